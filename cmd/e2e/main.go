@@ -0,0 +1,359 @@
+// Command e2e runs a deployment through a running DeployKnot server and checks that it reaches its
+// target: it registers a user, creates a deployment over the API, waits for the worker to finish it
+// and verifies the deployment's status, steps and logs, and optionally the deployed app.
+//
+// "make e2e" runs it against a dockerized target (sshd and Docker in Docker) with
+// docker-compose.e2e.yml. Against any other server and target it needs the target's SSH password
+// and the repository's PAT in E2E_SSH_PASSWORD and E2E_GITHUB_PAT.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+)
+
+func main() {
+	flags := flag.NewFlagSet("e2e", flag.ExitOnError)
+	apiURL := flags.String("api", "http://localhost:8080", "base URL of the DeployKnot server")
+	target := flags.String("target", "localhost", "IP or host name of the target to deploy to")
+	sshUser := flags.String("ssh-user", "root", "SSH user of the target")
+	repo := flags.String("repo", "https://github.com/e2e/app", "repository to deploy")
+	branch := flags.String("branch", "main", "branch to deploy")
+	port := flags.Int("port", 3000, "port the deployed app listens on")
+	appURL := flags.String("app-url", "", "URL the deployed app answers on from here; empty skips checking it")
+	appBody := flags.String("app-body", "", "text the deployed app's answer must contain")
+	steps := flags.String("steps", "validate_credentials,git_clone,docker_build,docker_run,health_check", "comma-separated steps that must complete")
+	timeout := flags.Duration("timeout", 10*time.Minute, "how long to wait for the server and the deployment")
+	flags.Parse(os.Args[1:])
+
+	r := &run{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		api:         strings.TrimSuffix(*apiURL, "/"),
+		sshPassword: os.Getenv("E2E_SSH_PASSWORD"),
+		pat:         os.Getenv("E2E_GITHUB_PAT"),
+	}
+	if r.sshPassword == "" || r.pat == "" {
+		fmt.Fprintln(os.Stderr, "error: set the target's SSH password in E2E_SSH_PASSWORD and the repository's PAT in E2E_GITHUB_PAT")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	// The API only takes the target's IP, so a host name such as compose's "target" is resolved here
+	targetIP, err := resolveTarget(ctx, *target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: %v\n", err)
+		os.Exit(1)
+	}
+	form := map[string]string{
+		"target_ip":       targetIP,
+		"ssh_username":    *sshUser,
+		"ssh_password":    r.sshPassword,
+		"github_repo_url": *repo,
+		"github_pat":      r.pat,
+		"github_branch":   *branch,
+		"port":            fmt.Sprint(*port),
+		"container_name":  "e2e-app",
+		"project_name":    "e2e",
+		"deployment_name": "e2e",
+	}
+	if err := r.deploy(ctx, form, strings.Split(*steps, ",")); err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: %v\n", err)
+		os.Exit(1)
+	}
+	if *appURL != "" {
+		if err := r.checkApp(ctx, *appURL, *appBody); err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Println("PASS")
+}
+
+// resolveTarget returns the IP of the target host, preferring IPv4
+func resolveTarget(ctx context.Context, host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve target %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.String(), nil
+		}
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("target %s has no IP", host)
+	}
+	return ips[0].String(), nil
+}
+
+// run is a run of the end-to-end test against a server
+type run struct {
+	client      *http.Client
+	api         string
+	token       string
+	sshPassword string
+	pat         string
+}
+
+// deploy signs up, deploys and checks the outcome of the deployment
+func (r *run) deploy(ctx context.Context, form map[string]string, requiredSteps []string) error {
+	if err := r.waitReady(ctx); err != nil {
+		return err
+	}
+	if err := r.signUp(ctx); err != nil {
+		return err
+	}
+
+	deployment, err := r.createDeployment(ctx, form)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created deployment %s\n", deployment.ID)
+	deployment, err = r.waitFinished(ctx, deployment.ID.String())
+	if err != nil {
+		return err
+	}
+
+	logs, err := r.logs(ctx, deployment.ID.String())
+	if err != nil {
+		return err
+	}
+	for _, entry := range logs {
+		// Secrets must never reach the logs, however a step fails
+		if strings.Contains(entry.Message, r.pat) || strings.Contains(entry.Message, r.sshPassword) {
+			return fmt.Errorf("log entry %d contains a secret of the deployment", entry.Seq)
+		}
+	}
+	if deployment.Status != models.DeploymentStatusCompleted {
+		for _, entry := range logs {
+			fmt.Fprintf(os.Stderr, "  [%s] %s\n", entry.LogLevel, entry.Message)
+		}
+		message := ""
+		if deployment.ErrorMessage != nil {
+			message = *deployment.ErrorMessage
+		}
+		return fmt.Errorf("deployment %s ended %s: %s", deployment.ID, deployment.Status, message)
+	}
+
+	var steps struct {
+		Steps []*models.DeploymentStep `json:"steps"`
+	}
+	if err := r.get(ctx, "/api/v1/deployments/"+deployment.ID.String()+"/steps", &steps); err != nil {
+		return err
+	}
+	completed := map[string]bool{}
+	for _, step := range steps.Steps {
+		fmt.Printf("  %-22s %s\n", step.StepName, step.Status)
+		if step.Status == models.DeploymentStatusFailed {
+			return fmt.Errorf("step %s failed although the deployment completed", step.StepName)
+		}
+		completed[step.StepName] = step.Status == models.DeploymentStatusCompleted
+	}
+	for _, name := range requiredSteps {
+		name = strings.TrimSpace(name)
+		if name != "" && !completed[name] {
+			return fmt.Errorf("step %s did not complete", name)
+		}
+		if name != "" && !slices.ContainsFunc(logs, func(entry *models.DeploymentLog) bool {
+			return entry.TaskName != nil && *entry.TaskName == name
+		}) {
+			return fmt.Errorf("step %s logged nothing", name)
+		}
+	}
+	fmt.Printf("Deployment %s completed with %d log entries\n", deployment.ID, len(logs))
+	return nil
+}
+
+// waitReady waits until the server is ready to serve requests
+func (r *run) waitReady(ctx context.Context) error {
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.api+"/health/ready", nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := r.client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server at %s did not become ready: %w", r.api, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// signUp registers a user of its own and logs in as it
+func (r *run) signUp(ctx context.Context) error {
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	username := "e2e-" + hex.EncodeToString(suffix)
+	password := hex.EncodeToString(suffix) + "-E2e!"
+
+	register := models.RegisterRequest{Username: username, Email: username + "@example.com", Password: password}
+	if err := r.postJSON(ctx, "/api/v1/auth/register", register, nil); err != nil {
+		return fmt.Errorf("failed to register: %w", err)
+	}
+	var login models.LoginResponse
+	if err := r.postJSON(ctx, "/api/v1/auth/login", models.LoginRequest{Username: username, Password: password}, &login); err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	r.token = login.Token
+	return nil
+}
+
+// createDeployment creates a deployment with an environment file from the form fields
+func (r *run) createDeployment(ctx context.Context, form map[string]string) (*models.Deployment, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range form {
+		writer.WriteField(key, value)
+	}
+	envFile, err := writer.CreateFormFile("env_file", "e2e.env")
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(envFile, "E2E=true\n")
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.api+"/api/v1/deployments", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	var deployment models.Deployment
+	if err := r.do(req, &deployment); err != nil {
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+	return &deployment, nil
+}
+
+// waitFinished polls a deployment until it stops running
+func (r *run) waitFinished(ctx context.Context, id string) (*models.Deployment, error) {
+	for {
+		var deployment models.Deployment
+		if err := r.get(ctx, "/api/v1/deployments/"+id, &deployment); err != nil {
+			return nil, err
+		}
+		switch deployment.Status {
+		case models.DeploymentStatusPending, models.DeploymentStatusRunning:
+		default:
+			return &deployment, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("deployment %s is still %s: %w", id, deployment.Status, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// logs returns all logs of a deployment
+func (r *run) logs(ctx context.Context, id string) ([]*models.DeploymentLog, error) {
+	var logs []*models.DeploymentLog
+	var after int64
+	for {
+		var page models.DeploymentLogPage
+		if err := r.get(ctx, fmt.Sprintf("/api/v1/deployments/%s/logs?after_seq=%d", id, after), &page); err != nil {
+			return nil, err
+		}
+		logs = append(logs, page.Logs...)
+		if !page.HasMore || page.NextAfterSeq <= after {
+			return logs, nil
+		}
+		after = page.NextAfterSeq
+	}
+}
+
+// checkApp checks that the deployed app answers on url with a body containing want
+func (r *run) checkApp(ctx context.Context, url, want string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("deployed app is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deployed app answered %s", resp.Status)
+	}
+	if !strings.Contains(string(body), want) {
+		return fmt.Errorf("deployed app's answer does not contain %q", want)
+	}
+	fmt.Printf("Deployed app answers on %s\n", url)
+	return nil
+}
+
+// get decodes the JSON response to a GET of path into out
+func (r *run) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.api+path, nil)
+	if err != nil {
+		return err
+	}
+	return r.do(req, out)
+}
+
+// postJSON posts in as JSON to path and decodes the response into out unless it is nil
+func (r *run) postJSON(ctx context.Context, path string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.api+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return r.do(req, out)
+}
+
+// do sends an API request as the signed up user and decodes a successful response into out
+func (r *run) do(req *http.Request, out any) error {
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return errors.Join(fmt.Errorf("%s %s: invalid response", req.Method, req.URL.Path), err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+	"deployknot/pkg/encryption"
+)
+
+// runBackup implements "server backup [-o file] [-passphrase-env VAR] [-without-logs]" and returns
+// the exit code
+func runBackup(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "", "file to write the backup to, - for stdout (default deployknot-<time>.backup)")
+	passphraseEnv := flags.String("passphrase-env", "BACKUP_PASSPHRASE", "environment variable holding the passphrase the backup is encrypted with")
+	withoutLogs := flags.Bool("without-logs", false, "leave out the deployment logs")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: server backup [-o file] [-passphrase-env VAR] [-without-logs]")
+		return 2
+	}
+	passphrase := os.Getenv(*passphraseEnv)
+	if len(passphrase) < services.MinBackupPassphraseLength {
+		fmt.Fprintf(os.Stderr, "error: set a passphrase of at least %d characters in %s\n", services.MinBackupPassphraseLength, *passphraseEnv)
+		return 2
+	}
+
+	service, closeDB, err := newBackupService(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer closeDB()
+
+	if *output == "" {
+		*output = "deployknot-" + time.Now().UTC().Format("20060102-150405") + ".backup"
+	}
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	summary, err := service.Export(context.Background(), w, passphrase, *withoutLogs)
+	if err == nil && *output != "-" {
+		err = w.(*os.File).Sync()
+	}
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if *output != "-" {
+		fmt.Printf("Wrote %s\n", *output)
+	}
+	printBackupSummary(summary)
+	return 0
+}
+
+// runRestore implements "server restore [-passphrase-env VAR] [-migrations dir] <file>" and returns
+// the exit code
+func runRestore(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	passphraseEnv := flags.String("passphrase-env", "BACKUP_PASSPHRASE", "environment variable holding the passphrase the backup is encrypted with")
+	migrations := flags.String("migrations", "migrations", "directory of the database migrations")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server restore [-passphrase-env VAR] [-migrations dir] <file, or - for stdin>")
+		return 2
+	}
+	passphrase := os.Getenv(*passphraseEnv)
+	if passphrase == "" {
+		fmt.Fprintf(os.Stderr, "error: set the backup's passphrase in %s\n", *passphraseEnv)
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		r = file
+	}
+
+	db, logger, closeDB, err := connectDatabase(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer closeDB()
+	encryptor, err := encryption.New(cfg.GetEncryptionKey())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	service := services.NewBackupService(db.Repository, encryptor, logger)
+
+	// The rows are restored into the schema they were backed up from, then migrated like an
+	// upgrade would migrate them
+	summary, err := service.Restore(context.Background(), r, passphrase, func(version uint) error {
+		return db.MigrateTo(*migrations, version)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Println("Restored the backup")
+	printBackupSummary(summary)
+	if err := db.RunMigrations(*migrations); err != nil {
+		fmt.Fprintf(os.Stderr, "error: the backup is restored, but migrating it failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// newBackupService connects to the database for a backup command; the returned function closes it
+func newBackupService(cfg *config.Config) (*services.BackupService, func(), error) {
+	db, logger, closeDB, err := connectDatabase(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptor, err := encryption.New(cfg.GetEncryptionKey())
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+	return services.NewBackupService(db.Repository, encryptor, logger), closeDB, nil
+}
+
+// printBackupSummary prints the rows of a backup per table to stderr, keeping stdout clean for a
+// backup written there
+func printBackupSummary(summary *models.BackupSummary) {
+	tables := make([]string, 0, len(summary.Rows))
+	for table := range summary.Rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	fmt.Fprintf(os.Stderr, "Schema version %d\n", summary.SchemaVersion)
+	for _, table := range tables {
+		fmt.Fprintf(os.Stderr, "  %-32s %d rows\n", table, summary.Rows[table])
+	}
+}
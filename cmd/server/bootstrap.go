@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// runBootstrapTarget implements "server bootstrap-target [flags] <project> <target>" and returns
+// the exit code
+func runBootstrapTarget(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("bootstrap-target", flag.ContinueOnError)
+	adminUser := flags.String("admin-user", "root", "user to set the target up as; other users than root need passwordless sudo")
+	identity := flags.String("identity", "", "private key file of the admin user")
+	passwordEnv := flags.String("password-env", "BOOTSTRAP_SSH_PASSWORD", "environment variable holding the admin user's password")
+	deployUser := flags.String("deploy-user", models.DefaultDeployUser, "user to create for deployments")
+	keyOut := flags.String("key-out", "", "file to write the deploy user's private key to (default deployknot_<target>_ed25519)")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: server bootstrap-target [-admin-user root] [-identity file] [-password-env VAR] [-deploy-user deployknot] [-key-out file] <project> <target>")
+		return 2
+	}
+	project, targetName := flags.Arg(0), flags.Arg(1)
+	if *keyOut == "" {
+		*keyOut = "deployknot_" + targetName + "_ed25519"
+	}
+
+	var auth []ssh.AuthMethod
+	if *identity != "" {
+		key, err := os.ReadFile(*identity)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to parse %s: %v\n", *identity, err)
+			return 1
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password := os.Getenv(*passwordEnv); password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		fmt.Fprintf(os.Stderr, "error: give the admin user's key with -identity or its password in %s\n", *passwordEnv)
+		return 2
+	}
+
+	// Create the key file first, so an existing key is never overwritten and no credentials are
+	// rotated when it cannot be written
+	keyFile, err := os.OpenFile(*keyOut, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	keyWritten := false
+	defer func() {
+		keyFile.Close()
+		if !keyWritten {
+			os.Remove(*keyOut)
+		}
+	}()
+
+	service, closeDB, err := newProjectService(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer closeDB()
+
+	result, err := service.BootstrapTarget(context.Background(), project, targetName, services.TargetBootstrapOptions{
+		AdminUser:  *adminUser,
+		AdminAuth:  auth,
+		DeployUser: *deployUser,
+		Timeout:    30 * time.Second,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if _, err := keyFile.WriteString(result.PrivateKey); err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to write %s: %v\n", *keyOut, err)
+		fmt.Fprint(os.Stderr, result.PrivateKey)
+	} else {
+		keyWritten = true
+	}
+
+	fmt.Printf("Bootstrapped target %q of project %q at %s\n", result.Target.Name, project, result.Target.TargetIP)
+	fmt.Printf("  ssh_username:         %s\n", result.Username)
+	fmt.Printf("  ssh_password:         %s\n", result.Password)
+	fmt.Printf("  private key:          %s\n", *keyOut)
+	fmt.Printf("  key fingerprint:      %s\n", *result.Target.SSHKeyFingerprint)
+	fmt.Printf("  host key fingerprint: %s\n", *result.Target.SSHHostKeyFingerprint)
+	fmt.Printf("  docker version:       %s\n", result.DockerVersion)
+	if !result.PasswordLogin {
+		fmt.Fprintln(os.Stderr, "warning: the SSH server does not accept the password, which deployments log in with; enable PasswordAuthentication for the deploy user")
+	}
+	fmt.Println("The password and key are only shown here; store them in your secret manager.")
+	return 0
+}
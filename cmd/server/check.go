@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runCheck prints a configuration report, verifies database, Redis and NATS connectivity and returns the exit code
+func runCheck(cfg *config.Config) int {
+	fmt.Println("DeployKnot configuration report")
+	fmt.Println()
+	printSection("Server", [][2]string{
+		{"SERVER_PORT", cfg.Server.Port},
+		{"SERVER_READ_TIMEOUT", cfg.Server.ReadTimeout.String()},
+		{"SERVER_WRITE_TIMEOUT", cfg.Server.WriteTimeout.String()},
+		{"SERVER_IDLE_TIMEOUT", cfg.Server.IdleTimeout.String()},
+		{"SERVER_WITH_WORKER", fmt.Sprint(cfg.Server.WithWorker)},
+		{"WORKER_API_ENABLED", fmt.Sprint(cfg.WorkerAPI.Enabled)},
+		{"WORKER_API_PORT", cfg.WorkerAPI.Port},
+		{"GRAPHQL_ENABLED", fmt.Sprint(cfg.GraphQL.Enabled)},
+	})
+	printSection("Database", [][2]string{
+		{"DB_DRIVER", cfg.Database.Driver},
+		{"SQLITE_PATH", cfg.Database.SQLitePath},
+		{"DB_HOST", cfg.Database.Host},
+		{"DB_PORT", cfg.Database.Port},
+		{"DB_USER", cfg.Database.User},
+		{"DB_PASSWORD", maskSecret(cfg.Database.Password)},
+		{"DB_NAME", cfg.Database.DBName},
+		{"DB_SSLMODE", cfg.Database.SSLMode},
+		{"DB_SCHEMA", cfg.Database.Schema},
+		{"DB_REPLICA_URL", maskSecret(cfg.Database.ReplicaURL)},
+	})
+	printSection("Redis", [][2]string{
+		{"REDIS_EMBEDDED", fmt.Sprint(cfg.Redis.Embedded)},
+		{"REDIS_HOST", cfg.Redis.Host},
+		{"REDIS_PORT", cfg.Redis.Port},
+		{"REDIS_PASSWORD", maskSecret(cfg.Redis.Password)},
+		{"REDIS_DB", fmt.Sprint(cfg.Redis.DB)},
+		{"DEPLOYMENT_CACHE_TTL", cfg.Cache.DeploymentTTL.String()},
+		{"QUEUE_JOB_TTL", cfg.Queue.JobTTL.String()},
+		{"QUEUE_BACKEND", cfg.Queue.Backend},
+		{"NATS_URL", cfg.Queue.NATSURL},
+		{"NATS_STREAM", cfg.Queue.NATSStream},
+		{"NATS_REPLICAS", fmt.Sprint(cfg.Queue.NATSReplicas)},
+	})
+	printSection("Security", [][2]string{
+		{"JWT_SECRET", maskSecret(cfg.JWT.Secret)},
+		{"JWT_KEY_ID", cfg.JWT.KeyID},
+		{"JWT_PREVIOUS_SECRET", maskSecret(cfg.JWT.PreviousSecret)},
+		{"JWT_PREVIOUS_KEY_ID", cfg.JWT.PreviousKeyID},
+		{"ENCRYPTION_KEY", maskSecret(cfg.EncryptionKey)},
+	})
+	printSection("TLS", [][2]string{
+		{"TLS_CERT_FILE", cfg.TLS.CertFile},
+		{"TLS_KEY_FILE", cfg.TLS.KeyFile},
+		{"TLS_AUTOCERT_DOMAINS", strings.Join(cfg.TLS.AutocertDomains, ",")},
+		{"TLS_AUTOCERT_CACHE_DIR", cfg.TLS.AutocertCacheDir},
+		{"TLS_AUTOCERT_EMAIL", cfg.TLS.AutocertEmail},
+		{"TLS_REDIRECT_HTTP", fmt.Sprint(cfg.TLS.RedirectHTTP)},
+		{"TLS_HTTP_PORT", cfg.TLS.HTTPPort},
+	})
+	printSection("HTTP", [][2]string{
+		{"CORS_ALLOWED_ORIGINS", strings.Join(cfg.CORS.AllowedOrigins, ",")},
+		{"CORS_ALLOW_CREDENTIALS", fmt.Sprint(cfg.CORS.AllowCredentials)},
+		{"HSTS_MAX_AGE", cfg.Headers.HSTSMaxAge.String()},
+		{"HSTS_INCLUDE_SUBDOMAINS", fmt.Sprint(cfg.Headers.HSTSIncludeSubdomains)},
+		{"FRAME_OPTIONS", cfg.Headers.FrameOptions},
+		{"MAX_REQUEST_BODY_SIZE", fmt.Sprint(cfg.Uploads.MaxBodySize)},
+		{"MAX_MULTIPART_MEMORY", fmt.Sprint(cfg.Uploads.MaxMultipartMemory)},
+		{"MAX_ENV_FILE_SIZE", fmt.Sprint(cfg.Uploads.MaxEnvFileSize)},
+	})
+	printSection("Worker", [][2]string{
+		{"WORKER_DOCKER_BACKEND", cfg.Worker.DockerBackend},
+		{"WORKER_DOCKER_SOCKET", cfg.Worker.DockerSocket},
+		{"WORKER_SECRET_SCAN", cfg.Worker.SecretScan},
+	})
+	printSection("Pre-flight", [][2]string{
+		{"PREFLIGHT_ENABLED", fmt.Sprint(cfg.Preflight.Enabled)},
+		{"PREFLIGHT_SSH_CHECK", fmt.Sprint(cfg.Preflight.SSHCheck)},
+		{"GITHUB_API_URL", cfg.Preflight.GitHubAPIURL},
+		{"PREFLIGHT_TIMEOUT", cfg.Preflight.Timeout.String()},
+	})
+	printSection("Changelogs", [][2]string{
+		{"CHANGELOG_ENABLED", fmt.Sprint(cfg.Changelog.Enabled)},
+		{"CHANGELOG_TIMEOUT", cfg.Changelog.Timeout.String()},
+	})
+	printSection("GitHub deployments", [][2]string{
+		{"GITHUB_DEPLOYMENTS_ENABLED", fmt.Sprint(cfg.GitHub.Enabled)},
+		{"GITHUB_DEPLOYMENTS_PUBLIC_URL", cfg.GitHub.PublicURL},
+		{"GITHUB_DEPLOYMENTS_INTERVAL", cfg.GitHub.Interval.String()},
+	})
+	printSection("Leader election", [][2]string{
+		{"LEADER_ELECTION_ENABLED", fmt.Sprint(cfg.Leader.Enabled)},
+		{"LEADER_LEASE_TTL", cfg.Leader.LeaseTTL.String()},
+		{"LEADER_RENEW_INTERVAL", cfg.Leader.RenewInterval.String()},
+	})
+	printSection("Startup", [][2]string{
+		{"STARTUP_CONNECT_RETRIES", fmt.Sprint(cfg.Startup.ConnectRetries)},
+		{"STARTUP_CONNECT_BACKOFF", cfg.Startup.ConnectBackoff.String()},
+		{"LOG_LEVEL", cfg.Logging.Level},
+	})
+
+	ok := true
+	if err := cfg.Validate(); err != nil {
+		ok = false
+		fmt.Println("Validation: FAILED")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Printf("  - %s\n", line)
+		}
+	} else {
+		fmt.Println("Validation: OK")
+	}
+	for _, warning := range cfg.Warnings() {
+		fmt.Printf("  warning: %s\n", warning)
+	}
+	fmt.Println()
+
+	// Connectivity checks log retries to stderr so the report stays readable
+	checkLogger := logrus.New()
+	checkLogger.SetOutput(os.Stderr)
+	checkLogger.SetLevel(logrus.WarnLevel)
+
+	dbErr := database.WithRetry("database", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, checkLogger, func() error {
+		db, err := database.New(cfg.GetDatabaseURL(), checkLogger)
+		if err != nil {
+			return err
+		}
+		return db.Close()
+	})
+	ok = printResult("Database connectivity", dbErr) && ok
+
+	if cfg.Database.ReplicaURL != "" {
+		replicaErr := database.WithRetry("read replica", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, checkLogger, func() error {
+			db, err := database.New(cfg.GetDatabaseURL(), checkLogger)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return db.ConnectReplica(cfg.Database.ReplicaURL)
+		})
+		ok = printResult("Read replica connectivity", replicaErr) && ok
+	}
+
+	redisErr := database.WithRetry("Redis", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, checkLogger, func() error {
+		redis, err := database.NewRedis(cfg.GetRedisURL(), checkLogger)
+		if err != nil {
+			return err
+		}
+		return redis.Close()
+	})
+	ok = printResult("Redis connectivity", redisErr) && ok
+
+	if cfg.Queue.Backend == config.QueueBackendNATS {
+		natsErr := database.WithRetry("NATS", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, checkLogger, func() error {
+			queue, err := services.NewJobQueue(cfg.Queue, nil, checkLogger)
+			if err != nil {
+				return err
+			}
+			return queue.Close()
+		})
+		ok = printResult("NATS connectivity", natsErr) && ok
+	}
+
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// printSection prints a titled list of configuration values
+func printSection(title string, values [][2]string) {
+	fmt.Printf("[%s]\n", title)
+	for _, kv := range values {
+		fmt.Printf("  %-24s %s\n", kv[0], kv[1])
+	}
+	fmt.Println()
+}
+
+// printResult prints the outcome of a check and reports whether it passed
+func printResult(name string, err error) bool {
+	if err != nil {
+		fmt.Printf("%s: FAILED (%v)\n", name, err)
+		return false
+	}
+	fmt.Printf("%s: OK\n", name)
+	return true
+}
+
+// maskSecret hides a secret while showing whether it is set
+func maskSecret(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	return fmt.Sprintf("******** (%d characters)", len(secret))
+}
@@ -2,19 +2,25 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
-	"deployknot/internal/api"
+	"deployknot/internal/app"
 	"deployknot/internal/config"
-	"deployknot/internal/database"
-	"deployknot/internal/services"
+	"deployknot/internal/worker"
+	"deployknot/internal/workerapi"
 	"deployknot/pkg/logger"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -24,34 +30,87 @@ func main() {
 		logrus.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Subcommands run instead of the server and exit
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			// "server check" prints a configuration report
+			os.Exit(runCheck(cfg))
+		case "export-project":
+			os.Exit(runExportProject(cfg, os.Args[2:]))
+		case "import-project":
+			os.Exit(runImportProject(cfg, os.Args[2:]))
+		case "bootstrap-target":
+			os.Exit(runBootstrapTarget(cfg, os.Args[2:]))
+		case "backup":
+			os.Exit(runBackup(cfg, os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(cfg, os.Args[2:]))
+		case "serve":
+			// "server serve [-with-worker]" starts the server like no subcommand does
+			flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+			withWorker := flags.Bool("with-worker", cfg.Server.WithWorker, "run a deployment worker in the server process")
+			if err := flags.Parse(os.Args[2:]); err != nil || flags.NArg() != 0 {
+				fmt.Fprintln(os.Stderr, "usage: server serve [-with-worker]")
+				os.Exit(2)
+			}
+			cfg.Server.WithWorker = *withWorker
+		}
+	}
+
 	// Initialize logger
 	log := logger.New(cfg.Logging.Level)
 	log.Info("Starting DeployKnot server...")
 
-	// Initialize database
-	db, err := database.New(cfg.GetDatabaseURL(), log.Logger)
+	// Validate configuration
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	for _, warning := range cfg.Warnings() {
+		log.Warn(warning)
+	}
+
+	// Wire up the application
+	application, err := app.New(cfg, log.Logger)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		log.Fatalf("Failed to initialize application: %v", err)
 	}
-	defer db.Close()
+	defer application.Close()
 
 	// Run database migrations
-	if err := db.RunMigrations("migrations"); err != nil {
+	if err := application.Migrate("migrations"); err != nil {
 		log.Fatalf("Failed to run database migrations: %v", err)
 	}
 
-	// Initialize Redis
-	redis, err := database.NewRedis(cfg.GetRedisURL(), log.Logger)
-	if err != nil {
-		log.Fatalf("Failed to initialize Redis: %v", err)
+	// Grant the admin role to the configured users
+	if err := application.UserService.PromoteAdmins(context.Background(), cfg.Admin.Usernames); err != nil {
+		log.Fatalf("Failed to promote admin users: %v", err)
 	}
-	defer redis.Close()
 
-	// Initialize queue service
-	queueService := services.NewQueueService(redis.Client, log.Logger)
+	// Run the background components; with leader election, only on the elected server
+	publisherCtx, stopPublisher := context.WithCancel(context.Background())
+	defer stopPublisher()
+	backgroundDone := make(chan struct{})
+	go func() {
+		defer close(backgroundDone)
+		application.LeaderElector.Run(publisherCtx, func(ctx context.Context) {
+			runBackground(ctx, application, cfg)
+		})
+	}()
+
+	// Run a deployment worker in this process; it shares the application's connections
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	workerDone := make(chan error, 1)
+	if cfg.Server.WithWorker {
+		log.Info("Starting embedded deployment worker...")
+		go func() {
+			workerDone <- worker.Run(workerCtx, application, cfg, log.Logger)
+		}()
+	}
 
 	// Initialize router
-	router := api.SetupRouter(db, queueService, log.Logger, cfg.GetJWTSecret())
+	router := application.Router()
 
 	// Create HTTP server
 	server := &http.Server{
@@ -62,20 +121,86 @@ func main() {
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
+	// Configure TLS and the plain HTTP listener used for redirects and ACME challenges
+	var httpServer *http.Server
+	if cfg.TLS.Enabled() {
+		httpHandler, err := setupTLS(server, cfg.TLS, log.Logger)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		if httpHandler != nil {
+			httpServer = &http.Server{
+				Addr:         ":" + cfg.TLS.HTTPPort,
+				Handler:      httpHandler,
+				ReadTimeout:  cfg.Server.ReadTimeout,
+				WriteTimeout: cfg.Server.WriteTimeout,
+				IdleTimeout:  cfg.Server.IdleTimeout,
+			}
+		}
+	}
+
 	// Start server in a goroutine
 	go func() {
-		log.Infof("Server starting on port %s", cfg.Server.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLS.Enabled() {
+			log.Infof("Server starting with TLS on port %s", cfg.Server.Port)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Infof("Server starting on port %s", cfg.Server.Port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
+	if httpServer != nil {
+		go func() {
+			log.Infof("HTTP listener starting on port %s", cfg.TLS.HTTPPort)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start HTTP listener: %v", err)
+			}
+		}()
+	}
+
+	// Serve the worker API on its own port; it uses the server's certificate when TLS is configured
+	var grpcServer *grpc.Server
+	if cfg.WorkerAPI.Enabled {
+		listener, err := net.Listen("tcp", ":"+cfg.WorkerAPI.Port)
+		if err != nil {
+			log.Fatalf("Failed to listen for the worker API: %v", err)
+		}
+		opts := workerapi.AuthOptions(application.WorkerTokenService)
+		if cfg.TLS.Enabled() {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(server.TLSConfig)))
+		}
+		grpcServer = grpc.NewServer(opts...)
+		workerapi.RegisterWorkerServiceServer(grpcServer, application.WorkerAPI)
+		go func() {
+			log.Infof("Worker API starting on port %s", cfg.WorkerAPI.Port)
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Fatalf("Failed to start worker API: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case err := <-workerDone:
+		log.Fatalf("Embedded worker failed: %v", err)
+	}
 
 	log.Info("Shutting down server...")
+	stopPublisher()
+	// Let the leader hand over to another server before this one stops
+	select {
+	case <-backgroundDone:
+	case <-time.After(10 * time.Second):
+		log.Warn("Background components did not stop in time")
+	}
 
 	// Create a deadline for server shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -85,6 +210,95 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Errorf("Server forced to shutdown: %v", err)
 	}
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Errorf("HTTP listener forced to shutdown: %v", err)
+		}
+	}
+	if grpcServer != nil {
+		// Lease calls wait up to 30 seconds for a job, so stop them rather than wait
+		grpcServer.Stop()
+	}
+
+	// Stop the embedded worker once no more deployments can be created, before the application's
+	// connections are closed
+	if cfg.Server.WithWorker {
+		log.Info("Shutting down embedded worker...")
+		stopWorker()
+		select {
+		case <-workerDone:
+		case <-time.After(worker.ShutdownTimeout):
+			log.Warn("Embedded worker did not stop in time")
+		}
+	}
 
 	log.Info("Server exited")
 }
+
+// runBackground runs the background components until ctx is cancelled and returns once they stopped
+func runBackground(ctx context.Context, application *app.App, cfg *config.Config) {
+	var wg sync.WaitGroup
+	run := func(component func(ctx context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			component(ctx)
+		}()
+	}
+
+	// Publish deployment jobs buffered while Redis was unavailable
+	run(application.OutboxPublisher.Run)
+
+	// Advise on resizing the worker fleet as the backlog changes
+	if cfg.Autoscale.AdvisoriesEnabled {
+		run(application.Autoscaler.Run)
+	}
+
+	// Delete deployment artifacts past their retention
+	if cfg.Artifacts.Retention > 0 {
+		run(application.ArtifactService.Run)
+	}
+
+	// Create the deployments of due schedules
+	if cfg.Scheduler.Enabled {
+		run(application.Scheduler.Run)
+	}
+
+	// Back up managed services whose scheduled backup is due
+	if cfg.VolumeBackups.Enabled() {
+		run(application.VolumeBackupService.Run)
+	}
+
+	// Collect the runs of cron jobs from the targets they run on
+	if cfg.CronJobs.CollectEnabled {
+		run(application.CronJobService.Run)
+	}
+
+	// Fail deployments whose gates were not reported in time
+	run(application.GateMonitor.Run)
+
+	// Queue the next service of application releases once the one before it has completed
+	run(application.ReleaseMonitor.Run)
+
+	// Send project deployment digests and escalate deployments that stay failed
+	if len(cfg.Notifications.Channels) > 0 {
+		run(application.Notifier.Run)
+	}
+
+	// Raise incidents for failed deployments and resolve them once a later deployment completes
+	if len(cfg.Incidents.Services) > 0 {
+		run(application.IncidentReporter.Run)
+	}
+
+	// Show the live status of deployments in the environments of their GitHub repositories
+	if cfg.GitHub.Enabled {
+		run(application.GitHubReporter.Run)
+	}
+
+	// Mirror deployment logs to the configured external log sinks
+	if len(cfg.LogSinks.Sinks) > 0 {
+		run(application.LogShipper.Run)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runExportProject implements "server export-project [-o file] <name>" and returns the exit code
+func runExportProject(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("export-project", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write the YAML configuration to (- for stdout)")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server export-project [-o file] <project name>")
+		return 2
+	}
+
+	service, closeDB, err := newProjectService(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer closeDB()
+
+	projectConfig, err := service.ExportProject(context.Background(), flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	data, err := services.MarshalProjectConfig(projectConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runImportProject implements "server import-project [-dry-run] <file>" and returns the exit code
+func runImportProject(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("import-project", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only validate the configuration")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: server import-project [-dry-run] <file, or - for stdin>")
+		return 2
+	}
+
+	var data []byte
+	var err error
+	if path := flags.Arg(0); path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	projectConfig, err := services.ParseProjectConfig(data)
+	if err == nil {
+		err = services.ValidateProjectConfig(projectConfig)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if *dryRun {
+		fmt.Printf("Project %q is valid: %d templates, %d targets, %d freeze windows, %d gates, %d escalations\n", projectConfig.Project.Name, len(projectConfig.Templates), len(projectConfig.Targets), len(projectConfig.FreezeWindows), len(projectConfig.Gates), escalationCount(projectConfig))
+		return 0
+	}
+
+	service, closeDB, err := newProjectService(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	defer closeDB()
+
+	result, err := service.ImportProject(context.Background(), projectConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	action := "Updated"
+	if result.Created {
+		action = "Created"
+	}
+	fmt.Printf("%s project %q: %d templates, %d targets, %d freeze windows, %d gates, %d escalations\n", action, result.Project.Name, result.Templates, result.Targets, result.FreezeWindows, result.Gates, result.Escalations)
+	return 0
+}
+
+// escalationCount returns the number of escalation policies of a project configuration
+func escalationCount(projectConfig *models.ProjectConfig) int {
+	if projectConfig.Notifications == nil {
+		return 0
+	}
+	return len(projectConfig.Notifications.Escalations)
+}
+
+// newProjectService connects to the database for a project command; the returned function closes it
+func newProjectService(cfg *config.Config) (*services.ProjectService, func(), error) {
+	db, logger, closeDB, err := connectDatabase(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return services.NewProjectService(db.Repository, logger), closeDB, nil
+}
+
+// connectDatabase connects to the database for a command; the returned function closes it
+func connectDatabase(cfg *config.Config) (*database.Database, *logrus.Logger, func(), error) {
+	// Keep stdout clean for the exported YAML and backups
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+
+	var db *database.Database
+	err := database.WithRetry("database", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, logger, func() error {
+		var err error
+		db, err = database.New(cfg.GetDatabaseURL(), logger)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	closeDB := func() {
+		if err := db.Close(); err != nil {
+			logger.WithError(err).Error("Failed to close database")
+		}
+	}
+	return db, logger, closeDB, nil
+}
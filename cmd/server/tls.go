@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"deployknot/internal/config"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certReloadInterval limits how often certificate files are checked for changes
+const certReloadInterval = time.Minute
+
+// certReloader serves a certificate from disk and reloads it when the files change,
+// so renewed certificates are picked up without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *logrus.Logger
+
+	mu          sync.RWMutex
+	cert        *tls.Certificate
+	modTime     time.Time
+	lastChecked time.Time
+}
+
+// newCertReloader loads the certificate and key from disk
+func newCertReloader(certFile, keyFile string, logger *logrus.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the certificate and key from disk
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.lastChecked = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// latestModTime returns the most recent modification time of the certificate and key files
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the files changed
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert, modTime, due := r.cert, r.modTime, time.Since(r.lastChecked) >= certReloadInterval
+	r.mu.RUnlock()
+
+	if due {
+		r.mu.Lock()
+		r.lastChecked = time.Now()
+		r.mu.Unlock()
+
+		if latest, err := r.latestModTime(); err == nil && latest.After(modTime) {
+			if err := r.reload(); err != nil {
+				// Keep serving the previous certificate until the new files are valid
+				r.logger.WithError(err).Error("Failed to reload TLS certificate")
+			} else {
+				r.logger.Info("TLS certificate reloaded")
+				r.mu.RLock()
+				cert = r.cert
+				r.mu.RUnlock()
+			}
+		}
+	}
+
+	return cert, nil
+}
+
+// setupTLS configures server for HTTPS and returns the handler for the plain HTTP listener,
+// which is nil when no HTTP listener is needed
+func setupTLS(server *http.Server, cfg config.TLSConfig, logger *logrus.Logger) (http.Handler, error) {
+	var httpHandler http.Handler
+	if cfg.RedirectHTTP {
+		httpHandler = http.HandlerFunc(redirectToHTTPS(server.Addr))
+	}
+
+	if cfg.UsesAutocert() {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Email:      cfg.AutocertEmail,
+		}
+		// autocert renews certificates in the background; its TLS config also enables HTTP/2
+		server.TLSConfig = manager.TLSConfig()
+		// The HTTP listener answers ACME HTTP-01 challenges and falls back to httpHandler
+		return manager.HTTPHandler(httpHandler), nil
+	}
+
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	server.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	return httpHandler, nil
+}
+
+// redirectToHTTPS redirects plain HTTP requests to the HTTPS listener on httpsAddr
+func redirectToHTTPS(httpsAddr string) http.HandlerFunc {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
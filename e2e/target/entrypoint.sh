@@ -0,0 +1,30 @@
+#!/bin/sh
+# Starts the end-to-end target: root logs in with E2E_SSH_PASSWORD, and github.com/$E2E_REPO
+# (default e2e/app) is the app in /srv/e2e-app for git and curl given E2E_GITHUB_PAT
+set -e
+: "${E2E_SSH_PASSWORD:?set the root password of the target}"
+: "${E2E_GITHUB_PAT:?set the PAT the repository accepts}"
+E2E_REPO=${E2E_REPO:-e2e/app}
+
+echo "root:$E2E_SSH_PASSWORD" | chpasswd
+ssh-keygen -A
+
+# Serve the app as the only branch, main, of a local repository
+mkdir -p /etc/e2e
+printf '%s' "$E2E_GITHUB_PAT" > /etc/e2e/pat
+chmod 600 /etc/e2e/pat
+work=$(mktemp -d)
+cp -r /srv/e2e-app/. "$work"
+git -C "$work" init -q -b main
+git -C "$work" add -A
+git -C "$work" -c user.name=e2e -c user.email=e2e@example.com commit -qm "E2E app"
+rm -rf "/srv/git/$E2E_REPO.git"
+git clone -q --bare "$work" "/srv/git/$E2E_REPO.git"
+rm -rf "$work"
+
+# Clone URLs carry the PAT, so only URLs with the right one reach the local repository; others go
+# to GitHub and fail
+git config --system "url./srv/git/.insteadOf" "https://$E2E_GITHUB_PAT@github.com/"
+
+dind dockerd > /var/log/dockerd.log 2>&1 &
+exec /usr/sbin/sshd -D -e -o PermitRootLogin=yes -o PasswordAuthentication=yes
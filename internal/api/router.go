@@ -1,10 +1,12 @@
 package api
 
 import (
-	"deployknot/internal/database"
+	"compress/gzip"
+	"deployknot/internal/config"
+	"deployknot/internal/graphqlapi"
 	"deployknot/internal/handlers"
 	"deployknot/internal/middleware"
-	"deployknot/internal/services"
+	"deployknot/internal/models"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -12,26 +14,85 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Dependencies holds the components the router is built from; they are constructed once by the app package
+type Dependencies struct {
+	Config                *config.Config
+	Logger                *logrus.Logger
+	AuthMiddleware        *middleware.AuthMiddleware
+	AuthHandler           *handlers.AuthHandler
+	DeploymentHandler     *handlers.DeploymentHandler
+	AdminHandler          *handlers.AdminHandler
+	ProjectHandler        *handlers.ProjectHandler
+	ViewHandler           *handlers.ViewHandler
+	ScheduleHandler       *handlers.ScheduleHandler
+	ApplicationHandler    *handlers.ApplicationHandler
+	ManagedServiceHandler *handlers.ManagedServiceHandler
+	VolumeBackupHandler   *handlers.VolumeBackupHandler
+	CronJobHandler        *handlers.CronJobHandler
+	JobHandler            *handlers.JobHandler
+	OAuthHandler          *handlers.OAuthHandler
+	SessionHandler        *handlers.SessionHandler
+	SCIMHandler           *handlers.SCIMHandler
+	SlackHandler          *handlers.SlackHandler
+	APIKeyHandler         *handlers.APIKeyHandler
+	CIHandler             *handlers.CIHandler
+	GateHandler           *handlers.GateHandler
+	StatusHandler         *handlers.StatusHandler
+	ExecHandler           *handlers.ExecHandler
+	FileHandler           *handlers.FileHandler
+	ArtifactHandler       *handlers.ArtifactHandler
+	HealthHandler         *handlers.HealthHandler
+	MetricsHandler        *handlers.MetricsHandler
+	GraphQL               *graphqlapi.Server
+	RoleLookup            middleware.RoleLookup
+	OrganizationLookup    middleware.OrganizationLookup
+	ActiveUserLookup      middleware.ActiveUserLookup
+	NetworkLookup         middleware.NetworkLookup
+	APIKeyLookup          middleware.APIKeyLookup
+	AuditRecorder         middleware.AuditRecorder
+}
+
 // SetupRouter configures the API routes
-func SetupRouter(db *database.Database, queue *services.QueueService, logger *logrus.Logger, jwtSecret string) *gin.Engine {
+func SetupRouter(deps Dependencies) *gin.Engine {
+	cfg, logger := deps.Config, deps.Logger
 	router := gin.New()
 
 	// Set Gin mode based on environment
 	gin.SetMode(gin.ReleaseMode)
 
+	// Multipart forms beyond this size are buffered to temporary files
+	router.MaxMultipartMemory = cfg.Uploads.MaxMultipartMemory
+
+	// Client IPs are only taken from forwarding headers set by trusted proxies; the list is validated at
+	// startup. Gin trusts every proxy unless told otherwise.
+	if cfg.Access.TrustsNoProxies() {
+		router.SetTrustedProxies(nil)
+	} else {
+		router.SetTrustedProxies(cfg.Access.TrustedProxies)
+	}
+
 	// Recovery middleware
 	router.Use(gin.Recovery())
 
+	// Request body size limit
+	router.Use(middleware.BodySizeLimit(cfg.Uploads.MaxBodySize))
+
+	// Security headers middleware
+	router.Use(middleware.SecurityHeaders(cfg.Headers))
+
 	// CORS middleware
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
+		AllowOrigins:     cfg.CORS.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: false, // Set to false for AllowOrigins: ["*"]
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "If-None-Match", "X-API-Key"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"},
+		AllowCredentials: cfg.CORS.AllowCredentials, // Not allowed together with AllowOrigins: ["*"]
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Response compression middleware
+	router.Use(middleware.Gzip(gzip.DefaultCompression))
+
 	// Logging middleware
 	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		logger.WithFields(logrus.Fields{
@@ -47,7 +108,24 @@ func SetupRouter(db *database.Database, queue *services.QueueService, logger *lo
 	}))
 
 	// Health check endpoint (no auth required)
-	router.GET("/health", handlers.HealthCheck)
+	router.GET("/health", deps.HealthHandler.HealthCheck)
+	router.GET("/health/ready", deps.HealthHandler.HealthCheck)
+	router.GET("/health/live", handlers.HealthCheck)
+
+	// Queue metrics for autoscalers, protected by METRICS_TOKEN when it is set
+	metrics := router.Group("/metrics")
+	if cfg.Autoscale.MetricsToken != "" {
+		metrics.Use(middleware.StaticBearerToken(cfg.Autoscale.MetricsToken))
+	}
+	{
+		metrics.GET("", deps.MetricsHandler.GetPrometheusMetrics)
+		metrics.GET("/queue", deps.MetricsHandler.GetQueueMetrics)
+	}
+
+	// Public status pages of the projects that opt in (no auth required)
+	if cfg.StatusPage.Enabled {
+		router.GET("/status/:id", deps.StatusHandler.GetStatusPage)
+	}
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
@@ -55,37 +133,233 @@ func SetupRouter(db *database.Database, queue *services.QueueService, logger *lo
 		// Auth routes (no auth required)
 		auth := v1.Group("/auth")
 		{
-			authHandler := handlers.NewAuthHandler(
-				services.NewUserService(db.Repository, logger),
-				middleware.NewAuthMiddleware(jwtSecret, logger),
-				logger,
-			)
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			auth.POST("/register", deps.AuthHandler.Register)
+			auth.POST("/login", deps.AuthHandler.Login)
+			auth.GET("/oauth/providers", deps.OAuthHandler.ListProviders)
+			auth.GET("/oauth/:provider/start", deps.OAuthHandler.Start)
+			auth.GET("/oauth/:provider/callback", deps.OAuthHandler.Callback)
+		}
+
+		if cfg.StatusPage.Enabled {
+			v1.GET("/status/:id", deps.StatusHandler.GetStatus)
+		}
+
+		// Deployment status badges, public or authenticated with the project's badge token
+		v1.GET("/projects/:id/badge.svg", deps.StatusHandler.GetBadge)
+
+		// Public keys of the SSH certificate authority for the targets' TrustedUserCAKeys
+		v1.GET("/ssh-ca/trusted-keys", deps.AdminHandler.GetSSHCATrustedKeys)
+
+		// Slack slash commands, authenticated with the signature of the Slack app
+		if cfg.Slack.Enabled() {
+			v1.POST("/slack/commands", middleware.SlackSignature(cfg.Slack.SigningSecret), deps.SlackHandler.Command)
 		}
 
 		// Protected routes (auth required)
 		protected := v1.Group("")
-		protected.Use(middleware.NewAuthMiddleware(jwtSecret, logger).AuthRequired())
+		protected.Use(deps.AuthMiddleware.AuthRequired())
+		protected.Use(middleware.RequireActiveUser(deps.ActiveUserLookup))
+		protected.Use(middleware.OrganizationScope(deps.OrganizationLookup))
+
+		// Deployment creation and access to targets are limited to the allowed networks; API_ALLOWED_CIDRS is validated at startup
+		globalNetworks, _ := models.ParseCIDRs(cfg.Access.AllowedCIDRs)
+		allowlist := middleware.IPAllowlist(globalNetworks, deps.NetworkLookup, deps.AuditRecorder)
 		{
 			// Auth profile
-			authHandler := handlers.NewAuthHandler(
-				services.NewUserService(db.Repository, logger),
-				middleware.NewAuthMiddleware(jwtSecret, logger),
-				logger,
-			)
-			protected.GET("/auth/profile", authHandler.GetProfile)
+			protected.GET("/auth/profile", deps.AuthHandler.GetProfile)
+			protected.POST("/auth/oauth/:provider/link", deps.OAuthHandler.Link)
+			protected.GET("/auth/identities", deps.OAuthHandler.GetIdentities)
+			protected.DELETE("/auth/identities/:provider", deps.OAuthHandler.Unlink)
+			if cfg.Slack.Enabled() {
+				protected.POST("/slack/link", deps.SlackHandler.CreateLinkCode)
+			}
+			protected.GET("/auth/sessions", deps.SessionHandler.ListSessions)
+			protected.DELETE("/auth/sessions", deps.SessionHandler.RevokeAllSessions)
+			protected.DELETE("/auth/sessions/:id", deps.SessionHandler.RevokeSession)
+			protected.GET("/api-keys", deps.APIKeyHandler.ListAPIKeys)
+			protected.POST("/api-keys", deps.APIKeyHandler.CreateAPIKey)
+			protected.DELETE("/api-keys/:id", deps.APIKeyHandler.DeleteAPIKey)
 
 			// Deployment routes
-			deploymentHandler := handlers.NewDeploymentHandler(
-				services.NewDeploymentService(db.Repository, queue, logger),
-				logger,
-			)
-			protected.POST("/deployments", deploymentHandler.CreateDeployment)
-			protected.GET("/deployments", deploymentHandler.GetDeployments)
-			protected.GET("/deployments/:id", deploymentHandler.GetDeployment)
-			protected.GET("/deployments/:id/logs", deploymentHandler.GetDeploymentLogs)
-			protected.GET("/deployments/:id/steps", deploymentHandler.GetDeploymentSteps)
+			protected.POST("/deployments", allowlist, middleware.UploadConstraints(cfg.Uploads.MaxMultipartMemory, map[string]middleware.UploadRule{
+				"env_file": {MaxSize: cfg.Uploads.MaxEnvFileSize, Extensions: []string{"", ".env", ".txt"}, TextOnly: true},
+			}), deps.DeploymentHandler.CreateDeployment)
+			protected.GET("/deployments", deps.DeploymentHandler.GetDeployments)
+			protected.GET("/deployments/export", deps.DeploymentHandler.ExportDeployments)
+			protected.GET("/deployments/:id", deps.DeploymentHandler.GetDeployment)
+			protected.GET("/deployments/:id/full", deps.DeploymentHandler.GetDeploymentDetail)
+			protected.GET("/deployments/:id/logs", deps.DeploymentHandler.GetDeploymentLogs)
+			protected.GET("/deployments/:id/logs/export", deps.DeploymentHandler.ExportDeploymentLogs)
+			protected.GET("/deployments/:id/bundle", deps.DeploymentHandler.DownloadDeploymentBundle)
+			protected.GET("/deployments/:id/steps", deps.DeploymentHandler.GetDeploymentSteps)
+			protected.GET("/deployments/:id/changelog", deps.DeploymentHandler.GetDeploymentChangelog)
+			protected.GET("/log-events", deps.DeploymentHandler.ListLogEvents)
+			protected.POST("/deployments/:id/resume", allowlist, deps.DeploymentHandler.ResumeDeployment)
+			protected.GET("/deployments/:id/comments", deps.DeploymentHandler.GetDeploymentComments)
+			protected.POST("/deployments/:id/comments", deps.DeploymentHandler.CreateDeploymentComment)
+			protected.GET("/deployments/:id/exec", allowlist, deps.ExecHandler.Exec)
+			protected.GET("/deployments/:id/exec/sessions", deps.ExecHandler.GetExecSessions)
+			protected.GET("/deployments/:id/files", allowlist, deps.FileHandler.ListFiles)
+			protected.GET("/deployments/:id/files/content", allowlist, deps.FileHandler.GetFileContent)
+			protected.GET("/deployments/:id/artifacts", deps.ArtifactHandler.ListArtifacts)
+			protected.GET("/deployments/:id/artifacts/:name", deps.ArtifactHandler.DownloadArtifact)
+			protected.GET("/deployments/:id/cron-runs", deps.CronJobHandler.ListRuns)
+			protected.DELETE("/deployments/:id/cron", allowlist, deps.CronJobHandler.RemoveJob)
+
+			// Read-only GraphQL API over deployments, projects and targets
+			if cfg.GraphQL.Enabled {
+				protected.GET("/graphql", deps.GraphQL.Handle)
+				protected.POST("/graphql", deps.GraphQL.Handle)
+			}
+
+			// Job history
+			protected.GET("/jobs", deps.JobHandler.ListJobs)
+			protected.GET("/jobs/:id", deps.JobHandler.GetJob)
+
+			// Project statistics
+			protected.GET("/projects/stats", deps.DeploymentHandler.GetProjectStats)
+			protected.GET("/projects/:id/timeline", deps.ProjectHandler.GetProjectTimeline)
+
+			// Saved views
+			protected.GET("/views", deps.ViewHandler.ListViews)
+			protected.POST("/views", deps.ViewHandler.CreateView)
+			protected.GET("/views/:id", deps.ViewHandler.GetView)
+			protected.PUT("/views/:id", deps.ViewHandler.UpdateView)
+			protected.DELETE("/views/:id", deps.ViewHandler.DeleteView)
+			protected.GET("/views/:id/deployments", deps.ViewHandler.GetViewDeployments)
+
+			// Deployment schedules; they create deployments, so changing them is subject to the IP allowlist
+			protected.GET("/schedules", deps.ScheduleHandler.ListSchedules)
+			protected.POST("/schedules", allowlist, deps.ScheduleHandler.CreateSchedule)
+			protected.GET("/schedules/:id", deps.ScheduleHandler.GetSchedule)
+			protected.PUT("/schedules/:id", allowlist, deps.ScheduleHandler.UpdateSchedule)
+			protected.DELETE("/schedules/:id", deps.ScheduleHandler.DeleteSchedule)
+
+			// Applications group container services that are released together; releasing one creates
+			// deployments, so it is subject to the IP allowlist
+			protected.GET("/applications", deps.ApplicationHandler.ListApplications)
+			protected.POST("/applications", deps.ApplicationHandler.CreateApplication)
+			protected.GET("/applications/:id", deps.ApplicationHandler.GetApplication)
+			protected.PUT("/applications/:id", deps.ApplicationHandler.UpdateApplication)
+			protected.DELETE("/applications/:id", deps.ApplicationHandler.DeleteApplication)
+			protected.POST("/applications/:id/releases", allowlist, deps.ApplicationHandler.CreateRelease)
+			protected.GET("/applications/:id/releases", deps.ApplicationHandler.ListReleases)
+			protected.GET("/applications/:id/releases/:release_id", deps.ApplicationHandler.GetRelease)
+
+			// Managed services are databases run on a target from their official images; deploying one
+			// creates a deployment, so it is subject to the IP allowlist
+			protected.GET("/managed-services", deps.ManagedServiceHandler.ListManagedServices)
+			protected.POST("/managed-services", deps.ManagedServiceHandler.CreateManagedService)
+			protected.GET("/managed-services/:id", deps.ManagedServiceHandler.GetManagedService)
+			protected.PUT("/managed-services/:id", deps.ManagedServiceHandler.UpdateManagedService)
+			protected.DELETE("/managed-services/:id", deps.ManagedServiceHandler.DeleteManagedService)
+			protected.GET("/managed-services/:id/connection", deps.ManagedServiceHandler.GetConnection)
+			protected.POST("/managed-services/:id/deployments", allowlist, deps.ManagedServiceHandler.DeployManagedService)
+
+			// Backups of managed services reach their targets, so taking and restoring them is subject
+			// to the IP allowlist
+			protected.GET("/managed-services/:id/backups", deps.VolumeBackupHandler.ListBackups)
+			protected.POST("/managed-services/:id/backups", allowlist, deps.VolumeBackupHandler.CreateBackup)
+			protected.GET("/managed-services/:id/backups/:backup_id", deps.VolumeBackupHandler.GetBackup)
+			protected.DELETE("/managed-services/:id/backups/:backup_id", deps.VolumeBackupHandler.DeleteBackup)
+			protected.POST("/managed-services/:id/backups/:backup_id/restore", allowlist, deps.VolumeBackupHandler.RestoreBackup)
+
+			// Admin routes (admin role required)
+			admin := protected.Group("/admin")
+			admin.Use(middleware.RequireRole(deps.RoleLookup, models.RoleAdmin))
+			{
+				admin.GET("/deployments", deps.AdminHandler.ListDeployments)
+				admin.GET("/quotas", deps.AdminHandler.GetQuotas)
+				admin.GET("/organizations", deps.AdminHandler.ListOrganizations)
+				admin.POST("/organizations", deps.AdminHandler.CreateOrganization)
+				admin.PUT("/organizations/:id/ip-allowlist", deps.AdminHandler.SetOrganizationIPAllowlist)
+				admin.GET("/workers", deps.HealthHandler.ListWorkers)
+				admin.GET("/worker-tokens", deps.AdminHandler.ListWorkerTokens)
+				admin.POST("/worker-tokens", allowlist, deps.AdminHandler.CreateWorkerToken)
+				admin.DELETE("/worker-tokens/:id", allowlist, deps.AdminHandler.RevokeWorkerToken)
+				admin.GET("/ssh-ca/keys", deps.AdminHandler.ListSSHCAKeys)
+				admin.POST("/ssh-ca/keys", allowlist, deps.AdminHandler.CreateSSHCAKey)
+				admin.POST("/ssh-ca/keys/:id/activate", allowlist, deps.AdminHandler.ActivateSSHCAKey)
+				admin.DELETE("/ssh-ca/keys/:id", allowlist, deps.AdminHandler.DeleteSSHCAKey)
+				admin.POST("/backup", allowlist, deps.AdminHandler.CreateBackup)
+				admin.GET("/command-templates", deps.AdminHandler.ListCommandTemplates)
+				admin.PUT("/command-templates/:step", allowlist, deps.AdminHandler.SetCommandTemplate)
+				admin.DELETE("/command-templates/:step", allowlist, deps.AdminHandler.DeleteCommandTemplate)
+				admin.GET("/audit-events", deps.AdminHandler.ListAuditEvents)
+				admin.GET("/users", deps.AdminHandler.ListUsers)
+				admin.POST("/users", deps.AdminHandler.CreateUser)
+				admin.PATCH("/users/:id", deps.AdminHandler.UpdateUser)
+				admin.PUT("/users/:id/organization", deps.AdminHandler.AssignUserOrganization)
+				admin.DELETE("/users/:id/sessions", deps.SessionHandler.RevokeUserSessions)
+				admin.GET("/projects", deps.ProjectHandler.ListProjects)
+				admin.POST("/projects", allowlist, deps.ProjectHandler.CreateProject)
+				admin.POST("/projects/import", allowlist, deps.ProjectHandler.ImportProject)
+				admin.GET("/projects/:id", deps.ProjectHandler.GetProject)
+				admin.PUT("/projects/:id", allowlist, deps.ProjectHandler.UpdateProject)
+				admin.DELETE("/projects/:id", allowlist, deps.ProjectHandler.DeleteProject)
+				admin.GET("/projects/:id/export", deps.ProjectHandler.ExportProject)
+				admin.POST("/projects/:id/badge-token", deps.ProjectHandler.RotateBadgeToken)
+				admin.DELETE("/projects/:id/badge-token", deps.ProjectHandler.RevokeBadgeToken)
+				admin.GET("/projects/:id/signing-keys", deps.ProjectHandler.ListSigningKeys)
+				admin.POST("/projects/:id/signing-keys", allowlist, deps.ProjectHandler.AddSigningKey)
+				admin.DELETE("/projects/:id/signing-keys/:key_id", allowlist, deps.ProjectHandler.DeleteSigningKey)
+				admin.GET("/projects/:id/targets", deps.ProjectHandler.ListTargets)
+				admin.POST("/projects/:id/targets", allowlist, deps.ProjectHandler.CreateTarget)
+				admin.GET("/projects/:id/targets/:target_id", deps.ProjectHandler.GetTarget)
+				admin.PUT("/projects/:id/targets/:target_id", allowlist, deps.ProjectHandler.UpdateTarget)
+				admin.DELETE("/projects/:id/targets/:target_id", allowlist, deps.ProjectHandler.DeleteTarget)
+				admin.GET("/projects/:id/templates", deps.ProjectHandler.ListTemplates)
+				admin.POST("/projects/:id/templates", allowlist, deps.ProjectHandler.CreateTemplate)
+				admin.GET("/projects/:id/templates/:template_id", deps.ProjectHandler.GetTemplate)
+				admin.PUT("/projects/:id/templates/:template_id", allowlist, deps.ProjectHandler.UpdateTemplate)
+				admin.DELETE("/projects/:id/templates/:template_id", allowlist, deps.ProjectHandler.DeleteTemplate)
+			}
+		}
+
+		// Deployments requested by CI pipelines, authenticated with an API key instead of a token
+		ci := v1.Group("/ci")
+		ci.Use(middleware.APIKeyAuth(deps.APIKeyLookup))
+		ci.Use(middleware.OrganizationScope(deps.OrganizationLookup))
+		{
+			ci.POST("/deploy", allowlist, deps.CIHandler.Deploy)
+			ci.GET("/deployments/:id", deps.CIHandler.GetDeploymentStatus)
+			ci.GET("/deployments/:id/logs", deps.CIHandler.GetDeploymentLogs)
+		}
+
+		// Deployment gates are reported by CI pipelines with an API key, or by users
+		gates := v1.Group("/deployments/:id/gates")
+		gates.Use(middleware.APIKeyOrToken(deps.APIKeyLookup, deps.AuthMiddleware.AuthRequired()))
+		gates.Use(middleware.RequireActiveUser(deps.ActiveUserLookup))
+		gates.Use(middleware.OrganizationScope(deps.OrganizationLookup))
+		{
+			gates.GET("", deps.GateHandler.ListGates)
+			gates.POST("/:name", deps.GateHandler.ReportGate)
+		}
+
+		// Who is on call for a project is synchronized from external schedules with an API key
+		onCall := v1.Group("/projects/:id/on-call")
+		onCall.Use(middleware.APIKeyOrToken(deps.APIKeyLookup, deps.AuthMiddleware.AuthRequired()))
+		onCall.Use(middleware.RequireActiveUser(deps.ActiveUserLookup))
+		onCall.Use(middleware.OrganizationScope(deps.OrganizationLookup))
+		{
+			onCall.GET("", deps.ProjectHandler.GetOnCall)
+			onCall.PUT("", middleware.RequireRole(deps.RoleLookup, models.RoleAdmin), deps.ProjectHandler.SetOnCall)
+			onCall.DELETE("", middleware.RequireRole(deps.RoleLookup, models.RoleAdmin), deps.ProjectHandler.ClearOnCall)
+		}
+	}
+
+	// SCIM 2.0 provisioning for identity providers, authenticated with SCIM_TOKEN
+	if cfg.SCIM.Token != "" {
+		scim := router.Group("/scim/v2")
+		scim.Use(middleware.StaticBearerToken(cfg.SCIM.Token))
+		{
+			scim.GET("/ServiceProviderConfig", deps.SCIMHandler.ServiceProviderConfig)
+			scim.GET("/Users", deps.SCIMHandler.ListUsers)
+			scim.POST("/Users", deps.SCIMHandler.CreateUser)
+			scim.GET("/Users/:id", deps.SCIMHandler.GetUser)
+			scim.PUT("/Users/:id", deps.SCIMHandler.ReplaceUser)
+			scim.PATCH("/Users/:id", deps.SCIMHandler.PatchUser)
+			scim.DELETE("/Users/:id", deps.SCIMHandler.DeleteUser)
 		}
 	}
 
@@ -0,0 +1,299 @@
+package app
+
+import (
+	"fmt"
+
+	"deployknot/internal/api"
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/graphqlapi"
+	"deployknot/internal/handlers"
+	"deployknot/internal/middleware"
+	"deployknot/internal/services"
+	"deployknot/internal/workerapi"
+	"deployknot/pkg/encryption"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// App is the composition root: it owns the infrastructure connections and constructs every
+// service, middleware and handler exactly once for the server and the worker
+type App struct {
+	Config *config.Config
+	Logger *logrus.Logger
+
+	DB    *database.Database
+	Redis *database.Redis
+
+	Encryptor              *encryption.Encryptor
+	JobQueue               services.JobQueue
+	QueueService           *services.QueueService
+	DeploymentCache        *services.DeploymentCache
+	UserService            *services.UserService
+	OrganizationService    *services.OrganizationService
+	ProjectService         *services.ProjectService
+	DeploymentService      *services.DeploymentService
+	SSHCAService           *services.SSHCAService
+	SSHTargetLimiter       *services.SSHTargetLimiter
+	BackupService          *services.BackupService
+	ChangelogService       *services.ChangelogService
+	PreflightService       *services.PreflightService
+	ExecService            *services.ExecService
+	FileService            *services.FileService
+	ArtifactService        *services.ArtifactService
+	CommandTemplateService *services.CommandTemplateService
+	ViewService            *services.ViewService
+	ScheduleService        *services.ScheduleService
+	JobService             *services.JobService
+	OAuthService           *services.OAuthService
+	SessionService         *services.SessionService
+	SlackService           *services.SlackService
+	APIKeyService          *services.APIKeyService
+	WorkerTokenService     *services.WorkerTokenService
+	CIService              *services.CIService
+	GateService            *services.GateService
+	AuditService           *services.AuditService
+	Watchdog               *services.Watchdog
+	OutboxPublisher        *services.OutboxPublisher
+	Autoscaler             *services.Autoscaler
+	Scheduler              *services.Scheduler
+	GateMonitor            *services.GateMonitor
+	ApplicationService     *services.ApplicationService
+	ManagedServiceService  *services.ManagedServiceService
+	VolumeBackupService    *services.VolumeBackupService
+	CronJobService         *services.CronJobService
+	ReleaseMonitor         *services.ReleaseMonitor
+	Notifier               *services.Notifier
+	IncidentReporter       *services.IncidentReporter
+	GitHubReporter         *services.GitHubDeploymentReporter
+	LogShipper             *services.LogShipper
+	LeaderElector          *services.LeaderElector
+	WorkerAPI              *workerapi.Server
+	GraphQL                *graphqlapi.Server
+
+	AuthMiddleware        *middleware.AuthMiddleware
+	AuthHandler           *handlers.AuthHandler
+	DeploymentHandler     *handlers.DeploymentHandler
+	AdminHandler          *handlers.AdminHandler
+	ProjectHandler        *handlers.ProjectHandler
+	ExecHandler           *handlers.ExecHandler
+	FileHandler           *handlers.FileHandler
+	ArtifactHandler       *handlers.ArtifactHandler
+	ViewHandler           *handlers.ViewHandler
+	ScheduleHandler       *handlers.ScheduleHandler
+	ApplicationHandler    *handlers.ApplicationHandler
+	ManagedServiceHandler *handlers.ManagedServiceHandler
+	VolumeBackupHandler   *handlers.VolumeBackupHandler
+	CronJobHandler        *handlers.CronJobHandler
+	JobHandler            *handlers.JobHandler
+	OAuthHandler          *handlers.OAuthHandler
+	SessionHandler        *handlers.SessionHandler
+	SCIMHandler           *handlers.SCIMHandler
+	SlackHandler          *handlers.SlackHandler
+	APIKeyHandler         *handlers.APIKeyHandler
+	CIHandler             *handlers.CIHandler
+	GateHandler           *handlers.GateHandler
+	StatusHandler         *handlers.StatusHandler
+	HealthHandler         *handlers.HealthHandler
+	MetricsHandler        *handlers.MetricsHandler
+}
+
+// New connects to the database and Redis and wires up the application
+func New(cfg *config.Config, logger *logrus.Logger) (*App, error) {
+	a := &App{Config: cfg, Logger: logger}
+
+	// Initialize database
+	err := database.WithRetry("database", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, logger, func() error {
+		var err error
+		a.DB, err = database.New(cfg.GetDatabaseURL(), logger)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if cfg.Database.ReplicaURL != "" {
+		err = database.WithRetry("read replica", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, logger, func() error {
+			return a.DB.ConnectReplica(cfg.Database.ReplicaURL)
+		})
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to initialize read replica: %w", err)
+		}
+	}
+
+	// Initialize Redis
+	err = database.WithRetry("Redis", cfg.Startup.ConnectRetries, cfg.Startup.ConnectBackoff, logger, func() error {
+		var err error
+		a.Redis, err = database.NewRedis(cfg.GetRedisURL(), logger)
+		return err
+	})
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to initialize Redis: %w", err)
+	}
+
+	// Initialize encryptor for stored secrets
+	a.Encryptor, err = encryption.New(cfg.GetEncryptionKey())
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to initialize encryptor: %w", err)
+	}
+
+	// Initialize services
+	a.JobQueue, err = services.NewJobQueue(cfg.Queue, a.Redis.Client, logger)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to initialize job queue: %w", err)
+	}
+	a.QueueService = services.NewQueueService(a.Redis.Client, a.JobQueue, a.DB.Repository, a.Encryptor, cfg.Queue, logger)
+	a.UserService = services.NewUserService(a.DB.Repository, logger)
+	a.OrganizationService = services.NewOrganizationService(a.DB.Repository, logger)
+	a.ProjectService = services.NewProjectService(a.DB.Repository, logger)
+	a.ChangelogService = services.NewChangelogService(a.DB.Repository, cfg.Changelog, logger)
+	a.SSHCAService = services.NewSSHCAService(a.DB.Repository, a.Encryptor, cfg.Credentials, logger)
+	a.SSHTargetLimiter = services.NewSSHTargetLimiter(a.Redis.Client, cfg.SSHTargets, logger)
+	a.BackupService = services.NewBackupService(a.DB.Repository, a.Encryptor, logger)
+	a.DeploymentCache = services.NewDeploymentCache(a.Redis.Client, cfg.Cache, logger)
+	a.DeploymentService = services.NewDeploymentService(a.DB.Repository, a.QueueService, a.Encryptor, cfg.Quotas, cfg.Credentials, a.ChangelogService, a.SSHCAService, a.DeploymentCache, logger)
+	a.PreflightService = services.NewPreflightService(cfg.Preflight, a.SSHCAService, a.SSHTargetLimiter, logger)
+	a.ExecService = services.NewExecService(a.DB.Repository, a.DeploymentService, a.SSHTargetLimiter, cfg.Exec, logger)
+	a.FileService = services.NewFileService(a.DB.Repository, a.SSHCAService, a.SSHTargetLimiter, cfg.Files, logger)
+	a.ArtifactService = services.NewArtifactService(a.DB.Repository, cfg.Artifacts, logger)
+	a.CommandTemplateService = services.NewCommandTemplateService(a.DB.Repository, cfg.Commands, logger)
+	a.ViewService = services.NewViewService(a.DB.Repository, logger)
+	a.ScheduleService = services.NewScheduleService(a.DB.Repository, logger)
+	a.JobService = services.NewJobService(a.DB.Repository, logger)
+	a.OAuthService = services.NewOAuthService(a.DB.Repository, a.Redis.Client, cfg.OAuth, logger)
+	a.SessionService = services.NewSessionService(a.Redis.Client, logger)
+	a.SlackService = services.NewSlackService(a.DB.Repository, a.Redis.Client, a.DeploymentService, cfg.Slack, logger)
+	a.APIKeyService = services.NewAPIKeyService(a.DB.Repository, logger)
+	a.WorkerTokenService = services.NewWorkerTokenService(a.DB.Repository, logger)
+	a.CIService = services.NewCIService(a.DB.Repository, a.DeploymentService, logger)
+	a.GateService = services.NewGateService(a.DB.Repository, a.DeploymentService, logger)
+	a.AuditService = services.NewAuditService(a.DB.Repository, logger)
+	a.Watchdog = services.NewWatchdog(a.DB.Repository, a.QueueService, a.DeploymentCache, cfg.Watchdog, logger)
+	a.OutboxPublisher = services.NewOutboxPublisher(a.DB.Repository, a.QueueService, a.Encryptor, cfg.Outbox, logger)
+	a.Autoscaler = services.NewAutoscaler(a.QueueService, a.Redis.Client, cfg.Autoscale, cfg.Health.WorkerStaleAfter, logger)
+	a.Scheduler = services.NewScheduler(a.DB.Repository, a.DeploymentService, cfg.Scheduler, logger)
+	a.GateMonitor = services.NewGateMonitor(a.GateService, cfg.Gates, logger)
+	a.ApplicationService = services.NewApplicationService(a.DB.Repository, a.DeploymentService, a.GateService, cfg.Applications, logger)
+	a.ReleaseMonitor = services.NewReleaseMonitor(a.ApplicationService, cfg.Applications, logger)
+	a.ManagedServiceService = services.NewManagedServiceService(a.DB.Repository, a.DeploymentService, a.Encryptor, logger)
+	a.VolumeBackupService = services.NewVolumeBackupService(a.DB.Repository, a.ManagedServiceService, a.SSHCAService, a.SSHTargetLimiter, cfg.VolumeBackups, logger)
+	a.CronJobService = services.NewCronJobService(a.DB.Repository, a.SSHCAService, a.SSHTargetLimiter, cfg.CronJobs, logger)
+	a.Notifier = services.NewNotifier(a.DB.Repository, cfg.Notifications, logger)
+	a.IncidentReporter = services.NewIncidentReporter(a.DB.Repository, cfg.Incidents, logger)
+	a.GitHubReporter = services.NewGitHubDeploymentReporter(a.DB.Repository, a.Encryptor, cfg.GitHub, logger)
+	a.LogShipper = services.NewLogShipper(a.DB.Repository, cfg.LogSinks, logger)
+	a.LeaderElector = services.NewLeaderElector(a.Redis.Client, cfg.Leader, logger)
+	a.WorkerAPI = workerapi.NewServer(a.QueueService, a.DeploymentService, cfg.Worker, logger)
+
+	// Initialize middleware: new tokens are signed with the current secret, the previous one is still accepted
+	signingKey := middleware.JWTKey{ID: cfg.JWT.KeyID, Secret: cfg.JWT.Secret}
+	var verifyKeys []middleware.JWTKey
+	if cfg.JWT.PreviousSecret != "" {
+		verifyKeys = append(verifyKeys, middleware.JWTKey{ID: cfg.JWT.PreviousKeyID, Secret: cfg.JWT.PreviousSecret})
+	}
+	a.AuthMiddleware = middleware.NewAuthMiddleware(signingKey, logger, verifyKeys...)
+	a.AuthMiddleware.SetSessionStore(a.SessionService)
+
+	// Initialize handlers
+	a.AuthHandler = handlers.NewAuthHandler(a.UserService, a.AuthMiddleware, logger)
+	a.DeploymentHandler = handlers.NewDeploymentHandler(a.DeploymentService, a.PreflightService, logger)
+	a.AdminHandler = handlers.NewAdminHandler(a.DeploymentService, a.OrganizationService, a.UserService, a.AuditService, a.CommandTemplateService, a.WorkerTokenService, a.SSHCAService, a.BackupService, logger)
+	a.ProjectHandler = handlers.NewProjectHandler(a.ProjectService, logger)
+	a.ExecHandler = handlers.NewExecHandler(a.ExecService, cfg.CORS.AllowedOrigins, logger)
+	a.FileHandler = handlers.NewFileHandler(a.FileService, logger)
+	a.ArtifactHandler = handlers.NewArtifactHandler(a.ArtifactService, logger)
+	a.ViewHandler = handlers.NewViewHandler(a.ViewService, logger)
+	a.ScheduleHandler = handlers.NewScheduleHandler(a.ScheduleService, logger)
+	a.ApplicationHandler = handlers.NewApplicationHandler(a.ApplicationService, logger)
+	a.ManagedServiceHandler = handlers.NewManagedServiceHandler(a.ManagedServiceService, logger)
+	a.VolumeBackupHandler = handlers.NewVolumeBackupHandler(a.VolumeBackupService, logger)
+	a.CronJobHandler = handlers.NewCronJobHandler(a.CronJobService, logger)
+	a.JobHandler = handlers.NewJobHandler(a.JobService, logger)
+	a.OAuthHandler = handlers.NewOAuthHandler(a.OAuthService, a.AuthMiddleware, logger)
+	a.SessionHandler = handlers.NewSessionHandler(a.SessionService, logger)
+	a.SCIMHandler = handlers.NewSCIMHandler(a.UserService, logger)
+	a.SlackHandler = handlers.NewSlackHandler(a.SlackService, logger)
+	a.APIKeyHandler = handlers.NewAPIKeyHandler(a.APIKeyService, logger)
+	a.CIHandler = handlers.NewCIHandler(a.CIService, a.DeploymentHandler, logger)
+	a.GateHandler = handlers.NewGateHandler(a.GateService, logger)
+	a.StatusHandler = handlers.NewStatusHandler(a.ProjectService, cfg.StatusPage, cfg.Badges, logger)
+	a.HealthHandler = handlers.NewHealthHandler(a.DB, a.Redis, a.QueueService, a.LeaderElector, cfg.Health, logger)
+	a.MetricsHandler = handlers.NewMetricsHandler(a.Autoscaler, logger)
+	if cfg.GraphQL.Enabled {
+		a.GraphQL, err = graphqlapi.NewServer(a.DeploymentService, a.ProjectService, a.UserService.GetUserRole, logger)
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Migrate runs the database migrations in migrationsPath
+func (a *App) Migrate(migrationsPath string) error {
+	return a.DB.RunMigrations(migrationsPath)
+}
+
+// Router builds the HTTP router
+func (a *App) Router() *gin.Engine {
+	return api.SetupRouter(api.Dependencies{
+		Config:                a.Config,
+		Logger:                a.Logger,
+		AuthMiddleware:        a.AuthMiddleware,
+		AuthHandler:           a.AuthHandler,
+		DeploymentHandler:     a.DeploymentHandler,
+		AdminHandler:          a.AdminHandler,
+		ProjectHandler:        a.ProjectHandler,
+		ExecHandler:           a.ExecHandler,
+		FileHandler:           a.FileHandler,
+		ArtifactHandler:       a.ArtifactHandler,
+		ViewHandler:           a.ViewHandler,
+		ScheduleHandler:       a.ScheduleHandler,
+		ApplicationHandler:    a.ApplicationHandler,
+		ManagedServiceHandler: a.ManagedServiceHandler,
+		VolumeBackupHandler:   a.VolumeBackupHandler,
+		CronJobHandler:        a.CronJobHandler,
+		JobHandler:            a.JobHandler,
+		OAuthHandler:          a.OAuthHandler,
+		SessionHandler:        a.SessionHandler,
+		SCIMHandler:           a.SCIMHandler,
+		SlackHandler:          a.SlackHandler,
+		APIKeyHandler:         a.APIKeyHandler,
+		CIHandler:             a.CIHandler,
+		GateHandler:           a.GateHandler,
+		StatusHandler:         a.StatusHandler,
+		HealthHandler:         a.HealthHandler,
+		MetricsHandler:        a.MetricsHandler,
+		GraphQL:               a.GraphQL,
+		RoleLookup:            a.UserService.GetUserRole,
+		OrganizationLookup:    a.OrganizationService.IsolatedOrganization,
+		ActiveUserLookup:      a.UserService.IsUserActive,
+		NetworkLookup:         a.OrganizationService.AllowedNetworks,
+		APIKeyLookup:          a.APIKeyService.Authenticate,
+		AuditRecorder:         a.AuditService.RecordEvent,
+	})
+}
+
+// Close closes the infrastructure connections
+func (a *App) Close() {
+	if a.JobQueue != nil {
+		if err := a.JobQueue.Close(); err != nil {
+			a.Logger.WithError(err).Error("Failed to close job queue")
+		}
+	}
+	if a.Redis != nil {
+		if err := a.Redis.Close(); err != nil {
+			a.Logger.WithError(err).Error("Failed to close Redis")
+		}
+	}
+	if a.DB != nil {
+		if err := a.DB.Close(); err != nil {
+			a.Logger.WithError(err).Error("Failed to close database")
+		}
+	}
+}
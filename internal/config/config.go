@@ -1,21 +1,67 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"deployknot/internal/models"
+
 	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	Redis     RedisConfig
-	Logging   LoggingConfig
-	JWTSecret string
+	Server        ServerConfig
+	Database      DatabaseConfig
+	Redis         RedisConfig
+	Cache         CacheConfig
+	Logging       LoggingConfig
+	Worker        WorkerConfig
+	Queue         QueueConfig
+	WorkerAPI     WorkerAPIConfig
+	GraphQL       GraphQLConfig
+	Commands      CommandTemplateConfig
+	Health        HealthConfig
+	Watchdog      WatchdogConfig
+	Outbox        OutboxConfig
+	Scheduler     SchedulerConfig
+	Leader        LeaderElectionConfig
+	Gates         GateConfig
+	Applications  ApplicationConfig
+	Notifications NotificationConfig
+	Incidents     IncidentConfig
+	GitHub        GitHubDeploymentsConfig
+	LogSinks      LogSinkConfig
+	Preflight     PreflightConfig
+	Changelog     ChangelogConfig
+	Startup       StartupConfig
+	JWT           JWTConfig
+	TLS           TLSConfig
+	CORS          CORSConfig
+	Uploads       UploadConfig
+	Headers       SecurityHeadersConfig
+	Admin         AdminConfig
+	Quotas        QuotaConfig
+	Exec          ExecConfig
+	StatusPage    StatusPageConfig
+	Badges        BadgeConfig
+	Files         FilesConfig
+	OAuth         OAuthConfig
+	SCIM          SCIMConfig
+	Slack         SlackConfig
+	Access        AccessConfig
+	Credentials   CredentialsConfig
+	Autoscale     AutoscaleConfig
+	Artifacts     ArtifactsConfig
+	VolumeBackups VolumeBackupConfig
+	CronJobs      CronJobConfig
+	SSHTargets    SSHTargetConfig
+	EncryptionKey string
 }
 
 // ServerConfig holds server-related configuration
@@ -24,38 +70,591 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// WithWorker runs a deployment worker in the server process, for installations on a single VM
+	WithWorker bool
 }
 
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
-	Schema   string
+	// Driver is postgres, or sqlite to keep everything in the file at SQLitePath for single-node
+	// installs
+	Driver     string
+	SQLitePath string
+	Host       string
+	Port       string
+	User       string
+	Password   string
+	DBName     string
+	SSLMode    string
+	Schema     string
+	// ReplicaURL is the connection string of a PostgreSQL read replica serving log, step and
+	// statistics reads; empty reads everything from the primary
+	ReplicaURL string
+}
+
+// UsesSQLite reports whether the data is stored in a SQLite database file
+func (d DatabaseConfig) UsesSQLite() bool {
+	return d.Driver == "sqlite"
 }
 
 // RedisConfig holds Redis-related configuration
 type RedisConfig struct {
+	// Embedded runs a Redis server in memory inside the process instead of connecting to one; its
+	// data is lost when the process stops
+	Embedded bool
 	Host     string
 	Port     string
 	Password string
 	DB       int
 }
 
+// CacheConfig holds configuration for caching deployment state in Redis
+type CacheConfig struct {
+	// DeploymentTTL bounds how long the status and steps of a deployment are served from the cache;
+	// zero disables the cache
+	DeploymentTTL time.Duration
+}
+
 // LoggingConfig holds logging-related configuration
 type LoggingConfig struct {
 	Level string
 }
 
+// WorkerConfig holds deployment worker configuration
+type WorkerConfig struct {
+	DockerBackend     string
+	DockerSocket      string
+	HeartbeatInterval time.Duration
+	// Pool is the worker pool whose queue the worker consumes; empty for the default pool
+	Pool string
+	// LockTTL bounds how long a worker holds a deployment; derived from the watchdog settings
+	LockTTL time.Duration
+	// HealthyTimeout bounds how long docker_run waits for a container with a HEALTHCHECK to become healthy
+	HealthyTimeout time.Duration
+	// DependencyTimeout bounds how long docker_run waits for the services an application service
+	// depends on to be ready
+	DependencyTimeout time.Duration
+	// TargetLogs attaches the target's Docker daemon and kernel OOM messages from the deployment
+	// window to the deployment logs
+	TargetLogs bool
+	// TargetLogLines caps the journal lines attached per source
+	TargetLogLines int
+	// DockerBuild advertises that the worker can run Docker deployments, which build images
+	DockerBuild bool
+	// MaxConcurrentJobs is how many deployments the worker processes at once
+	MaxConcurrentJobs int
+	// Networks are the IP addresses and CIDR blocks of the SSH targets the worker can reach; empty
+	// for any target
+	Networks []string
+	// SecretScan is the policy for secrets committed to deployed repositories: off, warn or fail.
+	// A repository's deployknot.yaml can make it stricter.
+	SecretScan string
+	// LocalFileDirs are the directories the local files named by jobs, such as uploaded env files,
+	// must be in
+	LocalFileDirs []string
+	// ExecUser is the user local commands such as git, kubectl and cosign run as; empty runs them
+	// as nobody when the worker runs as root and as the worker's user otherwise
+	ExecUser string
+	// AllowUnisolatedCommands lets a worker that cannot run local commands as another user run
+	// them as its own, which can read its environment; otherwise it refuses jobs needing them
+	AllowUnisolatedCommands bool
+	// SSHRetryAttempts is how many times a command on the target is tried when its session fails
+	// for a transient reason
+	SSHRetryAttempts int
+	// SSHRetryBackoff is the delay before the first retry; it doubles with every retry up to
+	// SSHRetryMaxBackoff, and a random half of it is waited
+	SSHRetryBackoff    time.Duration
+	SSHRetryMaxBackoff time.Duration
+	// SSHCommandTimeout bounds every command a deployment runs on the target and every file it
+	// transfers, so a hung command cannot hold the worker
+	SSHCommandTimeout time.Duration
+}
+
+// QueueConfig holds configuration for the deployment jobs kept in Redis
+type QueueConfig struct {
+	// JobTTL is how long a job and its deployment's pointer to it are kept in Redis after their last
+	// update; the jobs table keeps their history afterwards
+	JobTTL time.Duration
+	// Backend holds the pending jobs: redis, memory for single-binary installs, or nats to keep
+	// them in a NATS JetStream stream
+	Backend      string
+	NATSURL      string
+	NATSStream   string
+	NATSReplicas int
+}
+
+// Queue backends
+const (
+	QueueBackendRedis  = "redis"
+	QueueBackendMemory = "memory"
+	QueueBackendNATS   = "nats"
+)
+
+// WorkerAPIConfig holds configuration for the gRPC API workers use to lease jobs, append logs and
+// report statuses without access to PostgreSQL and Redis
+type WorkerAPIConfig struct {
+	Enabled bool
+	Port    string
+}
+
+// GraphQLConfig holds configuration for the read-only GraphQL API served next to the REST API
+type GraphQLConfig struct {
+	Enabled bool
+}
+
+// CommandTemplateConfig holds the installation's default command templates of the worker steps,
+// by step; templates set through the admin API take precedence
+type CommandTemplateConfig struct {
+	GitClone    string
+	DockerBuild string
+	DockerRun   string
+}
+
+// Templates returns the configured command templates by step name
+func (c CommandTemplateConfig) Templates() map[string]string {
+	templates := make(map[string]string)
+	for step, text := range map[string]string{
+		models.CommandStepGitClone:    c.GitClone,
+		models.CommandStepDockerBuild: c.DockerBuild,
+		models.CommandStepDockerRun:   c.DockerRun,
+	} {
+		if strings.TrimSpace(text) != "" {
+			templates[step] = text
+		}
+	}
+	return templates
+}
+
+// WatchdogConfig holds configuration for failing or requeueing deployments stuck in running
+type WatchdogConfig struct {
+	Enabled     bool
+	Interval    time.Duration
+	MaxDuration time.Duration
+	Requeue     bool
+	MaxRequeues int
+}
+
+// OutboxConfig holds configuration for publishing buffered deployment jobs to Redis
+type OutboxConfig struct {
+	PublishInterval time.Duration
+	BatchSize       int
+	Retention       time.Duration
+}
+
+// SchedulerConfig holds configuration for creating the deployments of cron schedules
+type SchedulerConfig struct {
+	Enabled  bool
+	Interval time.Duration
+}
+
+// LeaderElectionConfig holds configuration for electing the one server that runs the background
+// components, so several servers can serve the API without duplicating their work
+type LeaderElectionConfig struct {
+	Enabled bool
+	// LeaseTTL is how long leadership lasts without being renewed; after a leader dies, another
+	// server takes over within it
+	LeaseTTL      time.Duration
+	RenewInterval time.Duration
+}
+
+// GateConfig holds configuration for failing deployments whose gates were not reported in time
+type GateConfig struct {
+	Interval time.Duration
+}
+
+// ApplicationConfig holds configuration for deploying the services of application releases in order
+type ApplicationConfig struct {
+	// Interval is how often the server queues the next service of each release
+	Interval time.Duration
+	// ReleaseTimeout is how long a service waits for the services before it before it fails
+	ReleaseTimeout time.Duration
+}
+
+// NotificationConfig holds the channels project notifications are delivered to
+type NotificationConfig struct {
+	// Channels are "name=url" entries; project configurations refer to channels by name, so the
+	// webhook URLs, which often embed a secret, stay out of them
+	Channels []string
+	// Interval is how often digests and escalations are checked
+	Interval time.Duration
+	// Timeout bounds the delivery of one notification
+	Timeout time.Duration
+}
+
+// ChannelURLs returns the webhook URL of each notification channel by name
+func (c NotificationConfig) ChannelURLs() map[string]string {
+	urls := make(map[string]string, len(c.Channels))
+	for _, channel := range c.Channels {
+		if name, webhook, ok := strings.Cut(channel, "="); ok {
+			urls[strings.TrimSpace(name)] = strings.TrimSpace(webhook)
+		}
+	}
+	return urls
+}
+
+// IncidentConfig holds the incident management services failed deployments are reported to
+type IncidentConfig struct {
+	// Services are "name=provider:key" entries: a PagerDuty integration routing key or an Opsgenie
+	// API key. Project configurations refer to services by name, so the keys stay out of them.
+	Services []string
+	// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+	PagerDutyEventsURL string
+	// OpsgenieAPIURL is the base URL of the Opsgenie API, such as https://api.eu.opsgenie.com
+	OpsgenieAPIURL string
+	// Interval is how often failed and fixed deployments are looked for
+	Interval time.Duration
+	// Timeout bounds the delivery of one incident event
+	Timeout time.Duration
+}
+
+// Incident management providers
+const (
+	IncidentProviderPagerDuty = "pagerduty"
+	IncidentProviderOpsgenie  = "opsgenie"
+)
+
+// IncidentService is an incident management service incidents are created in
+type IncidentService struct {
+	Provider string
+	Key      string
+}
+
+// ServiceKeys returns each incident service by name
+func (c IncidentConfig) ServiceKeys() map[string]IncidentService {
+	services := make(map[string]IncidentService, len(c.Services))
+	for _, entry := range c.Services {
+		name, service, _ := strings.Cut(entry, "=")
+		provider, key, _ := strings.Cut(service, ":")
+		services[strings.TrimSpace(name)] = IncidentService{Provider: strings.TrimSpace(provider), Key: strings.TrimSpace(key)}
+	}
+	return services
+}
+
+// GitHubDeploymentsConfig holds the reporting of deployments to GitHub's Deployments API, which
+// shows their live status in the environments of the source repository
+type GitHubDeploymentsConfig struct {
+	Enabled bool
+	// APIURL is the base URL of the GitHub API
+	APIURL string
+	// PublicURL is the public URL of the server the deployment statuses link back to; without it
+	// they carry no links
+	PublicURL string
+	// Interval is how often deployment status changes are looked for
+	Interval time.Duration
+	// Timeout bounds one request to GitHub
+	Timeout time.Duration
+}
+
+// LogSinkConfig holds the external logging systems deployment logs are mirrored to
+type LogSinkConfig struct {
+	// Sinks are "name=kind:target" entries: a Loki push URL, an Elasticsearch index URL or a
+	// CloudWatch Logs "region:log-group". Basic auth credentials go in the URL's user info.
+	Sinks []string
+	// Interval is how often new deployment logs are looked for
+	Interval time.Duration
+	// BatchSize is the number of log entries sent to a sink per request
+	BatchSize int
+	// Timeout bounds one request to a sink
+	Timeout time.Duration
+	// MaxBackoff caps the delay between retries of a sink that keeps failing
+	MaxBackoff time.Duration
+	// AWS credentials for CloudWatch Logs sinks
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+}
+
+// Log sink kinds
+const (
+	LogSinkLoki          = "loki"
+	LogSinkElasticsearch = "elasticsearch"
+	LogSinkCloudWatch    = "cloudwatch"
+)
+
+// LogSink is an external logging system deployment logs are sent to
+type LogSink struct {
+	Name   string
+	Kind   string
+	Target string
+}
+
+// SinkTargets returns the log sinks in the order they are configured
+func (c LogSinkConfig) SinkTargets() []LogSink {
+	sinks := make([]LogSink, 0, len(c.Sinks))
+	for _, entry := range c.Sinks {
+		name, sink, _ := strings.Cut(entry, "=")
+		kind, target, _ := strings.Cut(sink, ":")
+		sinks = append(sinks, LogSink{Name: strings.TrimSpace(name), Kind: strings.TrimSpace(kind), Target: strings.TrimSpace(target)})
+	}
+	return sinks
+}
+
+// HealthConfig holds thresholds for reporting deployments as stalled in health checks
+type HealthConfig struct {
+	WorkerStaleAfter time.Duration
+	MaxPendingAge    time.Duration
+}
+
+// PreflightConfig holds configuration for the checks run before a deployment is enqueued
+type PreflightConfig struct {
+	Enabled      bool
+	SSHCheck     bool
+	GitHubAPIURL string
+	Timeout      time.Duration
+}
+
+// ChangelogConfig holds the generation of deployment changelogs from the GitHub compare API
+type ChangelogConfig struct {
+	Enabled bool
+	// GitHubAPIURL is the base URL of the GitHub API
+	GitHubAPIURL string
+	// Timeout bounds the request for the commits of a deployment
+	Timeout time.Duration
+}
+
+// JWTConfig holds the JWT signing secrets. Tokens are signed with Secret and tagged with KeyID;
+// tokens signed with PreviousSecret keep validating until it is removed, allowing secret rotation.
+type JWTConfig struct {
+	Secret         string
+	KeyID          string
+	PreviousSecret string
+	PreviousKeyID  string
+}
+
+// TLSConfig holds configuration for serving HTTPS directly. Certificates come either from
+// CertFile/KeyFile or from Let's Encrypt when AutocertDomains is set.
+type TLSConfig struct {
+	CertFile         string
+	KeyFile          string
+	AutocertDomains  []string
+	AutocertCacheDir string
+	AutocertEmail    string
+	RedirectHTTP     bool
+	HTTPPort         string
+}
+
+// CORSConfig holds cross-origin resource sharing configuration
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowCredentials bool
+}
+
+// UploadConfig holds request body and file upload limits, in bytes
+type UploadConfig struct {
+	MaxBodySize        int64
+	MaxMultipartMemory int64
+	MaxEnvFileSize     int64
+}
+
+// SecurityHeadersConfig holds configuration for the security headers added to every response
+type SecurityHeadersConfig struct {
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	FrameOptions          string
+}
+
+// AdminConfig holds configuration for administrator accounts
+type AdminConfig struct {
+	Usernames []string
+}
+
+// QuotaConfig holds per-user deployment limits; zero means unlimited
+type QuotaConfig struct {
+	MaxActiveDeployments int
+	MaxDeploymentsPerDay int
+}
+
+// ExecConfig holds configuration for interactive shells in deployment containers
+type ExecConfig struct {
+	Enabled           bool
+	MaxDuration       time.Duration
+	IdleTimeout       time.Duration
+	ConnectTimeout    time.Duration
+	MaxTranscriptSize int64
+}
+
+// StatusPageConfig holds configuration for the public status pages of projects that opt in
+type StatusPageConfig struct {
+	Enabled bool
+	// HistoryDays is how many days of deployment history a status page shows
+	HistoryDays int
+	// CacheMaxAge is how long clients and proxies may cache a status page
+	CacheMaxAge time.Duration
+}
+
+// BadgeConfig holds configuration for the deployment status badges of projects
+type BadgeConfig struct {
+	// CacheMaxAge is how long clients and proxies, such as GitHub's image proxy, may cache a badge
+	CacheMaxAge time.Duration
+}
+
+// FilesConfig holds configuration for browsing the files of deployment workspaces and containers
+type FilesConfig struct {
+	Enabled        bool
+	MaxFileSize    int64
+	MaxEntries     int
+	ConnectTimeout time.Duration
+}
+
+// OAuthConfig holds configuration for signing in with GitHub, Google or a generic OIDC provider.
+// A provider is enabled when its client ID is set.
+type OAuthConfig struct {
+	// RedirectBaseURL is the public URL of the server the providers redirect back to
+	RedirectBaseURL string
+	// SuccessRedirectURL receives the token in its fragment after login; JSON is returned when unset
+	SuccessRedirectURL string
+	StateTTL           time.Duration
+	HTTPTimeout        time.Duration
+	AutoProvision      bool
+	LinkVerifiedEmails bool
+	AllowedDomains     []string
+	// OrganizationClaim names the OIDC claim holding the slug of the user's organization
+	OrganizationClaim string
+
+	GitHubClientID     string
+	GitHubClientSecret string
+	GitHubURL          string
+	GitHubAPIURL       string
+
+	GoogleClientID     string
+	GoogleClientSecret string
+
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCScopes       []string
+}
+
+// SCIMConfig holds configuration for SCIM 2.0 user provisioning by identity providers
+type SCIMConfig struct {
+	// Token is the bearer token identity providers authenticate with; SCIM is disabled when it is empty
+	Token string
+}
+
+// SlackConfig holds configuration for the Slack slash command
+type SlackConfig struct {
+	// SigningSecret verifies that requests come from the Slack app; the slash command is disabled when it is empty
+	SigningSecret string
+	// LinkCodeTTL is how long a code for linking a Slack account stays valid
+	LinkCodeTTL time.Duration
+}
+
+// AccessConfig holds configuration for restricting where the API may be used from
+type AccessConfig struct {
+	// AllowedCIDRs restricts deployment creation and target access for every user; empty allows any network
+	AllowedCIDRs []string
+	// TrustedProxies are the proxies whose X-Forwarded-For and X-Real-IP headers are believed; empty
+	// or "none" trusts no one
+	TrustedProxies []string
+}
+
+// TrustsNoProxies reports whether client IPs are taken from the connection alone
+func (a AccessConfig) TrustsNoProxies() bool {
+	return len(a.TrustedProxies) == 0 || len(a.TrustedProxies) == 1 && strings.EqualFold(a.TrustedProxies[0], "none")
+}
+
+// CredentialsConfig holds configuration for deployment credentials
+type CredentialsConfig struct {
+	// OneTimeTTL is how long the credentials of a one-time deployment stay usable after it is created
+	OneTimeTTL time.Duration
+	// SSHCertTTL is how long the certificates signed by the SSH certificate authority stay valid
+	SSHCertTTL time.Duration
+}
+
+// AutoscaleConfig holds configuration for the queue metrics endpoints and worker scaling advisories
+type AutoscaleConfig struct {
+	// MetricsToken is the bearer token required by /metrics; the endpoints are open when it is empty
+	MetricsToken string
+	// JobsPerWorker is how many queued jobs one worker is expected to work through in addition to the job it is running
+	JobsPerWorker int
+	MinWorkers    int
+	MaxWorkers    int
+	// AdvisoriesEnabled makes the server evaluate the queue every interval and emit scale-up and scale-down advisories
+	AdvisoriesEnabled bool
+	Interval          time.Duration
+	// Cooldown is the minimum time between two advisories of the same direction
+	Cooldown time.Duration
+	// WebhookURL receives every advisory as a JSON POST when set
+	WebhookURL string
+}
+
+// ArtifactsConfig holds configuration for the files kept with deployments, such as full build logs
+type ArtifactsConfig struct {
+	// BuildLogs stores the full output of every image build as a compressed build.log artifact
+	BuildLogs bool
+	// MaxSize bounds the uncompressed size of an artifact; longer output is truncated
+	MaxSize int64
+	// Retention is how long artifacts are kept; they are never deleted when it is zero
+	Retention time.Duration
+}
+
+// VolumeBackupConfig holds configuration for backing up the data of managed services to
+// S3-compatible storage. Backups are enabled when a bucket is set.
+type VolumeBackupConfig struct {
+	// Endpoint is the URL of the storage service, such as https://s3.eu-west-1.amazonaws.com or
+	// the URL of a MinIO server; objects are addressed path-style, as endpoint/bucket/key
+	Endpoint string
+	Bucket   string
+	Region   string
+	// Prefix is prepended to the keys of the backup objects
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Interval is how often the server looks for managed services whose backup is due
+	Interval time.Duration
+	// Timeout bounds one backup or restore, including the transfer to or from storage
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+}
+
+// Enabled reports whether a backup bucket is configured
+func (c VolumeBackupConfig) Enabled() bool {
+	return c.Bucket != ""
+}
+
+// CronJobConfig holds configuration for collecting the runs of cron deployments from the targets
+// they run on
+type CronJobConfig struct {
+	CollectEnabled bool
+	// Interval is how often the server reads the run logs of the installed cron jobs
+	Interval       time.Duration
+	ConnectTimeout time.Duration
+	// OutputLimit bounds how much of the end of a run's output is kept
+	OutputLimit int64
+}
+
+// SSHTargetConfig holds the limits on the SSH connections and sessions that every server and worker
+// sharing a Redis together open to one target, so a busy target queues operations instead of
+// refusing them
+type SSHTargetConfig struct {
+	LimitsEnabled bool
+	// MaxConnections is how many SSH connections may be open to a target at once
+	MaxConnections int
+	// SessionRate is how many SSH sessions, each command or file transfer, may be opened on a
+	// target per second; opening a connection counts as one
+	SessionRate int
+	// WaitTimeout bounds how long an operation waits for a connection or session before failing
+	WaitTimeout time.Duration
+}
+
+// StartupConfig holds configuration for connecting to dependencies at startup
+type StartupConfig struct {
+	ConnectRetries int
+	ConnectBackoff time.Duration
+}
+
+// Docker execution backends supported by the worker
+const (
+	DockerBackendShell = "shell"
+	DockerBackendAPI   = "api"
+)
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
 		// Don't return error if .env file doesn't exist
-		fmt.Println("No .env file found, using environment variables")
+		fmt.Fprintln(os.Stderr, "No .env file found, using environment variables")
 	}
 
 	config := &Config{
@@ -64,33 +663,320 @@ func Load() (*Config, error) {
 			ReadTimeout:  getDurationEnv("SERVER_READ_TIMEOUT", 30*time.Second),
 			WriteTimeout: getDurationEnv("SERVER_WRITE_TIMEOUT", 30*time.Second),
 			IdleTimeout:  getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			WithWorker:   getBoolEnv("SERVER_WITH_WORKER", false),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "root"),
-			DBName:   getEnv("DB_NAME", "postgres"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
-			Schema:   getEnv("DB_SCHEMA", "deploy_knot"),
+			Driver:     getEnv("DB_DRIVER", "postgres"),
+			SQLitePath: getEnv("SQLITE_PATH", "deployknot.db"),
+			Host:       getEnv("DB_HOST", "localhost"),
+			Port:       getEnv("DB_PORT", "5432"),
+			User:       getEnv("DB_USER", "postgres"),
+			Password:   getEnv("DB_PASSWORD", "root"),
+			DBName:     getEnv("DB_NAME", "postgres"),
+			SSLMode:    getEnv("DB_SSLMODE", "disable"),
+			Schema:     getEnv("DB_SCHEMA", "deploy_knot"),
+			ReplicaURL: getEnv("DB_REPLICA_URL", ""),
 		},
 		Redis: RedisConfig{
+			Embedded: getBoolEnv("REDIS_EMBEDDED", false),
 			Host:     getEnv("REDIS_HOST", "localhost"),
 			Port:     getEnv("REDIS_PORT", "6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getIntEnv("REDIS_DB", 0),
 		},
+		Cache: CacheConfig{
+			DeploymentTTL: getDurationEnv("DEPLOYMENT_CACHE_TTL", 30*time.Second),
+		},
 		Logging: LoggingConfig{
 			Level: getEnv("LOG_LEVEL", "info"),
 		},
-		JWTSecret: getEnv("JWT_SECRET", "changeme-super-secret"),
+		Worker: WorkerConfig{
+			DockerBackend:           getEnv("WORKER_DOCKER_BACKEND", DockerBackendShell),
+			DockerSocket:            getEnv("WORKER_DOCKER_SOCKET", "/var/run/docker.sock"),
+			HeartbeatInterval:       getDurationEnv("WORKER_HEARTBEAT_INTERVAL", 15*time.Second),
+			Pool:                    getEnv("WORKER_POOL", ""),
+			HealthyTimeout:          getDurationEnv("WORKER_HEALTHY_TIMEOUT", 5*time.Minute),
+			DependencyTimeout:       getDurationEnv("WORKER_DEPENDENCY_TIMEOUT", 2*time.Minute),
+			TargetLogs:              getBoolEnv("WORKER_TARGET_LOGS", false),
+			TargetLogLines:          getIntEnv("WORKER_TARGET_LOG_LINES", 200),
+			DockerBuild:             getBoolEnv("WORKER_DOCKER_BUILD", true),
+			MaxConcurrentJobs:       getIntEnv("WORKER_MAX_CONCURRENT_JOBS", 1),
+			Networks:                getListEnv("WORKER_NETWORKS", nil),
+			SecretScan:              getEnv("WORKER_SECRET_SCAN", "off"),
+			LocalFileDirs:           getListEnv("WORKER_LOCAL_FILE_DIRS", []string{models.EnvFileDir}),
+			ExecUser:                getEnv("WORKER_EXEC_USER", ""),
+			AllowUnisolatedCommands: getBoolEnv("WORKER_ALLOW_UNISOLATED_COMMANDS", false),
+			SSHRetryAttempts:        getIntEnv("WORKER_SSH_RETRY_ATTEMPTS", 3),
+			SSHRetryBackoff:         getDurationEnv("WORKER_SSH_RETRY_BACKOFF", time.Second),
+			SSHRetryMaxBackoff:      getDurationEnv("WORKER_SSH_RETRY_MAX_BACKOFF", 15*time.Second),
+			SSHCommandTimeout:       getDurationEnv("WORKER_SSH_COMMAND_TIMEOUT", time.Hour),
+		},
+		Queue: QueueConfig{
+			JobTTL:       getDurationEnv("QUEUE_JOB_TTL", 24*time.Hour),
+			Backend:      getEnv("QUEUE_BACKEND", QueueBackendRedis),
+			NATSURL:      getEnv("NATS_URL", "nats://localhost:4222"),
+			NATSStream:   getEnv("NATS_STREAM", "DEPLOYKNOT_JOBS"),
+			NATSReplicas: getIntEnv("NATS_REPLICAS", 1),
+		},
+		WorkerAPI: WorkerAPIConfig{
+			Enabled: getBoolEnv("WORKER_API_ENABLED", false),
+			Port:    getEnv("WORKER_API_PORT", "9090"),
+		},
+		GraphQL: GraphQLConfig{
+			Enabled: getBoolEnv("GRAPHQL_ENABLED", false),
+		},
+		Commands: CommandTemplateConfig{
+			GitClone:    getEnv("COMMAND_TEMPLATE_GIT_CLONE", ""),
+			DockerBuild: getEnv("COMMAND_TEMPLATE_DOCKER_BUILD", ""),
+			DockerRun:   getEnv("COMMAND_TEMPLATE_DOCKER_RUN", ""),
+		},
+		Watchdog: WatchdogConfig{
+			Enabled:     getBoolEnv("WATCHDOG_ENABLED", true),
+			Interval:    getDurationEnv("WATCHDOG_INTERVAL", time.Minute),
+			MaxDuration: getDurationEnv("DEPLOYMENT_MAX_DURATION", time.Hour),
+			Requeue:     getBoolEnv("WATCHDOG_REQUEUE", false),
+			MaxRequeues: getIntEnv("WATCHDOG_MAX_REQUEUES", 1),
+		},
+		Outbox: OutboxConfig{
+			PublishInterval: getDurationEnv("OUTBOX_PUBLISH_INTERVAL", 5*time.Second),
+			BatchSize:       getIntEnv("OUTBOX_BATCH_SIZE", 100),
+			Retention:       getDurationEnv("OUTBOX_RETENTION", 7*24*time.Hour),
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:  getBoolEnv("SCHEDULER_ENABLED", true),
+			Interval: getDurationEnv("SCHEDULER_INTERVAL", 30*time.Second),
+		},
+		Leader: LeaderElectionConfig{
+			Enabled:       getBoolEnv("LEADER_ELECTION_ENABLED", false),
+			LeaseTTL:      getDurationEnv("LEADER_LEASE_TTL", 15*time.Second),
+			RenewInterval: getDurationEnv("LEADER_RENEW_INTERVAL", 5*time.Second),
+		},
+		Gates: GateConfig{
+			Interval: getDurationEnv("GATE_CHECK_INTERVAL", 30*time.Second),
+		},
+		Applications: ApplicationConfig{
+			Interval:       getDurationEnv("APPLICATION_RELEASE_INTERVAL", 15*time.Second),
+			ReleaseTimeout: getDurationEnv("APPLICATION_RELEASE_TIMEOUT", 2*time.Hour),
+		},
+		Notifications: NotificationConfig{
+			Channels: getListEnv("NOTIFICATION_CHANNELS", nil),
+			Interval: getDurationEnv("NOTIFICATION_INTERVAL", time.Minute),
+			Timeout:  getDurationEnv("NOTIFICATION_TIMEOUT", 10*time.Second),
+		},
+		Incidents: IncidentConfig{
+			Services:           getListEnv("INCIDENT_SERVICES", nil),
+			PagerDutyEventsURL: getEnv("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue"),
+			OpsgenieAPIURL:     strings.TrimSuffix(getEnv("OPSGENIE_API_URL", "https://api.opsgenie.com"), "/"),
+			Interval:           getDurationEnv("INCIDENT_CHECK_INTERVAL", 30*time.Second),
+			Timeout:            getDurationEnv("INCIDENT_TIMEOUT", 10*time.Second),
+		},
+		GitHub: GitHubDeploymentsConfig{
+			Enabled:   getBoolEnv("GITHUB_DEPLOYMENTS_ENABLED", false),
+			APIURL:    strings.TrimSuffix(getEnv("GITHUB_API_URL", "https://api.github.com"), "/"),
+			PublicURL: strings.TrimSuffix(getEnv("GITHUB_DEPLOYMENTS_PUBLIC_URL", getEnv("OAUTH_REDIRECT_BASE_URL", "")), "/"),
+			Interval:  getDurationEnv("GITHUB_DEPLOYMENTS_INTERVAL", 10*time.Second),
+			Timeout:   getDurationEnv("GITHUB_DEPLOYMENTS_TIMEOUT", 10*time.Second),
+		},
+		LogSinks: LogSinkConfig{
+			Sinks:              getListEnv("LOG_SINKS", nil),
+			Interval:           getDurationEnv("LOG_SINK_INTERVAL", 2*time.Second),
+			BatchSize:          getIntEnv("LOG_SINK_BATCH_SIZE", 500),
+			Timeout:            getDurationEnv("LOG_SINK_TIMEOUT", 10*time.Second),
+			MaxBackoff:         getDurationEnv("LOG_SINK_MAX_BACKOFF", 5*time.Minute),
+			AWSAccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			AWSSessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		},
+		Health: HealthConfig{
+			WorkerStaleAfter: getDurationEnv("HEALTH_WORKER_STALE_AFTER", time.Minute),
+			MaxPendingAge:    getDurationEnv("HEALTH_MAX_PENDING_AGE", 5*time.Minute),
+		},
+		Preflight: PreflightConfig{
+			Enabled:      getBoolEnv("PREFLIGHT_ENABLED", true),
+			SSHCheck:     getBoolEnv("PREFLIGHT_SSH_CHECK", false),
+			GitHubAPIURL: getEnv("GITHUB_API_URL", "https://api.github.com"),
+			Timeout:      getDurationEnv("PREFLIGHT_TIMEOUT", 10*time.Second),
+		},
+		Changelog: ChangelogConfig{
+			Enabled:      getBoolEnv("CHANGELOG_ENABLED", true),
+			GitHubAPIURL: strings.TrimSuffix(getEnv("GITHUB_API_URL", "https://api.github.com"), "/"),
+			Timeout:      getDurationEnv("CHANGELOG_TIMEOUT", 5*time.Second),
+		},
+		TLS: TLSConfig{
+			CertFile:         getEnv("TLS_CERT_FILE", ""),
+			KeyFile:          getEnv("TLS_KEY_FILE", ""),
+			AutocertDomains:  getListEnv("TLS_AUTOCERT_DOMAINS", nil),
+			AutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "autocert-cache"),
+			AutocertEmail:    getEnv("TLS_AUTOCERT_EMAIL", ""),
+			RedirectHTTP:     getBoolEnv("TLS_REDIRECT_HTTP", false),
+			HTTPPort:         getEnv("TLS_HTTP_PORT", "80"),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   getListEnv("CORS_ALLOWED_ORIGINS", []string{"*"}),
+			AllowCredentials: getBoolEnv("CORS_ALLOW_CREDENTIALS", false),
+		},
+		Uploads: UploadConfig{
+			MaxBodySize:        getSizeEnv("MAX_REQUEST_BODY_SIZE", 10<<20),
+			MaxMultipartMemory: getSizeEnv("MAX_MULTIPART_MEMORY", 8<<20),
+			MaxEnvFileSize:     getSizeEnv("MAX_ENV_FILE_SIZE", 1<<20),
+		},
+		Headers: SecurityHeadersConfig{
+			HSTSMaxAge:            getDurationEnv("HSTS_MAX_AGE", 180*24*time.Hour),
+			HSTSIncludeSubdomains: getBoolEnv("HSTS_INCLUDE_SUBDOMAINS", false),
+			FrameOptions:          getEnv("FRAME_OPTIONS", "DENY"),
+		},
+		Admin: AdminConfig{
+			Usernames: getListEnv("ADMIN_USERNAMES", nil),
+		},
+		Quotas: QuotaConfig{
+			MaxActiveDeployments: getIntEnv("QUOTA_MAX_ACTIVE_DEPLOYMENTS", 0),
+			MaxDeploymentsPerDay: getIntEnv("QUOTA_MAX_DEPLOYMENTS_PER_DAY", 0),
+		},
+		Exec: ExecConfig{
+			Enabled:           getBoolEnv("EXEC_ENABLED", false),
+			MaxDuration:       getDurationEnv("EXEC_MAX_DURATION", time.Hour),
+			IdleTimeout:       getDurationEnv("EXEC_IDLE_TIMEOUT", 15*time.Minute),
+			ConnectTimeout:    getDurationEnv("EXEC_CONNECT_TIMEOUT", 10*time.Second),
+			MaxTranscriptSize: getSizeEnv("EXEC_MAX_TRANSCRIPT_SIZE", 1<<20),
+		},
+		StatusPage: StatusPageConfig{
+			Enabled:     getBoolEnv("STATUS_PAGE_ENABLED", false),
+			HistoryDays: getIntEnv("STATUS_PAGE_HISTORY_DAYS", 90),
+			CacheMaxAge: getDurationEnv("STATUS_PAGE_CACHE_MAX_AGE", time.Minute),
+		},
+		Badges: BadgeConfig{
+			CacheMaxAge: getDurationEnv("BADGE_CACHE_MAX_AGE", time.Minute),
+		},
+		Files: FilesConfig{
+			Enabled:        getBoolEnv("FILES_ENABLED", true),
+			MaxFileSize:    getSizeEnv("FILES_MAX_FILE_SIZE", 10<<20),
+			MaxEntries:     getIntEnv("FILES_MAX_ENTRIES", 1000),
+			ConnectTimeout: getDurationEnv("FILES_CONNECT_TIMEOUT", 10*time.Second),
+		},
+		OAuth: OAuthConfig{
+			RedirectBaseURL:    strings.TrimSuffix(getEnv("OAUTH_REDIRECT_BASE_URL", ""), "/"),
+			SuccessRedirectURL: getEnv("OAUTH_SUCCESS_REDIRECT_URL", ""),
+			StateTTL:           getDurationEnv("OAUTH_STATE_TTL", 10*time.Minute),
+			HTTPTimeout:        getDurationEnv("OAUTH_HTTP_TIMEOUT", 10*time.Second),
+			AutoProvision:      getBoolEnv("OAUTH_AUTO_PROVISION", true),
+			LinkVerifiedEmails: getBoolEnv("OAUTH_LINK_VERIFIED_EMAILS", false),
+			AllowedDomains:     getListEnv("OAUTH_ALLOWED_DOMAINS", nil),
+			OrganizationClaim:  getEnv("OAUTH_ORGANIZATION_CLAIM", ""),
+			GitHubClientID:     getEnv("OAUTH_GITHUB_CLIENT_ID", ""),
+			GitHubClientSecret: getEnv("OAUTH_GITHUB_CLIENT_SECRET", ""),
+			GitHubURL:          strings.TrimSuffix(getEnv("OAUTH_GITHUB_URL", "https://github.com"), "/"),
+			GitHubAPIURL:       strings.TrimSuffix(getEnv("OAUTH_GITHUB_API_URL", "https://api.github.com"), "/"),
+			GoogleClientID:     getEnv("OAUTH_GOOGLE_CLIENT_ID", ""),
+			GoogleClientSecret: getEnv("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+			OIDCIssuerURL:      strings.TrimSuffix(getEnv("OIDC_ISSUER_URL", ""), "/"),
+			OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+			OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+			OIDCScopes:         getListEnv("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		},
+		SCIM: SCIMConfig{
+			Token: getEnv("SCIM_TOKEN", ""),
+		},
+		Slack: SlackConfig{
+			SigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+			LinkCodeTTL:   getDurationEnv("SLACK_LINK_CODE_TTL", 10*time.Minute),
+		},
+		Credentials: CredentialsConfig{
+			OneTimeTTL: getDurationEnv("ONE_TIME_CREDENTIALS_TTL", time.Hour),
+			SSHCertTTL: getDurationEnv("SSH_CERT_TTL", 5*time.Minute),
+		},
+		Access: AccessConfig{
+			AllowedCIDRs:   getListEnv("API_ALLOWED_CIDRS", nil),
+			TrustedProxies: getListEnv("TRUSTED_PROXIES", nil),
+		},
+		Autoscale: AutoscaleConfig{
+			MetricsToken:      getEnv("METRICS_TOKEN", ""),
+			JobsPerWorker:     getIntEnv("AUTOSCALE_JOBS_PER_WORKER", 1),
+			MinWorkers:        getIntEnv("AUTOSCALE_MIN_WORKERS", 1),
+			MaxWorkers:        getIntEnv("AUTOSCALE_MAX_WORKERS", 10),
+			AdvisoriesEnabled: getBoolEnv("AUTOSCALE_ADVISORIES_ENABLED", false),
+			Interval:          getDurationEnv("AUTOSCALE_INTERVAL", 30*time.Second),
+			Cooldown:          getDurationEnv("AUTOSCALE_COOLDOWN", 5*time.Minute),
+			WebhookURL:        getEnv("AUTOSCALE_WEBHOOK_URL", ""),
+		},
+		Artifacts: ArtifactsConfig{
+			BuildLogs: getBoolEnv("BUILD_LOG_ARTIFACTS", false),
+			MaxSize:   getSizeEnv("ARTIFACT_MAX_SIZE", 100<<20),
+			Retention: getDurationEnv("ARTIFACT_RETENTION", 30*24*time.Hour),
+		},
+		VolumeBackups: VolumeBackupConfig{
+			Endpoint:        getEnv("VOLUME_BACKUP_S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Bucket:          getEnv("VOLUME_BACKUP_S3_BUCKET", ""),
+			Region:          getEnv("VOLUME_BACKUP_S3_REGION", "us-east-1"),
+			Prefix:          getEnv("VOLUME_BACKUP_S3_PREFIX", "deployknot/"),
+			AccessKeyID:     getEnv("VOLUME_BACKUP_S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: getEnv("VOLUME_BACKUP_S3_SECRET_ACCESS_KEY", ""),
+			Interval:        getDurationEnv("VOLUME_BACKUP_INTERVAL", time.Minute),
+			Timeout:         getDurationEnv("VOLUME_BACKUP_TIMEOUT", time.Hour),
+			ConnectTimeout:  getDurationEnv("VOLUME_BACKUP_CONNECT_TIMEOUT", 10*time.Second),
+		},
+		CronJobs: CronJobConfig{
+			CollectEnabled: getBoolEnv("CRON_JOB_COLLECT_ENABLED", true),
+			Interval:       getDurationEnv("CRON_JOB_COLLECT_INTERVAL", time.Minute),
+			ConnectTimeout: getDurationEnv("CRON_JOB_CONNECT_TIMEOUT", 10*time.Second),
+			OutputLimit:    getSizeEnv("CRON_JOB_OUTPUT_LIMIT", 64<<10),
+		},
+		SSHTargets: SSHTargetConfig{
+			LimitsEnabled:  getBoolEnv("SSH_TARGET_LIMITS_ENABLED", true),
+			MaxConnections: getIntEnv("SSH_TARGET_MAX_CONNECTIONS", 8),
+			SessionRate:    getIntEnv("SSH_TARGET_SESSION_RATE", 10),
+			WaitTimeout:    getDurationEnv("SSH_TARGET_WAIT_TIMEOUT", 5*time.Minute),
+		},
+		Startup: StartupConfig{
+			ConnectRetries: getIntEnv("STARTUP_CONNECT_RETRIES", 5),
+			ConnectBackoff: getDurationEnv("STARTUP_CONNECT_BACKOFF", time.Second),
+		},
+		EncryptionKey: getEnv("ENCRYPTION_KEY", defaultEncryptionKey),
+	}
+
+	// A deployment lock outlives the maximum duration until the watchdog's next sweep
+	config.Worker.LockTTL = config.Watchdog.MaxDuration + config.Watchdog.Interval
+
+	config.JWT.Secret = getEnv("JWT_SECRET", defaultJWTSecret)
+	config.JWT.PreviousSecret = getEnv("JWT_PREVIOUS_SECRET", "")
+
+	// Key IDs are derived from the decrypted secrets
+	if err := config.decryptSecrets(); err != nil {
+		return nil, err
+	}
+
+	config.JWT.KeyID = getEnv("JWT_KEY_ID", deriveKeyID(config.JWT.Secret))
+	if config.JWT.PreviousSecret != "" {
+		config.JWT.PreviousKeyID = getEnv("JWT_PREVIOUS_KEY_ID", deriveKeyID(config.JWT.PreviousSecret))
 	}
 
 	return config, nil
 }
 
+// Enabled reports whether the server should serve HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.UsesAutocert()
+}
+
+// Enabled reports whether any OAuth or OIDC provider is configured
+func (o OAuthConfig) Enabled() bool {
+	return o.GitHubClientID != "" || o.GoogleClientID != "" || o.OIDCClientID != ""
+}
+
+// Enabled reports whether the Slack slash command is configured
+func (s SlackConfig) Enabled() bool {
+	return s.SigningSecret != ""
+}
+
+// UsesAutocert reports whether certificates are obtained from Let's Encrypt
+func (t TLSConfig) UsesAutocert() bool {
+	return len(t.AutocertDomains) > 0
+}
+
 // GetDatabaseURL returns the database connection string
 func (c *Config) GetDatabaseURL() string {
+	if c.Database.UsesSQLite() {
+		return "sqlite:" + c.Database.SQLitePath
+	}
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s&search_path=%s",
 		c.Database.User,
 		c.Database.Password,
@@ -104,6 +990,9 @@ func (c *Config) GetDatabaseURL() string {
 
 // GetRedisURL returns the Redis connection string
 func (c *Config) GetRedisURL() string {
+	if c.Redis.Embedded {
+		return "memory:"
+	}
 	if c.Redis.Password != "" {
 		return fmt.Sprintf("redis://:%s@%s:%s/%d",
 			c.Redis.Password,
@@ -121,7 +1010,18 @@ func (c *Config) GetRedisURL() string {
 
 // GetJWTSecret returns the JWT secret
 func (c *Config) GetJWTSecret() string {
-	return c.JWTSecret
+	return c.JWT.Secret
+}
+
+// deriveKeyID derives a stable key ID from a secret so rotation works without configuring IDs
+func deriveKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// GetEncryptionKey returns the key used to encrypt stored secrets
+func (c *Config) GetEncryptionKey() string {
+	return c.EncryptionKey
 }
 
 // Helper functions
@@ -141,6 +1041,53 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getSizeEnv parses a byte size such as "1048576", "512KB" or "10MB"
+func getSizeEnv(key string, defaultValue int64) int64 {
+	value := strings.ToUpper(strings.TrimSpace(os.Getenv(key)))
+	if value == "" {
+		return defaultValue
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return size * multiplier
+	}
+	return defaultValue
+}
+
+func getListEnv(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return defaultValue
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
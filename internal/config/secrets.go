@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Prefixes of encrypted configuration values, which are decrypted when the configuration is loaded
+const (
+	// ageValuePrefix starts a value encrypted with age, base64 encoded or ASCII armored. It is
+	// decrypted with the identities in AGE_IDENTITY_FILE.
+	ageValuePrefix = "age:"
+	// awsKMSValuePrefix starts the base64 encoded CiphertextBlob of an AWS KMS encryption. It is
+	// decrypted with the aws CLI, which finds its credentials as usual.
+	awsKMSValuePrefix = "awskms:"
+)
+
+// kmsDecryptTimeout bounds how long decrypting one value with AWS KMS may take
+const kmsDecryptTimeout = 30 * time.Second
+
+// secretValues returns the settings that hold secrets by their environment variable, so they can
+// be given encrypted
+func (c *Config) secretValues() map[string]*string {
+	return map[string]*string{
+		"DB_PASSWORD":                &c.Database.Password,
+		"REDIS_PASSWORD":             &c.Redis.Password,
+		"JWT_SECRET":                 &c.JWT.Secret,
+		"JWT_PREVIOUS_SECRET":        &c.JWT.PreviousSecret,
+		"ENCRYPTION_KEY":             &c.EncryptionKey,
+		"OAUTH_GITHUB_CLIENT_SECRET": &c.OAuth.GitHubClientSecret,
+		"OAUTH_GOOGLE_CLIENT_SECRET": &c.OAuth.GoogleClientSecret,
+		"OIDC_CLIENT_SECRET":         &c.OAuth.OIDCClientSecret,
+		"SCIM_TOKEN":                 &c.SCIM.Token,
+		"SLACK_SIGNING_SECRET":       &c.Slack.SigningSecret,
+		"METRICS_TOKEN":              &c.Autoscale.MetricsToken,
+		"AWS_SECRET_ACCESS_KEY":      &c.LogSinks.AWSSecretAccessKey,
+		"AWS_SESSION_TOKEN":          &c.LogSinks.AWSSessionToken,
+	}
+}
+
+// decryptSecrets replaces the encrypted secret settings with their plaintext, so operators do not
+// have to keep plaintext secrets in the environment or .env files of the DeployKnot hosts
+func (c *Config) decryptSecrets() error {
+	var identities []age.Identity
+	for name, value := range c.secretValues() {
+		var plaintext string
+		var err error
+		switch {
+		case strings.HasPrefix(*value, ageValuePrefix):
+			if identities == nil {
+				if identities, err = loadAgeIdentities(os.Getenv("AGE_IDENTITY_FILE")); err != nil {
+					return fmt.Errorf("failed to decrypt %s: %w", name, err)
+				}
+			}
+			plaintext, err = decryptAgeValue(strings.TrimPrefix(*value, ageValuePrefix), identities)
+		case strings.HasPrefix(*value, awsKMSValuePrefix):
+			plaintext, err = decryptAWSKMSValue(strings.TrimPrefix(*value, awsKMSValuePrefix))
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+		*value = plaintext
+	}
+	return nil
+}
+
+// loadAgeIdentities reads the age identities encrypted values are decrypted with
+func loadAgeIdentities(path string) ([]age.Identity, error) {
+	if path == "" {
+		return nil, fmt.Errorf("AGE_IDENTITY_FILE is required for age encrypted values")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open AGE_IDENTITY_FILE: %w", err)
+	}
+	defer file.Close()
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AGE_IDENTITY_FILE: %w", err)
+	}
+	return identities, nil
+}
+
+// decryptAgeValue decrypts an age encrypted value, ASCII armored or base64 encoded. A trailing
+// newline, as left by encrypting the output of echo, is not part of the value.
+func decryptAgeValue(payload string, identities []age.Identity) (string, error) {
+	payload = strings.TrimSpace(payload)
+	var ciphertext io.Reader
+	if strings.HasPrefix(payload, armor.Header) {
+		ciphertext = armor.NewReader(strings.NewReader(payload))
+	} else {
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", fmt.Errorf("value is neither ASCII armored nor base64 encoded: %w", err)
+		}
+		ciphertext = bytes.NewReader(data)
+	}
+
+	reader, err := age.Decrypt(ciphertext, identities...)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(plaintext), "\n"), nil
+}
+
+// decryptAWSKMSValue decrypts the base64 encoded CiphertextBlob of an AWS KMS encryption with
+// "aws kms decrypt". The ciphertext names its key, so no key needs to be configured.
+func decryptAWSKMSValue(payload string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return "", fmt.Errorf("value is not base64 encoded: %w", err)
+	}
+	file, err := os.CreateTemp("", "deployknot-kms-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(blob)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kmsDecryptTimeout)
+	defer cancel()
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, "aws", "kms", "decrypt", "--ciphertext-blob", "fileb://"+file.Name(), "--query", "Plaintext", "--output", "text")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("aws kms decrypt failed: %v, output: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode aws kms decrypt output: %w", err)
+	}
+	return string(plaintext), nil
+}
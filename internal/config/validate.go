@@ -0,0 +1,597 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+)
+
+// Default secrets shipped with the application; running with them is reported as a warning
+const (
+	defaultJWTSecret     = "changeme-super-secret"
+	defaultEncryptionKey = "changeme-encryption-key"
+)
+
+// minSecretLength is the minimum length accepted for secrets
+const minSecretLength = 16
+
+// channelNamePattern matches notification channel and incident service names such as "ops" or
+// "pager-primary"
+var channelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Validate checks the configuration for missing or invalid values
+func (c *Config) Validate() error {
+	var errs []error
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("SERVER_PORT must be a port number between 1 and 65535, got %q", c.Server.Port))
+	}
+	errs = append(errs, validateDuration("SERVER_READ_TIMEOUT", c.Server.ReadTimeout, time.Second, time.Hour))
+	errs = append(errs, validateDuration("SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout, time.Second, time.Hour))
+	errs = append(errs, validateDuration("SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout, time.Second, 24*time.Hour))
+
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.Host == "" {
+			errs = append(errs, fmt.Errorf("DB_HOST is required"))
+		}
+		if c.Database.User == "" {
+			errs = append(errs, fmt.Errorf("DB_USER is required"))
+		}
+		if c.Database.DBName == "" {
+			errs = append(errs, fmt.Errorf("DB_NAME is required"))
+		}
+	case "sqlite":
+		if c.Database.SQLitePath == "" {
+			errs = append(errs, fmt.Errorf("SQLITE_PATH is required when DB_DRIVER is sqlite"))
+		}
+		// Other servers could not open the file, so there is nothing to elect a leader among
+		if c.Leader.Enabled {
+			errs = append(errs, fmt.Errorf("LEADER_ELECTION_ENABLED cannot be used with DB_DRIVER sqlite"))
+		}
+		if c.Database.ReplicaURL != "" {
+			errs = append(errs, fmt.Errorf("DB_REPLICA_URL cannot be used with DB_DRIVER sqlite"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("DB_DRIVER must be postgres or sqlite, got %q", c.Database.Driver))
+	}
+	if !c.Redis.Embedded && c.Redis.Host == "" {
+		errs = append(errs, fmt.Errorf("REDIS_HOST is required"))
+	}
+	if c.Redis.Embedded && c.Leader.Enabled {
+		errs = append(errs, fmt.Errorf("LEADER_ELECTION_ENABLED cannot be used with REDIS_EMBEDDED"))
+	}
+	if c.Redis.DB < 0 || c.Redis.DB > 15 {
+		errs = append(errs, fmt.Errorf("REDIS_DB must be between 0 and 15, got %d", c.Redis.DB))
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL must be one of debug, info, warn, error, got %q", c.Logging.Level))
+	}
+
+	if len(c.JWT.Secret) < minSecretLength {
+		errs = append(errs, fmt.Errorf("JWT_SECRET must be at least %d characters", minSecretLength))
+	}
+	if c.JWT.KeyID == "" {
+		errs = append(errs, fmt.Errorf("JWT_KEY_ID must not be empty"))
+	}
+	if c.JWT.PreviousSecret != "" {
+		if len(c.JWT.PreviousSecret) < minSecretLength {
+			errs = append(errs, fmt.Errorf("JWT_PREVIOUS_SECRET must be at least %d characters", minSecretLength))
+		}
+		if c.JWT.PreviousKeyID == c.JWT.KeyID {
+			errs = append(errs, fmt.Errorf("JWT_PREVIOUS_KEY_ID must differ from JWT_KEY_ID"))
+		}
+	}
+	if len(c.EncryptionKey) < minSecretLength {
+		errs = append(errs, fmt.Errorf("ENCRYPTION_KEY must be at least %d characters", minSecretLength))
+	}
+
+	switch c.Worker.DockerBackend {
+	case DockerBackendShell, DockerBackendAPI:
+	default:
+		errs = append(errs, fmt.Errorf("WORKER_DOCKER_BACKEND must be %q or %q, got %q", DockerBackendShell, DockerBackendAPI, c.Worker.DockerBackend))
+	}
+	errs = append(errs, validateDuration("WORKER_HEARTBEAT_INTERVAL", c.Worker.HeartbeatInterval, time.Second, 5*time.Minute))
+	errs = append(errs, validateDuration("WORKER_HEALTHY_TIMEOUT", c.Worker.HealthyTimeout, 10*time.Second, time.Hour))
+	errs = append(errs, validateDuration("WORKER_DEPENDENCY_TIMEOUT", c.Worker.DependencyTimeout, time.Second, time.Hour))
+	if c.Worker.TargetLogs && (c.Worker.TargetLogLines < 1 || c.Worker.TargetLogLines > 5000) {
+		errs = append(errs, fmt.Errorf("WORKER_TARGET_LOG_LINES must be between 1 and 5000, got %d", c.Worker.TargetLogLines))
+	}
+	if c.Worker.MaxConcurrentJobs < 1 || c.Worker.MaxConcurrentJobs > 64 {
+		errs = append(errs, fmt.Errorf("WORKER_MAX_CONCURRENT_JOBS must be between 1 and 64, got %d", c.Worker.MaxConcurrentJobs))
+	}
+	errs = append(errs, validateCIDRs("WORKER_NETWORKS", c.Worker.Networks)...)
+	if c.Worker.SSHRetryAttempts < 1 || c.Worker.SSHRetryAttempts > 10 {
+		errs = append(errs, fmt.Errorf("WORKER_SSH_RETRY_ATTEMPTS must be between 1 and 10, got %d", c.Worker.SSHRetryAttempts))
+	}
+	errs = append(errs, validateDuration("WORKER_SSH_RETRY_BACKOFF", c.Worker.SSHRetryBackoff, 10*time.Millisecond, time.Minute))
+	errs = append(errs, validateDuration("WORKER_SSH_RETRY_MAX_BACKOFF", c.Worker.SSHRetryMaxBackoff, c.Worker.SSHRetryBackoff, 5*time.Minute))
+	errs = append(errs, validateDuration("WORKER_SSH_COMMAND_TIMEOUT", c.Worker.SSHCommandTimeout, time.Minute, 24*time.Hour))
+	if !models.SecretScanPolicy(c.Worker.SecretScan).IsValid() {
+		errs = append(errs, fmt.Errorf("WORKER_SECRET_SCAN must be %q, %q or %q, got %q", models.SecretScanOff, models.SecretScanWarn, models.SecretScanFail, c.Worker.SecretScan))
+	}
+	errs = append(errs, validateDuration("DEPLOYMENT_CACHE_TTL", c.Cache.DeploymentTTL, 0, time.Hour))
+	errs = append(errs, validateDuration("HEALTH_WORKER_STALE_AFTER", c.Health.WorkerStaleAfter, time.Second, time.Hour))
+	errs = append(errs, validateDuration("HEALTH_MAX_PENDING_AGE", c.Health.MaxPendingAge, time.Second, 24*time.Hour))
+	errs = append(errs, validateDuration("WATCHDOG_INTERVAL", c.Watchdog.Interval, time.Second, time.Hour))
+	errs = append(errs, validateDuration("DEPLOYMENT_MAX_DURATION", c.Watchdog.MaxDuration, time.Minute, 7*24*time.Hour))
+	if c.Watchdog.MaxRequeues < 0 {
+		errs = append(errs, fmt.Errorf("WATCHDOG_MAX_REQUEUES must not be negative"))
+	}
+	errs = append(errs, validateDuration("OUTBOX_PUBLISH_INTERVAL", c.Outbox.PublishInterval, 100*time.Millisecond, 10*time.Minute))
+	errs = append(errs, validateDuration("OUTBOX_RETENTION", c.Outbox.Retention, time.Minute, 365*24*time.Hour))
+	if c.Outbox.BatchSize < 1 || c.Outbox.BatchSize > 10000 {
+		errs = append(errs, fmt.Errorf("OUTBOX_BATCH_SIZE must be between 1 and 10000, got %d", c.Outbox.BatchSize))
+	}
+	errs = append(errs, validateDuration("QUEUE_JOB_TTL", c.Queue.JobTTL, time.Hour, 30*24*time.Hour))
+	switch c.Queue.Backend {
+	case QueueBackendRedis:
+	case QueueBackendMemory:
+		// Every server would hold a queue of its own
+		if c.Leader.Enabled {
+			errs = append(errs, fmt.Errorf("LEADER_ELECTION_ENABLED cannot be used with QUEUE_BACKEND memory"))
+		}
+	case QueueBackendNATS:
+		if c.Queue.NATSURL == "" {
+			errs = append(errs, fmt.Errorf("NATS_URL is required when QUEUE_BACKEND is nats"))
+		}
+		if c.Queue.NATSStream == "" || strings.ContainsAny(c.Queue.NATSStream, ". *>/\\") {
+			errs = append(errs, fmt.Errorf("NATS_STREAM must be a stream name without dots, spaces, wildcards or slashes, got %q", c.Queue.NATSStream))
+		}
+		if c.Queue.NATSReplicas < 1 || c.Queue.NATSReplicas > 5 {
+			errs = append(errs, fmt.Errorf("NATS_REPLICAS must be between 1 and 5, got %d", c.Queue.NATSReplicas))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("QUEUE_BACKEND must be redis, memory or nats, got %q", c.Queue.Backend))
+	}
+	if c.WorkerAPI.Enabled {
+		if port, err := strconv.Atoi(c.WorkerAPI.Port); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("WORKER_API_PORT must be a port number between 1 and 65535, got %q", c.WorkerAPI.Port))
+		} else if c.WorkerAPI.Port == c.Server.Port {
+			errs = append(errs, fmt.Errorf("WORKER_API_PORT must differ from SERVER_PORT"))
+		}
+	}
+	errs = append(errs, validateDuration("SCHEDULER_INTERVAL", c.Scheduler.Interval, time.Second, time.Hour))
+	if c.Leader.Enabled {
+		errs = append(errs, validateDuration("LEADER_LEASE_TTL", c.Leader.LeaseTTL, 3*time.Second, 5*time.Minute))
+		errs = append(errs, validateDuration("LEADER_RENEW_INTERVAL", c.Leader.RenewInterval, time.Second, time.Minute))
+		if c.Leader.RenewInterval*2 > c.Leader.LeaseTTL {
+			errs = append(errs, fmt.Errorf("LEADER_RENEW_INTERVAL must be at most half of LEADER_LEASE_TTL"))
+		}
+	}
+	errs = append(errs, validateDuration("GATE_CHECK_INTERVAL", c.Gates.Interval, time.Second, time.Hour))
+	errs = append(errs, validateDuration("APPLICATION_RELEASE_INTERVAL", c.Applications.Interval, time.Second, time.Hour))
+	errs = append(errs, validateDuration("APPLICATION_RELEASE_TIMEOUT", c.Applications.ReleaseTimeout, time.Minute, 7*24*time.Hour))
+	errs = append(errs, c.Notifications.validate()...)
+	errs = append(errs, c.Incidents.validate()...)
+	errs = append(errs, c.GitHub.validate()...)
+	if c.Changelog.Enabled {
+		errs = append(errs, validateDuration("CHANGELOG_TIMEOUT", c.Changelog.Timeout, time.Second, time.Minute))
+	}
+	errs = append(errs, c.LogSinks.validate()...)
+	templates := c.Commands.Templates()
+	for _, step := range models.CommandTemplateSteps() {
+		text, ok := templates[step]
+		if !ok {
+			continue
+		}
+		if _, err := models.ParseCommandTemplate(step, text); err != nil {
+			errs = append(errs, fmt.Errorf("COMMAND_TEMPLATE_%s: %w", strings.ToUpper(step), err))
+		}
+	}
+	if c.Health.WorkerStaleAfter <= c.Worker.HeartbeatInterval {
+		errs = append(errs, fmt.Errorf("HEALTH_WORKER_STALE_AFTER must be longer than WORKER_HEARTBEAT_INTERVAL"))
+	}
+
+	if u, err := url.Parse(c.Preflight.GitHubAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("GITHUB_API_URL must be an http(s) URL, got %q", c.Preflight.GitHubAPIURL))
+	}
+	errs = append(errs, validateDuration("PREFLIGHT_TIMEOUT", c.Preflight.Timeout, time.Second, 5*time.Minute))
+
+	if c.Files.Enabled {
+		if c.Files.MaxFileSize < 1 {
+			errs = append(errs, fmt.Errorf("FILES_MAX_FILE_SIZE must be positive"))
+		}
+		if c.Files.MaxEntries < 1 || c.Files.MaxEntries > 100000 {
+			errs = append(errs, fmt.Errorf("FILES_MAX_ENTRIES must be between 1 and 100000, got %d", c.Files.MaxEntries))
+		}
+		errs = append(errs, validateDuration("FILES_CONNECT_TIMEOUT", c.Files.ConnectTimeout, time.Second, 5*time.Minute))
+	}
+	if c.Exec.Enabled {
+		errs = append(errs, validateDuration("EXEC_MAX_DURATION", c.Exec.MaxDuration, time.Minute, 24*time.Hour))
+		errs = append(errs, validateDuration("EXEC_IDLE_TIMEOUT", c.Exec.IdleTimeout, 10*time.Second, 24*time.Hour))
+		errs = append(errs, validateDuration("EXEC_CONNECT_TIMEOUT", c.Exec.ConnectTimeout, time.Second, 5*time.Minute))
+		if c.Exec.MaxTranscriptSize < 0 {
+			errs = append(errs, fmt.Errorf("EXEC_MAX_TRANSCRIPT_SIZE must not be negative"))
+		}
+	}
+	if c.StatusPage.Enabled {
+		if c.StatusPage.HistoryDays < 1 || c.StatusPage.HistoryDays > 366 {
+			errs = append(errs, fmt.Errorf("STATUS_PAGE_HISTORY_DAYS must be between 1 and 366, got %d", c.StatusPage.HistoryDays))
+		}
+		errs = append(errs, validateDuration("STATUS_PAGE_CACHE_MAX_AGE", c.StatusPage.CacheMaxAge, 0, time.Hour))
+	}
+	errs = append(errs, validateDuration("BADGE_CACHE_MAX_AGE", c.Badges.CacheMaxAge, 0, time.Hour))
+
+	if c.SCIM.Token != "" && len(c.SCIM.Token) < minSecretLength {
+		errs = append(errs, fmt.Errorf("SCIM_TOKEN must be at least %d characters", minSecretLength))
+	}
+	if c.Slack.Enabled() {
+		errs = append(errs, validateDuration("SLACK_LINK_CODE_TTL", c.Slack.LinkCodeTTL, time.Minute, 24*time.Hour))
+	}
+	if c.OAuth.Enabled() {
+		errs = append(errs, c.OAuth.validate()...)
+	}
+	errs = append(errs, validateDuration("ONE_TIME_CREDENTIALS_TTL", c.Credentials.OneTimeTTL, time.Minute, 24*time.Hour))
+	errs = append(errs, validateDuration("SSH_CERT_TTL", c.Credentials.SSHCertTTL, time.Minute, time.Hour))
+	errs = append(errs, validateCIDRs("API_ALLOWED_CIDRS", c.Access.AllowedCIDRs)...)
+	if !c.Access.TrustsNoProxies() {
+		errs = append(errs, validateCIDRs("TRUSTED_PROXIES", c.Access.TrustedProxies)...)
+	}
+
+	if c.Autoscale.MetricsToken != "" && len(c.Autoscale.MetricsToken) < minSecretLength {
+		errs = append(errs, fmt.Errorf("METRICS_TOKEN must be at least %d characters", minSecretLength))
+	}
+	if c.Autoscale.JobsPerWorker < 1 {
+		errs = append(errs, fmt.Errorf("AUTOSCALE_JOBS_PER_WORKER must be at least 1, got %d", c.Autoscale.JobsPerWorker))
+	}
+	if c.Autoscale.MinWorkers < 0 {
+		errs = append(errs, fmt.Errorf("AUTOSCALE_MIN_WORKERS must not be negative"))
+	}
+	if c.Autoscale.MaxWorkers < 1 || c.Autoscale.MaxWorkers < c.Autoscale.MinWorkers {
+		errs = append(errs, fmt.Errorf("AUTOSCALE_MAX_WORKERS must be at least 1 and no less than AUTOSCALE_MIN_WORKERS, got %d", c.Autoscale.MaxWorkers))
+	}
+	if c.Autoscale.AdvisoriesEnabled {
+		errs = append(errs, validateDuration("AUTOSCALE_INTERVAL", c.Autoscale.Interval, time.Second, time.Hour))
+		errs = append(errs, validateDuration("AUTOSCALE_COOLDOWN", c.Autoscale.Cooldown, 0, 24*time.Hour))
+		if c.Autoscale.WebhookURL != "" && !isAbsoluteURL(c.Autoscale.WebhookURL) {
+			errs = append(errs, fmt.Errorf("AUTOSCALE_WEBHOOK_URL must be an absolute http(s) URL, got %q", c.Autoscale.WebhookURL))
+		}
+	}
+
+	if c.Artifacts.BuildLogs && c.Artifacts.MaxSize < 1 {
+		errs = append(errs, fmt.Errorf("ARTIFACT_MAX_SIZE must be at least 1 byte"))
+	}
+	errs = append(errs, validateDuration("ARTIFACT_RETENTION", c.Artifacts.Retention, 0, 10*365*24*time.Hour))
+	errs = append(errs, c.VolumeBackups.validate()...)
+	if c.CronJobs.CollectEnabled {
+		errs = append(errs, validateDuration("CRON_JOB_COLLECT_INTERVAL", c.CronJobs.Interval, 10*time.Second, time.Hour))
+		errs = append(errs, validateDuration("CRON_JOB_CONNECT_TIMEOUT", c.CronJobs.ConnectTimeout, time.Second, 5*time.Minute))
+		if c.CronJobs.OutputLimit < 1024 || c.CronJobs.OutputLimit > 10<<20 {
+			errs = append(errs, fmt.Errorf("CRON_JOB_OUTPUT_LIMIT must be between 1KB and 10MB, got %d bytes", c.CronJobs.OutputLimit))
+		}
+	}
+	if c.SSHTargets.LimitsEnabled {
+		if c.SSHTargets.MaxConnections < 1 || c.SSHTargets.MaxConnections > 1000 {
+			errs = append(errs, fmt.Errorf("SSH_TARGET_MAX_CONNECTIONS must be between 1 and 1000, got %d", c.SSHTargets.MaxConnections))
+		}
+		if c.SSHTargets.SessionRate < 1 || c.SSHTargets.SessionRate > 1000 {
+			errs = append(errs, fmt.Errorf("SSH_TARGET_SESSION_RATE must be between 1 and 1000, got %d", c.SSHTargets.SessionRate))
+		}
+		errs = append(errs, validateDuration("SSH_TARGET_WAIT_TIMEOUT", c.SSHTargets.WaitTimeout, time.Second, time.Hour))
+	}
+
+	if c.TLS.CertFile != "" && c.TLS.UsesAutocert() {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS cannot be used together"))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if c.TLS.UsesAutocert() && c.TLS.AutocertCacheDir == "" {
+		errs = append(errs, fmt.Errorf("TLS_AUTOCERT_CACHE_DIR is required when TLS_AUTOCERT_DOMAINS is set"))
+	}
+	if c.TLS.RedirectHTTP && !c.TLS.Enabled() {
+		errs = append(errs, fmt.Errorf("TLS_REDIRECT_HTTP requires TLS to be configured"))
+	}
+	if c.TLS.RedirectHTTP || c.TLS.UsesAutocert() {
+		if port, err := strconv.Atoi(c.TLS.HTTPPort); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("TLS_HTTP_PORT must be a port number between 1 and 65535, got %q", c.TLS.HTTPPort))
+		} else if c.TLS.HTTPPort == c.Server.Port {
+			errs = append(errs, fmt.Errorf("TLS_HTTP_PORT must differ from SERVER_PORT"))
+		}
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				errs = append(errs, fmt.Errorf("CORS_ALLOW_CREDENTIALS cannot be used with CORS_ALLOWED_ORIGINS=*"))
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS entries must be origins such as https://app.example.com, got %q", origin))
+		}
+	}
+	if c.Uploads.MaxBodySize <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_REQUEST_BODY_SIZE must be positive"))
+	}
+	if c.Uploads.MaxMultipartMemory <= 0 {
+		errs = append(errs, fmt.Errorf("MAX_MULTIPART_MEMORY must be positive"))
+	}
+	if c.Uploads.MaxEnvFileSize <= 0 || c.Uploads.MaxEnvFileSize > c.Uploads.MaxBodySize {
+		errs = append(errs, fmt.Errorf("MAX_ENV_FILE_SIZE must be positive and no larger than MAX_REQUEST_BODY_SIZE"))
+	}
+	if c.Headers.HSTSMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("HSTS_MAX_AGE must not be negative"))
+	}
+	switch c.Headers.FrameOptions {
+	case "DENY", "SAMEORIGIN", "":
+	default:
+		errs = append(errs, fmt.Errorf("FRAME_OPTIONS must be DENY, SAMEORIGIN or empty, got %q", c.Headers.FrameOptions))
+	}
+
+	if c.Quotas.MaxActiveDeployments < 0 {
+		errs = append(errs, fmt.Errorf("QUOTA_MAX_ACTIVE_DEPLOYMENTS must not be negative"))
+	}
+	if c.Quotas.MaxDeploymentsPerDay < 0 {
+		errs = append(errs, fmt.Errorf("QUOTA_MAX_DEPLOYMENTS_PER_DAY must not be negative"))
+	}
+
+	if c.Startup.ConnectRetries < 1 {
+		errs = append(errs, fmt.Errorf("STARTUP_CONNECT_RETRIES must be at least 1, got %d", c.Startup.ConnectRetries))
+	}
+	errs = append(errs, validateDuration("STARTUP_CONNECT_BACKOFF", c.Startup.ConnectBackoff, 10*time.Millisecond, time.Minute))
+
+	return errors.Join(errs...)
+}
+
+// Warnings returns configuration issues that do not prevent startup but should be fixed
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.JWT.Secret == defaultJWTSecret {
+		warnings = append(warnings, "JWT_SECRET is set to the default value")
+	}
+	if c.EncryptionKey == defaultEncryptionKey {
+		warnings = append(warnings, "ENCRYPTION_KEY is set to the default value")
+	}
+	if !c.Database.UsesSQLite() && c.Database.SSLMode == "disable" {
+		warnings = append(warnings, "DB_SSLMODE is disable; database traffic is not encrypted")
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			warnings = append(warnings, "CORS_ALLOWED_ORIGINS allows every origin")
+		}
+	}
+	if c.Queue.Backend == QueueBackendMemory && !c.Server.WithWorker && !c.WorkerAPI.Enabled {
+		warnings = append(warnings, "QUEUE_BACKEND is memory but neither SERVER_WITH_WORKER nor WORKER_API_ENABLED is set; no worker can reach the queue to run deployments")
+	}
+	if c.Redis.Embedded && !c.Server.WithWorker && !c.WorkerAPI.Enabled {
+		warnings = append(warnings, "REDIS_EMBEDDED is true but neither SERVER_WITH_WORKER nor WORKER_API_ENABLED is set; no worker can reach the embedded Redis to run deployments")
+	}
+	if !c.Preflight.Enabled {
+		warnings = append(warnings, "PREFLIGHT_ENABLED is false; bad credentials are only detected by the worker")
+	}
+	if len(c.Access.AllowedCIDRs) > 0 && len(c.Access.TrustedProxies) == 0 {
+		warnings = append(warnings, "API_ALLOWED_CIDRS is set but TRUSTED_PROXIES is not; behind a proxy every request comes from the proxy's IP")
+	}
+	if c.GitHub.Enabled && c.GitHub.PublicURL == "" {
+		warnings = append(warnings, "GITHUB_DEPLOYMENTS_PUBLIC_URL is not set; GitHub deployment statuses will not link back to DeployKnot")
+	}
+	return warnings
+}
+
+// validateDuration checks a duration setting lies within [min, max]
+func validateDuration(name string, value, min, max time.Duration) error {
+	if value < min || value > max {
+		return fmt.Errorf("%s must be between %s and %s, got %s", name, min, max, value)
+	}
+	return nil
+}
+
+// validateCIDRs checks every entry of a list setting is an IP address or CIDR block
+func validateCIDRs(name string, entries []string) []error {
+	var errs []error
+	for _, entry := range entries {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err == nil {
+				continue
+			}
+		} else if net.ParseIP(entry) != nil {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s entries must be IP addresses or CIDR blocks such as 10.0.0.0/8, got %q", name, entry))
+	}
+	return errs
+}
+
+// validate checks the OAuth settings of the enabled providers
+func (o OAuthConfig) validate() []error {
+	var errs []error
+	if !isAbsoluteURL(o.RedirectBaseURL) {
+		errs = append(errs, fmt.Errorf("OAUTH_REDIRECT_BASE_URL must be the public URL of the server, such as https://deploy.example.com, got %q", o.RedirectBaseURL))
+	}
+	if o.SuccessRedirectURL != "" && !isAbsoluteURL(o.SuccessRedirectURL) {
+		errs = append(errs, fmt.Errorf("OAUTH_SUCCESS_REDIRECT_URL must be an absolute http(s) URL, got %q", o.SuccessRedirectURL))
+	}
+	errs = append(errs, validateDuration("OAUTH_STATE_TTL", o.StateTTL, time.Minute, time.Hour))
+	errs = append(errs, validateDuration("OAUTH_HTTP_TIMEOUT", o.HTTPTimeout, time.Second, time.Minute))
+
+	if o.GitHubClientID != "" && o.GitHubClientSecret == "" {
+		errs = append(errs, fmt.Errorf("OAUTH_GITHUB_CLIENT_SECRET is required when OAUTH_GITHUB_CLIENT_ID is set"))
+	}
+	if o.GoogleClientID != "" && o.GoogleClientSecret == "" {
+		errs = append(errs, fmt.Errorf("OAUTH_GOOGLE_CLIENT_SECRET is required when OAUTH_GOOGLE_CLIENT_ID is set"))
+	}
+	if o.OIDCClientID != "" {
+		if !isAbsoluteURL(o.OIDCIssuerURL) {
+			errs = append(errs, fmt.Errorf("OIDC_ISSUER_URL must be an absolute http(s) URL when OIDC_CLIENT_ID is set, got %q", o.OIDCIssuerURL))
+		}
+		if o.OIDCClientSecret == "" {
+			errs = append(errs, fmt.Errorf("OIDC_CLIENT_SECRET is required when OIDC_CLIENT_ID is set"))
+		}
+	}
+	return errs
+}
+
+// isAbsoluteURL reports whether value is an absolute http or https URL
+func isAbsoluteURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validate checks that every notification channel has a unique name and an absolute webhook URL
+func (c NotificationConfig) validate() []error {
+	var errs []error
+	names := make(map[string]bool)
+	for _, channel := range c.Channels {
+		name, webhook, ok := strings.Cut(channel, "=")
+		name, webhook = strings.TrimSpace(name), strings.TrimSpace(webhook)
+		switch {
+		case !ok || name == "":
+			errs = append(errs, fmt.Errorf("NOTIFICATION_CHANNELS entries must be name=url"))
+			continue
+		case !channelNamePattern.MatchString(name):
+			errs = append(errs, fmt.Errorf("NOTIFICATION_CHANNELS channel name %q must start with a lowercase letter or digit and contain only lowercase letters, digits, '_' and '-'", name))
+		case names[name]:
+			errs = append(errs, fmt.Errorf("NOTIFICATION_CHANNELS names channel %q twice", name))
+		case !isAbsoluteURL(webhook):
+			errs = append(errs, fmt.Errorf("NOTIFICATION_CHANNELS URL of channel %q must be an absolute http(s) URL", name))
+		}
+		names[name] = true
+	}
+	if len(c.Channels) > 0 {
+		errs = append(errs, validateDuration("NOTIFICATION_INTERVAL", c.Interval, time.Second, time.Hour))
+		errs = append(errs, validateDuration("NOTIFICATION_TIMEOUT", c.Timeout, time.Second, 5*time.Minute))
+	}
+	return errs
+}
+
+// validate checks that every incident service has a unique name, a known provider and a key
+func (c IncidentConfig) validate() []error {
+	var errs []error
+	names := make(map[string]bool)
+	for _, entry := range c.Services {
+		name, service, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		provider, key, _ := strings.Cut(service, ":")
+		switch {
+		case !ok || name == "":
+			errs = append(errs, fmt.Errorf("INCIDENT_SERVICES entries must be name=provider:key"))
+			continue
+		case !channelNamePattern.MatchString(name):
+			errs = append(errs, fmt.Errorf("INCIDENT_SERVICES service name %q must start with a lowercase letter or digit and contain only lowercase letters, digits, '_' and '-'", name))
+		case names[name]:
+			errs = append(errs, fmt.Errorf("INCIDENT_SERVICES names service %q twice", name))
+		case strings.TrimSpace(provider) != IncidentProviderPagerDuty && strings.TrimSpace(provider) != IncidentProviderOpsgenie:
+			errs = append(errs, fmt.Errorf("INCIDENT_SERVICES provider of service %q must be %q or %q", name, IncidentProviderPagerDuty, IncidentProviderOpsgenie))
+		case strings.TrimSpace(key) == "":
+			errs = append(errs, fmt.Errorf("INCIDENT_SERVICES service %q needs a key", name))
+		}
+		names[name] = true
+	}
+	if len(c.Services) > 0 {
+		if !isAbsoluteURL(c.PagerDutyEventsURL) {
+			errs = append(errs, fmt.Errorf("PAGERDUTY_EVENTS_URL must be an absolute http(s) URL"))
+		}
+		if !isAbsoluteURL(c.OpsgenieAPIURL) {
+			errs = append(errs, fmt.Errorf("OPSGENIE_API_URL must be an absolute http(s) URL"))
+		}
+		errs = append(errs, validateDuration("INCIDENT_CHECK_INTERVAL", c.Interval, time.Second, time.Hour))
+		errs = append(errs, validateDuration("INCIDENT_TIMEOUT", c.Timeout, time.Second, 5*time.Minute))
+	}
+	return errs
+}
+
+// validate checks the GitHub API URL, the public URL and the intervals of enabled GitHub deployments
+func (c GitHubDeploymentsConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if !isAbsoluteURL(c.APIURL) {
+		errs = append(errs, fmt.Errorf("GITHUB_API_URL must be an absolute http(s) URL"))
+	}
+	if c.PublicURL != "" && !isAbsoluteURL(c.PublicURL) {
+		errs = append(errs, fmt.Errorf("GITHUB_DEPLOYMENTS_PUBLIC_URL must be the public URL of the server, such as https://deploy.example.com, got %q", c.PublicURL))
+	}
+	errs = append(errs, validateDuration("GITHUB_DEPLOYMENTS_INTERVAL", c.Interval, time.Second, time.Hour))
+	errs = append(errs, validateDuration("GITHUB_DEPLOYMENTS_TIMEOUT", c.Timeout, time.Second, 5*time.Minute))
+	return errs
+}
+
+// logGroupPattern matches CloudWatch Logs log group names
+var logGroupPattern = regexp.MustCompile(`^[A-Za-z0-9_./#-]{1,512}$`)
+
+// validate checks that every log sink has a unique name, a known kind and a target of that kind
+func (c LogSinkConfig) validate() []error {
+	var errs []error
+	names := make(map[string]bool)
+	cloudWatch := false
+	for _, entry := range c.Sinks {
+		name, sink, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		kind, target, _ := strings.Cut(sink, ":")
+		kind, target = strings.TrimSpace(kind), strings.TrimSpace(target)
+		switch {
+		case !ok || name == "":
+			errs = append(errs, fmt.Errorf("LOG_SINKS entries must be name=kind:target"))
+			continue
+		case !channelNamePattern.MatchString(name):
+			errs = append(errs, fmt.Errorf("LOG_SINKS sink name %q must start with a lowercase letter or digit and contain only lowercase letters, digits, '_' and '-'", name))
+		case names[name]:
+			errs = append(errs, fmt.Errorf("LOG_SINKS names sink %q twice", name))
+		}
+		names[name] = true
+
+		switch kind {
+		case LogSinkLoki, LogSinkElasticsearch:
+			if !isAbsoluteURL(target) {
+				errs = append(errs, fmt.Errorf("LOG_SINKS %s sink %q needs an absolute http(s) URL", kind, name))
+			}
+		case LogSinkCloudWatch:
+			cloudWatch = true
+			region, group, _ := strings.Cut(target, ":")
+			if region == "" || !logGroupPattern.MatchString(group) {
+				errs = append(errs, fmt.Errorf("LOG_SINKS cloudwatch sink %q needs a region:log-group target", name))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("LOG_SINKS kind of sink %q must be %q, %q or %q", name, LogSinkLoki, LogSinkElasticsearch, LogSinkCloudWatch))
+		}
+	}
+	if len(c.Sinks) > 0 {
+		errs = append(errs, validateDuration("LOG_SINK_INTERVAL", c.Interval, 100*time.Millisecond, time.Minute))
+		errs = append(errs, validateDuration("LOG_SINK_TIMEOUT", c.Timeout, time.Second, 5*time.Minute))
+		errs = append(errs, validateDuration("LOG_SINK_MAX_BACKOFF", c.MaxBackoff, c.Interval, 24*time.Hour))
+		if c.BatchSize < 1 || c.BatchSize > 1000 {
+			errs = append(errs, fmt.Errorf("LOG_SINK_BATCH_SIZE must be between 1 and 1000, got %d", c.BatchSize))
+		}
+	}
+	if cloudWatch && (c.AWSAccessKeyID == "" || c.AWSSecretAccessKey == "") {
+		errs = append(errs, fmt.Errorf("cloudwatch log sinks need AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"))
+	}
+	return errs
+}
+
+// validate checks the storage and timing of volume backups when a bucket is configured
+func (c VolumeBackupConfig) validate() []error {
+	if !c.Enabled() {
+		return nil
+	}
+	var errs []error
+	if !isAbsoluteURL(c.Endpoint) {
+		errs = append(errs, fmt.Errorf("VOLUME_BACKUP_S3_ENDPOINT must be an absolute http(s) URL, got %q", c.Endpoint))
+	}
+	if strings.Contains(c.Bucket, "/") {
+		errs = append(errs, fmt.Errorf("VOLUME_BACKUP_S3_BUCKET must be a bucket name, got %q", c.Bucket))
+	}
+	if c.Region == "" {
+		errs = append(errs, fmt.Errorf("VOLUME_BACKUP_S3_REGION is required when VOLUME_BACKUP_S3_BUCKET is set"))
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		errs = append(errs, fmt.Errorf("VOLUME_BACKUP_S3_BUCKET needs VOLUME_BACKUP_S3_ACCESS_KEY_ID and VOLUME_BACKUP_S3_SECRET_ACCESS_KEY"))
+	}
+	errs = append(errs, validateDuration("VOLUME_BACKUP_INTERVAL", c.Interval, time.Second, time.Hour))
+	errs = append(errs, validateDuration("VOLUME_BACKUP_TIMEOUT", c.Timeout, time.Minute, 24*time.Hour))
+	errs = append(errs, validateDuration("VOLUME_BACKUP_CONNECT_TIMEOUT", c.ConnectTimeout, time.Second, 5*time.Minute))
+	return errs
+}
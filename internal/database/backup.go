@@ -0,0 +1,390 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/lib/pq"
+)
+
+// backupSchema is the schema whose tables a backup holds
+const backupSchema = "deploy_knot"
+
+// foreignKey is a single column foreign key between two tables of the schema
+type foreignKey struct {
+	table      string
+	column     string
+	references string
+	notNull    bool
+}
+
+// BackupPlan describes the tables of the schema for a backup: their restore order and the
+// columns whose values are only restored after every row is inserted
+type BackupPlan struct {
+	// Tables are ordered so every table comes after the tables its NOT NULL foreign keys reference
+	Tables []string
+	// deferred are the nullable foreign key columns of each table. Rows are inserted with them
+	// NULL and updated once every table is restored, which resolves references in both directions,
+	// such as between deployments and their schedules.
+	deferred map[string][]string
+	// primaryKeys are the primary key columns of each table, which deferred columns are updated by
+	primaryKeys map[string][]string
+	// serials are the columns of each table whose default is a sequence
+	serials map[string][]string
+}
+
+// SchemaVersion returns the version of the last migration applied and whether it failed halfway;
+// the version is 0 for a database no migration ran on yet
+func (r *Repository) SchemaVersion() (uint, bool, error) {
+	var migrated bool
+	if err := r.db.QueryRow(`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&migrated); err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if !migrated {
+		return 0, false, nil
+	}
+
+	var version int64
+	var dirty bool
+	err := r.db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint(version), dirty, nil
+}
+
+// GetBackupPlan inspects the schema for a backup or restore
+func (r *Repository) GetBackupPlan() (*BackupPlan, error) {
+	plan := &BackupPlan{
+		deferred:    map[string][]string{},
+		primaryKeys: map[string][]string{},
+		serials:     map[string][]string{},
+	}
+
+	rows, err := r.db.Query(`
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = $1 AND table_type = 'BASE TABLE' AND table_name <> 'schema_migrations'
+		ORDER BY table_name
+	`, backupSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	rows, err = r.db.Query(`
+		SELECT cl.relname, a.attname, ref.relname, a.attnotnull
+		FROM pg_constraint con
+		JOIN pg_class cl ON cl.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_class ref ON ref.oid = con.confrelid
+		JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = ANY(con.conkey)
+		WHERE con.contype = 'f' AND n.nspname = $1
+		ORDER BY cl.relname, a.attname
+	`, backupSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	var keys []foreignKey
+	for rows.Next() {
+		var key foreignKey
+		if err := rows.Scan(&key.table, &key.column, &key.references, &key.notNull); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+
+	rows, err = r.db.Query(`
+		SELECT cl.relname, a.attname
+		FROM pg_index i
+		JOIN pg_class cl ON cl.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indisprimary AND n.nspname = $1
+		ORDER BY cl.relname, a.attnum
+	`, backupSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan primary key: %w", err)
+		}
+		plan.primaryKeys[table] = append(plan.primaryKeys[table], column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+
+	rows, err = r.db.Query(`
+		SELECT table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND column_default LIKE 'nextval(%'
+		ORDER BY table_name, column_name
+	`, backupSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan sequence: %w", err)
+		}
+		plan.serials[table] = append(plan.serials[table], column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+
+	// Order the tables by their NOT NULL foreign keys; nullable ones are deferred
+	dependencies := map[string][]string{}
+	for _, key := range keys {
+		if !key.notNull {
+			plan.deferred[key.table] = append(plan.deferred[key.table], key.column)
+			continue
+		}
+		if key.references != key.table {
+			dependencies[key.table] = append(dependencies[key.table], key.references)
+		}
+	}
+	for table, columns := range plan.deferred {
+		if len(plan.primaryKeys[table]) == 0 {
+			return nil, fmt.Errorf("table %s has nullable foreign keys %s but no primary key", table, strings.Join(columns, ", "))
+		}
+	}
+	ordered := map[string]bool{}
+	visiting := map[string]bool{}
+	var visit func(table string) error
+	visit = func(table string) error {
+		if ordered[table] {
+			return nil
+		}
+		if visiting[table] {
+			return fmt.Errorf("tables reference each other through NOT NULL foreign keys at %s", table)
+		}
+		visiting[table] = true
+		dependsOn := dependencies[table]
+		sort.Strings(dependsOn)
+		for _, dependency := range dependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		ordered[table] = true
+		plan.Tables = append(plan.Tables, table)
+		return nil
+	}
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// BackupSnapshot reads the tables of a backup from one consistent snapshot of the database
+type BackupSnapshot struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// BeginBackupSnapshot starts a read-only snapshot for a backup; Close must be called when done
+func (r *Repository) BeginBackupSnapshot(ctx context.Context) (*BackupSnapshot, error) {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return nil, fmt.Errorf("backups cannot be taken from a repository scoped to an organization")
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &BackupSnapshot{ctx: ctx, tx: tx}, nil
+}
+
+// ExportTable calls fn with every row of a table as a JSON object, keyed by column name
+func (s *BackupSnapshot) ExportTable(table string, fn func(row json.RawMessage) error) error {
+	rows, err := s.tx.QueryContext(s.ctx, `SELECT row_to_json(t) FROM `+qualifiedTable(table)+` t`)
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return fmt.Errorf("failed to export %s: %w", table, err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export %s: %w", table, err)
+	}
+	return nil
+}
+
+// Close ends the snapshot
+func (s *BackupSnapshot) Close() {
+	s.tx.Rollback()
+}
+
+// deferredRow is a row whose deferred foreign key columns are set after every table is restored
+type deferredRow struct {
+	table string
+	row   json.RawMessage
+}
+
+// BackupRestore restores the rows of a backup in one transaction, in the order of the plan
+type BackupRestore struct {
+	ctx      context.Context
+	tx       *sql.Tx
+	plan     *BackupPlan
+	deferred []deferredRow
+}
+
+// BeginBackupRestore starts restoring a backup into the database, which must hold no rows yet
+func (r *Repository) BeginBackupRestore(ctx context.Context, plan *BackupPlan) (*BackupRestore, error) {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return nil, fmt.Errorf("backups cannot be restored into a repository scoped to an organization")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for _, table := range plan.Tables {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+qualifiedTable(table)+`)`).Scan(&exists); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to check %s: %w", table, err)
+		}
+		if exists {
+			tx.Rollback()
+			return nil, fmt.Errorf("table %s is not empty; backups are only restored into a new database", table)
+		}
+	}
+	return &BackupRestore{ctx: ctx, tx: tx, plan: plan}, nil
+}
+
+// InsertRow inserts a row of a table as exported by ExportTable from the same schema version
+func (b *BackupRestore) InsertRow(table string, row json.RawMessage) error {
+	insert := row
+	if columns := b.plan.deferred[table]; len(columns) > 0 {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(row, &values); err != nil {
+			return fmt.Errorf("invalid row of %s: %w", table, err)
+		}
+		deferred := false
+		for _, column := range columns {
+			if value, ok := values[column]; ok && string(value) != "null" {
+				values[column] = json.RawMessage("null")
+				deferred = true
+			}
+		}
+		if deferred {
+			b.deferred = append(b.deferred, deferredRow{table: table, row: row})
+			var err error
+			if insert, err = json.Marshal(values); err != nil {
+				return fmt.Errorf("invalid row of %s: %w", table, err)
+			}
+		}
+	}
+
+	_, err := b.tx.ExecContext(b.ctx, `INSERT INTO `+qualifiedTable(table)+` SELECT * FROM json_populate_record(NULL::`+qualifiedTable(table)+`, $1)`, string(insert))
+	if err != nil {
+		return fmt.Errorf("failed to restore a row of %s: %w", table, err)
+	}
+	return nil
+}
+
+// Commit sets the deferred foreign keys, moves the sequences past the restored values and commits
+// the restore
+func (b *BackupRestore) Commit() error {
+	for _, row := range b.deferred {
+		table := qualifiedTable(row.table)
+		var set, match []string
+		for _, column := range b.plan.deferred[row.table] {
+			set = append(set, fmt.Sprintf("%s = r.%s", pq.QuoteIdentifier(column), pq.QuoteIdentifier(column)))
+		}
+		for _, column := range b.plan.primaryKeys[row.table] {
+			match = append(match, fmt.Sprintf("t.%s = r.%s", pq.QuoteIdentifier(column), pq.QuoteIdentifier(column)))
+		}
+		_, err := b.tx.ExecContext(b.ctx, `UPDATE `+table+` t SET `+strings.Join(set, ", ")+`
+			FROM json_populate_record(NULL::`+table+`, $1) r
+			WHERE `+strings.Join(match, " AND "), string(row.row))
+		if err != nil {
+			return fmt.Errorf("failed to restore the references of %s: %w", row.table, err)
+		}
+	}
+
+	for _, table := range b.plan.Tables {
+		for _, column := range b.plan.serials[table] {
+			quoted := pq.QuoteIdentifier(column)
+			_, err := b.tx.ExecContext(b.ctx, `SELECT setval(pg_get_serial_sequence($1, $2), COALESCE(MAX(`+quoted+`), 1), MAX(`+quoted+`) IS NOT NULL) FROM `+qualifiedTable(table),
+				backupSchema+"."+table, column)
+			if err != nil {
+				return fmt.Errorf("failed to reset the sequence of %s.%s: %w", table, column, err)
+			}
+		}
+	}
+
+	if err := b.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Rollback abandons the restore; it does nothing after Commit
+func (b *BackupRestore) Rollback() {
+	b.tx.Rollback()
+}
+
+// qualifiedTable returns the quoted name of a table of the schema
+func qualifiedTable(table string) string {
+	return pq.QuoteIdentifier(backupSchema) + "." + pq.QuoteIdentifier(table)
+}
+
+// MigrateTo migrates the database to exactly the given version, up or down
+func (d *Database) MigrateTo(migrationsPath string, version uint) error {
+	m, err := d.migrator(migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Migrate(version); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("failed to migrate to version %d: %w", version, err)
+	}
+	return nil
+}
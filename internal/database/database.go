@@ -3,9 +3,13 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
@@ -13,20 +17,28 @@ import (
 
 // Database represents the database connection
 type Database struct {
-	DB         *sql.DB
+	DB *sql.DB
+	// Replica is the connection to the read replica, if one is configured
+	Replica    *sql.DB
 	Repository *Repository
 	logger     *logrus.Logger
 }
 
-// New creates a new database connection
+// New creates a new database connection. A URL of the form sqlite:<path> opens the SQLite database
+// file at path, which is created when it does not exist.
 func New(databaseURL string, logger *logrus.Logger) (*Database, error) {
-	db, err := sql.Open("postgres", databaseURL)
+	driverName, dataSource := "postgres", databaseURL
+	if path, ok := strings.CutPrefix(databaseURL, sqliteURLPrefix); ok {
+		driverName, dataSource = sqliteDriverName, sqliteDataSource(path)
+	}
+	db, err := sql.Open(driverName, dataSource)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
@@ -41,8 +53,33 @@ func New(databaseURL string, logger *logrus.Logger) (*Database, error) {
 	}, nil
 }
 
-// Close closes the database connection
+// ConnectReplica connects to a PostgreSQL read replica of the database and routes the repository's
+// replica reads to it
+func (d *Database) ConnectReplica(replicaURL string) error {
+	if d.Repository.sqlite {
+		return fmt.Errorf("read replicas are not supported with SQLite")
+	}
+	replica, err := sql.Open("postgres", replicaURL)
+	if err != nil {
+		return fmt.Errorf("failed to open read replica: %w", err)
+	}
+	if err := replica.Ping(); err != nil {
+		replica.Close()
+		return fmt.Errorf("failed to ping read replica: %w", err)
+	}
+
+	d.logger.Info("Read replica connection established")
+
+	d.Replica = replica
+	d.Repository.replica = &Repository{db: replica, logger: d.logger}
+	return nil
+}
+
+// Close closes the database connections
 func (d *Database) Close() error {
+	if d.Replica != nil {
+		d.Replica.Close()
+	}
 	if d.DB != nil {
 		return d.DB.Close()
 	}
@@ -51,16 +88,9 @@ func (d *Database) Close() error {
 
 // RunMigrations runs database migrations
 func (d *Database) RunMigrations(migrationsPath string) error {
-	driver, err := postgres.WithInstance(d.DB, &postgres.Config{})
-	if err != nil {
-		return fmt.Errorf("failed to create migration driver: %w", err)
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", migrationsPath),
-		"postgres", driver)
+	m, err := d.migrator(migrationsPath)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return err
 	}
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
@@ -71,6 +101,32 @@ func (d *Database) RunMigrations(migrationsPath string) error {
 	return nil
 }
 
+// migrator creates a migrate instance for the migrations in migrationsPath. SQLite databases run
+// the migrations in its sqlite subdirectory instead.
+func (d *Database) migrator(migrationsPath string) (*migrate.Migrate, error) {
+	var driver migratedb.Driver
+	var err error
+	databaseName := "postgres"
+	if d.Repository.IsSQLite() {
+		databaseName = "sqlite"
+		migrationsPath = filepath.Join(migrationsPath, "sqlite")
+		driver, err = migratesqlite.WithInstance(d.DB, &migratesqlite.Config{})
+	} else {
+		driver, err = postgres.WithInstance(d.DB, &postgres.Config{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(
+		fmt.Sprintf("file://%s", migrationsPath),
+		databaseName, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return m, nil
+}
+
 // HealthCheck performs a health check on the database
 func (d *Database) HealthCheck() error {
 	return d.DB.Ping()
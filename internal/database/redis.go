@@ -5,20 +5,39 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
+// embeddedRedisURL starts a Redis server in memory inside the process instead of connecting to one
+const embeddedRedisURL = "memory:"
+
 // Redis represents the Redis connection
 type Redis struct {
 	Client *redis.Client
+	// server is the embedded Redis server, if the connection is to one
+	server *miniredis.Miniredis
 	logger *logrus.Logger
 }
 
-// NewRedis creates a new Redis connection
+// NewRedis creates a new Redis connection. A "memory:" URL starts an embedded Redis server that
+// keeps its data in memory until the process stops, for single-node installs.
 func NewRedis(redisURL string, logger *logrus.Logger) (*Redis, error) {
+	var server *miniredis.Miniredis
+	if redisURL == embeddedRedisURL {
+		server = miniredis.NewMiniRedis()
+		if err := server.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start embedded Redis: %w", err)
+		}
+		redisURL = "redis://" + server.Addr()
+	}
+
 	opts, err := redis.ParseURL(redisURL)
 	if err != nil {
+		if server != nil {
+			server.Close()
+		}
 		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
 	}
 
@@ -29,23 +48,36 @@ func NewRedis(redisURL string, logger *logrus.Logger) (*Redis, error) {
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		if server != nil {
+			server.Close()
+		}
 		return nil, fmt.Errorf("failed to ping Redis: %w", err)
 	}
 
-	logger.Info("Redis connection established")
+	if server != nil {
+		logger.WithField("addr", server.Addr()).Info("Embedded Redis started")
+	} else {
+		logger.Info("Redis connection established")
+	}
 
 	return &Redis{
 		Client: client,
+		server: server,
 		logger: logger,
 	}, nil
 }
 
 // Close closes the Redis connection
 func (r *Redis) Close() error {
+	var err error
 	if r.Client != nil {
-		return r.Client.Close()
+		err = r.Client.Close()
+	}
+	if r.server != nil {
+		r.server.Close()
 	}
-	return nil
+	return err
 }
 
 // HealthCheck performs a health check on Redis
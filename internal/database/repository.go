@@ -3,39 +3,131 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"deployknot/internal/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrDeploymentNotFound is returned when a deployment does not exist
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
+// queryHandle is implemented by dbHandle and by *sql.Tx
+type queryHandle interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// dbHandle is implemented by *sql.DB and by organization-scoped connections
+type dbHandle interface {
+	queryHandle
+	Begin() (*sql.Tx, error)
+}
+
 // Repository handles database operations
 type Repository struct {
-	db     *sql.DB
-	logger *logrus.Logger
+	db dbHandle
+	// replica reads from the read replica, when one is connected
+	replica *Repository
+	sqlite  bool
+	logger  *logrus.Logger
 }
 
 // NewRepository creates a new repository instance
 func NewRepository(db *sql.DB, logger *logrus.Logger) *Repository {
+	_, sqlite := db.Driver().(*sqliteDriver)
 	return &Repository{
 		db:     db,
+		sqlite: sqlite,
 		logger: logger,
 	}
 }
 
+// IsSQLite reports whether the repository stores its data in a SQLite database rather than in
+// PostgreSQL. SQLite databases have no row-level security and are not backed up by DeployKnot.
+func (r *Repository) IsSQLite() bool {
+	return r.sqlite
+}
+
+// Replica returns a repository reading from the read replica, or r itself when none is connected.
+// Its reads lag behind the primary's writes, so it only serves listings and statistics shown to
+// users, never reads a write is based on, and it must not write.
+func (r *Repository) Replica() *Repository {
+	if r.replica == nil {
+		return r
+	}
+	return r.replica
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 // CreateDeployment creates a new deployment record
 func (r *Repository) CreateDeployment(deployment *models.Deployment) error {
+	return r.createDeployment(r.db, deployment)
+}
+
+// CreateDeploymentWithJob records a deployment, its initial steps, the gates it waits for and the
+// outbox entry of its job in a single transaction, so either all of them are stored or none are
+func (r *Repository) CreateDeploymentWithJob(deployment *models.Deployment, steps []*models.DeploymentStep, gates []*models.DeploymentGate, entry *models.OutboxEntry) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := r.createDeployment(tx, deployment); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err := createDeploymentStep(tx, step); err != nil {
+			return fmt.Errorf("failed to create step %s: %w", step.StepName, err)
+		}
+	}
+	for _, gate := range gates {
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.deployment_gates (deployment_id, name, status, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, gate.DeploymentID, gate.Name, gate.Status, gate.ExpiresAt, gate.CreatedAt); err != nil {
+			return fmt.Errorf("failed to create gate %s: %w", gate.Name, err)
+		}
+	}
+	if err := createOutboxEntry(tx, entry); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// createDeployment inserts a deployment record using ex
+func (r *Repository) createDeployment(ex execer, deployment *models.Deployment) error {
 	query := `
 		INSERT INTO deploy_knot.deployments (
 			id, created_at, updated_at, status, target_ip, ssh_username, 
 			ssh_password_encrypted, github_repo_url, github_pat_encrypted, 
 			github_branch, additional_vars, port, container_name, created_by, 
-			project_name, deployment_name, user_id
+			project_name, deployment_name, user_id, deployment_type, script_path,
+			script_content, target_type, kubeconfig_encrypted, kubernetes_namespace,
+			image, manifests_path, organization_id, repo_subdirectory, git_lfs,
+			concurrency_group, one_time_credentials, worker_pool, gpus, extra_run_args,
+			schedule_id, commit_sha, application_release_id, application_service, managed_services,
+			cron_schedule
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+			$18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33,
+			$34, $35, $36, $37, $38, $39
 		)
 	`
 
@@ -84,6 +176,28 @@ func (r *Repository) CreateDeployment(deployment *models.Deployment) error {
 		deployment.ProjectName,
 		deployment.DeploymentName,
 		deployment.UserID,
+		deploymentTypeOrDefault(deployment.DeploymentType),
+		deployment.ScriptPath,
+		deployment.ScriptContent,
+		targetTypeOrDefault(deployment.TargetType),
+		deployment.KubeconfigEncrypted,
+		deployment.KubernetesNamespace,
+		deployment.Image,
+		deployment.ManifestsPath,
+		deployment.OrganizationID,
+		deployment.RepoSubdirectory,
+		deployment.GitLFS,
+		deployment.ConcurrencyGroup,
+		deployment.OneTimeCredentials,
+		deployment.WorkerPool,
+		deployment.GPUs,
+		deployment.ExtraRunArgs,
+		deployment.ScheduleID,
+		deployment.CommitSHA,
+		deployment.ApplicationReleaseID,
+		deployment.ApplicationService,
+		deployment.ManagedServices,
+		deployment.CronSchedule,
 	}
 
 	r.logger.WithField("param_count", len(params)).Debug("Exec parameters prepared")
@@ -96,7 +210,7 @@ func (r *Repository) CreateDeployment(deployment *models.Deployment) error {
 		}).Debug("Parameter details")
 	}
 
-	_, err := r.db.Exec(query, params...)
+	_, err := ex.Exec(query, params...)
 
 	if err != nil {
 		return fmt.Errorf("failed to create deployment: %w", err)
@@ -105,13 +219,44 @@ func (r *Repository) CreateDeployment(deployment *models.Deployment) error {
 	return nil
 }
 
+// deploymentTypeOrDefault returns the deployment type, falling back to docker
+func deploymentTypeOrDefault(deploymentType models.DeploymentType) models.DeploymentType {
+	if deploymentType == "" {
+		return models.DeploymentTypeDocker
+	}
+	return deploymentType
+}
+
+// roleOrDefault returns the user role, falling back to user
+func roleOrDefault(role models.Role) models.Role {
+	if role == "" {
+		return models.RoleUser
+	}
+	return role
+}
+
+// targetTypeOrDefault returns the target type, falling back to ssh
+func targetTypeOrDefault(targetType models.TargetType) models.TargetType {
+	if targetType == "" {
+		return models.TargetTypeSSH
+	}
+	return targetType
+}
+
 // GetDeployment retrieves a deployment by ID
 func (r *Repository) GetDeployment(id uuid.UUID) (*models.Deployment, error) {
 	query := `
 		SELECT id, created_at, updated_at, status, target_ip, ssh_username,
 		       ssh_password_encrypted, github_repo_url, github_pat_encrypted,
 		       github_branch, additional_vars, port, container_name, started_at, 
-		       completed_at, error_message, created_by, project_name, deployment_name
+		       completed_at, error_message, created_by, project_name, deployment_name,
+		       deployment_type, script_path, script_content, target_type,
+		       kubeconfig_encrypted, kubernetes_namespace, image, manifests_path,
+		       repo_subdirectory, git_lfs, concurrency_group, organization_id, user_id,
+		       superseded_by, one_time_credentials, worker_pool, gpus, extra_run_args, schedule_id, commit_sha,
+		       failure_category, application_release_id, application_service, managed_services,
+		       cron_schedule, cron_removed_at,
+		       (SELECT COUNT(*) FROM deploy_knot.deployment_comments c WHERE c.deployment_id = deployments.id)
 		FROM deploy_knot.deployments
 		WHERE id = $1
 	`
@@ -139,11 +284,38 @@ func (r *Repository) GetDeployment(id uuid.UUID) (*models.Deployment, error) {
 		&deployment.CreatedBy,
 		&deployment.ProjectName,
 		&deployment.DeploymentName,
+		&deployment.DeploymentType,
+		&deployment.ScriptPath,
+		&deployment.ScriptContent,
+		&deployment.TargetType,
+		&deployment.KubeconfigEncrypted,
+		&deployment.KubernetesNamespace,
+		&deployment.Image,
+		&deployment.ManifestsPath,
+		&deployment.RepoSubdirectory,
+		&deployment.GitLFS,
+		&deployment.ConcurrencyGroup,
+		&deployment.OrganizationID,
+		&deployment.UserID,
+		&deployment.SupersededBy,
+		&deployment.OneTimeCredentials,
+		&deployment.WorkerPool,
+		&deployment.GPUs,
+		&deployment.ExtraRunArgs,
+		&deployment.ScheduleID,
+		&deployment.CommitSHA,
+		&deployment.FailureCategory,
+		&deployment.ApplicationReleaseID,
+		&deployment.ApplicationService,
+		&deployment.ManagedServices,
+		&deployment.CronSchedule,
+		&deployment.CronRemovedAt,
+		&deployment.CommentCount,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("deployment not found")
+			return nil, ErrDeploymentNotFound
 		}
 		return nil, fmt.Errorf("failed to get deployment: %w", err)
 	}
@@ -158,22 +330,64 @@ func (r *Repository) GetDeployment(id uuid.UUID) (*models.Deployment, error) {
 	return deployment, nil
 }
 
-// UpdateDeploymentStatus updates the deployment status
+// UpdateDeploymentStatus updates the deployment status; cancelled deployments keep their status.
+// Failed deployments are classified by the error of their failed step.
 func (r *Repository) UpdateDeploymentStatus(id uuid.UUID, status models.DeploymentStatus, errorMessage *string) error {
+	// Record when the deployment started running and when it reached a final status
 	query := `
 		UPDATE deploy_knot.deployments
-		SET status = $2, updated_at = $3, error_message = $4
-		WHERE id = $1
+		SET status = $2, updated_at = $3, error_message = $4, failure_category = NULL,
+		    started_at = CASE WHEN $2 = 'running' THEN COALESCE(started_at, $3) ELSE started_at END,
+		    completed_at = CASE WHEN $2 IN ('completed', 'failed', 'cancelled', 'aborted') THEN $3 ELSE completed_at END
+		WHERE id = $1 AND status <> 'cancelled'
 	`
 
-	_, err := r.db.Exec(query, id, status, time.Now(), errorMessage)
+	result, err := r.db.Exec(query, id, status, time.Now(), errorMessage)
 	if err != nil {
 		return fmt.Errorf("failed to update deployment status: %w", err)
 	}
 
+	if status == models.DeploymentStatusFailed {
+		if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+			r.classifyDeploymentFailure(id)
+		}
+	}
+
 	return nil
 }
 
+// classifyDeploymentFailure stores the failure category of a failed deployment, classified from
+// the step that failed first: the first one to have started, as unfinished steps are failed along
+// with the deployment. The failure is already recorded, so errors are only logged.
+func (r *Repository) classifyDeploymentFailure(id uuid.UUID) {
+	var stepName, stepError, deploymentError sql.NullString
+	err := r.db.QueryRow(`
+		SELECT s.step_name, s.error_message, d.error_message
+		FROM deploy_knot.deployments d
+		LEFT JOIN LATERAL (
+			SELECT step_name, error_message
+			FROM deploy_knot.deployment_steps
+			WHERE deployment_id = d.id AND status = 'failed'
+			ORDER BY started_at IS NULL, completed_at, step_order
+			LIMIT 1
+		) s ON TRUE
+		WHERE d.id = $1
+	`, id).Scan(&stepName, &stepError, &deploymentError)
+	if err != nil {
+		r.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to get deployment failure")
+		return
+	}
+
+	category := models.ClassifyFailure(stepName.String, stepError.String, deploymentError.String)
+	if _, err := r.db.Exec(`
+		UPDATE deploy_knot.deployments
+		SET failure_category = $2
+		WHERE id = $1 AND status = 'failed'
+	`, id, category); err != nil {
+		r.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to classify deployment failure")
+	}
+}
+
 // UpdateDeploymentTiming updates deployment timing fields
 func (r *Repository) UpdateDeploymentTiming(id uuid.UUID, startedAt, completedAt *time.Time) error {
 	query := `
@@ -190,12 +404,38 @@ func (r *Repository) UpdateDeploymentTiming(id uuid.UUID, startedAt, completedAt
 	return nil
 }
 
+const deploymentLogColumns = `id, seq, deployment_id, created_at, log_level, message, task_name, step_order, category, event_code, params`
+
+// scanDeploymentLog scans a row selected with deploymentLogColumns
+func scanDeploymentLog(row interface{ Scan(...interface{}) error }) (*models.DeploymentLog, error) {
+	log := &models.DeploymentLog{}
+	var paramsJSON []byte
+	if err := row.Scan(&log.ID, &log.Seq, &log.DeploymentID, &log.CreatedAt, &log.LogLevel, &log.Message,
+		&log.TaskName, &log.StepOrder, &log.Category, &log.EventCode, &paramsJSON); err != nil {
+		return nil, fmt.Errorf("failed to scan deployment log: %w", err)
+	}
+	if len(paramsJSON) > 0 {
+		if err := json.Unmarshal(paramsJSON, &log.Params); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal deployment log params: %w", err)
+		}
+	}
+	return log, nil
+}
+
 // CreateDeploymentLog creates a new deployment log entry
 func (r *Repository) CreateDeploymentLog(log *models.DeploymentLog) error {
+	var paramsJSON []byte
+	if len(log.Params) > 0 {
+		var err error
+		if paramsJSON, err = json.Marshal(log.Params); err != nil {
+			return fmt.Errorf("failed to marshal deployment log params: %w", err)
+		}
+	}
+
 	query := `
 		INSERT INTO deploy_knot.deployment_logs (
-			id, deployment_id, created_at, log_level, message, task_name, step_order
-		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			id, deployment_id, created_at, log_level, message, task_name, step_order, category, event_code, params
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	_, err := r.db.Exec(query,
@@ -206,6 +446,9 @@ func (r *Repository) CreateDeploymentLog(log *models.DeploymentLog) error {
 		log.Message,
 		log.TaskName,
 		log.StepOrder,
+		log.Category,
+		log.EventCode,
+		paramsJSON,
 	)
 
 	if err != nil {
@@ -215,17 +458,31 @@ func (r *Repository) CreateDeploymentLog(log *models.DeploymentLog) error {
 	return nil
 }
 
-// GetDeploymentLogs retrieves logs for a deployment
-func (r *Repository) GetDeploymentLogs(deploymentID uuid.UUID, limit int) ([]*models.DeploymentLog, error) {
+// GetDeploymentLogs retrieves the logs for a deployment selected by filter with a sequence greater
+// than afterSeq
+func (r *Repository) GetDeploymentLogs(deploymentID uuid.UUID, afterSeq int64, limit int, filter models.DeploymentLogFilter) ([]*models.DeploymentLog, error) {
+	categories := make([]string, len(filter.Categories))
+	for i, category := range filter.Categories {
+		categories[i] = string(category)
+	}
+	levels := make([]string, len(filter.Levels))
+	for i, level := range filter.Levels {
+		levels[i] = string(level)
+	}
+	taskNames := append([]string{}, filter.TaskNames...)
+
 	query := `
-		SELECT id, deployment_id, created_at, log_level, message, task_name, step_order
+		SELECT ` + deploymentLogColumns + `
 		FROM deploy_knot.deployment_logs
-		WHERE deployment_id = $1
-		ORDER BY created_at ASC
-		LIMIT $2
+		WHERE deployment_id = $1 AND seq > $2
+		  AND (cardinality($4::text[]) = 0 OR category = ANY($4))
+		  AND (cardinality($5::text[]) = 0 OR log_level = ANY($5))
+		  AND (cardinality($6::text[]) = 0 OR task_name = ANY($6))
+		ORDER BY seq ASC
+		LIMIT $3
 	`
 
-	rows, err := r.db.Query(query, deploymentID, limit)
+	rows, err := r.db.Query(query, deploymentID, afterSeq, limit, pq.Array(categories), pq.Array(levels), pq.Array(taskNames))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment logs: %w", err)
 	}
@@ -233,18 +490,9 @@ func (r *Repository) GetDeploymentLogs(deploymentID uuid.UUID, limit int) ([]*mo
 
 	var logs []*models.DeploymentLog
 	for rows.Next() {
-		log := &models.DeploymentLog{}
-		err := rows.Scan(
-			&log.ID,
-			&log.DeploymentID,
-			&log.CreatedAt,
-			&log.LogLevel,
-			&log.Message,
-			&log.TaskName,
-			&log.StepOrder,
-		)
+		log, err := scanDeploymentLog(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan deployment log: %w", err)
+			return nil, err
 		}
 		logs = append(logs, log)
 	}
@@ -252,16 +500,49 @@ func (r *Repository) GetDeploymentLogs(deploymentID uuid.UUID, limit int) ([]*mo
 	return logs, nil
 }
 
+// GetDeploymentLogPage retrieves up to pageSize logs selected by filter following afterSeq and
+// reports whether more remain
+func (r *Repository) GetDeploymentLogPage(deploymentID uuid.UUID, afterSeq int64, pageSize int, filter models.DeploymentLogFilter) (*models.DeploymentLogPage, error) {
+	// Fetch one extra row to learn whether another page exists
+	logs, err := r.GetDeploymentLogs(deploymentID, afterSeq, pageSize+1, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.DeploymentLogPage{
+		Logs:         logs,
+		AfterSeq:     afterSeq,
+		NextAfterSeq: afterSeq,
+	}
+	if len(logs) > pageSize {
+		page.Logs = logs[:pageSize]
+		page.HasMore = true
+	}
+	if page.Logs == nil {
+		page.Logs = []*models.DeploymentLog{}
+	}
+	if len(page.Logs) > 0 {
+		page.NextAfterSeq = page.Logs[len(page.Logs)-1].Seq
+	}
+
+	return page, nil
+}
+
 // CreateDeploymentStep creates a new deployment step
 func (r *Repository) CreateDeploymentStep(step *models.DeploymentStep) error {
+	return createDeploymentStep(r.db, step)
+}
+
+// createDeploymentStep inserts a deployment step using ex
+func createDeploymentStep(ex execer, step *models.DeploymentStep) error {
 	query := `
 		INSERT INTO deploy_knot.deployment_steps (
 			id, deployment_id, step_name, status, started_at, completed_at,
-			duration_ms, error_message, step_order
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			duration_ms, error_message, step_order, depends_on
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
-	_, err := r.db.Exec(query,
+	_, err := ex.Exec(query,
 		step.ID,
 		step.DeploymentID,
 		step.StepName,
@@ -271,6 +552,7 @@ func (r *Repository) CreateDeploymentStep(step *models.DeploymentStep) error {
 		step.DurationMs,
 		step.ErrorMessage,
 		step.StepOrder,
+		pq.Array(toInt64s(step.DependsOn)),
 	)
 
 	if err != nil {
@@ -280,6 +562,15 @@ func (r *Repository) CreateDeploymentStep(step *models.DeploymentStep) error {
 	return nil
 }
 
+// toInt64s converts step orders for storage in an INTEGER[] column
+func toInt64s(values []int) []int64 {
+	result := make([]int64, len(values))
+	for i, value := range values {
+		result[i] = int64(value)
+	}
+	return result
+}
+
 // UpdateDeploymentStep updates a deployment step
 func (r *Repository) UpdateDeploymentStep(step *models.DeploymentStep) error {
 	query := `
@@ -305,11 +596,30 @@ func (r *Repository) UpdateDeploymentStep(step *models.DeploymentStep) error {
 	return nil
 }
 
+// MergeDeploymentStepOutput adds fields to the output of a deployment's step, replacing fields of
+// the same name
+func (r *Repository) MergeDeploymentStepOutput(deploymentID uuid.UUID, stepOrder int, output map[string]interface{}) error {
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment step output: %w", err)
+	}
+
+	_, err = r.db.Exec(`
+		UPDATE deploy_knot.deployment_steps
+		SET output = COALESCE(output, '{}'::jsonb) || $3::jsonb
+		WHERE deployment_id = $1 AND step_order = $2
+	`, deploymentID, stepOrder, string(outputJSON))
+	if err != nil {
+		return fmt.Errorf("failed to update deployment step output: %w", err)
+	}
+	return nil
+}
+
 // GetDeploymentSteps retrieves steps for a deployment
 func (r *Repository) GetDeploymentSteps(deploymentID uuid.UUID) ([]*models.DeploymentStep, error) {
 	query := `
 		SELECT id, deployment_id, step_name, status, started_at, completed_at,
-		       duration_ms, error_message, step_order
+		       duration_ms, error_message, step_order, output, depends_on
 		FROM deploy_knot.deployment_steps
 		WHERE deployment_id = $1
 		ORDER BY step_order ASC
@@ -324,6 +634,8 @@ func (r *Repository) GetDeploymentSteps(deploymentID uuid.UUID) ([]*models.Deplo
 	var steps []*models.DeploymentStep
 	for rows.Next() {
 		step := &models.DeploymentStep{}
+		var outputJSON []byte
+		var dependsOn pq.Int64Array
 		err := rows.Scan(
 			&step.ID,
 			&step.DeploymentID,
@@ -334,10 +646,21 @@ func (r *Repository) GetDeploymentSteps(deploymentID uuid.UUID) ([]*models.Deplo
 			&step.DurationMs,
 			&step.ErrorMessage,
 			&step.StepOrder,
+			&outputJSON,
+			&dependsOn,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan deployment step: %w", err)
 		}
+		step.DependsOn = make([]int, len(dependsOn))
+		for i, order := range dependsOn {
+			step.DependsOn[i] = int(order)
+		}
+		if outputJSON != nil {
+			if err := json.Unmarshal(outputJSON, &step.Output); err != nil {
+				r.logger.WithError(err).Warn("Failed to parse deployment step output JSON")
+			}
+		}
 		steps = append(steps, step)
 	}
 
@@ -348,8 +671,8 @@ func (r *Repository) GetDeploymentSteps(deploymentID uuid.UUID) ([]*models.Deplo
 func (r *Repository) CreateUser(user *models.User) error {
 	query := `
 		INSERT INTO deploy_knot.users (
-			id, username, email, password_hash, is_active, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			id, username, email, password_hash, role, is_active, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 
 	_, err := r.db.Exec(query,
@@ -357,6 +680,7 @@ func (r *Repository) CreateUser(user *models.User) error {
 		user.Username,
 		user.Email,
 		user.PasswordHash,
+		roleOrDefault(user.Role),
 		user.IsActive,
 		user.CreatedAt,
 		user.UpdatedAt,
@@ -372,7 +696,7 @@ func (r *Repository) CreateUser(user *models.User) error {
 // GetUserByID retrieves a user by ID
 func (r *Repository) GetUserByID(id uuid.UUID) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, is_active, created_at, updated_at
+		SELECT id, username, email, password_hash, role, is_active, created_at, updated_at
 		FROM deploy_knot.users
 		WHERE id = $1
 	`
@@ -383,6 +707,7 @@ func (r *Repository) GetUserByID(id uuid.UUID) (*models.User, error) {
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
 		&user.IsActive,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -401,7 +726,7 @@ func (r *Repository) GetUserByID(id uuid.UUID) (*models.User, error) {
 // GetUserByUsername retrieves a user by username
 func (r *Repository) GetUserByUsername(username string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, is_active, created_at, updated_at
+		SELECT id, username, email, password_hash, role, is_active, created_at, updated_at
 		FROM deploy_knot.users
 		WHERE username = $1
 	`
@@ -412,6 +737,7 @@ func (r *Repository) GetUserByUsername(username string) (*models.User, error) {
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
 		&user.IsActive,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -430,7 +756,7 @@ func (r *Repository) GetUserByUsername(username string) (*models.User, error) {
 // GetUserByEmail retrieves a user by email
 func (r *Repository) GetUserByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, is_active, created_at, updated_at
+		SELECT id, username, email, password_hash, role, is_active, created_at, updated_at
 		FROM deploy_knot.users
 		WHERE email = $1
 	`
@@ -441,6 +767,7 @@ func (r *Repository) GetUserByEmail(email string) (*models.User, error) {
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
 		&user.IsActive,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -459,10 +786,7 @@ func (r *Repository) GetUserByEmail(email string) (*models.User, error) {
 // GetDeploymentsByUserID retrieves deployments for a specific user
 func (r *Repository) GetDeploymentsByUserID(userID uuid.UUID, limit, offset int) ([]*models.Deployment, error) {
 	query := `
-		SELECT id, created_at, updated_at, status, target_ip, ssh_username,
-		       ssh_password_encrypted, github_repo_url, github_pat_encrypted,
-		       github_branch, additional_vars, port, container_name, started_at, 
-		       completed_at, error_message, created_by, project_name, deployment_name, user_id
+		SELECT ` + deploymentListColumns + `
 		FROM deploy_knot.deployments
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -475,51 +799,4960 @@ func (r *Repository) GetDeploymentsByUserID(userID uuid.UUID, limit, offset int)
 	}
 	defer rows.Close()
 
+	return r.scanDeployments(rows)
+}
+
+// deploymentListColumns are the columns scanned by scanDeployments, in order
+const deploymentListColumns = `id, created_at, updated_at, status, target_ip, ssh_username,
+		       ssh_password_encrypted, github_repo_url, github_pat_encrypted,
+		       github_branch, additional_vars, port, container_name, started_at,
+		       completed_at, error_message, created_by, project_name, deployment_name, user_id,
+		       deployment_type, script_path, script_content, target_type,
+		       kubeconfig_encrypted, kubernetes_namespace, image, manifests_path,
+		       repo_subdirectory, git_lfs, concurrency_group, organization_id, superseded_by,
+		       one_time_credentials, worker_pool, gpus, extra_run_args, schedule_id, commit_sha,
+		       failure_category, application_release_id, application_service, managed_services,
+		       cron_schedule, cron_removed_at,
+		       (SELECT COUNT(*) FROM deploy_knot.deployment_comments c WHERE c.deployment_id = deployments.id)`
+
+// scanDeployments scans rows selected with deploymentListColumns
+func (r *Repository) scanDeployments(rows *sql.Rows) ([]*models.Deployment, error) {
 	var deployments []*models.Deployment
 	for rows.Next() {
-		deployment := &models.Deployment{}
-		var additionalVarsJSON []byte
+		deployment, err := r.scanDeployment(rows)
+		if err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, deployment)
+	}
 
-		err := rows.Scan(
-			&deployment.ID,
-			&deployment.CreatedAt,
-			&deployment.UpdatedAt,
-			&deployment.Status,
-			&deployment.TargetIP,
-			&deployment.SSHUsername,
-			&deployment.SSHPasswordEncrypted,
-			&deployment.GitHubRepoURL,
-			&deployment.GitHubPATEncrypted,
-			&deployment.GitHubBranch,
-			&additionalVarsJSON,
-			&deployment.Port,
-			&deployment.ContainerName,
-			&deployment.StartedAt,
-			&deployment.CompletedAt,
-			&deployment.ErrorMessage,
-			&deployment.CreatedBy,
-			&deployment.ProjectName,
-			&deployment.DeploymentName,
-			&deployment.UserID,
-		)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployments: %w", err)
+	}
+
+	return deployments, nil
+}
+
+// scanDeployment scans the current row of rows selected with deploymentListColumns
+func (r *Repository) scanDeployment(rows *sql.Rows) (*models.Deployment, error) {
+	deployment := &models.Deployment{}
+	var additionalVarsJSON []byte
+
+	err := rows.Scan(
+		&deployment.ID,
+		&deployment.CreatedAt,
+		&deployment.UpdatedAt,
+		&deployment.Status,
+		&deployment.TargetIP,
+		&deployment.SSHUsername,
+		&deployment.SSHPasswordEncrypted,
+		&deployment.GitHubRepoURL,
+		&deployment.GitHubPATEncrypted,
+		&deployment.GitHubBranch,
+		&additionalVarsJSON,
+		&deployment.Port,
+		&deployment.ContainerName,
+		&deployment.StartedAt,
+		&deployment.CompletedAt,
+		&deployment.ErrorMessage,
+		&deployment.CreatedBy,
+		&deployment.ProjectName,
+		&deployment.DeploymentName,
+		&deployment.UserID,
+		&deployment.DeploymentType,
+		&deployment.ScriptPath,
+		&deployment.ScriptContent,
+		&deployment.TargetType,
+		&deployment.KubeconfigEncrypted,
+		&deployment.KubernetesNamespace,
+		&deployment.Image,
+		&deployment.ManifestsPath,
+		&deployment.RepoSubdirectory,
+		&deployment.GitLFS,
+		&deployment.ConcurrencyGroup,
+		&deployment.OrganizationID,
+		&deployment.SupersededBy,
+		&deployment.OneTimeCredentials,
+		&deployment.WorkerPool,
+		&deployment.GPUs,
+		&deployment.ExtraRunArgs,
+		&deployment.ScheduleID,
+		&deployment.CommitSHA,
+		&deployment.FailureCategory,
+		&deployment.ApplicationReleaseID,
+		&deployment.ApplicationService,
+		&deployment.ManagedServices,
+		&deployment.CronSchedule,
+		&deployment.CronRemovedAt,
+		&deployment.CommentCount,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan deployment: %w", err)
+	}
+
+	// Parse additional_vars JSON
+	if additionalVarsJSON != nil {
+		if err := json.Unmarshal(additionalVarsJSON, &deployment.AdditionalVars); err != nil {
+			r.logger.WithError(err).Warn("Failed to parse additional_vars JSON")
+		}
+	}
+
+	return deployment, nil
+}
+
+// deploymentFilterSQL builds the WHERE clause and arguments for a deployment filter
+func deploymentFilterSQL(filter models.DeploymentFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != nil {
+		addCondition("user_id = $%d", *filter.UserID)
+	}
+	if filter.Username != nil {
+		addCondition("user_id = (SELECT id FROM deploy_knot.users WHERE username = $%d)", *filter.Username)
+	}
+	if filter.Status != nil {
+		addCondition("status = $%d", *filter.Status)
+	}
+	if filter.TargetIP != nil {
+		addCondition("target_ip = $%d", *filter.TargetIP)
+	}
+	if filter.TargetType != nil {
+		addCondition("target_type = $%d", *filter.TargetType)
+	}
+	if filter.ProjectName != nil {
+		addCondition("project_name = $%d", *filter.ProjectName)
+	}
+	if filter.DeploymentName != nil {
+		addCondition("deployment_name = $%d", *filter.DeploymentName)
+	}
+	if filter.CreatedAfter != nil {
+		addCondition("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		addCondition("created_at < $%d", *filter.CreatedBefore)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	return where, args
+}
+
+// ListDeployments retrieves deployments across all users matching the filter
+func (r *Repository) ListDeployments(filter models.DeploymentFilter, limit, offset int) ([]*models.Deployment, error) {
+	where, args := deploymentFilterSQL(filter)
+
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(`
+		SELECT `+deploymentListColumns+`
+		FROM deploy_knot.deployments
+		%s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanDeployments(rows)
+}
+
+// StreamDeployments calls fn for every deployment matching the filter, newest first, reading rows
+// from the database as they are consumed rather than loading them all into memory
+func (r *Repository) StreamDeployments(filter models.DeploymentFilter, fn func(*models.Deployment) error) error {
+	where, args := deploymentFilterSQL(filter)
+	query := `
+		SELECT ` + deploymentListColumns + `
+		FROM deploy_knot.deployments
+		` + where + `
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream deployments: %w", err)
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		deployment, err := r.scanDeployment(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+			return err
+		}
+		if err := fn(deployment); err != nil {
+			return err
 		}
+	}
 
-		// Parse additional_vars JSON
-		if additionalVarsJSON != nil {
-			if err := json.Unmarshal(additionalVarsJSON, &deployment.AdditionalVars); err != nil {
-				r.logger.WithError(err).Warn("Failed to parse additional_vars JSON")
-			}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating deployments: %w", err)
+	}
+	return nil
+}
+
+// StreamDeploymentLogs calls fn for every log of a deployment in order, reading rows from the
+// database as they are consumed rather than loading them all into memory
+func (r *Repository) StreamDeploymentLogs(deploymentID uuid.UUID, fn func(*models.DeploymentLog) error) error {
+	rows, err := r.db.Query(`
+		SELECT `+deploymentLogColumns+`
+		FROM deploy_knot.deployment_logs
+		WHERE deployment_id = $1
+		ORDER BY seq ASC
+	`, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to stream deployment logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		log, err := scanDeploymentLog(rows)
+		if err != nil {
+			return err
 		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
 
-		deployments = append(deployments, deployment)
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating deployment logs: %w", err)
 	}
+	return nil
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating deployments: %w", err)
+// ShipDeploymentLogs hands the next deployment logs of all deployments that a log sink has not
+// received to ship, at most limit of them in sequence order, and moves the sink's cursor past them
+// once ship succeeds. Logs written after before are left for a later call, so entries committed out
+// of sequence order are not skipped. A sink seen for the first time starts after the latest log. It
+// returns 0 without calling ship when the sink is held by another server.
+func (r *Repository) ShipDeploymentLogs(sink string, limit int, before time.Time, ship func([]*models.ShippedLog) error) (int, error) {
+	tx, ok, err := r.beginCallout("log_sink_cursors/" + sink)
+	if err != nil || !ok {
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	return deployments, nil
+	if _, err := tx.Exec(`
+		INSERT INTO deploy_knot.log_sink_cursors (sink, last_seq)
+		SELECT $1, COALESCE(MAX(seq), 0) FROM deploy_knot.deployment_logs
+		ON CONFLICT (sink) DO NOTHING
+	`, sink); err != nil {
+		return 0, fmt.Errorf("failed to create log sink cursor: %w", err)
+	}
+
+	var lastSeq int64
+	err = tx.QueryRow(`
+		SELECT last_seq FROM deploy_knot.log_sink_cursors
+		WHERE sink = $1
+		FOR UPDATE SKIP LOCKED
+	`, sink).Scan(&lastSeq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get log sink cursor: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+deploymentLogColumns+`
+		FROM deploy_knot.deployment_logs
+		WHERE seq > $1 AND created_at < $2
+		ORDER BY seq ASC
+		LIMIT $3
+	`, lastSeq, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deployment logs to ship: %w", err)
+	}
+	var logs []*models.ShippedLog
+	deployments := make(map[uuid.UUID][]*models.ShippedLog)
+	for rows.Next() {
+		log, err := scanDeploymentLog(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		shipped := &models.ShippedLog{DeploymentLog: log}
+		logs = append(logs, shipped)
+		deployments[log.DeploymentID] = append(deployments[log.DeploymentID], shipped)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating deployment logs: %w", err)
+	}
+	if len(logs) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(deployments))
+	for id := range deployments {
+		ids = append(ids, id.String())
+	}
+	nameRows, err := tx.Query(`
+		SELECT id, project_name, deployment_name
+		FROM deploy_knot.deployments
+		WHERE id = ANY($1::uuid[])
+	`, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get deployment names: %w", err)
+	}
+	for nameRows.Next() {
+		var id uuid.UUID
+		var projectName, deploymentName *string
+		if err := nameRows.Scan(&id, &projectName, &deploymentName); err != nil {
+			nameRows.Close()
+			return 0, fmt.Errorf("failed to scan deployment names: %w", err)
+		}
+		for _, shipped := range deployments[id] {
+			shipped.ProjectName = projectName
+			shipped.DeploymentName = deploymentName
+		}
+	}
+	nameRows.Close()
+	if err := nameRows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating deployment names: %w", err)
+	}
+
+	if shipErr := ship(logs); shipErr != nil {
+		if _, err := tx.Exec(`
+			UPDATE deploy_knot.log_sink_cursors
+			SET attempts = attempts + 1, last_error = $2
+			WHERE sink = $1
+		`, sink, shipErr.Error()); err != nil {
+			return 0, fmt.Errorf("failed to record log sink attempt: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return 0, shipErr
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE deploy_knot.log_sink_cursors
+		SET last_seq = $2, attempts = 0, last_error = NULL, shipped_at = NOW()
+		WHERE sink = $1
+	`, sink, logs[len(logs)-1].Seq); err != nil {
+		return 0, fmt.Errorf("failed to advance log sink cursor: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(logs), nil
+}
+
+// CountUserDeployments returns how many of a user's deployments are pending or running and how
+// many were created since the given time
+func (r *Repository) CountUserDeployments(userID uuid.UUID, since time.Time) (active, recent int, err error) {
+	query := `
+		SELECT COUNT(*) FILTER (WHERE status IN ('pending', 'running')),
+		       COUNT(*) FILTER (WHERE created_at >= $2)
+		FROM deploy_knot.deployments
+		WHERE user_id = $1
+	`
+
+	if err := r.db.QueryRow(query, userID, since).Scan(&active, &recent); err != nil {
+		return 0, 0, fmt.Errorf("failed to count user deployments: %w", err)
+	}
+
+	return active, recent, nil
+}
+
+// GetUserQuotaUsage retrieves deployment usage for every user; recent counts deployments created since the given time
+func (r *Repository) GetUserQuotaUsage(since time.Time) ([]*models.UserQuota, error) {
+	query := `
+		SELECT u.id, u.username, u.role,
+		       COUNT(d.id) FILTER (WHERE d.status IN ('pending', 'running')),
+		       COUNT(d.id) FILTER (WHERE d.created_at >= $1),
+		       COUNT(d.id)
+		FROM deploy_knot.users u
+		LEFT JOIN deploy_knot.deployments d ON d.user_id = u.id
+		GROUP BY u.id, u.username, u.role
+		ORDER BY u.username ASC
+	`
+
+	rows, err := r.db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user quota usage: %w", err)
+	}
+	defer rows.Close()
+
+	var quotas []*models.UserQuota
+	for rows.Next() {
+		quota := &models.UserQuota{}
+		if err := rows.Scan(
+			&quota.UserID,
+			&quota.Username,
+			&quota.Role,
+			&quota.ActiveDeployments,
+			&quota.DeploymentsLast24h,
+			&quota.TotalDeployments,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user quota usage: %w", err)
+		}
+		quotas = append(quotas, quota)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user quota usage: %w", err)
+	}
+
+	return quotas, nil
+}
+
+// PromoteUsersToAdmin grants the admin role to the given usernames and returns how many users changed
+func (r *Repository) PromoteUsersToAdmin(usernames []string) (int64, error) {
+	query := `
+		UPDATE deploy_knot.users
+		SET role = 'admin', updated_at = NOW()
+		WHERE username = ANY($1) AND role <> 'admin'
+	`
+
+	result, err := r.db.Exec(query, pq.Array(usernames))
+	if err != nil {
+		return 0, fmt.Errorf("failed to promote users to admin: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// deploymentDurationSQL computes a deployment's duration in seconds, falling back to the time
+// between its first step starting and its last step completing for deployments without recorded
+// start and completion times. Steps run in parallel, so their durations do not add up.
+const deploymentDurationSQL = `COALESCE(
+			EXTRACT(EPOCH FROM (d.completed_at - d.started_at)),
+			(SELECT EXTRACT(EPOCH FROM (MAX(s.completed_at) - MIN(s.started_at))) FROM deploy_knot.deployment_steps s WHERE s.deployment_id = d.id)
+		)::float8`
+
+// recentProjectDeploymentsSQL selects a user's ($1) last $3 finished deployments of a project ($2) as "recent"
+const recentProjectDeploymentsSQL = `
+		WITH recent AS (
+			SELECT d.id, d.status, ` + deploymentDurationSQL + ` AS duration_seconds
+			FROM deploy_knot.deployments d
+			WHERE d.user_id = $1
+			  AND COALESCE(NULLIF(d.project_name, ''), d.github_repo_url) = $2
+			  AND d.status IN ('completed', 'failed')
+			ORDER BY d.created_at DESC
+			LIMIT $3
+		)
+	`
+
+// GetProjectStats summarises a user's most recent finished deployments of a project. Deployments
+// are grouped by project name, or by repository URL when no project name was given.
+func (r *Repository) GetProjectStats(userID uuid.UUID, project string, window int) (*models.ProjectStats, error) {
+	stats := &models.ProjectStats{Project: project}
+
+	var avgDuration sql.NullFloat64
+	err := r.db.QueryRow(recentProjectDeploymentsSQL+`
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE status = 'completed'),
+		       AVG(duration_seconds) FILTER (WHERE status = 'completed')
+		FROM recent
+	`, userID, project, window).Scan(&stats.SampleSize, &stats.Succeeded, &avgDuration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project stats: %w", err)
+	}
+
+	if stats.SampleSize > 0 {
+		stats.SuccessRate = float64(stats.Succeeded) / float64(stats.SampleSize)
+	}
+	if avgDuration.Valid {
+		stats.AvgDurationSeconds = &avgDuration.Float64
+	}
+
+	stats.AvgStepDurationSeconds, err = r.GetProjectStepDurations(userID, project, window)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.FailureCauses, err = r.GetProjectFailureCauses(userID, project, window)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetProjectFailureCauses counts a user's most recent failed deployments of a project by failure
+// category, most common first. Failures recorded before deployments were classified count as other.
+func (r *Repository) GetProjectFailureCauses(userID uuid.UUID, project string, window int) ([]*models.FailureCause, error) {
+	rows, err := r.db.Query(recentProjectDeploymentsSQL+`
+		SELECT COALESCE(d.failure_category, 'other') AS category, COUNT(*)
+		FROM recent
+		JOIN deploy_knot.deployments d ON d.id = recent.id
+		WHERE recent.status = 'failed'
+		GROUP BY category
+		ORDER BY COUNT(*) DESC, category
+	`, userID, project, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project failure causes: %w", err)
+	}
+	defer rows.Close()
+
+	causes := []*models.FailureCause{}
+	for rows.Next() {
+		cause := &models.FailureCause{}
+		if err := rows.Scan(&cause.Category, &cause.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan project failure cause: %w", err)
+		}
+		causes = append(causes, cause)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project failure causes: %w", err)
+	}
+
+	return causes, nil
+}
+
+// GetProjectStepDurations returns the average duration in seconds of each completed step across a
+// user's most recent finished deployments of a project
+func (r *Repository) GetProjectStepDurations(userID uuid.UUID, project string, window int) (map[string]float64, error) {
+	rows, err := r.db.Query(recentProjectDeploymentsSQL+`
+		SELECT s.step_name, AVG(s.duration_ms) / 1000.0
+		FROM deploy_knot.deployment_steps s
+		JOIN recent ON recent.id = s.deployment_id
+		WHERE s.status = 'completed' AND s.duration_ms IS NOT NULL
+		GROUP BY s.step_name
+	`, userID, project, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project step durations: %w", err)
+	}
+	defer rows.Close()
+
+	durations := map[string]float64{}
+	for rows.Next() {
+		var stepName string
+		var seconds float64
+		if err := rows.Scan(&stepName, &seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan project step duration: %w", err)
+		}
+		durations[stepName] = seconds
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project step durations: %w", err)
+	}
+
+	return durations, nil
+}
+
+// GetProjectTrend aggregates a user's deployments of a project per day since the given time. A nil
+// userID includes every user's deployments; with organizationID set, only the deployments created
+// in that organization are included.
+func (r *Repository) GetProjectTrend(userID, organizationID *uuid.UUID, project string, since time.Time) ([]*models.ProjectTrendPoint, error) {
+	query := `
+		SELECT date_trunc('day', d.created_at)::date AS day,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE d.status = 'completed'),
+		       COUNT(*) FILTER (WHERE d.status = 'failed'),
+		       AVG(` + deploymentDurationSQL + `) FILTER (WHERE d.status = 'completed')
+		FROM deploy_knot.deployments d
+		WHERE ($1::uuid IS NULL OR d.user_id = $1)
+		  AND ($2::uuid IS NULL OR d.organization_id = $2)
+		  AND COALESCE(NULLIF(d.project_name, ''), d.github_repo_url) = $3
+		  AND d.created_at >= $4
+		GROUP BY day
+		ORDER BY day ASC
+	`
+
+	rows, err := r.db.Query(query, userID, organizationID, project, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project trend: %w", err)
+	}
+	defer rows.Close()
+
+	trend := []*models.ProjectTrendPoint{}
+	for rows.Next() {
+		point := &models.ProjectTrendPoint{}
+		var day time.Time
+		var avgDuration sql.NullFloat64
+		if err := rows.Scan(&day, &point.Deployments, &point.Succeeded, &point.Failed, &avgDuration); err != nil {
+			return nil, fmt.Errorf("failed to scan project trend: %w", err)
+		}
+		point.Date = day.Format("2006-01-02")
+		if avgDuration.Valid {
+			point.AvgDurationSeconds = &avgDuration.Float64
+		}
+		trend = append(trend, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project trend: %w", err)
+	}
+
+	return trend, nil
+}
+
+// GetProjectEnvironmentStatuses retrieves the latest deployment of each environment of a project
+// created in an organization, ordered by environment, together with its latest completed
+// deployment. Deployments without a deployment name form the environment "".
+func (r *Repository) GetProjectEnvironmentStatuses(project string, organizationID uuid.UUID, limit int) ([]*models.EnvironmentStatus, error) {
+	query := `
+		WITH project_deployments AS (
+			SELECT COALESCE(deployment_name, '') AS environment, status, github_branch, commit_sha,
+			       COALESCE(completed_at, updated_at) AS updated_at, created_at
+			FROM deploy_knot.deployments
+			WHERE COALESCE(NULLIF(project_name, ''), github_repo_url) = $1
+			  AND organization_id = $3
+		),
+		latest AS (
+			SELECT DISTINCT ON (environment) environment, status, github_branch, commit_sha, updated_at
+			FROM project_deployments
+			ORDER BY environment, created_at DESC
+		)
+		SELECT latest.environment, latest.status, latest.github_branch, latest.commit_sha, latest.updated_at,
+		       deployed.commit_sha, deployed.updated_at
+		FROM latest
+		LEFT JOIN LATERAL (
+			SELECT commit_sha, updated_at
+			FROM project_deployments
+			WHERE environment = latest.environment AND status = 'completed'
+			ORDER BY created_at DESC
+			LIMIT 1
+		) deployed ON true
+		ORDER BY latest.environment
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, project, limit, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project environment statuses: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := []*models.EnvironmentStatus{}
+	for rows.Next() {
+		status := &models.EnvironmentStatus{}
+		if err := rows.Scan(&status.Environment, &status.Status, &status.GitHubBranch, &status.CommitSHA,
+			&status.UpdatedAt, &status.DeployedCommitSHA, &status.DeployedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan project environment status: %w", err)
+		}
+		statuses = append(statuses, status)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating project environment statuses: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// GetProjectTimelineDeployments retrieves up to limit deployments of a project created in
+// [since, until), oldest first. Deployments are grouped by project name, or by repository URL when
+// no project name was given. A nil userID includes every user's deployments.
+func (r *Repository) GetProjectTimelineDeployments(project string, userID *uuid.UUID, since, until time.Time, limit int) ([]*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentListColumns + `
+		FROM deploy_knot.deployments
+		WHERE COALESCE(NULLIF(project_name, ''), github_repo_url) = $1
+		  AND created_at >= $2 AND created_at < $3
+		  AND ($4::uuid IS NULL OR user_id = $4)
+		ORDER BY created_at ASC
+		LIMIT $5
+	`
+
+	rows, err := r.db.Query(query, project, since, until, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project timeline deployments: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanDeployments(rows)
+}
+
+// GetLatestProjectDeployment retrieves a user's most recent deployment of a project with the given
+// status; it returns nil when there is none
+func (r *Repository) GetLatestProjectDeployment(userID uuid.UUID, project string, status models.DeploymentStatus) (*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentListColumns + `
+		FROM deploy_knot.deployments
+		WHERE user_id = $1 AND COALESCE(NULLIF(project_name, ''), github_repo_url) = $2 AND status = $3
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	rows, err := r.db.Query(query, userID, project, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest project deployment: %w", err)
+	}
+	defer rows.Close()
+
+	deployments, err := r.scanDeployments(rows)
+	if err != nil || len(deployments) == 0 {
+		return nil, err
+	}
+	return deployments[0], nil
+}
+
+// GetLatestEnvironmentDeployment retrieves a user's most recent deployment of a GitHub repository
+// ("owner/repo") to an environment, the deployment name, with the given status. With project set,
+// only deployments of that project are considered. It returns nil when there is none.
+func (r *Repository) GetLatestEnvironmentDeployment(userID uuid.UUID, repo, environment, project string, status models.DeploymentStatus) (*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentListColumns + `
+		FROM deploy_knot.deployments
+		WHERE user_id = $1
+		  AND lower(regexp_replace(regexp_replace(github_repo_url, '^https?://[^/]+/', ''), '\.git$', '')) = lower($2)
+		  AND deployment_name = $3
+		  AND ($4 = '' OR COALESCE(NULLIF(project_name, ''), github_repo_url) = $4)
+		  AND status = $5
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	rows, err := r.db.Query(query, userID, repo, environment, project, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest environment deployment: %w", err)
+	}
+	defer rows.Close()
+
+	deployments, err := r.scanDeployments(rows)
+	if err != nil || len(deployments) == 0 {
+		return nil, err
+	}
+	return deployments[0], nil
+}
+
+// GetRolledBackSteps retrieves the steps of the given deployments that restored the previous image
+func (r *Repository) GetRolledBackSteps(deploymentIDs []uuid.UUID) ([]*models.DeploymentStep, error) {
+	if len(deploymentIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, deployment_id, step_name, status, started_at, completed_at, error_message, step_order
+		FROM deploy_knot.deployment_steps
+		WHERE deployment_id = ANY($1) AND output->>'rolled_back' = 'true'
+		ORDER BY completed_at ASC
+	`, pq.Array(deploymentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rolled back steps: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []*models.DeploymentStep
+	for rows.Next() {
+		step := &models.DeploymentStep{}
+		if err := rows.Scan(&step.ID, &step.DeploymentID, &step.StepName, &step.Status, &step.StartedAt,
+			&step.CompletedAt, &step.ErrorMessage, &step.StepOrder); err != nil {
+			return nil, fmt.Errorf("failed to scan rolled back step: %w", err)
+		}
+		steps = append(steps, step)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rolled back steps: %w", err)
+	}
+	return steps, nil
+}
+
+// GetLatestDeploymentLogs retrieves the most recent limit logs for a deployment, oldest first
+func (r *Repository) GetLatestDeploymentLogs(deploymentID uuid.UUID, limit int) ([]*models.DeploymentLog, error) {
+	query := `
+		SELECT ` + deploymentLogColumns + `
+		FROM (
+			SELECT ` + deploymentLogColumns + `
+			FROM deploy_knot.deployment_logs
+			WHERE deployment_id = $1
+			ORDER BY seq DESC
+			LIMIT $2
+		) latest
+		ORDER BY seq ASC
+	`
+
+	rows, err := r.db.Query(query, deploymentID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest deployment logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []*models.DeploymentLog{}
+	for rows.Next() {
+		log, err := scanDeploymentLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment logs: %w", err)
+	}
+
+	return logs, nil
+}
+
+// GetStuckDeployments retrieves deployments that have been running since before the cutoff
+func (r *Repository) GetStuckDeployments(cutoff time.Time) ([]*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentListColumns + `
+		FROM deploy_knot.deployments
+		WHERE status = 'running' AND COALESCE(started_at, updated_at) < $1
+		ORDER BY created_at ASC
+	`
+
+	rows, err := r.db.Query(query, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stuck deployments: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanDeployments(rows)
+}
+
+// TimeOutDeployment marks a running deployment and its unfinished steps as failed with the given
+// error; it returns false when the deployment was no longer running
+func (r *Repository) TimeOutDeployment(id uuid.UUID, errorMessage string) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE deploy_knot.deployments
+		SET status = 'failed', error_message = $2, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, id, errorMessage)
+	if err != nil {
+		return false, fmt.Errorf("failed to time out deployment: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE deploy_knot.deployment_steps
+		SET status = 'failed', error_message = $2, completed_at = NOW(),
+		    duration_ms = CASE WHEN started_at IS NOT NULL THEN (EXTRACT(EPOCH FROM (NOW() - started_at)) * 1000)::int END
+		WHERE deployment_id = $1 AND status IN ('pending', 'running')
+	`, id, errorMessage)
+	if err != nil {
+		return false, fmt.Errorf("failed to time out deployment steps: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	r.classifyDeploymentFailure(id)
+	return true, nil
+}
+
+// ResetDeploymentForRequeue returns a running deployment and its steps to pending so it can be
+// processed again; it returns false when the deployment was no longer running
+func (r *Repository) ResetDeploymentForRequeue(id uuid.UUID) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE deploy_knot.deployments
+		SET status = 'pending', started_at = NULL, completed_at = NULL, error_message = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset deployment: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE deploy_knot.deployment_steps
+		SET status = 'pending', started_at = NULL, completed_at = NULL, duration_ms = NULL, error_message = NULL, output = NULL
+		WHERE deployment_id = $1
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset deployment steps: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// ResetDeploymentForResume returns a failed deployment to pending and resets its steps from
+// fromStep on, keeping the earlier steps' records; it returns false when the deployment was no
+// longer failed
+func (r *Repository) ResetDeploymentForResume(id uuid.UUID, fromStep int) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE deploy_knot.deployments
+		SET status = 'pending', started_at = NULL, completed_at = NULL, error_message = NULL, failure_category = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'failed'
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset deployment: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE deploy_knot.deployment_steps
+		SET status = 'pending', started_at = NULL, completed_at = NULL, duration_ms = NULL, error_message = NULL, output = NULL
+		WHERE deployment_id = $1 AND step_order >= $2
+	`, id, fromStep)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset deployment steps: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// concurrencyGroupFilter matches the active deployments of concurrency group $1, scoped to
+// organization $2 or, without one, to user $3
+const concurrencyGroupFilter = `concurrency_group = $1 AND status IN ('pending', 'running')
+		  AND CASE WHEN $2::uuid IS NOT NULL THEN organization_id = $2
+		           ELSE organization_id IS NULL AND user_id IS NOT DISTINCT FROM $3::uuid END`
+
+// GetActiveDeploymentsInGroup returns the IDs of the pending and running deployments of a
+// concurrency group, oldest first
+func (r *Repository) GetActiveDeploymentsInGroup(group string, organizationID, userID *uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(`
+		SELECT id FROM deploy_knot.deployments
+		WHERE `+concurrencyGroupFilter+`
+		ORDER BY created_at ASC
+	`, group, organizationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active deployments in group: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployments: %w", err)
+	}
+	return ids, nil
+}
+
+// CancelActiveDeploymentsInGroup cancels the pending and running deployments of a concurrency
+// group and fails their unfinished steps with the given reason; it returns the cancelled IDs
+func (r *Repository) CancelActiveDeploymentsInGroup(group string, organizationID, userID *uuid.UUID, reason string) ([]uuid.UUID, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids, err := queryCancelledIDs(tx, `
+		UPDATE deploy_knot.deployments
+		SET status = 'cancelled', error_message = $4, completed_at = NOW(), updated_at = NOW()
+		WHERE `+concurrencyGroupFilter+`
+		RETURNING id
+	`, group, organizationID, userID, reason)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if err := cancelDeploymentSteps(tx, ids, reason); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return ids, nil
+}
+
+// SupersedePendingDeployments cancels the deployments still waiting in the queue for the same
+// project, branch, target and application service as the given newer deployment, within its
+// organization or, without one, its user. They are linked to it through superseded_by; it returns the superseded IDs.
+func (r *Repository) SupersedePendingDeployments(deployment *models.Deployment, reason string) ([]uuid.UUID, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids, err := queryCancelledIDs(tx, `
+		UPDATE deploy_knot.deployments
+		SET status = 'cancelled', superseded_by = $1, error_message = $2, completed_at = NOW(), updated_at = NOW()
+		WHERE id <> $1 AND status = 'pending' AND started_at IS NULL AND created_at <= $3
+		  AND COALESCE(NULLIF(project_name, ''), github_repo_url) = $4
+		  AND github_branch = $5 AND target_type = $6 AND target_ip = $7
+		  AND kubernetes_namespace IS NOT DISTINCT FROM $8
+		  AND CASE WHEN $9::uuid IS NOT NULL THEN organization_id = $9
+		           ELSE organization_id IS NULL AND user_id IS NOT DISTINCT FROM $10::uuid END
+		  AND application_service IS NOT DISTINCT FROM $11
+		RETURNING id
+	`, deployment.ID, reason, deployment.CreatedAt, deployment.ProjectKey(), deployment.GitHubBranch,
+		targetTypeOrDefault(deployment.TargetType), deployment.TargetIP, deployment.KubernetesNamespace,
+		deployment.OrganizationID, deployment.UserID, deployment.ApplicationService)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	if err := cancelDeploymentSteps(tx, ids, reason); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return ids, nil
+}
+
+// queryCancelledIDs runs an UPDATE ... RETURNING id that cancels deployments and collects their IDs
+func queryCancelledIDs(tx *sql.Tx, query string, args ...interface{}) ([]uuid.UUID, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cancelled deployments: %w", err)
+	}
+	return ids, nil
+}
+
+// cancelDeploymentSteps fails the unfinished steps of cancelled deployments with the given reason
+func cancelDeploymentSteps(ex execer, ids []uuid.UUID, reason string) error {
+	_, err := ex.Exec(`
+		UPDATE deploy_knot.deployment_steps
+		SET status = 'failed', error_message = $2, completed_at = NOW(),
+		    duration_ms = CASE WHEN started_at IS NOT NULL THEN (EXTRACT(EPOCH FROM (NOW() - started_at)) * 1000)::int END
+		WHERE deployment_id = ANY($1) AND status IN ('pending', 'running')
+	`, pq.Array(ids), reason)
+	if err != nil {
+		return fmt.Errorf("failed to cancel deployment steps: %w", err)
+	}
+	return nil
+}
+
+// GetLatestStartedDeploymentOnTarget returns the ID of the deployment that most recently started on
+// an SSH target, or uuid.Nil when none has
+func (r *Repository) GetLatestStartedDeploymentOnTarget(targetIP string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRow(`
+		SELECT id FROM deploy_knot.deployments
+		WHERE target_type = 'ssh' AND target_ip = $1 AND started_at IS NOT NULL
+		ORDER BY started_at DESC
+		LIMIT 1
+	`, targetIP).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get latest deployment on target: %w", err)
+	}
+	return id, nil
+}
+
+// CreateDeploymentComment stores a comment on a deployment
+func (r *Repository) CreateDeploymentComment(comment *models.DeploymentComment) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.deployment_comments (id, deployment_id, user_id, username, body, mentions, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, comment.ID, comment.DeploymentID, comment.UserID, comment.Username, comment.Body,
+		pq.Array(comment.Mentions), comment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment comment: %w", err)
+	}
+	return nil
+}
+
+// GetDeploymentComments returns the comments on a deployment, oldest first
+func (r *Repository) GetDeploymentComments(deploymentID uuid.UUID) ([]*models.DeploymentComment, error) {
+	rows, err := r.db.Query(`
+		SELECT id, deployment_id, user_id, username, body, mentions, created_at
+		FROM deploy_knot.deployment_comments
+		WHERE deployment_id = $1
+		ORDER BY created_at ASC
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments := []*models.DeploymentComment{}
+	for rows.Next() {
+		comment := &models.DeploymentComment{}
+		if err := rows.Scan(
+			&comment.ID,
+			&comment.DeploymentID,
+			&comment.UserID,
+			&comment.Username,
+			&comment.Body,
+			pq.Array(&comment.Mentions),
+			&comment.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment comments: %w", err)
+	}
+	return comments, nil
+}
+
+// SaveDeploymentArtifact stores an artifact of a deployment, replacing the artifact of the same name
+func (r *Repository) SaveDeploymentArtifact(artifact *models.DeploymentArtifact) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.deployment_artifacts (id, deployment_id, name, content_type, size, compressed_size, truncated, content, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (deployment_id, name) DO UPDATE SET
+			content_type = EXCLUDED.content_type,
+			size = EXCLUDED.size,
+			compressed_size = EXCLUDED.compressed_size,
+			truncated = EXCLUDED.truncated,
+			content = EXCLUDED.content,
+			created_at = EXCLUDED.created_at
+	`, artifact.ID, artifact.DeploymentID, artifact.Name, artifact.ContentType, artifact.Size,
+		artifact.CompressedSize, artifact.Truncated, artifact.Content, artifact.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save deployment artifact: %w", err)
+	}
+	return nil
+}
+
+// GetDeploymentArtifacts returns the artifacts of a deployment without their content, by name
+func (r *Repository) GetDeploymentArtifacts(deploymentID uuid.UUID) ([]*models.DeploymentArtifact, error) {
+	rows, err := r.db.Query(`
+		SELECT id, deployment_id, name, content_type, size, compressed_size, truncated, created_at
+		FROM deploy_knot.deployment_artifacts
+		WHERE deployment_id = $1
+		ORDER BY name ASC
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	artifacts := []*models.DeploymentArtifact{}
+	for rows.Next() {
+		artifact := &models.DeploymentArtifact{}
+		if err := rows.Scan(
+			&artifact.ID,
+			&artifact.DeploymentID,
+			&artifact.Name,
+			&artifact.ContentType,
+			&artifact.Size,
+			&artifact.CompressedSize,
+			&artifact.Truncated,
+			&artifact.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment artifact: %w", err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// GetDeploymentArtifact returns an artifact of a deployment with its content, or nil if there is none
+func (r *Repository) GetDeploymentArtifact(deploymentID uuid.UUID, name string) (*models.DeploymentArtifact, error) {
+	artifact := &models.DeploymentArtifact{}
+	err := r.db.QueryRow(`
+		SELECT id, deployment_id, name, content_type, size, compressed_size, truncated, content, created_at
+		FROM deploy_knot.deployment_artifacts
+		WHERE deployment_id = $1 AND name = $2
+	`, deploymentID, name).Scan(
+		&artifact.ID,
+		&artifact.DeploymentID,
+		&artifact.Name,
+		&artifact.ContentType,
+		&artifact.Size,
+		&artifact.CompressedSize,
+		&artifact.Truncated,
+		&artifact.Content,
+		&artifact.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// DeleteDeploymentArtifacts removes the artifacts stored before the given time
+func (r *Repository) DeleteDeploymentArtifacts(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.deployment_artifacts
+		WHERE created_at < $1
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete deployment artifacts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetExistingUsernames returns the usernames of the users among names, matched case-insensitively
+func (r *Repository) GetExistingUsernames(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.db.Query(`
+		SELECT username FROM deploy_knot.users
+		WHERE LOWER(username) = ANY($1)
+		ORDER BY username
+	`, pq.Array(lowerAll(names)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up usernames: %w", err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("failed to scan username: %w", err)
+		}
+		usernames = append(usernames, username)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating usernames: %w", err)
+	}
+	return usernames, nil
+}
+
+// lowerAll returns the strings in lower case
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
+}
+
+// CreateExecSession records the start of an interactive shell in a deployment's container
+func (r *Repository) CreateExecSession(session *models.ExecSession) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.exec_sessions (
+			id, deployment_id, user_id, username, client_ip, container_name, started_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, session.ID, session.DeploymentID, session.UserID, session.Username, session.ClientIP,
+		session.ContainerName, session.StartedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create exec session: %w", err)
+	}
+	return nil
+}
+
+// FinishExecSession records the end of an interactive shell along with its input transcript
+func (r *Repository) FinishExecSession(session *models.ExecSession) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.exec_sessions
+		SET ended_at = $2, exit_code = $3, end_reason = $4, input_transcript = $5,
+		    input_truncated = $6, output_bytes = $7
+		WHERE id = $1
+	`, session.ID, session.EndedAt, session.ExitCode, session.EndReason,
+		session.InputTranscript, session.InputTruncated, session.OutputBytes)
+	if err != nil {
+		return fmt.Errorf("failed to finish exec session: %w", err)
+	}
+	return nil
+}
+
+// GetExecSessions returns the interactive shells opened in a deployment's container, newest first
+func (r *Repository) GetExecSessions(deploymentID uuid.UUID) ([]*models.ExecSession, error) {
+	rows, err := r.db.Query(`
+		SELECT id, deployment_id, user_id, username, COALESCE(client_ip, ''), container_name,
+		       started_at, ended_at, exit_code, end_reason, input_transcript, input_truncated, output_bytes
+		FROM deploy_knot.exec_sessions
+		WHERE deployment_id = $1
+		ORDER BY started_at DESC
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exec sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.ExecSession
+	for rows.Next() {
+		session := &models.ExecSession{}
+		if err := rows.Scan(
+			&session.ID,
+			&session.DeploymentID,
+			&session.UserID,
+			&session.Username,
+			&session.ClientIP,
+			&session.ContainerName,
+			&session.StartedAt,
+			&session.EndedAt,
+			&session.ExitCode,
+			&session.EndReason,
+			&session.InputTranscript,
+			&session.InputTruncated,
+			&session.OutputBytes,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan exec session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exec sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// createOutboxEntry stores a deployment job that still has to be published to the queue
+func createOutboxEntry(ex execer, entry *models.OutboxEntry) error {
+	_, err := ex.Exec(`
+		INSERT INTO deploy_knot.job_outbox (id, deployment_id, payload_encrypted, created_at, held)
+		VALUES ($1, $2, $3, $4, $5)
+	`, entry.ID, entry.DeploymentID, entry.PayloadEncrypted, entry.CreatedAt, entry.Held)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox entry: %w", err)
+	}
+	return nil
+}
+
+// PublishOutboxEntries locks up to limit unpublished outbox entries that are not held, least
+// attempted and oldest first, and hands each to publish. Published entries are marked as such; on the first failure
+// the attempt is recorded and the batch stops, since the queue is most likely still unavailable.
+// Rows locked by another publisher are skipped. It returns the number of entries published.
+func (r *Repository) PublishOutboxEntries(limit int, publish func(*models.OutboxEntry) error) (int, error) {
+	return r.publishOutboxEntries(`
+		WHERE published_at IS NULL AND NOT held
+		ORDER BY attempts, created_at
+		LIMIT $1
+	`, []interface{}{limit}, publish)
+}
+
+// PublishOutboxEntry hands a single unpublished outbox entry to publish and marks it published on
+// success. It returns false without calling publish when the entry was already published, is held
+// or is locked by a publisher.
+func (r *Repository) PublishOutboxEntry(id uuid.UUID, publish func(*models.OutboxEntry) error) (bool, error) {
+	published, err := r.publishOutboxEntries(`
+		WHERE id = $1 AND published_at IS NULL AND NOT held
+	`, []interface{}{id}, publish)
+	return published == 1, err
+}
+
+// publishOutboxEntries locks the unpublished outbox entries selected by filter, skipping rows
+// locked elsewhere, and publishes them in order until the first failure
+func (r *Repository) publishOutboxEntries(filter string, args []interface{}, publish func(*models.OutboxEntry) error) (int, error) {
+	tx, ok, err := r.beginCallout("job_outbox")
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, deployment_id, payload_encrypted, created_at, published_at, attempts, last_error, held
+		FROM deploy_knot.job_outbox
+	`+filter+`
+		FOR UPDATE SKIP LOCKED
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get outbox entries: %w", err)
+	}
+
+	var entries []*models.OutboxEntry
+	for rows.Next() {
+		entry := &models.OutboxEntry{}
+		if err := rows.Scan(&entry.ID, &entry.DeploymentID, &entry.PayloadEncrypted, &entry.CreatedAt,
+			&entry.PublishedAt, &entry.Attempts, &entry.LastError, &entry.Held); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate outbox entries: %w", err)
+	}
+
+	published := 0
+	for _, entry := range entries {
+		if publishErr := publish(entry); publishErr != nil {
+			if _, err := tx.Exec(`
+				UPDATE deploy_knot.job_outbox
+				SET attempts = attempts + 1, last_error = $2
+				WHERE id = $1
+			`, entry.ID, publishErr.Error()); err != nil {
+				return published, fmt.Errorf("failed to record outbox attempt: %w", err)
+			}
+			break
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE deploy_knot.job_outbox
+			SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+			WHERE id = $1
+		`, entry.ID); err != nil {
+			return published, fmt.Errorf("failed to mark outbox entry published: %w", err)
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return published, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return published, nil
+}
+
+// DeleteDeploymentOutboxEntries removes every outbox entry of a deployment, published or not
+func (r *Repository) DeleteDeploymentOutboxEntries(deploymentID uuid.UUID) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.job_outbox
+		WHERE deployment_id = $1
+	`, deploymentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete deployment outbox entries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// DeletePublishedOutboxEntries removes outbox entries published before the given time
+func (r *Repository) DeletePublishedOutboxEntries(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.job_outbox
+		WHERE published_at IS NOT NULL AND published_at < $1
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox entries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// organizationColumns are the columns scanned by scanOrganization
+const organizationColumns = `id, name, slug, isolation_mode, allowed_cidrs, created_at, updated_at`
+
+// scanOrganization scans a row selected with organizationColumns
+func scanOrganization(row interface{ Scan(...interface{}) error }) (*models.Organization, error) {
+	org := &models.Organization{}
+	if err := row.Scan(&org.ID, &org.Name, &org.Slug, &org.IsolationMode, pq.Array(&org.AllowedCIDRs), &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// CreateOrganization creates a new organization
+func (r *Repository) CreateOrganization(org *models.Organization) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.organizations (id, name, slug, isolation_mode, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, org.ID, org.Name, org.Slug, org.IsolationMode, org.CreatedAt, org.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	return nil
+}
+
+// GetOrganization retrieves an organization by ID; it returns nil when the organization does not exist
+func (r *Repository) GetOrganization(id uuid.UUID) (*models.Organization, error) {
+	org, err := scanOrganization(r.db.QueryRow(`
+		SELECT `+organizationColumns+`
+		FROM deploy_knot.organizations
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return org, nil
+}
+
+// GetOrganizationBySlug retrieves an organization by slug; it returns nil when the organization does not exist
+func (r *Repository) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	org, err := scanOrganization(r.db.QueryRow(`
+		SELECT `+organizationColumns+`
+		FROM deploy_knot.organizations
+		WHERE slug = $1
+	`, slug))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return org, nil
+}
+
+// ListOrganizations retrieves all organizations ordered by name
+func (r *Repository) ListOrganizations() ([]*models.Organization, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + organizationColumns + `
+		FROM deploy_knot.organizations
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []*models.Organization
+	for rows.Next() {
+		org, err := scanOrganization(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetUserOrganization retrieves the organization a user belongs to; it returns nil when the user has none
+func (r *Repository) GetUserOrganization(userID uuid.UUID) (*models.Organization, error) {
+	org, err := scanOrganization(r.db.QueryRow(`
+		SELECT o.id, o.name, o.slug, o.isolation_mode, o.allowed_cidrs, o.created_at, o.updated_at
+		FROM deploy_knot.organizations o
+		JOIN deploy_knot.users u ON u.organization_id = o.id
+		WHERE u.id = $1
+	`, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user organization: %w", err)
+	}
+	return org, nil
+}
+
+// SetOrganizationAllowedCIDRs replaces the networks an organization's members may make sensitive
+// requests from; it returns false when the organization does not exist
+func (r *Repository) SetOrganizationAllowedCIDRs(id uuid.UUID, cidrs []string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.organizations
+		SET allowed_cidrs = $2
+		WHERE id = $1
+	`, id, pq.Array(cidrs))
+	if err != nil {
+		return false, fmt.Errorf("failed to set organization allowed CIDRs: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SetUserOrganization moves a user into an organization, or out of any when organizationID is nil;
+// it returns false when the user does not exist
+func (r *Repository) SetUserOrganization(userID uuid.UUID, organizationID *uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.users
+		SET organization_id = $2, updated_at = NOW()
+		WHERE id = $1
+	`, userID, organizationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set user organization: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+const projectColumns = `id, name, description, COALESCE(is_active, true), worker_pool, owner, organization_id, public_status, image_signature_policy, created_at, updated_at`
+
+// scanProject scans a row selected with projectColumns
+func scanProject(row interface{ Scan(...interface{}) error }) (*models.Project, error) {
+	project := &models.Project{}
+	if err := row.Scan(&project.ID, &project.Name, &project.Description, &project.IsActive,
+		&project.WorkerPool, &project.Owner, &project.OrganizationID, &project.PublicStatus, &project.ImageSignaturePolicy, &project.CreatedAt, &project.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// GetProjectByName retrieves a project by name; it returns nil when the project does not exist
+func (r *Repository) GetProjectByName(name string) (*models.Project, error) {
+	project, err := scanProject(r.db.QueryRow(`
+		SELECT `+projectColumns+`
+		FROM deploy_knot.projects
+		WHERE name = $1
+	`, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return project, nil
+}
+
+// GetProjectByID retrieves a project by ID; it returns nil when the project does not exist
+func (r *Repository) GetProjectByID(id uuid.UUID) (*models.Project, error) {
+	project, err := scanProject(r.db.QueryRow(`
+		SELECT `+projectColumns+`
+		FROM deploy_knot.projects
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return project, nil
+}
+
+// GetProjectTemplates retrieves the active deployment templates of a project ordered by name
+func (r *Repository) GetProjectTemplates(projectID uuid.UUID) ([]models.ProjectTemplateSpec, error) {
+	rows, err := r.db.Query(`
+		SELECT name, COALESCE(description, ''), playbook_template, default_vars
+		FROM deploy_knot.deployment_templates
+		WHERE project_id = $1 AND COALESCE(is_active, true)
+		ORDER BY name
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []models.ProjectTemplateSpec
+	for rows.Next() {
+		var template models.ProjectTemplateSpec
+		var defaultVarsJSON []byte
+		if err := rows.Scan(&template.Name, &template.Description, &template.PlaybookTemplate, &defaultVarsJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan project template: %w", err)
+		}
+		if defaultVarsJSON != nil {
+			if err := json.Unmarshal(defaultVarsJSON, &template.DefaultVars); err != nil {
+				r.logger.WithError(err).Warn("Failed to parse default_vars JSON")
+			}
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// GetProjectTargets retrieves the deployment targets of a project ordered by name
+func (r *Repository) GetProjectTargets(projectID uuid.UUID) ([]models.ProjectTargetSpec, error) {
+	rows, err := r.db.Query(`
+		SELECT name, target_type, COALESCE(target_ip, ''), COALESCE(ssh_username, ''),
+		       COALESCE(port, 0), COALESCE(kubernetes_namespace, ''), COALESCE(worker_pool, '')
+		FROM deploy_knot.project_targets
+		WHERE project_id = $1
+		ORDER BY name
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project targets: %w", err)
+	}
+	defer rows.Close()
+
+	var targets []models.ProjectTargetSpec
+	for rows.Next() {
+		var target models.ProjectTargetSpec
+		if err := rows.Scan(&target.Name, &target.TargetType, &target.TargetIP, &target.SSHUsername,
+			&target.Port, &target.KubernetesNamespace, &target.WorkerPool); err != nil {
+			return nil, fmt.Errorf("failed to scan project target: %w", err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+// GetProjectFreezeWindows retrieves the freeze windows of a project ordered by start
+func (r *Repository) GetProjectFreezeWindows(projectID uuid.UUID) ([]models.ProjectFreezeWindowSpec, error) {
+	rows, err := r.db.Query(`
+		SELECT starts_at, ends_at, COALESCE(reason, '')
+		FROM deploy_knot.project_freeze_windows
+		WHERE project_id = $1
+		ORDER BY starts_at, ends_at
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project freeze windows: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []models.ProjectFreezeWindowSpec
+	for rows.Next() {
+		var window models.ProjectFreezeWindowSpec
+		if err := rows.Scan(&window.StartsAt, &window.EndsAt, &window.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan project freeze window: %w", err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
+
+// GetActiveProjectFreezeWindow returns the freeze window of a project in effect at the given time
+// that ends last, or nil when there is none
+func (r *Repository) GetActiveProjectFreezeWindow(projectID uuid.UUID, at time.Time) (*models.ProjectFreezeWindowSpec, error) {
+	window := &models.ProjectFreezeWindowSpec{}
+	err := r.db.QueryRow(`
+		SELECT starts_at, ends_at, COALESCE(reason, '')
+		FROM deploy_knot.project_freeze_windows
+		WHERE project_id = $1 AND starts_at <= $2 AND ends_at > $2
+		ORDER BY ends_at DESC
+		LIMIT 1
+	`, projectID, at).Scan(&window.StartsAt, &window.EndsAt, &window.Reason)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get active project freeze window: %w", err)
+	}
+	return window, nil
+}
+
+// GetProjectGates retrieves the gates of a project ordered by name
+func (r *Repository) GetProjectGates(projectID uuid.UUID) ([]models.ProjectGateSpec, error) {
+	rows, err := r.db.Query(`
+		SELECT name, COALESCE(description, ''), timeout_minutes
+		FROM deploy_knot.project_gates
+		WHERE project_id = $1
+		ORDER BY name
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project gates: %w", err)
+	}
+	defer rows.Close()
+
+	var gates []models.ProjectGateSpec
+	for rows.Next() {
+		var gate models.ProjectGateSpec
+		if err := rows.Scan(&gate.Name, &gate.Description, &gate.TimeoutMinutes); err != nil {
+			return nil, fmt.Errorf("failed to scan project gate: %w", err)
+		}
+		gates = append(gates, gate)
+	}
+	return gates, rows.Err()
+}
+
+// nullIfEmpty maps an empty string to NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// ImportProjectConfig creates or updates the project named in the configuration, belonging to
+// organizationID, and replaces its templates, targets, freeze windows, gates, notifications and
+// incident policy with the configured ones, all in one transaction. Templates and targets that keep
+// their name keep their ID.
+func (r *Repository) ImportProjectConfig(cfg *models.ProjectConfig, organizationID *uuid.UUID) (*models.ProjectImportResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	project := &models.Project{Name: cfg.Project.Name, IsActive: true}
+	var created bool
+	err = tx.QueryRow(`
+		INSERT INTO deploy_knot.projects (name, description, is_active, worker_pool, owner, organization_id, public_status, image_signature_policy)
+		VALUES ($1, $2, true, $3, $4, $5, $6, $7)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description, is_active = true, worker_pool = EXCLUDED.worker_pool,
+		    owner = EXCLUDED.owner, organization_id = EXCLUDED.organization_id, public_status = EXCLUDED.public_status,
+		    image_signature_policy = EXCLUDED.image_signature_policy, updated_at = NOW()
+		RETURNING id, description, worker_pool, owner, organization_id, public_status, image_signature_policy, created_at, updated_at, (xmax = 0)
+	`, cfg.Project.Name, nullIfEmpty(cfg.Project.Description), nullIfEmpty(cfg.Project.WorkerPool), nullIfEmpty(cfg.Project.Owner), organizationID,
+		cfg.Project.PublicStatus, cfg.Project.ImageSignaturePolicy.OrDefault()).Scan(
+		&project.ID, &project.Description, &project.WorkerPool, &project.Owner, &project.OrganizationID, &project.PublicStatus, &project.ImageSignaturePolicy,
+		&project.CreatedAt, &project.UpdatedAt, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert project: %w", err)
+	}
+
+	// Templates and targets are matched by name, so the ones kept keep their IDs
+	templateNames := make([]string, len(cfg.Templates))
+	for i, template := range cfg.Templates {
+		templateNames[i] = template.Name
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM deploy_knot.deployment_templates WHERE project_id = $1 AND NOT (name = ANY($2))
+	`, project.ID, pq.Array(templateNames)); err != nil {
+		return nil, fmt.Errorf("failed to delete project templates: %w", err)
+	}
+	for _, template := range cfg.Templates {
+		var defaultVarsJSON []byte
+		if template.DefaultVars != nil {
+			defaultVarsJSON, err = json.Marshal(template.DefaultVars)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal default_vars of template %s: %w", template.Name, err)
+			}
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.deployment_templates (project_id, name, description, playbook_template, default_vars, is_active)
+			VALUES ($1, $2, $3, $4, $5, true)
+			ON CONFLICT (project_id, name) WHERE project_id IS NOT NULL DO UPDATE
+			SET description = EXCLUDED.description, playbook_template = EXCLUDED.playbook_template,
+			    default_vars = EXCLUDED.default_vars, is_active = true
+		`, project.ID, template.Name, nullIfEmpty(template.Description), template.PlaybookTemplate, defaultVarsJSON); err != nil {
+			return nil, fmt.Errorf("failed to create template %s: %w", template.Name, err)
+		}
+	}
+
+	targetNames := make([]string, len(cfg.Targets))
+	for i, target := range cfg.Targets {
+		targetNames[i] = target.Name
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM deploy_knot.project_targets WHERE project_id = $1 AND NOT (name = ANY($2))
+	`, project.ID, pq.Array(targetNames)); err != nil {
+		return nil, fmt.Errorf("failed to delete project targets: %w", err)
+	}
+	for _, target := range cfg.Targets {
+		var port interface{}
+		if target.Port != 0 {
+			port = target.Port
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.project_targets (project_id, name, target_type, target_ip, ssh_username, port, kubernetes_namespace, worker_pool)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (project_id, name) DO UPDATE
+			SET target_type = EXCLUDED.target_type, target_ip = EXCLUDED.target_ip, ssh_username = EXCLUDED.ssh_username,
+			    port = EXCLUDED.port, kubernetes_namespace = EXCLUDED.kubernetes_namespace, worker_pool = EXCLUDED.worker_pool
+		`, project.ID, target.Name, targetTypeOrDefault(target.TargetType), nullIfEmpty(target.TargetIP),
+			nullIfEmpty(target.SSHUsername), port, nullIfEmpty(target.KubernetesNamespace), nullIfEmpty(target.WorkerPool)); err != nil {
+			return nil, fmt.Errorf("failed to create target %s: %w", target.Name, err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM deploy_knot.project_freeze_windows WHERE project_id = $1`, project.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete project freeze windows: %w", err)
+	}
+	for _, window := range cfg.FreezeWindows {
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.project_freeze_windows (project_id, starts_at, ends_at, reason)
+			VALUES ($1, $2, $3, $4)
+		`, project.ID, window.StartsAt, window.EndsAt, nullIfEmpty(window.Reason)); err != nil {
+			return nil, fmt.Errorf("failed to create freeze window starting %s: %w", window.StartsAt.Format(time.RFC3339), err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM deploy_knot.project_gates WHERE project_id = $1`, project.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete project gates: %w", err)
+	}
+	for _, gate := range cfg.Gates {
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.project_gates (project_id, name, description, timeout_minutes)
+			VALUES ($1, $2, $3, $4)
+		`, project.ID, gate.Name, nullIfEmpty(gate.Description), gate.TimeoutMinutes); err != nil {
+			return nil, fmt.Errorf("failed to create gate %s: %w", gate.Name, err)
+		}
+	}
+
+	var notifications models.ProjectNotificationsSpec
+	if cfg.Notifications != nil {
+		notifications = *cfg.Notifications
+	}
+	if err := importProjectNotifications(tx, project.ID, notifications); err != nil {
+		return nil, err
+	}
+	if err := importProjectIncidentPolicy(tx, project.ID, cfg.Incidents); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &models.ProjectImportResult{
+		Project:       project,
+		Created:       created,
+		Templates:     len(cfg.Templates),
+		Targets:       len(cfg.Targets),
+		FreezeWindows: len(cfg.FreezeWindows),
+		Gates:         len(cfg.Gates),
+		Escalations:   len(notifications.Escalations),
+	}, nil
+}
+
+// importProjectNotifications replaces the digest and escalation policies of a project. A digest
+// whose schedule changed is rescheduled; replaced escalation policies only escalate deployments
+// that fail after the import.
+func importProjectNotifications(tx *sql.Tx, projectID uuid.UUID, spec models.ProjectNotificationsSpec) error {
+	if digest := spec.Digest; digest != nil {
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.project_digests (project_id, channel, cron_expression, timezone)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (project_id) DO UPDATE
+			SET channel = EXCLUDED.channel, cron_expression = EXCLUDED.cron_expression, timezone = EXCLUDED.timezone,
+			    next_send_at = CASE
+			        WHEN project_digests.cron_expression = EXCLUDED.cron_expression AND project_digests.timezone = EXCLUDED.timezone
+			        THEN project_digests.next_send_at
+			    END
+		`, projectID, digest.Channel, digest.GetCronExpression(), digest.GetTimezone()); err != nil {
+			return fmt.Errorf("failed to upsert project digest: %w", err)
+		}
+	} else if _, err := tx.Exec(`DELETE FROM deploy_knot.project_digests WHERE project_id = $1`, projectID); err != nil {
+		return fmt.Errorf("failed to delete project digest: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM deploy_knot.project_escalations WHERE project_id = $1`, projectID); err != nil {
+		return fmt.Errorf("failed to delete project escalations: %w", err)
+	}
+	for i, escalation := range spec.Escalations {
+		environments := escalation.Environments
+		if environments == nil {
+			environments = []string{}
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO deploy_knot.project_escalations (project_id, environments, after_minutes, channel)
+			VALUES ($1, $2, $3, $4)
+		`, projectID, pq.Array(environments), escalation.AfterMinutes, escalation.Channel); err != nil {
+			return fmt.Errorf("failed to create escalation %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ListProjects retrieves every project ordered by name
+func (r *Repository) ListProjects() ([]*models.Project, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + projectColumns + `
+		FROM deploy_knot.projects
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := []*models.Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// CreateProject creates a project
+func (r *Repository) CreateProject(project *models.Project) error {
+	err := r.db.QueryRow(`
+		INSERT INTO deploy_knot.projects (name, description, is_active, worker_pool, owner, organization_id, public_status, image_signature_policy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`, project.Name, project.Description, project.IsActive, project.WorkerPool, project.Owner, project.OrganizationID, project.PublicStatus, project.ImageSignaturePolicy.OrDefault()).Scan(
+		&project.ID, &project.CreatedAt, &project.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create project: %w", err)
+	}
+	return nil
+}
+
+// UpdateProject replaces the name, description, worker pool, owner, organization, status page
+// setting and image signature policy of a project. With expected set,
+// the project is only updated when it was last updated at that time. It reports whether the
+// project was updated.
+func (r *Repository) UpdateProject(project *models.Project, expected *time.Time) (bool, error) {
+	err := r.db.QueryRow(`
+		UPDATE deploy_knot.projects
+		SET name = $2, description = $3, worker_pool = $4, owner = $5, organization_id = $6, public_status = $7, image_signature_policy = $8
+		WHERE id = $1 AND ($9::timestamptz IS NULL OR updated_at = $9)
+		RETURNING COALESCE(is_active, true), created_at, updated_at
+	`, project.ID, project.Name, project.Description, project.WorkerPool, project.Owner, project.OrganizationID, project.PublicStatus, project.ImageSignaturePolicy.OrDefault(), expected).Scan(
+		&project.IsActive, &project.CreatedAt, &project.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update project: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteProject deletes a project with its templates, targets and freeze windows. With expected
+// set, the project is only deleted when it was last updated at that time. It reports whether the
+// project was deleted.
+func (r *Repository) DeleteProject(id uuid.UUID, expected *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.projects
+		WHERE id = $1 AND ($2::timestamptz IS NULL OR updated_at = $2)
+	`, id, expected)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete project: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+const projectOnCallColumns = `name, contact, source, since, until, previous_name, updated_at`
+
+// scanProjectOnCall scans a row selected with projectOnCallColumns
+func scanProjectOnCall(row interface{ Scan(...interface{}) error }) (*models.ProjectOnCall, error) {
+	onCall := &models.ProjectOnCall{}
+	if err := row.Scan(&onCall.Name, &onCall.Contact, &onCall.Source, &onCall.Since, &onCall.Until,
+		&onCall.PreviousName, &onCall.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return onCall, nil
+}
+
+// GetProjectOnCall retrieves who is on call for a project, or nil when nobody was reported
+func (r *Repository) GetProjectOnCall(projectID uuid.UUID) (*models.ProjectOnCall, error) {
+	onCall, err := scanProjectOnCall(r.db.QueryRow(`
+		SELECT `+projectOnCallColumns+`
+		FROM deploy_knot.project_on_call
+		WHERE project_id = $1
+	`, projectID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project on call: %w", err)
+	}
+	return onCall, nil
+}
+
+// SetProjectOnCall records who is on call for a project. When someone else than before takes over,
+// the previous person is kept as the one who handed off; reporting the same person again keeps
+// the start of their shift.
+func (r *Repository) SetProjectOnCall(projectID uuid.UUID, req *models.ProjectOnCallRequest) (*models.ProjectOnCall, error) {
+	onCall, err := scanProjectOnCall(r.db.QueryRow(`
+		INSERT INTO deploy_knot.project_on_call (project_id, name, contact, source, since, until)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamptz, NOW()), $6)
+		ON CONFLICT (project_id) DO UPDATE
+		SET previous_name = CASE WHEN project_on_call.name = EXCLUDED.name THEN project_on_call.previous_name ELSE project_on_call.name END,
+		    since = CASE WHEN project_on_call.name = EXCLUDED.name AND $5::timestamptz IS NULL THEN project_on_call.since ELSE EXCLUDED.since END,
+		    name = EXCLUDED.name, contact = EXCLUDED.contact, source = EXCLUDED.source, until = EXCLUDED.until,
+		    updated_at = NOW()
+		RETURNING `+projectOnCallColumns+`
+	`, projectID, req.OnCall, nullIfEmpty(req.Contact), nullIfEmpty(req.Source), req.Since, req.Until))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set project on call: %w", err)
+	}
+	return onCall, nil
+}
+
+// DeleteProjectOnCall records that nobody is on call for a project; it reports whether someone was
+func (r *Repository) DeleteProjectOnCall(projectID uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.project_on_call WHERE project_id = $1`, projectID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete project on call: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SetProjectBadgeToken replaces the badge token of a project with the one of the given hash
+func (r *Repository) SetProjectBadgeToken(projectID uuid.UUID, tokenHash, prefix string) (*models.ProjectBadgeToken, error) {
+	token := &models.ProjectBadgeToken{Prefix: prefix}
+	err := r.db.QueryRow(`
+		INSERT INTO deploy_knot.project_badge_tokens (project_id, token_hash, token_prefix)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, token_prefix = EXCLUDED.token_prefix, created_at = NOW()
+		RETURNING created_at
+	`, projectID, tokenHash, prefix).Scan(&token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set project badge token: %w", err)
+	}
+	return token, nil
+}
+
+// GetProjectBadgeTokenHash retrieves the hash of a project's badge token; it returns "" when the
+// project has none
+func (r *Repository) GetProjectBadgeTokenHash(projectID uuid.UUID) (string, error) {
+	var tokenHash string
+	err := r.db.QueryRow(`
+		SELECT token_hash FROM deploy_knot.project_badge_tokens WHERE project_id = $1
+	`, projectID).Scan(&tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get project badge token: %w", err)
+	}
+	return tokenHash, nil
+}
+
+// DeleteProjectBadgeToken revokes the badge token of a project and reports whether it had one
+func (r *Repository) DeleteProjectBadgeToken(projectID uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.project_badge_tokens WHERE project_id = $1`, projectID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete project badge token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ListProjectSigningKeys retrieves the signing keys of a project, by name
+func (r *Repository) ListProjectSigningKeys(projectID uuid.UUID) ([]*models.ProjectSigningKey, error) {
+	rows, err := r.db.Query(`
+		SELECT id, project_id, name, public_key, fingerprint, created_at
+		FROM deploy_knot.project_signing_keys
+		WHERE project_id = $1
+		ORDER BY name
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.ProjectSigningKey{}
+	for rows.Next() {
+		key := &models.ProjectSigningKey{}
+		if err := rows.Scan(&key.ID, &key.ProjectID, &key.Name, &key.PublicKey, &key.Fingerprint, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan project signing key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// CreateProjectSigningKey adds a signing key to a project. It reports false when the project
+// already has a key with the same name.
+func (r *Repository) CreateProjectSigningKey(key *models.ProjectSigningKey) (bool, error) {
+	err := r.db.QueryRow(`
+		INSERT INTO deploy_knot.project_signing_keys (project_id, name, public_key, fingerprint)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project_id, name) DO NOTHING
+		RETURNING id, created_at
+	`, key.ProjectID, key.Name, key.PublicKey, key.Fingerprint).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create project signing key: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteProjectSigningKey deletes a signing key of a project and reports whether it existed
+func (r *Repository) DeleteProjectSigningKey(projectID, id uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.project_signing_keys WHERE project_id = $1 AND id = $2`, projectID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete project signing key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetProjectContacts retrieves the owner of the project with the given name and who is on call for
+// it at the given time, or nil when there is no such project
+func (r *Repository) GetProjectContacts(name string, at time.Time) (*models.ProjectContacts, error) {
+	contacts := &models.ProjectContacts{}
+	onCall := &models.ProjectOnCall{}
+	// The on-call columns are NULL when nobody is on call
+	var onCallName *string
+	var since, updatedAt *time.Time
+	err := r.db.QueryRow(`
+		SELECT p.name, p.owner, o.name, o.contact, o.source, o.since, o.until, o.previous_name, o.updated_at
+		FROM deploy_knot.projects p
+		LEFT JOIN deploy_knot.project_on_call o ON o.project_id = p.id AND (o.until IS NULL OR o.until > $2)
+		WHERE p.name = $1
+	`, name, at).Scan(&contacts.Project, &contacts.Owner, &onCallName, &onCall.Contact, &onCall.Source, &since,
+		&onCall.Until, &onCall.PreviousName, &updatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project contacts: %w", err)
+	}
+
+	if onCallName != nil {
+		onCall.Name, onCall.Since, onCall.UpdatedAt = *onCallName, *since, *updatedAt
+		contacts.OnCall = onCall
+	}
+	return contacts, nil
+}
+
+const projectTargetColumns = `id, project_id, name, target_type, COALESCE(target_ip, ''), COALESCE(ssh_username, ''),
+		       COALESCE(port, 0), COALESCE(kubernetes_namespace, ''), COALESCE(worker_pool, ''),
+		       ssh_key_fingerprint, ssh_host_key_fingerprint, bootstrapped_at, created_at, updated_at`
+
+// scanProjectTarget scans a row selected with projectTargetColumns
+func scanProjectTarget(row interface{ Scan(...interface{}) error }) (*models.ProjectTarget, error) {
+	target := &models.ProjectTarget{}
+	if err := row.Scan(&target.ID, &target.ProjectID, &target.Name, &target.TargetType, &target.TargetIP,
+		&target.SSHUsername, &target.Port, &target.KubernetesNamespace, &target.WorkerPool,
+		&target.SSHKeyFingerprint, &target.SSHHostKeyFingerprint, &target.BootstrappedAt,
+		&target.CreatedAt, &target.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// ListProjectTargets retrieves the deployment targets of a project with their IDs, ordered by name
+func (r *Repository) ListProjectTargets(projectID uuid.UUID) ([]*models.ProjectTarget, error) {
+	rows, err := r.db.Query(`
+		SELECT `+projectTargetColumns+`
+		FROM deploy_knot.project_targets
+		WHERE project_id = $1
+		ORDER BY name
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project targets: %w", err)
+	}
+	defer rows.Close()
+
+	targets := []*models.ProjectTarget{}
+	for rows.Next() {
+		target, err := scanProjectTarget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project target: %w", err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
+
+// GetProjectTarget retrieves a target of a project; it returns nil when the project has no such target
+func (r *Repository) GetProjectTarget(projectID, id uuid.UUID) (*models.ProjectTarget, error) {
+	return r.getProjectTarget(`project_id = $1 AND id = $2`, projectID, id)
+}
+
+// GetProjectTargetByName retrieves a target of a project by name; it returns nil when there is none
+func (r *Repository) GetProjectTargetByName(projectID uuid.UUID, name string) (*models.ProjectTarget, error) {
+	return r.getProjectTarget(`project_id = $1 AND name = $2`, projectID, name)
+}
+
+// getProjectTarget retrieves the project target matching the condition
+func (r *Repository) getProjectTarget(condition string, args ...interface{}) (*models.ProjectTarget, error) {
+	target, err := scanProjectTarget(r.db.QueryRow(`
+		SELECT `+projectTargetColumns+`
+		FROM deploy_knot.project_targets
+		WHERE `+condition, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project target: %w", err)
+	}
+	return target, nil
+}
+
+// CreateProjectTarget creates a deployment target of a project
+func (r *Repository) CreateProjectTarget(target *models.ProjectTarget) error {
+	var port interface{}
+	if target.Port != 0 {
+		port = target.Port
+	}
+	err := r.db.QueryRow(`
+		INSERT INTO deploy_knot.project_targets (project_id, name, target_type, target_ip, ssh_username, port, kubernetes_namespace, worker_pool)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, target_type, created_at, updated_at
+	`, target.ProjectID, target.Name, targetTypeOrDefault(target.TargetType), nullIfEmpty(target.TargetIP),
+		nullIfEmpty(target.SSHUsername), port, nullIfEmpty(target.KubernetesNamespace), nullIfEmpty(target.WorkerPool)).Scan(
+		&target.ID, &target.TargetType, &target.CreatedAt, &target.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create project target: %w", err)
+	}
+	return nil
+}
+
+// UpdateProjectTarget replaces a deployment target of a project. With expected set, the target is
+// only updated when it was last updated at that time. It reports whether the target was updated.
+func (r *Repository) UpdateProjectTarget(target *models.ProjectTarget, expected *time.Time) (bool, error) {
+	var port interface{}
+	if target.Port != 0 {
+		port = target.Port
+	}
+	err := r.db.QueryRow(`
+		UPDATE deploy_knot.project_targets
+		SET name = $3, target_type = $4, target_ip = $5, ssh_username = $6, port = $7,
+		    kubernetes_namespace = $8, worker_pool = $9
+		WHERE project_id = $1 AND id = $2 AND ($10::timestamptz IS NULL OR updated_at = $10)
+		RETURNING target_type, created_at, updated_at
+	`, target.ProjectID, target.ID, target.Name, targetTypeOrDefault(target.TargetType), nullIfEmpty(target.TargetIP),
+		nullIfEmpty(target.SSHUsername), port, nullIfEmpty(target.KubernetesNamespace), nullIfEmpty(target.WorkerPool),
+		expected).Scan(&target.TargetType, &target.CreatedAt, &target.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update project target: %w", err)
+	}
+	return true, nil
+}
+
+// RecordProjectTargetBootstrap stores the deploy user of a bootstrapped SSH target with the
+// fingerprints of its key and of the target's host key
+func (r *Repository) RecordProjectTargetBootstrap(target *models.ProjectTarget) error {
+	err := r.db.QueryRow(`
+		UPDATE deploy_knot.project_targets
+		SET ssh_username = $3, ssh_key_fingerprint = $4, ssh_host_key_fingerprint = $5, bootstrapped_at = NOW()
+		WHERE project_id = $1 AND id = $2
+		RETURNING bootstrapped_at, updated_at
+	`, target.ProjectID, target.ID, target.SSHUsername, target.SSHKeyFingerprint, target.SSHHostKeyFingerprint).Scan(
+		&target.BootstrappedAt, &target.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record project target bootstrap: %w", err)
+	}
+	return nil
+}
+
+// DeleteProjectTarget deletes a deployment target of a project. With expected set, the target is
+// only deleted when it was last updated at that time. It reports whether the target was deleted.
+func (r *Repository) DeleteProjectTarget(projectID, id uuid.UUID, expected *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.project_targets
+		WHERE project_id = $1 AND id = $2 AND ($3::timestamptz IS NULL OR updated_at = $3)
+	`, projectID, id, expected)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete project target: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+const projectTemplateColumns = `id, project_id, name, COALESCE(description, ''), playbook_template, default_vars, created_at, updated_at`
+
+// scanProjectTemplate scans a row selected with projectTemplateColumns
+func (r *Repository) scanProjectTemplate(row interface{ Scan(...interface{}) error }) (*models.ProjectTemplate, error) {
+	template := &models.ProjectTemplate{}
+	var defaultVarsJSON []byte
+	if err := row.Scan(&template.ID, &template.ProjectID, &template.Name, &template.Description,
+		&template.PlaybookTemplate, &defaultVarsJSON, &template.CreatedAt, &template.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if defaultVarsJSON != nil {
+		if err := json.Unmarshal(defaultVarsJSON, &template.DefaultVars); err != nil {
+			r.logger.WithError(err).Warn("Failed to parse default_vars JSON")
+		}
+	}
+	return template, nil
+}
+
+// ListProjectTemplates retrieves the active deployment templates of a project with their IDs,
+// ordered by name
+func (r *Repository) ListProjectTemplates(projectID uuid.UUID) ([]*models.ProjectTemplate, error) {
+	rows, err := r.db.Query(`
+		SELECT `+projectTemplateColumns+`
+		FROM deploy_knot.deployment_templates
+		WHERE project_id = $1 AND COALESCE(is_active, true)
+		ORDER BY name
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []*models.ProjectTemplate{}
+	for rows.Next() {
+		template, err := r.scanProjectTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project template: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// GetProjectTemplate retrieves an active template of a project; it returns nil when there is none
+func (r *Repository) GetProjectTemplate(projectID, id uuid.UUID) (*models.ProjectTemplate, error) {
+	return r.getProjectTemplate(`project_id = $1 AND id = $2`, projectID, id)
+}
+
+// GetProjectTemplateByName retrieves an active template of a project by name; it returns nil when
+// there is none
+func (r *Repository) GetProjectTemplateByName(projectID uuid.UUID, name string) (*models.ProjectTemplate, error) {
+	return r.getProjectTemplate(`project_id = $1 AND name = $2`, projectID, name)
+}
+
+// getProjectTemplate retrieves the active project template matching the condition
+func (r *Repository) getProjectTemplate(condition string, args ...interface{}) (*models.ProjectTemplate, error) {
+	template, err := r.scanProjectTemplate(r.db.QueryRow(`
+		SELECT `+projectTemplateColumns+`
+		FROM deploy_knot.deployment_templates
+		WHERE COALESCE(is_active, true) AND `+condition, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project template: %w", err)
+	}
+	return template, nil
+}
+
+// CreateProjectTemplate creates a deployment template of a project. An inactive template with the
+// same name is replaced.
+func (r *Repository) CreateProjectTemplate(template *models.ProjectTemplate) error {
+	defaultVarsJSON, err := marshalDefaultVars(template.DefaultVars)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRow(`
+		INSERT INTO deploy_knot.deployment_templates (project_id, name, description, playbook_template, default_vars, is_active)
+		VALUES ($1, $2, $3, $4, $5, true)
+		ON CONFLICT (project_id, name) WHERE project_id IS NOT NULL DO UPDATE
+		SET description = EXCLUDED.description, playbook_template = EXCLUDED.playbook_template,
+		    default_vars = EXCLUDED.default_vars, is_active = true
+		WHERE NOT COALESCE(deployment_templates.is_active, true)
+		RETURNING id, created_at, updated_at
+	`, template.ProjectID, template.Name, nullIfEmpty(template.Description), template.PlaybookTemplate, defaultVarsJSON).Scan(
+		&template.ID, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create project template: %w", err)
+	}
+	return nil
+}
+
+// UpdateProjectTemplate replaces an active deployment template of a project. With expected set,
+// the template is only updated when it was last updated at that time. It reports whether the
+// template was updated.
+func (r *Repository) UpdateProjectTemplate(template *models.ProjectTemplate, expected *time.Time) (bool, error) {
+	defaultVarsJSON, err := marshalDefaultVars(template.DefaultVars)
+	if err != nil {
+		return false, err
+	}
+	err = r.db.QueryRow(`
+		UPDATE deploy_knot.deployment_templates
+		SET name = $3, description = $4, playbook_template = $5, default_vars = $6
+		WHERE project_id = $1 AND id = $2 AND COALESCE(is_active, true)
+		  AND ($7::timestamptz IS NULL OR updated_at = $7)
+		RETURNING created_at, updated_at
+	`, template.ProjectID, template.ID, template.Name, nullIfEmpty(template.Description), template.PlaybookTemplate,
+		defaultVarsJSON, expected).Scan(&template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update project template: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteProjectTemplate deletes a deployment template of a project. With expected set, the
+// template is only deleted when it was last updated at that time. It reports whether the template
+// was deleted.
+func (r *Repository) DeleteProjectTemplate(projectID, id uuid.UUID, expected *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.deployment_templates
+		WHERE project_id = $1 AND id = $2 AND COALESCE(is_active, true)
+		  AND ($3::timestamptz IS NULL OR updated_at = $3)
+	`, projectID, id, expected)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete project template: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// marshalDefaultVars encodes the default variables of a template, NULL when there are none
+func marshalDefaultVars(defaultVars map[string]interface{}) ([]byte, error) {
+	if defaultVars == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(defaultVars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal default_vars: %w", err)
+	}
+	return data, nil
+}
+
+const savedViewColumns = `id, user_id, name, filters, created_at, updated_at`
+
+// scanSavedView scans a row selected with savedViewColumns
+func scanSavedView(row interface{ Scan(...interface{}) error }) (*models.SavedView, error) {
+	view := &models.SavedView{}
+	var filtersJSON []byte
+	if err := row.Scan(&view.ID, &view.UserID, &view.Name, &filtersJSON, &view.CreatedAt, &view.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(filtersJSON, &view.Filters); err != nil {
+		return nil, fmt.Errorf("failed to parse saved view filters: %w", err)
+	}
+	return view, nil
+}
+
+// CreateSavedView stores a new saved view
+func (r *Repository) CreateSavedView(view *models.SavedView) error {
+	filtersJSON, err := json.Marshal(view.Filters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal saved view filters: %w", err)
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO deploy_knot.saved_views (id, user_id, name, filters, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, view.ID, view.UserID, view.Name, filtersJSON, view.CreatedAt, view.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create saved view: %w", err)
+	}
+	return nil
+}
+
+// GetSavedView retrieves one of userID's saved views; it returns nil when the view does not exist
+func (r *Repository) GetSavedView(id, userID uuid.UUID) (*models.SavedView, error) {
+	view, err := scanSavedView(r.db.QueryRow(`
+		SELECT `+savedViewColumns+`
+		FROM deploy_knot.saved_views
+		WHERE id = $1 AND user_id = $2
+	`, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get saved view: %w", err)
+	}
+	return view, nil
+}
+
+// GetSavedViewByName retrieves userID's saved view with the given name; it returns nil when there is none
+func (r *Repository) GetSavedViewByName(userID uuid.UUID, name string) (*models.SavedView, error) {
+	view, err := scanSavedView(r.db.QueryRow(`
+		SELECT `+savedViewColumns+`
+		FROM deploy_knot.saved_views
+		WHERE user_id = $1 AND name = $2
+	`, userID, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get saved view: %w", err)
+	}
+	return view, nil
+}
+
+// ListSavedViews returns userID's saved views ordered by name
+func (r *Repository) ListSavedViews(userID uuid.UUID) ([]*models.SavedView, error) {
+	rows, err := r.db.Query(`
+		SELECT `+savedViewColumns+`
+		FROM deploy_knot.saved_views
+		WHERE user_id = $1
+		ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved views: %w", err)
+	}
+	defer rows.Close()
+
+	var views []*models.SavedView
+	for rows.Next() {
+		view, err := scanSavedView(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saved view: %w", err)
+		}
+		views = append(views, view)
+	}
+	return views, rows.Err()
+}
+
+// UpdateSavedView replaces the name and filters of a saved view; it reports whether the view exists
+func (r *Repository) UpdateSavedView(view *models.SavedView) (bool, error) {
+	filtersJSON, err := json.Marshal(view.Filters)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal saved view filters: %w", err)
+	}
+
+	err = r.db.QueryRow(`
+		UPDATE deploy_knot.saved_views
+		SET name = $3, filters = $4
+		WHERE id = $1 AND user_id = $2
+		RETURNING created_at, updated_at
+	`, view.ID, view.UserID, view.Name, filtersJSON).Scan(&view.CreatedAt, &view.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update saved view: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteSavedView deletes one of userID's saved views; it reports whether the view existed
+func (r *Repository) DeleteSavedView(id, userID uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.saved_views
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved view: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved view: %w", err)
+	}
+	return affected > 0, nil
+}
+
+const userIdentityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+// scanUserIdentity scans a row selected with userIdentityColumns
+func scanUserIdentity(row interface{ Scan(...interface{}) error }) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+	if err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// CreateUserIdentity links an external identity to a user
+func (r *Repository) CreateUserIdentity(identity *models.UserIdentity) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.user_identities (id, user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email,
+		identity.CreatedAt, identity.LastLoginAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user identity: %w", err)
+	}
+	return nil
+}
+
+// GetUserIdentity retrieves the identity with the provider's subject; it returns nil when none is linked
+func (r *Repository) GetUserIdentity(provider, subject string) (*models.UserIdentity, error) {
+	identity, err := scanUserIdentity(r.db.QueryRow(`
+		SELECT `+userIdentityColumns+`
+		FROM deploy_knot.user_identities
+		WHERE provider = $1 AND subject = $2
+	`, provider, subject))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+	return identity, nil
+}
+
+// GetUserIdentities returns the identities linked to a user
+func (r *Repository) GetUserIdentities(userID uuid.UUID) ([]*models.UserIdentity, error) {
+	rows, err := r.db.Query(`
+		SELECT `+userIdentityColumns+`
+		FROM deploy_knot.user_identities
+		WHERE user_id = $1
+		ORDER BY provider
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*models.UserIdentity
+	for rows.Next() {
+		identity, err := scanUserIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// TouchUserIdentity records a login with an identity and refreshes its email
+func (r *Repository) TouchUserIdentity(id uuid.UUID, email *string) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.user_identities
+		SET last_login_at = NOW(), email = COALESCE($2, email)
+		WHERE id = $1
+	`, id, email)
+	if err != nil {
+		return fmt.Errorf("failed to update user identity: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserIdentity unlinks a user's identity at a provider; it reports whether one was linked
+func (r *Repository) DeleteUserIdentity(userID uuid.UUID, provider string) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.user_identities
+		WHERE user_id = $1 AND provider = $2
+	`, userID, provider)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user identity: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete user identity: %w", err)
+	}
+	return affected > 0, nil
+}
+
+const userColumns = `id, username, email, password_hash, role, is_active, created_at, updated_at`
+
+// scanUser scans a row selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	user := &models.User{}
+	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role,
+		&user.IsActive, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListUsers retrieves the users matching the filter ordered by username, together with the total
+// number of matches
+func (r *Repository) ListUsers(filter models.UserFilter, limit, offset int) ([]*models.User, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Username != nil {
+		args = append(args, *filter.Username)
+		conditions = append(conditions, fmt.Sprintf("LOWER(username) = LOWER($%d)", len(args)))
+	}
+	if filter.Email != nil {
+		args = append(args, *filter.Email)
+		conditions = append(conditions, fmt.Sprintf("LOWER(email) = LOWER($%d)", len(args)))
+	}
+	if filter.Active != nil {
+		args = append(args, *filter.Active)
+		conditions = append(conditions, fmt.Sprintf("is_active = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM deploy_knot.users `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT `+userColumns+`
+		FROM deploy_knot.users
+		%s
+		ORDER BY username
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating users: %w", err)
+	}
+	return users, total, nil
+}
+
+// UpdateUser saves a user's username, email, password hash, role and active flag; it reports
+// whether the user exists
+func (r *Repository) UpdateUser(user *models.User) (bool, error) {
+	err := r.db.QueryRow(`
+		UPDATE deploy_knot.users
+		SET username = $2, email = $3, password_hash = $4, role = $5, is_active = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`, user.ID, user.Username, user.Email, user.PasswordHash, roleOrDefault(user.Role), user.IsActive).Scan(&user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update user: %w", err)
+	}
+	return true, nil
+}
+
+// auditEventColumns are the columns scanned by scanAuditEvent
+const auditEventColumns = `id, event_type, user_id, COALESCE(username, ''), organization_id, ip_address, method, path, reason, created_at`
+
+// scanAuditEvent scans a row selected with auditEventColumns
+func scanAuditEvent(row interface{ Scan(...interface{}) error }) (*models.AuditEvent, error) {
+	event := &models.AuditEvent{}
+	if err := row.Scan(&event.ID, &event.EventType, &event.UserID, &event.Username, &event.OrganizationID,
+		&event.IPAddress, &event.Method, &event.Path, &event.Reason, &event.CreatedAt); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// CreateAuditEvent records an audit event
+func (r *Repository) CreateAuditEvent(event *models.AuditEvent) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.audit_events (id, event_type, user_id, username, organization_id, ip_address, method, path, reason, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)
+	`, event.ID, event.EventType, event.UserID, event.Username, event.OrganizationID,
+		event.IPAddress, event.Method, event.Path, event.Reason, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents retrieves the audit events matching the filter, newest first, and the total number of matches
+func (r *Repository) ListAuditEvents(filter models.AuditEventFilter, limit, offset int) ([]*models.AuditEvent, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.EventType != nil {
+		args = append(args, *filter.EventType)
+		conditions = append(conditions, fmt.Sprintf("event_type = $%d", len(args)))
+	}
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM deploy_knot.audit_events `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT `+auditEventColumns+`
+		FROM deploy_knot.audit_events
+		%s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating audit events: %w", err)
+	}
+	return events, total, nil
+}
+
+const deploymentScheduleColumns = `id, user_id, name, project, source_deployment_id, github_branch, cron_expression,
+		timezone, enabled, next_run_at, last_run_at, last_deployment_id, last_error, created_at, updated_at`
+
+// scanDeploymentSchedule scans a row selected with deploymentScheduleColumns
+func scanDeploymentSchedule(row interface{ Scan(...interface{}) error }) (*models.DeploymentSchedule, error) {
+	schedule := &models.DeploymentSchedule{}
+	err := row.Scan(&schedule.ID, &schedule.UserID, &schedule.Name, &schedule.Project, &schedule.SourceDeploymentID,
+		&schedule.GitHubBranch, &schedule.CronExpression, &schedule.Timezone, &schedule.Enabled, &schedule.NextRunAt,
+		&schedule.LastRunAt, &schedule.LastDeploymentID, &schedule.LastError, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// scanDeploymentSchedules scans rows selected with deploymentScheduleColumns
+func scanDeploymentSchedules(rows *sql.Rows) ([]*models.DeploymentSchedule, error) {
+	defer rows.Close()
+
+	var schedules []*models.DeploymentSchedule
+	for rows.Next() {
+		schedule, err := scanDeploymentSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deployment schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// CreateDeploymentSchedule stores a new deployment schedule
+func (r *Repository) CreateDeploymentSchedule(schedule *models.DeploymentSchedule) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.deployment_schedules (
+			id, user_id, name, project, source_deployment_id, github_branch, cron_expression,
+			timezone, enabled, next_run_at, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`, schedule.ID, schedule.UserID, schedule.Name, schedule.Project, schedule.SourceDeploymentID, schedule.GitHubBranch,
+		schedule.CronExpression, schedule.Timezone, schedule.Enabled, schedule.NextRunAt, schedule.CreatedAt, schedule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment schedule: %w", err)
+	}
+	return nil
+}
+
+// GetDeploymentSchedule retrieves a deployment schedule; it returns nil when it does not exist
+func (r *Repository) GetDeploymentSchedule(id uuid.UUID) (*models.DeploymentSchedule, error) {
+	schedule, err := scanDeploymentSchedule(r.db.QueryRow(`
+		SELECT `+deploymentScheduleColumns+`
+		FROM deploy_knot.deployment_schedules
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get deployment schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// GetDeploymentScheduleByName retrieves userID's deployment schedule with the given name; it
+// returns nil when there is none
+func (r *Repository) GetDeploymentScheduleByName(userID uuid.UUID, name string) (*models.DeploymentSchedule, error) {
+	schedule, err := scanDeploymentSchedule(r.db.QueryRow(`
+		SELECT `+deploymentScheduleColumns+`
+		FROM deploy_knot.deployment_schedules
+		WHERE user_id = $1 AND name = $2
+	`, userID, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get deployment schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListDeploymentSchedules returns deployment schedules ordered by project and name, only userID's
+// when it is set and only the project's when project is not empty
+func (r *Repository) ListDeploymentSchedules(userID *uuid.UUID, project string) ([]*models.DeploymentSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deploymentScheduleColumns+`
+		FROM deploy_knot.deployment_schedules
+		WHERE ($1::uuid IS NULL OR user_id = $1) AND ($2 = '' OR project = $2)
+		ORDER BY project, name
+	`, userID, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployment schedules: %w", err)
+	}
+	return scanDeploymentSchedules(rows)
+}
+
+// UpdateDeploymentSchedule replaces the settings of a deployment schedule and its next run. With
+// expected set, the schedule is only updated when it was last updated at that time. It reports
+// whether the schedule was updated.
+func (r *Repository) UpdateDeploymentSchedule(schedule *models.DeploymentSchedule, expected *time.Time) (bool, error) {
+	err := r.db.QueryRow(`
+		UPDATE deploy_knot.deployment_schedules
+		SET name = $2, project = $3, source_deployment_id = $4, github_branch = $5, cron_expression = $6,
+		    timezone = $7, enabled = $8, next_run_at = $9
+		WHERE id = $1 AND ($10::timestamptz IS NULL OR updated_at = $10)
+		RETURNING user_id, last_run_at, last_deployment_id, last_error, created_at, updated_at
+	`, schedule.ID, schedule.Name, schedule.Project, schedule.SourceDeploymentID, schedule.GitHubBranch,
+		schedule.CronExpression, schedule.Timezone, schedule.Enabled, schedule.NextRunAt, expected).Scan(
+		&schedule.UserID, &schedule.LastRunAt, &schedule.LastDeploymentID, &schedule.LastError, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update deployment schedule: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteDeploymentSchedule deletes a deployment schedule. With expected set, the schedule is only
+// deleted when it was last updated at that time. It reports whether the schedule was deleted.
+func (r *Repository) DeleteDeploymentSchedule(id uuid.UUID, expected *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.deployment_schedules
+		WHERE id = $1 AND ($2::timestamptz IS NULL OR updated_at = $2)
+	`, id, expected)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete deployment schedule: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetDueDeploymentSchedules returns up to limit enabled schedules whose next run is at or before now
+func (r *Repository) GetDueDeploymentSchedules(now time.Time, limit int) ([]*models.DeploymentSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deploymentScheduleColumns+`
+		FROM deploy_knot.deployment_schedules
+		WHERE enabled AND next_run_at <= $1
+		ORDER BY next_run_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due deployment schedules: %w", err)
+	}
+	return scanDeploymentSchedules(rows)
+}
+
+// ClaimDeploymentScheduleRun moves a due schedule's next run from dueAt to nextRunAt, so only one
+// server runs it; it reports whether this call claimed the run
+func (r *Repository) ClaimDeploymentScheduleRun(id uuid.UUID, dueAt time.Time, nextRunAt *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.deployment_schedules
+		SET next_run_at = $3, last_run_at = NOW()
+		WHERE id = $1 AND enabled AND next_run_at = $2
+	`, id, dueAt, nextRunAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim deployment schedule run: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// RecordDeploymentScheduleRun records the outcome of a schedule run: the deployment it created, or
+// why it created none
+func (r *Repository) RecordDeploymentScheduleRun(id uuid.UUID, deploymentID *uuid.UUID, runErr *string) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.deployment_schedules
+		SET last_deployment_id = COALESCE($2, last_deployment_id), last_error = $3
+		WHERE id = $1
+	`, id, deploymentID, runErr)
+	if err != nil {
+		return fmt.Errorf("failed to record deployment schedule run: %w", err)
+	}
+	return nil
+}
+
+const applicationColumns = `id, user_id, name, description, services, created_at, updated_at`
+
+// scanApplication scans a row selected with applicationColumns
+func scanApplication(row interface{ Scan(...interface{}) error }) (*models.Application, error) {
+	application := &models.Application{}
+	var servicesJSON []byte
+	err := row.Scan(&application.ID, &application.UserID, &application.Name, &application.Description, &servicesJSON,
+		&application.CreatedAt, &application.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(servicesJSON, &application.Services); err != nil {
+		return nil, fmt.Errorf("failed to parse application services: %w", err)
+	}
+	return application, nil
+}
+
+// CreateApplication stores a new application
+func (r *Repository) CreateApplication(application *models.Application) error {
+	servicesJSON, err := json.Marshal(application.Services)
+	if err != nil {
+		return fmt.Errorf("failed to marshal application services: %w", err)
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO deploy_knot.applications (id, user_id, name, description, services, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, application.ID, application.UserID, application.Name, application.Description, servicesJSON,
+		application.CreatedAt, application.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
+	}
+	return nil
+}
+
+// GetApplication retrieves an application; it returns nil when it does not exist
+func (r *Repository) GetApplication(id uuid.UUID) (*models.Application, error) {
+	application, err := scanApplication(r.db.QueryRow(`
+		SELECT `+applicationColumns+`
+		FROM deploy_knot.applications
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get application: %w", err)
+	}
+	return application, nil
+}
+
+// GetApplicationByName retrieves userID's application with the given name; it returns nil when
+// there is none
+func (r *Repository) GetApplicationByName(userID uuid.UUID, name string) (*models.Application, error) {
+	application, err := scanApplication(r.db.QueryRow(`
+		SELECT `+applicationColumns+`
+		FROM deploy_knot.applications
+		WHERE user_id = $1 AND name = $2
+	`, userID, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get application: %w", err)
+	}
+	return application, nil
+}
+
+// ListApplications returns applications ordered by name, only userID's when it is set
+func (r *Repository) ListApplications(userID *uuid.UUID) ([]*models.Application, error) {
+	rows, err := r.db.Query(`
+		SELECT `+applicationColumns+`
+		FROM deploy_knot.applications
+		WHERE ($1::uuid IS NULL OR user_id = $1)
+		ORDER BY name, created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applications: %w", err)
+	}
+	defer rows.Close()
+
+	var applications []*models.Application
+	for rows.Next() {
+		application, err := scanApplication(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan application: %w", err)
+		}
+		applications = append(applications, application)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating applications: %w", err)
+	}
+	return applications, nil
+}
+
+// UpdateApplication replaces the name, description and services of an application. With expected
+// set, the application is only updated when it was last updated at that time. It reports whether
+// the application was updated.
+func (r *Repository) UpdateApplication(application *models.Application, expected *time.Time) (bool, error) {
+	servicesJSON, err := json.Marshal(application.Services)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal application services: %w", err)
+	}
+	err = r.db.QueryRow(`
+		UPDATE deploy_knot.applications
+		SET name = $2, description = $3, services = $4
+		WHERE id = $1 AND ($5::timestamptz IS NULL OR updated_at = $5)
+		RETURNING user_id, created_at, updated_at
+	`, application.ID, application.Name, application.Description, servicesJSON, expected).Scan(
+		&application.UserID, &application.CreatedAt, &application.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update application: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteApplication deletes an application and its releases. With expected set, the application
+// is only deleted when it was last updated at that time. It reports whether the application was
+// deleted.
+func (r *Repository) DeleteApplication(id uuid.UUID, expected *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM deploy_knot.applications
+		WHERE id = $1 AND ($2::timestamptz IS NULL OR updated_at = $2)
+	`, id, expected)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete application: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+const applicationReleaseColumns = `id, application_id, user_id, target_ip, services, dependencies, created_at`
+
+// scanApplicationRelease scans a row selected with applicationReleaseColumns
+func scanApplicationRelease(row interface{ Scan(...interface{}) error }) (*models.ApplicationRelease, error) {
+	release := &models.ApplicationRelease{}
+	var dependenciesJSON []byte
+	err := row.Scan(&release.ID, &release.ApplicationID, &release.UserID, &release.TargetIP,
+		pq.Array(&release.Services), &dependenciesJSON, &release.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dependenciesJSON, &release.Dependencies); err != nil {
+		return nil, fmt.Errorf("failed to parse application release dependencies: %w", err)
+	}
+	return release, nil
+}
+
+// CreateApplicationRelease stores a new application release
+func (r *Repository) CreateApplicationRelease(release *models.ApplicationRelease) error {
+	dependencies := release.Dependencies
+	if dependencies == nil {
+		dependencies = map[string][]models.ApplicationDependency{}
+	}
+	dependenciesJSON, err := json.Marshal(dependencies)
+	if err != nil {
+		return fmt.Errorf("failed to marshal application release dependencies: %w", err)
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO deploy_knot.application_releases (id, application_id, user_id, target_ip, services, dependencies, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, release.ID, release.ApplicationID, release.UserID, release.TargetIP, pq.Array(release.Services), dependenciesJSON, release.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create application release: %w", err)
+	}
+	return nil
+}
+
+// GetApplicationRelease retrieves an application release; it returns nil when it does not exist
+func (r *Repository) GetApplicationRelease(id uuid.UUID) (*models.ApplicationRelease, error) {
+	release, err := scanApplicationRelease(r.db.QueryRow(`
+		SELECT `+applicationReleaseColumns+`
+		FROM deploy_knot.application_releases
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get application release: %w", err)
+	}
+	return release, nil
+}
+
+// ListApplicationReleases returns the latest limit releases of an application, newest first
+func (r *Repository) ListApplicationReleases(applicationID uuid.UUID, limit int) ([]*models.ApplicationRelease, error) {
+	rows, err := r.db.Query(`
+		SELECT `+applicationReleaseColumns+`
+		FROM deploy_knot.application_releases
+		WHERE application_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, applicationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list application releases: %w", err)
+	}
+	defer rows.Close()
+
+	var releases []*models.ApplicationRelease
+	for rows.Next() {
+		release, err := scanApplicationRelease(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan application release: %w", err)
+		}
+		releases = append(releases, release)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating application releases: %w", err)
+	}
+	return releases, nil
+}
+
+// GetApplicationReleaseDeployments returns the deployments of the services of application releases
+func (r *Repository) GetApplicationReleaseDeployments(releaseIDs []uuid.UUID) ([]*models.Deployment, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deploymentListColumns+`
+		FROM deploy_knot.deployments
+		WHERE application_release_id = ANY($1)
+		ORDER BY created_at
+	`, pq.Array(releaseIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get application release deployments: %w", err)
+	}
+	defer rows.Close()
+	return r.scanDeployments(rows)
+}
+
+// GetWaitingApplicationReleases returns up to limit releases with a deployment still waiting for
+// the services before it
+func (r *Repository) GetWaitingApplicationReleases(limit int) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT d.application_release_id
+		FROM deploy_knot.deployments d
+		JOIN deploy_knot.deployment_gates g ON g.deployment_id = d.id
+		WHERE d.application_release_id IS NOT NULL AND d.status = 'pending'
+		  AND g.name = $1 AND g.status = 'waiting'
+		LIMIT $2
+	`, models.ApplicationReleaseGate, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get waiting application releases: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan application release: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating application releases: %w", err)
+	}
+	return ids, nil
+}
+
+const apiKeyColumns = `id, user_id, name, key_prefix, expires_at, last_used_at, created_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CreateAPIKey stores a new API key with the hash of the key
+func (r *Repository) CreateAPIKey(key *models.APIKey, keyHash string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.api_keys (id, user_id, name, key_prefix, key_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, key.ID, key.UserID, key.Name, key.Prefix, keyHash, key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys retrieves a user's API keys, newest first
+func (r *Repository) ListAPIKeys(userID uuid.UUID) ([]*models.APIKey, error) {
+	rows, err := r.db.Query(`
+		SELECT `+apiKeyColumns+`
+		FROM deploy_knot.api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByName retrieves a user's API key by name; it returns nil when there is none
+func (r *Repository) GetAPIKeyByName(userID uuid.UUID, name string) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(`
+		SELECT `+apiKeyColumns+`
+		FROM deploy_knot.api_keys
+		WHERE user_id = $1 AND name = $2
+	`, userID, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash; it returns nil when there is none
+func (r *Repository) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(`
+		SELECT `+apiKeyColumns+`
+		FROM deploy_knot.api_keys
+		WHERE key_hash = $1
+	`, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// TouchAPIKey records that an API key was used, at most once a minute
+func (r *Repository) TouchAPIKey(id uuid.UUID) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIKey deletes one of userID's API keys; it reports whether the key existed
+func (r *Repository) DeleteAPIKey(id, userID uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete API key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// workerTokenColumns are the columns scanned by scanWorkerToken
+const workerTokenColumns = `id, worker_id, token_prefix, created_by, created_at, last_used_at, revoked_at, revoked_by`
+
+// scanWorkerToken scans a row selected with workerTokenColumns
+func scanWorkerToken(row interface{ Scan(...interface{}) error }) (*models.WorkerToken, error) {
+	token := &models.WorkerToken{}
+	if err := row.Scan(&token.ID, &token.WorkerID, &token.Prefix, &token.CreatedBy, &token.CreatedAt, &token.LastUsedAt,
+		&token.RevokedAt, &token.RevokedBy); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// CreateWorkerToken stores a new worker token with the hash of the token
+func (r *Repository) CreateWorkerToken(token *models.WorkerToken, tokenHash string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.worker_tokens (id, worker_id, token_prefix, token_hash, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, token.ID, token.WorkerID, token.Prefix, tokenHash, token.CreatedBy, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create worker token: %w", err)
+	}
+	return nil
+}
+
+// ListWorkerTokens retrieves every worker token, including revoked ones, newest first
+func (r *Repository) ListWorkerTokens() ([]*models.WorkerToken, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + workerTokenColumns + `
+		FROM deploy_knot.worker_tokens
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []*models.WorkerToken{}
+	for rows.Next() {
+		token, err := scanWorkerToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan worker token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// GetActiveWorkerToken retrieves the token of a worker that is not revoked; it returns nil when
+// there is none
+func (r *Repository) GetActiveWorkerToken(workerID string) (*models.WorkerToken, error) {
+	token, err := scanWorkerToken(r.db.QueryRow(`
+		SELECT `+workerTokenColumns+`
+		FROM deploy_knot.worker_tokens
+		WHERE worker_id = $1 AND revoked_at IS NULL
+	`, workerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get worker token: %w", err)
+	}
+	return token, nil
+}
+
+// GetWorkerTokenByHash retrieves a worker token by the hash of the token; it returns nil when there is none
+func (r *Repository) GetWorkerTokenByHash(tokenHash string) (*models.WorkerToken, error) {
+	token, err := scanWorkerToken(r.db.QueryRow(`
+		SELECT `+workerTokenColumns+`
+		FROM deploy_knot.worker_tokens
+		WHERE token_hash = $1
+	`, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get worker token: %w", err)
+	}
+	return token, nil
+}
+
+// TouchWorkerToken records that a worker token was used, at most once a minute
+func (r *Repository) TouchWorkerToken(id uuid.UUID) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.worker_tokens
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to update worker token: %w", err)
+	}
+	return nil
+}
+
+// RevokeWorkerToken revokes a worker token; it reports whether an active token was revoked
+func (r *Repository) RevokeWorkerToken(id uuid.UUID, revokedBy *string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.worker_tokens
+		SET revoked_at = NOW(), revoked_by = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, id, revokedBy)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke worker token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// jobColumns are the columns scanned by scanJobRecord
+const jobColumns = `j.id, j.deployment_id, j.type, j.status, j.pool, j.requeues, j.deferrals, j.error_message, j.created_at,
+	j.started_at, j.completed_at, j.updated_at`
+
+// scanJobRecord scans a row selected with jobColumns
+func scanJobRecord(row interface{ Scan(...interface{}) error }) (*models.JobRecord, error) {
+	job := &models.JobRecord{}
+	if err := row.Scan(&job.ID, &job.DeploymentID, &job.Type, &job.Status, &job.Pool, &job.Requeues, &job.Deferrals,
+		&job.ErrorMessage, &job.CreatedAt, &job.StartedAt, &job.CompletedAt, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RecordJob stores the current state of a deployment job, creating its record on first use
+func (r *Repository) RecordJob(job *models.JobRecord) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.jobs (id, deployment_id, type, status, pool, requeues, deferrals, error_message,
+		                              created_at, started_at, completed_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status, pool = EXCLUDED.pool, requeues = EXCLUDED.requeues, deferrals = EXCLUDED.deferrals,
+		    error_message = EXCLUDED.error_message, started_at = EXCLUDED.started_at,
+		    completed_at = EXCLUDED.completed_at, updated_at = NOW()
+	`, job.ID, job.DeploymentID, job.Type, job.Status, job.Pool, job.Requeues, job.Deferrals, job.ErrorMessage,
+		job.CreatedAt, job.StartedAt, job.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record job: %w", err)
+	}
+	return nil
+}
+
+// ListJobs retrieves the jobs matching filter, newest first. Jobs are joined with their
+// deployments, so row-level security limits them to an isolated organization's.
+func (r *Repository) ListJobs(filter models.JobFilter, limit, offset int) ([]*models.JobRecord, error) {
+	rows, err := r.db.Query(`
+		SELECT `+jobColumns+`
+		FROM deploy_knot.jobs j
+		JOIN deploy_knot.deployments d ON d.id = j.deployment_id
+		WHERE ($1::uuid IS NULL OR d.user_id = $1) AND ($2::uuid IS NULL OR j.deployment_id = $2)
+		  AND ($3 = '' OR j.status = $3) AND ($4 = '' OR j.pool = $4)
+		ORDER BY j.created_at DESC
+		LIMIT $5 OFFSET $6
+	`, filter.UserID, filter.DeploymentID, filter.Status, filter.Pool, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.JobRecord{}
+	for rows.Next() {
+		job, err := scanJobRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetJobRecord retrieves a job, only among the deployments of userID when it is set; it returns
+// nil when there is none
+func (r *Repository) GetJobRecord(id uuid.UUID, userID *uuid.UUID) (*models.JobRecord, error) {
+	job, err := scanJobRecord(r.db.QueryRow(`
+		SELECT `+jobColumns+`
+		FROM deploy_knot.jobs j
+		JOIN deploy_knot.deployments d ON d.id = j.deployment_id
+		WHERE j.id = $1 AND ($2::uuid IS NULL OR d.user_id = $2)
+	`, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// deploymentGateColumns are the columns scanned by scanDeploymentGate
+const deploymentGateColumns = `deployment_id, name, status, expires_at, details, url, reported_by, reported_at, created_at`
+
+// scanDeploymentGate scans a row selected with deploymentGateColumns
+func scanDeploymentGate(row interface{ Scan(...interface{}) error }) (*models.DeploymentGate, error) {
+	gate := &models.DeploymentGate{}
+	if err := row.Scan(&gate.DeploymentID, &gate.Name, &gate.Status, &gate.ExpiresAt, &gate.Details, &gate.URL,
+		&gate.ReportedBy, &gate.ReportedAt, &gate.CreatedAt); err != nil {
+		return nil, err
+	}
+	return gate, nil
+}
+
+// GetDeploymentGates retrieves the gates of a deployment ordered by name
+func (r *Repository) GetDeploymentGates(deploymentID uuid.UUID) ([]*models.DeploymentGate, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deploymentGateColumns+`
+		FROM deploy_knot.deployment_gates
+		WHERE deployment_id = $1
+		ORDER BY name
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment gates: %w", err)
+	}
+	defer rows.Close()
+
+	var gates []*models.DeploymentGate
+	for rows.Next() {
+		gate, err := scanDeploymentGate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment gate: %w", err)
+		}
+		gates = append(gates, gate)
+	}
+	return gates, rows.Err()
+}
+
+// ReportDeploymentGate records the result of a gate that is still waiting and has not expired. It
+// returns the updated gate, or nil when the gate does not exist or is no longer waiting.
+func (r *Repository) ReportDeploymentGate(deploymentID uuid.UUID, name string, status models.GateStatus, details, url *string, reportedBy uuid.UUID) (*models.DeploymentGate, error) {
+	gate, err := scanDeploymentGate(r.db.QueryRow(`
+		UPDATE deploy_knot.deployment_gates
+		SET status = $3, details = $4, url = $5, reported_by = $6, reported_at = NOW()
+		WHERE deployment_id = $1 AND name = $2 AND status = 'waiting' AND expires_at > NOW()
+		RETURNING `+deploymentGateColumns, deploymentID, name, status, details, url, reportedBy))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to report deployment gate: %w", err)
+	}
+	return gate, nil
+}
+
+// ExpireDeploymentGates marks up to limit waiting gates that expired before now as timed out and
+// returns them
+func (r *Repository) ExpireDeploymentGates(now time.Time, limit int) ([]*models.DeploymentGate, error) {
+	rows, err := r.db.Query(`
+		UPDATE deploy_knot.deployment_gates
+		SET status = 'timed_out'
+		WHERE (deployment_id, name) IN (
+			SELECT deployment_id, name
+			FROM deploy_knot.deployment_gates
+			WHERE status = 'waiting' AND expires_at <= $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deploymentGateColumns, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire deployment gates: %w", err)
+	}
+	defer rows.Close()
+
+	var gates []*models.DeploymentGate
+	for rows.Next() {
+		gate, err := scanDeploymentGate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment gate: %w", err)
+		}
+		gates = append(gates, gate)
+	}
+	return gates, rows.Err()
+}
+
+// ReleaseHeldOutboxEntries stops holding back the outbox entries of a deployment and returns their
+// IDs; only the first caller gets them
+func (r *Repository) ReleaseHeldOutboxEntries(deploymentID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(`
+		UPDATE deploy_knot.job_outbox
+		SET held = FALSE
+		WHERE deployment_id = $1 AND held
+		RETURNING id
+	`, deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release outbox entries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox entry ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FailGatedDeployment fails a deployment that is still waiting for its gates and drops its
+// unpublished jobs. The jobs are dropped even when the deployment was already cancelled; it reports
+// whether the deployment was failed.
+func (r *Repository) FailGatedDeployment(id uuid.UUID, message string) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE deploy_knot.deployments
+		SET status = 'failed', error_message = $2, failure_category = 'other', completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'pending' AND started_at IS NULL
+	`, id, message)
+	if err != nil {
+		return false, fmt.Errorf("failed to fail deployment: %w", err)
+	}
+	failed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if failed > 0 {
+		if err := cancelDeploymentSteps(tx, []uuid.UUID{id}, message); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM deploy_knot.job_outbox
+		WHERE deployment_id = $1 AND published_at IS NULL
+	`, id); err != nil {
+		return false, fmt.Errorf("failed to delete outbox entries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return failed > 0, nil
+}
+
+// importProjectIncidentPolicy replaces the incident policy of a project. An updated policy keeps
+// its creation time, so failures from before the import are not reported again.
+func importProjectIncidentPolicy(tx *sql.Tx, projectID uuid.UUID, spec *models.ProjectIncidentSpec) error {
+	if spec == nil {
+		if _, err := tx.Exec(`DELETE FROM deploy_knot.project_incident_policies WHERE project_id = $1`, projectID); err != nil {
+			return fmt.Errorf("failed to delete project incident policy: %w", err)
+		}
+		return nil
+	}
+
+	environments := spec.Environments
+	if environments == nil {
+		environments = []string{}
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO deploy_knot.project_incident_policies (project_id, service, environments, severity)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (project_id) DO UPDATE
+		SET service = EXCLUDED.service, environments = EXCLUDED.environments, severity = EXCLUDED.severity
+	`, projectID, spec.Service, pq.Array(environments), spec.GetSeverity()); err != nil {
+		return fmt.Errorf("failed to upsert project incident policy: %w", err)
+	}
+	return nil
+}
+
+// GetProjectNotifications retrieves the digest and escalation policies of a project, or nil when it
+// has neither
+func (r *Repository) GetProjectNotifications(projectID uuid.UUID) (*models.ProjectNotificationsSpec, error) {
+	spec := &models.ProjectNotificationsSpec{}
+	digest := &models.ProjectDigestSpec{}
+	err := r.db.QueryRow(`
+		SELECT channel, cron_expression, timezone
+		FROM deploy_knot.project_digests
+		WHERE project_id = $1
+	`, projectID).Scan(&digest.Channel, &digest.CronExpression, &digest.Timezone)
+	switch {
+	case err == nil:
+		spec.Digest = digest
+	case err != sql.ErrNoRows:
+		return nil, fmt.Errorf("failed to get project digest: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT environments, after_minutes, channel
+		FROM deploy_knot.project_escalations
+		WHERE project_id = $1
+		ORDER BY created_at, id
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project escalations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var escalation models.ProjectEscalationSpec
+		if err := rows.Scan(pq.Array(&escalation.Environments), &escalation.AfterMinutes, &escalation.Channel); err != nil {
+			return nil, fmt.Errorf("failed to scan project escalation: %w", err)
+		}
+		if len(escalation.Environments) == 0 {
+			escalation.Environments = nil
+		}
+		spec.Escalations = append(spec.Escalations, escalation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if spec.Digest == nil && len(spec.Escalations) == 0 {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// ListProjectDigests retrieves the digests of every active project
+func (r *Repository) ListProjectDigests() ([]*models.ProjectDigest, error) {
+	rows, err := r.db.Query(`
+		SELECT d.project_id, p.name, d.channel, d.cron_expression, d.timezone, d.next_send_at, d.last_sent_at
+		FROM deploy_knot.project_digests d
+		JOIN deploy_knot.projects p ON p.id = d.project_id
+		WHERE p.is_active
+		ORDER BY p.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project digests: %w", err)
+	}
+	defer rows.Close()
+
+	var digests []*models.ProjectDigest
+	for rows.Next() {
+		digest := &models.ProjectDigest{}
+		if err := rows.Scan(&digest.ProjectID, &digest.ProjectName, &digest.Channel, &digest.CronExpression,
+			&digest.Timezone, &digest.NextSendAt, &digest.LastSentAt); err != nil {
+			return nil, fmt.Errorf("failed to scan project digest: %w", err)
+		}
+		digests = append(digests, digest)
+	}
+	return digests, rows.Err()
+}
+
+// AdvanceProjectDigest moves the next send of a project digest from expected, which is nil for a
+// digest that is not scheduled yet, to next, so only one server sends it. With sent set, the digest
+// is recorded as sent now. It reports whether this call advanced the digest.
+func (r *Repository) AdvanceProjectDigest(projectID uuid.UUID, expected, next *time.Time, sent bool) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.project_digests
+		SET next_send_at = $3, last_sent_at = CASE WHEN $4::boolean THEN NOW() ELSE last_sent_at END
+		WHERE project_id = $1 AND next_send_at IS NOT DISTINCT FROM $2::timestamptz
+	`, projectID, expected, next, sent)
+	if err != nil {
+		return false, fmt.Errorf("failed to advance project digest: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetDueEscalations returns up to limit failed deployments an escalation policy of their project is
+// due for: the deployment failed after the policy was created and at least after_minutes before now,
+// was not escalated by the policy yet, and no later deployment of its environment completed or failed
+func (r *Repository) GetDueEscalations(now time.Time, limit int) ([]*models.DueEscalation, error) {
+	rows, err := r.db.Query(`
+		SELECT e.id, e.channel, e.after_minutes, p.name, d.id
+		FROM deploy_knot.project_escalations e
+		JOIN deploy_knot.projects p ON p.id = e.project_id AND p.is_active
+		JOIN deploy_knot.deployments d ON d.project_name = p.name
+		WHERE d.status = 'failed'
+		  AND d.completed_at >= e.created_at
+		  AND d.completed_at <= $1::timestamptz - make_interval(mins => e.after_minutes)
+		  AND (cardinality(e.environments) = 0 OR d.deployment_name = ANY(e.environments))
+		  AND NOT EXISTS (
+		      SELECT 1 FROM deploy_knot.deployment_escalations de
+		      WHERE de.deployment_id = d.id AND de.escalation_id = e.id
+		  )
+		  AND NOT EXISTS (
+		      SELECT 1 FROM deploy_knot.deployments later
+		      WHERE later.project_name = d.project_name
+		        AND later.deployment_name IS NOT DISTINCT FROM d.deployment_name
+		        AND later.created_at > d.created_at
+		        AND later.status IN ('completed', 'failed')
+		  )
+		ORDER BY d.completed_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due escalations: %w", err)
+	}
+	defer rows.Close()
+
+	var due []*models.DueEscalation
+	for rows.Next() {
+		escalation := &models.DueEscalation{}
+		if err := rows.Scan(&escalation.EscalationID, &escalation.Channel, &escalation.AfterMinutes,
+			&escalation.ProjectName, &escalation.DeploymentID); err != nil {
+			return nil, fmt.Errorf("failed to scan due escalation: %w", err)
+		}
+		due = append(due, escalation)
+	}
+	return due, rows.Err()
+}
+
+// ClaimDeploymentEscalation records that an escalation policy is sent for a deployment, so only one
+// server sends it; it reports whether this call claimed it
+func (r *Repository) ClaimDeploymentEscalation(deploymentID, escalationID uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO deploy_knot.deployment_escalations (deployment_id, escalation_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, deploymentID, escalationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim deployment escalation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ReleaseDeploymentEscalation forgets a claimed escalation that could not be sent, so it is retried
+func (r *Repository) ReleaseDeploymentEscalation(deploymentID, escalationID uuid.UUID) error {
+	_, err := r.db.Exec(`
+		DELETE FROM deploy_knot.deployment_escalations
+		WHERE deployment_id = $1 AND escalation_id = $2
+	`, deploymentID, escalationID)
+	if err != nil {
+		return fmt.Errorf("failed to release deployment escalation: %w", err)
+	}
+	return nil
+}
+
+// GetProjectIncidentPolicy retrieves the incident policy of a project, or nil when it has none
+func (r *Repository) GetProjectIncidentPolicy(projectID uuid.UUID) (*models.ProjectIncidentSpec, error) {
+	spec := &models.ProjectIncidentSpec{}
+	err := r.db.QueryRow(`
+		SELECT service, environments, severity
+		FROM deploy_knot.project_incident_policies
+		WHERE project_id = $1
+	`, projectID).Scan(&spec.Service, pq.Array(&spec.Environments), &spec.Severity)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project incident policy: %w", err)
+	}
+	if len(spec.Environments) == 0 {
+		spec.Environments = nil
+	}
+	return spec, nil
+}
+
+// GetUnreportedIncidentFailures returns up to limit failed deployments, oldest failure first, that
+// the incident policy of their project covers and that were not added to an incident yet. Failures
+// from before the policy was created, and failures a later deployment of the environment already
+// fixed, are left out.
+func (r *Repository) GetUnreportedIncidentFailures(limit int) ([]*models.IncidentFailure, error) {
+	rows, err := r.db.Query(`
+		SELECT p.id, p.name, ip.service, ip.severity, COALESCE(d.deployment_name, ''), d.id, d.created_at
+		FROM deploy_knot.project_incident_policies ip
+		JOIN deploy_knot.projects p ON p.id = ip.project_id AND p.is_active
+		JOIN deploy_knot.deployments d ON d.project_name = p.name
+		WHERE d.status = 'failed'
+		  AND d.completed_at >= ip.created_at
+		  AND (cardinality(ip.environments) = 0 OR d.deployment_name = ANY(ip.environments))
+		  AND NOT EXISTS (SELECT 1 FROM deploy_knot.incident_deployments x WHERE x.deployment_id = d.id)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM deploy_knot.deployments later
+		      WHERE later.project_name = d.project_name
+		        AND later.deployment_name IS NOT DISTINCT FROM d.deployment_name
+		        AND later.created_at > d.created_at
+		        AND later.status = 'completed'
+		  )
+		ORDER BY d.completed_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unreported incident failures: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []*models.IncidentFailure
+	for rows.Next() {
+		failure := &models.IncidentFailure{}
+		if err := rows.Scan(&failure.ProjectID, &failure.ProjectName, &failure.Service, &failure.Severity,
+			&failure.Environment, &failure.DeploymentID, &failure.FailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan incident failure: %w", err)
+		}
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+// RecordIncidentFailure adds a failed deployment to the triggered incident of its environment, or
+// raises a new incident, and marks the incident's trigger event for delivery. It reports whether
+// the failure was added; it is not when another server added it first.
+func (r *Repository) RecordIncidentFailure(failure *models.IncidentFailure) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var incidentID uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO deploy_knot.deployment_incidents (project_id, environment, service, severity, deployment_id, last_failed_at, pending_event)
+		VALUES ($1, $2, $3, $4, $5, $6, 'trigger')
+		ON CONFLICT (project_id, environment) WHERE status = 'triggered' DO UPDATE
+		SET deployment_id = EXCLUDED.deployment_id, failures = deployment_incidents.failures + 1,
+		    last_failed_at = GREATEST(deployment_incidents.last_failed_at, EXCLUDED.last_failed_at),
+		    pending_event = 'trigger', last_error = NULL
+		RETURNING id
+	`, failure.ProjectID, failure.Environment, failure.Service, failure.Severity, failure.DeploymentID, failure.FailedAt).Scan(&incidentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record incident: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO deploy_knot.incident_deployments (deployment_id, incident_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, failure.DeploymentID, incidentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record incident deployment: %w", err)
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if added == 0 {
+		return false, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// ResolveDeploymentIncidents resolves every triggered incident whose environment completed a
+// deployment created after its latest failure, marks the resolve events for delivery and returns
+// how many incidents were resolved
+func (r *Repository) ResolveDeploymentIncidents() (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.deployment_incidents i
+		SET status = 'resolved', resolved_at = NOW(), resolved_by_deployment_id = fixed.id,
+		    pending_event = 'resolve', last_error = NULL
+		FROM (
+		    SELECT DISTINCT ON (i2.id) i2.id AS incident_id, d.id
+		    FROM deploy_knot.deployment_incidents i2
+		    JOIN deploy_knot.projects p ON p.id = i2.project_id
+		    JOIN deploy_knot.deployments d ON d.project_name = p.name
+		        AND COALESCE(d.deployment_name, '') = i2.environment
+		        AND d.created_at > i2.last_failed_at
+		        AND d.status = 'completed'
+		    WHERE i2.status = 'triggered'
+		    ORDER BY i2.id, d.completed_at
+		) fixed
+		WHERE i.id = fixed.incident_id AND i.status = 'triggered'
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve deployment incidents: %w", err)
+	}
+	resolved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(resolved), nil
+}
+
+const deploymentIncidentColumns = `i.id, i.project_id, p.name, i.environment, i.service, i.severity, i.status,
+		       i.deployment_id, i.failures, i.last_failed_at, i.resolved_by_deployment_id, i.pending_event,
+		       i.last_error, i.triggered_at, i.resolved_at`
+
+// GetPendingIncidentEvents returns up to limit incidents with an event still to be delivered,
+// oldest first
+func (r *Repository) GetPendingIncidentEvents(limit int) ([]*models.DeploymentIncident, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deploymentIncidentColumns+`
+		FROM deploy_knot.deployment_incidents i
+		JOIN deploy_knot.projects p ON p.id = i.project_id
+		WHERE i.pending_event IS NOT NULL
+		ORDER BY i.triggered_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending incident events: %w", err)
+	}
+	defer rows.Close()
+
+	var incidents []*models.DeploymentIncident
+	for rows.Next() {
+		incident := &models.DeploymentIncident{}
+		if err := rows.Scan(&incident.ID, &incident.ProjectID, &incident.ProjectName, &incident.Environment,
+			&incident.Service, &incident.Severity, &incident.Status, &incident.DeploymentID, &incident.Failures,
+			&incident.LastFailedAt, &incident.ResolvedByDeploymentID, &incident.PendingEvent, &incident.LastError,
+			&incident.TriggeredAt, &incident.ResolvedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan deployment incident: %w", err)
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+// CompleteIncidentEvent records the delivery of an incident event. An event that was replaced
+// while it was delivered, such as a trigger by a resolve, stays pending.
+func (r *Repository) CompleteIncidentEvent(id uuid.UUID, event models.IncidentEvent) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.deployment_incidents
+		SET pending_event = NULL, last_error = NULL
+		WHERE id = $1 AND pending_event = $2
+	`, id, event)
+	if err != nil {
+		return fmt.Errorf("failed to complete incident event: %w", err)
+	}
+	return nil
+}
+
+// FailIncidentEvent records why an incident event could not be delivered; with retry unset the
+// event is dropped
+func (r *Repository) FailIncidentEvent(id uuid.UUID, event models.IncidentEvent, message string, retry bool) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.deployment_incidents
+		SET last_error = $3, pending_event = CASE WHEN $4::boolean THEN pending_event END
+		WHERE id = $1 AND pending_event = $2
+	`, id, event, message, retry)
+	if err != nil {
+		return fmt.Errorf("failed to record incident event error: %w", err)
+	}
+	return nil
+}
+
+// ListCommandTemplates returns the command templates set through the API, by step
+func (r *Repository) ListCommandTemplates() ([]*models.CommandTemplate, error) {
+	rows, err := r.db.Query(`
+		SELECT step, template, updated_by, updated_at
+		FROM deploy_knot.command_templates
+		ORDER BY step
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list command templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*models.CommandTemplate
+	for rows.Next() {
+		tmpl := &models.CommandTemplate{Source: models.CommandTemplateSourceDatabase}
+		if err := rows.Scan(&tmpl.Step, &tmpl.Template, &tmpl.UpdatedBy, &tmpl.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan command template: %w", err)
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// GetCommandTemplate returns the command template of a step set through the API, or nil when none is set
+func (r *Repository) GetCommandTemplate(step string) (*models.CommandTemplate, error) {
+	tmpl := &models.CommandTemplate{Source: models.CommandTemplateSourceDatabase}
+	err := r.db.QueryRow(`
+		SELECT step, template, updated_by, updated_at
+		FROM deploy_knot.command_templates
+		WHERE step = $1
+	`, step).Scan(&tmpl.Step, &tmpl.Template, &tmpl.UpdatedBy, &tmpl.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get command template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// SetCommandTemplate creates or replaces the command template of a step
+func (r *Repository) SetCommandTemplate(step, template string, updatedBy *string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.command_templates (step, template, updated_by, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (step) DO UPDATE
+		SET template = EXCLUDED.template, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, step, template, updatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to set command template: %w", err)
+	}
+	return nil
+}
+
+// DeleteCommandTemplate removes the command template of a step; it returns false when none was set
+func (r *Repository) DeleteCommandTemplate(step string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.command_templates WHERE step = $1`, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete command template: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetPendingGitHubDeploymentUpdates returns up to limit deployments created since the given time,
+// oldest first, whose current status has not been reported to GitHub. Deployments without a stored
+// GitHub token are left out, and so are statuses whose reporting failed maxAttempts times.
+func (r *Repository) GetPendingGitHubDeploymentUpdates(since time.Time, maxAttempts, limit int) ([]*models.GitHubDeploymentUpdate, error) {
+	rows, err := r.db.Query(`
+		SELECT d.id, d.status, d.github_repo_url, d.github_branch, d.commit_sha, d.project_name,
+		       d.deployment_name, d.target_type, d.target_ip, d.port, d.error_message,
+		       d.github_pat_encrypted, d.created_at, g.github_deployment_id
+		FROM deploy_knot.deployments d
+		LEFT JOIN deploy_knot.github_deployments g ON g.deployment_id = d.id
+		WHERE d.created_at >= $1
+		  AND d.github_pat_encrypted IS NOT NULL
+		  AND g.reported_status IS DISTINCT FROM d.status
+		  AND NOT (g.attempted_status IS NOT DISTINCT FROM d.status AND g.attempts >= $2)
+		ORDER BY d.created_at
+		LIMIT $3
+	`, since, maxAttempts, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending GitHub deployment updates: %w", err)
+	}
+	defer rows.Close()
+
+	var updates []*models.GitHubDeploymentUpdate
+	for rows.Next() {
+		update := &models.GitHubDeploymentUpdate{}
+		if err := rows.Scan(&update.DeploymentID, &update.Status, &update.RepoURL, &update.Branch, &update.CommitSHA,
+			&update.ProjectName, &update.DeploymentName, &update.TargetType, &update.TargetIP, &update.Port,
+			&update.ErrorMessage, &update.PATEncrypted, &update.CreatedAt, &update.GitHubDeploymentID); err != nil {
+			return nil, fmt.Errorf("failed to scan GitHub deployment update: %w", err)
+		}
+		updates = append(updates, update)
+	}
+	return updates, rows.Err()
+}
+
+// RecordGitHubDeployment records the GitHub deployment created for a deployment
+func (r *Repository) RecordGitHubDeployment(deploymentID uuid.UUID, githubDeploymentID int64) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.github_deployments (deployment_id, github_deployment_id)
+		VALUES ($1, $2)
+		ON CONFLICT (deployment_id) DO UPDATE SET github_deployment_id = EXCLUDED.github_deployment_id, updated_at = NOW()
+	`, deploymentID, githubDeploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to record GitHub deployment: %w", err)
+	}
+	return nil
+}
+
+// CompleteGitHubDeploymentUpdate records that a status of a deployment was reported to GitHub
+func (r *Repository) CompleteGitHubDeploymentUpdate(deploymentID uuid.UUID, status models.DeploymentStatus) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.github_deployments (deployment_id, reported_status)
+		VALUES ($1, $2)
+		ON CONFLICT (deployment_id) DO UPDATE
+		SET reported_status = EXCLUDED.reported_status, attempted_status = NULL, attempts = 0,
+		    last_error = NULL, updated_at = NOW()
+	`, deploymentID, status)
+	if err != nil {
+		return fmt.Errorf("failed to complete GitHub deployment update: %w", err)
+	}
+	return nil
+}
+
+// FailGitHubDeploymentUpdate records why a status of a deployment could not be reported to GitHub.
+// With retry unset the status is given up on right away.
+func (r *Repository) FailGitHubDeploymentUpdate(deploymentID uuid.UUID, status models.DeploymentStatus, message string, retry bool, maxAttempts int) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.github_deployments (deployment_id, attempted_status, attempts, last_error)
+		VALUES ($1, $2, CASE WHEN $4::boolean THEN 1 ELSE $5 END, $3)
+		ON CONFLICT (deployment_id) DO UPDATE
+		SET attempted_status = EXCLUDED.attempted_status,
+		    attempts = CASE
+		        WHEN NOT $4::boolean THEN $5
+		        WHEN deploy_knot.github_deployments.attempted_status IS NOT DISTINCT FROM EXCLUDED.attempted_status
+		            THEN deploy_knot.github_deployments.attempts + 1
+		        ELSE 1
+		    END,
+		    last_error = EXCLUDED.last_error, updated_at = NOW()
+	`, deploymentID, status, message, retry, maxAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to record GitHub deployment update error: %w", err)
+	}
+	return nil
+}
+
+// GetLastCompletedCommit returns the latest completed deployment of a commit to an environment of
+// a project from the same repository, created before the given time, and its commit; nil when
+// there is none. Deployments without a project are grouped by their repository.
+func (r *Repository) GetLastCompletedCommit(project, environment, repoURL string, before time.Time) (*uuid.UUID, string, error) {
+	var id uuid.UUID
+	var sha string
+	err := r.db.QueryRow(`
+		SELECT id, commit_sha
+		FROM deploy_knot.deployments
+		WHERE COALESCE(NULLIF(project_name, ''), github_repo_url) = $1
+		  AND COALESCE(deployment_name, '') = $2
+		  AND github_repo_url = $3
+		  AND status = 'completed'
+		  AND commit_sha IS NOT NULL
+		  AND created_at < $4
+		ORDER BY completed_at DESC
+		LIMIT 1
+	`, project, environment, repoURL, before).Scan(&id, &sha)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get last completed commit: %w", err)
+	}
+	return &id, sha, nil
+}
+
+// CreateDeploymentChangelog stores the changelog of a deployment
+func (r *Repository) CreateDeploymentChangelog(changelog *models.DeploymentChangelog) error {
+	commitsJSON, err := json.Marshal(changelog.Commits)
+	if err != nil {
+		return fmt.Errorf("failed to marshal changelog commits: %w", err)
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO deploy_knot.deployment_changelogs (deployment_id, base_deployment_id, base_commit_sha,
+			head_commit_sha, commits, total_commits, compare_url, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (deployment_id) DO NOTHING
+	`, changelog.DeploymentID, changelog.BaseDeploymentID, changelog.BaseCommitSHA, changelog.HeadCommitSHA,
+		string(commitsJSON), changelog.TotalCommits, changelog.CompareURL, changelog.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment changelog: %w", err)
+	}
+	return nil
+}
+
+// GetDeploymentChangelog returns the changelog of a deployment, or nil when it has none
+func (r *Repository) GetDeploymentChangelog(deploymentID uuid.UUID) (*models.DeploymentChangelog, error) {
+	changelog := &models.DeploymentChangelog{}
+	var commitsJSON []byte
+	err := r.db.QueryRow(`
+		SELECT deployment_id, base_deployment_id, base_commit_sha, head_commit_sha, commits,
+		       total_commits, compare_url, created_at
+		FROM deploy_knot.deployment_changelogs
+		WHERE deployment_id = $1
+	`, deploymentID).Scan(&changelog.DeploymentID, &changelog.BaseDeploymentID, &changelog.BaseCommitSHA,
+		&changelog.HeadCommitSHA, &commitsJSON, &changelog.TotalCommits, &changelog.CompareURL, &changelog.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment changelog: %w", err)
+	}
+	if err := json.Unmarshal(commitsJSON, &changelog.Commits); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal changelog commits: %w", err)
+	}
+	return changelog, nil
+}
+
+// sshCAKeyColumns are the columns scanned by scanSSHCAKey
+const sshCAKeyColumns = `id, name, public_key, private_key_encrypted, fingerprint, status, created_by, created_at, activated_at`
+
+// scanSSHCAKey scans a row selected with sshCAKeyColumns
+func scanSSHCAKey(row interface{ Scan(...interface{}) error }) (*models.SSHCAKey, error) {
+	key := &models.SSHCAKey{}
+	if err := row.Scan(&key.ID, &key.Name, &key.PublicKey, &key.PrivateKeyEncrypted, &key.Fingerprint, &key.Status,
+		&key.CreatedBy, &key.CreatedAt, &key.ActivatedAt); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CreateSSHCAKey stores a new key of the SSH certificate authority; it returns false when the name
+// is taken
+func (r *Repository) CreateSSHCAKey(key *models.SSHCAKey) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO deploy_knot.ssh_ca_keys (id, name, public_key, private_key_encrypted, fingerprint, status, created_by, created_at, activated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (name) DO NOTHING
+	`, key.ID, key.Name, key.PublicKey, key.PrivateKeyEncrypted, key.Fingerprint, key.Status, key.CreatedBy, key.CreatedAt, key.ActivatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create SSH CA key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ListSSHCAKeys retrieves every key of the SSH certificate authority, newest first
+func (r *Repository) ListSSHCAKeys() ([]*models.SSHCAKey, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + sshCAKeyColumns + `
+		FROM deploy_knot.ssh_ca_keys
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSH CA keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.SSHCAKey{}
+	for rows.Next() {
+		key, err := scanSSHCAKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan SSH CA key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetSSHCAKey retrieves a key of the SSH certificate authority; it returns nil when there is none
+func (r *Repository) GetSSHCAKey(id uuid.UUID) (*models.SSHCAKey, error) {
+	key, err := scanSSHCAKey(r.db.QueryRow(`
+		SELECT `+sshCAKeyColumns+`
+		FROM deploy_knot.ssh_ca_keys
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get SSH CA key: %w", err)
+	}
+	return key, nil
+}
+
+// GetActiveSSHCAKey retrieves the key of the SSH certificate authority that signs certificates; it
+// returns nil when there is none
+func (r *Repository) GetActiveSSHCAKey() (*models.SSHCAKey, error) {
+	key, err := scanSSHCAKey(r.db.QueryRow(`
+		SELECT ` + sshCAKeyColumns + `
+		FROM deploy_knot.ssh_ca_keys
+		WHERE status = 'active'
+	`))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get active SSH CA key: %w", err)
+	}
+	return key, nil
+}
+
+// ActivateSSHCAKey makes a key of the SSH certificate authority the one signing certificates and
+// moves the previously active key to retiring; it returns false when the key does not exist
+func (r *Repository) ActivateSSHCAKey(id uuid.UUID) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE deploy_knot.ssh_ca_keys
+		SET status = 'retiring'
+		WHERE status = 'active' AND id <> $1
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to retire SSH CA key: %w", err)
+	}
+	result, err := tx.Exec(`
+		UPDATE deploy_knot.ssh_ca_keys
+		SET status = 'active', activated_at = CASE WHEN status = 'active' THEN activated_at ELSE NOW() END
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to activate SSH CA key: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteSSHCAKey deletes a key of the SSH certificate authority that is not active; it reports
+// whether one was deleted
+func (r *Repository) DeleteSSHCAKey(id uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.ssh_ca_keys WHERE id = $1 AND status <> 'active'`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete SSH CA key: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+const managedServiceColumns = `id, user_id, name, engine, version, target_ip, port, database_name, username,
+	password_encrypted, volume, backup_schedule, backup_retention, next_backup_at, deployment_id, created_at, updated_at`
+
+// scanManagedService scans a row selected with managedServiceColumns
+func scanManagedService(row interface{ Scan(...interface{}) error }) (*models.ManagedService, error) {
+	service := &models.ManagedService{}
+	var database, username sql.NullString
+	err := row.Scan(&service.ID, &service.UserID, &service.Name, &service.Engine, &service.Version, &service.TargetIP,
+		&service.Port, &database, &username, &service.PasswordEncrypted, &service.Volume, &service.BackupSchedule,
+		&service.BackupRetention, &service.NextBackupAt, &service.DeploymentID, &service.CreatedAt, &service.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	service.Database, service.Username = database.String, username.String
+	return service, nil
+}
+
+// CreateManagedService stores a new managed service
+func (r *Repository) CreateManagedService(service *models.ManagedService) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.managed_services (`+managedServiceColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`, service.ID, service.UserID, service.Name, service.Engine, service.Version, service.TargetIP, service.Port,
+		nullIfEmpty(service.Database), nullIfEmpty(service.Username), service.PasswordEncrypted, service.Volume,
+		service.BackupSchedule, service.BackupRetention, service.NextBackupAt, service.DeploymentID, service.CreatedAt,
+		service.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create managed service: %w", err)
+	}
+	return nil
+}
+
+// GetManagedService retrieves a managed service; it returns nil when it does not exist
+func (r *Repository) GetManagedService(id uuid.UUID) (*models.ManagedService, error) {
+	service, err := scanManagedService(r.db.QueryRow(`
+		SELECT `+managedServiceColumns+`
+		FROM deploy_knot.managed_services
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get managed service: %w", err)
+	}
+	return service, nil
+}
+
+// GetManagedServiceByName retrieves userID's managed service with the given name on a target; it
+// returns nil when there is none
+func (r *Repository) GetManagedServiceByName(userID uuid.UUID, targetIP, name string) (*models.ManagedService, error) {
+	service, err := scanManagedService(r.db.QueryRow(`
+		SELECT `+managedServiceColumns+`
+		FROM deploy_knot.managed_services
+		WHERE user_id = $1 AND target_ip = $2 AND name = $3
+	`, userID, targetIP, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get managed service: %w", err)
+	}
+	return service, nil
+}
+
+// ListManagedServices returns managed services ordered by target and name, only userID's when it
+// is set
+func (r *Repository) ListManagedServices(userID *uuid.UUID) ([]*models.ManagedService, error) {
+	rows, err := r.db.Query(`
+		SELECT `+managedServiceColumns+`
+		FROM deploy_knot.managed_services
+		WHERE ($1::uuid IS NULL OR user_id = $1)
+		ORDER BY target_ip, name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list managed services: %w", err)
+	}
+	defer rows.Close()
+
+	var services []*models.ManagedService
+	for rows.Next() {
+		service, err := scanManagedService(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan managed service: %w", err)
+		}
+		services = append(services, service)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating managed services: %w", err)
+	}
+	return services, nil
+}
+
+// UpdateManagedService replaces the version, port and backup configuration of a managed service.
+// It reports whether the service was updated.
+func (r *Repository) UpdateManagedService(service *models.ManagedService) (bool, error) {
+	err := r.db.QueryRow(`
+		UPDATE deploy_knot.managed_services
+		SET version = $2, port = $3, backup_schedule = $4, backup_retention = $5, next_backup_at = $6
+		WHERE id = $1
+		RETURNING updated_at
+	`, service.ID, service.Version, service.Port, service.BackupSchedule, service.BackupRetention,
+		service.NextBackupAt).Scan(&service.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to update managed service: %w", err)
+	}
+	return true, nil
+}
+
+// SetManagedServiceDeployment records the latest deployment of a managed service
+func (r *Repository) SetManagedServiceDeployment(id, deploymentID uuid.UUID) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.managed_services
+		SET deployment_id = $2
+		WHERE id = $1
+	`, id, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to record managed service deployment: %w", err)
+	}
+	return nil
+}
+
+// DeleteManagedService deletes a managed service; it reports whether one was deleted
+func (r *Repository) DeleteManagedService(id uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.managed_services WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete managed service: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetDueManagedServiceBackups returns up to limit managed services whose scheduled backup is due
+// at now, the longest overdue first
+func (r *Repository) GetDueManagedServiceBackups(now time.Time, limit int) ([]*models.ManagedService, error) {
+	rows, err := r.db.Query(`
+		SELECT `+managedServiceColumns+`
+		FROM deploy_knot.managed_services
+		WHERE next_backup_at <= $1
+		ORDER BY next_backup_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due managed service backups: %w", err)
+	}
+	defer rows.Close()
+
+	var services []*models.ManagedService
+	for rows.Next() {
+		service, err := scanManagedService(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan managed service: %w", err)
+		}
+		services = append(services, service)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating managed services: %w", err)
+	}
+	return services, nil
+}
+
+// ClaimManagedServiceBackup moves a due backup of a managed service from dueAt to nextBackupAt, so
+// only one server runs it; it reports whether this call claimed the backup
+func (r *Repository) ClaimManagedServiceBackup(id uuid.UUID, dueAt time.Time, nextBackupAt *time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.managed_services
+		SET next_backup_at = $3
+		WHERE id = $1 AND next_backup_at = $2
+	`, id, dueAt, nextBackupAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim managed service backup: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+const volumeBackupColumns = `id, managed_service_id, method, trigger_type, status, object_key, size_bytes, sha256,
+	error_message, created_by, created_at, started_at, completed_at, restore_status, restore_error, restored_at`
+
+// scanVolumeBackup scans a row selected with volumeBackupColumns
+func scanVolumeBackup(row interface{ Scan(...interface{}) error }) (*models.VolumeBackup, error) {
+	backup := &models.VolumeBackup{}
+	err := row.Scan(&backup.ID, &backup.ManagedServiceID, &backup.Method, &backup.Trigger, &backup.Status,
+		&backup.ObjectKey, &backup.SizeBytes, &backup.SHA256, &backup.ErrorMessage, &backup.CreatedBy,
+		&backup.CreatedAt, &backup.StartedAt, &backup.CompletedAt, &backup.RestoreStatus, &backup.RestoreError,
+		&backup.RestoredAt)
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// CreateVolumeBackup stores a new backup record
+func (r *Repository) CreateVolumeBackup(backup *models.VolumeBackup) error {
+	_, err := r.db.Exec(`
+		INSERT INTO deploy_knot.volume_backups (`+volumeBackupColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`, backup.ID, backup.ManagedServiceID, backup.Method, backup.Trigger, backup.Status, backup.ObjectKey,
+		backup.SizeBytes, backup.SHA256, backup.ErrorMessage, backup.CreatedBy, backup.CreatedAt, backup.StartedAt,
+		backup.CompletedAt, backup.RestoreStatus, backup.RestoreError, backup.RestoredAt)
+	if err != nil {
+		return fmt.Errorf("failed to create volume backup: %w", err)
+	}
+	return nil
+}
+
+// GetVolumeBackup retrieves a backup; it returns nil when it does not exist
+func (r *Repository) GetVolumeBackup(id uuid.UUID) (*models.VolumeBackup, error) {
+	backup, err := scanVolumeBackup(r.db.QueryRow(`
+		SELECT `+volumeBackupColumns+`
+		FROM deploy_knot.volume_backups
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get volume backup: %w", err)
+	}
+	return backup, nil
+}
+
+// ListVolumeBackups returns the backups of a managed service, newest first
+func (r *Repository) ListVolumeBackups(managedServiceID uuid.UUID) ([]*models.VolumeBackup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+volumeBackupColumns+`
+		FROM deploy_knot.volume_backups
+		WHERE managed_service_id = $1
+		ORDER BY created_at DESC
+	`, managedServiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume backups: %w", err)
+	}
+	defer rows.Close()
+
+	var backups []*models.VolumeBackup
+	for rows.Next() {
+		backup, err := scanVolumeBackup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan volume backup: %w", err)
+		}
+		backups = append(backups, backup)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating volume backups: %w", err)
+	}
+	return backups, nil
+}
+
+// UpdateVolumeBackup records the progress of a backup: its status, size, checksum, error and when
+// it started and completed
+func (r *Repository) UpdateVolumeBackup(backup *models.VolumeBackup) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.volume_backups
+		SET status = $2, size_bytes = $3, sha256 = $4, error_message = $5, started_at = $6, completed_at = $7
+		WHERE id = $1
+	`, backup.ID, backup.Status, backup.SizeBytes, backup.SHA256, backup.ErrorMessage, backup.StartedAt,
+		backup.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update volume backup: %w", err)
+	}
+	return nil
+}
+
+// UpdateVolumeBackupRestore records the progress of the latest restore of a backup
+func (r *Repository) UpdateVolumeBackupRestore(backup *models.VolumeBackup) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.volume_backups
+		SET restore_status = $2, restore_error = $3, restored_at = $4
+		WHERE id = $1
+	`, backup.ID, backup.RestoreStatus, backup.RestoreError, backup.RestoredAt)
+	if err != nil {
+		return fmt.Errorf("failed to update volume backup restore: %w", err)
+	}
+	return nil
+}
+
+// FailStaleVolumeBackups fails backups and restores that started before the given time and never
+// finished, because the server running them stopped; it returns how many it failed
+func (r *Repository) FailStaleVolumeBackups(before time.Time, message string) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE deploy_knot.volume_backups
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE status IN ('pending', 'running') AND created_at < $1
+	`, before, message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale volume backups: %w", err)
+	}
+	failed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = r.db.Exec(`
+		UPDATE deploy_knot.volume_backups
+		SET restore_status = 'failed', restore_error = $2
+		WHERE restore_status = 'running' AND restored_at < $1
+	`, before, message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale volume backup restores: %w", err)
+	}
+	restores, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return failed + restores, nil
+}
+
+// DeleteVolumeBackup deletes a backup record; it reports whether one was deleted
+func (r *Repository) DeleteVolumeBackup(id uuid.UUID) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM deploy_knot.volume_backups WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete volume backup: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetActiveCronDeployments returns the cron deployments whose job is installed on their target: the
+// latest completed cron deployment of each container on a target, unless its job was removed.
+// Deployments with one-time credentials are left out, since their target cannot be reached again.
+func (r *Repository) GetActiveCronDeployments() ([]*models.Deployment, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + deploymentListColumns + `
+		FROM deploy_knot.deployments
+		WHERE deployment_type = 'cron' AND status = 'completed' AND cron_removed_at IS NULL
+		  AND one_time_credentials = FALSE
+		  AND NOT EXISTS (
+		      SELECT 1 FROM deploy_knot.deployments newer
+		      WHERE newer.deployment_type = 'cron' AND newer.status = 'completed'
+		        AND newer.target_ip = deployments.target_ip
+		        AND newer.container_name = deployments.container_name
+		        AND newer.completed_at > deployments.completed_at
+		  )
+		ORDER BY completed_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active cron deployments: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanDeployments(rows)
+}
+
+// GetLatestCronDeployment returns the latest completed cron deployment of a container on a target,
+// the one whose job the crontab entry runs; uuid.Nil when there is none
+func (r *Repository) GetLatestCronDeployment(targetIP, containerName string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRow(`
+		SELECT id FROM deploy_knot.deployments
+		WHERE deployment_type = 'cron' AND status = 'completed'
+		  AND target_ip = $1 AND container_name = $2
+		ORDER BY completed_at DESC
+		LIMIT 1
+	`, targetIP, containerName).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get latest cron deployment: %w", err)
+	}
+	return id, nil
+}
+
+// MarkCronJobRemoved records that the crontab entry of a cron deployment was removed
+func (r *Repository) MarkCronJobRemoved(deploymentID uuid.UUID, removedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE deploy_knot.deployments SET cron_removed_at = $2 WHERE id = $1
+	`, deploymentID, removedAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark cron job removed: %w", err)
+	}
+	return nil
+}
+
+// GetLatestCronJobRunStart returns when the latest collected run of a cron deployment started, or
+// nil when none was collected yet
+func (r *Repository) GetLatestCronJobRunStart(deploymentID uuid.UUID) (*time.Time, error) {
+	var startedAt time.Time
+	err := r.db.QueryRow(`
+		SELECT started_at FROM deploy_knot.cron_job_runs
+		WHERE deployment_id = $1
+		ORDER BY started_at DESC
+		LIMIT 1
+	`, deploymentID).Scan(&startedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest cron job run: %w", err)
+	}
+	return &startedAt, nil
+}
+
+// CreateCronJobRun stores a collected run of a cron job. A run that was collected before is left
+// as is; it reports whether the run was stored.
+func (r *Repository) CreateCronJobRun(run *models.CronJobRun) (bool, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO deploy_knot.cron_job_runs (
+			id, deployment_id, started_at, finished_at, exit_code, output, output_truncated, collected_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (deployment_id, started_at) DO NOTHING
+	`, run.ID, run.DeploymentID, run.StartedAt, run.FinishedAt, run.ExitCode, run.Output, run.OutputTruncated, run.CollectedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create cron job run: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// GetCronJobRuns returns the latest limit collected runs of a cron deployment, newest first
+func (r *Repository) GetCronJobRuns(deploymentID uuid.UUID, limit int) ([]*models.CronJobRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, deployment_id, started_at, finished_at, exit_code, output, output_truncated, collected_at
+		FROM deploy_knot.cron_job_runs
+		WHERE deployment_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, deploymentID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cron job runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*models.CronJobRun
+	for rows.Next() {
+		run := &models.CronJobRun{}
+		if err := rows.Scan(&run.ID, &run.DeploymentID, &run.StartedAt, &run.FinishedAt, &run.ExitCode, &run.Output, &run.OutputTruncated, &run.CollectedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan cron job run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cron job runs: %w", err)
+	}
+	return runs, nil
 }
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRetryBackoff caps the delay between connection attempts
+const maxRetryBackoff = 30 * time.Second
+
+// WithRetry calls connect until it succeeds or attempts are exhausted, doubling the backoff between attempts
+func WithRetry(name string, attempts int, backoff time.Duration, logger *logrus.Logger, connect func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = connect(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		logger.WithError(err).WithFields(logrus.Fields{
+			"attempt":  attempt,
+			"retry_in": backoff,
+		}).Warnf("Failed to connect to %s, retrying", name)
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+	return fmt.Errorf("failed to connect to %s after %d attempts: %w", name, attempts, err)
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// organizationSetting is the session setting the row-level security policies filter on
+const organizationSetting = "deploy_knot.organization_id"
+
+type organizationContextKey struct{}
+
+// ContextWithOrganization marks ctx as acting on behalf of an organization with row-level isolation
+func ContextWithOrganization(ctx context.Context, organizationID uuid.UUID) context.Context {
+	return context.WithValue(ctx, organizationContextKey{}, organizationID)
+}
+
+// OrganizationFromContext returns the isolated organization ctx acts on behalf of, if any
+func OrganizationFromContext(ctx context.Context) (uuid.UUID, bool) {
+	organizationID, ok := ctx.Value(organizationContextKey{}).(uuid.UUID)
+	return organizationID, ok
+}
+
+// scopedConn runs every statement on a single connection whose session is scoped to an organization
+type scopedConn struct {
+	ctx  context.Context
+	conn *sql.Conn
+}
+
+func (c *scopedConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(c.ctx, query, args...)
+}
+
+func (c *scopedConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(c.ctx, query, args...)
+}
+
+func (c *scopedConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c *scopedConn) Begin() (*sql.Tx, error) {
+	return c.conn.BeginTx(c.ctx, nil)
+}
+
+// ForOrganization returns a repository whose queries only see the given organization's deployments,
+// steps and logs, enforced by PostgreSQL row-level security. The returned release function must be
+// called once the repository is no longer used; it returns the connection to the pool.
+func (r *Repository) ForOrganization(ctx context.Context, organizationID uuid.UUID) (*Repository, func(), error) {
+	if r.sqlite {
+		return nil, nil, fmt.Errorf("row-level security is not supported with SQLite")
+	}
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return nil, nil, fmt.Errorf("repository is already scoped to an organization")
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT set_config($1, $2, false)`, organizationSetting, organizationID.String()); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to scope connection to organization: %w", err)
+	}
+
+	release := func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT set_config($1, '', false)`, organizationSetting); err != nil {
+			// Never hand a scoped session back to the pool
+			r.logger.WithError(err).Error("Failed to reset organization scope, discarding connection")
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	return &Repository{db: &scopedConn{ctx: ctx, conn: conn}, logger: r.logger}, release, nil
+}
+
+// Scoped returns a repository scoped to the isolated organization in ctx, or r itself when ctx
+// carries none. The release function must always be called.
+func (r *Repository) Scoped(ctx context.Context) (*Repository, func(), error) {
+	organizationID, ok := OrganizationFromContext(ctx)
+	if !ok {
+		return r, func() {}, nil
+	}
+	return r.ForOrganization(ctx, organizationID)
+}
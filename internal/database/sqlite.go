@@ -0,0 +1,728 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// sqliteURLPrefix marks database URLs of SQLite databases, followed by the path of the database file
+const sqliteURLPrefix = "sqlite:"
+
+// sqliteDriverName is the database/sql driver SQLite databases are opened with. It runs the
+// repository's PostgreSQL queries on SQLite by translating them, see translateQuery.
+const sqliteDriverName = "deployknot-sqlite"
+
+// sqliteTimeFormat is how timestamps are stored: in UTC with a fixed number of digits, so they
+// compare in time order as text
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// sqliteNow is PostgreSQL's NOW() in sqliteTimeFormat. SQLite keeps 'now' fixed while a statement
+// runs, so every row and column a statement sets gets the same time; it has millisecond precision.
+const sqliteNow = `strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')`
+
+// sqliteUpdatedAtTables are the tables whose updated_at column PostgreSQL sets with a trigger on
+// every update. SQLite triggers run after RETURNING is evaluated, so updates of these tables set
+// the column themselves.
+var sqliteUpdatedAtTables = map[string]bool{
+	"deployments":          true,
+	"projects":             true,
+	"deployment_templates": true,
+	"organizations":        true,
+	"project_targets":      true,
+	"saved_views":          true,
+	"deployment_schedules": true,
+	"applications":         true,
+	"managed_services":     true,
+}
+
+// sqliteFragments replace the parts of queries that have no direct SQLite counterpart, such as
+// LATERAL joins and DISTINCT ON, before the rest of a query is translated. Both sides are compared
+// with their whitespace collapsed.
+var sqliteFragments = []struct{ postgres, sqlite string }{
+	{
+		postgres: `LEFT JOIN LATERAL (
+			SELECT step_name, error_message
+			FROM deploy_knot.deployment_steps
+			WHERE deployment_id = d.id AND status = 'failed'
+			ORDER BY started_at IS NULL, completed_at, step_order
+			LIMIT 1
+		) s ON TRUE`,
+		sqlite: `LEFT JOIN deploy_knot.deployment_steps s ON s.id = (
+			SELECT id
+			FROM deploy_knot.deployment_steps
+			WHERE deployment_id = d.id AND status = 'failed'
+			ORDER BY started_at IS NULL, completed_at, step_order
+			LIMIT 1
+		)`,
+	},
+	{
+		postgres: `SELECT DISTINCT ON (environment) environment, status, github_branch, commit_sha, updated_at
+			FROM project_deployments
+			ORDER BY environment, created_at DESC`,
+		sqlite: `SELECT environment, status, github_branch, commit_sha, updated_at
+			FROM (
+				SELECT *, ROW_NUMBER() OVER (PARTITION BY environment ORDER BY created_at DESC) AS position
+				FROM project_deployments
+			)
+			WHERE position = 1`,
+	},
+	{
+		postgres: `deployed.commit_sha, deployed.updated_at
+		FROM latest
+		LEFT JOIN LATERAL (
+			SELECT commit_sha, updated_at
+			FROM project_deployments
+			WHERE environment = latest.environment AND status = 'completed'
+			ORDER BY created_at DESC
+			LIMIT 1
+		) deployed ON true`,
+		sqlite: `deployed.commit_sha, deployed.updated_at
+		FROM latest
+		LEFT JOIN (
+			SELECT environment, commit_sha, updated_at,
+			       ROW_NUMBER() OVER (PARTITION BY environment ORDER BY created_at DESC) AS position
+			FROM project_deployments
+			WHERE status = 'completed'
+		) deployed ON deployed.environment = latest.environment AND deployed.position = 1`,
+	},
+	{
+		// SQLite requires AS before the alias of the updated table
+		postgres: `UPDATE deploy_knot.deployment_incidents i
+		SET status = 'resolved'`,
+		sqlite: `UPDATE deploy_knot.deployment_incidents AS i
+		SET status = 'resolved'`,
+	},
+	{
+		postgres: `SELECT DISTINCT ON (i2.id) i2.id AS incident_id, d.id`,
+		sqlite: `SELECT incident_id, id FROM (
+			SELECT i2.id AS incident_id, d.id, ROW_NUMBER() OVER (PARTITION BY i2.id ORDER BY d.completed_at) AS position`,
+	},
+	{
+		postgres: `WHERE i2.status = 'triggered'
+		    ORDER BY i2.id, d.completed_at
+		) fixed`,
+		sqlite: `WHERE i2.status = 'triggered'
+		    ) WHERE position = 1
+		) fixed`,
+	},
+	{
+		// Whether the upsert inserted the row: both timestamps default to the same time
+		postgres: `(xmax = 0)`,
+		sqlite:   `(created_at = updated_at)`,
+	},
+	{
+		// json_patch merges recursively where jsonb's || merges the top level only
+		postgres: `COALESCE(output, '{}'::jsonb) || $3::jsonb`,
+		sqlite:   `json_patch(COALESCE(output, '{}'), $3)`,
+	},
+	{
+		// ->> returns JSON true as 1 in SQLite, -> as the JSON text
+		postgres: `output->>'rolled_back' = 'true'`,
+		sqlite:   `output->'rolled_back' = 'true'`,
+	},
+	{
+		postgres: `NOW() - INTERVAL '1 minute'`,
+		sqlite:   `strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now', '-1 minute')`,
+	},
+	{
+		postgres: `$1::timestamptz - make_interval(mins => e.after_minutes)`,
+		sqlite:   `strftime('%Y-%m-%dT%H:%M:%f000000Z', $1, '-' || e.after_minutes || ' minutes')`,
+	},
+	{
+		postgres: `date_trunc('day', d.created_at)::date`,
+		sqlite:   `strftime('%Y-%m-%dT00:00:00.000000000Z', d.created_at)`,
+	},
+	{
+		// An INSERT ... SELECT needs a WHERE clause before ON CONFLICT to be parsed unambiguously
+		postgres: `FROM deploy_knot.deployment_logs ON CONFLICT (sink) DO NOTHING`,
+		sqlite:   `FROM deploy_knot.deployment_logs WHERE true ON CONFLICT (sink) DO NOTHING`,
+	},
+}
+
+var (
+	sqliteAnyPattern         = regexp.MustCompile(`= ANY\(([^()]+)\)`)
+	sqliteCastPattern        = regexp.MustCompile(`::(\w+)(\[\])?`)
+	sqliteUpdatePattern      = regexp.MustCompile(`^UPDATE (\w+)(?: (?:AS )?\w+)? SET `)
+	sqliteUpsertPattern      = regexp.MustCompile(`^INSERT INTO (\w+) .* DO UPDATE SET `)
+	sqliteUnsupportedPattern = regexp.MustCompile(`(?i)\b(LATERAL|DISTINCT ON|xmax|make_interval|date_trunc|INTERVAL)\b`)
+
+	// sqliteNumericCasts are the casts of a parenthesized expression that convert its value
+	sqliteNumericCasts = map[string]string{"int": "INTEGER", "integer": "INTEGER", "bigint": "INTEGER", "float8": "REAL", "numeric": "REAL"}
+
+	// sqliteBaseDriver is the driver of the SQLite package, which the functions below are registered with
+	sqliteBaseDriver driver.Driver
+
+	// sqliteQueries caches the translations of queries; the repository's queries are constants
+	sqliteQueries sync.Map
+	// sqliteRegexps caches the compiled patterns of regexp_replace
+	sqliteRegexps sync.Map
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &sqliteDriver{})
+	// Opening a handle does not connect
+	db, _ := sql.Open("sqlite", "")
+	sqliteBaseDriver = db.Driver()
+	db.Close()
+
+	for i := range sqliteFragments {
+		sqliteFragments[i].postgres = normalizeSQL(sqliteFragments[i].postgres)
+		sqliteFragments[i].sqlite = normalizeSQL(sqliteFragments[i].sqlite)
+	}
+
+	// The PostgreSQL functions the schema and queries use
+	sqlite.MustRegisterScalarFunction("gen_random_uuid", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.New().String(), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("cardinality", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		var elements pq.StringArray
+		if err := elements.Scan(args[0]); err != nil {
+			return nil, err
+		}
+		return int64(len(elements)), nil
+	})
+	// regexp_replace replaces the first match, like PostgreSQL's without flags; the replacement is
+	// inserted as is
+	sqlite.MustRegisterDeterministicScalarFunction("regexp_replace", 3, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		if args[0] == nil || args[1] == nil || args[2] == nil {
+			return nil, nil
+		}
+		source, pattern, replacement := sqliteText(args[0]), sqliteText(args[1]), sqliteText(args[2])
+		compiled, ok := sqliteRegexps.Load(pattern)
+		if !ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			compiled, _ = sqliteRegexps.LoadOrStore(pattern, re)
+		}
+		match := compiled.(*regexp.Regexp).FindStringIndex(source)
+		if match == nil {
+			return source, nil
+		}
+		return source[:match[0]] + replacement + source[match[1]:], nil
+	})
+	// pg_array_json converts an array in the PostgreSQL format to a JSON array, which json_each
+	// reads the elements of
+	sqlite.MustRegisterDeterministicScalarFunction("pg_array_json", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		elements := pq.StringArray{}
+		if args[0] != nil {
+			if err := elements.Scan(args[0]); err != nil {
+				return nil, err
+			}
+		}
+		encoded, err := json.Marshal([]string(elements))
+		if err != nil {
+			return nil, err
+		}
+		return string(encoded), nil
+	})
+}
+
+// sqliteText returns a text or blob argument of a SQL function as a string
+func sqliteText(value driver.Value) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sqliteDataSource returns the data source name of the SQLite database file at path. Foreign keys
+// are enforced like in PostgreSQL, and transactions take the write lock when they begin: SQLite
+// has a single writer, and a transaction that reads before it writes could not upgrade its lock
+// otherwise.
+func sqliteDataSource(path string) string {
+	return path + "?_pragma=busy_timeout(10000)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// sqliteDriver opens SQLite databases for the repository
+type sqliteDriver struct{}
+
+// sqliteDriverConn lists the interfaces of the connections of the SQLite driver that sqliteConn
+// wraps
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+func (d *sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := sqliteBaseDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, ok := conn.(sqliteDriverConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unsupported SQLite connection %T", conn)
+	}
+	return &sqliteConn{conn: wrapped}, nil
+}
+
+// sqliteConn translates the queries and arguments of the repository for SQLite
+type sqliteConn struct {
+	conn sqliteDriverConn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	translated, err := translateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := c.conn.PrepareContext(ctx, translated)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStmt{stmt: stmt}, nil
+}
+
+func (c *sqliteConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *sqliteConn) Begin() (driver.Tx, error) {
+	return c.conn.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.conn.BeginTx(ctx, opts)
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	translated, err := translateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return c.conn.ExecContext(ctx, translated, args)
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	translated, err := translateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.conn.QueryContext(ctx, translated, args)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteRows(rows), nil
+}
+
+func (c *sqliteConn) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
+
+func (c *sqliteConn) ResetSession(ctx context.Context) error {
+	return c.conn.ResetSession(ctx)
+}
+
+func (c *sqliteConn) IsValid() bool {
+	return c.conn.IsValid()
+}
+
+// CheckNamedValue stores timestamps in sqliteTimeFormat, and byte slices holding text, such as
+// marshalled JSON, as text so SQL functions and comparisons see text. Other byte slices, such as
+// compressed artifacts, are stored as blobs.
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case time.Time:
+		value = v.UTC().Format(sqliteTimeFormat)
+	case []byte:
+		if utf8.Valid(v) {
+			value = string(v)
+		}
+	}
+	nv.Value = value
+	return nil
+}
+
+// sqliteStmt returns the rows of a prepared statement through sqliteRows
+type sqliteStmt struct {
+	stmt driver.Stmt
+}
+
+func (s *sqliteStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *sqliteStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *sqliteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args) //nolint:staticcheck // required by driver.Stmt
+}
+
+func (s *sqliteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.stmt.Query(args) //nolint:staticcheck // required by driver.Stmt
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteRows(rows), nil
+}
+
+func (s *sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+func (s *sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteRows(rows), nil
+}
+
+// sqliteRows returns computed timestamps, such as COALESCE(completed_at, updated_at), as times.
+// The SQLite driver only converts values of columns declared as timestamps.
+type sqliteRows struct {
+	driver.Rows
+	types []string
+}
+
+func newSQLiteRows(rows driver.Rows) *sqliteRows {
+	r := &sqliteRows{Rows: rows, types: make([]string, len(rows.Columns()))}
+	if typed, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		for i := range r.types {
+			r.types[i] = typed.ColumnTypeDatabaseTypeName(i)
+		}
+	}
+	return r
+}
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	for i, value := range dest {
+		text, ok := value.(string)
+		if !ok || r.types[i] != "" || !isSQLiteTimestamp(text) {
+			continue
+		}
+		if t, err := time.Parse(sqliteTimeFormat, text); err == nil {
+			dest[i] = t
+		}
+	}
+	return nil
+}
+
+func (r *sqliteRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.types[index]
+}
+
+// isSQLiteTimestamp reports whether text has the shape of a timestamp in sqliteTimeFormat
+func isSQLiteTimestamp(text string) bool {
+	return len(text) == len(sqliteTimeFormat) && text[4] == '-' && text[10] == 'T' && text[19] == '.' && text[len(text)-1] == 'Z'
+}
+
+// translateQuery translates a PostgreSQL query of the repository to SQLite
+func translateQuery(query string) (string, error) {
+	if translated, ok := sqliteQueries.Load(query); ok {
+		return translated.(string), nil
+	}
+	translated, err := translatePostgres(query)
+	if err != nil {
+		return "", err
+	}
+	sqliteQueries.Store(query, translated)
+	return translated, nil
+}
+
+// translatePostgres rewrites the PostgreSQL specific syntax the repository uses: the schema
+// qualifier, casts, ANY over arrays, EXTRACT(EPOCH FROM ...), IS [NOT] DISTINCT FROM, row locks,
+// GREATEST and NOW(), and the fragments of sqliteFragments. It fails for queries that still use
+// syntax SQLite lacks.
+func translatePostgres(query string) (string, error) {
+	text := normalizeSQL(query)
+	for _, fragment := range sqliteFragments {
+		text = strings.ReplaceAll(text, fragment.postgres, fragment.sqlite)
+	}
+
+	// Rewrite the code only, never the contents of string literals
+	text, literals := extractLiterals(text)
+	if match := sqliteUnsupportedPattern.FindString(text); match != "" {
+		return "", fmt.Errorf("query uses %s, which SQLite does not support: %s", match, query)
+	}
+
+	text = strings.ReplaceAll(text, "deploy_knot.", "")
+	text = strings.ReplaceAll(text, " IS NOT DISTINCT FROM ", " IS ")
+	text = strings.ReplaceAll(text, " IS DISTINCT FROM ", " IS NOT ")
+	text = strings.ReplaceAll(text, " FOR UPDATE SKIP LOCKED", "")
+	text = strings.ReplaceAll(text, " FOR UPDATE", "")
+	// SQLite's max returns NULL when any argument is NULL, where GREATEST ignores NULL arguments
+	text = strings.ReplaceAll(text, "GREATEST(", "max(")
+	text = sqliteAnyPattern.ReplaceAllString(text, "IN (SELECT value FROM json_each(pg_array_json($1)))")
+	text = translateEpochs(text)
+	text = translateCasts(text)
+
+	if match := sqliteUpdatePattern.FindStringSubmatchIndex(text); match != nil && sqliteUpdatedAtTables[text[match[2]:match[3]]] {
+		text = text[:match[1]] + "updated_at = NOW(), " + text[match[1]:]
+	} else if match := sqliteUpsertPattern.FindStringSubmatchIndex(text); match != nil && sqliteUpdatedAtTables[text[match[2]:match[3]]] {
+		text = text[:match[1]] + "updated_at = NOW(), " + text[match[1]:]
+	}
+	text = strings.ReplaceAll(text, "NOW()", sqliteNow)
+	text = strings.ReplaceAll(text, "now()", sqliteNow)
+
+	return restoreLiterals(text, literals), nil
+}
+
+// translateEpochs rewrites EXTRACT(EPOCH FROM (a - b)), the seconds between two timestamps
+func translateEpochs(text string) string {
+	const extract = "EXTRACT(EPOCH FROM ("
+	for {
+		start := strings.Index(text, extract)
+		if start < 0 {
+			return text
+		}
+		open := start + len(extract) - 1
+		end := matchingParen(text, open)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ')' {
+			return text
+		}
+		a, b, ok := splitSubtraction(text[open+1 : end])
+		if !ok {
+			return text
+		}
+		text = text[:start] + "((julianday(" + a + ") - julianday(" + b + ")) * 86400.0)" + text[end+2:]
+	}
+}
+
+// translateCasts removes casts, which SQLite does not need as its values keep their types, except
+// numeric casts of parenthesized expressions, which become CAST
+func translateCasts(text string) string {
+	for {
+		match := sqliteCastPattern.FindStringSubmatchIndex(text)
+		if match == nil {
+			return text
+		}
+		castType, isNumeric := sqliteNumericCasts[text[match[2]:match[3]]]
+		if !isNumeric || match[0] == 0 || text[match[0]-1] != ')' {
+			text = text[:match[0]] + text[match[1]:]
+			continue
+		}
+		open := matchingOpenParen(text, match[0]-1)
+		if open < 0 {
+			text = text[:match[0]] + text[match[1]:]
+			continue
+		}
+		// Include the name of a function call, such as COALESCE(...)
+		for open > 0 && isIdentifierByte(text[open-1]) {
+			open--
+		}
+		text = text[:open] + "CAST(" + text[open:match[0]] + " AS " + castType + ")" + text[match[1]:]
+	}
+}
+
+// matchingParen returns the index of the parenthesis closing the one at open, or -1
+func matchingParen(text string, open int) int {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// matchingOpenParen returns the index of the parenthesis opening the one at close, or -1
+func matchingOpenParen(text string, close int) int {
+	depth := 0
+	for i := close; i >= 0; i-- {
+		switch text[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitSubtraction splits "a - b" at the subtraction outside of parentheses
+func splitSubtraction(text string) (string, string, bool) {
+	depth := 0
+	for i := 0; i+3 <= len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ':
+			if depth == 0 && text[i:i+3] == " - " {
+				return text[:i], text[i+3:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func isIdentifierByte(b byte) bool {
+	return b == '_' || b == '.' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
+
+// normalizeSQL removes comments and collapses whitespace outside of string literals, so queries
+// compare equal however they are indented
+func normalizeSQL(query string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			end := literalEnd(query, i)
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteString(query[i:end])
+			i = end - 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+		default:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// literalEnd returns the index after the string literal starting at start
+func literalEnd(query string, start int) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != '\'' {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == '\'' {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+// extractLiterals replaces the string literals of a normalized query with numbered placeholders
+func extractLiterals(query string) (string, []string) {
+	var b strings.Builder
+	var literals []string
+	for i := 0; i < len(query); i++ {
+		if query[i] != '\'' {
+			b.WriteByte(query[i])
+			continue
+		}
+		end := literalEnd(query, i)
+		fmt.Fprintf(&b, "\x00%d\x00", len(literals))
+		literals = append(literals, query[i:end])
+		i = end - 1
+	}
+	return b.String(), literals
+}
+
+// restoreLiterals puts the string literals extractLiterals took out back in place
+func restoreLiterals(query string, literals []string) string {
+	for i, literal := range literals {
+		query = strings.Replace(query, fmt.Sprintf("\x00%d\x00", i), literal, 1)
+	}
+	return query
+}
+
+// sqliteLocks stand in for the row locks that work calling out of the database holds on
+// PostgreSQL. Only one process uses a SQLite database, so locks within the process suffice.
+var sqliteLocks sync.Map
+
+// calloutTx is the transaction of work that keeps rows locked while it calls out of the database,
+// such as publishing jobs to Redis
+type calloutTx struct {
+	queryHandle
+	tx     *sql.Tx
+	unlock func()
+}
+
+// beginCallout begins a callout transaction. SQLite allows one writer at a time, so a transaction
+// held open during the call would block every other write, including those of the call itself;
+// with SQLite the work runs outside of a transaction instead, and callers of the same lock take
+// turns. It returns false when another caller holds the lock.
+func (r *Repository) beginCallout(lock string) (*calloutTx, bool, error) {
+	if !r.sqlite {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		return &calloutTx{queryHandle: tx, tx: tx}, true, nil
+	}
+
+	value, _ := sqliteLocks.LoadOrStore(lock, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, false, nil
+	}
+	return &calloutTx{queryHandle: r.db, unlock: mu.Unlock}, true, nil
+}
+
+// Commit commits the transaction
+func (t *calloutTx) Commit() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Commit()
+}
+
+// Rollback rolls back the transaction unless it was committed, and releases the lock
+func (t *calloutTx) Rollback() {
+	if t.tx != nil {
+		t.tx.Rollback()
+	}
+	if t.unlock != nil {
+		t.unlock()
+		t.unlock = nil
+	}
+}
@@ -0,0 +1,522 @@
+package dockerapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// apiVersion is the Docker Engine API version used for all requests (Docker 20.10+)
+const apiVersion = "v1.41"
+
+// DialFunc opens a connection to the Docker Engine API socket
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// Client is a minimal Docker Engine API client working over any connection, such as
+// a unix socket forwarded through SSH
+type Client struct {
+	httpClient *http.Client
+}
+
+// APIError represents an error response from the Docker Engine API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker api error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a Docker Engine API 404 response
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Version describes the Docker Engine answering the API
+type Version struct {
+	Version       string `json:"Version"`
+	APIVersion    string `json:"ApiVersion"`
+	Os            string `json:"Os"`
+	Arch          string `json:"Arch"`
+	KernelVersion string `json:"KernelVersion"`
+}
+
+// BuildMessage is a single progress message of an image build
+type BuildMessage struct {
+	Stream string `json:"stream,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Aux    *struct {
+		ID string `json:"ID"`
+	} `json:"aux,omitempty"`
+}
+
+// ContainerConfig describes a container to create
+type ContainerConfig struct {
+	Image string
+	Env   []string
+	Port  int
+	// ContainerPort is the port Port is published to inside the container, Port itself by default
+	ContainerPort int
+	// Cmd replaces the command of the image
+	Cmd []string
+	// Binds mount volumes and host paths, such as "data:/var/lib/postgresql/data"
+	Binds []string
+	// Healthcheck replaces the health check of the image
+	Healthcheck *Healthcheck
+	// AllGPUs passes every GPU of the host to the container, GPUDevices the GPUs of these
+	// indexes or UUIDs
+	AllGPUs    bool
+	GPUDevices []string
+	// Resource limits and runtime options, the equivalents of docker run flags such as --ulimit
+	ExtraHosts     []string
+	Ulimits        []Ulimit
+	ShmSize        int64
+	Memory         int64
+	NanoCPUs       int64
+	PidsLimit      int64
+	Init           bool
+	ReadonlyRootfs bool
+	RestartPolicy  *RestartPolicy
+	// Network is a user-defined network the container joins, where other containers reach it by
+	// the names in NetworkAliases
+	Network        string
+	NetworkAliases []string
+}
+
+// Healthcheck is a command the daemon runs in a container to tell whether it is healthy
+type Healthcheck struct {
+	// Test is the command, e.g. ["CMD-SHELL", "pg_isready"]
+	Test        []string      `json:"Test"`
+	Interval    time.Duration `json:"Interval,omitempty"`
+	Timeout     time.Duration `json:"Timeout,omitempty"`
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+	Retries     int           `json:"Retries,omitempty"`
+}
+
+// Ulimit is a resource limit of a container
+type Ulimit struct {
+	Name string `json:"Name"`
+	Soft int64  `json:"Soft"`
+	Hard int64  `json:"Hard"`
+}
+
+// RestartPolicy tells the daemon when to restart a container
+type RestartPolicy struct {
+	Name              string `json:"Name"`
+	MaximumRetryCount int    `json:"MaximumRetryCount,omitempty"`
+}
+
+// ContainerState is the state section of a container inspection
+type ContainerState struct {
+	Status     string `json:"Status"`
+	Running    bool   `json:"Running"`
+	Restarting bool   `json:"Restarting"`
+	ExitCode   int    `json:"ExitCode"`
+	Error      string `json:"Error"`
+	StartedAt  string `json:"StartedAt"`
+	// Health is only set for containers whose image or run options define a health check
+	Health *ContainerHealth `json:"Health,omitempty"`
+}
+
+// ContainerHealth is the state of a container's health check: "starting", "healthy" or "unhealthy"
+type ContainerHealth struct {
+	Status        string `json:"Status"`
+	FailingStreak int    `json:"FailingStreak"`
+	Log           []struct {
+		ExitCode int    `json:"ExitCode"`
+		Output   string `json:"Output"`
+	} `json:"Log"`
+}
+
+// ContainerInfo is the result of a container inspection
+type ContainerInfo struct {
+	ID    string         `json:"Id"`
+	Name  string         `json:"Name"`
+	Image string         `json:"Image"`
+	State ContainerState `json:"State"`
+}
+
+// NewClient creates a new Docker Engine API client using dial for every connection
+func NewClient(dial DialFunc) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dial(ctx)
+		},
+		MaxIdleConns:    1,
+		IdleConnTimeout: 30 * time.Second,
+	}
+
+	return &Client{
+		httpClient: &http.Client{Transport: transport},
+	}
+}
+
+// Close releases idle connections held by the client
+func (c *Client) Close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// Ping checks the Docker Engine API is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Version returns version information about the Docker Engine
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	var version Version
+	if err := c.doJSON(ctx, http.MethodGet, "/version", nil, nil, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// BuildImage builds an image tagged tag from a tar build context, reporting progress to onMessage.
+// dockerfile is relative to the build context; empty uses the context's Dockerfile.
+func (c *Client) BuildImage(ctx context.Context, tag, dockerfile string, buildContext io.Reader, onMessage func(BuildMessage)) error {
+	query := url.Values{}
+	query.Set("t", tag)
+	if dockerfile != "" {
+		query.Set("dockerfile", dockerfile)
+	}
+	query.Set("rm", "1")
+	query.Set("forcerm", "1")
+
+	resp, err := c.do(ctx, http.MethodPost, "/build", query, buildContext, "application/x-tar")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The build endpoint streams JSON messages; errors are reported in-band
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var msg BuildMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode build output: %w", err)
+		}
+		if onMessage != nil {
+			onMessage(msg)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("build failed: %s", msg.Error)
+		}
+	}
+}
+
+// RemoveImage removes an image; missing images are not an error
+func (c *Client) RemoveImage(ctx context.Context, ref string) error {
+	query := url.Values{}
+	query.Set("force", "1")
+
+	resp, err := c.do(ctx, http.MethodDelete, "/images/"+url.PathEscape(ref), query, nil, "")
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// TagImage tags the image ref as repo:tag, replacing the tag when it exists
+func (c *Client) TagImage(ctx context.Context, ref, repo, tag string) error {
+	query := url.Values{}
+	query.Set("repo", repo)
+	query.Set("tag", tag)
+
+	resp, err := c.do(ctx, http.MethodPost, "/images/"+url.PathEscape(ref)+"/tag", query, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PruneImages removes dangling images
+func (c *Client) PruneImages(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodPost, "/images/prune", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PruneContainers removes stopped containers
+func (c *Client) PruneContainers(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/prune", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// CreateContainer creates a container named name and returns its ID
+func (c *Client) CreateContainer(ctx context.Context, name string, cfg ContainerConfig) (string, error) {
+	query := url.Values{}
+	query.Set("name", name)
+
+	hostConfig := map[string]interface{}{}
+	body := map[string]interface{}{
+		"Image":      cfg.Image,
+		"Env":        cfg.Env,
+		"HostConfig": hostConfig,
+	}
+	if cfg.Port > 0 {
+		containerPort := cfg.ContainerPort
+		if containerPort <= 0 {
+			containerPort = cfg.Port
+		}
+		portKey := strconv.Itoa(containerPort) + "/tcp"
+		body["ExposedPorts"] = map[string]struct{}{portKey: {}}
+		hostConfig["PortBindings"] = map[string][]map[string]string{
+			portKey: {{"HostPort": strconv.Itoa(cfg.Port)}},
+		}
+	}
+	if len(cfg.Cmd) > 0 {
+		body["Cmd"] = cfg.Cmd
+	}
+	if len(cfg.Binds) > 0 {
+		hostConfig["Binds"] = cfg.Binds
+	}
+	if cfg.Healthcheck != nil {
+		body["Healthcheck"] = cfg.Healthcheck
+	}
+	// The equivalent of docker run --gpus
+	if cfg.AllGPUs || len(cfg.GPUDevices) > 0 {
+		request := map[string]interface{}{"Capabilities": [][]string{{"gpu"}}}
+		if cfg.AllGPUs {
+			request["Count"] = -1
+		} else {
+			request["DeviceIDs"] = cfg.GPUDevices
+		}
+		hostConfig["DeviceRequests"] = []map[string]interface{}{request}
+	}
+	if len(cfg.ExtraHosts) > 0 {
+		hostConfig["ExtraHosts"] = cfg.ExtraHosts
+	}
+	if len(cfg.Ulimits) > 0 {
+		hostConfig["Ulimits"] = cfg.Ulimits
+	}
+	if cfg.ShmSize > 0 {
+		hostConfig["ShmSize"] = cfg.ShmSize
+	}
+	if cfg.Memory > 0 {
+		hostConfig["Memory"] = cfg.Memory
+	}
+	if cfg.NanoCPUs > 0 {
+		hostConfig["NanoCpus"] = cfg.NanoCPUs
+	}
+	if cfg.PidsLimit != 0 {
+		hostConfig["PidsLimit"] = cfg.PidsLimit
+	}
+	if cfg.Init {
+		hostConfig["Init"] = true
+	}
+	if cfg.ReadonlyRootfs {
+		hostConfig["ReadonlyRootfs"] = true
+	}
+	if cfg.RestartPolicy != nil {
+		hostConfig["RestartPolicy"] = cfg.RestartPolicy
+	}
+	if cfg.Network != "" {
+		hostConfig["NetworkMode"] = cfg.Network
+		body["NetworkingConfig"] = map[string]interface{}{
+			"EndpointsConfig": map[string]interface{}{
+				cfg.Network: map[string]interface{}{"Aliases": cfg.NetworkAliases},
+			},
+		}
+	}
+
+	var created struct {
+		ID       string   `json:"Id"`
+		Warnings []string `json:"Warnings"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/containers/create", query, body, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// EnsureNetwork creates a bridge network named name unless it exists
+func (c *Client) EnsureNetwork(ctx context.Context, name string) error {
+	err := c.doJSON(ctx, http.MethodGet, "/networks/"+url.PathEscape(name), nil, nil, nil)
+	if err == nil || !IsNotFound(err) {
+		return err
+	}
+	body := map[string]interface{}{
+		"Name":           name,
+		"Driver":         "bridge",
+		"CheckDuplicate": true,
+	}
+	return c.doJSON(ctx, http.MethodPost, "/networks/create", nil, body, nil)
+}
+
+// CreateVolume creates a local volume named name; creating a volume that exists leaves it as it is
+func (c *Client) CreateVolume(ctx context.Context, name string) error {
+	body := map[string]interface{}{
+		"Name":   name,
+		"Driver": "local",
+	}
+	return c.doJSON(ctx, http.MethodPost, "/volumes/create", nil, body, nil)
+}
+
+// StartContainer starts a created container
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// RemoveContainer force-removes a container; missing containers are not an error
+func (c *Client) RemoveContainer(ctx context.Context, name string) error {
+	query := url.Values{}
+	query.Set("force", "1")
+
+	resp, err := c.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(name), query, nil, "")
+	if err != nil {
+		if IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// InspectContainer returns the details of a container
+func (c *Client) InspectContainer(ctx context.Context, name string) (*ContainerInfo, error) {
+	var info ContainerInfo
+	if err := c.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// InspectContainerJSON returns the full details of a container as the API reports them
+func (c *Client) InspectContainerJSON(ctx context.Context, name string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := c.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// InspectImage checks an image exists; a missing image is reported as an APIError with status 404
+func (c *Client) InspectImage(ctx context.Context, ref string) error {
+	return c.doJSON(ctx, http.MethodGet, "/images/"+url.PathEscape(ref)+"/json", nil, nil, nil)
+}
+
+// PullImage pulls an image from its registry; ref may include a tag or digest
+func (c *Client) PullImage(ctx context.Context, ref string) error {
+	query := url.Values{}
+	query.Set("fromImage", ref)
+
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", query, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Like builds, pulls stream JSON progress messages and report errors in-band
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var msg BuildMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode pull output: %w", err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pull failed: %s", msg.Error)
+		}
+	}
+}
+
+// doJSON performs a request with an optional JSON body and decodes the JSON response into out
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+		contentType = "application/json"
+	}
+
+	resp, err := c.do(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// do performs a request and converts error status codes into APIError
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := url.URL{Scheme: "http", Host: "docker", Path: "/" + apiVersion + path}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api request failed: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = string(bytes.TrimSpace(data))
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,703 @@
+package faketarget
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Flags of the docker commands that take no value; every other flag without an = takes the next
+// argument
+var (
+	runBoolFlags    = []string{"-d", "--detach", "--rm", "-i", "--interactive", "-t", "--tty", "-it", "--init", "--privileged", "--read-only"}
+	buildBoolFlags  = []string{"-q", "--quiet", "--no-cache", "--pull"}
+	removeBoolFlags = []string{"-f", "--force", "-v", "--volumes"}
+	psBoolFlags     = []string{"-a", "--all", "-q", "--quiet", "--no-trunc"}
+)
+
+// errDockerFailed is returned by state updates that printed why the command failed
+type errDockerFailed struct{ status int }
+
+func (e errDockerFailed) Error() string { return fmt.Sprintf("docker exited with status %d", e.status) }
+
+// docker simulates the docker CLI commands deployments run, against a Docker daemon whose images
+// and containers only exist in the state of the target
+func (p *program) docker(args []string) int {
+	if len(args) == 0 {
+		return p.fail(1, "Usage:  docker [OPTIONS] COMMAND")
+	}
+	// docker image and docker container commands only look at one kind of object
+	kind := ""
+	if args[0] == "image" || args[0] == "container" {
+		kind, args = args[0], args[1:]
+		if len(args) == 0 {
+			return p.fail(1, "Usage:  docker %s COMMAND", kind)
+		}
+	}
+
+	switch args[0] {
+	case "--version":
+		fmt.Fprintln(p.stdout, "Docker version 27.0.3, build faketarget")
+		return 0
+	case "version":
+		fmt.Fprintln(p.stdout, "27.0.3")
+		return 0
+	case "build":
+		return p.dockerBuild(args[1:])
+	case "pull":
+		return p.dockerPull(args[1:])
+	case "images":
+		return p.dockerImages(args[1:])
+	case "ls":
+		if kind == "image" {
+			return p.dockerImages(args[1:])
+		}
+		return p.dockerPs(args[1:])
+	case "tag":
+		return p.dockerTag(args[1:])
+	case "rmi":
+		return p.dockerRmi(args[1:])
+	case "rm":
+		if kind == "image" {
+			return p.dockerRmi(args[1:])
+		}
+		return p.dockerRm(args[1:])
+	case "run":
+		return p.dockerRun(args[1:])
+	case "stop":
+		return p.dockerStop(args[1:])
+	case "ps":
+		return p.dockerPs(args[1:])
+	case "inspect":
+		return p.dockerInspect(args[1:], kind)
+	case "port":
+		return p.dockerPort(args[1:])
+	case "logs":
+		return p.withContainer(args[len(args)-1], func(*state, int) error { return nil })
+	case "network":
+		return p.dockerCreate(args[1:], "network")
+	case "volume":
+		return p.dockerCreate(args[1:], "volume")
+	case "system":
+		return p.dockerPrune()
+	}
+	return p.fail(1, "docker: '%s' is not a docker command the fake target simulates", args[0])
+}
+
+// update changes the state of the target, returning the status of a command that failed
+func (p *program) update(change func(*state) error) int {
+	err := updateState(p.dir, change)
+	if failed, ok := err.(errDockerFailed); ok {
+		return failed.status
+	}
+	if err != nil {
+		return p.fail(1, "docker: %v", err)
+	}
+	return 0
+}
+
+// failed prints why a command failed from within a state update
+func (p *program) failed(status int, format string, args ...any) error {
+	p.fail(status, format, args...)
+	return errDockerFailed{status}
+}
+
+// normalizeRef adds the latest tag to an image reference without one
+func normalizeRef(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i < 0 || strings.Contains(ref[i:], "/") {
+		return ref + ":latest"
+	}
+	return ref
+}
+
+// findImage returns the index of the image ref names, by tag or ID prefix, or -1
+func findImage(s *state, ref string) int {
+	for i, image := range s.Images {
+		if slices.Contains(image.Tags, normalizeRef(ref)) || strings.HasPrefix(image.ID, ref) ||
+			strings.HasPrefix(strings.TrimPrefix(image.ID, "sha256:"), ref) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findContainer returns the index of the container ref names, by name or ID prefix, or -1
+func findContainer(s *state, ref string) int {
+	for i, container := range s.Containers {
+		if container.Name == strings.TrimPrefix(ref, "/") || len(ref) >= 4 && strings.HasPrefix(container.ID, ref) {
+			return i
+		}
+	}
+	return -1
+}
+
+// untag removes tag from the image that has it
+func untag(s *state, tag string) {
+	for i := range s.Images {
+		s.Images[i].Tags = slices.DeleteFunc(s.Images[i].Tags, func(t string) bool { return t == tag })
+	}
+}
+
+// addImage tags a new image with ref, moving the tag off the image that had it
+func addImage(s *state, ref, dockerfile string) Image {
+	ref = normalizeRef(ref)
+	untag(s, ref)
+	image := Image{ID: "sha256:" + randomID(), Tags: []string{ref}, Dockerfile: dockerfile}
+	s.Images = append(s.Images, image)
+	return image
+}
+
+// randomID returns a random 64 character hex ID
+func randomID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// splitFlags splits docker command arguments into flags with their values and positional
+// arguments. With stopAtPositional, the first positional argument and everything after it, such as
+// the image and command of docker run, are returned as positional arguments.
+func splitFlags(args, boolFlags []string, stopAtPositional bool) (map[string][]string, []string) {
+	flags := map[string][]string{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			if stopAtPositional {
+				return flags, args[i:]
+			}
+			positional = append(positional, arg)
+		case strings.Contains(arg, "="):
+			name, value, _ := strings.Cut(arg, "=")
+			flags[name] = append(flags[name], value)
+		case slices.Contains(boolFlags, arg):
+			flags[arg] = append(flags[arg], "")
+		default:
+			value := ""
+			if i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			flags[arg] = append(flags[arg], value)
+		}
+	}
+	return flags, positional
+}
+
+// dockerBuild builds an image from the Dockerfile of the context. An instruction RUN false fails
+// the build, as it would for real.
+func (p *program) dockerBuild(args []string) int {
+	flags, positional := splitFlags(args, buildBoolFlags, false)
+	if len(positional) != 1 {
+		return p.fail(1, "\"docker build\" requires exactly 1 argument.")
+	}
+	dockerfile := filepath.Join(positional[0], "Dockerfile")
+	if files := flags["-f"]; len(files) > 0 {
+		dockerfile = files[0]
+		if !filepath.IsAbs(dockerfile) {
+			dockerfile = filepath.Join(positional[0], dockerfile)
+		}
+	}
+	content, err := os.ReadFile(dockerfile)
+	if err != nil {
+		return p.fail(1, "ERROR: failed to solve: failed to read dockerfile: open %s: no such file or directory", filepath.Base(dockerfile))
+	}
+
+	var instructions []string
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			instructions = append(instructions, line)
+		}
+	}
+	if len(instructions) == 0 || !strings.HasPrefix(strings.ToUpper(instructions[0]), "FROM ") && !strings.HasPrefix(strings.ToUpper(instructions[0]), "ARG ") {
+		return p.fail(1, "ERROR: failed to solve: dockerfile parse error: no FROM instruction")
+	}
+	for i, instruction := range instructions {
+		fmt.Fprintf(p.stdout, "Step %d/%d : %s\n", i+1, len(instructions), instruction)
+		if strings.EqualFold(instruction, "RUN false") {
+			return p.fail(1, "The command '/bin/sh -c false' returned a non-zero code: 1")
+		}
+	}
+
+	return p.update(func(s *state) error {
+		var image Image
+		for i, tag := range flags["-t"] {
+			if i == 0 {
+				image = addImage(s, tag, string(content))
+				continue
+			}
+			untag(s, normalizeRef(tag))
+			s.Images[len(s.Images)-1].Tags = append(s.Images[len(s.Images)-1].Tags, normalizeRef(tag))
+		}
+		if image.ID == "" {
+			image = addImage(s, "<none>:<none>", string(content))
+		}
+		fmt.Fprintf(p.stdout, "Successfully built %s\n", strings.TrimPrefix(image.ID, "sha256:")[:12])
+		for _, tag := range flags["-t"] {
+			fmt.Fprintf(p.stdout, "Successfully tagged %s\n", normalizeRef(tag))
+		}
+		return nil
+	})
+}
+
+// dockerPull adds an image as if it was pulled from a registry
+func (p *program) dockerPull(args []string) int {
+	_, positional := splitFlags(args, nil, false)
+	if len(positional) != 1 {
+		return p.fail(1, "\"docker pull\" requires exactly 1 argument.")
+	}
+	ref := normalizeRef(positional[0])
+	return p.update(func(s *state) error {
+		if findImage(s, ref) < 0 {
+			addImage(s, ref, "")
+		}
+		fmt.Fprintf(p.stdout, "%s: Pulling from %s\nStatus: Downloaded newer image for %s\n", ref[strings.LastIndex(ref, ":")+1:], ref[:strings.LastIndex(ref, ":")], ref)
+		return nil
+	})
+}
+
+// dockerImages lists the images, or the image given
+func (p *program) dockerImages(args []string) int {
+	flags, positional := splitFlags(args, nil, false)
+	s, err := loadState(p.dir)
+	if err != nil {
+		return p.fail(1, "docker: %v", err)
+	}
+	type row struct{ Repository, Tag, ID string }
+	var rows []any
+	for _, image := range s.Images {
+		for _, tag := range image.Tags {
+			if len(positional) > 0 && tag != normalizeRef(positional[0]) {
+				continue
+			}
+			i := strings.LastIndex(tag, ":")
+			rows = append(rows, row{Repository: tag[:i], Tag: tag[i+1:], ID: strings.TrimPrefix(image.ID, "sha256:")[:12]})
+		}
+	}
+	return p.printRows(flags, "table {{.Repository}}\t{{.Tag}}\t{{.ID}}", rows)
+}
+
+// dockerTag adds a tag to an image
+func (p *program) dockerTag(args []string) int {
+	if len(args) != 2 {
+		return p.fail(1, "\"docker tag\" requires exactly 2 arguments.")
+	}
+	return p.update(func(s *state) error {
+		i := findImage(s, args[0])
+		if i < 0 {
+			return p.failed(1, "Error response from daemon: No such image: %s", normalizeRef(args[0]))
+		}
+		tag := normalizeRef(args[1])
+		untag(s, tag)
+		s.Images[i].Tags = append(s.Images[i].Tags, tag)
+		return nil
+	})
+}
+
+// dockerRmi removes tags, and images left without tags that no container uses
+func (p *program) dockerRmi(args []string) int {
+	_, positional := splitFlags(args, removeBoolFlags, false)
+	return p.update(func(s *state) error {
+		for _, ref := range positional {
+			i := findImage(s, ref)
+			if i < 0 {
+				return p.failed(1, "Error response from daemon: No such image: %s", normalizeRef(ref))
+			}
+			tag := normalizeRef(ref)
+			fmt.Fprintf(p.stdout, "Untagged: %s\n", tag)
+			untag(s, tag)
+			if len(s.Images[i].Tags) == 0 {
+				fmt.Fprintf(p.stdout, "Deleted: %s\n", s.Images[i].ID)
+				s.Images = slices.Delete(s.Images, i, i+1)
+			}
+		}
+		return nil
+	})
+}
+
+// dockerRun creates a container, running it in the background with -d. Without -d the container
+// runs to completion at once; with --rm it is removed afterwards.
+func (p *program) dockerRun(args []string) int {
+	flags, positional := splitFlags(args, runBoolFlags, true)
+	if len(positional) == 0 {
+		return p.fail(1, "\"docker run\" requires at least 1 argument.")
+	}
+	ref := positional[0]
+	_, detach := flags["-d"]
+	_, remove := flags["--rm"]
+
+	var env []string
+	for _, envFile := range flags["--env-file"] {
+		content, err := os.ReadFile(envFile)
+		if err != nil {
+			return p.fail(125, "docker: open %s: no such file or directory.", envFile)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				env = append(env, line)
+			}
+		}
+	}
+	env = append(env, flags["-e"]...)
+	env = append(env, flags["--env"]...)
+	labels := map[string]string{}
+	for _, label := range flags["--label"] {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	network := ""
+	if networks := flags["--network"]; len(networks) > 0 {
+		network = networks[0]
+	}
+	ports := append(flags["-p"], flags["--publish"]...)
+
+	return p.update(func(s *state) error {
+		if findImage(s, ref) < 0 {
+			// docker run pulls images it does not have
+			addImage(s, ref, "")
+		}
+		if network != "" && network != "bridge" && network != "host" && !slices.Contains(s.Networks, network) {
+			return p.failed(125, "docker: Error response from daemon: network %s not found.", network)
+		}
+		name := ""
+		if names := flags["--name"]; len(names) > 0 {
+			name = names[0]
+			if i := findContainer(s, name); i >= 0 {
+				return p.failed(125, "docker: Error response from daemon: Conflict. The container name \"/%s\" is already in use by container \"%s\". You have to remove (or rename) that container to be able to reuse that name.", name, s.Containers[i].ID)
+			}
+		}
+		for _, container := range s.Containers {
+			if !container.Running {
+				continue
+			}
+			for _, port := range ports {
+				if slices.ContainsFunc(container.Ports, func(p string) bool { return hostPort(p) == hostPort(port) }) {
+					return p.failed(125, "docker: Error response from daemon: driver failed programming external connectivity on endpoint %s: Bind for 0.0.0.0:%s failed: port is already allocated.", name, hostPort(port))
+				}
+			}
+		}
+
+		container := Container{
+			ID:      randomID(),
+			Name:    name,
+			Image:   normalizeRef(ref),
+			Running: detach,
+			Ports:   ports,
+			Env:     env,
+			Labels:  labels,
+			Network: network,
+			Args:    args,
+			Created: time.Now().UTC(),
+		}
+		if container.Name == "" {
+			container.Name = "faketarget_" + container.ID[:8]
+		}
+		if detach {
+			fmt.Fprintln(p.stdout, container.ID)
+		}
+		if detach || !remove {
+			s.Containers = append(s.Containers, container)
+		}
+		return nil
+	})
+}
+
+// hostPort returns the host port of a published port, host:container or ip:host:container
+func hostPort(published string) string {
+	parts := strings.Split(published, ":")
+	if len(parts) < 2 {
+		return parts[0]
+	}
+	return parts[len(parts)-2]
+}
+
+// withContainer calls change with the container ref names, failing when there is none
+func (p *program) withContainer(ref string, change func(*state, int) error) int {
+	return p.update(func(s *state) error {
+		i := findContainer(s, ref)
+		if i < 0 {
+			return p.failed(1, "Error response from daemon: No such container: %s", ref)
+		}
+		return change(s, i)
+	})
+}
+
+// dockerStop stops containers
+func (p *program) dockerStop(args []string) int {
+	_, positional := splitFlags(args, nil, false)
+	for _, ref := range positional {
+		status := p.withContainer(ref, func(s *state, i int) error {
+			s.Containers[i].Running = false
+			fmt.Fprintln(p.stdout, ref)
+			return nil
+		})
+		if status != 0 {
+			return status
+		}
+	}
+	return 0
+}
+
+// dockerRm removes containers, which must be stopped unless forced
+func (p *program) dockerRm(args []string) int {
+	flags, positional := splitFlags(args, removeBoolFlags, false)
+	_, force := flags["-f"]
+	if _, ok := flags["--force"]; ok {
+		force = true
+	}
+	for _, ref := range positional {
+		status := p.withContainer(ref, func(s *state, i int) error {
+			if s.Containers[i].Running && !force {
+				return p.failed(1, "Error response from daemon: You cannot remove a running container %s. Stop the container before attempting removal or force remove", s.Containers[i].ID)
+			}
+			s.Containers = slices.Delete(s.Containers, i, i+1)
+			fmt.Fprintln(p.stdout, ref)
+			return nil
+		})
+		if status != 0 {
+			return status
+		}
+	}
+	return 0
+}
+
+// dockerPs lists the running containers, or all with -a, matching the filters
+func (p *program) dockerPs(args []string) int {
+	flags, _ := splitFlags(args, psBoolFlags, false)
+	_, all := flags["-a"]
+	if _, ok := flags["--all"]; ok {
+		all = true
+	}
+	s, err := loadState(p.dir)
+	if err != nil {
+		return p.fail(1, "docker: %v", err)
+	}
+
+	type row struct{ ID, Names, Image, Status string }
+	var rows []any
+	for _, container := range s.Containers {
+		if !container.Running && !all || !matchesFilters(container, flags["--filter"]) {
+			continue
+		}
+		status := "Up " + time.Since(container.Created).Round(time.Second).String()
+		if !container.Running {
+			status = "Exited (0) " + time.Since(container.Created).Round(time.Second).String() + " ago"
+		}
+		rows = append(rows, row{ID: container.ID[:12], Names: container.Name, Image: container.Image, Status: status})
+	}
+	return p.printRows(flags, "table {{.ID}}\t{{.Image}}\t{{.Status}}\t{{.Names}}", rows)
+}
+
+// matchesFilters reports whether a container matches docker ps filters: name matches a substring
+// of its name, id a prefix of its ID, and label a label or label=value
+func matchesFilters(container Container, filters []string) bool {
+	for _, filter := range filters {
+		key, value, _ := strings.Cut(filter, "=")
+		switch key {
+		case "name":
+			if !strings.Contains(container.Name, value) {
+				return false
+			}
+		case "id":
+			if !strings.HasPrefix(container.ID, value) {
+				return false
+			}
+		case "label":
+			name, want, hasValue := strings.Cut(value, "=")
+			got, ok := container.Labels[name]
+			if !ok || hasValue && got != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// printRows prints rows with the --format template, or the default one. A table template prints
+// a header of the upper-cased field names first.
+func (p *program) printRows(flags map[string][]string, defaultFormat string, rows []any) int {
+	format := defaultFormat
+	if formats := flags["--format"]; len(formats) > 0 {
+		format = formats[0]
+	}
+	if body, ok := strings.CutPrefix(format, "table "); ok {
+		format = body
+		header := regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`).ReplaceAllStringFunc(body, func(field string) string {
+			return strings.ToUpper(strings.Trim(field, "{}. "))
+		})
+		fmt.Fprintln(p.stdout, header)
+	}
+	tmpl, err := template.New("format").Funcs(template.FuncMap{"json": toJSON}).Parse(format)
+	if err != nil {
+		return p.fail(1, "template parsing error: %v", err)
+	}
+	for _, row := range rows {
+		if err := tmpl.Execute(p.stdout, row); err != nil {
+			return p.fail(1, "template: %v", err)
+		}
+		fmt.Fprintln(p.stdout)
+	}
+	return 0
+}
+
+// toJSON is the json function of docker format templates
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// inspectedContainer is the part of docker inspect output of a container the simulator fills in
+type inspectedContainer struct {
+	ID      string `json:"Id"`
+	Name    string `json:"Name"`
+	Created string `json:"Created"`
+	Image   string `json:"Image"`
+	State   struct {
+		Status     string `json:"Status"`
+		Running    bool   `json:"Running"`
+		Restarting bool   `json:"Restarting"`
+		ExitCode   int    `json:"ExitCode"`
+		Error      string `json:"Error"`
+		StartedAt  string `json:"StartedAt"`
+	} `json:"State"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+	} `json:"HostConfig"`
+}
+
+// inspectedImage is the part of docker inspect output of an image the simulator fills in
+type inspectedImage struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// dockerInspect prints containers or images as JSON or with the --format template. kind limits
+// the lookup to "container" or "image" objects.
+func (p *program) dockerInspect(args []string, kind string) int {
+	flags, positional := splitFlags(args, nil, false)
+	if len(positional) == 0 {
+		return p.fail(1, "\"docker inspect\" requires at least 1 argument.")
+	}
+	s, err := loadState(p.dir)
+	if err != nil {
+		return p.fail(1, "docker: %v", err)
+	}
+
+	var objects []any
+	for _, ref := range positional {
+		if i := findContainer(s, ref); i >= 0 && kind != "image" {
+			objects = append(objects, inspectContainer(s.Containers[i]))
+			continue
+		}
+		if i := findImage(s, ref); i >= 0 && kind != "container" {
+			objects = append(objects, inspectedImage{ID: s.Images[i].ID, RepoTags: s.Images[i].Tags})
+			continue
+		}
+		fmt.Fprintln(p.stdout, "[]")
+		switch kind {
+		case "image":
+			return p.fail(1, "Error response from daemon: No such image: %s", normalizeRef(ref))
+		case "container":
+			return p.fail(1, "Error response from daemon: No such container: %s", ref)
+		}
+		return p.fail(1, "Error: No such object: %s", ref)
+	}
+
+	if formats := flags["--format"]; len(formats) > 0 || len(flags["-f"]) > 0 {
+		format := append(formats, flags["-f"]...)[0]
+		return p.printRows(map[string][]string{"--format": {format}}, "", objects)
+	}
+	data, err := json.MarshalIndent(objects, "", "    ")
+	if err != nil {
+		return p.fail(1, "docker: %v", err)
+	}
+	fmt.Fprintln(p.stdout, string(data))
+	return 0
+}
+
+// inspectContainer returns the docker inspect output of a container
+func inspectContainer(container Container) inspectedContainer {
+	var inspected inspectedContainer
+	inspected.ID = container.ID
+	inspected.Name = "/" + container.Name
+	inspected.Created = container.Created.Format(time.RFC3339Nano)
+	inspected.Image = container.Image
+	inspected.State.Status = "exited"
+	if container.Running {
+		inspected.State.Status = "running"
+	}
+	inspected.State.Running = container.Running
+	inspected.State.StartedAt = inspected.Created
+	inspected.Config.Image = container.Image
+	inspected.Config.Env = container.Env
+	inspected.Config.Labels = container.Labels
+	inspected.HostConfig.NetworkMode = container.Network
+	if inspected.HostConfig.NetworkMode == "" {
+		inspected.HostConfig.NetworkMode = "bridge"
+	}
+	return inspected
+}
+
+// dockerPort prints the published ports of a container
+func (p *program) dockerPort(args []string) int {
+	if len(args) == 0 {
+		return p.fail(1, "\"docker port\" requires at least 1 argument.")
+	}
+	return p.withContainer(args[0], func(s *state, i int) error {
+		for _, published := range s.Containers[i].Ports {
+			parts := strings.Split(published, ":")
+			fmt.Fprintf(p.stdout, "%s/tcp -> 0.0.0.0:%s\n", parts[len(parts)-1], hostPort(published))
+		}
+		return nil
+	})
+}
+
+// dockerCreate creates a network or volume
+func (p *program) dockerCreate(args []string, kind string) int {
+	_, positional := splitFlags(args, nil, false)
+	if len(positional) != 2 || positional[0] != "create" {
+		return p.fail(1, "docker %s: only create is simulated", kind)
+	}
+	name := positional[1]
+	return p.update(func(s *state) error {
+		if kind == "volume" {
+			if !slices.Contains(s.Volumes, name) {
+				s.Volumes = append(s.Volumes, name)
+			}
+			fmt.Fprintln(p.stdout, name)
+			return nil
+		}
+		if slices.Contains(s.Networks, name) {
+			return p.failed(1, "Error response from daemon: network with name %s already exists", name)
+		}
+		s.Networks = append(s.Networks, name)
+		fmt.Fprintln(p.stdout, randomID())
+		return nil
+	})
+}
+
+// dockerPrune removes the stopped containers and the images without tags
+func (p *program) dockerPrune() int {
+	return p.update(func(s *state) error {
+		s.Containers = slices.DeleteFunc(s.Containers, func(c Container) bool { return !c.Running })
+		s.Images = slices.DeleteFunc(s.Images, func(image Image) bool { return len(image.Tags) == 0 })
+		fmt.Fprintln(p.stdout, "Total reclaimed space: 0B")
+		return nil
+	})
+}
@@ -0,0 +1,415 @@
+// Package faketarget runs fake deployment targets for tests of the worker. A target is an SSH
+// server on the loopback interface that runs commands in a local shell and serves SFTP, with the
+// docker, git, curl and crontab programs deployments run on targets simulated, so a deployment
+// goes through every step without a VPS, a Docker daemon or GitHub.
+//
+// Commands and file transfers use the filesystem of the host the tests run on, and deployments use
+// fixed paths on their targets such as /tmp/deployknot-app, so tests must not run deployments
+// against several fake targets at once. Only the CLI Docker backend is simulated.
+//
+// The simulated programs run in the test binary, so a package using fake targets must hand its
+// tests to Main:
+//
+//	func TestMain(m *testing.M) { faketarget.Main(m) }
+package faketarget
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"deployknot/internal/shellquote"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Default login of a fake target
+const (
+	DefaultUser     = "deploy"
+	DefaultPassword = "deploy-password"
+)
+
+// Options configures a fake target and the repository and web its simulated programs reach
+type Options struct {
+	// User and Password are the login the target accepts; empty uses DefaultUser and DefaultPassword
+	User     string
+	Password string
+	// Files are the files of the repository git clones, by slash-separated path relative to its
+	// root. curl serves them from raw.githubusercontent.com for every branch.
+	Files map[string]string
+	// Branches are the branches of the repository; empty has only main
+	Branches []string
+	// PAT is the token git and curl require for the repository; empty accepts any
+	PAT string
+	// HTTPStatus is the status curl reports for URLs other than the repository's, such as the
+	// health checks of deployed containers; zero is 200
+	HTTPStatus int
+}
+
+// Target is a running fake target
+type Target struct {
+	// Host and Port are where its SSH server listens
+	Host string
+	Port int
+	// User and Password are its login
+	User     string
+	Password string
+
+	dir      string
+	binDir   string
+	listener net.Listener
+	config   *ssh.ServerConfig
+	conns    sync.WaitGroup
+
+	mu             sync.Mutex
+	commands       []string
+	refuseSessions int
+	dropExitStatus int
+	open           map[ssh.Conn]bool
+}
+
+// New starts a fake target. Close stops it and removes its state.
+func New(opts Options) (*Target, error) {
+	if opts.User == "" {
+		opts.User = DefaultUser
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultPassword
+	}
+	if len(opts.Branches) == 0 {
+		opts.Branches = []string{"main"}
+	}
+	if opts.HTTPStatus == 0 {
+		opts.HTTPStatus = 200
+	}
+
+	dir, err := os.MkdirTemp("", "faketarget-")
+	if err != nil {
+		return nil, err
+	}
+	t := &Target{
+		User:     opts.User,
+		Password: opts.Password,
+		dir:      dir,
+		binDir:   filepath.Join(dir, "bin"),
+		open:     map[ssh.Conn]bool{},
+	}
+	if err := t.setUp(opts); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	t.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	addr := t.listener.Addr().(*net.TCPAddr)
+	t.Host, t.Port = addr.IP.String(), addr.Port
+	go t.serve()
+	return t, nil
+}
+
+// setUp writes the state of the simulated programs and the shims that run them
+func (t *Target) setUp(opts Options) error {
+	if err := os.MkdirAll(filepath.Join(t.dir, "home"), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.binDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(t.dir, optionsFile), data, 0600); err != nil {
+		return err
+	}
+	if err := saveState(t.dir, &state{}); err != nil {
+		return err
+	}
+
+	// The shims run the test binary, whose TestMain simulates the program through Main instead of
+	// running the tests
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	for _, program := range simulatedPrograms {
+		shim := fmt.Sprintf("#!/bin/sh\n%s=%s %s=%s exec %s \"$@\"\n",
+			programEnv, program, stateEnv, shellquote.Quote(t.dir), shellquote.Quote(self))
+		if err := os.WriteFile(filepath.Join(t.binDir, program), []byte(shim), 0700); err != nil {
+			return err
+		}
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return err
+	}
+	t.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() != t.User || string(password) != t.Password {
+				return nil, fmt.Errorf("password rejected for %s", conn.User())
+			}
+			return nil, nil
+		},
+	}
+	t.config.AddHostKey(signer)
+	return nil
+}
+
+// Addr returns the address of its SSH server
+func (t *Target) Addr() string {
+	return net.JoinHostPort(t.Host, fmt.Sprint(t.Port))
+}
+
+// Close stops the target, closing the connections to it, and removes its state
+func (t *Target) Close() error {
+	err := t.listener.Close()
+	t.mu.Lock()
+	for conn := range t.open {
+		conn.Close()
+	}
+	t.mu.Unlock()
+	t.conns.Wait()
+	os.RemoveAll(t.dir)
+	return err
+}
+
+// Commands returns the commands run on the target so far, in the order they started
+func (t *Target) Commands() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.commands...)
+}
+
+// RefuseSessions makes the target refuse the next n sessions as administratively prohibited, as
+// sshd does once a connection has MaxSessions open
+func (t *Target) RefuseSessions(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refuseSessions = n
+}
+
+// DropExitStatus makes the next n commands end without reporting their exit status, as when the
+// connection to sshd breaks while they run
+func (t *Target) DropExitStatus(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dropExitStatus = n
+}
+
+// Containers returns the containers of the simulated Docker daemon
+func (t *Target) Containers() ([]Container, error) {
+	s, err := loadState(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.Containers, nil
+}
+
+// Images returns the images of the simulated Docker daemon
+func (t *Target) Images() ([]Image, error) {
+	s, err := loadState(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.Images, nil
+}
+
+// Crontab returns the simulated crontab of the target's user
+func (t *Target) Crontab() (string, error) {
+	s, err := loadState(t.dir)
+	if err != nil {
+		return "", err
+	}
+	return s.Crontab, nil
+}
+
+// serve accepts SSH connections until the target is closed
+func (t *Target) serve() {
+	for {
+		netConn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.conns.Add(1)
+		go func() {
+			defer t.conns.Done()
+			t.handleConn(netConn)
+		}()
+	}
+}
+
+// handleConn serves the sessions of a connection
+func (t *Target) handleConn(netConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, t.config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	t.mu.Lock()
+	t.open[conn] = true
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.open, conn)
+		t.mu.Unlock()
+		conn.Close()
+	}()
+
+	go ssh.DiscardRequests(reqs)
+	var sessions sync.WaitGroup
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		t.mu.Lock()
+		refuse := t.refuseSessions > 0
+		if refuse {
+			t.refuseSessions--
+		}
+		t.mu.Unlock()
+		if refuse {
+			newChannel.Reject(ssh.Prohibited, "open failed")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			t.handleSession(channel, requests)
+		}()
+	}
+	sessions.Wait()
+}
+
+// handleSession serves a session: one command or the SFTP subsystem
+func (t *Target) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+
+	env := []string{}
+	var cmd *exec.Cmd
+	var done chan struct{}
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var kv struct{ Key, Value string }
+			if ssh.Unmarshal(req.Payload, &kv) == nil {
+				env = append(env, kv.Key+"="+kv.Value)
+			}
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if cmd != nil || ssh.Unmarshal(req.Payload, &payload) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			cmd, done = t.startCommand(channel, payload.Command, env)
+		case "subsystem":
+			var payload struct{ Name string }
+			if cmd != nil || ssh.Unmarshal(req.Payload, &payload) != nil || payload.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			server.Close()
+			return
+		case "signal":
+			if cmd != nil && cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+
+	// The client closed the session; whatever still runs in it is abandoned
+	if cmd != nil {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		<-done
+	}
+}
+
+// startCommand runs command in a local shell with the simulated programs first in its PATH, and
+// reports its exit status and closes the session when it ends
+func (t *Target) startCommand(channel ssh.Channel, command string, env []string) (*exec.Cmd, chan struct{}) {
+	t.mu.Lock()
+	t.commands = append(t.commands, command)
+	drop := t.dropExitStatus > 0
+	if drop {
+		t.dropExitStatus--
+	}
+	t.mu.Unlock()
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Dir = filepath.Join(t.dir, "home")
+	cmd.Env = append([]string{
+		"PATH=" + t.binDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"HOME=" + cmd.Dir,
+		"USER=" + t.User,
+		"LANG=C",
+	}, env...)
+	cmd.Stdin = channel
+	cmd.Stdout = channel
+	cmd.Stderr = channel.Stderr()
+
+	// Started here so a signal or the client closing the session can kill it
+	startErr := cmd.Start()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		status := 0
+		err := startErr
+		if err == nil {
+			err = cmd.Wait()
+		}
+		if err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				fmt.Fprintf(channel.Stderr(), "sh: %v\n", err)
+				status = 127
+			} else if status = exitErr.ExitCode(); status < 0 {
+				// Killed by a signal
+				status = 137
+			}
+		}
+		if !drop {
+			payload := make([]byte, 4)
+			binary.BigEndian.PutUint32(payload, uint32(status))
+			channel.SendRequest("exit-status", false, payload)
+		}
+		channel.CloseWrite()
+		channel.Close()
+	}()
+	return cmd, done
+}
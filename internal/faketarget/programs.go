@@ -0,0 +1,368 @@
+package faketarget
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// programEnv names the program a shim runs the binary as
+	programEnv = "FAKETARGET_PROGRAM"
+	// stateEnv is the directory of the target a shim runs for
+	stateEnv = "FAKETARGET_STATE"
+)
+
+// simulatedPrograms are the programs of a fake target the shims in its PATH replace
+var simulatedPrograms = []string{"docker", "git", "curl", "crontab"}
+
+// Main runs the tests of m, or the simulated program a shim of a fake target runs the test binary
+// as. Packages testing against fake targets call it from their TestMain.
+func Main(m interface{ Run() int }) {
+	if name := os.Getenv(programEnv); name != "" {
+		os.Exit(runProgram(name, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// program is a run of a simulated program
+type program struct {
+	dir    string
+	opts   *Options
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// runProgram runs the simulated program name and returns its exit status
+func runProgram(name string, args []string) int {
+	dir := os.Getenv(stateEnv)
+	opts, err := loadOptions(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 127
+	}
+	p := &program{dir: dir, opts: opts, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	switch name {
+	case "docker":
+		return p.docker(args)
+	case "git":
+		return p.git(args)
+	case "curl":
+		return p.curl(args)
+	case "crontab":
+		return p.crontab(args)
+	}
+	return p.fail(127, "%s: not simulated by the fake target", name)
+}
+
+// fail prints an error message and returns status
+func (p *program) fail(status int, format string, args ...any) int {
+	fmt.Fprintf(p.stderr, format+"\n", args...)
+	return status
+}
+
+// branchCommit is the commit the head of a branch of the fake repository is at
+func branchCommit(branch string) string {
+	sum := sha1.Sum([]byte("faketarget:" + branch))
+	return hex.EncodeToString(sum[:])
+}
+
+// authorized reports whether a URL of the repository carries the PAT of the target
+func (p *program) authorized(token string) bool {
+	return p.opts.PAT == "" || token == p.opts.PAT
+}
+
+// git simulates the git commands deployments run against the fake repository
+func (p *program) git(args []string) int {
+	if len(args) >= 2 && args[0] == "-C" {
+		if err := os.Chdir(args[1]); err != nil {
+			return p.fail(128, "fatal: cannot change to '%s': No such file or directory", args[1])
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return p.fail(1, "usage: git <command> [<args>]")
+	}
+
+	switch args[0] {
+	case "--version":
+		fmt.Fprintln(p.stdout, "git version 2.43.0")
+	case "lfs":
+		if len(args) > 1 && args[1] == "version" {
+			fmt.Fprintln(p.stdout, "git-lfs/3.4.1 (faketarget)")
+		}
+	case "ls-remote":
+		return p.gitLsRemote(args[1:])
+	case "clone":
+		return p.gitClone(args[1:])
+	case "checkout":
+		return p.gitCheckout(args[1:])
+	case "rev-parse":
+		head, err := os.ReadFile(filepath.Join(".git", "HEAD"))
+		if err != nil {
+			return p.fail(128, "fatal: not a git repository (or any of the parent directories): .git")
+		}
+		fmt.Fprintln(p.stdout, strings.TrimSpace(string(head)))
+	case "sparse-checkout", "fetch", "config":
+	default:
+		return p.fail(1, "git: '%s' is not a git command the fake target simulates", args[0])
+	}
+	return 0
+}
+
+// repoURL checks a URL of the fake repository, returning the status git fails with when it is not
+// readable
+func (p *program) repoURL(raw string) int {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host != "github.com" {
+		return p.fail(128, "fatal: repository '%s' not found", raw)
+	}
+	token := ""
+	if u.User != nil {
+		token = u.User.Username()
+	}
+	if !p.authorized(token) {
+		return p.fail(128, "remote: Invalid username or token.\nfatal: Authentication failed for 'https://github.com%s/'", u.Path)
+	}
+	return 0
+}
+
+// gitLsRemote lists the branches of the fake repository matching the patterns
+func (p *program) gitLsRemote(args []string) int {
+	var positional []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) == 0 {
+		return p.fail(128, "fatal: No remote configured to list refs from.")
+	}
+	if status := p.repoURL(positional[0]); status != 0 {
+		return status
+	}
+	for _, branch := range p.opts.Branches {
+		ref := "refs/heads/" + branch
+		matched := len(positional) == 1
+		for _, pattern := range positional[1:] {
+			matched = matched || ref == pattern || strings.HasSuffix(ref, "/"+pattern)
+		}
+		if matched {
+			fmt.Fprintf(p.stdout, "%s\t%s\n", branchCommit(branch), ref)
+		}
+	}
+	return 0
+}
+
+// gitClone writes the files of the fake repository into the destination directory
+func (p *program) gitClone(args []string) int {
+	branch := "main"
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--branch" || arg == "-b":
+			if i+1 < len(args) {
+				branch = args[i+1]
+				i++
+			}
+		case arg == "--depth":
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 2 {
+		return p.fail(129, "usage: git clone [<options>] [--] <repo> <dir>")
+	}
+	repo, dest := positional[0], positional[1]
+	if status := p.repoURL(repo); status != 0 {
+		return status
+	}
+	if !slices.Contains(p.opts.Branches, branch) {
+		return p.fail(128, "fatal: Remote branch %s not found in upstream origin", branch)
+	}
+	if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+		return p.fail(128, "fatal: destination path '%s' already exists and is not an empty directory.", dest)
+	}
+
+	fmt.Fprintf(p.stderr, "Cloning into '%s'...\n", dest)
+	for name, content := range p.opts.Files {
+		file := filepath.Join(dest, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return p.fail(128, "fatal: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			return p.fail(128, "fatal: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dest, ".git"), 0755); err != nil {
+		return p.fail(128, "fatal: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, ".git", "HEAD"), []byte(branchCommit(branch)+"\n"), 0644); err != nil {
+		return p.fail(128, "fatal: %v", err)
+	}
+	return 0
+}
+
+// gitCheckout moves the head of the clone in the working directory to a branch or commit
+func (p *program) gitCheckout(args []string) int {
+	if len(args) == 0 {
+		return p.fail(1, "error: no branch or commit to check out")
+	}
+	ref := args[len(args)-1]
+	commit := ref
+	if !slices.Contains(args, "--detach") {
+		if !slices.Contains(p.opts.Branches, ref) {
+			return p.fail(1, "error: pathspec '%s' did not match any file(s) known to git", ref)
+		}
+		commit = branchCommit(ref)
+	}
+	if err := os.WriteFile(filepath.Join(".git", "HEAD"), []byte(commit+"\n"), 0644); err != nil {
+		return p.fail(128, "fatal: not a git repository (or any of the parent directories): .git")
+	}
+	return 0
+}
+
+// curl simulates requests to GitHub for files of the fake repository, and to everything else,
+// such as the health checks of deployed containers, answers with the configured status
+func (p *program) curl(args []string) int {
+	var target, output, writeOut string
+	var headers []string
+	fail, silent, showError := false, false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch {
+		case arg == "-H" || arg == "--header":
+			headers = append(headers, value())
+		case arg == "-o" || arg == "--output":
+			output = value()
+		case arg == "-w" || arg == "--write-out":
+			writeOut = value()
+		case arg == "-m" || arg == "--max-time" || arg == "-X" || arg == "--request":
+			value()
+		case arg == "--fail":
+			fail = true
+		case arg == "--silent":
+			silent = true
+		case arg == "--show-error":
+			showError = true
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-"):
+			fail = fail || strings.Contains(arg, "f")
+			silent = silent || strings.Contains(arg, "s")
+			showError = showError || strings.Contains(arg, "S")
+		default:
+			target = arg
+		}
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return p.fail(3, "curl: (3) URL using bad/illegal format or missing URL")
+	}
+
+	status, body := p.opts.HTTPStatus, "OK\n"
+	if u.Host == "raw.githubusercontent.com" {
+		status, body = p.rawFile(u.Path, headers)
+	}
+	if fail && status >= 400 {
+		if !silent || showError {
+			fmt.Fprintf(p.stderr, "curl: (22) The requested URL returned error: %d\n", status)
+		}
+		return 22
+	}
+
+	switch output {
+	case "":
+		io.WriteString(p.stdout, body)
+	case "/dev/null":
+	default:
+		if err := os.WriteFile(output, []byte(body), 0644); err != nil {
+			return p.fail(23, "curl: (23) Failure writing output to destination")
+		}
+	}
+	if writeOut != "" {
+		replacer := strings.NewReplacer(`\n`, "\n", "%{http_code}", fmt.Sprint(status), "%{time_total}", "0.004200")
+		io.WriteString(p.stdout, replacer.Replace(writeOut))
+	}
+	return 0
+}
+
+// rawFile answers a request for /owner/repo/ref/path of the fake repository as GitHub does
+func (p *program) rawFile(urlPath string, headers []string) (int, string) {
+	token := ""
+	for _, header := range headers {
+		if value, ok := strings.CutPrefix(header, "Authorization: token "); ok {
+			token = value
+		}
+	}
+	parts := strings.SplitN(strings.TrimPrefix(urlPath, "/"), "/", 4)
+	if !p.authorized(token) || len(parts) < 4 {
+		return 404, "404: Not Found"
+	}
+	content, ok := p.opts.Files[path.Clean(parts[3])]
+	if !ok {
+		return 404, "404: Not Found"
+	}
+	return 200, content
+}
+
+// crontab simulates the crontab of the target's user
+func (p *program) crontab(args []string) int {
+	if len(args) == 0 {
+		return p.fail(1, "crontab: usage error: file name must be specified for replace")
+	}
+	switch args[0] {
+	case "-l":
+		s, err := loadState(p.dir)
+		if err != nil {
+			return p.fail(1, "crontab: %v", err)
+		}
+		if s.Crontab == "" {
+			return p.fail(1, "no crontab for %s", p.opts.User)
+		}
+		io.WriteString(p.stdout, s.Crontab)
+		return 0
+	case "-r":
+		return p.setCrontab("")
+	case "-":
+		content, err := io.ReadAll(p.stdin)
+		if err != nil {
+			return p.fail(1, "crontab: %v", err)
+		}
+		return p.setCrontab(string(content))
+	default:
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return p.fail(1, "crontab: %v", err)
+		}
+		return p.setCrontab(string(content))
+	}
+}
+
+// setCrontab replaces the crontab of the target's user
+func (p *program) setCrontab(content string) int {
+	err := updateState(p.dir, func(s *state) error {
+		s.Crontab = content
+		return nil
+	})
+	if err != nil {
+		return p.fail(1, "crontab: %v", err)
+	}
+	return 0
+}
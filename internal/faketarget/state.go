@@ -0,0 +1,128 @@
+package faketarget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// optionsFile holds the Options of the target for its simulated programs
+	optionsFile = "options.json"
+	// stateFile holds what the simulated programs changed on the target
+	stateFile = "state.json"
+	// lockDir is held by the simulated program updating the state
+	lockDir = "state.lock"
+	// staleLockAge is when a lock left by a killed program is taken over
+	staleLockAge = 10 * time.Second
+)
+
+// state is what the simulated programs changed on the target
+type state struct {
+	Images     []Image     `json:"images"`
+	Containers []Container `json:"containers"`
+	Networks   []string    `json:"networks"`
+	Volumes    []string    `json:"volumes"`
+	Crontab    string      `json:"crontab"`
+}
+
+// Image is an image of the simulated Docker daemon
+type Image struct {
+	ID string `json:"id"`
+	// Tags are its references, such as app:latest
+	Tags []string `json:"tags"`
+	// Dockerfile is what it was built from; empty for pulled images
+	Dockerfile string `json:"dockerfile,omitempty"`
+}
+
+// Container is a container of the simulated Docker daemon
+type Container struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	Running bool   `json:"running"`
+	// Ports are the published ports as host:container
+	Ports   []string          `json:"ports,omitempty"`
+	Env     []string          `json:"env,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Network string            `json:"network,omitempty"`
+	// Args are the arguments of the docker run that created it
+	Args    []string  `json:"args"`
+	Created time.Time `json:"created"`
+}
+
+// loadState reads the state of the target in dir
+func loadState(dir string) (*state, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid fake target state: %w", err)
+	}
+	return &s, nil
+}
+
+// saveState replaces the state of the target in dir
+func saveState(dir string, s *state) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, stateFile))
+}
+
+// updateState calls update with the state of the target in dir while no other simulated program
+// changes it, and saves it unless update fails
+func updateState(dir string, update func(*state) error) error {
+	lock := filepath.Join(dir, lockDir)
+	deadline := time.Now().Add(2 * staleLockAge)
+	for {
+		err := os.Mkdir(lock, 0700)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		if info, statErr := os.Stat(lock); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the fake target state lock")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	defer os.Remove(lock)
+
+	s, err := loadState(dir)
+	if err != nil {
+		return err
+	}
+	if err := update(s); err != nil {
+		return err
+	}
+	return saveState(dir, s)
+}
+
+// loadOptions reads the Options of the target in dir
+func loadOptions(dir string) (*Options, error) {
+	data, err := os.ReadFile(filepath.Join(dir, optionsFile))
+	if err != nil {
+		return nil, err
+	}
+	var opts Options
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return nil, fmt.Errorf("invalid fake target options: %w", err)
+	}
+	return &opts, nil
+}
@@ -0,0 +1,320 @@
+package graphqlapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// jsonScalar passes maps such as step outputs and log parameters through as JSON objects
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "An arbitrary JSON value.",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return nil
+	},
+})
+
+// jsonField resolves a field from the field of the source struct with the given JSON name, so the
+// schema reads the models the REST API returns
+func jsonField(typ graphql.Output, name string) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return jsonValue(p.Source, name), nil
+		},
+	}
+}
+
+// jsonValue returns the field of the struct source points to whose JSON name is name, looking into
+// embedded structs. Nil pointers, like unknown fields, yield nil.
+func jsonValue(source interface{}, name string) interface{} {
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	field, ok := fieldByJSONName(v, name)
+	if !ok {
+		return nil
+	}
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	return field.Interface()
+}
+
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if value, ok := fieldByJSONName(v.Field(i), name); ok {
+				return value, true
+			}
+			continue
+		}
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var (
+	nonNullID       = graphql.NewNonNull(graphql.ID)
+	nonNullString   = graphql.NewNonNull(graphql.String)
+	nonNullInt      = graphql.NewNonNull(graphql.Int)
+	nonNullBoolean  = graphql.NewNonNull(graphql.Boolean)
+	nonNullDateTime = graphql.NewNonNull(graphql.DateTime)
+)
+
+// errAdminRequired is returned for projects and targets, which only admins may read like in the REST API
+var errAdminRequired = errors.New("admin role required")
+
+// newSchema builds the schema; the resolvers of deployments, projects and subscriptions are s's
+func (s *Server) newSchema() (graphql.Schema, error) {
+	stepType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeploymentStep",
+		Fields: graphql.Fields{
+			"id":           jsonField(nonNullID, "id"),
+			"stepName":     jsonField(nonNullString, "step_name"),
+			"stepOrder":    jsonField(nonNullInt, "step_order"),
+			"status":       jsonField(nonNullString, "status"),
+			"startedAt":    jsonField(graphql.DateTime, "started_at"),
+			"completedAt":  jsonField(graphql.DateTime, "completed_at"),
+			"durationMs":   jsonField(graphql.Int, "duration_ms"),
+			"errorMessage": jsonField(graphql.String, "error_message"),
+			"output":       jsonField(jsonScalar, "output"),
+			"dependsOn":    jsonField(graphql.NewList(nonNullInt), "depends_on"),
+		},
+	})
+
+	logType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeploymentLog",
+		Fields: graphql.Fields{
+			"id":           jsonField(nonNullID, "id"),
+			"seq":          jsonField(nonNullInt, "seq"),
+			"deploymentId": jsonField(nonNullID, "deployment_id"),
+			"createdAt":    jsonField(nonNullDateTime, "created_at"),
+			"level":        jsonField(nonNullString, "log_level"),
+			"message":      jsonField(nonNullString, "message"),
+			"taskName":     jsonField(graphql.String, "task_name"),
+			"stepOrder":    jsonField(graphql.Int, "step_order"),
+			"category":     jsonField(graphql.String, "category"),
+			"eventCode":    jsonField(graphql.String, "event_code"),
+			"params":       jsonField(jsonScalar, "params"),
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"endCursor":   &graphql.Field{Type: graphql.String},
+			"hasNextPage": &graphql.Field{Type: nonNullBoolean},
+		},
+	})
+
+	logConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeploymentLogConnection",
+		Fields: graphql.Fields{
+			"nodes":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(logType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+
+	logArgs := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: defaultLogPageSize,
+			Description:  "The number of logs to return, at most 1000.",
+		},
+		"after": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "The endCursor of the previous page; logs are returned oldest first.",
+		},
+		"categories": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(nonNullString),
+			Description: "Only return logs of these categories.",
+		},
+		"level": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Only return logs at least this severe: info, warn or error.",
+		},
+		"taskNames": &graphql.ArgumentConfig{
+			Type:        graphql.NewList(nonNullString),
+			Description: "Only return logs of these tasks.",
+		},
+	}
+
+	deploymentType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Deployment",
+		Fields: graphql.Fields{
+			"id":                  jsonField(nonNullID, "id"),
+			"status":              jsonField(nonNullString, "status"),
+			"projectName":         jsonField(graphql.String, "project_name"),
+			"deploymentName":      jsonField(graphql.String, "deployment_name"),
+			"deploymentType":      jsonField(nonNullString, "deployment_type"),
+			"targetType":          jsonField(nonNullString, "target_type"),
+			"targetIp":            jsonField(graphql.String, "target_ip"),
+			"port":                jsonField(graphql.Int, "port"),
+			"githubRepoUrl":       jsonField(graphql.String, "github_repo_url"),
+			"githubBranch":        jsonField(graphql.String, "github_branch"),
+			"commitSha":           jsonField(graphql.String, "commit_sha"),
+			"containerName":       jsonField(graphql.String, "container_name"),
+			"image":               jsonField(graphql.String, "image"),
+			"kubernetesNamespace": jsonField(graphql.String, "kubernetes_namespace"),
+			"workerPool":          jsonField(graphql.String, "worker_pool"),
+			"concurrencyGroup":    jsonField(graphql.String, "concurrency_group"),
+			"createdAt":           jsonField(nonNullDateTime, "created_at"),
+			"startedAt":           jsonField(graphql.DateTime, "started_at"),
+			"completedAt":         jsonField(graphql.DateTime, "completed_at"),
+			"errorMessage":        jsonField(graphql.String, "error_message"),
+			"failureCategory":     jsonField(graphql.String, "failure_category"),
+			"progress":            jsonField(graphql.Int, "progress"),
+			"commentCount":        jsonField(nonNullInt, "comment_count"),
+			"steps": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(stepType))),
+				Resolve: s.resolveSteps,
+			},
+			"logs": &graphql.Field{
+				Type:    graphql.NewNonNull(logConnectionType),
+				Args:    logArgs,
+				Resolve: s.resolveLogs,
+			},
+		},
+	})
+
+	targetType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Target",
+		Fields: graphql.Fields{
+			"id":                  jsonField(nonNullID, "id"),
+			"name":                jsonField(nonNullString, "name"),
+			"targetType":          jsonField(graphql.String, "target_type"),
+			"targetIp":            jsonField(graphql.String, "target_ip"),
+			"sshUsername":         jsonField(graphql.String, "ssh_username"),
+			"port":                jsonField(graphql.Int, "port"),
+			"kubernetesNamespace": jsonField(graphql.String, "kubernetes_namespace"),
+			"workerPool":          jsonField(graphql.String, "worker_pool"),
+			"bootstrappedAt":      jsonField(graphql.DateTime, "bootstrapped_at"),
+		},
+	})
+
+	projectType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Project",
+		Fields: graphql.Fields{
+			"id":           jsonField(nonNullID, "id"),
+			"name":         jsonField(nonNullString, "name"),
+			"description":  jsonField(graphql.String, "description"),
+			"isActive":     jsonField(nonNullBoolean, "is_active"),
+			"owner":        jsonField(graphql.String, "owner"),
+			"workerPool":   jsonField(graphql.String, "worker_pool"),
+			"publicStatus": jsonField(nonNullBoolean, "public_status"),
+			"createdAt":    jsonField(nonNullDateTime, "created_at"),
+			"targets": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(targetType))),
+				Resolve: s.resolveTargets,
+			},
+		},
+	})
+
+	statusUpdateType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeploymentStatusUpdate",
+		Fields: graphql.Fields{
+			"deploymentId": &graphql.Field{Type: nonNullID},
+			"status":       &graphql.Field{Type: nonNullString},
+			"progress":     &graphql.Field{Type: nonNullInt},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"deployment": &graphql.Field{
+				Type:        deploymentType,
+				Description: "A deployment, or null when it does not exist.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: nonNullID},
+				},
+				Resolve: s.resolveDeployment,
+			},
+			"deployments": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(deploymentType))),
+				Description: "The authenticated user's deployments, newest first.",
+				Args: graphql.FieldConfigArgument{
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultDeploymentLimit},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: s.resolveDeployments,
+			},
+			"project": &graphql.Field{
+				Type:        projectType,
+				Description: "A project given by its ID or name, or null when it does not exist or the user is not an admin.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: nonNullString},
+				},
+				Resolve: s.resolveProject,
+			},
+			"projects": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(projectType)),
+				Description: "All projects, or null with an error for users who are not admins.",
+				Resolve:     s.resolveProjects,
+			},
+		},
+	})
+
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"deploymentStatus": &graphql.Field{
+				Type:        graphql.NewNonNull(statusUpdateType),
+				Description: "The status and progress of a deployment whenever they change, until it finishes.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: nonNullID},
+				},
+				Resolve:   resolvePayload,
+				Subscribe: s.subscribeStatus,
+			},
+			"deploymentLogs": &graphql.Field{
+				Type:        graphql.NewNonNull(logType),
+				Description: "The logs of a deployment as they are written, starting after the given cursor.",
+				Args: graphql.FieldConfigArgument{
+					"id":         &graphql.ArgumentConfig{Type: nonNullID},
+					"after":      logArgs["after"],
+					"categories": logArgs["categories"],
+					"level":      logArgs["level"],
+					"taskNames":  logArgs["taskNames"],
+				},
+				Resolve:   resolvePayload,
+				Subscribe: s.subscribeLogs,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Subscription: subscription,
+	})
+}
+
+// resolvePayload resolves a subscription field to the event the subscription produced
+func resolvePayload(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source, nil
+}
@@ -0,0 +1,467 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultLogPageSize and maxLogPageSize match the page sizes of the REST log endpoint
+	defaultLogPageSize = 100
+	maxLogPageSize     = 1000
+	// defaultDeploymentLimit and maxDeploymentLimit bound the deployments listed at once
+	defaultDeploymentLimit = 50
+	maxDeploymentLimit     = 100
+	// pollInterval is how often subscriptions look for changes, like the REST log stream
+	pollInterval = time.Second
+)
+
+type userIDContextKey struct{}
+
+// Server serves a read-only GraphQL API over deployments, their steps and logs, and projects and
+// their targets, from the same services as the REST API. Subscriptions are streamed as Server-Sent
+// Events.
+type Server struct {
+	deployments *services.DeploymentService
+	projects    *services.ProjectService
+	roles       middleware.RoleLookup
+	schema      graphql.Schema
+	logger      *logrus.Logger
+}
+
+// NewServer creates a new GraphQL API server
+func NewServer(deployments *services.DeploymentService, projects *services.ProjectService, roles middleware.RoleLookup, logger *logrus.Logger) (*Server, error) {
+	s := &Server{
+		deployments: deployments,
+		projects:    projects,
+		roles:       roles,
+		logger:      logger,
+	}
+	schema, err := s.newSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
+	s.schema = schema
+	return s, nil
+}
+
+// request is a GraphQL request, sent as the JSON body of a POST or as the query parameters of a GET
+type request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handle handles GET and POST /api/v1/graphql. Queries are answered with JSON; subscriptions need
+// Accept: text/event-stream and are answered with a "next" event per result and a final "complete"
+// event, as in the distinct connections mode of the GraphQL over SSE protocol.
+func (s *Server) Handle(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	var req request
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": err.Error(),
+			})
+			return
+		}
+	} else {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid variables",
+					"message": "variables must be a JSON object",
+				})
+				return
+			}
+		}
+	}
+	if req.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "query is required",
+		})
+		return
+	}
+
+	params := graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(c.Request.Context(), userIDContextKey{}, userID),
+	}
+
+	if !isSubscription(req.Query, req.OperationName) {
+		c.JSON(http.StatusOK, graphql.Do(params))
+		return
+	}
+	if c.GetHeader("Accept") != "text/event-stream" {
+		c.JSON(http.StatusNotAcceptable, gin.H{
+			"error":   "Subscriptions are streamed",
+			"message": "Subscriptions need Accept: text/event-stream",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// The results are drained until the subscription stops, which it does once the client left
+	for result := range graphql.Subscribe(params) {
+		c.SSEvent("next", result)
+		c.Writer.Flush()
+	}
+	c.SSEvent("complete", "")
+	c.Writer.Flush()
+}
+
+// isSubscription reports whether the operation a request runs is a subscription. Documents that do
+// not parse are left to graphql.Do to report.
+func isSubscription(query, operationName string) bool {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return false
+	}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			return operation.Operation == ast.OperationTypeSubscription
+		}
+	}
+	return false
+}
+
+// requireAdmin fails unless the authenticated user is an admin
+func (s *Server) requireAdmin(ctx context.Context) error {
+	userID, _ := ctx.Value(userIDContextKey{}).(uuid.UUID)
+	role, err := s.roles(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user role: %w", err)
+	}
+	if role != models.RoleAdmin {
+		return errAdminRequired
+	}
+	return nil
+}
+
+// idArg parses the ID argument named name
+func idArg(p graphql.ResolveParams, name string) (uuid.UUID, error) {
+	value, _ := p.Args[name].(string)
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s must be a valid UUID", name)
+	}
+	return id, nil
+}
+
+// logFilterArgs parses the cursor and filter arguments of a log field
+func logFilterArgs(p graphql.ResolveParams) (int64, models.DeploymentLogFilter, error) {
+	var afterSeq int64
+	var filter models.DeploymentLogFilter
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		seq, err := strconv.ParseInt(after, 10, 64)
+		if err != nil || seq < 0 {
+			return 0, filter, fmt.Errorf("after must be a cursor returned as endCursor")
+		}
+		afterSeq = seq
+	}
+	categories, _ := p.Args["categories"].([]interface{})
+	for _, value := range categories {
+		name, _ := value.(string)
+		category, ok := models.ParseLogCategory(name)
+		if !ok {
+			return 0, filter, fmt.Errorf("unknown log category %q; see GET /api/v1/log-events for the categories", name)
+		}
+		filter.Categories = append(filter.Categories, category)
+	}
+	if value, ok := p.Args["level"].(string); ok && value != "" {
+		level, ok := models.ParseLogLevel(value)
+		if !ok {
+			return 0, filter, fmt.Errorf("unknown log level %q; use info, warn or error", value)
+		}
+		filter.Levels = level.AtLeast()
+	}
+	taskNames, _ := p.Args["taskNames"].([]interface{})
+	for _, value := range taskNames {
+		if name, _ := value.(string); name != "" {
+			filter.TaskNames = append(filter.TaskNames, name)
+		}
+	}
+	return afterSeq, filter, nil
+}
+
+func (s *Server) resolveDeployment(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p, "id")
+	if err != nil {
+		return nil, err
+	}
+	deployment, err := s.deployments.GetDeployment(p.Context, id)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return deployment, nil
+}
+
+func (s *Server) resolveDeployments(p graphql.ResolveParams) (interface{}, error) {
+	userID, _ := p.Context.Value(userIDContextKey{}).(uuid.UUID)
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if limit < 1 || limit > maxDeploymentLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxDeploymentLimit)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+	deployments, err := s.deployments.GetDeploymentsByUser(p.Context, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if deployments == nil {
+		deployments = []*models.DeploymentResponse{}
+	}
+	return deployments, nil
+}
+
+func (s *Server) resolveSteps(p graphql.ResolveParams) (interface{}, error) {
+	deployment := p.Source.(*models.DeploymentResponse)
+	steps, err := s.deployments.ListDeploymentSteps(p.Context, deployment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if steps == nil {
+		steps = []*models.DeploymentStep{}
+	}
+	return steps, nil
+}
+
+func (s *Server) resolveLogs(p graphql.ResolveParams) (interface{}, error) {
+	deployment := p.Source.(*models.DeploymentResponse)
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxLogPageSize {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxLogPageSize)
+	}
+	afterSeq, filter, err := logFilterArgs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.deployments.GetDeploymentLogPage(p.Context, deployment.ID, afterSeq, first, filter)
+	if err != nil {
+		return nil, err
+	}
+	// The cursor stays put on an empty page, so clients can poll from it for new logs
+	return map[string]interface{}{
+		"nodes": page.Logs,
+		"pageInfo": map[string]interface{}{
+			"endCursor":   strconv.FormatInt(page.NextAfterSeq, 10),
+			"hasNextPage": page.HasMore,
+		},
+	}, nil
+}
+
+func (s *Server) resolveProject(p graphql.ResolveParams) (interface{}, error) {
+	if err := s.requireAdmin(p.Context); err != nil {
+		return nil, err
+	}
+	idOrName, _ := p.Args["id"].(string)
+	project, err := s.projects.GetProject(p.Context, idOrName)
+	if err != nil {
+		if errors.Is(err, services.ErrProjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return project, nil
+}
+
+func (s *Server) resolveProjects(p graphql.ResolveParams) (interface{}, error) {
+	if err := s.requireAdmin(p.Context); err != nil {
+		return nil, err
+	}
+	projects, err := s.projects.ListProjects(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	if projects == nil {
+		projects = []*models.Project{}
+	}
+	return projects, nil
+}
+
+func (s *Server) resolveTargets(p graphql.ResolveParams) (interface{}, error) {
+	project := p.Source.(*models.Project)
+	targets, err := s.projects.ListTargets(p.Context, project.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if targets == nil {
+		targets = []*models.ProjectTarget{}
+	}
+	return targets, nil
+}
+
+// finished reports whether a deployment reached a status it only leaves when resumed
+func finished(status models.DeploymentStatus) bool {
+	switch status {
+	case models.DeploymentStatusCompleted, models.DeploymentStatusFailed, models.DeploymentStatusCancelled, models.DeploymentStatusAborted:
+		return true
+	}
+	return false
+}
+
+// subscribeStatus polls the status and progress of a deployment, which the deployment cache serves,
+// and sends them whenever they change. The stream ends once the deployment finished.
+func (s *Server) subscribeStatus(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p, "id")
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.Context
+	// Fail the subscription right away for a deployment that does not exist
+	status, progress, err := s.deployments.GetDeploymentProgress(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan interface{})
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		var lastStatus models.DeploymentStatus
+		lastProgress := -1
+		for {
+			if status != lastStatus || progress != lastProgress {
+				event := map[string]interface{}{
+					"deploymentId": id.String(),
+					"status":       string(status),
+					"progress":     progress,
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+				lastStatus, lastProgress = status, progress
+			}
+			if finished(status) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if status, progress, err = s.deployments.GetDeploymentProgress(ctx, id); err != nil {
+				if ctx.Err() == nil {
+					s.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to poll deployment status")
+				}
+				status, progress = lastStatus, lastProgress
+			}
+		}
+	}()
+	return events, nil
+}
+
+// subscribeLogs polls the logs of a deployment written after the cursor and sends each of them,
+// until it has sent those of the finished deployment
+func (s *Server) subscribeLogs(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p, "id")
+	if err != nil {
+		return nil, err
+	}
+	afterSeq, filter, err := logFilterArgs(p)
+	if err != nil {
+		return nil, err
+	}
+	ctx := p.Context
+	if _, _, err := s.deployments.GetDeploymentProgress(ctx, id); err != nil {
+		return nil, err
+	}
+
+	events := make(chan interface{})
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Read the status before the logs, so the logs of a finished deployment are all sent
+			status, _, err := s.deployments.GetDeploymentProgress(ctx, id)
+			if err != nil && ctx.Err() == nil {
+				s.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to poll deployment status")
+			}
+			done := err == nil && finished(status)
+
+			// Drain every page after the cursor so a burst of logs is not delayed by the poll interval
+			for {
+				page, err := s.deployments.GetDeploymentLogPage(ctx, id, afterSeq, defaultLogPageSize, filter)
+				if err != nil {
+					if ctx.Err() == nil {
+						s.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to poll deployment logs")
+					}
+					done = false
+					break
+				}
+				for _, log := range page.Logs {
+					select {
+					case events <- log:
+					case <-ctx.Done():
+						return
+					}
+				}
+				afterSeq = page.NextAfterSeq
+				if !page.HasMore {
+					break
+				}
+			}
+			if done {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return events, nil
+}
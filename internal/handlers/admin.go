@@ -0,0 +1,588 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminHandler handles administrator-only HTTP requests
+type AdminHandler struct {
+	deploymentService   *services.DeploymentService
+	organizationService *services.OrganizationService
+	userService         *services.UserService
+	auditService        *services.AuditService
+	// commandTemplateService manages the command templates of the worker steps
+	commandTemplateService *services.CommandTemplateService
+	// workerTokenService manages the tokens workers authenticate to the worker API with
+	workerTokenService *services.WorkerTokenService
+	// sshCAService manages the keys of the SSH certificate authority
+	sshCAService *services.SSHCAService
+	// backupService writes backups of DeployKnot's state
+	backupService *services.BackupService
+	logger        *logrus.Logger
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(deploymentService *services.DeploymentService, organizationService *services.OrganizationService, userService *services.UserService, auditService *services.AuditService, commandTemplateService *services.CommandTemplateService, workerTokenService *services.WorkerTokenService, sshCAService *services.SSHCAService, backupService *services.BackupService, logger *logrus.Logger) *AdminHandler {
+	return &AdminHandler{
+		deploymentService:      deploymentService,
+		organizationService:    organizationService,
+		userService:            userService,
+		auditService:           auditService,
+		commandTemplateService: commandTemplateService,
+		workerTokenService:     workerTokenService,
+		sshCAService:           sshCAService,
+		backupService:          backupService,
+		logger:                 logger,
+	}
+}
+
+// ListDeployments handles GET /api/v1/admin/deployments
+func (h *AdminHandler) ListDeployments(c *gin.Context) {
+	var filter models.DeploymentFilter
+
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid user ID",
+				"message": "user_id must be a valid UUID",
+			})
+			return
+		}
+		filter.UserID = &userID
+	}
+	if username := c.Query("username"); username != "" {
+		filter.Username = &username
+	}
+	if statusStr := c.Query("status"); statusStr != "" {
+		status := models.DeploymentStatus(statusStr)
+		filter.Status = &status
+	}
+	if target := c.Query("target"); target != "" {
+		filter.TargetIP = &target
+	}
+	if targetTypeStr := c.Query("target_type"); targetTypeStr != "" {
+		targetType := models.TargetType(targetTypeStr)
+		filter.TargetType = &targetType
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	deployments, err := h.deploymentService.ListDeployments(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list deployments")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list deployments",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deployments": deployments,
+		"limit":       limit,
+		"offset":      offset,
+		"count":       len(deployments),
+	})
+}
+
+// GetQuotas handles GET /api/v1/admin/quotas
+func (h *AdminHandler) GetQuotas(c *gin.Context) {
+	quotas, err := h.deploymentService.GetUserQuotas(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get user quotas")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get user quotas",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quotas": quotas,
+	})
+}
+
+// CreateOrganization handles POST /api/v1/admin/organizations
+func (h *AdminHandler) CreateOrganization(c *gin.Context) {
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	org, err := h.organizationService.CreateOrganization(c.Request.Context(), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidOrganization):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": err.Error(),
+			})
+		case errors.Is(err, services.ErrOrganizationExists):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Organization already exists",
+				"message": err.Error(),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to create organization")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create organization",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// ListOrganizations handles GET /api/v1/admin/organizations
+func (h *AdminHandler) ListOrganizations(c *gin.Context) {
+	orgs, err := h.organizationService.ListOrganizations(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list organizations")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list organizations",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organizations": orgs,
+	})
+}
+
+// SetOrganizationIPAllowlist handles PUT /api/v1/admin/organizations/:id/ip-allowlist
+func (h *AdminHandler) SetOrganizationIPAllowlist(c *gin.Context) {
+	organizationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid organization ID",
+			"message": "Organization ID must be a valid UUID",
+		})
+		return
+	}
+
+	var req models.UpdateIPAllowlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	org, err := h.organizationService.SetIPAllowlist(c.Request.Context(), organizationID, req.AllowedCIDRs)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidOrganization):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": err.Error(),
+			})
+		case errors.Is(err, services.ErrOrganizationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not found",
+				"message": err.Error(),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to set organization IP allowlist")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to set organization IP allowlist",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// AssignUserOrganization handles PUT /api/v1/admin/users/:id/organization
+func (h *AdminHandler) AssignUserOrganization(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"message": "User ID must be a valid UUID",
+		})
+		return
+	}
+
+	var req models.AssignOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.organizationService.AssignUser(c.Request.Context(), userID, req.OrganizationID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrganizationNotFound), errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not found",
+				"message": err.Error(),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to assign user organization")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to assign user organization",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":         userID,
+		"organization_id": req.OrganizationID,
+	})
+}
+
+// ListCommandTemplates handles GET /api/v1/admin/command-templates
+func (h *AdminHandler) ListCommandTemplates(c *gin.Context) {
+	templates, err := h.commandTemplateService.ListTemplates(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list command templates")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list command templates",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// SetCommandTemplate handles PUT /api/v1/admin/command-templates/:step
+func (h *AdminHandler) SetCommandTemplate(c *gin.Context) {
+	var req models.SetCommandTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	tmpl, err := h.commandTemplateService.SetTemplate(c.Request.Context(), c.Param("step"), req.Template, username)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCommandTemplate) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to set command template")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to set command template",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// DeleteCommandTemplate handles DELETE /api/v1/admin/command-templates/:step
+func (h *AdminHandler) DeleteCommandTemplate(c *gin.Context) {
+	if err := h.commandTemplateService.DeleteTemplate(c.Request.Context(), c.Param("step")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCommandTemplate):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": err.Error(),
+			})
+		case errors.Is(err, services.ErrCommandTemplateNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not found",
+				"message": err.Error(),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to delete command template")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to delete command template",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListWorkerTokens handles GET /api/v1/admin/worker-tokens
+func (h *AdminHandler) ListWorkerTokens(c *gin.Context) {
+	tokens, err := h.workerTokenService.ListTokens(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list worker tokens")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list worker tokens",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"worker_tokens": tokens})
+}
+
+// CreateWorkerToken handles POST /api/v1/admin/worker-tokens
+func (h *AdminHandler) CreateWorkerToken(c *gin.Context) {
+	var req models.CreateWorkerTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	token, err := h.workerTokenService.CreateToken(c.Request.Context(), &req, username)
+	if err != nil {
+		if errors.Is(err, services.ErrWorkerTokenExists) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Worker token already exists",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create worker token")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create worker token",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// RevokeWorkerToken handles DELETE /api/v1/admin/worker-tokens/:id
+func (h *AdminHandler) RevokeWorkerToken(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid worker token ID",
+			"message": "Worker token ID must be a valid UUID",
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	if err := h.workerTokenService.RevokeToken(c.Request.Context(), id, username); err != nil {
+		if errors.Is(err, services.ErrWorkerTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not found",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke worker token")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to revoke worker token",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListSSHCAKeys handles GET /api/v1/admin/ssh-ca/keys
+func (h *AdminHandler) ListSSHCAKeys(c *gin.Context) {
+	keys, err := h.sshCAService.ListKeys(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list SSH CA keys")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list SSH CA keys",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ssh_ca_keys": keys})
+}
+
+// CreateSSHCAKey handles POST /api/v1/admin/ssh-ca/keys
+func (h *AdminHandler) CreateSSHCAKey(c *gin.Context) {
+	var req models.CreateSSHCAKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	key, err := h.sshCAService.CreateKey(c.Request.Context(), &req, username)
+	if err != nil {
+		if errors.Is(err, services.ErrSSHCAKeyExists) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "SSH CA key already exists",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create SSH CA key")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create SSH CA key",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ActivateSSHCAKey handles POST /api/v1/admin/ssh-ca/keys/:id/activate
+func (h *AdminHandler) ActivateSSHCAKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid SSH CA key ID",
+			"message": "SSH CA key ID must be a valid UUID",
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	key, err := h.sshCAService.ActivateKey(c.Request.Context(), id, username)
+	if err != nil {
+		if errors.Is(err, services.ErrSSHCAKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not found",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to activate SSH CA key")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to activate SSH CA key",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// DeleteSSHCAKey handles DELETE /api/v1/admin/ssh-ca/keys/:id
+func (h *AdminHandler) DeleteSSHCAKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid SSH CA key ID",
+			"message": "SSH CA key ID must be a valid UUID",
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	if err := h.sshCAService.DeleteKey(c.Request.Context(), id, username); err != nil {
+		switch {
+		case errors.Is(err, services.ErrSSHCAKeyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Not found",
+				"message": err.Error(),
+			})
+		case errors.Is(err, services.ErrSSHCAKeyActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "SSH CA key is active",
+				"message": err.Error(),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to delete SSH CA key")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to delete SSH CA key",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetSSHCATrustedKeys handles GET /api/v1/ssh-ca/trusted-keys. It is public, so targets can fetch
+// the keys for their TrustedUserCAKeys file.
+func (h *AdminHandler) GetSSHCATrustedKeys(c *gin.Context) {
+	keys, err := h.sshCAService.TrustedKeys(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list trusted SSH CA keys")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list trusted SSH CA keys",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.String(http.StatusOK, keys)
+}
+
+// CreateBackup handles POST /api/v1/admin/backup, streaming a backup encrypted with the passphrase
+func (h *AdminHandler) CreateBackup(c *gin.Context) {
+	var req models.CreateBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	username, _ := middleware.GetUsernameFromContext(c)
+	filename := "deployknot-" + time.Now().UTC().Format("20060102-150405") + ".backup"
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	summary, err := h.backupService.Export(c.Request.Context(), c.Writer, req.Passphrase, req.WithoutLogs)
+	if err != nil {
+		h.logger.WithError(err).WithField("requested_by", username).Error("Failed to write backup")
+		// Once the archive has started, the status is sent; the truncated archive fails to restore
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to write backup",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"requested_by": username,
+		"rows":         summary.Rows,
+	}).Info("Backup downloaded")
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyHandler handles the API keys of the authenticated user
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+	logger        *logrus.Logger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService, logger *logrus.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+// CreateAPIKey handles POST /api/v1/api-keys. The key is only shown in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	key, err := h.apiKeyService.CreateAPIKey(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.apiKeyFailed(c, err, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys handles GET /api/v1/api-keys
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyService.ListAPIKeys(c.Request.Context(), userID)
+	if err != nil {
+		h.apiKeyFailed(c, err, "Failed to list API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+// DeleteAPIKey handles DELETE /api/v1/api-keys/:id
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid API key ID",
+			"message": "API key ID must be a valid UUID",
+		})
+		return
+	}
+
+	if err := h.apiKeyService.DeleteAPIKey(c.Request.Context(), userID, id); err != nil {
+		h.apiKeyFailed(c, err, "Failed to delete API key")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// apiKeyFailed maps an API key error to its response
+func (h *APIKeyHandler) apiKeyFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "API key already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "API key not found",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
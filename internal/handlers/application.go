@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ApplicationHandler handles applications and their releases
+type ApplicationHandler struct {
+	applicationService *services.ApplicationService
+	logger             *logrus.Logger
+}
+
+// NewApplicationHandler creates a new application handler
+func NewApplicationHandler(applicationService *services.ApplicationService, logger *logrus.Logger) *ApplicationHandler {
+	return &ApplicationHandler{
+		applicationService: applicationService,
+		logger:             logger,
+	}
+}
+
+// CreateApplication handles POST /api/v1/applications
+func (h *ApplicationHandler) CreateApplication(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.ApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	application, err := h.applicationService.CreateApplication(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.applicationFailed(c, err, "Failed to create application")
+		return
+	}
+
+	setETag(c, application.UpdatedAt)
+	c.JSON(http.StatusCreated, application)
+}
+
+// ListApplications handles GET /api/v1/applications
+func (h *ApplicationHandler) ListApplications(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	applications, err := h.applicationService.ListApplications(c.Request.Context(), userID)
+	if err != nil {
+		h.applicationFailed(c, err, "Failed to list applications")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"applications": applications,
+		"count":        len(applications),
+	})
+}
+
+// GetApplication handles GET /api/v1/applications/:id
+func (h *ApplicationHandler) GetApplication(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := applicationID(c)
+	if !ok {
+		return
+	}
+
+	application, err := h.applicationService.GetApplication(c.Request.Context(), userID, id)
+	if err != nil {
+		h.applicationFailed(c, err, "Failed to get application")
+		return
+	}
+
+	setETag(c, application.UpdatedAt)
+	c.JSON(http.StatusOK, application)
+}
+
+// UpdateApplication handles PUT /api/v1/applications/:id, honouring If-Match
+func (h *ApplicationHandler) UpdateApplication(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := applicationID(c)
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.ApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	application, err := h.applicationService.UpdateApplication(c.Request.Context(), userID, id, &req, expected)
+	if err != nil {
+		h.applicationFailed(c, err, "Failed to update application")
+		return
+	}
+
+	setETag(c, application.UpdatedAt)
+	c.JSON(http.StatusOK, application)
+}
+
+// DeleteApplication handles DELETE /api/v1/applications/:id, honouring If-Match
+func (h *ApplicationHandler) DeleteApplication(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := applicationID(c)
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.applicationService.DeleteApplication(c.Request.Context(), userID, id, expected); err != nil {
+		h.applicationFailed(c, err, "Failed to delete application")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateRelease handles POST /api/v1/applications/:id/releases
+func (h *ApplicationHandler) CreateRelease(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := applicationID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ApplicationReleaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	release, err := h.applicationService.CreateRelease(c.Request.Context(), userID, id, &req)
+	if err != nil {
+		if deploymentRejected(c, err) {
+			return
+		}
+		h.applicationFailed(c, err, "Failed to create application release")
+		return
+	}
+
+	c.JSON(http.StatusCreated, release)
+}
+
+// ListReleases handles GET /api/v1/applications/:id/releases
+func (h *ApplicationHandler) ListReleases(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := applicationID(c)
+	if !ok {
+		return
+	}
+
+	releases, err := h.applicationService.ListReleases(c.Request.Context(), userID, id)
+	if err != nil {
+		h.applicationFailed(c, err, "Failed to list application releases")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"releases": releases,
+		"count":    len(releases),
+	})
+}
+
+// GetRelease handles GET /api/v1/applications/:id/releases/:release_id
+func (h *ApplicationHandler) GetRelease(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := applicationID(c)
+	if !ok {
+		return
+	}
+	releaseID, err := uuid.Parse(c.Param("release_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid release ID",
+			"message": "Release ID must be a valid UUID",
+		})
+		return
+	}
+
+	release, err := h.applicationService.GetRelease(c.Request.Context(), userID, id, releaseID)
+	if err != nil {
+		h.applicationFailed(c, err, "Failed to get application release")
+		return
+	}
+
+	c.JSON(http.StatusOK, release)
+}
+
+// applicationFailed maps an application error to its response
+func (h *ApplicationHandler) applicationFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidApplication), errors.Is(err, services.ErrInvalidRelease):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrApplicationExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Application already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrApplicationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Application not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrReleaseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Release not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrPreconditionFailed):
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":   "Precondition failed",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// applicationID parses the application ID path parameter, responding with 400 when it is invalid
+func applicationID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid application ID",
+			"message": "Application ID must be a valid UUID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/database"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ArtifactHandler serves the files kept with deployments, such as their full build logs
+type ArtifactHandler struct {
+	artifactService *services.ArtifactService
+	logger          *logrus.Logger
+}
+
+// NewArtifactHandler creates a new artifact handler
+func NewArtifactHandler(artifactService *services.ArtifactService, logger *logrus.Logger) *ArtifactHandler {
+	return &ArtifactHandler{
+		artifactService: artifactService,
+		logger:          logger,
+	}
+}
+
+// ListArtifacts handles GET /api/v1/deployments/:id/artifacts
+func (h *ArtifactHandler) ListArtifacts(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	artifacts, err := h.artifactService.GetDeploymentArtifacts(c.Request.Context(), id)
+	if err != nil {
+		h.artifactFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"artifacts": artifacts,
+		"count":     len(artifacts),
+	})
+}
+
+// DownloadArtifact handles GET /api/v1/deployments/:id/artifacts/:name. Clients accepting gzip
+// receive the stored content as is, others receive it decompressed.
+func (h *ArtifactHandler) DownloadArtifact(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	artifact, err := h.artifactService.GetDeploymentArtifact(c.Request.Context(), id, c.Param("name"))
+	if err != nil {
+		h.artifactFailed(c, err)
+		return
+	}
+
+	// Artifacts are served as attachments so browsers never render them in the API's origin
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", artifact.Name))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Vary", "Accept-Encoding")
+
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(http.StatusOK, artifact.ContentType, artifact.Content)
+		return
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(artifact.Content))
+	if err != nil {
+		h.logger.WithError(err).WithField("deployment_id", id).Error("Stored artifact is not valid gzip")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to read artifact",
+			"message": "The stored artifact is corrupt",
+		})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", artifact.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(artifact.Size, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		h.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to stream artifact")
+	}
+}
+
+// artifactFailed responds to a failure to read the artifacts of a deployment
+func (h *ArtifactHandler) artifactFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrDeploymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": "The specified deployment does not exist",
+		})
+	case errors.Is(err, services.ErrArtifactNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Artifact not found",
+			"message": "The deployment has no artifact of that name",
+		})
+	default:
+		h.logger.WithError(err).Error("Failed to get deployment artifacts")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get artifacts",
+			"message": err.Error(),
+		})
+	}
+}
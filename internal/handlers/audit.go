@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListAuditEvents handles GET /api/v1/admin/audit-events
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	var filter models.AuditEventFilter
+	if eventType := c.Query("event_type"); eventType != "" {
+		t := models.AuditEventType(eventType)
+		filter.EventType = &t
+	}
+	if userIDStr := c.Query("user_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid user ID",
+				"message": "user_id must be a valid UUID",
+			})
+			return
+		}
+		filter.UserID = &userID
+	}
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid since parameter",
+				"message": "since must be an RFC 3339 timestamp",
+			})
+			return
+		}
+		filter.Since = &since
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, 500)
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	events, total, err := h.auditService.ListEvents(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list audit events")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list audit events",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"count":  len(events),
+	})
+}
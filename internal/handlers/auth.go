@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"deployknot/internal/middleware"
@@ -80,17 +81,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Generate JWT token
-	token, expiresAt, err := h.authMiddleware.GenerateToken(&models.User{
+	token, expiresAt, err := h.authMiddleware.GenerateToken(ctx, &models.User{
 		ID:       loginResponse.User.ID,
 		Username: loginResponse.User.Username,
 		Email:    loginResponse.User.Email,
-	})
+	}, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate JWT token")
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Authentication failed",
-			"message": "Failed to generate token",
-		})
+		tokenFailed(c, h.logger, err)
 		return
 	}
 
@@ -100,6 +97,23 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, loginResponse)
 }
 
+// tokenFailed responds to a failure to issue a token to a user signing in
+func tokenFailed(c *gin.Context, logger *logrus.Logger, err error) {
+	if errors.Is(err, middleware.ErrSessionStoreUnavailable) {
+		logger.WithError(err).Error("Failed to record session")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Service unavailable",
+			"message": "Unable to record the session",
+		})
+		return
+	}
+	logger.WithError(err).Error("Failed to generate JWT token")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Authentication failed",
+		"message": "Failed to generate token",
+	})
+}
+
 // GetProfile handles GET /api/v1/auth/profile
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, err := middleware.GetUserIDFromContext(c)
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// CIHandler handles deployments requested by CI pipelines with an API key
+type CIHandler struct {
+	ciService   *services.CIService
+	deployments *DeploymentHandler
+	logger      *logrus.Logger
+}
+
+// NewCIHandler creates a new CI handler. Log requests are served by the deployment handler once
+// access to the deployment was checked.
+func NewCIHandler(ciService *services.CIService, deployments *DeploymentHandler, logger *logrus.Logger) *CIHandler {
+	return &CIHandler{
+		ciService:   ciService,
+		deployments: deployments,
+		logger:      logger,
+	}
+}
+
+// Deploy handles POST /api/v1/ci/deploy
+func (h *CIHandler) Deploy(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.CIDeployRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response, err := h.ciService.Deploy(c.Request.Context(), userID, &req)
+	if err != nil {
+		if deploymentRejected(c, err) {
+			return
+		}
+		h.ciFailed(c, err, "Failed to create deployment")
+		return
+	}
+
+	c.Header("Location", response.StatusURL)
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetDeploymentStatus handles GET /api/v1/ci/deployments/:id. It responds with 202 while the
+// deployment is pending or running and with 200 and an exit code once it finished.
+func (h *CIHandler) GetDeploymentStatus(c *gin.Context) {
+	userID, id, ok := deploymentRequest(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.ciService.Status(c.Request.Context(), userID, id)
+	if err != nil {
+		h.ciFailed(c, err, "Failed to get deployment status")
+		return
+	}
+
+	if !status.Done {
+		c.JSON(http.StatusAccepted, status)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetDeploymentLogs handles GET /api/v1/ci/deployments/:id/logs, as a page of logs or, with
+// Accept: text/event-stream, as a stream
+func (h *CIHandler) GetDeploymentLogs(c *gin.Context) {
+	userID, id, ok := deploymentRequest(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.ciService.GetDeployment(c.Request.Context(), userID, id); err != nil {
+		h.ciFailed(c, err, "Failed to get deployment logs")
+		return
+	}
+
+	h.deployments.GetDeploymentLogs(c)
+}
+
+// ciFailed maps a CI deploy error to its response
+func (h *CIHandler) ciFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCIDeploy):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrCISourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "No deployment to repeat",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrCIDeploymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrCISourceUnusable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Deployment cannot be repeated",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// deploymentRequest returns the authenticated user and the deployment ID path parameter, responding
+// with 401 or 400 when either is missing or invalid
+func deploymentRequest(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
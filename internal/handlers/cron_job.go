@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deployknot/internal/database"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Page sizes of the runs of a cron deployment
+const (
+	defaultCronRunPageSize = 50
+	maxCronRunPageSize     = 500
+)
+
+// CronJobHandler handles the jobs of cron deployments and their runs
+type CronJobHandler struct {
+	cronJobService *services.CronJobService
+	logger         *logrus.Logger
+}
+
+// NewCronJobHandler creates a new cron job handler
+func NewCronJobHandler(cronJobService *services.CronJobService, logger *logrus.Logger) *CronJobHandler {
+	return &CronJobHandler{
+		cronJobService: cronJobService,
+		logger:         logger,
+	}
+}
+
+// ListRuns handles GET /api/v1/deployments/:id/cron-runs
+func (h *CronJobHandler) ListRuns(c *gin.Context) {
+	id, ok := cronDeploymentID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultCronRunPageSize
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, maxCronRunPageSize)
+		}
+	}
+
+	runs, err := h.cronJobService.ListRuns(c.Request.Context(), id, limit)
+	if err != nil {
+		h.cronJobFailed(c, err, "Failed to list cron job runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":  runs,
+		"count": len(runs),
+	})
+}
+
+// RemoveJob handles DELETE /api/v1/deployments/:id/cron
+func (h *CronJobHandler) RemoveJob(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := cronDeploymentID(c)
+	if !ok {
+		return
+	}
+
+	deployment, err := h.cronJobService.RemoveJob(c.Request.Context(), userID, id)
+	if err != nil {
+		h.cronJobFailed(c, err, "Failed to remove cron job")
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment)
+}
+
+// cronJobFailed maps a cron job error to its response
+func (h *CronJobHandler) cronJobFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrDeploymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": "The specified deployment does not exist",
+		})
+	case errors.Is(err, services.ErrCronJobForbidden):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrCronJobUnavailable):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Cron job unavailable",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// cronDeploymentID parses the deployment ID path parameter, responding with 400 when it is invalid
+func cronDeploymentID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -1,32 +1,46 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"deployknot/internal/database"
 	"deployknot/internal/middleware"
 	"deployknot/internal/models"
 	"deployknot/internal/services"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// defaultLogPageSize is the number of log entries returned when no page size is given
+	defaultLogPageSize = 100
+	// maxLogPageSize caps the page size a client may request
+	maxLogPageSize = 1000
+)
+
 // DeploymentHandler handles deployment-related HTTP requests
 type DeploymentHandler struct {
 	deploymentService *services.DeploymentService
+	preflightService  *services.PreflightService
 	logger            *logrus.Logger
 }
 
 // NewDeploymentHandler creates a new deployment handler
-func NewDeploymentHandler(deploymentService *services.DeploymentService, logger *logrus.Logger) *DeploymentHandler {
+func NewDeploymentHandler(deploymentService *services.DeploymentService, preflightService *services.PreflightService, logger *logrus.Logger) *DeploymentHandler {
 	return &DeploymentHandler{
 		deploymentService: deploymentService,
+		preflightService:  preflightService,
 		logger:            logger,
 	}
 }
@@ -62,11 +76,30 @@ func (h *DeploymentHandler) CreateDeployment(c *gin.Context) {
 		return
 	}
 
+	// Verify credentials before enqueueing so bad ones fail fast
+	if err := h.preflightService.Check(c.Request.Context(), &req); err != nil {
+		var preflightErr *services.PreflightError
+		if errors.As(err, &preflightErr) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "Pre-flight check failed",
+				"message": preflightErr.Error(),
+				"details": preflightErr.Failures,
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to run pre-flight checks")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Internal server error",
+			"message": "Failed to run pre-flight checks",
+		})
+		return
+	}
+
 	// Handle .env file upload
 	var envFilePath string
 	if file, err := c.FormFile("env_file"); err == nil && file != nil {
 		// Create temp directory if it doesn't exist
-		tempDir := "temp_env_files"
+		tempDir := models.EnvFileDir
 		if err := os.MkdirAll(tempDir, 0755); err != nil {
 			h.logger.WithError(err).Error("Failed to create temp directory")
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -87,12 +120,32 @@ func (h *DeploymentHandler) CreateDeployment(c *gin.Context) {
 			return
 		}
 
+		// Reject variable names that could be misinterpreted on the target
+		content, err := os.ReadFile(envFilePath)
+		if err == nil {
+			err = models.ValidateEnvContent(string(content))
+		}
+		if err != nil {
+			os.Remove(envFilePath)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"message": fmt.Sprintf("invalid env_file: %v", err),
+			})
+			return
+		}
+
 		h.logger.WithField("env_file_path", envFilePath).Info("Environment file uploaded successfully")
 	}
 
 	ctx := c.Request.Context()
 	deployment, err := h.deploymentService.CreateDeploymentWithEnvFile(ctx, &req, envFilePath, userID)
 	if err != nil {
+		if deploymentRejected(c, err) {
+			if envFilePath != "" {
+				os.Remove(envFilePath)
+			}
+			return
+		}
 		h.logger.WithError(err).Error("Failed to create deployment")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to create deployment",
@@ -101,6 +154,12 @@ func (h *DeploymentHandler) CreateDeployment(c *gin.Context) {
 		return
 	}
 
+	// The job is buffered and will be enqueued once Redis is reachable again
+	if deployment.EnqueueDeferred {
+		c.JSON(http.StatusAccepted, deployment)
+		return
+	}
+
 	c.JSON(http.StatusCreated, deployment)
 }
 
@@ -119,7 +178,7 @@ func (h *DeploymentHandler) GetDeployment(c *gin.Context) {
 	ctx := c.Request.Context()
 	deployment, err := h.deploymentService.GetDeployment(ctx, id)
 	if err != nil {
-		if err.Error() == "deployment not found" {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error":   "Deployment not found",
 				"message": "The specified deployment does not exist",
@@ -137,6 +196,225 @@ func (h *DeploymentHandler) GetDeployment(c *gin.Context) {
 	c.JSON(http.StatusOK, deployment)
 }
 
+// GetDeploymentDetail handles GET /api/v1/deployments/:id/full
+func (h *DeploymentHandler) GetDeploymentDetail(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	logLimit := defaultLogPageSize
+	if logsStr := c.Query("logs"); logsStr != "" {
+		if l, err := strconv.Atoi(logsStr); err == nil && l >= 0 {
+			logLimit = min(l, maxLogPageSize)
+		}
+	}
+
+	ctx := c.Request.Context()
+	detail, err := h.deploymentService.GetDeploymentDetail(ctx, id, logLimit)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": "The specified deployment does not exist",
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get deployment detail")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get deployment",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// CreateDeploymentComment handles POST /api/v1/deployments/:id/comments
+func (h *DeploymentHandler) CreateDeploymentComment(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	var req models.CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "Comment body must not be empty",
+		})
+		return
+	}
+
+	comment, err := h.deploymentService.AddDeploymentComment(c.Request.Context(), id, userID, req.Body)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": "The specified deployment does not exist",
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to add deployment comment")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to add comment",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// ResumeDeployment handles POST /api/v1/deployments/:id/resume
+func (h *DeploymentHandler) ResumeDeployment(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	deployment, err := h.deploymentService.ResumeDeployment(c.Request.Context(), id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrDeploymentNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": "The specified deployment does not exist",
+			})
+		case errors.Is(err, services.ErrResumeForbidden):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": err.Error(),
+			})
+		case errors.Is(err, services.ErrResumeUnavailable):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Deployment cannot be resumed",
+				"message": err.Error(),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to resume deployment")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to resume deployment",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, deployment)
+}
+
+// GetDeploymentComments handles GET /api/v1/deployments/:id/comments
+func (h *DeploymentHandler) GetDeploymentComments(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	comments, err := h.deploymentService.GetDeploymentComments(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": "The specified deployment does not exist",
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get deployment comments")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get comments",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"count":    len(comments),
+	})
+}
+
+// GetDeploymentChangelog handles GET /api/v1/deployments/:id/changelog
+func (h *DeploymentHandler) GetDeploymentChangelog(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	changelog, err := h.deploymentService.GetDeploymentChangelog(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": "The specified deployment does not exist",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrChangelogNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Changelog not found",
+				"message": "The deployment has no changelog; only deployments of a commit to an environment with an earlier completed deployment of a commit get one",
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get deployment changelog")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get changelog",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, changelog)
+}
+
 // GetDeploymentLogs handles GET /api/v1/deployments/:id/logs
 func (h *DeploymentHandler) GetDeploymentLogs(c *gin.Context) {
 	idStr := c.Param("id")
@@ -149,22 +427,35 @@ func (h *DeploymentHandler) GetDeploymentLogs(c *gin.Context) {
 		return
 	}
 
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid log filter",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	// Check if client accepts SSE
 	acceptHeader := c.GetHeader("Accept")
 	if acceptHeader == "text/event-stream" {
-		h.streamDeploymentLogs(c, id)
+		h.streamDeploymentLogs(c, id, filter)
 		return
 	}
 
-	// Return logs as JSON
-	limitStr := c.DefaultQuery("limit", "100")
-	limit, err := strconv.Atoi(limitStr)
+	// Return a page of logs as JSON; since and limit are accepted as aliases
+	afterSeq, err := parseAfterSeq(c)
 	if err != nil {
-		limit = 100
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid after_seq parameter",
+			"message": "after_seq must be a non-negative log sequence number",
+		})
+		return
 	}
+	pageSize := parsePageSize(c)
 
 	ctx := c.Request.Context()
-	logs, err := h.deploymentService.GetDeploymentLogs(ctx, id, limit)
+	page, err := h.deploymentService.GetDeploymentLogPage(ctx, id, afterSeq, pageSize, filter)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get deployment logs")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -174,9 +465,116 @@ func (h *DeploymentHandler) GetDeploymentLogs(c *gin.Context) {
 		return
 	}
 
+	// Logs are append-only, so the filter, the cursor and the last sequence identify the response
+	etag := fmt.Sprintf(`W/"logs-%s-%d-%d-%d-%d-%s"`, id, afterSeq, pageSize, len(page.Logs), page.NextAfterSeq, filterKey(filter))
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && match == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"deployment_id": id,
-		"logs":          logs,
+		"deployment_id":  id,
+		"logs":           page.Logs,
+		"after_seq":      page.AfterSeq,
+		"next_after_seq": page.NextAfterSeq,
+		"has_more":       page.HasMore,
+		"last_seq":       page.NextAfterSeq,
+	})
+}
+
+// parseAfterSeq reads the log cursor from after_seq, falling back to since
+func parseAfterSeq(c *gin.Context) (int64, error) {
+	value := c.Query("after_seq")
+	if value == "" {
+		value = c.Query("since")
+	}
+	if value == "" {
+		return 0, nil
+	}
+
+	seq, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid log sequence %q", value)
+	}
+	return seq, nil
+}
+
+// parseLogFilter reads the log categories and task names to return from category and task_name,
+// each given as a comma-separated list or repeated, and the least severe log level to return from
+// level
+func parseLogFilter(c *gin.Context) (models.DeploymentLogFilter, error) {
+	var filter models.DeploymentLogFilter
+	for _, name := range queryList(c, "category") {
+		category, ok := models.ParseLogCategory(name)
+		if !ok {
+			return filter, fmt.Errorf("unknown log category %q; see GET /api/v1/log-events for the categories", name)
+		}
+		filter.Categories = append(filter.Categories, category)
+	}
+	if value := c.Query("level"); value != "" {
+		level, ok := models.ParseLogLevel(value)
+		if !ok {
+			return filter, fmt.Errorf("unknown log level %q; use info, warn or error", value)
+		}
+		filter.Levels = level.AtLeast()
+	}
+	filter.TaskNames = queryList(c, "task_name")
+	return filter, nil
+}
+
+// queryList reads the values of a query parameter given as a comma-separated list or repeated
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, value := range c.QueryArray(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// filterKey identifies a log filter in ETags
+func filterKey(filter models.DeploymentLogFilter) string {
+	names := make([]string, len(filter.Categories))
+	for i, category := range filter.Categories {
+		names[i] = string(category)
+	}
+	sort.Strings(names)
+	levels := make([]string, len(filter.Levels))
+	for i, level := range filter.Levels {
+		levels[i] = string(level)
+	}
+	tasks := append([]string(nil), filter.TaskNames...)
+	sort.Strings(tasks)
+	return strings.Join(names, ",") + ";" + strings.Join(levels, ",") + ";" + strings.Join(tasks, ",")
+}
+
+// parsePageSize reads the page size from page_size, falling back to limit, and clamps it
+func parsePageSize(c *gin.Context) int {
+	value := c.Query("page_size")
+	if value == "" {
+		value = c.Query("limit")
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return defaultLogPageSize
+	}
+	if size > maxLogPageSize {
+		return maxLogPageSize
+	}
+	return size
+}
+
+// ListLogEvents handles GET /api/v1/log-events, the log categories and the catalog of log event
+// codes with their English templates, for clients that filter or translate deployment logs
+func (h *DeploymentHandler) ListLogEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"categories": models.LogCategories(),
+		"events":     models.LogEvents(),
 	})
 }
 
@@ -193,7 +591,7 @@ func (h *DeploymentHandler) GetDeploymentSteps(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
-	steps, err := h.deploymentService.GetDeploymentSteps(ctx, id)
+	steps, err := h.deploymentService.ListDeploymentSteps(ctx, id)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get deployment steps")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -210,7 +608,7 @@ func (h *DeploymentHandler) GetDeploymentSteps(c *gin.Context) {
 }
 
 // streamDeploymentLogs streams deployment logs via Server-Sent Events
-func (h *DeploymentHandler) streamDeploymentLogs(c *gin.Context, deploymentID uuid.UUID) {
+func (h *DeploymentHandler) streamDeploymentLogs(c *gin.Context, deploymentID uuid.UUID, filter models.DeploymentLogFilter) {
 	// Set headers for SSE
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
@@ -229,20 +627,43 @@ func (h *DeploymentHandler) streamDeploymentLogs(c *gin.Context, deploymentID uu
 	c.Writer.Flush()
 
 	ctx := c.Request.Context()
-	var lastLogID uuid.UUID
 
-	// Send initial logs
-	logs, err := h.deploymentService.GetDeploymentLogs(ctx, deploymentID, 50)
-	if err == nil {
-		for _, log := range logs {
-			c.SSEvent("log", log)
-			c.Writer.Flush()
-			if log.ID.String() > lastLogID.String() {
-				lastLogID = log.ID
+	// Resume after the last event the client saw when it reconnects
+	var afterSeq int64
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		if seq, err := strconv.ParseInt(lastEventID, 10, 64); err == nil && seq > 0 {
+			afterSeq = seq
+		}
+	}
+
+	// sendNewLogs drains every page after the cursor so a burst of logs is not delayed by the poll interval
+	sendNewLogs := func() {
+		for {
+			page, err := h.deploymentService.GetDeploymentLogPage(ctx, deploymentID, afterSeq, defaultLogPageSize, filter)
+			if err != nil {
+				h.logger.WithError(err).WithField("deployment_id", deploymentID).Warn("Failed to poll deployment logs")
+				return
+			}
+			for _, log := range page.Logs {
+				c.Render(-1, sse.Event{
+					Id:    strconv.FormatInt(log.Seq, 10),
+					Event: "log",
+					Data:  log,
+				})
+			}
+			if len(page.Logs) > 0 {
+				c.Writer.Flush()
+			}
+			afterSeq = page.NextAfterSeq
+			if !page.HasMore {
+				return
 			}
 		}
 	}
 
+	// Send initial logs
+	sendNewLogs()
+
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -253,18 +674,16 @@ func (h *DeploymentHandler) streamDeploymentLogs(c *gin.Context, deploymentID uu
 			return
 		case <-ticker.C:
 			// Poll for new logs
-			newLogs, err := h.deploymentService.GetDeploymentLogs(ctx, deploymentID, 100)
-			if err == nil {
-				for _, log := range newLogs {
-					if log.ID.String() > lastLogID.String() {
-						c.SSEvent("log", log)
-						c.Writer.Flush()
-						lastLogID = log.ID
-					}
-				}
+			sendNewLogs()
+			// Send heartbeat with the current status and progress
+			heartbeat := gin.H{"timestamp": time.Now().Format(time.RFC3339)}
+			if status, progress, err := h.deploymentService.GetDeploymentProgress(ctx, deploymentID); err == nil {
+				heartbeat["status"] = status
+				heartbeat["progress"] = progress
+			} else {
+				h.logger.WithError(err).WithField("deployment_id", deploymentID).Warn("Failed to compute deployment progress")
 			}
-			// Send heartbeat
-			c.SSEvent("heartbeat", gin.H{"timestamp": time.Now().Format(time.RFC3339)})
+			c.SSEvent("heartbeat", heartbeat)
 			c.Writer.Flush()
 		}
 	}
@@ -316,3 +735,98 @@ func (h *DeploymentHandler) GetDeployments(c *gin.Context) {
 		"count":       len(deployments),
 	})
 }
+
+// GetProjectStats handles GET /api/v1/projects/stats
+func (h *DeploymentHandler) GetProjectStats(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	project := c.Query("project")
+	if project == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "project is required (project name, or repository URL for deployments without one)",
+		})
+		return
+	}
+
+	window := services.DefaultStatsWindow
+	if windowStr := c.Query("window"); windowStr != "" {
+		if w, err := strconv.Atoi(windowStr); err == nil && w > 0 && w <= 200 {
+			window = w
+		}
+	}
+
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		if d, err := strconv.Atoi(daysStr); err == nil && d > 0 && d <= 365 {
+			days = d
+		}
+	}
+
+	stats, err := h.deploymentService.GetProjectStats(c.Request.Context(), userID, project, window, days)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get project stats")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get project stats",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// deploymentRejected responds to the errors a deployment is refused with and reports whether err
+// was one of them
+func deploymentRejected(c *gin.Context, err error) bool {
+	var quotaErr *services.QuotaError
+	var concurrencyErr *services.ConcurrencyError
+	var poolErr *services.WorkerPoolError
+	var freezeErr *services.FreezeError
+	var projectErr *services.ProjectAccessError
+	switch {
+	case errors.As(err, &quotaErr):
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Quota exceeded",
+			"message": quotaErr.Error(),
+		})
+	case errors.As(err, &concurrencyErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":              "Concurrency group busy",
+			"message":            concurrencyErr.Error(),
+			"active_deployments": concurrencyErr.Active,
+		})
+	case errors.As(err, &poolErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":       "Worker pool mismatch",
+			"message":     poolErr.Error(),
+			"worker_pool": poolErr.Required,
+		})
+	case errors.As(err, &freezeErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":        "Project frozen",
+			"message":      freezeErr.Error(),
+			"frozen_until": freezeErr.Window.EndsAt,
+		})
+	case errors.As(err, &projectErr):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Project access denied",
+			"message": projectErr.Error(),
+		})
+	case errors.Is(err, services.ErrSSHCredentialsRequired), errors.Is(err, services.ErrUnknownManagedService):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag sets the ETag header to the version of a resource last updated at updatedAt
+func setETag(c *gin.Context, updatedAt time.Time) {
+	c.Header("ETag", models.ETag(updatedAt))
+}
+
+// ifMatch returns the resource version the If-Match header requires, or nil when the header is
+// missing or "*". It responds with 412 when the header names no version DeployKnot issued.
+func ifMatch(c *gin.Context) (*time.Time, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	updatedAt, ok := models.ParseETag(header)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":   "Precondition failed",
+			"message": "If-Match must be an ETag returned by DeployKnot",
+		})
+		return nil, false
+	}
+	return &updatedAt, true
+}
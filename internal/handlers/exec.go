@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// maxExecFrameSize bounds the size of a frame received from an exec client
+const maxExecFrameSize = 64 * 1024
+
+// ExecHandler serves interactive shells in deployment containers over WebSocket
+type ExecHandler struct {
+	execService    *services.ExecService
+	allowedOrigins []string
+	logger         *logrus.Logger
+}
+
+// NewExecHandler creates a new exec handler. Browser clients must connect from one of the
+// allowed origins; "*" allows any origin.
+func NewExecHandler(execService *services.ExecService, allowedOrigins []string, logger *logrus.Logger) *ExecHandler {
+	return &ExecHandler{
+		execService:    execService,
+		allowedOrigins: allowedOrigins,
+		logger:         logger,
+	}
+}
+
+// execFrame is a frame received from an exec client along with its type
+type execFrame struct {
+	payloadType byte
+	data        []byte
+}
+
+// execFrameCodec receives frames without decoding them so text and binary frames can be told apart
+var execFrameCodec = websocket.Codec{
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		frame := v.(*execFrame)
+		frame.payloadType = payloadType
+		frame.data = data
+		return nil
+	},
+}
+
+// Exec handles GET /api/v1/deployments/:id/exec. The connection is upgraded to a WebSocket
+// proxying a shell in the deployment's container: binary frames carry terminal input and output,
+// text frames carry JSON control messages.
+func (h *ExecHandler) Exec(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	if !websocketRequested(c.Request) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "WebSocket required",
+			"message": "Exec sessions are served over a WebSocket connection",
+		})
+		return
+	}
+	if err := h.checkOrigin(c.Request); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	cols, _ := strconv.Atoi(c.Query("cols"))
+	rows, _ := strconv.Atoi(c.Query("rows"))
+
+	// The shell is opened before the upgrade so failures are reported as regular HTTP errors
+	session, err := h.execService.Open(c.Request.Context(), id, userID, c.ClientIP(), cols, rows)
+	if err != nil {
+		h.execFailed(c, err)
+		return
+	}
+
+	reason := "client disconnected"
+	server := websocket.Server{
+		// The origin was checked above
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			reason = h.serveExec(ws, session)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+
+	exitCode := h.execService.Finish(c.Request.Context(), session, reason)
+	h.logger.WithFields(logrus.Fields{
+		"exec_session_id": session.ID(),
+		"exit_code":       exitCode,
+	}).Debug("Exec connection closed")
+}
+
+// serveExec pumps terminal data between the WebSocket and the shell until either side ends or a
+// limit is reached, and returns why the session ended
+func (h *ExecHandler) serveExec(ws *websocket.Conn, session *services.ExecSession) string {
+	cfg := h.execService.Config()
+	ws.PayloadType = websocket.BinaryFrame
+	ws.MaxPayloadBytes = maxExecFrameSize
+	// Hijacked connections keep the server's deadlines; sessions are bounded by their own limits
+	ws.SetDeadline(time.Time{})
+
+	ended := make(chan string, 2)
+
+	// Terminal output
+	go func() {
+		if _, err := io.Copy(ws, session); err != nil {
+			ended <- "connection lost"
+			return
+		}
+		ended <- "shell exited"
+	}()
+
+	// Terminal input and control messages
+	go func() {
+		for {
+			ws.SetReadDeadline(time.Now().Add(cfg.IdleTimeout))
+			var frame execFrame
+			if err := execFrameCodec.Receive(ws, &frame); err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					ended <- "idle timeout"
+				} else {
+					ended <- "client disconnected"
+				}
+				return
+			}
+			if err := h.handleExecFrame(session, frame); err != nil {
+				websocket.JSON.Send(ws, models.ExecMessage{Type: models.ExecMessageError, Message: err.Error()})
+			}
+		}
+	}()
+
+	timer := time.NewTimer(cfg.MaxDuration)
+	defer timer.Stop()
+
+	var reason string
+	select {
+	case reason = <-ended:
+	case <-timer.C:
+		reason = "maximum session duration reached"
+	}
+
+	if reason == "shell exited" {
+		websocket.JSON.Send(ws, models.ExecMessage{Type: models.ExecMessageExit})
+	} else {
+		websocket.JSON.Send(ws, models.ExecMessage{Type: models.ExecMessageError, Message: "session ended: " + reason})
+	}
+	ws.Close()
+	return reason
+}
+
+// handleExecFrame forwards terminal input and applies control messages
+func (h *ExecHandler) handleExecFrame(session *services.ExecSession, frame execFrame) error {
+	if frame.payloadType == websocket.BinaryFrame {
+		_, err := session.Write(frame.data)
+		return err
+	}
+
+	var msg models.ExecMessage
+	if err := json.Unmarshal(frame.data, &msg); err != nil {
+		return fmt.Errorf("invalid control message: %w", err)
+	}
+	switch msg.Type {
+	case models.ExecMessageInput:
+		_, err := session.Write([]byte(msg.Data))
+		return err
+	case models.ExecMessageResize:
+		return session.Resize(msg.Cols, msg.Rows)
+	default:
+		return fmt.Errorf("unknown control message type %q", msg.Type)
+	}
+}
+
+// execFailed reports why a shell could not be opened
+func (h *ExecHandler) execFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrDeploymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": "The specified deployment does not exist",
+		})
+	case errors.Is(err, services.ErrExecDisabled):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Exec disabled",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrExecForbidden):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrExecUnavailable):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Container unavailable",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error("Failed to open exec session")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Failed to open exec session",
+			"message": err.Error(),
+		})
+	}
+}
+
+// GetExecSessions handles GET /api/v1/deployments/:id/exec/sessions
+func (h *ExecHandler) GetExecSessions(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	sessions, err := h.execService.GetExecSessions(c.Request.Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": "The specified deployment does not exist",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrExecSessionsForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get exec sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get exec sessions",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deployment_id": id,
+		"sessions":      sessions,
+	})
+}
+
+// websocketRequested reports whether the request asks for a WebSocket upgrade
+func websocketRequested(r *http.Request) bool {
+	return r.Method == http.MethodGet && headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerContainsToken reports whether a comma-separated header contains a token, ignoring case
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkOrigin rejects browser connections from origins outside the allowed list. Clients that
+// send no Origin header, such as command-line tools, are accepted.
+func (h *ExecHandler) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if _, err := url.ParseRequestURI(origin); err != nil {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
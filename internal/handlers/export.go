@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Export formats accepted by the format query parameter
+const (
+	exportFormatCSV    = "csv"
+	exportFormatJSON   = "json"
+	exportFormatNDJSON = "ndjson"
+)
+
+// exportFlushEvery is how many records are written between flushes to the client
+const exportFlushEvery = 100
+
+var deploymentExportColumns = []string{
+	"id", "created_at", "status", "project_name", "deployment_name", "deployment_type", "target_type",
+	"target_ip", "github_repo_url", "github_branch", "port", "container_name", "started_at",
+	"completed_at", "duration_seconds", "error_message",
+}
+
+var logExportColumns = []string{
+	"seq", "created_at", "log_level", "task_name", "step_order", "category", "event_code", "message",
+}
+
+// exportWriter streams records to the client as CSV, a JSON array or newline-delimited JSON.
+// Headers are only sent with the first record, so errors before it can still be reported as JSON.
+type exportWriter struct {
+	c        *gin.Context
+	format   string
+	filename string
+	columns  []string
+	csv      *csv.Writer
+	started  bool
+	count    int
+}
+
+func newExportWriter(c *gin.Context, format, name string, columns []string) *exportWriter {
+	return &exportWriter{
+		c:        c,
+		format:   format,
+		filename: fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102T150405Z"), format),
+		columns:  columns,
+	}
+}
+
+// parseExportFormat reads the format query parameter, defaulting to CSV
+func parseExportFormat(c *gin.Context) (string, bool) {
+	format := strings.ToLower(c.DefaultQuery("format", exportFormatCSV))
+	switch format {
+	case exportFormatCSV, exportFormatJSON, exportFormatNDJSON:
+		return format, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid format",
+		"message": fmt.Sprintf("format must be %q, %q or %q", exportFormatCSV, exportFormatJSON, exportFormatNDJSON),
+	})
+	return "", false
+}
+
+func (w *exportWriter) start() error {
+	w.started = true
+
+	contentType := "text/csv; charset=utf-8"
+	switch w.format {
+	case exportFormatJSON:
+		contentType = "application/json; charset=utf-8"
+	case exportFormatNDJSON:
+		contentType = "application/x-ndjson"
+	}
+	w.c.Header("Content-Type", contentType)
+	w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.filename))
+	w.c.Header("Cache-Control", "no-store")
+	w.c.Status(http.StatusOK)
+
+	switch w.format {
+	case exportFormatCSV:
+		w.csv = csv.NewWriter(w.c.Writer)
+		return w.csv.Write(w.columns)
+	case exportFormatJSON:
+		_, err := w.c.Writer.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+// write outputs one record; row holds its CSV cells in column order
+func (w *exportWriter) write(record interface{}, row []string) error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch w.format {
+	case exportFormatCSV:
+		err = w.csv.Write(row)
+	default:
+		var data []byte
+		data, err = json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if w.format == exportFormatJSON && w.count > 0 {
+			data = append([]byte(","), data...)
+		}
+		if w.format == exportFormatNDJSON {
+			data = append(data, '\n')
+		}
+		_, err = w.c.Writer.Write(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.count++
+	if w.count%exportFlushEvery == 0 {
+		w.flush()
+	}
+	return nil
+}
+
+// finish completes the export; empty exports still get headers and, for CSV, the column row
+func (w *exportWriter) finish() error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.format == exportFormatJSON {
+		if _, err := w.c.Writer.WriteString("]\n"); err != nil {
+			return err
+		}
+	}
+	w.flush()
+	if w.csv != nil {
+		return w.csv.Error()
+	}
+	return nil
+}
+
+func (w *exportWriter) flush() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	w.c.Writer.Flush()
+}
+
+// csvCell neutralizes values a spreadsheet would otherwise evaluate as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return csvCell(*value)
+}
+
+func optionalTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339)
+}
+
+func deploymentExportRow(d *models.DeploymentResponse) []string {
+	duration := ""
+	if d.StartedAt != nil && d.CompletedAt != nil {
+		duration = strconv.FormatFloat(d.CompletedAt.Sub(*d.StartedAt).Seconds(), 'f', 0, 64)
+	}
+	return []string{
+		d.ID.String(),
+		d.CreatedAt.UTC().Format(time.RFC3339),
+		string(d.Status),
+		optionalString(d.ProjectName),
+		optionalString(d.DeploymentName),
+		string(d.DeploymentType),
+		string(d.TargetType),
+		csvCell(d.TargetIP),
+		csvCell(d.GitHubRepoURL),
+		csvCell(d.GitHubBranch),
+		strconv.Itoa(d.Port),
+		optionalString(d.ContainerName),
+		optionalTime(d.StartedAt),
+		optionalTime(d.CompletedAt),
+		duration,
+		optionalString(d.ErrorMessage),
+	}
+}
+
+func logExportRow(log *models.DeploymentLog) []string {
+	stepOrder := ""
+	if log.StepOrder != nil {
+		stepOrder = strconv.Itoa(*log.StepOrder)
+	}
+	category, eventCode := "", ""
+	if log.Category != nil {
+		category = string(*log.Category)
+	}
+	if log.EventCode != nil {
+		eventCode = string(*log.EventCode)
+	}
+	return []string{
+		strconv.FormatInt(log.Seq, 10),
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		string(log.LogLevel),
+		optionalString(log.TaskName),
+		stepOrder,
+		category,
+		eventCode,
+		csvCell(log.Message),
+	}
+}
+
+// parseExportTime reads an optional RFC 3339 timestamp or YYYY-MM-DD date query parameter
+func parseExportTime(c *gin.Context, name string) (*time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid " + name,
+		"message": name + " must be an RFC 3339 timestamp or a YYYY-MM-DD date",
+	})
+	return nil, false
+}
+
+// ExportDeployments handles GET /api/v1/deployments/export
+func (h *DeploymentHandler) ExportDeployments(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+
+	filter := models.DeploymentFilter{UserID: &userID}
+	if statusStr := c.Query("status"); statusStr != "" {
+		status := models.DeploymentStatus(statusStr)
+		filter.Status = &status
+	}
+	if target := c.Query("target"); target != "" {
+		filter.TargetIP = &target
+	}
+	if targetTypeStr := c.Query("target_type"); targetTypeStr != "" {
+		targetType := models.TargetType(targetTypeStr)
+		filter.TargetType = &targetType
+	}
+	if project := c.Query("project"); project != "" {
+		filter.ProjectName = &project
+	}
+	if filter.CreatedAfter, ok = parseExportTime(c, "since"); !ok {
+		return
+	}
+	if filter.CreatedBefore, ok = parseExportTime(c, "until"); !ok {
+		return
+	}
+
+	w := newExportWriter(c, format, "deployments", deploymentExportColumns)
+	err = h.deploymentService.ExportDeployments(c.Request.Context(), filter, func(d *models.DeploymentResponse) error {
+		return w.write(d, deploymentExportRow(d))
+	})
+	if err == nil {
+		err = w.finish()
+	}
+	if err != nil {
+		h.exportFailed(c, w, err, "Failed to export deployments")
+	}
+}
+
+// ExportDeploymentLogs handles GET /api/v1/deployments/:id/logs/export
+func (h *DeploymentHandler) ExportDeploymentLogs(c *gin.Context) {
+	deploymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	format, ok := parseExportFormat(c)
+	if !ok {
+		return
+	}
+
+	w := newExportWriter(c, format, "deployment-"+deploymentID.String()+"-logs", logExportColumns)
+	err = h.deploymentService.ExportDeploymentLogs(c.Request.Context(), deploymentID, func(log *models.DeploymentLog) error {
+		return w.write(log, logExportRow(log))
+	})
+	if err == nil {
+		err = w.finish()
+	}
+	if err != nil {
+		if !w.started && errors.Is(err, database.ErrDeploymentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Deployment not found",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.exportFailed(c, w, err, "Failed to export deployment logs")
+	}
+}
+
+// exportFailed reports an export error as JSON if nothing was sent yet; otherwise the response
+// is already under way and is cut short
+func (h *DeploymentHandler) exportFailed(c *gin.Context, w *exportWriter, err error, message string) {
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	h.logger.WithError(err).Error(message)
+	if w.started {
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   message,
+		"message": err.Error(),
+	})
+}
+
+// DownloadDeploymentBundle handles GET /api/v1/deployments/:id/bundle, a zip archive with the
+// deployment, its effective configuration, steps, full log and container details, for attaching to
+// incident tickets. Secrets are redacted.
+func (h *DeploymentHandler) DownloadDeploymentBundle(c *gin.Context) {
+	deploymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="deployment-%s-bundle.zip"`, deploymentID))
+	err = h.deploymentService.WriteDeploymentBundle(c.Request.Context(), deploymentID, c.Writer)
+	if err == nil || c.Request.Context().Err() != nil {
+		return
+	}
+	if c.Writer.Written() {
+		// The archive is under way and is cut short
+		h.logger.WithError(err).Error("Failed to write deployment bundle")
+		c.Abort()
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Disposition")
+	if errors.Is(err, database.ErrDeploymentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": "The specified deployment does not exist",
+		})
+		return
+	}
+	h.logger.WithError(err).Error("Failed to write deployment bundle")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Failed to write deployment bundle",
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"deployknot/internal/database"
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// FileHandler serves read-only access to the files of deployment workspaces and containers
+type FileHandler struct {
+	fileService *services.FileService
+	logger      *logrus.Logger
+}
+
+// NewFileHandler creates a new file handler
+func NewFileHandler(fileService *services.FileService, logger *logrus.Logger) *FileHandler {
+	return &FileHandler{
+		fileService: fileService,
+		logger:      logger,
+	}
+}
+
+// fileRequest holds the parameters shared by the file endpoints
+type fileRequest struct {
+	userID       uuid.UUID
+	deploymentID uuid.UUID
+	source       models.FileSource
+	path         string
+}
+
+// parseFileRequest reads the deployment, source and path of a file request, responding with an
+// error and returning false when they are invalid
+func parseFileRequest(c *gin.Context) (*fileRequest, bool) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return nil, false
+	}
+
+	deploymentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid deployment ID",
+			"message": "Deployment ID must be a valid UUID",
+		})
+		return nil, false
+	}
+
+	source, err := models.ParseFileSource(c.Query("source"))
+	if err == nil {
+		err = models.ValidateFilePath(c.Query("path"))
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid file request",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	return &fileRequest{userID: userID, deploymentID: deploymentID, source: source, path: c.Query("path")}, true
+}
+
+// ListFiles handles GET /api/v1/deployments/:id/files
+func (h *FileHandler) ListFiles(c *gin.Context) {
+	req, ok := parseFileRequest(c)
+	if !ok {
+		return
+	}
+
+	listing, err := h.fileService.List(c.Request.Context(), req.deploymentID, req.userID, req.source, req.path)
+	if err != nil {
+		h.fileFailed(c, err, "Failed to list files")
+		return
+	}
+
+	c.JSON(http.StatusOK, listing)
+}
+
+// GetFileContent handles GET /api/v1/deployments/:id/files/content
+func (h *FileHandler) GetFileContent(c *gin.Context) {
+	req, ok := parseFileRequest(c)
+	if !ok {
+		return
+	}
+
+	entry, content, err := h.fileService.Fetch(c.Request.Context(), req.deploymentID, req.userID, req.source, req.path)
+	if err != nil {
+		h.fileFailed(c, err, "Failed to fetch file")
+		return
+	}
+
+	contentType := http.DetectContentType(content)
+	if !strings.HasPrefix(contentType, "text/") {
+		contentType = "application/octet-stream"
+	}
+	// Files are served as attachments so browsers never render them in the API's origin
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", entry.Name))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// fileFailed reports a file browser error
+func (h *FileHandler) fileFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrDeploymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": "The specified deployment does not exist",
+		})
+	case errors.Is(err, services.ErrFilesDisabled), errors.Is(err, services.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrFilesForbidden):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrFilesUnavailable):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Files unavailable",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrNotDirectory), errors.Is(err, services.ErrIsDirectory):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid file request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "File too large",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GateHandler handles the external checks deployments wait for
+type GateHandler struct {
+	gateService *services.GateService
+	logger      *logrus.Logger
+}
+
+// NewGateHandler creates a new gate handler
+func NewGateHandler(gateService *services.GateService, logger *logrus.Logger) *GateHandler {
+	return &GateHandler{
+		gateService: gateService,
+		logger:      logger,
+	}
+}
+
+// ListGates handles GET /api/v1/deployments/:id/gates
+func (h *GateHandler) ListGates(c *gin.Context) {
+	userID, id, ok := deploymentRequest(c)
+	if !ok {
+		return
+	}
+
+	gates, err := h.gateService.ListGates(c.Request.Context(), userID, id)
+	if err != nil {
+		h.gateFailed(c, err, "Failed to list deployment gates")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"gates": gates,
+		"count": len(gates),
+	})
+}
+
+// ReportGate handles POST /api/v1/deployments/:id/gates/:name
+func (h *GateHandler) ReportGate(c *gin.Context) {
+	userID, id, ok := deploymentRequest(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReportGateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	gate, err := h.gateService.ReportGate(c.Request.Context(), userID, id, c.Param("name"), &req)
+	if err != nil {
+		h.gateFailed(c, err, "Failed to report deployment gate")
+		return
+	}
+
+	c.JSON(http.StatusOK, gate)
+}
+
+// gateFailed maps a gate error to its response
+func (h *GateHandler) gateFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrGateDeploymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Deployment not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrGateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Gate not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrGateClosed):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Gate closed",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"time"
 
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -12,6 +18,9 @@ import (
 type HealthHandler struct {
 	db     DatabaseHealthChecker
 	redis  RedisHealthChecker
+	queue  QueueHealthChecker
+	leader LeaderChecker
+	config config.HealthConfig
 	logger *logrus.Logger
 }
 
@@ -25,28 +34,49 @@ type RedisHealthChecker interface {
 	HealthCheck() error
 }
 
+// QueueHealthChecker interface for deployment queue and worker health checks
+type QueueHealthChecker interface {
+	Health(ctx context.Context, staleAfter time.Duration) (*services.QueueHealth, error)
+	Workers(ctx context.Context, staleAfter time.Duration) ([]*models.WorkerInfo, error)
+}
+
+// LeaderChecker interface for whether this server runs the background components
+type LeaderChecker interface {
+	IsLeader() bool
+}
+
 // NewHealthHandler creates a new health handler
-func NewHealthHandler(db DatabaseHealthChecker, redis RedisHealthChecker, logger *logrus.Logger) *HealthHandler {
+func NewHealthHandler(db DatabaseHealthChecker, redis RedisHealthChecker, queue QueueHealthChecker, leader LeaderChecker, cfg config.HealthConfig, logger *logrus.Logger) *HealthHandler {
 	return &HealthHandler{
 		db:     db,
 		redis:  redis,
+		queue:  queue,
+		leader: leader,
+		config: cfg,
 		logger: logger,
 	}
 }
 
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Timestamp time.Time         `json:"timestamp"`
-	Services  map[string]string `json:"services"`
+	Status    string                `json:"status"`
+	Timestamp time.Time             `json:"timestamp"`
+	Services  map[string]string     `json:"services"`
+	Queue     *services.QueueHealth `json:"queue,omitempty"`
+	Issues    []string              `json:"issues,omitempty"`
+	// Leader reports whether this server runs the background components
+	Leader bool `json:"leader"`
 }
 
-// HealthCheck handles the health check endpoint
+// HealthCheck handles the readiness endpoint. It responds 503 when PostgreSQL or Redis is
+// unreachable, and reports "degraded" with 200 when the API is up but deployments are stuck
+// because no worker is alive or jobs have waited too long.
 func (h *HealthHandler) HealthCheck(c *gin.Context) {
 	response := HealthResponse{
 		Status:    "healthy",
 		Timestamp: time.Now(),
 		Services:  make(map[string]string),
+		Leader:    h.leader.IsLeader(),
 	}
 
 	// Check database health
@@ -67,14 +97,68 @@ func (h *HealthHandler) HealthCheck(c *gin.Context) {
 		response.Services["redis"] = "healthy"
 	}
 
+	// Check the deployment queue and workers
+	if response.Services["redis"] == "healthy" {
+		queue, err := h.queue.Health(c.Request.Context(), h.config.WorkerStaleAfter)
+		if err != nil {
+			response.Status = "unhealthy"
+			response.Services["queue"] = "unhealthy"
+			h.logger.WithError(err).Error("Queue health check failed")
+		} else {
+			response.Queue = queue
+			response.Issues = h.queueIssues(queue)
+			if len(response.Issues) > 0 {
+				response.Services["queue"] = "degraded"
+				if response.Status == "healthy" {
+					response.Status = "degraded"
+				}
+			} else {
+				response.Services["queue"] = "healthy"
+			}
+		}
+	}
+
 	// Set appropriate HTTP status code
-	if response.Status == "healthy" {
+	if response.Status != "unhealthy" {
 		c.JSON(http.StatusOK, response)
 	} else {
 		c.JSON(http.StatusServiceUnavailable, response)
 	}
 }
 
+// queueIssues lists the reasons deployments are not being processed
+func (h *HealthHandler) queueIssues(queue *services.QueueHealth) []string {
+	var issues []string
+	if queue.ActiveWorkers == 0 {
+		issues = append(issues, fmt.Sprintf("no worker heartbeat in the last %s", h.config.WorkerStaleAfter))
+	}
+	if queue.OldestPendingAgeSeconds != nil && *queue.OldestPendingAgeSeconds > h.config.MaxPendingAge.Seconds() {
+		issues = append(issues, fmt.Sprintf("oldest pending job has waited longer than %s", h.config.MaxPendingAge))
+	}
+	for _, pool := range queue.Pools {
+		if queue.ActiveWorkers > 0 && pool.Depth > 0 && pool.ActiveWorkers == 0 {
+			issues = append(issues, fmt.Sprintf("worker pool %q has pending jobs but no live worker", pool.Pool))
+		}
+	}
+	return issues
+}
+
+// ListWorkers lists the live workers with their pools, advertised capabilities and the deployments
+// they are processing
+func (h *HealthHandler) ListWorkers(c *gin.Context) {
+	workers, err := h.queue.Workers(c.Request.Context(), h.config.WorkerStaleAfter)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list workers")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list workers",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workers": workers})
+}
+
 // HealthCheck is a simple health check function for the router
 func HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
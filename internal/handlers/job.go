@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// JobHandler serves the history of deployment jobs
+type JobHandler struct {
+	jobService *services.JobService
+	logger     *logrus.Logger
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(jobService *services.JobService, logger *logrus.Logger) *JobHandler {
+	return &JobHandler{
+		jobService: jobService,
+		logger:     logger,
+	}
+}
+
+// ListJobs handles GET /api/v1/jobs, optionally filtered by ?deployment_id=, ?status= and ?pool=
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	filter := models.JobFilter{
+		Status: c.Query("status"),
+		Pool:   c.Query("pool"),
+	}
+	if deploymentIDStr := c.Query("deployment_id"); deploymentIDStr != "" {
+		deploymentID, err := uuid.Parse(deploymentIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid deployment ID",
+				"message": "Deployment ID must be a valid UUID",
+			})
+			return
+		}
+		filter.DeploymentID = &deploymentID
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	jobs, err := h.jobService.ListJobs(c.Request.Context(), userID, filter, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list jobs")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list jobs",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":   jobs,
+		"limit":  limit,
+		"offset": offset,
+		"count":  len(jobs),
+	})
+}
+
+// GetJob handles GET /api/v1/jobs/:id
+func (h *JobHandler) GetJob(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid job ID",
+			"message": "Job ID must be a valid UUID",
+		})
+		return
+	}
+
+	job, err := h.jobService.GetJob(c.Request.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Job not found",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get job")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get job",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ManagedServiceHandler handles managed services and their deployments
+type ManagedServiceHandler struct {
+	managedServiceService *services.ManagedServiceService
+	logger                *logrus.Logger
+}
+
+// NewManagedServiceHandler creates a new managed service handler
+func NewManagedServiceHandler(managedServiceService *services.ManagedServiceService, logger *logrus.Logger) *ManagedServiceHandler {
+	return &ManagedServiceHandler{
+		managedServiceService: managedServiceService,
+		logger:                logger,
+	}
+}
+
+// CreateManagedService handles POST /api/v1/managed-services
+func (h *ManagedServiceHandler) CreateManagedService(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.ManagedServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	service, err := h.managedServiceService.CreateManagedService(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.managedServiceFailed(c, err, "Failed to create managed service")
+		return
+	}
+
+	c.JSON(http.StatusCreated, service)
+}
+
+// ListManagedServices handles GET /api/v1/managed-services
+func (h *ManagedServiceHandler) ListManagedServices(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	managedServices, err := h.managedServiceService.ListManagedServices(c.Request.Context(), userID)
+	if err != nil {
+		h.managedServiceFailed(c, err, "Failed to list managed services")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"managed_services": managedServices,
+		"count":            len(managedServices),
+	})
+}
+
+// GetManagedService handles GET /api/v1/managed-services/:id
+func (h *ManagedServiceHandler) GetManagedService(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	service, err := h.managedServiceService.GetManagedService(c.Request.Context(), userID, id)
+	if err != nil {
+		h.managedServiceFailed(c, err, "Failed to get managed service")
+		return
+	}
+
+	c.JSON(http.StatusOK, service)
+}
+
+// UpdateManagedService handles PUT /api/v1/managed-services/:id
+func (h *ManagedServiceHandler) UpdateManagedService(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ManagedServiceUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	service, err := h.managedServiceService.UpdateManagedService(c.Request.Context(), userID, id, &req)
+	if err != nil {
+		h.managedServiceFailed(c, err, "Failed to update managed service")
+		return
+	}
+
+	c.JSON(http.StatusOK, service)
+}
+
+// DeleteManagedService handles DELETE /api/v1/managed-services/:id
+func (h *ManagedServiceHandler) DeleteManagedService(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.managedServiceService.DeleteManagedService(c.Request.Context(), userID, id); err != nil {
+		h.managedServiceFailed(c, err, "Failed to delete managed service")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DeployManagedService handles POST /api/v1/managed-services/:id/deployments
+func (h *ManagedServiceHandler) DeployManagedService(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ManagedServiceDeployRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	deployment, err := h.managedServiceService.DeployManagedService(c.Request.Context(), userID, id, &req)
+	if err != nil {
+		if deploymentRejected(c, err) {
+			return
+		}
+		h.managedServiceFailed(c, err, "Failed to deploy managed service")
+		return
+	}
+
+	c.JSON(http.StatusCreated, deployment)
+}
+
+// GetConnection handles GET /api/v1/managed-services/:id/connection
+func (h *ManagedServiceHandler) GetConnection(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	connection, err := h.managedServiceService.GetConnection(c.Request.Context(), userID, id)
+	if err != nil {
+		h.managedServiceFailed(c, err, "Failed to get managed service connection")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"environment": connection})
+}
+
+// managedServiceFailed maps a managed service error to its response
+func (h *ManagedServiceHandler) managedServiceFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidManagedService):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrManagedServiceExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Managed service already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrManagedServiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Managed service not found",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// managedServiceID parses the managed service ID path parameter, responding with 400 when it is
+// invalid
+func managedServiceID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid managed service ID",
+			"message": "Managed service ID must be a valid UUID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
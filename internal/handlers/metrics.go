@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MetricsHandler exports the deployment queue in machine-readable form for autoscalers
+type MetricsHandler struct {
+	autoscaler *services.Autoscaler
+	logger     *logrus.Logger
+}
+
+// NewMetricsHandler creates a new metrics handler
+func NewMetricsHandler(autoscaler *services.Autoscaler, logger *logrus.Logger) *MetricsHandler {
+	return &MetricsHandler{
+		autoscaler: autoscaler,
+		logger:     logger,
+	}
+}
+
+// QueueMetricsResponse represents the queue metrics response
+type QueueMetricsResponse struct {
+	Timestamp time.Time               `json:"timestamp"`
+	Queue     *services.QueueHealth   `json:"queue"`
+	Scaling   *services.ScalingAdvice `json:"scaling"`
+}
+
+// GetQueueMetrics handles GET /metrics/queue
+func (h *MetricsHandler) GetQueueMetrics(c *gin.Context) {
+	queue, advice, err := h.autoscaler.Evaluate(c.Request.Context())
+	if err != nil {
+		h.metricsFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, QueueMetricsResponse{
+		Timestamp: time.Now(),
+		Queue:     queue,
+		Scaling:   advice,
+	})
+}
+
+// GetPrometheusMetrics handles GET /metrics in the Prometheus text exposition format, with one
+// series per worker pool
+func (h *MetricsHandler) GetPrometheusMetrics(c *gin.Context) {
+	queue, advice, err := h.autoscaler.Evaluate(c.Request.Context())
+	if err != nil {
+		h.metricsFailed(c, err)
+		return
+	}
+
+	pools, advices := queue.Pools, advice.Pools
+	if len(pools) == 0 {
+		pools, advices = []*services.QueueHealth{queue}, []*services.ScalingAdvice{advice}
+	}
+
+	var b strings.Builder
+	writeGauge(&b, "deployknot_queue_depth", "Deployment jobs waiting in the queue.", pools, func(i int) float64 {
+		return float64(pools[i].Depth)
+	})
+	writeGauge(&b, "deployknot_queue_oldest_pending_age_seconds", "How long the oldest pending job has waited; 0 when the queue is empty.", pools, func(i int) float64 {
+		if pools[i].OldestPendingAgeSeconds == nil {
+			return 0
+		}
+		return *pools[i].OldestPendingAgeSeconds
+	})
+	writeGauge(&b, "deployknot_jobs_in_flight", "Deployment jobs being processed by live workers.", pools, func(i int) float64 {
+		return float64(pools[i].InFlight)
+	})
+	writeGauge(&b, "deployknot_workers_active", "Workers that sent a heartbeat recently.", pools, func(i int) float64 {
+		return float64(pools[i].ActiveWorkers)
+	})
+	writeGauge(&b, "deployknot_workers_desired", "Workers recommended for the current backlog.", pools, func(i int) float64 {
+		return float64(advices[i].DesiredWorkers)
+	})
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// writeGauge writes a gauge with its help and type lines and one sample per pool
+func writeGauge(b *strings.Builder, name, help string, pools []*services.QueueHealth, value func(i int) float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for i, pool := range pools {
+		fmt.Fprintf(b, "%s{pool=%q} %g\n", name, pool.Pool, value(i))
+	}
+}
+
+// metricsFailed responds to a failure to read the queue
+func (h *MetricsHandler) metricsFailed(c *gin.Context, err error) {
+	h.logger.WithError(err).Error("Failed to collect queue metrics")
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":   "Service unavailable",
+		"message": "Unable to read the deployment queue",
+	})
+}
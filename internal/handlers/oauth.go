@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// OAuthHandler handles signing in with OAuth and OIDC providers and linking identities
+type OAuthHandler struct {
+	oauthService   *services.OAuthService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewOAuthHandler creates a new OAuth handler
+func NewOAuthHandler(oauthService *services.OAuthService, authMiddleware *middleware.AuthMiddleware, logger *logrus.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService:   oauthService,
+		authMiddleware: authMiddleware,
+		logger:         logger,
+	}
+}
+
+// ListProviders handles GET /api/v1/auth/oauth/providers
+func (h *OAuthHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": h.oauthService.Providers(),
+	})
+}
+
+// Start handles GET /api/v1/auth/oauth/:provider/start by redirecting to the provider
+func (h *OAuthHandler) Start(c *gin.Context) {
+	authURL, cookie, err := h.oauthService.Start(c.Request.Context(), c.Param("provider"), nil)
+	if err != nil {
+		h.oauthFailed(c, err)
+		return
+	}
+
+	http.SetCookie(c.Writer, cookie)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Link handles POST /api/v1/auth/oauth/:provider/link. It returns the URL the user opens to link
+// an identity at the provider to their account, in the browser that made the request.
+func (h *OAuthHandler) Link(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	authURL, cookie, err := h.oauthService.Start(c.Request.Context(), c.Param("provider"), &userID)
+	if err != nil {
+		h.oauthFailed(c, err)
+		return
+	}
+
+	http.SetCookie(c.Writer, cookie)
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+	})
+}
+
+// Callback handles GET /api/v1/auth/oauth/:provider/callback
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		message := providerError
+		if description := c.Query("error_description"); description != "" {
+			message += ": " + description
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Sign-in cancelled",
+			"message": message,
+		})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "code and state are required",
+		})
+		return
+	}
+
+	// The state cookie is only good for one callback
+	binding, _ := c.Cookie(services.OAuthStateCookie)
+	http.SetCookie(c.Writer, h.oauthService.ClearStateCookie())
+	result, err := h.oauthService.Callback(c.Request.Context(), c.Param("provider"), code, state, binding)
+	if err != nil {
+		h.oauthFailed(c, err)
+		return
+	}
+
+	token, expiresAt, err := h.authMiddleware.GenerateToken(c.Request.Context(), result.User, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		tokenFailed(c, h.logger, err)
+		return
+	}
+
+	// Browsers are sent back to the frontend with the token in the fragment, which is never sent to servers
+	if redirectURL := h.oauthService.SuccessRedirectURL(); redirectURL != "" {
+		fragment := url.Values{
+			"token":      {token},
+			"expires_at": {expiresAt.UTC().Format(time.RFC3339)},
+			"provider":   {c.Param("provider")},
+		}
+		if result.Created {
+			fragment.Set("created", "true")
+		}
+		if result.Linked {
+			fragment.Set("linked", "true")
+		}
+		c.Redirect(http.StatusFound, redirectURL+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+		"user": models.UserInfo{
+			ID:        result.User.ID,
+			Username:  result.User.Username,
+			Email:     result.User.Email,
+			Role:      result.User.Role,
+			IsActive:  result.User.IsActive,
+			CreatedAt: result.User.CreatedAt,
+		},
+		"created": result.Created,
+		"linked":  result.Linked,
+	})
+}
+
+// GetIdentities handles GET /api/v1/auth/identities
+func (h *OAuthHandler) GetIdentities(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	identities, err := h.oauthService.GetIdentities(c.Request.Context(), userID)
+	if err != nil {
+		h.oauthFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"identities": identities,
+	})
+}
+
+// Unlink handles DELETE /api/v1/auth/identities/:provider
+func (h *OAuthHandler) Unlink(c *gin.Context) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return
+	}
+
+	if err := h.oauthService.Unlink(c.Request.Context(), userID, c.Param("provider")); err != nil {
+		h.oauthFailed(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// oauthFailed maps an OAuth error to its response
+func (h *OAuthHandler) oauthFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOAuthProviderNotFound), errors.Is(err, services.ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrOAuthStateInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid state",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrOAuthNotAllowed), errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Sign-in not allowed",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrOAuthAccountExists), errors.Is(err, services.ErrIdentityLinked),
+		errors.Is(err, services.ErrLastSignInMethod):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Conflict",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrOAuthFailed):
+		h.logger.WithError(err).Warn("OAuth sign-in failed")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Sign-in failed",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error("OAuth request failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Sign-in failed",
+			"message": err.Error(),
+		})
+	}
+}
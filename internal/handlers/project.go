@@ -0,0 +1,603 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// maxTimelineSpan bounds the period a project timeline covers
+const maxTimelineSpan = 366 * 24 * time.Hour
+
+// ProjectHandler handles projects with their targets and templates, project configuration import
+// and export, and project timelines
+type ProjectHandler struct {
+	projectService *services.ProjectService
+	logger         *logrus.Logger
+}
+
+// NewProjectHandler creates a new project handler
+func NewProjectHandler(projectService *services.ProjectService, logger *logrus.Logger) *ProjectHandler {
+	return &ProjectHandler{
+		projectService: projectService,
+		logger:         logger,
+	}
+}
+
+// ExportProject handles GET /api/v1/admin/projects/:id/export; the project is given by its ID or name
+func (h *ProjectHandler) ExportProject(c *gin.Context) {
+	cfg, err := h.projectService.ExportProject(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to export project")
+		return
+	}
+
+	data, err := services.MarshalProjectConfig(cfg)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to marshal project configuration")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to export project",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cfg.Project.Name+".yaml"))
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+}
+
+// ImportProject handles POST /api/v1/admin/projects/import. With dry_run=true the configuration is
+// only validated.
+func (h *ProjectHandler) ImportProject(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	cfg, err := services.ParseProjectConfig(body)
+	if err == nil {
+		err = services.ValidateProjectConfig(cfg)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid project configuration",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if c.Query("dry_run") == "true" {
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Project configuration is valid",
+			"project":        cfg.Project.Name,
+			"templates":      len(cfg.Templates),
+			"targets":        len(cfg.Targets),
+			"freeze_windows": len(cfg.FreezeWindows),
+		})
+		return
+	}
+
+	result, err := h.projectService.ImportProject(c.Request.Context(), cfg)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to import project")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to import project",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	status := http.StatusOK
+	if result.Created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, result)
+}
+
+// ListProjects handles GET /api/v1/admin/projects
+func (h *ProjectHandler) ListProjects(c *gin.Context) {
+	projects, err := h.projectService.ListProjects(c.Request.Context())
+	if err != nil {
+		h.projectFailed(c, err, "Failed to list projects")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"projects": projects,
+		"count":    len(projects),
+	})
+}
+
+// CreateProject handles POST /api/v1/admin/projects
+func (h *ProjectHandler) CreateProject(c *gin.Context) {
+	var spec models.ProjectSpec
+	if !bindProjectResource(c, &spec) {
+		return
+	}
+
+	project, err := h.projectService.CreateProject(c.Request.Context(), &spec)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to create project")
+		return
+	}
+
+	setETag(c, project.UpdatedAt)
+	c.JSON(http.StatusCreated, project)
+}
+
+// GetProject handles GET /api/v1/admin/projects/:id; the project is given by its ID or name
+func (h *ProjectHandler) GetProject(c *gin.Context) {
+	project, err := h.projectService.GetProject(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to get project")
+		return
+	}
+
+	setETag(c, project.UpdatedAt)
+	c.JSON(http.StatusOK, project)
+}
+
+// UpdateProject handles PUT /api/v1/admin/projects/:id, honouring If-Match
+func (h *ProjectHandler) UpdateProject(c *gin.Context) {
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+	var spec models.ProjectSpec
+	if !bindProjectResource(c, &spec) {
+		return
+	}
+
+	project, err := h.projectService.UpdateProject(c.Request.Context(), c.Param("id"), &spec, expected)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to update project")
+		return
+	}
+
+	setETag(c, project.UpdatedAt)
+	c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject handles DELETE /api/v1/admin/projects/:id, honouring If-Match
+func (h *ProjectHandler) DeleteProject(c *gin.Context) {
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.projectService.DeleteProject(c.Request.Context(), c.Param("id"), expected); err != nil {
+		h.projectFailed(c, err, "Failed to delete project")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetOnCall handles GET /api/v1/projects/:id/on-call: the owner of the project and who is on call
+// for it. The project is given by its ID or name.
+func (h *ProjectHandler) GetOnCall(c *gin.Context) {
+	contacts, err := h.projectService.GetContacts(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to get project on-call")
+		return
+	}
+
+	c.JSON(http.StatusOK, contacts)
+}
+
+// SetOnCall handles PUT /api/v1/projects/:id/on-call, called by external schedules at each handoff
+func (h *ProjectHandler) SetOnCall(c *gin.Context) {
+	var req models.ProjectOnCallRequest
+	if !bindProjectResource(c, &req) {
+		return
+	}
+
+	contacts, err := h.projectService.SetOnCall(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to set project on-call")
+		return
+	}
+
+	c.JSON(http.StatusOK, contacts)
+}
+
+// ClearOnCall handles DELETE /api/v1/projects/:id/on-call
+func (h *ProjectHandler) ClearOnCall(c *gin.Context) {
+	if err := h.projectService.ClearOnCall(c.Request.Context(), c.Param("id")); err != nil {
+		h.projectFailed(c, err, "Failed to clear project on-call")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RotateBadgeToken handles POST /api/v1/admin/projects/:id/badge-token; the new token is only
+// returned here and replaces the previous one
+func (h *ProjectHandler) RotateBadgeToken(c *gin.Context) {
+	token, err := h.projectService.RotateBadgeToken(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to rotate project badge token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// RevokeBadgeToken handles DELETE /api/v1/admin/projects/:id/badge-token
+func (h *ProjectHandler) RevokeBadgeToken(c *gin.Context) {
+	if err := h.projectService.RevokeBadgeToken(c.Request.Context(), c.Param("id")); err != nil {
+		h.projectFailed(c, err, "Failed to revoke project badge token")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListSigningKeys handles GET /api/v1/admin/projects/:id/signing-keys
+func (h *ProjectHandler) ListSigningKeys(c *gin.Context) {
+	keys, err := h.projectService.ListSigningKeys(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to list project signing keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"signing_keys": keys,
+		"count":        len(keys),
+	})
+}
+
+// AddSigningKey handles POST /api/v1/admin/projects/:id/signing-keys
+func (h *ProjectHandler) AddSigningKey(c *gin.Context) {
+	var req models.CreateProjectSigningKeyRequest
+	if !bindProjectResource(c, &req) {
+		return
+	}
+
+	key, err := h.projectService.AddSigningKey(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to add project signing key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// DeleteSigningKey handles DELETE /api/v1/admin/projects/:id/signing-keys/:key_id
+func (h *ProjectHandler) DeleteSigningKey(c *gin.Context) {
+	keyID, ok := projectResourceID(c, "key_id", "signing key")
+	if !ok {
+		return
+	}
+
+	if err := h.projectService.DeleteSigningKey(c.Request.Context(), c.Param("id"), keyID); err != nil {
+		h.projectFailed(c, err, "Failed to delete project signing key")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListTargets handles GET /api/v1/admin/projects/:id/targets
+func (h *ProjectHandler) ListTargets(c *gin.Context) {
+	targets, err := h.projectService.ListTargets(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to list project targets")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"targets": targets,
+		"count":   len(targets),
+	})
+}
+
+// CreateTarget handles POST /api/v1/admin/projects/:id/targets
+func (h *ProjectHandler) CreateTarget(c *gin.Context) {
+	var spec models.ProjectTargetSpec
+	if !bindProjectResource(c, &spec) {
+		return
+	}
+
+	target, err := h.projectService.CreateTarget(c.Request.Context(), c.Param("id"), &spec)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to create project target")
+		return
+	}
+
+	setETag(c, target.UpdatedAt)
+	c.JSON(http.StatusCreated, target)
+}
+
+// GetTarget handles GET /api/v1/admin/projects/:id/targets/:target_id
+func (h *ProjectHandler) GetTarget(c *gin.Context) {
+	targetID, ok := projectResourceID(c, "target_id", "target")
+	if !ok {
+		return
+	}
+
+	target, err := h.projectService.GetTarget(c.Request.Context(), c.Param("id"), targetID)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to get project target")
+		return
+	}
+
+	setETag(c, target.UpdatedAt)
+	c.JSON(http.StatusOK, target)
+}
+
+// UpdateTarget handles PUT /api/v1/admin/projects/:id/targets/:target_id, honouring If-Match
+func (h *ProjectHandler) UpdateTarget(c *gin.Context) {
+	targetID, ok := projectResourceID(c, "target_id", "target")
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+	var spec models.ProjectTargetSpec
+	if !bindProjectResource(c, &spec) {
+		return
+	}
+
+	target, err := h.projectService.UpdateTarget(c.Request.Context(), c.Param("id"), targetID, &spec, expected)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to update project target")
+		return
+	}
+
+	setETag(c, target.UpdatedAt)
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteTarget handles DELETE /api/v1/admin/projects/:id/targets/:target_id, honouring If-Match
+func (h *ProjectHandler) DeleteTarget(c *gin.Context) {
+	targetID, ok := projectResourceID(c, "target_id", "target")
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.projectService.DeleteTarget(c.Request.Context(), c.Param("id"), targetID, expected); err != nil {
+		h.projectFailed(c, err, "Failed to delete project target")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListTemplates handles GET /api/v1/admin/projects/:id/templates
+func (h *ProjectHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.projectService.ListTemplates(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.projectFailed(c, err, "Failed to list project templates")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"count":     len(templates),
+	})
+}
+
+// CreateTemplate handles POST /api/v1/admin/projects/:id/templates
+func (h *ProjectHandler) CreateTemplate(c *gin.Context) {
+	var spec models.ProjectTemplateSpec
+	if !bindProjectResource(c, &spec) {
+		return
+	}
+
+	template, err := h.projectService.CreateTemplate(c.Request.Context(), c.Param("id"), &spec)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to create project template")
+		return
+	}
+
+	setETag(c, template.UpdatedAt)
+	c.JSON(http.StatusCreated, template)
+}
+
+// GetTemplate handles GET /api/v1/admin/projects/:id/templates/:template_id
+func (h *ProjectHandler) GetTemplate(c *gin.Context) {
+	templateID, ok := projectResourceID(c, "template_id", "template")
+	if !ok {
+		return
+	}
+
+	template, err := h.projectService.GetTemplate(c.Request.Context(), c.Param("id"), templateID)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to get project template")
+		return
+	}
+
+	setETag(c, template.UpdatedAt)
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdateTemplate handles PUT /api/v1/admin/projects/:id/templates/:template_id, honouring If-Match
+func (h *ProjectHandler) UpdateTemplate(c *gin.Context) {
+	templateID, ok := projectResourceID(c, "template_id", "template")
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+	var spec models.ProjectTemplateSpec
+	if !bindProjectResource(c, &spec) {
+		return
+	}
+
+	template, err := h.projectService.UpdateTemplate(c.Request.Context(), c.Param("id"), templateID, &spec, expected)
+	if err != nil {
+		h.projectFailed(c, err, "Failed to update project template")
+		return
+	}
+
+	setETag(c, template.UpdatedAt)
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteTemplate handles DELETE /api/v1/admin/projects/:id/templates/:template_id, honouring If-Match
+func (h *ProjectHandler) DeleteTemplate(c *gin.Context) {
+	templateID, ok := projectResourceID(c, "template_id", "template")
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.projectService.DeleteTemplate(c.Request.Context(), c.Param("id"), templateID, expected); err != nil {
+		h.projectFailed(c, err, "Failed to delete project template")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// projectFailed maps a project error to its response
+func (h *ProjectHandler) projectFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidProjectConfig):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrProjectNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Project not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrProjectTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Target not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrProjectTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Template not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrProjectSigningKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Signing key not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrProjectExists), errors.Is(err, services.ErrProjectTargetExists),
+		errors.Is(err, services.ErrProjectTemplateExists), errors.Is(err, services.ErrProjectSigningKeyExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrPreconditionFailed):
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":   "Precondition failed",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// bindProjectResource binds the JSON body of a project, target or template request, responding
+// with 400 when it is invalid
+func bindProjectResource(c *gin.Context, resource interface{}) bool {
+	if err := c.ShouldBindJSON(resource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// projectResourceID parses the ID path parameter of a target, template or signing key, responding with 400
+// when it is invalid
+func projectResourceID(c *gin.Context, param, resource string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid " + resource + " ID",
+			"message": "The " + resource + " ID must be a valid UUID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// GetProjectTimeline handles GET /api/v1/projects/:id/timeline. The project is given by its ID or
+// name; since and until default to the last 30 days.
+func (h *ProjectHandler) GetProjectTimeline(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	since, ok := parseExportTime(c, "since")
+	if !ok {
+		return
+	}
+	until, ok := parseExportTime(c, "until")
+	if !ok {
+		return
+	}
+	if until == nil {
+		now := time.Now()
+		until = &now
+	}
+	if since == nil {
+		start := until.AddDate(0, 0, -30)
+		since = &start
+	}
+	if !since.Before(*until) || until.Sub(*since) > maxTimelineSpan {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "since must be before until and at most 366 days earlier",
+		})
+		return
+	}
+
+	timeline, err := h.projectService.Timeline(c.Request.Context(), userID, c.Param("id"), *since, *until)
+	if err != nil {
+		if errors.Is(err, services.ErrProjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Project not found",
+				"message": err.Error(),
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get project timeline")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get project timeline",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ScheduleHandler handles deployment schedules
+type ScheduleHandler struct {
+	scheduleService *services.ScheduleService
+	logger          *logrus.Logger
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(scheduleService *services.ScheduleService, logger *logrus.Logger) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: scheduleService,
+		logger:          logger,
+	}
+}
+
+// CreateSchedule handles POST /api/v1/schedules
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.DeploymentScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.scheduleService.CreateSchedule(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.scheduleFailed(c, err, "Failed to create schedule")
+		return
+	}
+
+	setETag(c, schedule.UpdatedAt)
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules handles GET /api/v1/schedules, optionally filtered by ?project=
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.scheduleService.ListSchedules(c.Request.Context(), userID, c.Query("project"))
+	if err != nil {
+		h.scheduleFailed(c, err, "Failed to list schedules")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+		"count":     len(schedules),
+	})
+}
+
+// GetSchedule handles GET /api/v1/schedules/:id
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduleService.GetSchedule(c.Request.Context(), userID, id)
+	if err != nil {
+		h.scheduleFailed(c, err, "Failed to get schedule")
+		return
+	}
+
+	setETag(c, schedule.UpdatedAt)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule handles PUT /api/v1/schedules/:id, honouring If-Match
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	var req models.DeploymentScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.scheduleService.UpdateSchedule(c.Request.Context(), userID, id, &req, expected)
+	if err != nil {
+		h.scheduleFailed(c, err, "Failed to update schedule")
+		return
+	}
+
+	setETag(c, schedule.UpdatedAt)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule handles DELETE /api/v1/schedules/:id, honouring If-Match
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	expected, ok := ifMatch(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleService.DeleteSchedule(c.Request.Context(), userID, id, expected); err != nil {
+		h.scheduleFailed(c, err, "Failed to delete schedule")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// scheduleFailed maps a schedule error to its response
+func (h *ScheduleHandler) scheduleFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrScheduleExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Schedule already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Schedule not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrPreconditionFailed):
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":   "Precondition failed",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// scheduleID parses the schedule ID path parameter, responding with 400 when it is invalid
+func scheduleID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid schedule ID",
+			"message": "Schedule ID must be a valid UUID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// scimFilterPattern matches the SCIM filters identity providers use to look users up,
+// such as `userName eq "alice"` or `active eq true`
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+(?:"((?:[^"\\]|\\.)*)"|(true|false))\s*$`)
+
+// Page sizes of SCIM user listings
+const (
+	defaultSCIMPageSize = 100
+	maxSCIMPageSize     = 500
+)
+
+// SCIMHandler implements the SCIM 2.0 Users endpoints identity providers provision users through
+type SCIMHandler struct {
+	userService *services.UserService
+	logger      *logrus.Logger
+}
+
+// NewSCIMHandler creates a new SCIM handler
+func NewSCIMHandler(userService *services.UserService, logger *logrus.Logger) *SCIMHandler {
+	return &SCIMHandler{
+		userService: userService,
+		logger:      logger,
+	}
+}
+
+// ServiceProviderConfig handles GET /scim/v2/ServiceProviderConfig
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{models.SCIMServiceProviderConfigSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxSCIMPageSize},
+		"changePassword": gin.H{"supported": true},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token configured in SCIM_TOKEN",
+			"primary":     true,
+		}},
+	})
+}
+
+// ListUsers handles GET /scim/v2/Users
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	filter, err := parseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	startIndex := 1
+	if s, err := strconv.Atoi(c.Query("startIndex")); err == nil && s > 1 {
+		startIndex = s
+	}
+	count := defaultSCIMPageSize
+	if n, err := strconv.Atoi(c.Query("count")); err == nil && n >= 0 {
+		count = min(n, maxSCIMPageSize)
+	}
+
+	users, total, err := h.userService.ListUsers(c.Request.Context(), filter, count, startIndex-1)
+	if err != nil {
+		h.scimFailed(c, err)
+		return
+	}
+
+	resources := make([]*models.SCIMUser, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toSCIMUser(user))
+	}
+	scimJSON(c, http.StatusOK, &models.SCIMListResponse{
+		Schemas:      []string{models.SCIMListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// GetUser handles GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(user))
+}
+
+// CreateUser handles POST /scim/v2/Users
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req models.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	active := req.Active == nil || *req.Active
+	user, err := h.userService.CreateUser(c.Request.Context(), &models.CreateUserRequest{
+		Username: req.UserName,
+		Email:    req.PrimaryEmail(),
+		Password: req.Password,
+		Role:     models.RoleUser,
+	}, active)
+	if err != nil {
+		h.scimFailed(c, err)
+		return
+	}
+
+	c.Header("Location", scimUserLocation(user))
+	scimJSON(c, http.StatusCreated, toSCIMUser(user))
+}
+
+// ReplaceUser handles PUT /scim/v2/Users/:id
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	user.Username = req.UserName
+	if email := req.PrimaryEmail(); email != "" {
+		user.Email = email
+	}
+	user.IsActive = req.Active == nil || *req.Active
+
+	user, err := h.userService.SaveUser(c.Request.Context(), user, req.Password)
+	if err != nil {
+		h.scimFailed(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(user))
+}
+
+// PatchUser handles PATCH /scim/v2/Users/:id. Changes to userName, emails, active and password
+// are applied; other attributes are accepted and ignored.
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	password := ""
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		case "remove":
+			continue
+		default:
+			scimError(c, http.StatusBadRequest, "invalidSyntax", "unsupported patch operation: "+op.Op)
+			return
+		}
+
+		attributes := map[string]interface{}{}
+		if op.Path != "" {
+			attributes[op.Path] = op.Value
+		} else if values, ok := op.Value.(map[string]interface{}); ok {
+			attributes = values
+		} else {
+			scimError(c, http.StatusBadRequest, "invalidValue", "patch operations without a path need an object value")
+			return
+		}
+
+		for path, value := range attributes {
+			if err := applySCIMAttribute(user, &password, path, value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		}
+	}
+
+	user, err := h.userService.SaveUser(c.Request.Context(), user, password)
+	if err != nil {
+		h.scimFailed(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toSCIMUser(user))
+}
+
+// DeleteUser handles DELETE /scim/v2/Users/:id. The user is deactivated rather than deleted, so
+// their deployment history is kept.
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	user.IsActive = false
+	if _, err := h.userService.SaveUser(c.Request.Context(), user, ""); err != nil {
+		h.scimFailed(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// loadUser reads the user named by the id path parameter, responding with a SCIM error when there is none
+func (h *SCIMHandler) loadUser(c *gin.Context) (*models.User, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	user, err := h.userService.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		h.scimFailed(c, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// scimFailed maps a user provisioning error to a SCIM error response
+func (h *SCIMHandler) scimFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidUser):
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, services.ErrUsernameTaken), errors.Is(err, services.ErrEmailTaken):
+		scimError(c, http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, services.ErrUserNotFound):
+		scimError(c, http.StatusNotFound, "", err.Error())
+	default:
+		h.logger.WithError(err).Error("SCIM request failed")
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+	}
+}
+
+// applySCIMAttribute sets one patched attribute on the user; unsupported attributes are ignored
+func applySCIMAttribute(user *models.User, password *string, path string, value interface{}) error {
+	switch strings.ToLower(path) {
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		user.IsActive = active
+	case "username":
+		username, ok := value.(string)
+		if !ok {
+			return errors.New("userName must be a string")
+		}
+		user.Username = username
+	case "password":
+		p, ok := value.(string)
+		if !ok {
+			return errors.New("password must be a string")
+		}
+		*password = p
+	case "emails":
+		emails, ok := value.([]interface{})
+		if !ok {
+			return errors.New("emails must be a list")
+		}
+		var primary, first string
+		for _, item := range emails {
+			email, _ := item.(map[string]interface{})
+			address, _ := email["value"].(string)
+			if address == "" {
+				continue
+			}
+			if first == "" {
+				first = address
+			}
+			if isPrimary, _ := email["primary"].(bool); isPrimary {
+				primary = address
+			}
+		}
+		if primary == "" {
+			primary = first
+		}
+		if primary != "" {
+			user.Email = primary
+		}
+	default:
+		// Paths such as emails[type eq "work"].value address a single email address
+		if strings.HasPrefix(strings.ToLower(path), "emails[") && strings.HasSuffix(strings.ToLower(path), "].value") {
+			address, ok := value.(string)
+			if !ok {
+				return errors.New("email value must be a string")
+			}
+			user.Email = address
+		}
+	}
+	return nil
+}
+
+// scimBool reads a boolean attribute value; some identity providers send "True" and "False" strings
+func scimBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		if err != nil {
+			return false, errors.New("active must be a boolean")
+		}
+		return b, nil
+	}
+	return false, errors.New("active must be a boolean")
+}
+
+// parseSCIMFilter turns a SCIM filter on userName, emails or active into a user filter
+func parseSCIMFilter(filter string) (models.UserFilter, error) {
+	var userFilter models.UserFilter
+	if strings.TrimSpace(filter) == "" {
+		return userFilter, nil
+	}
+
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return userFilter, errors.New("only filters of the form `attribute eq \"value\"` are supported")
+	}
+	attribute, value, literal := strings.ToLower(match[1]), strings.ReplaceAll(match[2], `\"`, `"`), strings.ToLower(match[3])
+
+	switch attribute {
+	case "username":
+		userFilter.Username = &value
+	case "emails", "emails.value":
+		userFilter.Email = &value
+	case "active":
+		active := literal == "true" || strings.EqualFold(value, "true")
+		userFilter.Active = &active
+	default:
+		return userFilter, errors.New("filtering on " + match[1] + " is not supported")
+	}
+	return userFilter, nil
+}
+
+// toSCIMUser returns the user in the SCIM core User schema
+func toSCIMUser(user *models.User) *models.SCIMUser {
+	active := user.IsActive
+	return &models.SCIMUser{
+		Schemas:  []string{models.SCIMUserSchema},
+		ID:       user.ID.String(),
+		UserName: user.Username,
+		Active:   &active,
+		Emails:   []models.SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Meta: &models.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimUserLocation(user),
+		},
+	}
+}
+
+// scimUserLocation returns the path of a user's SCIM resource
+func scimUserLocation(user *models.User) string {
+	return "/scim/v2/Users/" + user.ID.String()
+}
+
+// scimJSON writes a SCIM response with the SCIM media type
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", "application/scim+json; charset=utf-8")
+	c.JSON(status, body)
+}
+
+// scimError writes a SCIM error response
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	scimJSON(c, status, &models.SCIMError{
+		Schemas:  []string{models.SCIMErrorSchema},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
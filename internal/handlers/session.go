@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/middleware"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// SessionHandler handles listing and revoking the tokens issued to users
+type SessionHandler struct {
+	sessionService *services.SessionService
+	logger         *logrus.Logger
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionService *services.SessionService, logger *logrus.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		logger:         logger,
+	}
+}
+
+// ListSessions handles GET /api/v1/auth/sessions
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessionService.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		h.sessionFailed(c, err)
+		return
+	}
+
+	currentID := middleware.GetSessionIDFromContext(c)
+	for _, session := range sessions {
+		session.Current = currentID != "" && session.ID == currentID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSession handles DELETE /api/v1/auth/sessions/:id; the ID "current" revokes the session making the request
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	sessionID := c.Param("id")
+	if sessionID == "current" {
+		sessionID = middleware.GetSessionIDFromContext(c)
+		if sessionID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": "The token was issued without a session; revoke all sessions instead",
+			})
+			return
+		}
+	}
+
+	if err := h.sessionService.RevokeSession(c.Request.Context(), userID, sessionID); err != nil {
+		h.sessionFailed(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeAllSessions handles DELETE /api/v1/auth/sessions. With keep_current=true the session making
+// the request stays signed in.
+func (h *SessionHandler) RevokeAllSessions(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	keepSessionID := ""
+	if c.Query("keep_current") == "true" {
+		keepSessionID = middleware.GetSessionIDFromContext(c)
+		if keepSessionID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": "The token was issued without a session and cannot be kept",
+			})
+			return
+		}
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(c.Request.Context(), userID, keepSessionID)
+	if err != nil {
+		h.sessionFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revoked": revoked,
+	})
+}
+
+// RevokeUserSessions handles DELETE /api/v1/admin/users/:id/sessions
+func (h *SessionHandler) RevokeUserSessions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"message": "User ID must be a valid UUID",
+		})
+		return
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(c.Request.Context(), userID, "")
+	if err != nil {
+		h.sessionFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revoked": revoked,
+	})
+}
+
+// sessionFailed maps a session error to its response
+func (h *SessionHandler) sessionFailed(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Not found",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	h.logger.WithError(err).Error("Session request failed")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Session request failed",
+		"message": err.Error(),
+	})
+}
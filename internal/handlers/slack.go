@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// SlackHandler handles the Slack slash command and linking Slack accounts
+type SlackHandler struct {
+	slackService *services.SlackService
+	logger       *logrus.Logger
+}
+
+// NewSlackHandler creates a new Slack handler
+func NewSlackHandler(slackService *services.SlackService, logger *logrus.Logger) *SlackHandler {
+	return &SlackHandler{
+		slackService: slackService,
+		logger:       logger,
+	}
+}
+
+// Command handles POST /api/v1/slack/commands. Slack shows the reply to the user, so every outcome
+// is answered with 200 and a message.
+func (h *SlackHandler) Command(c *gin.Context) {
+	var cmd models.SlackCommand
+	if err := c.ShouldBind(&cmd); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response, err := h.slackService.HandleCommand(c.Request.Context(), &cmd)
+	if err != nil {
+		h.logger.WithError(err).WithField("slack_subject", cmd.SlackSubject()).Error("Failed to run Slack command")
+		response = &models.SlackResponse{
+			ResponseType: models.SlackResponseEphemeral,
+			Text:         "DeployKnot could not run the command. Try again later.",
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateLinkCode handles POST /api/v1/slack/link
+func (h *SlackHandler) CreateLinkCode(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	code, err := h.slackService.CreateLinkCode(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create Slack link code")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to create Slack link code",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, code)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// statusPageCSP allows the inline styles of the status page; it loads nothing else
+const statusPageCSP = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+
+// statusPageTemplate renders a project's status page without scripts or external resources
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"shortSHA": func(sha *string) string {
+		if sha == nil {
+			return "-"
+		}
+		if len(*sha) > 7 {
+			return (*sha)[:7]
+		}
+		return *sha
+	},
+	"environment": func(name string) string {
+		if name == "" {
+			return "(default)"
+		}
+		return name
+	},
+	"percent": func(rate *float64) string {
+		if rate == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", *rate*100)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Project}} status</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 860px; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2rem; }
+th, td { text-align: left; padding: .5rem; border-bottom: 1px solid #d0d7de; }
+code { font-family: ui-monospace, Menlo, monospace; }
+.status { font-weight: 600; }
+.completed, .healthy { color: #1a7f37; }
+.failed, .failing { color: #cf222e; }
+.running, .pending, .degraded { color: #9a6700; }
+.history { display: flex; gap: 2px; height: 2rem; }
+.history span { flex: 1; border-radius: 2px; background: #d0d7de; }
+.history .healthy { background: #2da44e; }
+.history .degraded { background: #d4a72c; }
+.history .failing { background: #cf222e; }
+.muted { color: #656d76; font-size: .875rem; }
+</style>
+</head>
+<body>
+<h1>{{.Project}}</h1>
+{{with .Description}}<p>{{.}}</p>{{end}}
+<h2>Environments</h2>
+{{if .Environments}}<table>
+<tr><th>Environment</th><th>Latest deployment</th><th>Commit</th><th>Live commit</th><th>Updated</th></tr>
+{{range .Environments}}<tr>
+<td>{{environment .Environment}}</td>
+<td class="status {{.Status}}">{{.Status}}</td>
+<td><code>{{shortSHA .CommitSHA}}</code> {{.GitHubBranch}}</td>
+<td><code>{{shortSHA .DeployedCommitSHA}}</code></td>
+<td>{{.UpdatedAt.UTC.Format "2006-01-02 15:04 UTC"}}</td>
+</tr>{{end}}
+</table>{{else}}<p class="muted">No deployments yet.</p>{{end}}
+<h2>History</h2>
+<div class="history">{{range .History}}<span class="{{.State}}" title="{{.Date}}: {{.Succeeded}} completed, {{.Failed}} failed"></span>{{end}}</div>
+<p class="muted">{{len .History}} days, {{percent .SuccessRate}} of finished deployments completed. Generated {{.GeneratedAt.Format "2006-01-02 15:04 UTC"}}.</p>
+</body>
+</html>
+`))
+
+// badgeTemplate renders a status badge in the style of shields.io
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">
+<title>{{.Label}}: {{.Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="#555"/><rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/><rect width="{{.Width}}" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelX}}" y="14">{{.Label}}</text><text x="{{.MessageX}}" y="14">{{.Message}}</text>
+</g>
+</svg>
+`))
+
+// Badge text is measured approximately, as 7 pixels per character of 11px Verdana
+const (
+	badgeCharWidth = 7
+	badgePadding   = 10
+)
+
+// badgeLayout positions the texts of a badge
+type badgeLayout struct {
+	*models.ProjectBadge
+	Width, LabelWidth, MessageWidth int
+	LabelX, MessageX                int
+}
+
+// StatusHandler serves the public status pages of projects that opt in, and the status badges of
+// projects; they need no account
+type StatusHandler struct {
+	projectService *services.ProjectService
+	config         config.StatusPageConfig
+	badges         config.BadgeConfig
+	logger         *logrus.Logger
+}
+
+// NewStatusHandler creates a new status page and badge handler
+func NewStatusHandler(projectService *services.ProjectService, cfg config.StatusPageConfig, badges config.BadgeConfig, logger *logrus.Logger) *StatusHandler {
+	return &StatusHandler{
+		projectService: projectService,
+		config:         cfg,
+		badges:         badges,
+		logger:         logger,
+	}
+}
+
+// GetBadge handles GET /api/v1/projects/:id/badge.svg, the status of a project's latest deployment as
+// an SVG badge. Projects without a public status page need their badge token in token; environment
+// selects a deployment name.
+func (h *StatusHandler) GetBadge(c *gin.Context) {
+	environment := c.Query("environment")
+	if len(environment) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": "environment must be at most 200 characters",
+		})
+		return
+	}
+
+	badge, err := h.projectService.Badge(c.Request.Context(), c.Param("id"), c.Query("token"), environment)
+	if err != nil {
+		if errors.Is(err, services.ErrProjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Project not found",
+				"message": "No badge exists for this project, or the token is wrong",
+			})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get project badge")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get project badge",
+			"message": "The project badge could not be loaded",
+		})
+		return
+	}
+
+	layout := badgeLayout{
+		ProjectBadge: badge,
+		LabelWidth:   len([]rune(badge.Label))*badgeCharWidth + badgePadding,
+		MessageWidth: len([]rune(badge.Message))*badgeCharWidth + badgePadding,
+	}
+	layout.Width = layout.LabelWidth + layout.MessageWidth
+	layout.LabelX = layout.LabelWidth / 2
+	layout.MessageX = layout.LabelWidth + layout.MessageWidth/2
+
+	var body bytes.Buffer
+	if err := badgeTemplate.Execute(&body, layout); err != nil {
+		h.logger.WithError(err).Error("Failed to render project badge")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to render project badge",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Badges of private projects must not be kept by shared caches
+	visibility := "private"
+	if badge.Public {
+		visibility = "public"
+	}
+	c.Header("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, int(h.badges.CacheMaxAge.Seconds())))
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", body.Bytes())
+}
+
+// GetStatus handles GET /api/v1/status/:id, the status of a project as JSON; the project is given by
+// its ID or name
+func (h *StatusHandler) GetStatus(c *gin.Context) {
+	page, ok := h.statusPage(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetStatusPage handles GET /status/:id, the status of a project as an HTML page
+func (h *StatusHandler) GetStatusPage(c *gin.Context) {
+	page, ok := h.statusPage(c)
+	if !ok {
+		return
+	}
+
+	var body bytes.Buffer
+	if err := statusPageTemplate.Execute(&body, page); err != nil {
+		h.logger.WithError(err).Error("Failed to render status page")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to render status page",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Security-Policy", statusPageCSP)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", body.Bytes())
+}
+
+// statusPage gets the status of the project in the request, writing the error response on failure
+func (h *StatusHandler) statusPage(c *gin.Context) (*models.ProjectStatusPage, bool) {
+	page, err := h.projectService.StatusPage(c.Request.Context(), c.Param("id"), h.config.HistoryDays)
+	if err != nil {
+		if errors.Is(err, services.ErrProjectNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Project not found",
+				"message": "No public status page exists for this project",
+			})
+			return nil, false
+		}
+		h.logger.WithError(err).Error("Failed to get project status")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get project status",
+			"message": "The project status could not be loaded",
+		})
+		return nil, false
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.config.CacheMaxAge.Seconds())))
+	return page, true
+}
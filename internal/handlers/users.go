@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListUsers handles GET /api/v1/admin/users
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var filter models.UserFilter
+	if username := c.Query("username"); username != "" {
+		filter.Username = &username
+	}
+	if email := c.Query("email"); email != "" {
+		filter.Email = &email
+	}
+	if activeStr := c.Query("active"); activeStr != "" {
+		active, err := strconv.ParseBool(activeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid active parameter",
+				"message": "active must be true or false",
+			})
+			return
+		}
+		filter.Active = &active
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, 500)
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	users, total, err := h.userService.ListUsers(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list users")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to list users",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	responses := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, userResponse(user))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"users":  responses,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"count":  len(responses),
+	})
+}
+
+// CreateUser handles POST /api/v1/admin/users
+func (h *AdminHandler) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userService.CreateUser(c.Request.Context(), &req, true)
+	if err != nil {
+		h.userFailed(c, err, "Failed to create user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, userResponse(user))
+}
+
+// UpdateUser handles PATCH /api/v1/admin/users/:id
+func (h *AdminHandler) UpdateUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"message": "User ID must be a valid UUID",
+		})
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Administrators cannot lock themselves out
+	if currentID, err := middleware.GetUserIDFromContext(c); err == nil && currentID == userID {
+		if (req.IsActive != nil && !*req.IsActive) || (req.Role != nil && *req.Role != models.RoleAdmin) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": "You cannot deactivate yourself or remove your own admin role",
+			})
+			return
+		}
+	}
+
+	user, err := h.userService.UpdateUser(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.userFailed(c, err, "Failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, userResponse(user))
+}
+
+// userFailed maps a user provisioning error to its response
+func (h *AdminHandler) userFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidUser):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrUsernameTaken), errors.Is(err, services.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "User already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "User not found",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// userResponse returns the user without sensitive fields
+func userResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		IsActive:  user.IsActive,
+		CreatedAt: user.CreatedAt,
+	}
+}
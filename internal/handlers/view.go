@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"deployknot/internal/middleware"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ViewHandler handles saved deployment views
+type ViewHandler struct {
+	viewService *services.ViewService
+	logger      *logrus.Logger
+}
+
+// NewViewHandler creates a new view handler
+func NewViewHandler(viewService *services.ViewService, logger *logrus.Logger) *ViewHandler {
+	return &ViewHandler{
+		viewService: viewService,
+		logger:      logger,
+	}
+}
+
+// CreateView handles POST /api/v1/views
+func (h *ViewHandler) CreateView(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	var req models.SavedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	view, err := h.viewService.CreateView(c.Request.Context(), userID, &req)
+	if err != nil {
+		h.viewFailed(c, err, "Failed to create saved view")
+		return
+	}
+
+	c.JSON(http.StatusCreated, view)
+}
+
+// ListViews handles GET /api/v1/views
+func (h *ViewHandler) ListViews(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+
+	views, err := h.viewService.ListViews(c.Request.Context(), userID)
+	if err != nil {
+		h.viewFailed(c, err, "Failed to list saved views")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"views": views,
+		"count": len(views),
+	})
+}
+
+// GetView handles GET /api/v1/views/:id
+func (h *ViewHandler) GetView(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := viewID(c)
+	if !ok {
+		return
+	}
+
+	view, err := h.viewService.GetView(c.Request.Context(), userID, id)
+	if err != nil {
+		h.viewFailed(c, err, "Failed to get saved view")
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// UpdateView handles PUT /api/v1/views/:id
+func (h *ViewHandler) UpdateView(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := viewID(c)
+	if !ok {
+		return
+	}
+
+	var req models.SavedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	view, err := h.viewService.UpdateView(c.Request.Context(), userID, id, &req)
+	if err != nil {
+		h.viewFailed(c, err, "Failed to update saved view")
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// DeleteView handles DELETE /api/v1/views/:id
+func (h *ViewHandler) DeleteView(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := viewID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.viewService.DeleteView(c.Request.Context(), userID, id); err != nil {
+		h.viewFailed(c, err, "Failed to delete saved view")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetViewDeployments handles GET /api/v1/views/:id/deployments
+func (h *ViewHandler) GetViewDeployments(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	id, ok := viewID(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, 500)
+		}
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	view, deployments, err := h.viewService.GetViewDeployments(c.Request.Context(), userID, id, limit, offset)
+	if err != nil {
+		h.viewFailed(c, err, "Failed to get saved view deployments")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"view":        view,
+		"deployments": deployments,
+		"limit":       limit,
+		"offset":      offset,
+		"count":       len(deployments),
+	})
+}
+
+// viewFailed maps a saved view error to its response
+func (h *ViewHandler) viewFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSavedView):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrSavedViewExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Saved view already exists",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrSavedViewNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Saved view not found",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// viewUser returns the authenticated user, responding with 401 when there is none
+func viewUser(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Unauthorized",
+			"message": "User not found in context",
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// viewID parses the saved view ID path parameter, responding with 400 when it is invalid
+func viewID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid view ID",
+			"message": "View ID must be a valid UUID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"deployknot/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// VolumeBackupHandler handles the backups of managed services
+type VolumeBackupHandler struct {
+	volumeBackupService *services.VolumeBackupService
+	logger              *logrus.Logger
+}
+
+// NewVolumeBackupHandler creates a new volume backup handler
+func NewVolumeBackupHandler(volumeBackupService *services.VolumeBackupService, logger *logrus.Logger) *VolumeBackupHandler {
+	return &VolumeBackupHandler{
+		volumeBackupService: volumeBackupService,
+		logger:              logger,
+	}
+}
+
+// ListBackups handles GET /api/v1/managed-services/:id/backups
+func (h *VolumeBackupHandler) ListBackups(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	serviceID, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	backups, err := h.volumeBackupService.ListBackups(c.Request.Context(), userID, serviceID)
+	if err != nil {
+		h.backupFailed(c, err, "Failed to list backups")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"backups": backups,
+		"count":   len(backups),
+	})
+}
+
+// CreateBackup handles POST /api/v1/managed-services/:id/backups
+func (h *VolumeBackupHandler) CreateBackup(c *gin.Context) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return
+	}
+	serviceID, ok := managedServiceID(c)
+	if !ok {
+		return
+	}
+
+	backup, err := h.volumeBackupService.CreateBackup(c.Request.Context(), userID, serviceID)
+	if err != nil {
+		h.backupFailed(c, err, "Failed to create backup")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, backup)
+}
+
+// GetBackup handles GET /api/v1/managed-services/:id/backups/:backup_id
+func (h *VolumeBackupHandler) GetBackup(c *gin.Context) {
+	userID, serviceID, backupID, ok := backupParams(c)
+	if !ok {
+		return
+	}
+
+	backup, err := h.volumeBackupService.GetBackup(c.Request.Context(), userID, serviceID, backupID)
+	if err != nil {
+		h.backupFailed(c, err, "Failed to get backup")
+		return
+	}
+
+	c.JSON(http.StatusOK, backup)
+}
+
+// RestoreBackup handles POST /api/v1/managed-services/:id/backups/:backup_id/restore
+func (h *VolumeBackupHandler) RestoreBackup(c *gin.Context) {
+	userID, serviceID, backupID, ok := backupParams(c)
+	if !ok {
+		return
+	}
+
+	backup, err := h.volumeBackupService.RestoreBackup(c.Request.Context(), userID, serviceID, backupID)
+	if err != nil {
+		h.backupFailed(c, err, "Failed to restore backup")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, backup)
+}
+
+// DeleteBackup handles DELETE /api/v1/managed-services/:id/backups/:backup_id
+func (h *VolumeBackupHandler) DeleteBackup(c *gin.Context) {
+	userID, serviceID, backupID, ok := backupParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.volumeBackupService.DeleteBackup(c.Request.Context(), userID, serviceID, backupID); err != nil {
+		h.backupFailed(c, err, "Failed to delete backup")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// backupFailed maps a volume backup error to its response
+func (h *VolumeBackupHandler) backupFailed(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrVolumeBackupsDisabled):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Volume backups disabled",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrManagedServiceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Managed service not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrVolumeBackupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Backup not found",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrVolumeBackupBusy), errors.Is(err, services.ErrVolumeBackupUnavailable):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Backup unavailable",
+			"message": err.Error(),
+		})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"message": err.Error(),
+		})
+	}
+}
+
+// backupParams returns the user and the managed service and backup IDs of a backup request,
+// responding with 400 when an ID is invalid
+func backupParams(c *gin.Context) (uuid.UUID, uuid.UUID, uuid.UUID, bool) {
+	userID, ok := viewUser(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	serviceID, ok := managedServiceID(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	backupID, err := uuid.Parse(c.Param("backup_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid backup ID",
+			"message": "Backup ID must be a valid UUID",
+		})
+		return uuid.Nil, uuid.Nil, uuid.Nil, false
+	}
+	return userID, serviceID, backupID, true
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ActiveUserLookup reports whether a user exists and is active
+type ActiveUserLookup func(ctx context.Context, userID uuid.UUID) (bool, error)
+
+// RequireActiveUser rejects requests from users who were deactivated or deleted after their token
+// was issued, so offboarding takes effect immediately. It must run after AuthRequired.
+func RequireActiveUser(lookup ActiveUserLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := GetUserIDFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "User not found in context",
+			})
+			return
+		}
+
+		active, err := lookup(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Unable to determine user status",
+			})
+			return
+		}
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "Account is deactivated",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// StaticBearerToken allows the request only when it carries the given bearer token, as identity
+// providers do for SCIM provisioning
+func StaticBearerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"schemas": []string{models.SCIMErrorSchema},
+				"status":  "401",
+				"detail":  "A valid bearer token is required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// NetworkLookup returns the organization of a user and the networks it allows sensitive requests
+// from; empty networks allow any
+type NetworkLookup func(ctx context.Context, userID uuid.UUID) (*uuid.UUID, []*net.IPNet, error)
+
+// AuditRecorder records an audit event
+type AuditRecorder func(ctx context.Context, event *models.AuditEvent)
+
+// IPAllowlist rejects requests whose client IP is outside the global networks, when any are set, or
+// outside the networks of the user's organization, when it has any. Blocked requests are recorded
+// through record. It must run after AuthRequired.
+func IPAllowlist(global []*net.IPNet, lookup NetworkLookup, record AuditRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := GetUserIDFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "User not found in context",
+			})
+			return
+		}
+
+		organizationID, networks, err := lookup(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Unable to determine allowed networks",
+			})
+			return
+		}
+
+		clientIP := c.ClientIP()
+		ip := net.ParseIP(clientIP)
+		reason := ""
+		switch {
+		case len(global) > 0 && !containsIP(global, ip):
+			reason = "client IP is not in the global allowlist"
+		case len(networks) > 0 && !containsIP(networks, ip):
+			reason = "client IP is not in the organization allowlist"
+		}
+
+		if reason != "" {
+			username, _ := GetUsernameFromContext(c)
+			record(c.Request.Context(), &models.AuditEvent{
+				EventType:      models.AuditEventIPBlocked,
+				UserID:         &userID,
+				Username:       username,
+				OrganizationID: organizationID,
+				IPAddress:      clientIP,
+				Method:         c.Request.Method,
+				Path:           c.FullPath(),
+				Reason:         reason,
+			})
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "Requests from this IP address are not allowed",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// containsIP reports whether ip is in any of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
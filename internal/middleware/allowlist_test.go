@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// allowlistRequest sends a request from remoteAddr claiming forwardedFor through IPAllowlist, allowing
+// 203.0.113.0/24, on a router trusting the given proxies, and returns its status
+func allowlistRequest(t *testing.T, proxies []string, remoteAddr, forwardedFor string) int {
+	t.Helper()
+	_, global, err := net.ParseCIDR("203.0.113.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(ctx context.Context, userID uuid.UUID) (*uuid.UUID, []*net.IPNet, error) { return nil, nil, nil }
+	record := func(ctx context.Context, event *models.AuditEvent) {}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		t.Fatal(err)
+	}
+	router.GET("/", func(c *gin.Context) { c.Set("user_id", uuid.New()) }, IPAllowlist([]*net.IPNet{global}, lookup, record),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestIPAllowlistIgnoresForwardingHeadersOfUntrustedClients(t *testing.T) {
+	if code := allowlistRequest(t, nil, "198.51.100.7:4000", "203.0.113.5"); code != http.StatusForbidden {
+		t.Errorf("client claiming an allowed IP without trusted proxies: got %d, want 403", code)
+	}
+	if code := allowlistRequest(t, nil, "203.0.113.5:4000", "198.51.100.7"); code != http.StatusOK {
+		t.Errorf("allowed client without trusted proxies: got %d, want 200", code)
+	}
+	if code := allowlistRequest(t, []string{"10.0.0.1"}, "10.0.0.1:4000", "203.0.113.5"); code != http.StatusOK {
+		t.Errorf("allowed client through a trusted proxy: got %d, want 200", code)
+	}
+	if code := allowlistRequest(t, []string{"10.0.0.1"}, "198.51.100.7:4000", "203.0.113.5"); code != http.StatusForbidden {
+		t.Errorf("client claiming an allowed IP past the trusted proxy: got %d, want 403", code)
+	}
+}
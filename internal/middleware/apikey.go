@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyLookup returns the active user an API key belongs to, or nil when the key is not valid
+type APIKeyLookup func(ctx context.Context, key string) (*models.User, error)
+
+// APIKeyAuth authenticates requests with an API key, sent as a bearer token or in the X-API-Key
+// header. It sets the same context values as AuthRequired.
+func APIKeyAuth(lookup APIKeyLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			key = c.GetHeader("X-API-Key")
+		}
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "No API key provided",
+			})
+			return
+		}
+
+		user, err := lookup(c.Request.Context(), key)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Unable to verify API key",
+			})
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "Invalid or expired API key",
+			})
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Set("email", user.Email)
+		c.Next()
+	}
+}
+
+// APIKeyOrToken authenticates requests with an API key when one is sent and with auth otherwise,
+// for endpoints that both users and CI pipelines call
+func APIKeyOrToken(lookup APIKeyLookup, auth gin.HandlerFunc) gin.HandlerFunc {
+	apiKey := APIKeyAuth(lookup)
+	return func(c *gin.Context) {
+		bearer, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if c.GetHeader("X-API-Key") != "" || strings.HasPrefix(bearer, models.APIKeyPrefix) {
+			apiKey(c)
+			return
+		}
+		auth(c)
+	}
+}
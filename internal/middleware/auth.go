@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -22,20 +24,56 @@ type JWTClaims struct {
 	jwt.RegisteredClaims
 }
 
+// JWTKey is a secret used to sign or verify tokens, identified by the token's "kid" header
+type JWTKey struct {
+	ID     string
+	Secret string
+}
+
+// ErrSessionStoreUnavailable is returned when a token is not issued because its session could not
+// be recorded
+var ErrSessionStoreUnavailable = errors.New("session store is unavailable")
+
+// tokenLifetime is how long issued tokens are valid
+const tokenLifetime = 7 * 24 * time.Hour
+
+// SessionStore records the tokens issued at sign-in so they can be listed and revoked
+type SessionStore interface {
+	// CreateSession records a newly issued token
+	CreateSession(ctx context.Context, session *models.Session) error
+	// ValidateSession reports whether a token is still valid. Tokens without a session ID were
+	// issued before sessions were recorded and are only checked against a revocation of all sessions.
+	ValidateSession(ctx context.Context, userID uuid.UUID, sessionID string, issuedAt time.Time) (bool, error)
+}
+
 // AuthMiddleware handles JWT authentication
 type AuthMiddleware struct {
-	jwtSecret []byte
-	logger    *logrus.Logger
+	signingKey JWTKey
+	keys       map[string][]byte
+	sessions   SessionStore
+	logger     *logrus.Logger
 }
 
-// NewAuthMiddleware creates a new auth middleware
-func NewAuthMiddleware(jwtSecret string, logger *logrus.Logger) *AuthMiddleware {
+// NewAuthMiddleware creates a new auth middleware. Tokens are signed with signingKey and
+// verified against it and any additional keys, which lets old tokens survive a secret rotation.
+func NewAuthMiddleware(signingKey JWTKey, logger *logrus.Logger, verifyKeys ...JWTKey) *AuthMiddleware {
+	keys := map[string][]byte{signingKey.ID: []byte(signingKey.Secret)}
+	for _, key := range verifyKeys {
+		keys[key.ID] = []byte(key.Secret)
+	}
+
 	return &AuthMiddleware{
-		jwtSecret: []byte(jwtSecret),
-		logger:    logger,
+		signingKey: signingKey,
+		keys:       keys,
+		logger:     logger,
 	}
 }
 
+// SetSessionStore makes the middleware record issued tokens in store and reject revoked ones
+func (m *AuthMiddleware) SetSessionStore(store SessionStore) {
+	m.sessions = store
+}
+
 // AuthRequired middleware that requires authentication
 func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -60,8 +98,36 @@ func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		// Revoked sessions are rejected. While the store is unreachable no token is accepted, since a
+		// revoked one cannot be told apart.
+		if m.sessions != nil {
+			var issuedAt time.Time
+			if claims.IssuedAt != nil {
+				issuedAt = claims.IssuedAt.Time
+			}
+			valid, err := m.sessions.ValidateSession(c.Request.Context(), claims.UserID, claims.ID, issuedAt)
+			if err != nil {
+				m.logger.WithError(err).Error("Failed to check session")
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error":   "Service unavailable",
+					"message": "Unable to check the session",
+				})
+				c.Abort()
+				return
+			}
+			if !valid {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "Unauthorized",
+					"message": "Session has been revoked",
+				})
+				c.Abort()
+				return
+			}
+		}
+
 		// Set user info in context
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.ID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
 
@@ -86,13 +152,37 @@ func (m *AuthMiddleware) extractToken(c *gin.Context) string {
 
 // validateToken validates the JWT token and returns claims
 func (m *AuthMiddleware) validateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	keyFunc := func(secret []byte) jwt.Keyfunc {
+		return func(token *jwt.Token) (interface{}, error) {
+			// Validate the signing method
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return secret, nil
 		}
-		return m.jwtSecret, nil
-	})
+	}
+
+	unverified, _, err := jwt.NewParser().ParseUnverified(tokenString, &JWTClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	var token *jwt.Token
+	if kid, ok := unverified.Header["kid"].(string); ok {
+		secret, known := m.keys[kid]
+		if !known {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+		token, err = jwt.ParseWithClaims(tokenString, &JWTClaims{}, keyFunc(secret))
+	} else {
+		// Tokens issued before key IDs were introduced carry no kid; try every known key
+		for _, secret := range m.keys {
+			token, err = jwt.ParseWithClaims(tokenString, &JWTClaims{}, keyFunc(secret))
+			if err == nil {
+				break
+			}
+		}
+	}
 
 	if err != nil {
 		return nil, err
@@ -105,25 +195,47 @@ func (m *AuthMiddleware) validateToken(tokenString string) (*JWTClaims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
-// GenerateToken generates a JWT token for a user
-func (m *AuthMiddleware) GenerateToken(user *models.User) (string, time.Time, error) {
-	expiresAt := time.Now().Add(7 * 24 * time.Hour) // 1 week
+// GenerateToken generates a JWT token for a user signing in from the given client, recording it
+// as a session when a session store is set. A token whose session cannot be recorded could not be
+// revoked, so none is issued then and ErrSessionStoreUnavailable is returned.
+func (m *AuthMiddleware) GenerateToken(ctx context.Context, user *models.User, userAgent, clientIP string) (string, time.Time, error) {
+	issuedAt := time.Now()
+	expiresAt := issuedAt.Add(tokenLifetime)
+
+	sessionID := ""
+	if m.sessions != nil {
+		session := &models.Session{
+			ID:        uuid.New().String(),
+			UserID:    user.ID,
+			Device:    models.DescribeDevice(userAgent),
+			UserAgent: userAgent,
+			IPAddress: clientIP,
+			IssuedAt:  issuedAt,
+			ExpiresAt: expiresAt,
+		}
+		if err := m.sessions.CreateSession(ctx, session); err != nil {
+			return "", time.Time{}, fmt.Errorf("%w: %w", ErrSessionStoreUnavailable, err)
+		}
+		sessionID = session.ID
+	}
 
 	claims := &JWTClaims{
 		UserID:   user.ID,
 		Username: user.Username,
 		Email:    user.Email,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(issuedAt),
 			Issuer:    "deployknot",
 			Subject:   user.ID.String(),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(m.jwtSecret)
+	token.Header["kid"] = m.signingKey.ID
+	tokenString, err := token.SignedString([]byte(m.signingKey.Secret))
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -146,6 +258,11 @@ func GetUserIDFromContext(c *gin.Context) (uuid.UUID, error) {
 	return userID, nil
 }
 
+// GetSessionIDFromContext returns the session ID of the request's token, or "" when it has none
+func GetSessionIDFromContext(c *gin.Context) string {
+	return c.GetString("session_id")
+}
+
 // GetUsernameFromContext gets the username from the context
 func GetUsernameFromContext(c *gin.Context) (string, error) {
 	usernameInterface, exists := c.Get("username")
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeSessionStore keeps sessions in memory and fails every call while err is set
+type fakeSessionStore struct {
+	sessions map[string]*models.Session
+	err      error
+}
+
+func (s *fakeSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *fakeSessionStore) ValidateSession(ctx context.Context, userID uuid.UUID, sessionID string, issuedAt time.Time) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	session, ok := s.sessions[sessionID]
+	return ok && session.UserID == userID, nil
+}
+
+// newTestAuth returns a middleware recording sessions in a fake store
+func newTestAuth() (*AuthMiddleware, *fakeSessionStore) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	auth := NewAuthMiddleware(JWTKey{ID: "test", Secret: "auth-test-secret-0123456789abcdefghij"}, logger)
+	store := &fakeSessionStore{sessions: map[string]*models.Session{}}
+	auth.SetSessionStore(store)
+	return auth, store
+}
+
+// request sends an authenticated request through AuthRequired and returns its status
+func request(auth *AuthMiddleware, token string) int {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", auth.AuthRequired(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestAuthRequiredChecksSessions(t *testing.T) {
+	auth, store := newTestAuth()
+	token, _, err := auth.GenerateToken(context.Background(), &models.User{ID: uuid.New(), Username: "alice"}, "curl/8", "203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := request(auth, token); code != http.StatusOK {
+		t.Fatalf("request with a recorded session: got %d, want 200", code)
+	}
+
+	store.err = errors.New("connection refused")
+	if code := request(auth, token); code != http.StatusServiceUnavailable {
+		t.Errorf("request while the session store fails: got %d, want 503", code)
+	}
+
+	store.err = nil
+	clear(store.sessions)
+	if code := request(auth, token); code != http.StatusUnauthorized {
+		t.Errorf("request with a revoked session: got %d, want 401", code)
+	}
+}
+
+func TestGenerateTokenRequiresSession(t *testing.T) {
+	auth, store := newTestAuth()
+	store.err = errors.New("connection refused")
+
+	token, _, err := auth.GenerateToken(context.Background(), &models.User{ID: uuid.New(), Username: "alice"}, "curl/8", "203.0.113.1")
+	if !errors.Is(err, ErrSessionStoreUnavailable) {
+		t.Fatalf("GenerateToken while the session store fails: got %v, want ErrSessionStoreUnavailable", err)
+	}
+	if token != "" {
+		t.Errorf("GenerateToken issued a token without a session")
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriter compresses the response body of a request
+type gzipWriter struct {
+	gin.ResponseWriter
+	gz       *gzip.Writer
+	decided  bool
+	disabled bool
+}
+
+// WriteHeader enables compression for responses that carry a body
+func (w *gzipWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.decided = true
+		if code == http.StatusNoContent || code == http.StatusNotModified || w.Header().Get("Content-Encoding") != "" {
+			w.disabled = true
+		} else {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Del("Content-Length")
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(w.Status())
+	}
+	if w.disabled {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush flushes compressed data so streamed responses keep flowing
+func (w *gzipWriter) Flush() {
+	if !w.disabled {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Gzip compresses responses for clients that accept gzip encoding. Server-sent event
+// streams and WebSocket upgrades are left uncompressed.
+func Gzip(level int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") ||
+			strings.Contains(c.GetHeader("Accept"), "text/event-stream") ||
+			c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		gz, err := gzip.NewWriterLevel(c.Writer, level)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Accept-Encoding")
+		writer := &gzipWriter{ResponseWriter: c.Writer, gz: gz}
+		c.Writer = writer
+		defer func() {
+			if !writer.decided {
+				// Nothing was written, so leave the response uncompressed
+				writer.disabled = true
+			}
+			if !writer.disabled {
+				gz.Close()
+			}
+		}()
+
+		c.Next()
+	}
+}
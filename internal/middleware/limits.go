@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadRule constrains a single multipart file field
+type UploadRule struct {
+	MaxSize    int64
+	Extensions []string // Allowed lowercase extensions; "" allows files without one
+	TextOnly   bool
+}
+
+// sniffLength is the number of bytes inspected to detect binary uploads
+const sniffLength = 512
+
+// BodySizeLimit rejects request bodies larger than maxBytes with 413 Request Entity Too Large
+func BodySizeLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			abortTooLarge(c, fmt.Sprintf("Request body must not exceed %d bytes", maxBytes))
+			return
+		}
+		// Bodies without a declared length are cut off while being read
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// UploadConstraints parses multipart requests within maxMemory and enforces rules on their file fields
+func UploadConstraints(maxMemory int64, rules map[string]UploadRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			c.Next()
+			return
+		}
+
+		if err := c.Request.ParseMultipartForm(maxMemory); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				abortTooLarge(c, fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit))
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"message": fmt.Sprintf("Failed to parse multipart form: %v", err),
+			})
+			return
+		}
+
+		for field, rule := range rules {
+			for _, file := range c.Request.MultipartForm.File[field] {
+				if status, message := checkUpload(file, rule); status != 0 {
+					c.AbortWithStatusJSON(status, gin.H{
+						"error":   http.StatusText(status),
+						"message": fmt.Sprintf("%s: %s", field, message),
+					})
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// checkUpload validates an uploaded file against rule, returning a status code and message on failure
+func checkUpload(file *multipart.FileHeader, rule UploadRule) (int, string) {
+	if rule.MaxSize > 0 && file.Size > rule.MaxSize {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("file must not exceed %d bytes", rule.MaxSize)
+	}
+
+	if len(rule.Extensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		allowed := false
+		for _, e := range rule.Extensions {
+			if ext == e {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return http.StatusUnsupportedMediaType, fmt.Sprintf("file extension %q is not allowed", ext)
+		}
+	}
+
+	if rule.TextOnly {
+		f, err := file.Open()
+		if err != nil {
+			return http.StatusBadRequest, "failed to read file"
+		}
+		defer f.Close()
+
+		head := make([]byte, sniffLength)
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return http.StatusBadRequest, "failed to read file"
+		}
+		head = head[:n]
+		if bytes.IndexByte(head, 0) >= 0 || !strings.HasPrefix(http.DetectContentType(head), "text/") {
+			return http.StatusUnsupportedMediaType, "file must be a text file"
+		}
+	}
+
+	return 0, ""
+}
+
+// abortTooLarge aborts the request with 413 Request Entity Too Large
+func abortTooLarge(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":   "Request entity too large",
+		"message": message,
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"deployknot/internal/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OrganizationLookup returns the organization of a user when it uses row-level isolation, and nil otherwise
+type OrganizationLookup func(ctx context.Context, userID uuid.UUID) (*uuid.UUID, error)
+
+// OrganizationScope scopes the request to the authenticated user's organization when that organization
+// uses row-level isolation, so database reads made on its behalf only see the organization's data.
+// It must run after AuthRequired.
+func OrganizationScope(lookup OrganizationLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := GetUserIDFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "User not found in context",
+			})
+			return
+		}
+
+		organizationID, err := lookup(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   "Internal server error",
+				"message": "Unable to determine user organization",
+			})
+			return
+		}
+
+		if organizationID != nil {
+			c.Set("organization_id", *organizationID)
+			c.Request = c.Request.WithContext(database.ContextWithOrganization(c.Request.Context(), *organizationID))
+		}
+		c.Next()
+	}
+}
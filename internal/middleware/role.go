@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"deployknot/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RoleLookup returns the current role of a user
+type RoleLookup func(ctx context.Context, userID uuid.UUID) (models.Role, error)
+
+// RequireRole allows the request only when the authenticated user holds one of the given roles.
+// The role is read through lookup on every request so that changes apply without reissuing tokens.
+// It must run after AuthRequired.
+func RequireRole(lookup RoleLookup, roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := GetUserIDFromContext(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Unauthorized",
+				"message": "User not found in context",
+			})
+			return
+		}
+
+		role, err := lookup(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": "Unable to determine user role",
+			})
+			return
+		}
+
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Set("role", role)
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Forbidden",
+			"message": "Insufficient permissions",
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeploymentFilter narrows a deployment listing; nil fields are not filtered on
+type DeploymentFilter struct {
+	UserID         *uuid.UUID
+	Username       *string
+	Status         *DeploymentStatus
+	TargetIP       *string
+	TargetType     *TargetType
+	ProjectName    *string
+	DeploymentName *string
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+}
+
+// UserQuota reports a user's deployment usage against the configured limits
+type UserQuota struct {
+	UserID               uuid.UUID `json:"user_id"`
+	Username             string    `json:"username"`
+	Role                 Role      `json:"role"`
+	ActiveDeployments    int       `json:"active_deployments"`
+	DeploymentsLast24h   int       `json:"deployments_last_24h"`
+	TotalDeployments     int       `json:"total_deployments"`
+	MaxActiveDeployments int       `json:"max_active_deployments"`
+	MaxDeploymentsPerDay int       `json:"max_deployments_per_day"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize
+const APIKeyPrefix = "dk_"
+
+// APIKey authenticates a CI pipeline as the user who created it. Only a hash of the key is stored;
+// the key itself is shown once, when it is created.
+type APIKey struct {
+	ID     uuid.UUID `json:"id" db:"id"`
+	UserID uuid.UUID `json:"user_id" db:"user_id"`
+	Name   string    `json:"name" db:"name"`
+	// Prefix is the start of the key, to tell keys apart
+	Prefix     string     `json:"prefix" db:"key_prefix"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Expired reports whether the key has expired at t
+func (k *APIKey) Expired(t time.Time) bool {
+	return k.ExpiresAt != nil && !t.Before(*k.ExpiresAt)
+}
+
+// CreateAPIKeyRequest represents the request to create an API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// ExpiresInDays is how long the key is valid; 0 means it does not expire
+	ExpiresInDays int `json:"expires_in_days" binding:"min=0,max=3650"`
+}
+
+// CreatedAPIKey is a newly created API key together with the key itself
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
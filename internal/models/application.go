@@ -0,0 +1,386 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// applicationNamePattern matches application and service names such as "shop" or "api". Both
+// become part of container and network names and services reach each other by name, so they are
+// restricted to DNS labels.
+var applicationNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// maxApplicationServices bounds the number of services of an application
+const maxApplicationServices = 20
+
+// ApplicationReleaseGate is the gate that holds the deployment of a service of an application
+// release until the deployments of the services it waits for have completed
+const ApplicationReleaseGate = "application-release"
+
+// Conditions a service waits for before its container starts
+const (
+	// DependencyHealthy waits for the container of the dependency to run and, when its image
+	// defines a HEALTHCHECK, to be healthy
+	DependencyHealthy = "healthy"
+	// DependencyPortOpen waits for the port of the dependency to accept connections on the target
+	DependencyPortOpen = "port_open"
+)
+
+// Application groups the container services a user deploys together, such as an api, a worker
+// and a frontend. A release deploys the services in their order, each after the services it
+// depends on, on a network shared by the application, where each service is reachable by its name.
+type Application struct {
+	ID          uuid.UUID            `json:"id" db:"id"`
+	UserID      uuid.UUID            `json:"user_id" db:"user_id"`
+	Name        string               `json:"name" db:"name"`
+	Description *string              `json:"description,omitempty" db:"description"`
+	Services    []ApplicationService `json:"services" db:"services"`
+	CreatedAt   time.Time            `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at" db:"updated_at"`
+}
+
+// ApplicationService is a container of an application, built from a repository like a docker
+// deployment
+type ApplicationService struct {
+	Name          string `json:"name" binding:"required,max=63"`
+	GitHubRepoURL string `json:"github_repo_url" binding:"required"`
+	GitHubBranch  string `json:"github_branch" binding:"required"`
+	// Port defaults to the repository's deployknot.yaml
+	Port             int    `json:"port,omitempty"`
+	RepoSubdirectory string `json:"repo_subdirectory,omitempty"`
+	// DependsOn are the services, such as a database or a cache, that must be ready before the
+	// container of this service starts
+	DependsOn []ApplicationDependency `json:"depends_on,omitempty" binding:"dive"`
+}
+
+// ApplicationDependency is a service another service of the application depends on
+type ApplicationDependency struct {
+	Service string `json:"service" binding:"required,max=63"`
+	// Condition is "healthy" (the default) or "port_open"
+	Condition string `json:"condition,omitempty"`
+}
+
+// OrDefault returns the condition, defaulting to healthy
+func (d ApplicationDependency) OrDefault() string {
+	if d.Condition == "" {
+		return DependencyHealthy
+	}
+	return d.Condition
+}
+
+// ApplicationRequest represents the request to create or replace an application
+type ApplicationRequest struct {
+	Name        string `json:"name" binding:"required,max=63"`
+	Description string `json:"description" binding:"max=2000"`
+	// Services are deployed in this order, except that a service is deployed after the services
+	// it depends on
+	Services []ApplicationService `json:"services" binding:"required,dive"`
+}
+
+// Validate checks the application request
+func (r *ApplicationRequest) Validate() error {
+	if !applicationNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits and hyphens, starting and ending with a letter or digit")
+	}
+	if len(r.Services) == 0 {
+		return fmt.Errorf("an application needs at least one service")
+	}
+	if len(r.Services) > maxApplicationServices {
+		return fmt.Errorf("an application has at most %d services", maxApplicationServices)
+	}
+
+	names := make(map[string]bool, len(r.Services))
+	for _, service := range r.Services {
+		if !applicationNamePattern.MatchString(service.Name) {
+			return fmt.Errorf("service name %q must be lowercase letters, digits and hyphens, starting and ending with a letter or digit", service.Name)
+		}
+		if names[service.Name] {
+			return fmt.Errorf("duplicate service %q", service.Name)
+		}
+		names[service.Name] = true
+
+		if err := ValidateRepoURL(service.GitHubRepoURL); err != nil {
+			return fmt.Errorf("service %q: %w", service.Name, err)
+		}
+		if err := ValidateGitBranch(service.GitHubBranch); err != nil {
+			return fmt.Errorf("service %q: %w", service.Name, err)
+		}
+		if service.Port < 0 || service.Port > 65535 {
+			return fmt.Errorf("service %q: port must be between 1 and 65535", service.Name)
+		}
+		if service.RepoSubdirectory != "" {
+			if err := ValidateRepoSubdirectory(service.RepoSubdirectory); err != nil {
+				return fmt.Errorf("service %q: %w", service.Name, err)
+			}
+		}
+	}
+
+	application := Application{Name: r.Name, Services: r.Services}
+	for _, service := range r.Services {
+		seen := make(map[string]bool, len(service.DependsOn))
+		for _, dependency := range service.DependsOn {
+			target := application.Service(dependency.Service)
+			switch {
+			case target == nil:
+				return fmt.Errorf("service %q depends on unknown service %q", service.Name, dependency.Service)
+			case dependency.Service == service.Name:
+				return fmt.Errorf("service %q cannot depend on itself", service.Name)
+			case seen[dependency.Service]:
+				return fmt.Errorf("service %q depends on service %q more than once", service.Name, dependency.Service)
+			}
+			seen[dependency.Service] = true
+
+			switch dependency.OrDefault() {
+			case DependencyHealthy:
+			case DependencyPortOpen:
+				if target.Port == 0 {
+					return fmt.Errorf("service %q waits for the port of service %q, which must set its port", service.Name, dependency.Service)
+				}
+			default:
+				return fmt.Errorf("service %q: dependency condition must be %q or %q", service.Name, DependencyHealthy, DependencyPortOpen)
+			}
+		}
+	}
+	if _, err := application.ReleaseOrder(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Service returns the service of the application with the given name, or nil
+func (a *Application) Service(name string) *ApplicationService {
+	for i := range a.Services {
+		if a.Services[i].Name == name {
+			return &a.Services[i]
+		}
+	}
+	return nil
+}
+
+// ReleaseOrder returns the services in the order a release deploys them: their own order, except
+// that every service comes after the services it depends on. It fails when services depend on
+// each other in a cycle.
+func (a *Application) ReleaseOrder() ([]ApplicationService, error) {
+	placed := make(map[string]bool, len(a.Services))
+	order := make([]ApplicationService, 0, len(a.Services))
+	for len(order) < len(a.Services) {
+		next := -1
+		for i, service := range a.Services {
+			if placed[service.Name] {
+				continue
+			}
+			ready := true
+			for _, dependency := range service.DependsOn {
+				if !placed[dependency.Service] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for _, service := range a.Services {
+				if !placed[service.Name] {
+					cycle = append(cycle, service.Name)
+				}
+			}
+			return nil, fmt.Errorf("services %s depend on each other", strings.Join(cycle, ", "))
+		}
+		placed[a.Services[next].Name] = true
+		order = append(order, a.Services[next])
+	}
+	return order, nil
+}
+
+// Dependencies returns the dependencies of every service that has any, by service name
+func (a *Application) Dependencies() map[string][]ApplicationDependency {
+	dependencies := make(map[string][]ApplicationDependency)
+	for _, service := range a.Services {
+		if len(service.DependsOn) > 0 {
+			dependencies[service.Name] = service.DependsOn
+		}
+	}
+	return dependencies
+}
+
+// Network returns the name of the Docker network the services of the application share
+func (a *Application) Network() string {
+	return "deployknot-" + a.Name
+}
+
+// ContainerName returns the name of the container of one of the application's services
+func (a *Application) ContainerName(service string) string {
+	return a.Name + "-" + service
+}
+
+// PortString returns the port of the service as a deployment request expects it; empty when the
+// repository's deployknot.yaml sets it
+func (s ApplicationService) PortString() string {
+	if s.Port == 0 {
+		return ""
+	}
+	return strconv.Itoa(s.Port)
+}
+
+// ApplicationRelease deploys every service of an application once, each as a deployment. Its
+// status is derived from the status of those deployments.
+type ApplicationRelease struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	ApplicationID uuid.UUID `json:"application_id" db:"application_id"`
+	UserID        uuid.UUID `json:"user_id" db:"user_id"`
+	TargetIP      string    `json:"target_ip" db:"target_ip"`
+	// Services are the names of the services released, in deployment order
+	Services []string `json:"services" db:"services"`
+	// Dependencies are the services each service waited for, by service name. A service without
+	// dependencies waits for the service before it.
+	Dependencies map[string][]ApplicationDependency `json:"dependencies,omitempty" db:"dependencies"`
+	Status       DeploymentStatus                   `json:"status" db:"-"`
+	Members      []ApplicationReleaseStatus         `json:"deployments" db:"-"`
+	CreatedAt    time.Time                          `json:"created_at" db:"created_at"`
+}
+
+// ApplicationReleaseStatus is the deployment of one service of an application release
+type ApplicationReleaseStatus struct {
+	Service      string           `json:"service"`
+	DeploymentID uuid.UUID        `json:"deployment_id"`
+	Status       DeploymentStatus `json:"status"`
+	ErrorMessage *string          `json:"error_message,omitempty"`
+	StartedAt    *time.Time       `json:"started_at,omitempty"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+}
+
+// ApplicationReleaseRequest represents the request to release an application to a target
+type ApplicationReleaseRequest struct {
+	TargetIP    string `json:"target_ip" binding:"required,ip"`
+	SSHUsername string `json:"ssh_username" binding:"required"`
+	// SSHPassword may be empty when the target trusts the SSH certificate authority
+	SSHPassword string `json:"ssh_password"`
+	GitHubPAT   string `json:"github_pat" binding:"required"`
+	// EnvironmentVars is .env file content every service gets
+	EnvironmentVars string `json:"environment_vars"`
+	// ServiceEnvironmentVars is .env file content of single services by name; it overrides the
+	// shared variables
+	ServiceEnvironmentVars map[string]string `json:"service_environment_vars"`
+}
+
+// Validate checks the release request against the services of the application
+func (r *ApplicationReleaseRequest) Validate(application *Application) error {
+	if err := ValidateGitHubPAT(r.GitHubPAT); err != nil {
+		return err
+	}
+	if err := ValidateEnvContent(r.EnvironmentVars); err != nil {
+		return fmt.Errorf("invalid environment_vars: %w", err)
+	}
+	for name, content := range r.ServiceEnvironmentVars {
+		if application.Service(name) == nil {
+			return fmt.Errorf("application %q has no service %q", application.Name, name)
+		}
+		if err := ValidateEnvContent(content); err != nil {
+			return fmt.Errorf("invalid environment_vars of service %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ServiceEnv returns the .env file content of a service: the shared variables followed by the
+// service's own, which win since later lines of an env file override earlier ones
+func (r *ApplicationReleaseRequest) ServiceEnv(service string) string {
+	var parts []string
+	for _, content := range []string{r.EnvironmentVars, r.ServiceEnvironmentVars[service]} {
+		if content = strings.TrimSpace(content); content != "" {
+			parts = append(parts, content)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ApplicationReleaseMember makes a deployment the deployment of a service of an application
+// release. It is set by the application service; clients cannot set it.
+type ApplicationReleaseMember struct {
+	ReleaseID uuid.UUID
+	Service   string
+	// Network is the network the service joins, with the service name as its alias
+	Network string
+	// EnvironmentVars is the .env file content of the service, passed to the worker with the job
+	EnvironmentVars string
+	// WaitUntil is when the deployment stops waiting for the services before it and fails
+	WaitUntil *time.Time
+	// DependsOn are the containers the worker checks are ready before it starts the container
+	DependsOn []ContainerDependency
+}
+
+// ContainerDependency is a container on the target that must be ready before a deployment starts
+// its own container
+type ContainerDependency struct {
+	Container string
+	// Condition is "healthy" or "port_open"
+	Condition string
+	// Port is the published port of the container, set for port_open
+	Port int
+}
+
+// String encodes the dependency for a deployment job, such as "shop-db:healthy" or
+// "shop-cache:port_open:6379"
+func (d ContainerDependency) String() string {
+	if d.Condition == DependencyPortOpen {
+		return fmt.Sprintf("%s:%s:%d", d.Container, d.Condition, d.Port)
+	}
+	return d.Container + ":" + d.Condition
+}
+
+// ParseContainerDependency parses a dependency encoded by ContainerDependency.String
+func ParseContainerDependency(value string) (ContainerDependency, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 {
+		return ContainerDependency{}, fmt.Errorf("invalid dependency %q", value)
+	}
+	dependency := ContainerDependency{Container: parts[0], Condition: parts[1]}
+	if err := ValidateContainerName(dependency.Container); err != nil {
+		return ContainerDependency{}, fmt.Errorf("invalid dependency %q: %w", value, err)
+	}
+	switch {
+	case dependency.Condition == DependencyHealthy && len(parts) == 2:
+	case dependency.Condition == DependencyPortOpen && len(parts) == 3:
+		port, err := strconv.Atoi(parts[2])
+		if err != nil || port < 1 || port > 65535 {
+			return ContainerDependency{}, fmt.Errorf("invalid port of dependency %q", value)
+		}
+		dependency.Port = port
+	default:
+		return ContainerDependency{}, fmt.Errorf("invalid dependency %q", value)
+	}
+	return dependency, nil
+}
+
+// AggregateReleaseStatus derives the status of an application release from the status of its
+// deployments: a failed or cancelled service fails the release, which completes once every
+// service has completed
+func AggregateReleaseStatus(statuses []DeploymentStatus) DeploymentStatus {
+	if len(statuses) == 0 {
+		return DeploymentStatusPending
+	}
+	counts := make(map[DeploymentStatus]int, len(statuses))
+	for _, status := range statuses {
+		counts[status]++
+	}
+	switch {
+	case counts[DeploymentStatusFailed] > 0:
+		return DeploymentStatusFailed
+	case counts[DeploymentStatusCancelled] > 0 || counts[DeploymentStatusAborted] > 0:
+		return DeploymentStatusCancelled
+	case counts[DeploymentStatusCompleted] == len(statuses):
+		return DeploymentStatusCompleted
+	case counts[DeploymentStatusPending] == len(statuses):
+		return DeploymentStatusPending
+	}
+	return DeploymentStatusRunning
+}
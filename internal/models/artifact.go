@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BuildLogArtifact is the name of the artifact holding the full output of a deployment's image build
+const BuildLogArtifact = "build.log"
+
+// ContainerInspectArtifact is the name of the artifact holding the docker inspect output of a
+// deployment's container, with the values of its environment variables redacted
+const ContainerInspectArtifact = "container.json"
+
+// DeploymentArtifact is a file kept with a deployment. Its content is stored gzip-compressed.
+type DeploymentArtifact struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	DeploymentID   uuid.UUID `json:"deployment_id" db:"deployment_id"`
+	Name           string    `json:"name" db:"name"`
+	ContentType    string    `json:"content_type" db:"content_type"`
+	Size           int64     `json:"size" db:"size"`
+	CompressedSize int64     `json:"compressed_size" db:"compressed_size"`
+	Truncated      bool      `json:"truncated" db:"truncated"`
+	Content        []byte    `json:"-" db:"content"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
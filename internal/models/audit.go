@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEventType identifies what an audit event records
+type AuditEventType string
+
+const (
+	// AuditEventIPBlocked records a request rejected by an IP allowlist
+	AuditEventIPBlocked AuditEventType = "ip_blocked"
+)
+
+// AuditEvent records a security-relevant request
+type AuditEvent struct {
+	ID             uuid.UUID      `json:"id" db:"id"`
+	EventType      AuditEventType `json:"event_type" db:"event_type"`
+	UserID         *uuid.UUID     `json:"user_id,omitempty" db:"user_id"`
+	Username       string         `json:"username,omitempty" db:"username"`
+	OrganizationID *uuid.UUID     `json:"organization_id,omitempty" db:"organization_id"`
+	IPAddress      string         `json:"ip_address" db:"ip_address"`
+	Method         string         `json:"method" db:"method"`
+	Path           string         `json:"path" db:"path"`
+	Reason         string         `json:"reason" db:"reason"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+}
+
+// AuditEventFilter narrows an audit event listing; nil fields are not filtered on
+type AuditEventFilter struct {
+	EventType *AuditEventType
+	UserID    *uuid.UUID
+	Since     *time.Time
+}
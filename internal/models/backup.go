@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// BackupFormatVersion is the version of the backup archive format written by this release
+const BackupFormatVersion = 1
+
+// BackupManifest starts a backup archive and describes its contents
+type BackupManifest struct {
+	FormatVersion int `json:"format_version"`
+	// SchemaVersion is the migration the backed up database was at; the rows match its tables
+	SchemaVersion uint      `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// EncryptionKeyCheck is a known value encrypted with the ENCRYPTION_KEY the stored secrets in the
+	// backup are encrypted with, so a restore with a different key fails before writing anything
+	EncryptionKeyCheck string   `json:"encryption_key_check"`
+	Tables             []string `json:"tables"`
+}
+
+// BackupSummary describes a backup that was written or restored
+type BackupSummary struct {
+	SchemaVersion uint             `json:"schema_version"`
+	Rows          map[string]int64 `json:"rows"`
+}
+
+// CreateBackupRequest represents the request to download a backup
+type CreateBackupRequest struct {
+	// Passphrase encrypts the archive; it is needed to restore it
+	Passphrase string `json:"passphrase" binding:"required,min=16"`
+	// WithoutLogs leaves out the deployment logs, usually the bulk of the data
+	WithoutLogs bool `json:"without_logs"`
+}
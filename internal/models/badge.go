@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// BadgeTokenPrefix starts every badge token, so leaked tokens are easy to recognize
+const BadgeTokenPrefix = "dkb_"
+
+// Badge colors, as in the shields.io palette
+const (
+	BadgeColorGreen  = "#4c1"
+	BadgeColorRed    = "#e05d44"
+	BadgeColorYellow = "#dfb317"
+	BadgeColorGrey   = "#9f9f9f"
+)
+
+// ProjectBadge is the status badge of a project: the status and commit of its latest deployment
+type ProjectBadge struct {
+	Label   string
+	Message string
+	Color   string
+	// Public is set for projects with a public status page; other badges need a token
+	Public bool
+}
+
+// NewProjectBadge describes the latest deployment of a project, or of one of its environments, on a
+// badge; status is nil when there is no deployment yet
+func NewProjectBadge(label string, status *EnvironmentStatus) *ProjectBadge {
+	badge := &ProjectBadge{Label: label, Message: "no deployments", Color: BadgeColorGrey}
+	if status == nil {
+		return badge
+	}
+
+	switch status.Status {
+	case DeploymentStatusCompleted:
+		badge.Message, badge.Color = "deployed", BadgeColorGreen
+	case DeploymentStatusFailed:
+		badge.Message, badge.Color = "failed", BadgeColorRed
+	case DeploymentStatusPending, DeploymentStatusRunning:
+		badge.Message, badge.Color = "deploying", BadgeColorYellow
+	default:
+		badge.Message = string(status.Status)
+	}
+	if status.CommitSHA != nil && *status.CommitSHA != "" {
+		sha := *status.CommitSHA
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		badge.Message += " " + sha
+	}
+	return badge
+}
+
+// ProjectBadgeToken gives access to the badge of a project without a public status page. Only a hash
+// of the token is stored; the token itself is shown once, when it is created.
+type ProjectBadgeToken struct {
+	Project string `json:"project"`
+	// Prefix is the start of the token, to tell tokens apart
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"created_at"`
+	// Token is only set when the token is created
+	Token string `json:"token,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultDeployUser is the user a bootstrapped target runs deployments as
+const DefaultDeployUser = "deployknot"
+
+// deployUserPattern restricts deploy users to names every Linux distribution accepts
+var deployUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// ValidateDeployUser checks a deploy user name for a target bootstrap
+func ValidateDeployUser(name string) error {
+	if !deployUserPattern.MatchString(name) || name == "root" {
+		return fmt.Errorf("deploy user must be a lowercase user name of at most 32 characters other than root")
+	}
+	return nil
+}
+
+// TargetBootstrap is the outcome of bootstrapping an SSH target: its deploy user with the
+// credentials it was given, which are only returned here and never stored
+type TargetBootstrap struct {
+	Target   *ProjectTarget `json:"target"`
+	Username string         `json:"username"`
+	// Password is the deploy user's password, which deployments log in with
+	Password string `json:"password"`
+	// PrivateKey is the PEM encoded OpenSSH private key whose public key was authorized for the user
+	PrivateKey    string `json:"private_key"`
+	AuthorizedKey string `json:"authorized_key"`
+	// PasswordLogin reports whether the target's SSH server accepted the password
+	PasswordLogin bool `json:"password_login"`
+	// DockerVersion is the Docker server version the deploy user could reach
+	DockerVersion string `json:"docker_version"`
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RedactedValue replaces secrets in post-mortem bundles and container inspect artifacts
+const RedactedValue = "[REDACTED]"
+
+// DeploymentConfigSnapshot is the effective configuration of a deployment, as written to its
+// post-mortem bundle. Credentials are never included: those that were given are shown as
+// RedactedValue, and so are the values of additional variables.
+type DeploymentConfigSnapshot struct {
+	DeploymentID        uuid.UUID         `json:"deployment_id"`
+	DeploymentType      DeploymentType    `json:"deployment_type"`
+	TargetType          TargetType        `json:"target_type"`
+	TargetIP            string            `json:"target_ip,omitempty"`
+	SSHUsername         string            `json:"ssh_username,omitempty"`
+	SSHPassword         string            `json:"ssh_password,omitempty"`
+	GitHubRepoURL       string            `json:"github_repo_url"`
+	GitHubPAT           string            `json:"github_pat,omitempty"`
+	GitHubBranch        string            `json:"github_branch"`
+	CommitSHA           *string           `json:"commit_sha,omitempty"`
+	RepoSubdirectory    *string           `json:"repo_subdirectory,omitempty"`
+	GitLFS              bool              `json:"git_lfs"`
+	Port                int               `json:"port"`
+	ContainerName       *string           `json:"container_name,omitempty"`
+	ProjectName         *string           `json:"project_name,omitempty"`
+	DeploymentName      *string           `json:"deployment_name,omitempty"`
+	ScriptPath          *string           `json:"script_path,omitempty"`
+	Script              string            `json:"script,omitempty"`
+	Kubeconfig          string            `json:"kubeconfig,omitempty"`
+	KubernetesNamespace *string           `json:"kubernetes_namespace,omitempty"`
+	Image               *string           `json:"image,omitempty"`
+	ManifestsPath       *string           `json:"manifests_path,omitempty"`
+	ConcurrencyGroup    *string           `json:"concurrency_group,omitempty"`
+	WorkerPool          *string           `json:"worker_pool,omitempty"`
+	GPUs                *string           `json:"gpus,omitempty"`
+	ExtraRunArgs        *string           `json:"extra_run_args,omitempty"`
+	OneTimeCredentials  bool              `json:"one_time_credentials"`
+	ScheduleID          *uuid.UUID        `json:"schedule_id,omitempty"`
+	AdditionalVars      map[string]string `json:"additional_vars,omitempty"`
+}
+
+// redacted returns RedactedValue for a secret that was given, and nothing otherwise
+func redacted(secret *string) string {
+	if secret == nil || *secret == "" {
+		return ""
+	}
+	return RedactedValue
+}
+
+// NewDeploymentConfigSnapshot describes the configuration a deployment ran with, leaving out its secrets
+func NewDeploymentConfigSnapshot(d *Deployment) *DeploymentConfigSnapshot {
+	snapshot := &DeploymentConfigSnapshot{
+		DeploymentID:        d.ID,
+		DeploymentType:      d.DeploymentType,
+		TargetType:          d.TargetType,
+		TargetIP:            d.TargetIP,
+		SSHUsername:         d.SSHUsername,
+		SSHPassword:         redacted(d.SSHPasswordEncrypted),
+		GitHubRepoURL:       d.GitHubRepoURL,
+		GitHubPAT:           redacted(d.GitHubPATEncrypted),
+		GitHubBranch:        d.GitHubBranch,
+		CommitSHA:           d.CommitSHA,
+		RepoSubdirectory:    d.RepoSubdirectory,
+		GitLFS:              d.GitLFS,
+		Port:                d.Port,
+		ContainerName:       d.ContainerName,
+		ProjectName:         d.ProjectName,
+		DeploymentName:      d.DeploymentName,
+		ScriptPath:          d.ScriptPath,
+		Script:              redacted(d.ScriptContent),
+		Kubeconfig:          redacted(d.KubeconfigEncrypted),
+		KubernetesNamespace: d.KubernetesNamespace,
+		Image:               d.Image,
+		ManifestsPath:       d.ManifestsPath,
+		ConcurrencyGroup:    d.ConcurrencyGroup,
+		WorkerPool:          d.WorkerPool,
+		GPUs:                d.GPUs,
+		ExtraRunArgs:        d.ExtraRunArgs,
+		OneTimeCredentials:  d.OneTimeCredentials,
+		ScheduleID:          d.ScheduleID,
+	}
+	if len(d.AdditionalVars) > 0 {
+		snapshot.AdditionalVars = make(map[string]string, len(d.AdditionalVars))
+		for name := range d.AdditionalVars {
+			snapshot.AdditionalVars[name] = RedactedValue
+		}
+	}
+	return snapshot
+}
+
+// RedactContainerInspect replaces the values of a container's environment variables in its docker
+// inspect output, since they carry the deployment's secrets. It accepts the docker CLI's array or
+// the Docker Engine API's object and returns the container's details as indented JSON.
+func RedactContainerInspect(raw []byte) ([]byte, error) {
+	var container map[string]interface{}
+	if err := json.Unmarshal(raw, &container); err != nil {
+		var containers []map[string]interface{}
+		if err := json.Unmarshal(raw, &containers); err != nil || len(containers) == 0 {
+			return nil, fmt.Errorf("failed to parse docker inspect output")
+		}
+		container = containers[0]
+	}
+
+	if cfg, ok := container["Config"].(map[string]interface{}); ok {
+		if env, ok := cfg["Env"].([]interface{}); ok {
+			for i, entry := range env {
+				if s, ok := entry.(string); ok {
+					name, _, _ := strings.Cut(s, "=")
+					env[i] = name + "=" + RedactedValue
+				}
+			}
+		}
+	}
+	return json.MarshalIndent(container, "", "  ")
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// pullRequestPatterns find the pull request a commit subject names: a merge commit, or a squash
+// merge with the pull request number appended
+var pullRequestPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^Merge pull request #(\d+)`),
+	regexp.MustCompile(`\(#(\d+)\)\s*$`),
+}
+
+// DeploymentChangelog is the commits a deployment adds on top of the last completed deployment of
+// its environment
+type DeploymentChangelog struct {
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	// BaseDeploymentID is the completed deployment compared against; nil once it was deleted
+	BaseDeploymentID *uuid.UUID       `json:"base_deployment_id,omitempty"`
+	BaseCommitSHA    string           `json:"base_commit_sha"`
+	HeadCommitSHA    string           `json:"head_commit_sha"`
+	Commits          []ChangelogEntry `json:"commits"`
+	// TotalCommits counts all commits of the range; Commits lists at most 250 of them
+	TotalCommits int       `json:"total_commits"`
+	CompareURL   *string   `json:"compare_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ChangelogEntry is a commit of a deployment changelog
+type ChangelogEntry struct {
+	SHA     string `json:"sha"`
+	Subject string `json:"subject"`
+	Author  string `json:"author"`
+	URL     string `json:"url,omitempty"`
+	// PullRequest is the number of the pull request the commit merged, if its subject names one
+	PullRequest    int    `json:"pull_request,omitempty"`
+	PullRequestURL string `json:"pull_request_url,omitempty"`
+}
+
+// PullRequestNumber returns the pull request a commit subject names, or 0 when it names none
+func PullRequestNumber(subject string) int {
+	for _, pattern := range pullRequestPatterns {
+		if match := pattern.FindStringSubmatch(subject); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			return number
+		}
+	}
+	return 0
+}
+
+// Summary describes the changelog in a sentence, such as "3 commits since 1a2b3c4"
+func (c *DeploymentChangelog) Summary() string {
+	base := c.BaseCommitSHA
+	if len(base) > 7 {
+		base = base[:7]
+	}
+	switch c.TotalCommits {
+	case 0:
+		return fmt.Sprintf("no new commits since %s", base)
+	case 1:
+		return fmt.Sprintf("1 commit since %s", base)
+	default:
+		return fmt.Sprintf("%d commits since %s", c.TotalCommits, base)
+	}
+}
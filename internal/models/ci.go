@@ -0,0 +1,70 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Exit codes of a finished CI deployment, for CI jobs to exit with
+const (
+	// CIExitSucceeded is the exit code of a completed deployment
+	CIExitSucceeded = 0
+	// CIExitFailed is the exit code of a failed deployment
+	CIExitFailed = 1
+	// CIExitCancelled is the exit code of a deployment that was cancelled, aborted or superseded
+	CIExitCancelled = 2
+)
+
+// CIDeployRequest represents the request of a CI pipeline to deploy a commit to an environment
+type CIDeployRequest struct {
+	// Repo is the GitHub repository, as owner/repo or its URL
+	Repo string `json:"repo" binding:"required"`
+	// SHA is the full commit SHA to deploy
+	SHA string `json:"sha" binding:"required"`
+	// Environment is the deployment_name of the deployments to the environment, such as "production"
+	Environment string `json:"environment" binding:"required,max=200"`
+	// Project narrows the deployments to one project of a monorepo
+	Project string `json:"project,omitempty" binding:"max=500"`
+	// Ref is the branch the commit is on; it defaults to the branch last deployed to the environment
+	Ref string `json:"ref,omitempty" binding:"max=255"`
+}
+
+// CIDeployResponse is returned when a CI deployment is created
+type CIDeployResponse struct {
+	DeploymentID       uuid.UUID        `json:"deployment_id"`
+	Status             DeploymentStatus `json:"status"`
+	CommitSHA          string           `json:"commit_sha"`
+	GitHubBranch       string           `json:"github_branch"`
+	SourceDeploymentID uuid.UUID        `json:"source_deployment_id"`
+	// StatusURL is polled for the status; it answers 202 until the deployment finishes
+	StatusURL string `json:"status_url"`
+	// StreamURL streams the deployment logs as Server-Sent Events
+	StreamURL string `json:"stream_url"`
+}
+
+// CIDeploymentStatus is the status of a deployment as reported to a CI pipeline
+type CIDeploymentStatus struct {
+	DeploymentID uuid.UUID        `json:"deployment_id"`
+	Status       DeploymentStatus `json:"status"`
+	// Done is set once the deployment has finished, successfully or not
+	Done bool `json:"done"`
+	// ExitCode is set once the deployment has finished: CIExitSucceeded, CIExitFailed or CIExitCancelled
+	ExitCode     *int       `json:"exit_code,omitempty"`
+	CommitSHA    *string    `json:"commit_sha,omitempty"`
+	FailedStep   string     `json:"failed_step,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+	SupersededBy *uuid.UUID `json:"superseded_by,omitempty"`
+}
+
+// CIExitCode returns the exit code of a finished deployment status, and false while the deployment
+// is still pending or running
+func CIExitCode(status DeploymentStatus) (int, bool) {
+	switch status {
+	case DeploymentStatusCompleted:
+		return CIExitSucceeded, true
+	case DeploymentStatusFailed:
+		return CIExitFailed, true
+	case DeploymentStatusCancelled, DeploymentStatusAborted:
+		return CIExitCancelled, true
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Steps whose commands can be overridden with a command template
+const (
+	CommandStepGitClone    = "git_clone"
+	CommandStepDockerBuild = "docker_build"
+	CommandStepDockerRun   = "docker_run"
+)
+
+// MaxCommandTemplateLength caps the length of a command template
+const MaxCommandTemplateLength = 4096
+
+// commandTemplateVars are the variables each step's command template may use. Command is the
+// command DeployKnot would run; Args are its arguments without the program, so a template can run
+// them with another CLI such as nerdctl.
+var commandTemplateVars = map[string][]string{
+	CommandStepGitClone:    {"Command", "URL", "Branch", "Commit", "Dir"},
+	CommandStepDockerBuild: {"Command", "Args", "Image", "Dockerfile", "Context"},
+	CommandStepDockerRun:   {"Command", "Args", "Name", "Image", "Port", "EnvFile"},
+}
+
+// CommandTemplate overrides the command a worker runs on the target for a step. It is a Go
+// template whose variables are quoted for the target's shell before they are substituted, so
+// repository, branch and container names cannot inject commands.
+type CommandTemplate struct {
+	Step     string `json:"step"`
+	Template string `json:"template"`
+	// Source is where the template is set: "database" for templates set through the API, which
+	// take precedence, or "config" for the COMMAND_TEMPLATE_* settings; it is empty for steps
+	// running their built-in command
+	Source string `json:"source,omitempty"`
+	// Variables are the variables the template may use
+	Variables []string   `json:"variables"`
+	UpdatedBy *string    `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Sources of command templates
+const (
+	CommandTemplateSourceDatabase = "database"
+	CommandTemplateSourceConfig   = "config"
+)
+
+// SetCommandTemplateRequest represents the request to set the command template of a step
+type SetCommandTemplateRequest struct {
+	Template string `json:"template" binding:"required"`
+}
+
+// CommandTemplateSteps returns the steps whose commands can be overridden, in order
+func CommandTemplateSteps() []string {
+	steps := make([]string, 0, len(commandTemplateVars))
+	for step := range commandTemplateVars {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	return steps
+}
+
+// CommandTemplateVars returns the variables the command template of a step may use, and whether
+// the step's command can be overridden
+func CommandTemplateVars(step string) ([]string, bool) {
+	vars, ok := commandTemplateVars[step]
+	return vars, ok
+}
+
+// ParseCommandTemplate parses the command template of a step, rejecting templates that refer to
+// variables the step does not have or that render to an empty command
+func ParseCommandTemplate(step, text string) (*template.Template, error) {
+	vars, ok := commandTemplateVars[step]
+	if !ok {
+		return nil, fmt.Errorf("step %q has no command template; use one of %s", step, strings.Join(CommandTemplateSteps(), ", "))
+	}
+	if len(text) > MaxCommandTemplateLength {
+		return nil, fmt.Errorf("command template must be at most %d characters", MaxCommandTemplateLength)
+	}
+
+	tmpl, err := template.New(step).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command template: %w", err)
+	}
+
+	sample := make(map[string]string, len(vars))
+	for _, name := range vars {
+		sample[name] = "'" + strings.ToLower(name) + "'"
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, sample); err != nil {
+		return nil, fmt.Errorf("invalid command template, it may use %s: %w", strings.Join(vars, ", "), err)
+	}
+	if strings.TrimSpace(rendered.String()) == "" {
+		return nil, fmt.Errorf("command template renders an empty command")
+	}
+	return tmpl, nil
+}
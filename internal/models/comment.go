@@ -0,0 +1,44 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// mentionPattern matches @username mentions in comment bodies
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([A-Za-z0-9_][A-Za-z0-9_.-]{0,99})`)
+
+// DeploymentComment is a note a team member left on a deployment
+type DeploymentComment struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	DeploymentID uuid.UUID  `json:"deployment_id" db:"deployment_id"`
+	UserID       *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	Username     string     `json:"username" db:"username"`
+	Body         string     `json:"body" db:"body"`
+	Mentions     []string   `json:"mentions" db:"mentions"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateCommentRequest represents the request to comment on a deployment
+type CreateCommentRequest struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
+
+// ParseMentions returns the distinct usernames mentioned with @username in a comment, in order
+func ParseMentions(body string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// A trailing dot ends a sentence rather than the username
+		username := strings.TrimRight(match[1], ".")
+		if username == "" || seen[strings.ToLower(username)] {
+			continue
+		}
+		seen[strings.ToLower(username)] = true
+		mentions = append(mentions, username)
+	}
+	return mentions
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ConcurrencyPolicy decides what happens to a new deployment while another deployment of the
+// same concurrency group is pending or running
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyQueue runs the new deployment once the active ones have finished
+	ConcurrencyQueue ConcurrencyPolicy = "queue"
+	// ConcurrencyReplace cancels the active deployments in favour of the new one
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+	// ConcurrencyReject refuses the new deployment
+	ConcurrencyReject ConcurrencyPolicy = "reject"
+)
+
+// maxConcurrencyGroupLength bounds the length of a concurrency group name
+const maxConcurrencyGroupLength = 200
+
+// GetConcurrencyPolicy returns the requested concurrency policy, defaulting to queue
+func (req *CreateDeploymentRequest) GetConcurrencyPolicy() ConcurrencyPolicy {
+	if req.ConcurrencyPolicy == "" {
+		return ConcurrencyQueue
+	}
+	return ConcurrencyPolicy(strings.ToLower(req.ConcurrencyPolicy))
+}
+
+// GetConcurrencyGroup returns the requested concurrency group. It defaults to the project and
+// its environment: the deployment name when given, otherwise the target.
+func (req *CreateDeploymentRequest) GetConcurrencyGroup() string {
+	if req.ConcurrencyGroup != nil && strings.TrimSpace(*req.ConcurrencyGroup) != "" {
+		return strings.TrimSpace(*req.ConcurrencyGroup)
+	}
+
+	environment := req.TargetIP
+	if req.DeploymentName != nil && *req.DeploymentName != "" {
+		environment = *req.DeploymentName
+	} else if req.GetTargetType() == TargetTypeKubernetes {
+		environment = "kubernetes:" + req.GetKubernetesNamespace()
+	}
+
+	group := req.ProjectKey() + "/" + environment
+	if len(group) > maxConcurrencyGroupLength {
+		group = group[:maxConcurrencyGroupLength]
+	}
+	return group
+}
+
+// validateConcurrency validates the concurrency group and policy of a deployment request
+func (req *CreateDeploymentRequest) validateConcurrency() error {
+	switch req.GetConcurrencyPolicy() {
+	case ConcurrencyQueue, ConcurrencyReplace, ConcurrencyReject:
+	default:
+		return fmt.Errorf("concurrency_policy must be %q, %q or %q", ConcurrencyQueue, ConcurrencyReplace, ConcurrencyReject)
+	}
+	if req.ConcurrencyGroup != nil && len(strings.TrimSpace(*req.ConcurrencyGroup)) > maxConcurrencyGroupLength {
+		return fmt.Errorf("concurrency_group must be at most %d characters", maxConcurrencyGroupLength)
+	}
+	return nil
+}
+
+// ConcurrencyKey identifies a concurrency group across tenants: groups are shared within an
+// organization, and otherwise belong to the user who created the deployment
+func ConcurrencyKey(group string, organizationID, userID *uuid.UUID) string {
+	switch {
+	case organizationID != nil:
+		return "org:" + organizationID.String() + ":" + group
+	case userID != nil:
+		return "user:" + userID.String() + ":" + group
+	}
+	return "global:" + group
+}
+
+// ConcurrencyKey returns the key of the deployment's concurrency group, or "" when it has none
+func (d *Deployment) ConcurrencyKey() string {
+	if d.ConcurrencyGroup == nil || *d.ConcurrencyGroup == "" {
+		return ""
+	}
+	return ConcurrencyKey(*d.ConcurrencyGroup, d.OrganizationID, d.UserID)
+}
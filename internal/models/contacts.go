@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ProjectOnCall is who is on call for a project, as reported by an external schedule
+type ProjectOnCall struct {
+	Name string `json:"name"`
+	// Contact is how to reach them, such as a phone number or a chat handle
+	Contact *string `json:"contact,omitempty"`
+	// Source names the schedule that reported them, such as "pagerduty"
+	Source *string `json:"source,omitempty"`
+	// Since is when they took over
+	Since time.Time `json:"since"`
+	// Until is when their shift ends
+	Until *time.Time `json:"until,omitempty"`
+	// PreviousName is who handed off to them
+	PreviousName *string   `json:"previous_name,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ProjectOnCallRequest reports who is on call for a project
+type ProjectOnCallRequest struct {
+	OnCall  string `json:"on_call" binding:"required,max=200"`
+	Contact string `json:"contact" binding:"max=200"`
+	Source  string `json:"source" binding:"max=100"`
+	// Since is when the shift started, now by default
+	Since *time.Time `json:"since"`
+	// Until is when the shift ends; without it the person stays on call until the next report
+	Until *time.Time `json:"until"`
+}
+
+// Validate checks the on-call report
+func (r *ProjectOnCallRequest) Validate(now time.Time) error {
+	if strings.TrimSpace(r.OnCall) == "" {
+		return fmt.Errorf("on_call must not be empty")
+	}
+	if r.Until != nil {
+		if !r.Until.After(now) {
+			return fmt.Errorf("until must be in the future")
+		}
+		if r.Since != nil && !r.Until.After(*r.Since) {
+			return fmt.Errorf("until must be after since")
+		}
+	}
+	return nil
+}
+
+// ProjectContacts tells responders who to contact when a deployment of a project breaks
+type ProjectContacts struct {
+	Project string  `json:"project"`
+	Owner   *string `json:"owner,omitempty"`
+	// OnCall is unset when nobody is on call, including after a shift ended without a handoff
+	OnCall *ProjectOnCall `json:"on_call,omitempty"`
+}
+
+// String describes the contacts in a sentence for notification messages, or returns "" when there
+// are none
+func (c *ProjectContacts) String() string {
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	if c.Owner != nil {
+		parts = append(parts, "Owner: "+*c.Owner)
+	}
+	if c.OnCall != nil {
+		onCall := "On call: " + c.OnCall.Name
+		if c.OnCall.Contact != nil {
+			onCall += " (" + *c.OnCall.Contact + ")"
+		}
+		parts = append(parts, onCall)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, ". ")
+}
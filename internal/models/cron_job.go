@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CronJobDir is the directory, relative to the home directory of the SSH user, that holds a
+// directory per cron job with its wrapper script, environment, run log and the output of its
+// recent runs
+const CronJobDir = ".deployknot/cron"
+
+// Files of the directory of a cron job
+const (
+	CronJobScript    = "job.sh"
+	CronJobEnvFile   = "job.env"
+	CronJobRunLog    = "runs.log"
+	CronJobOutputDir = "output"
+)
+
+// CronJobMarker is the comment that ends the crontab entry of the cron job name, by which the entry
+// is replaced and removed
+func CronJobMarker(name string) string {
+	return "# deployknot:" + name
+}
+
+// CronJobOtherEntries is a POSIX shell command printing the crontab of the SSH user without the
+// entry of the cron job name, which ends with its marker. name must be a valid container name, so
+// it needs no quoting.
+func CronJobOtherEntries(name string) string {
+	return "crontab -l 2>/dev/null | awk -v m=' " + CronJobMarker(name) + "' 'length($0) < length(m) || substr($0, length($0) - length(m) + 1) != m'"
+}
+
+// CronJobOutputFile is the file in the output directory of a cron job holding the output of the run
+// started at the unix time start
+func CronJobOutputFile(start int64) string {
+	return strconv.FormatInt(start, 10) + ".log"
+}
+
+// CronJobRun is one run of a cron job, collected from the target it ran on
+type CronJobRun struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	DeploymentID uuid.UUID `json:"deployment_id" db:"deployment_id"`
+	StartedAt    time.Time `json:"started_at" db:"started_at"`
+	FinishedAt   time.Time `json:"finished_at" db:"finished_at"`
+	ExitCode     int       `json:"exit_code" db:"exit_code"`
+	// Output is the end of what the container wrote to stdout and stderr
+	Output          *string   `json:"output,omitempty" db:"output"`
+	OutputTruncated bool      `json:"output_truncated" db:"output_truncated"`
+	CollectedAt     time.Time `json:"collected_at" db:"collected_at"`
+}
+
+// ParseCronJobRunLine parses a line of the run log of a cron job: the deployment that installed
+// the job, the unix times the run started and finished at and the container's exit status
+func ParseCronJobRunLine(line string) (*CronJobRun, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected 4 fields, got %d", len(fields))
+	}
+	deploymentID, err := uuid.Parse(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid deployment ID: %w", err)
+	}
+	started, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time: %w", err)
+	}
+	finished, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid finish time: %w", err)
+	}
+	exitCode, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid exit code: %w", err)
+	}
+	return &CronJobRun{
+		DeploymentID: deploymentID,
+		StartedAt:    time.Unix(started, 0).UTC(),
+		FinishedAt:   time.Unix(finished, 0).UTC(),
+		ExitCode:     exitCode,
+	}, nil
+}
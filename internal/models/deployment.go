@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +23,39 @@ const (
 	DeploymentStatusAborted   DeploymentStatus = "aborted"
 )
 
+// DeploymentType represents how a deployment is executed on the target
+type DeploymentType string
+
+const (
+	DeploymentTypeDocker DeploymentType = "docker"
+	DeploymentTypeScript DeploymentType = "script"
+	// DeploymentTypeManaged runs the official image of a managed service's database
+	DeploymentTypeManaged DeploymentType = "managed"
+	// DeploymentTypeCron builds an image and runs it as a one-shot container on a cron schedule
+	DeploymentTypeCron DeploymentType = "cron"
+)
+
+// TargetType represents where a deployment is executed
+type TargetType string
+
+const (
+	TargetTypeSSH        TargetType = "ssh"
+	TargetTypeKubernetes TargetType = "kubernetes"
+)
+
+// DefaultKubernetesNamespace is used when a Kubernetes deployment does not specify a namespace
+const DefaultKubernetesNamespace = "default"
+
+// kubernetesNamespacePattern matches valid Kubernetes namespace names (RFC 1123 labels)
+var kubernetesNamespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// DefaultScriptPath is the script executed for script deployments when neither
+// script_path nor an inline script is supplied
+const DefaultScriptPath = "deploy.sh"
+
+// repoPathPattern restricts paths inside the cloned repository to plain relative paths
+var repoPathPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
 // Deployment represents a deployment record
 type Deployment struct {
 	ID                   uuid.UUID              `json:"id" db:"id"`
@@ -44,22 +79,84 @@ type Deployment struct {
 	ProjectName          *string                `json:"project_name,omitempty" db:"project_name"`
 	DeploymentName       *string                `json:"deployment_name,omitempty" db:"deployment_name"`
 	UserID               *uuid.UUID             `json:"user_id,omitempty" db:"user_id"`
+	DeploymentType       DeploymentType         `json:"deployment_type" db:"deployment_type"`
+	ScriptPath           *string                `json:"script_path,omitempty" db:"script_path"`
+	ScriptContent        *string                `json:"-" db:"script_content"`
+	TargetType           TargetType             `json:"target_type" db:"target_type"`
+	KubeconfigEncrypted  *string                `json:"-" db:"kubeconfig_encrypted"`
+	KubernetesNamespace  *string                `json:"kubernetes_namespace,omitempty" db:"kubernetes_namespace"`
+	Image                *string                `json:"image,omitempty" db:"image"`
+	ManifestsPath        *string                `json:"manifests_path,omitempty" db:"manifests_path"`
+	OrganizationID       *uuid.UUID             `json:"organization_id,omitempty" db:"organization_id"`
+	RepoSubdirectory     *string                `json:"repo_subdirectory,omitempty" db:"repo_subdirectory"`
+	GitLFS               bool                   `json:"git_lfs" db:"git_lfs"`
+	ConcurrencyGroup     *string                `json:"concurrency_group,omitempty" db:"concurrency_group"`
+	SupersededBy         *uuid.UUID             `json:"superseded_by,omitempty" db:"superseded_by"`
+	OneTimeCredentials   bool                   `json:"one_time_credentials" db:"one_time_credentials"`
+	WorkerPool           *string                `json:"worker_pool,omitempty" db:"worker_pool"`
+	GPUs                 *string                `json:"gpus,omitempty" db:"gpus"`
+	ExtraRunArgs         *string                `json:"extra_run_args,omitempty" db:"extra_run_args"`
+	ScheduleID           *uuid.UUID             `json:"schedule_id,omitempty" db:"schedule_id"`
+	CommitSHA            *string                `json:"commit_sha,omitempty" db:"commit_sha"`
+	FailureCategory      *FailureCategory       `json:"failure_category,omitempty" db:"failure_category"`
+	ApplicationReleaseID *uuid.UUID             `json:"application_release_id,omitempty" db:"application_release_id"`
+	ApplicationService   *string                `json:"application_service,omitempty" db:"application_service"`
+	ManagedServices      *string                `json:"managed_services,omitempty" db:"managed_services"`
+	CronSchedule         *string                `json:"cron_schedule,omitempty" db:"cron_schedule"`
+	CronRemovedAt        *time.Time             `json:"cron_removed_at,omitempty" db:"cron_removed_at"`
+	CommentCount         int                    `json:"comment_count" db:"-"`
 }
 
 // CreateDeploymentRequest represents the request to create a deployment
 // For multipart form: all fields are form fields except env_file, which is a file upload
 // Use binding:"required" for required fields
 type CreateDeploymentRequest struct {
-	TargetIP       string  `form:"target_ip" binding:"required,ip"`
-	SSHUsername    string  `form:"ssh_username" binding:"required"`
-	SSHPassword    string  `form:"ssh_password" binding:"required"`
+	TargetIP       string  `form:"target_ip" binding:"omitempty,ip"` // Required for ssh targets
+	SSHUsername    string  `form:"ssh_username"`                     // Required for ssh targets
+	SSHPassword    string  `form:"ssh_password"`                     // Required for ssh targets without an SSH CA
 	GitHubRepoURL  string  `form:"github_repo_url" binding:"required"`
 	GitHubPAT      string  `form:"github_pat" binding:"required"`
 	GitHubBranch   string  `form:"github_branch" binding:"required"`
-	Port           string  `form:"port" binding:"required"` // Will be converted to int
+	Port           string  `form:"port"` // Will be converted to int; defaults to the repository's deployknot.yaml
 	ContainerName  *string `form:"container_name"`
 	ProjectName    *string `form:"project_name"`
 	DeploymentName *string `form:"deployment_name"`
+	DeploymentType string  `form:"deployment_type"` // "docker" (default), "script" or "cron"
+	ScriptPath     *string `form:"script_path"`     // Script inside the repository, relative to its root
+	Script         *string `form:"script"`          // Inline script, used instead of script_path
+	// Kubernetes targets
+	TargetType          string  `form:"target_type"` // "ssh" (default) or "kubernetes"
+	Kubeconfig          string  `form:"kubeconfig"`
+	KubernetesNamespace *string `form:"kubernetes_namespace"`
+	Image               *string `form:"image"`          // Image for the generated Deployment manifest
+	ManifestsPath       *string `form:"manifests_path"` // Directory of manifests inside the repository, used instead of image
+	// Monorepos on ssh targets
+	RepoSubdirectory *string `form:"repo_subdirectory"` // Only this directory is checked out and used as the application root
+	GitLFS           bool    `form:"git_lfs"`           // Fetch Git LFS objects after checkout
+	// Concurrency with other deployments of the same group
+	ConcurrencyGroup  *string `form:"concurrency_group"`  // Defaults to the project and environment
+	ConcurrencyPolicy string  `form:"concurrency_policy"` // "queue" (default), "replace" or "reject"
+	// Credentials are only used for this deployment and never stored
+	OneTimeCredentials bool `form:"one_time_credentials"`
+	// Workers of this pool run the deployment; a pool required by the project or its target wins
+	WorkerPool *string `form:"worker_pool"`
+	// GPUs passed to the container: "all" or a comma-separated list of device indexes or UUIDs
+	GPUs *string `form:"gpus"`
+	// Additional docker run flags from an allowlist, e.g. "--add-host=db:10.0.0.5 --shm-size=1g"
+	ExtraRunArgs *string `form:"extra_run_args"`
+	// ScheduleID is set by the scheduler on the deployments it creates; clients cannot set it
+	ScheduleID *uuid.UUID `form:"-"`
+	// CommitSHA pins the commit of github_branch to deploy instead of its head
+	CommitSHA *string `form:"commit_sha"`
+	// Release is set by the application service on the deployments of an application release
+	Release *ApplicationReleaseMember `form:"-"`
+	// Managed is set by the managed service service on the deployments of a managed service
+	Managed *ManagedServiceMember `form:"-"`
+	// Comma-separated names of managed services on the target whose connection variables the
+	// container gets, e.g. "shop-db,cache"
+	ManagedServices *string `form:"managed_services"`
+	// Cron expression a cron deployment runs its container on, e.g. "*/15 * * * *"
+	CronSchedule *string `form:"cron_schedule"`
 	// env_file is handled as a file upload in the handler, not as a struct field
 	// AdditionalVars can be handled as a JSON string if needed
 	AdditionalVars map[string]interface{} `form:"additional_vars"`
@@ -67,27 +164,283 @@ type CreateDeploymentRequest struct {
 
 // Validate validates the deployment request
 func (req *CreateDeploymentRequest) Validate() error {
-	if req.TargetIP == "" {
-		return fmt.Errorf("target_ip is required")
+	if req.GetDeploymentType() == DeploymentTypeManaged {
+		return req.validateManaged()
 	}
-	if req.SSHUsername == "" {
-		return fmt.Errorf("ssh_username is required")
+	switch req.GetTargetType() {
+	case TargetTypeSSH:
+		if req.TargetIP == "" {
+			return fmt.Errorf("target_ip is required")
+		}
+		if req.SSHUsername == "" {
+			return fmt.Errorf("ssh_username is required")
+		}
+		// Without ssh_password the target is logged in to with a certificate of the SSH
+		// certificate authority, which the deployment service checks for
+		if req.RepoSubdirectory != nil && *req.RepoSubdirectory != "" {
+			if err := ValidateRepoSubdirectory(*req.RepoSubdirectory); err != nil {
+				return err
+			}
+		}
+	case TargetTypeKubernetes:
+		if err := req.validateKubernetes(); err != nil {
+			return err
+		}
+		if (req.RepoSubdirectory != nil && *req.RepoSubdirectory != "") || req.GitLFS {
+			return fmt.Errorf("repo_subdirectory and git_lfs are not supported for kubernetes targets")
+		}
+	default:
+		return fmt.Errorf("invalid target_type: %s", req.TargetType)
 	}
-	if req.SSHPassword == "" {
-		return fmt.Errorf("ssh_password is required")
+	if err := req.validateConcurrency(); err != nil {
+		return err
 	}
 	if req.GitHubRepoURL == "" {
 		return fmt.Errorf("github_repo_url is required")
 	}
+	if err := ValidateRepoURL(req.GitHubRepoURL); err != nil {
+		return err
+	}
 	if req.GitHubPAT == "" {
 		return fmt.Errorf("github_pat is required")
 	}
-	if req.Port == "" {
-		return fmt.Errorf("port is required")
+	if err := ValidateGitHubPAT(req.GitHubPAT); err != nil {
+		return err
+	}
+	if err := ValidateGitBranch(req.GitHubBranch); err != nil {
+		return err
+	}
+	if req.CommitSHA != nil && *req.CommitSHA != "" {
+		if err := ValidateCommitSHA(*req.CommitSHA); err != nil {
+			return err
+		}
+	}
+	if req.ContainerName != nil && *req.ContainerName != "" {
+		if err := ValidateContainerName(*req.ContainerName); err != nil {
+			return err
+		}
+	}
+	if req.GPUs != nil && *req.GPUs != "" {
+		if req.GetTargetType() != TargetTypeSSH || req.GetDeploymentType() != DeploymentTypeDocker {
+			return fmt.Errorf("gpus is only supported for docker deployments on ssh targets")
+		}
+		if err := ValidateGPUs(*req.GPUs); err != nil {
+			return err
+		}
+	}
+	if req.ExtraRunArgs != nil && strings.TrimSpace(*req.ExtraRunArgs) != "" {
+		if req.GetTargetType() != TargetTypeSSH || req.GetDeploymentType() != DeploymentTypeDocker {
+			return fmt.Errorf("extra_run_args is only supported for docker deployments on ssh targets")
+		}
+		if _, err := ParseExtraRunArgs(*req.ExtraRunArgs); err != nil {
+			return err
+		}
+	}
+	if req.ManagedServices != nil && strings.TrimSpace(*req.ManagedServices) != "" {
+		if req.GetTargetType() != TargetTypeSSH || req.GetDeploymentType() != DeploymentTypeDocker {
+			return fmt.Errorf("managed_services is only supported for docker deployments on ssh targets")
+		}
+		if _, err := ParseManagedServiceNames(*req.ManagedServices); err != nil {
+			return err
+		}
+	}
+	if req.CronSchedule != nil && strings.TrimSpace(*req.CronSchedule) != "" && req.GetDeploymentType() != DeploymentTypeCron {
+		return fmt.Errorf("cron_schedule is only supported for cron deployments")
+	}
+	switch req.GetDeploymentType() {
+	case DeploymentTypeDocker:
+		if req.Port == "" && req.RequiresPort() {
+			return fmt.Errorf("port is required")
+		}
+	case DeploymentTypeScript:
+		if err := req.validateScript(); err != nil {
+			return err
+		}
+	case DeploymentTypeCron:
+		if err := req.validateCron(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid deployment_type: %s", req.DeploymentType)
 	}
 	return nil
 }
 
+// validateCron validates a cron deployment, which installs its schedule in the crontab of an SSH
+// target
+func (req *CreateDeploymentRequest) validateCron() error {
+	if req.GetTargetType() != TargetTypeSSH {
+		return fmt.Errorf("deployment_type cron is only supported for ssh targets")
+	}
+	if req.CronSchedule == nil || strings.TrimSpace(*req.CronSchedule) == "" {
+		return fmt.Errorf("cron_schedule is required for cron deployments")
+	}
+	if _, err := ParseCron(*req.CronSchedule); err != nil {
+		return fmt.Errorf("invalid cron_schedule: %w", err)
+	}
+	return nil
+}
+
+// validateManaged validates the deployment of a managed service, which runs an official image
+// rather than building a repository
+func (req *CreateDeploymentRequest) validateManaged() error {
+	if req.Managed == nil {
+		return fmt.Errorf("managed deployments are created by deploying a managed service")
+	}
+	if req.GetTargetType() != TargetTypeSSH {
+		return fmt.Errorf("deployment_type managed is only supported for ssh targets")
+	}
+	if req.TargetIP == "" {
+		return fmt.Errorf("target_ip is required")
+	}
+	if req.SSHUsername == "" {
+		return fmt.Errorf("ssh_username is required")
+	}
+	if _, err := ManagedContainerFor(req.Managed.Engine, req.Managed.Version); err != nil {
+		return err
+	}
+	if _, err := req.GetPortAsInt(); err != nil {
+		return err
+	}
+	if req.ContainerName == nil || ValidateContainerName(*req.ContainerName) != nil {
+		return fmt.Errorf("invalid container_name")
+	}
+	return req.validateConcurrency()
+}
+
+// GetDeploymentType returns the requested deployment type, defaulting to docker
+func (req *CreateDeploymentRequest) GetDeploymentType() DeploymentType {
+	if req.DeploymentType == "" {
+		return DeploymentTypeDocker
+	}
+	return DeploymentType(strings.ToLower(req.DeploymentType))
+}
+
+// RequiresPort reports whether the deployment needs a port: script deployments, Kubernetes
+// deployments driven by repository manifests and docker deployments over SSH, which can take
+// it from the repository's deployknot.yaml, do not
+func (req *CreateDeploymentRequest) RequiresPort() bool {
+	if req.GetDeploymentType() == DeploymentTypeScript || req.GetTargetType() == TargetTypeSSH {
+		return false
+	}
+	if req.GetTargetType() == TargetTypeKubernetes && req.ManifestsPath != nil && *req.ManifestsPath != "" {
+		return false
+	}
+	return true
+}
+
+// GetTargetType returns the requested target type, defaulting to ssh
+func (req *CreateDeploymentRequest) GetTargetType() TargetType {
+	if req.TargetType == "" {
+		return TargetTypeSSH
+	}
+	return TargetType(strings.ToLower(req.TargetType))
+}
+
+// GetKubernetesNamespace returns the requested namespace, defaulting to "default"
+func (req *CreateDeploymentRequest) GetKubernetesNamespace() string {
+	if req.KubernetesNamespace != nil && *req.KubernetesNamespace != "" {
+		return *req.KubernetesNamespace
+	}
+	return DefaultKubernetesNamespace
+}
+
+// validateKubernetes validates the fields of a Kubernetes target
+func (req *CreateDeploymentRequest) validateKubernetes() error {
+	if err := ValidateKubeconfig(req.Kubeconfig); err != nil {
+		return err
+	}
+	if req.GetDeploymentType() != DeploymentTypeDocker {
+		return fmt.Errorf("deployment_type %s is not supported for kubernetes targets", req.DeploymentType)
+	}
+	if !kubernetesNamespacePattern.MatchString(req.GetKubernetesNamespace()) {
+		return fmt.Errorf("invalid kubernetes_namespace")
+	}
+
+	hasImage := req.Image != nil && *req.Image != ""
+	hasManifests := req.ManifestsPath != nil && *req.ManifestsPath != ""
+	if hasImage == hasManifests {
+		return fmt.Errorf("exactly one of image or manifests_path is required for kubernetes targets")
+	}
+
+	if hasManifests {
+		if err := ValidateManifestsPath(*req.ManifestsPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetScriptPath returns the repository script to execute for script deployments
+func (req *CreateDeploymentRequest) GetScriptPath() string {
+	if req.ScriptPath != nil && *req.ScriptPath != "" {
+		return path.Clean(*req.ScriptPath)
+	}
+	return DefaultScriptPath
+}
+
+// validateScript validates the script_path and script fields of a script deployment
+func (req *CreateDeploymentRequest) validateScript() error {
+	hasPath := req.ScriptPath != nil && *req.ScriptPath != ""
+	hasInline := req.Script != nil && strings.TrimSpace(*req.Script) != ""
+
+	if hasPath && hasInline {
+		return fmt.Errorf("only one of script_path or script may be provided")
+	}
+
+	if hasPath {
+		if err := validateRepoPath("script_path", *req.ScriptPath); err != nil {
+			return err
+		}
+	}
+
+	if req.Port != "" {
+		if _, err := req.GetPortAsInt(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateRepoPath validates a path that must stay inside the cloned repository
+func validateRepoPath(field, value string) error {
+	if !repoPathPattern.MatchString(value) {
+		return fmt.Errorf("%s contains invalid characters", field)
+	}
+	cleaned := path.Clean(value)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("%s must be relative to the repository root", field)
+	}
+	return nil
+}
+
+// ValidateManifestsPath validates the directory of Kubernetes manifests inside the repository
+func ValidateManifestsPath(value string) error {
+	return validateRepoPath("manifests_path", value)
+}
+
+// ValidateRepoSubdirectory validates the directory checked out for monorepo deployments
+func ValidateRepoSubdirectory(value string) error {
+	if err := validateRepoPath("repo_subdirectory", value); err != nil {
+		return err
+	}
+	cleaned := path.Clean(value)
+	if cleaned == "." || strings.HasPrefix(cleaned, "-") {
+		return fmt.Errorf("repo_subdirectory must name a directory inside the repository")
+	}
+	return nil
+}
+
+// GetRepoSubdirectory returns the cleaned repository subdirectory, or "" for the whole repository
+func (req *CreateDeploymentRequest) GetRepoSubdirectory() string {
+	if req.RepoSubdirectory == nil || *req.RepoSubdirectory == "" {
+		return ""
+	}
+	return path.Clean(*req.RepoSubdirectory)
+}
+
 // GetPortAsInt converts the Port string to int
 func (r *CreateDeploymentRequest) GetPortAsInt() (int, error) {
 	if r.Port == "" {
@@ -106,6 +459,24 @@ func (r *CreateDeploymentRequest) GetPortAsInt() (int, error) {
 	return port, nil
 }
 
+// ProjectKey identifies the project the deployment belongs to for statistics: the project name
+// when set, otherwise the repository URL
+func (d *Deployment) ProjectKey() string {
+	if d.ProjectName != nil && *d.ProjectName != "" {
+		return *d.ProjectName
+	}
+	return d.GitHubRepoURL
+}
+
+// ProjectKey identifies the project a deployment belongs to for statistics: the project name
+// when given, otherwise the repository URL
+func (r *CreateDeploymentRequest) ProjectKey() string {
+	if r.ProjectName != nil && *r.ProjectName != "" {
+		return *r.ProjectName
+	}
+	return r.GitHubRepoURL
+}
+
 // EnvironmentVariable represents a single environment variable
 type EnvironmentVariable struct {
 	Key   string `json:"key" binding:"required"`
@@ -156,30 +527,124 @@ func FromEnvFile(content string) EnvironmentVariables {
 
 // DeploymentResponse represents the response for a deployment
 type DeploymentResponse struct {
-	ID             uuid.UUID        `json:"id"`
-	Status         DeploymentStatus `json:"status"`
-	TargetIP       string           `json:"target_ip"`
-	GitHubRepoURL  string           `json:"github_repo_url"`
-	GitHubBranch   string           `json:"github_branch"`
-	Port           int              `json:"port"`
-	ContainerName  *string          `json:"container_name,omitempty"`
-	CreatedAt      time.Time        `json:"created_at"`
-	StartedAt      *time.Time       `json:"started_at,omitempty"`
-	CompletedAt    *time.Time       `json:"completed_at,omitempty"`
-	ErrorMessage   *string          `json:"error_message,omitempty"`
-	ProjectName    *string          `json:"project_name,omitempty"`
-	DeploymentName *string          `json:"deployment_name,omitempty"`
+	ID               uuid.UUID        `json:"id"`
+	Status           DeploymentStatus `json:"status"`
+	TargetIP         string           `json:"target_ip"`
+	GitHubRepoURL    string           `json:"github_repo_url"`
+	GitHubBranch     string           `json:"github_branch"`
+	Port             int              `json:"port"`
+	ContainerName    *string          `json:"container_name,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
+	StartedAt        *time.Time       `json:"started_at,omitempty"`
+	CompletedAt      *time.Time       `json:"completed_at,omitempty"`
+	ErrorMessage     *string          `json:"error_message,omitempty"`
+	ProjectName      *string          `json:"project_name,omitempty"`
+	DeploymentName   *string          `json:"deployment_name,omitempty"`
+	DeploymentType   DeploymentType   `json:"deployment_type"`
+	ScriptPath       *string          `json:"script_path,omitempty"`
+	TargetType       TargetType       `json:"target_type"`
+	Namespace        *string          `json:"kubernetes_namespace,omitempty"`
+	Image            *string          `json:"image,omitempty"`
+	ManifestsPath    *string          `json:"manifests_path,omitempty"`
+	RepoSubdirectory *string          `json:"repo_subdirectory,omitempty"`
+	GitLFS           bool             `json:"git_lfs,omitempty"`
+	ConcurrencyGroup *string          `json:"concurrency_group,omitempty"`
+	SupersededBy     *uuid.UUID       `json:"superseded_by,omitempty"`
+	UserID           *uuid.UUID       `json:"user_id,omitempty"`
+	CommentCount     int              `json:"comment_count"`
+	// OneTimeCredentials is set when the deployment's credentials were not stored
+	OneTimeCredentials bool `json:"one_time_credentials,omitempty"`
+	// WorkerPool is the pool of workers the deployment runs on; empty for the default pool
+	WorkerPool *string `json:"worker_pool,omitempty"`
+	// GPUs are the GPUs of the target passed to the container
+	GPUs *string `json:"gpus,omitempty"`
+	// ExtraRunArgs are the additional docker run flags of the container, normalized to --flag=value
+	ExtraRunArgs *string `json:"extra_run_args,omitempty"`
+	// ScheduleID is the schedule that created the deployment
+	ScheduleID *uuid.UUID `json:"schedule_id,omitempty"`
+	// CommitSHA is the commit deployed instead of the head of the branch
+	CommitSHA *string `json:"commit_sha,omitempty"`
+	// FailureCategory is the likely cause of a failed deployment
+	FailureCategory *FailureCategory `json:"failure_category,omitempty"`
+	// ApplicationReleaseID is the application release the deployment deploys ApplicationService of
+	ApplicationReleaseID *uuid.UUID `json:"application_release_id,omitempty"`
+	ApplicationService   *string    `json:"application_service,omitempty"`
+	// ManagedServices are the managed services whose connection variables the container gets
+	ManagedServices *string `json:"managed_services,omitempty"`
+	// CronSchedule is when a cron deployment runs its container; CronRemovedAt is set once its
+	// crontab entry was removed from the target
+	CronSchedule  *string    `json:"cron_schedule,omitempty"`
+	CronRemovedAt *time.Time `json:"cron_removed_at,omitempty"`
+
+	// EstimatedDurationSeconds is the average duration of recent successful deployments of the same project
+	EstimatedDurationSeconds *int `json:"estimated_duration_seconds,omitempty"`
+	// Progress is the estimated completion percentage (0-100), weighted by historical step durations
+	Progress *int `json:"progress,omitempty"`
+	// EnqueueDeferred is set when the queue was unavailable and the job was buffered for later publishing
+	EnqueueDeferred bool `json:"enqueue_deferred,omitempty"`
+	// Superseded lists the older queued deployments of the same project, branch and target this one replaced
+	Superseded []uuid.UUID `json:"superseded,omitempty"`
+	// Gates are the external checks the deployment waits for before it is queued
+	Gates []*DeploymentGate `json:"gates,omitempty"`
+	// Contacts are the owner of the deployment's project and who is on call for it
+	Contacts *ProjectContacts `json:"contacts,omitempty"`
 }
 
 // DeploymentLog represents a deployment log entry
 type DeploymentLog struct {
 	ID           uuid.UUID `json:"id" db:"id"`
+	Seq          int64     `json:"seq" db:"seq"`
 	DeploymentID uuid.UUID `json:"deployment_id" db:"deployment_id"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	LogLevel     string    `json:"log_level" db:"log_level"`
+	LogLevel     LogLevel  `json:"log_level" db:"log_level"`
 	Message      string    `json:"message" db:"message"`
 	TaskName     *string   `json:"task_name,omitempty" db:"task_name"`
 	StepOrder    *int      `json:"step_order,omitempty" db:"step_order"`
+	// Category is unset for entries written before categories were recorded
+	Category *LogCategory `json:"category,omitempty" db:"category"`
+	// EventCode and Params identify the message independently of its English text; free-text
+	// entries have neither
+	EventCode *LogEventCode     `json:"event_code,omitempty" db:"event_code"`
+	Params    map[string]string `json:"params,omitempty" db:"params"`
+}
+
+// DeploymentLogPage is one page of deployment logs following a sequence cursor
+type DeploymentLogPage struct {
+	Logs         []*DeploymentLog `json:"logs"`
+	AfterSeq     int64            `json:"after_seq"`
+	NextAfterSeq int64            `json:"next_after_seq"`
+	HasMore      bool             `json:"has_more"`
+}
+
+// DeploymentDetail bundles a deployment with its steps and most recent logs
+type DeploymentDetail struct {
+	Deployment   *DeploymentResponse  `json:"deployment"`
+	Steps        []*DeploymentStep    `json:"steps"`
+	Logs         []*DeploymentLog     `json:"logs"`
+	NextAfterSeq int64                `json:"next_after_seq"`
+	Comments     []*DeploymentComment `json:"comments"`
+}
+
+// ProjectStats summarises the most recent finished deployments of a project
+type ProjectStats struct {
+	Project                string             `json:"project"`
+	SampleSize             int                `json:"sample_size"`
+	Succeeded              int                `json:"succeeded"`
+	SuccessRate            float64            `json:"success_rate"`
+	AvgDurationSeconds     *float64           `json:"avg_duration_seconds,omitempty"`
+	AvgStepDurationSeconds map[string]float64 `json:"avg_step_duration_seconds"`
+	// FailureCauses counts the failed deployments of the sample by failure category, most common first
+	FailureCauses []*FailureCause      `json:"failure_causes"`
+	Trend         []*ProjectTrendPoint `json:"trend"`
+}
+
+// ProjectTrendPoint aggregates a project's deployments created on one day
+type ProjectTrendPoint struct {
+	Date               string   `json:"date"`
+	Deployments        int      `json:"deployments"`
+	Succeeded          int      `json:"succeeded"`
+	Failed             int      `json:"failed"`
+	AvgDurationSeconds *float64 `json:"avg_duration_seconds,omitempty"`
 }
 
 // DeploymentStep represents a deployment step
@@ -193,4 +658,22 @@ type DeploymentStep struct {
 	DurationMs   *int             `json:"duration_ms,omitempty" db:"duration_ms"`
 	ErrorMessage *string          `json:"error_message,omitempty" db:"error_message"`
 	StepOrder    int              `json:"step_order" db:"step_order"`
+	// Output holds structured results of the step, such as the resolved commit SHA or the container ID
+	Output map[string]interface{} `json:"output,omitempty" db:"output"`
+	// DependsOn are the orders of the steps that must complete before this step starts; steps
+	// that do not depend on each other run in parallel
+	DependsOn []int `json:"depends_on" db:"depends_on"`
+}
+
+// OutboxEntry is a deployment job persisted in PostgreSQL until it has been published to the queue
+type OutboxEntry struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	DeploymentID     uuid.UUID  `json:"deployment_id" db:"deployment_id"`
+	PayloadEncrypted string     `json:"-" db:"payload_encrypted"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	PublishedAt      *time.Time `json:"published_at,omitempty" db:"published_at"`
+	Attempts         int        `json:"attempts" db:"attempts"`
+	LastError        *string    `json:"last_error,omitempty" db:"last_error"`
+	// Held entries wait for the gates of their deployment and are not published yet
+	Held bool `json:"held" db:"held"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ETag returns the entity tag of a resource version, derived from when the resource was last updated
+func ETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 36) + `"`
+}
+
+// ParseETag returns the update time an entity tag created by ETag stands for
+func ParseETag(tag string) (time.Time, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 3 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return time.Time{}, false
+	}
+	micros, err := strconv.ParseInt(tag[1:len(tag)-1], 36, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(micros), true
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExecSession is the audit record of an interactive shell opened in a deployment's container
+type ExecSession struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	DeploymentID    uuid.UUID  `json:"deployment_id" db:"deployment_id"`
+	UserID          *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	Username        string     `json:"username" db:"username"`
+	ClientIP        string     `json:"client_ip,omitempty" db:"client_ip"`
+	ContainerName   string     `json:"container_name" db:"container_name"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	EndedAt         *time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	ExitCode        *int       `json:"exit_code,omitempty" db:"exit_code"`
+	EndReason       *string    `json:"end_reason,omitempty" db:"end_reason"`
+	InputTranscript string     `json:"input_transcript" db:"input_transcript"`
+	InputTruncated  bool       `json:"input_truncated" db:"input_truncated"`
+	OutputBytes     int64      `json:"output_bytes" db:"output_bytes"`
+}
+
+// Exec control message types exchanged as text frames over the exec WebSocket
+const (
+	ExecMessageInput  = "input"
+	ExecMessageResize = "resize"
+	ExecMessageExit   = "exit"
+	ExecMessageError  = "error"
+)
+
+// ExecMessage is a control message of the exec WebSocket. Clients send input and resize
+// messages; the server sends exit and error messages. Terminal output is sent as binary frames.
+type ExecMessage struct {
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Cols     int    `json:"cols,omitempty"`
+	Rows     int    `json:"rows,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "regexp"
+
+// FailureCategory is the likely cause of a failed deployment, derived from the error of its failed
+// step
+type FailureCategory string
+
+const (
+	// FailureAuth is a failure to authenticate to the target, the repository or a registry
+	FailureAuth FailureCategory = "auth"
+	// FailureNetwork is a failure to reach the target, the repository or a registry
+	FailureNetwork FailureCategory = "network"
+	// FailureBuild is a failure to fetch or build the application
+	FailureBuild FailureCategory = "build"
+	// FailureRuntime is a failure to start the application
+	FailureRuntime FailureCategory = "runtime"
+	// FailureHealth is a failure of the checks of the started application
+	FailureHealth FailureCategory = "health"
+	// FailureOther is a failure matching no other category, such as a failed gate or a timeout
+	FailureOther FailureCategory = "other"
+)
+
+// FailureCategories returns the failure categories in the order they are reported
+func FailureCategories() []FailureCategory {
+	return []FailureCategory{FailureAuth, FailureNetwork, FailureBuild, FailureRuntime, FailureHealth, FailureOther}
+}
+
+// failureRules classify an error by its message, whatever step it happened in; the first match wins
+var failureRules = []struct {
+	category FailureCategory
+	pattern  *regexp.Regexp
+}{
+	{FailureAuth, regexp.MustCompile(`(?i)unable to authenticate|authentication failed|permission denied \(publickey|bad credentials|could not read username|repository not found|pull access denied|no basic auth credentials|unauthorized: authentication required`)},
+	{FailureNetwork, regexp.MustCompile(`(?i)connection (refused|reset|timed out)|i/o timeout|no route to host|network is unreachable|could not resolve|no such host|temporary failure in name resolution|tls handshake timeout`)},
+}
+
+// stepFailureCategories are the categories of the errors of each step that match no rule
+var stepFailureCategories = map[string]FailureCategory{
+	"git_clone":            FailureBuild,
+	"pull_base_images":     FailureBuild,
+	"secret_scan":          FailureBuild,
+	"docker_build":         FailureBuild,
+	"run_script":           FailureBuild,
+	"pull_image":           FailureRuntime,
+	"create_volume":        FailureRuntime,
+	"install_cron":         FailureRuntime,
+	"validate_credentials": FailureRuntime,
+	"docker_run":           FailureRuntime,
+	"kubectl_apply":        FailureRuntime,
+	"rollout_status":       FailureRuntime,
+}
+
+// ClassifyFailure returns the category of a failed deployment from the name and error of its failed
+// step, or from the deployment's error when no step failed
+func ClassifyFailure(stepName, stepError, deploymentError string) FailureCategory {
+	for _, message := range []string{stepError, deploymentError} {
+		for _, rule := range failureRules {
+			if message != "" && rule.pattern.MatchString(message) {
+				return rule.category
+			}
+		}
+	}
+	if category, ok := stepFailureCategories[stepName]; ok {
+		return category
+	}
+	if IsPostDeployStep(stepName) {
+		return FailureHealth
+	}
+	return FailureOther
+}
+
+// FailureCause counts the failed deployments of a project with one failure category
+type FailureCause struct {
+	Category FailureCategory `json:"category"`
+	Count    int             `json:"count"`
+}
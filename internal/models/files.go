@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RemoteWorkspaceDir is where the worker clones the repository on SSH targets. It is shared by
+// every deployment on the target, so it holds the checkout of the latest one.
+const RemoteWorkspaceDir = "/tmp/deployknot-app"
+
+// FileSource selects where the file browser reads from
+type FileSource string
+
+const (
+	// FileSourceWorkspace is the cloned repository on the target
+	FileSourceWorkspace FileSource = "workspace"
+	// FileSourceContainer is the file system of the deployment's running container
+	FileSourceContainer FileSource = "container"
+)
+
+// maxFilePathLength bounds the length of a browsed path
+const maxFilePathLength = 1024
+
+// File entry types
+const (
+	FileTypeFile    = "file"
+	FileTypeDir     = "dir"
+	FileTypeSymlink = "symlink"
+	FileTypeOther   = "other"
+)
+
+// FileEntry describes a file or directory on the target or in a container
+type FileEntry struct {
+	Name       string     `json:"name"`
+	Path       string     `json:"path"`
+	Type       string     `json:"type"`
+	Size       int64      `json:"size"`
+	Mode       string     `json:"mode"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	LinkTarget string     `json:"link_target,omitempty"`
+}
+
+// FileListing is the content of a directory
+type FileListing struct {
+	DeploymentID uuid.UUID   `json:"deployment_id"`
+	Source       FileSource  `json:"source"`
+	Path         string      `json:"path"`
+	Entries      []FileEntry `json:"entries"`
+	// Truncated is set when the directory has more entries than were listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ParseFileSource parses a file source, defaulting to the workspace
+func ParseFileSource(value string) (FileSource, error) {
+	switch FileSource(strings.ToLower(value)) {
+	case "", FileSourceWorkspace:
+		return FileSourceWorkspace, nil
+	case FileSourceContainer:
+		return FileSourceContainer, nil
+	}
+	return "", fmt.Errorf("source must be %q or %q", FileSourceWorkspace, FileSourceContainer)
+}
+
+// ValidateFilePath validates a path requested from the file browser; it is resolved against the
+// root of the source, so ".." cannot leave it
+func ValidateFilePath(p string) error {
+	if len(p) > maxFilePathLength {
+		return fmt.Errorf("path must be at most %d characters", maxFilePathLength)
+	}
+	if strings.ContainsAny(p, "\x00\r\n") {
+		return fmt.Errorf("path contains invalid characters")
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GateStatus is the state of an external check a deployment waits for
+type GateStatus string
+
+const (
+	GateStatusWaiting  GateStatus = "waiting"
+	GateStatusPassed   GateStatus = "passed"
+	GateStatusFailed   GateStatus = "failed"
+	GateStatusTimedOut GateStatus = "timed_out"
+)
+
+// ProjectGateSpec describes an external check every deployment of a project waits for, such as CI
+// reporting "tests-passed" for the deployed commit
+type ProjectGateSpec struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// TimeoutMinutes is how long a deployment waits for the gate before it fails
+	TimeoutMinutes int `yaml:"timeout_minutes" json:"timeout_minutes"`
+}
+
+// DeploymentGate is a gate of a deployment and what was reported for it
+type DeploymentGate struct {
+	DeploymentID uuid.UUID  `json:"deployment_id"`
+	Name         string     `json:"name"`
+	Status       GateStatus `json:"status"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	Details      *string    `json:"details,omitempty"`
+	URL          *string    `json:"url,omitempty"`
+	ReportedBy   *uuid.UUID `json:"reported_by,omitempty"`
+	ReportedAt   *time.Time `json:"reported_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ReportGateRequest reports the result of an external check for a deployment
+type ReportGateRequest struct {
+	Status  GateStatus `json:"status" binding:"required,oneof=passed failed"`
+	Details string     `json:"details" binding:"max=2000"`
+	URL     string     `json:"url" binding:"omitempty,url,max=2000"`
+}
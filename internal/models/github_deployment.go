@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GitHubDeploymentState is the state of a deployment status in GitHub's Deployments API
+type GitHubDeploymentState string
+
+const (
+	GitHubDeploymentStateQueued     GitHubDeploymentState = "queued"
+	GitHubDeploymentStateInProgress GitHubDeploymentState = "in_progress"
+	GitHubDeploymentStateSuccess    GitHubDeploymentState = "success"
+	GitHubDeploymentStateFailure    GitHubDeploymentState = "failure"
+	GitHubDeploymentStateError      GitHubDeploymentState = "error"
+)
+
+// GitHubDeploymentState returns the GitHub deployment state a deployment status is reported as.
+// Cancelled and aborted deployments did not fail on their own, so they are reported as errors.
+func (s DeploymentStatus) GitHubDeploymentState() GitHubDeploymentState {
+	switch s {
+	case DeploymentStatusRunning:
+		return GitHubDeploymentStateInProgress
+	case DeploymentStatusCompleted:
+		return GitHubDeploymentStateSuccess
+	case DeploymentStatusFailed:
+		return GitHubDeploymentStateFailure
+	case DeploymentStatusCancelled, DeploymentStatusAborted:
+		return GitHubDeploymentStateError
+	default:
+		return GitHubDeploymentStateQueued
+	}
+}
+
+// GitHubDeploymentUpdate is a deployment whose status has not been reported to GitHub yet
+type GitHubDeploymentUpdate struct {
+	DeploymentID   uuid.UUID
+	Status         DeploymentStatus
+	RepoURL        string
+	Branch         string
+	CommitSHA      *string
+	ProjectName    *string
+	DeploymentName *string
+	TargetType     TargetType
+	TargetIP       string
+	Port           int
+	ErrorMessage   *string
+	PATEncrypted   string
+	CreatedAt      time.Time
+	// GitHubDeploymentID is the GitHub deployment created for the deployment, nil until it is created
+	GitHubDeploymentID *int64
+}
+
+// Environment returns the GitHub environment the deployment is reported to: its deployment name,
+// or its project when it has none
+func (u *GitHubDeploymentUpdate) Environment() string {
+	if u.DeploymentName != nil && *u.DeploymentName != "" {
+		return *u.DeploymentName
+	}
+	if u.ProjectName != nil && *u.ProjectName != "" {
+		return *u.ProjectName
+	}
+	return "deployknot"
+}
+
+// Ref returns the commit the deployment deploys, or its branch when no commit was pinned
+func (u *GitHubDeploymentUpdate) Ref() string {
+	if u.CommitSHA != nil && *u.CommitSHA != "" {
+		return *u.CommitSHA
+	}
+	return u.Branch
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IncidentStatus is the state of an incident raised for a failed environment of a project
+type IncidentStatus string
+
+const (
+	IncidentStatusTriggered IncidentStatus = "triggered"
+	IncidentStatusResolved  IncidentStatus = "resolved"
+)
+
+// IncidentEvent is a change of an incident delivered to its incident management service
+type IncidentEvent string
+
+const (
+	IncidentEventTrigger IncidentEvent = "trigger"
+	IncidentEventResolve IncidentEvent = "resolve"
+)
+
+// IncidentSeverity is how urgent an incident is; it maps to a PagerDuty severity and an Opsgenie
+// priority
+type IncidentSeverity string
+
+const (
+	IncidentSeverityCritical IncidentSeverity = "critical"
+	IncidentSeverityError    IncidentSeverity = "error"
+	IncidentSeverityWarning  IncidentSeverity = "warning"
+	IncidentSeverityInfo     IncidentSeverity = "info"
+)
+
+// OpsgeniePriority returns the Opsgenie priority of the severity, from P1 for critical to P4
+func (s IncidentSeverity) OpsgeniePriority() string {
+	switch s {
+	case IncidentSeverityError:
+		return "P2"
+	case IncidentSeverityWarning:
+		return "P3"
+	case IncidentSeverityInfo:
+		return "P4"
+	default:
+		return "P1"
+	}
+}
+
+// postDeploySteps are the steps that check a deployed application; their failure means the
+// deployment degraded the target's health
+var postDeploySteps = map[string]bool{
+	"health_check":  true,
+	"smoke_tests":   true,
+	"latency_check": true,
+}
+
+// IsPostDeployStep reports whether a step checks the health of the deployed application
+func IsPostDeployStep(stepName string) bool {
+	return postDeploySteps[stepName]
+}
+
+// ProjectIncidentSpec raises an incident in an incident management service, such as PagerDuty or
+// Opsgenie, when a deployment of the project fails, and resolves it once a later deployment of the
+// same environment completes. Service names one of the INCIDENT_SERVICES configured on the server.
+type ProjectIncidentSpec struct {
+	Service string `yaml:"service" json:"service"`
+	// Environments are the deployment names incidents are raised for; all of them when empty
+	Environments []string `yaml:"environments,omitempty" json:"environments,omitempty"`
+	// Severity is critical by default
+	Severity IncidentSeverity `yaml:"severity,omitempty" json:"severity,omitempty"`
+}
+
+// GetSeverity returns the severity of the incidents, critical by default
+func (s ProjectIncidentSpec) GetSeverity() IncidentSeverity {
+	if s.Severity == "" {
+		return IncidentSeverityCritical
+	}
+	return s.Severity
+}
+
+// Validate checks the incident policy
+func (s ProjectIncidentSpec) Validate() error {
+	if !channelNamePattern.MatchString(s.Service) {
+		return fmt.Errorf("service name %q must start with a lowercase letter or digit and contain only lowercase letters, digits, '_' and '-'", s.Service)
+	}
+	switch s.GetSeverity() {
+	case IncidentSeverityCritical, IncidentSeverityError, IncidentSeverityWarning, IncidentSeverityInfo:
+	default:
+		return fmt.Errorf("severity must be one of critical, error, warning, info, got %q", s.Severity)
+	}
+	for _, environment := range s.Environments {
+		if environment == "" || len(environment) > 200 {
+			return fmt.Errorf("environments must be non-empty deployment names of at most 200 characters")
+		}
+	}
+	return nil
+}
+
+// IncidentFailure is a failed deployment no incident was raised for yet
+type IncidentFailure struct {
+	ProjectID   uuid.UUID
+	ProjectName string
+	Service     string
+	Severity    IncidentSeverity
+	// Environment is the deployment name, empty for deployments without one
+	Environment  string
+	DeploymentID uuid.UUID
+	// FailedAt is the creation time of the deployment, which later deployments are compared to
+	FailedAt time.Time
+}
+
+// DeploymentIncident is an incident raised for the failed deployments of a project environment.
+// Failures of the environment while it is triggered are added to it.
+type DeploymentIncident struct {
+	ID          uuid.UUID        `json:"id"`
+	ProjectID   uuid.UUID        `json:"project_id"`
+	ProjectName string           `json:"project_name"`
+	Environment string           `json:"environment"`
+	Service     string           `json:"service"`
+	Severity    IncidentSeverity `json:"severity"`
+	Status      IncidentStatus   `json:"status"`
+	// DeploymentID is the latest failed deployment of the incident
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty"`
+	Failures     int        `json:"failures"`
+	// LastFailedAt is the creation time of the latest failed deployment
+	LastFailedAt           time.Time  `json:"last_failed_at"`
+	ResolvedByDeploymentID *uuid.UUID `json:"resolved_by_deployment_id,omitempty"`
+	// PendingEvent is the event still to be delivered to the service
+	PendingEvent *IncidentEvent `json:"pending_event,omitempty"`
+	// LastError is why the pending event could not be delivered
+	LastError   *string    `json:"last_error,omitempty"`
+	TriggeredAt time.Time  `json:"triggered_at"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// DedupKey identifies the incident to its service, so repeated events update the same incident
+func (i *DeploymentIncident) DedupKey() string {
+	return "deployknot-" + i.ID.String()
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobRecord is the lifecycle of a deployment job as kept in PostgreSQL once the job has expired
+// from Redis. It holds no job data, which carries credentials.
+type JobRecord struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	DeploymentID uuid.UUID  `json:"deployment_id" db:"deployment_id"`
+	Type         string     `json:"type" db:"type"`
+	Status       string     `json:"status" db:"status"`
+	Pool         string     `json:"pool" db:"pool"`
+	Requeues     int        `json:"requeues" db:"requeues"`
+	Deferrals    int        `json:"deferrals" db:"deferrals"`
+	ErrorMessage *string    `json:"error_message,omitempty" db:"error_message"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// JobFilter narrows the jobs listed by the jobs API; zero fields match every job
+type JobFilter struct {
+	// UserID restricts the jobs to the deployments of a user; nil for administrators
+	UserID       *uuid.UUID
+	DeploymentID *uuid.UUID
+	Status       string
+	Pool         string
+}
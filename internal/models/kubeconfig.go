@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubeconfigFields lists the fields a kubeconfig may set, by the path of the mapping holding them.
+// kubectl runs on the worker, so a kubeconfig must not name commands to run (exec, auth-provider)
+// or files to read (certificate-authority, client-key, tokenFile, ...): only inline credentials
+// are accepted.
+var kubeconfigFields = map[string][]string{
+	"":                   {"apiVersion", "kind", "clusters", "contexts", "users", "current-context", "preferences"},
+	"clusters[]":         {"name", "cluster"},
+	"clusters[].cluster": {"server", "certificate-authority-data", "tls-server-name", "insecure-skip-tls-verify", "disable-compression"},
+	"contexts[]":         {"name", "context"},
+	"contexts[].context": {"cluster", "user", "namespace"},
+	"users[]":            {"name", "user"},
+	"users[].user":       {"token", "client-certificate-data", "client-key-data"},
+}
+
+// ValidateKubeconfig validates a kubeconfig given for a Kubernetes target. Clusters and users may
+// only use inline credentials; exec plugins, auth providers and file paths are rejected.
+func ValidateKubeconfig(kubeconfig string) error {
+	if strings.TrimSpace(kubeconfig) == "" {
+		return fmt.Errorf("kubeconfig is required for kubernetes targets")
+	}
+	var document interface{}
+	if err := yaml.Unmarshal([]byte(kubeconfig), &document); err != nil {
+		return fmt.Errorf("kubeconfig is not valid YAML: %w", err)
+	}
+	return checkKubeconfigMapping(document, "", "kubeconfig")
+}
+
+// checkKubeconfigMapping checks a mapping of a kubeconfig at the given path against the fields
+// allowed there; at names it in errors
+func checkKubeconfigMapping(value interface{}, path, at string) error {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be a mapping", at)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	allowed := kubeconfigFields[path]
+	for _, key := range keys {
+		child, childAt := fields[key], at+"."+key
+		if !slices.Contains(allowed, key) {
+			return fmt.Errorf("%s is not allowed; kubeconfigs may only use inline credentials (certificate-authority-data, client-certificate-data, client-key-data or token)", childAt)
+		}
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+
+		switch {
+		case path == "" && key == "preferences":
+			// kubectl's preferences are not needed; only an empty mapping is accepted
+			if preferences, ok := child.(map[string]interface{}); child != nil && (!ok || len(preferences) > 0) {
+				return fmt.Errorf("%s is not allowed", childAt)
+			}
+		case kubeconfigFields[childPath+"[]"] != nil:
+			if child == nil {
+				continue
+			}
+			items, ok := child.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s must be a list", childAt)
+			}
+			for i, item := range items {
+				if err := checkKubeconfigMapping(item, childPath+"[]", fmt.Sprintf("%s[%d]", childAt, i)); err != nil {
+					return err
+				}
+			}
+		case kubeconfigFields[childPath] != nil:
+			if child == nil {
+				continue
+			}
+			if err := checkKubeconfigMapping(child, childPath, childAt); err != nil {
+				return err
+			}
+		default:
+			switch child.(type) {
+			case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+				return fmt.Errorf("%s must be a single value", childAt)
+			}
+		}
+	}
+	return nil
+}
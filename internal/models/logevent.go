@@ -0,0 +1,246 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// LogLevel is the severity of a deployment log entry
+type LogLevel string
+
+const (
+	LogLevelInfo  LogLevel = "info"
+	LogLevelWarn  LogLevel = "warn"
+	LogLevelError LogLevel = "error"
+)
+
+// logLevelSeverities orders the log levels from the least to the most severe
+var logLevelSeverities = map[LogLevel]int{
+	LogLevelInfo:  0,
+	LogLevelWarn:  1,
+	LogLevelError: 2,
+}
+
+// ParseLogLevel returns the log level with the given name, in any case, and whether it exists;
+// "warning" names warn
+func ParseLogLevel(name string) (LogLevel, bool) {
+	level := LogLevel(strings.ToLower(strings.TrimSpace(name)))
+	if level == "warning" {
+		level = LogLevelWarn
+	}
+	_, ok := logLevelSeverities[level]
+	return level, ok
+}
+
+// AtLeast returns the log levels at least as severe as l
+func (l LogLevel) AtLeast() []LogLevel {
+	var levels []LogLevel
+	for _, level := range []LogLevel{LogLevelInfo, LogLevelWarn, LogLevelError} {
+		if logLevelSeverities[level] >= logLevelSeverities[l] {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// LogCategory groups deployment log entries by the part of the deployment they come from, so
+// clients can filter them
+type LogCategory string
+
+const (
+	LogCategoryGit        LogCategory = "GIT"
+	LogCategoryDocker     LogCategory = "DOCKER"
+	LogCategorySSH        LogCategory = "SSH"
+	LogCategoryHealth     LogCategory = "HEALTH"
+	LogCategoryKubernetes LogCategory = "KUBERNETES"
+	LogCategoryScript     LogCategory = "SCRIPT"
+	// LogCategorySystem covers messages of the target's operating system, such as its journal
+	LogCategorySystem LogCategory = "SYSTEM"
+	// LogCategoryDeployment covers the deployment as a whole: its lifecycle, gates, hooks and rollbacks
+	LogCategoryDeployment LogCategory = "DEPLOYMENT"
+)
+
+// logCategories are the valid log categories
+var logCategories = map[LogCategory]bool{
+	LogCategoryGit:        true,
+	LogCategoryDocker:     true,
+	LogCategorySSH:        true,
+	LogCategoryHealth:     true,
+	LogCategoryKubernetes: true,
+	LogCategoryScript:     true,
+	LogCategorySystem:     true,
+	LogCategoryDeployment: true,
+}
+
+// LogCategories returns the log categories in the order of a deployment
+func LogCategories() []LogCategory {
+	return []LogCategory{
+		LogCategorySSH,
+		LogCategoryGit,
+		LogCategoryDocker,
+		LogCategoryKubernetes,
+		LogCategoryScript,
+		LogCategoryHealth,
+		LogCategorySystem,
+		LogCategoryDeployment,
+	}
+}
+
+// ParseLogCategory returns the log category with the given name, in any case, and whether it exists
+func ParseLogCategory(name string) (LogCategory, bool) {
+	category := LogCategory(strings.ToUpper(strings.TrimSpace(name)))
+	return category, logCategories[category]
+}
+
+// taskCategories are the categories of the tasks whose names do not start with a category prefix
+var taskCategories = map[string]LogCategory{
+	"repo_config":     LogCategoryGit,
+	"secret_scan":     LogCategoryGit,
+	"image_check":     LogCategoryDocker,
+	"container_check": LogCategoryDocker,
+	"env_setup":       LogCategoryDocker,
+	"env_upload":      LogCategoryDocker,
+	"env_copy":        LogCategoryDocker,
+	"env_check":       LogCategoryDocker,
+	"health_check":    LogCategoryHealth,
+	"smoke_tests":     LogCategoryHealth,
+	"latency_check":   LogCategoryHealth,
+	"kubectl_apply":   LogCategoryKubernetes,
+	"image_signature": LogCategoryKubernetes,
+	"rollout_status":  LogCategoryKubernetes,
+	"run_script":      LogCategoryScript,
+	"target_logs":     LogCategorySystem,
+	"pull_image":      LogCategoryDocker,
+	"create_volume":   LogCategoryDocker,
+	"managed_service": LogCategoryDocker,
+	"install_cron":    LogCategorySystem,
+}
+
+// LogCategoryForTask returns the category of the log entries of a task, such as GIT for git_clone
+func LogCategoryForTask(taskName string) LogCategory {
+	if category, ok := taskCategories[taskName]; ok {
+		return category
+	}
+	switch {
+	case strings.HasPrefix(taskName, "git_"):
+		return LogCategoryGit
+	case strings.HasPrefix(taskName, "docker_"):
+		return LogCategoryDocker
+	case strings.HasPrefix(taskName, "ssh_"):
+		return LogCategorySSH
+	default:
+		return LogCategoryDeployment
+	}
+}
+
+// LogEventCode identifies a kind of deployment log entry independently of its English message, so
+// clients can localize and filter it. The values of its parameters are stored with the entry.
+type LogEventCode string
+
+const (
+	LogEventDeploymentStarted    LogEventCode = "DEPLOYMENT_STARTED"
+	LogEventDeploymentCompleted  LogEventCode = "DEPLOYMENT_COMPLETED"
+	LogEventDeploymentFailed     LogEventCode = "DEPLOYMENT_FAILED"
+	LogEventDeploymentCancelled  LogEventCode = "DEPLOYMENT_CANCELLED"
+	LogEventSSHConnected         LogEventCode = "SSH_CONNECTED"
+	LogEventSSHConnectFailed     LogEventCode = "SSH_CONNECT_FAILED"
+	LogEventGitCloneStarted      LogEventCode = "GIT_CLONE_STARTED"
+	LogEventGitCloneSucceeded    LogEventCode = "GIT_CLONE_SUCCEEDED"
+	LogEventGitCloneFailed       LogEventCode = "GIT_CLONE_FAILED"
+	LogEventDockerBuildStarted   LogEventCode = "DOCKER_BUILD_STARTED"
+	LogEventDockerBuildSucceeded LogEventCode = "DOCKER_BUILD_SUCCEEDED"
+	LogEventDockerBuildFailed    LogEventCode = "DOCKER_BUILD_FAILED"
+	LogEventDockerRunStarted     LogEventCode = "DOCKER_RUN_STARTED"
+	LogEventDockerRunSucceeded   LogEventCode = "DOCKER_RUN_SUCCEEDED"
+	LogEventDockerRunFailed      LogEventCode = "DOCKER_RUN_FAILED"
+	LogEventHealthCheckStarted   LogEventCode = "HEALTH_CHECK_STARTED"
+	LogEventHealthCheckPassed    LogEventCode = "HEALTH_CHECK_PASSED"
+	LogEventHealthCheckFailed    LogEventCode = "HEALTH_CHECK_FAILED"
+)
+
+// LogEvent describes a log event code: its category, level and English message template. Templates
+// refer to parameters as {name}.
+type LogEvent struct {
+	Code     LogEventCode `json:"code"`
+	Category LogCategory  `json:"category"`
+	Level    LogLevel     `json:"level"`
+	Template string       `json:"template"`
+	// Params are the names of the parameters the template uses
+	Params []string `json:"params,omitempty"`
+}
+
+// logEvents is the catalog of log event codes
+var logEvents = map[LogEventCode]LogEvent{
+	LogEventDeploymentStarted:    {Category: LogCategoryDeployment, Level: LogLevelInfo, Template: "Starting deployment process"},
+	LogEventDeploymentCompleted:  {Category: LogCategoryDeployment, Level: LogLevelInfo, Template: "Deployment completed successfully"},
+	LogEventDeploymentFailed:     {Category: LogCategoryDeployment, Level: LogLevelError, Template: "Deployment failed: {error}", Params: []string{"error"}},
+	LogEventDeploymentCancelled:  {Category: LogCategoryDeployment, Level: LogLevelWarn, Template: "Deployment was cancelled, stopped processing it"},
+	LogEventSSHConnected:         {Category: LogCategorySSH, Level: LogLevelInfo, Template: "SSH connection established"},
+	LogEventSSHConnectFailed:     {Category: LogCategorySSH, Level: LogLevelError, Template: "Failed to connect to target server {target}: {error}", Params: []string{"target", "error"}},
+	LogEventGitCloneStarted:      {Category: LogCategoryGit, Level: LogLevelInfo, Template: "Starting repository clone"},
+	LogEventGitCloneSucceeded:    {Category: LogCategoryGit, Level: LogLevelInfo, Template: "Repository cloned successfully: {output}", Params: []string{"output"}},
+	LogEventGitCloneFailed:       {Category: LogCategoryGit, Level: LogLevelError, Template: "Git clone failed: {error}", Params: []string{"error"}},
+	LogEventDockerBuildStarted:   {Category: LogCategoryDocker, Level: LogLevelInfo, Template: "Starting Docker build"},
+	LogEventDockerBuildSucceeded: {Category: LogCategoryDocker, Level: LogLevelInfo, Template: "Docker image built successfully: {output}", Params: []string{"output"}},
+	LogEventDockerBuildFailed:    {Category: LogCategoryDocker, Level: LogLevelError, Template: "Docker build failed: {error}", Params: []string{"error"}},
+	LogEventDockerRunStarted:     {Category: LogCategoryDocker, Level: LogLevelInfo, Template: "Starting Docker container"},
+	LogEventDockerRunSucceeded:   {Category: LogCategoryDocker, Level: LogLevelInfo, Template: "Docker container started successfully with ID: {container_id}", Params: []string{"container_id"}},
+	LogEventDockerRunFailed:      {Category: LogCategoryDocker, Level: LogLevelError, Template: "Docker run failed: {error}", Params: []string{"error"}},
+	LogEventHealthCheckStarted:   {Category: LogCategoryHealth, Level: LogLevelInfo, Template: "Starting health check"},
+	LogEventHealthCheckPassed:    {Category: LogCategoryHealth, Level: LogLevelInfo, Template: "Health check passed: {output}", Params: []string{"output"}},
+	LogEventHealthCheckFailed:    {Category: LogCategoryHealth, Level: LogLevelError, Template: "Health check failed: {error}", Params: []string{"error"}},
+}
+
+// Event returns the catalog entry of the code
+func (c LogEventCode) Event() LogEvent {
+	event := logEvents[c]
+	event.Code = c
+	if event.Category == "" {
+		event.Category = LogCategoryDeployment
+	}
+	if event.Level == "" {
+		event.Level = LogLevelInfo
+	}
+	return event
+}
+
+// Render returns the English message of the code with its parameters filled in
+func (c LogEventCode) Render(params map[string]string) string {
+	template := logEvents[c].Template
+	if template == "" {
+		return string(c)
+	}
+	replacements := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// LogEvents returns the catalog of log event codes ordered by code
+func LogEvents() []LogEvent {
+	events := make([]LogEvent, 0, len(logEvents))
+	for code := range logEvents {
+		events = append(events, code.Event())
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Code < events[j].Code
+	})
+	return events
+}
+
+// DeploymentLogFilter selects the logs of a deployment; empty fields select everything
+type DeploymentLogFilter struct {
+	Categories []LogCategory
+	// Levels are the log levels to return, those at least as severe as the requested level
+	Levels    []LogLevel
+	TaskNames []string
+}
+
+// ShippedLog is a deployment log entry sent to an external log sink, with the names of its
+// deployment so the sink can index them
+type ShippedLog struct {
+	*DeploymentLog
+	ProjectName    *string
+	DeploymentName *string
+}
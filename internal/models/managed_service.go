@@ -0,0 +1,382 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ManagedEngine is the database a managed service runs
+type ManagedEngine string
+
+const (
+	ManagedEnginePostgres ManagedEngine = "postgres"
+	ManagedEngineRedis    ManagedEngine = "redis"
+	ManagedEngineMySQL    ManagedEngine = "mysql"
+)
+
+// DefaultManagedBackupRetention is how many backups of a managed service are kept by default
+const DefaultManagedBackupRetention = 7
+
+// maxManagedBackupRetention bounds the backups kept of a managed service
+const maxManagedBackupRetention = 365
+
+var (
+	// managedServiceNamePattern matches managed service names such as "shop-db". The name becomes
+	// the container name and the prefix of the connection variables, so it starts with a letter.
+	managedServiceNamePattern = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+	// managedIdentifierPattern matches database and user names, which reach SQL unquoted
+	managedIdentifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,62}$`)
+	// imageTagPattern matches Docker image tags such as "16" or "7.2-alpine"
+	imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// ManagedContainer describes how the container of a managed service is run
+type ManagedContainer struct {
+	Image string
+	// Port is the port the database listens on inside the container
+	Port int
+	// DataDir is where the volume is mounted, the directory the database keeps its data in
+	DataDir string
+	// HealthCheck is a shell command that succeeds once the database accepts connections. It reads
+	// the credentials from the container environment, so they never appear in the container config.
+	HealthCheck string
+	// Command replaces the command of the image when set
+	Command []string
+}
+
+// managedEngineSpec describes an engine: its official image and how it is configured
+type managedEngineSpec struct {
+	image          string
+	defaultVersion string
+	port           int
+	dataDir        string
+	healthCheck    string
+	command        []string
+	scheme         string
+	// sql engines have a database and a user
+	sql bool
+	// backup is how the data of the service is backed up and restored
+	backup ManagedBackup
+}
+
+var managedEngines = map[ManagedEngine]managedEngineSpec{
+	ManagedEnginePostgres: {
+		image:          "postgres",
+		defaultVersion: "16",
+		port:           5432,
+		dataDir:        "/var/lib/postgresql/data",
+		healthCheck:    `pg_isready -U "$POSTGRES_USER" -d "$POSTGRES_DB"`,
+		scheme:         "postgres",
+		sql:            true,
+		backup: ManagedBackup{
+			Method:    "pg_dump",
+			Extension: ".dump",
+			Dump:      `exec pg_dump -U "$POSTGRES_USER" -Fc "$POSTGRES_DB"`,
+			Load:      `exec pg_restore -U "$POSTGRES_USER" -d "$POSTGRES_DB" --clean --if-exists --no-owner`,
+		},
+	},
+	ManagedEngineMySQL: {
+		image:          "mysql",
+		defaultVersion: "8.4",
+		port:           3306,
+		dataDir:        "/var/lib/mysql",
+		healthCheck:    `mysqladmin ping -h 127.0.0.1 -u root -p"$MYSQL_ROOT_PASSWORD" --silent`,
+		scheme:         "mysql",
+		sql:            true,
+		backup: ManagedBackup{
+			Method:    "mysqldump",
+			Extension: ".sql.gz",
+			Dump:      `MYSQL_PWD="$MYSQL_ROOT_PASSWORD" exec mysqldump -u root --single-transaction --routines --triggers --databases "$MYSQL_DATABASE"`,
+			Load:      `MYSQL_PWD="$MYSQL_ROOT_PASSWORD" exec mysql -u root`,
+			Compress:  true,
+		},
+	},
+	ManagedEngineRedis: {
+		image:          "redis",
+		defaultVersion: "7",
+		port:           6379,
+		dataDir:        "/data",
+		healthCheck:    `redis-cli -a "$REDIS_PASSWORD" --no-auth-warning ping | grep -q PONG`,
+		command:        []string{"sh", "-c", `exec redis-server --requirepass "$REDIS_PASSWORD" --appendonly yes`},
+		scheme:         "redis",
+		backup: ManagedBackup{
+			Method:    "tar",
+			Extension: ".tar.gz",
+			Dump:      `redis-cli -a "$REDIS_PASSWORD" --no-auth-warning SAVE >/dev/null && exec tar cf - -C /data .`,
+			Load:      `find /data -mindepth 1 -delete && exec tar xf - -C /data`,
+			Compress:  true,
+			Offline:   true,
+		},
+	},
+}
+
+// ManagedContainerFor returns how the container of an engine is run at a version
+func ManagedContainerFor(engine ManagedEngine, version string) (*ManagedContainer, error) {
+	spec, ok := managedEngines[engine]
+	if !ok {
+		return nil, fmt.Errorf("engine must be %q, %q or %q", ManagedEnginePostgres, ManagedEngineMySQL, ManagedEngineRedis)
+	}
+	if !imageTagPattern.MatchString(version) {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+	return &ManagedContainer{
+		Image:       spec.image + ":" + version,
+		Port:        spec.port,
+		DataDir:     spec.dataDir,
+		HealthCheck: spec.healthCheck,
+		Command:     spec.command,
+	}, nil
+}
+
+// ManagedService is a database DeployKnot runs on a target from its official image, with a
+// generated password and a persistent volume. Deployments on the same target that use it get its
+// connection variables.
+type ManagedService struct {
+	ID       uuid.UUID     `json:"id" db:"id"`
+	UserID   uuid.UUID     `json:"user_id" db:"user_id"`
+	Name     string        `json:"name" db:"name"`
+	Engine   ManagedEngine `json:"engine" db:"engine"`
+	Version  string        `json:"version" db:"version"`
+	TargetIP string        `json:"target_ip" db:"target_ip"`
+	// Port is the port the database is published on on the target
+	Port int `json:"port" db:"port"`
+	// Database and Username are empty for Redis
+	Database          string `json:"database,omitempty" db:"database_name"`
+	Username          string `json:"username,omitempty" db:"username"`
+	PasswordEncrypted string `json:"-" db:"password_encrypted"`
+	// Volume is the Docker volume the data is kept in; it outlives the container
+	Volume string `json:"volume" db:"volume"`
+	// BackupSchedule is a cron expression of when the volume is backed up; nil disables backups
+	BackupSchedule  *string `json:"backup_schedule,omitempty" db:"backup_schedule"`
+	BackupRetention int     `json:"backup_retention" db:"backup_retention"`
+	// NextBackupAt is when the next scheduled backup is due, in UTC
+	NextBackupAt *time.Time `json:"next_backup_at,omitempty" db:"next_backup_at"`
+	// DeploymentID is the latest deployment of the service
+	DeploymentID *uuid.UUID `json:"deployment_id,omitempty" db:"deployment_id"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ContainerName returns the name of the container of the service
+func (s *ManagedService) ContainerName() string {
+	return s.Name
+}
+
+// ContainerEnv returns the .env file content the container of the service is created with
+func (s *ManagedService) ContainerEnv(password string) string {
+	var lines []string
+	switch s.Engine {
+	case ManagedEnginePostgres:
+		lines = []string{"POSTGRES_USER=" + s.Username, "POSTGRES_PASSWORD=" + password, "POSTGRES_DB=" + s.Database}
+	case ManagedEngineMySQL:
+		lines = []string{"MYSQL_ROOT_PASSWORD=" + password, "MYSQL_DATABASE=" + s.Database, "MYSQL_USER=" + s.Username, "MYSQL_PASSWORD=" + password}
+	case ManagedEngineRedis:
+		lines = []string{"REDIS_PASSWORD=" + password}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// NextBackup returns when the first scheduled backup after t is due, or nil without a backup
+// schedule. Schedules are evaluated in UTC.
+func (s *ManagedService) NextBackup(t time.Time) (*time.Time, error) {
+	if s.BackupSchedule == nil {
+		return nil, nil
+	}
+	cron, err := ParseCron(*s.BackupSchedule)
+	if err != nil {
+		return nil, err
+	}
+	next := cron.Next(t.UTC())
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// EnvPrefix returns the prefix of the connection variables of the service, e.g. SHOP_DB for shop-db
+func (s *ManagedService) EnvPrefix() string {
+	return strings.ToUpper(strings.ReplaceAll(s.Name, "-", "_"))
+}
+
+// URL returns the connection URL of the service on host
+func (s *ManagedService) URL(host, password string) string {
+	spec := managedEngines[s.Engine]
+	address := host + ":" + strconv.Itoa(s.Port)
+	if !spec.sql {
+		return fmt.Sprintf("%s://:%s@%s/0", spec.scheme, password, address)
+	}
+	return fmt.Sprintf("%s://%s:%s@%s/%s", spec.scheme, s.Username, password, address, s.Database)
+}
+
+// ConnectionEnv returns the variables a deployment connects to the service with, prefixed with
+// EnvPrefix: _HOST, _PORT, _PASSWORD and _URL, and _USER and _DATABASE for SQL databases
+func (s *ManagedService) ConnectionEnv(host, password string) []string {
+	prefix := s.EnvPrefix()
+	lines := []string{
+		prefix + "_HOST=" + host,
+		prefix + "_PORT=" + strconv.Itoa(s.Port),
+	}
+	if managedEngines[s.Engine].sql {
+		lines = append(lines, prefix+"_USER="+s.Username, prefix+"_DATABASE="+s.Database)
+	}
+	return append(lines, prefix+"_PASSWORD="+password, prefix+"_URL="+s.URL(host, password))
+}
+
+// ConventionalEnvName returns the variable frameworks read the URL of such a service from:
+// DATABASE_URL for SQL databases and REDIS_URL for Redis
+func (s *ManagedService) ConventionalEnvName() string {
+	if managedEngines[s.Engine].sql {
+		return "DATABASE_URL"
+	}
+	return "REDIS_URL"
+}
+
+// ManagedServiceRequest represents the request to create a managed service
+type ManagedServiceRequest struct {
+	Name     string `json:"name" binding:"required,max=63"`
+	Engine   string `json:"engine" binding:"required"`
+	TargetIP string `json:"target_ip" binding:"required,ip"`
+	// Version is the tag of the official image, the engine's current major version by default
+	Version string `json:"version"`
+	// Port defaults to the engine's port
+	Port int `json:"port"`
+	// Database and Username default to the name of the service and "app"; Redis has neither
+	Database string `json:"database"`
+	Username string `json:"username"`
+	// BackupSchedule is a cron expression, in UTC, of when the data is backed up
+	BackupSchedule string `json:"backup_schedule" binding:"max=100"`
+	// BackupRetention is how many backups are kept, 7 by default
+	BackupRetention int `json:"backup_retention"`
+}
+
+// Validate checks the managed service request and fills in its defaults
+func (r *ManagedServiceRequest) Validate() error {
+	if !managedServiceNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits and hyphens, starting with a letter and ending with a letter or digit")
+	}
+	engine := ManagedEngine(strings.ToLower(r.Engine))
+	spec, ok := managedEngines[engine]
+	if !ok {
+		return fmt.Errorf("engine must be %q, %q or %q", ManagedEnginePostgres, ManagedEngineMySQL, ManagedEngineRedis)
+	}
+	r.Engine = string(engine)
+	if err := validateManagedSettings(spec, &r.Version, &r.Port, r.BackupSchedule, &r.BackupRetention); err != nil {
+		return err
+	}
+
+	if spec.sql {
+		if r.Database == "" {
+			r.Database = strings.ReplaceAll(r.Name, "-", "_")
+		}
+		if r.Username == "" {
+			r.Username = "app"
+		}
+		for field, value := range map[string]string{"database": r.Database, "username": r.Username} {
+			if !managedIdentifierPattern.MatchString(value) {
+				return fmt.Errorf("%s must be letters, digits and underscores, not starting with a digit", field)
+			}
+		}
+		if engine == ManagedEngineMySQL && strings.EqualFold(r.Username, "root") {
+			return fmt.Errorf("username must not be root, which the service keeps for itself")
+		}
+	} else if r.Database != "" || r.Username != "" {
+		return fmt.Errorf("%s has no database or username", engine)
+	}
+	return nil
+}
+
+// ManagedServiceUpdateRequest represents the request to change a managed service. The name,
+// engine, target and credentials cannot change, since the volume was initialized with them.
+type ManagedServiceUpdateRequest struct {
+	Version         string `json:"version"`
+	Port            int    `json:"port"`
+	BackupSchedule  string `json:"backup_schedule" binding:"max=100"`
+	BackupRetention int    `json:"backup_retention"`
+}
+
+// Validate checks the update of a managed service of an engine and fills in its defaults
+func (r *ManagedServiceUpdateRequest) Validate(engine ManagedEngine) error {
+	spec, ok := managedEngines[engine]
+	if !ok {
+		return fmt.Errorf("unknown engine %q", engine)
+	}
+	return validateManagedSettings(spec, &r.Version, &r.Port, r.BackupSchedule, &r.BackupRetention)
+}
+
+// validateManagedSettings checks the settings of a managed service that may change and fills in
+// their defaults
+func validateManagedSettings(spec managedEngineSpec, version *string, port *int, backupSchedule string, backupRetention *int) error {
+	if *version == "" {
+		*version = spec.defaultVersion
+	}
+	if !imageTagPattern.MatchString(*version) {
+		return fmt.Errorf("version must be a tag of the %s image", spec.image)
+	}
+	if *port == 0 {
+		*port = spec.port
+	}
+	if *port < 1 || *port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+
+	if backupSchedule != "" {
+		if _, err := ParseCron(backupSchedule); err != nil {
+			return fmt.Errorf("invalid backup_schedule: %w", err)
+		}
+	}
+	if *backupRetention == 0 {
+		*backupRetention = DefaultManagedBackupRetention
+	}
+	if *backupRetention < 1 || *backupRetention > maxManagedBackupRetention {
+		return fmt.Errorf("backup_retention must be between 1 and %d", maxManagedBackupRetention)
+	}
+	return nil
+}
+
+// ManagedServiceVolume returns the name of the volume of a managed service
+func ManagedServiceVolume(name string) string {
+	return "deployknot-" + name + "-data"
+}
+
+// ManagedServiceDeployRequest represents the request to deploy a managed service to its target
+type ManagedServiceDeployRequest struct {
+	SSHUsername string `json:"ssh_username" binding:"required"`
+	// SSHPassword may be empty when the target trusts the SSH certificate authority
+	SSHPassword string `json:"ssh_password"`
+}
+
+// ManagedServiceMember makes a deployment the deployment of a managed service. It is set by the
+// managed service service; clients cannot set it.
+type ManagedServiceMember struct {
+	ServiceID uuid.UUID
+	Engine    ManagedEngine
+	Version   string
+	Volume    string
+	// EnvironmentVars is the .env file content the container is created with, passed to the worker
+	// with the job
+	EnvironmentVars string
+}
+
+// ParseManagedServiceNames parses the comma-separated names of the managed services a deployment
+// uses
+func ParseManagedServiceNames(value string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if !managedServiceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid managed service name %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default schedule of a project's deployment digest: every morning at 9:00 UTC
+const (
+	DefaultDigestCron     = "0 9 * * *"
+	DefaultDigestTimezone = "UTC"
+)
+
+// Notification events
+const (
+	NotificationEventDigest     = "deployment.digest"
+	NotificationEventEscalation = "deployment.escalation"
+)
+
+// ProjectNotificationsSpec describes the notifications of a project beyond the immediate ones: a
+// periodic digest of its deployments and escalations of failures nobody fixed. Channels are names
+// of the NOTIFICATION_CHANNELS configured on the server.
+type ProjectNotificationsSpec struct {
+	Digest      *ProjectDigestSpec      `yaml:"digest,omitempty" json:"digest,omitempty"`
+	Escalations []ProjectEscalationSpec `yaml:"escalations,omitempty" json:"escalations,omitempty"`
+}
+
+// ProjectDigestSpec describes a summary of a project's deployments sent on a cron schedule
+type ProjectDigestSpec struct {
+	Channel string `yaml:"channel" json:"channel"`
+	// CronExpression is when the digest is sent, daily at 9:00 by default
+	CronExpression string `yaml:"cron_expression,omitempty" json:"cron_expression,omitempty"`
+	// Timezone is an IANA time zone name the cron expression is evaluated in, UTC by default
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+}
+
+// GetCronExpression returns when the digest is sent, daily at 9:00 by default
+func (d ProjectDigestSpec) GetCronExpression() string {
+	if d.CronExpression == "" {
+		return DefaultDigestCron
+	}
+	return d.CronExpression
+}
+
+// GetTimezone returns the time zone of the digest, UTC by default
+func (d ProjectDigestSpec) GetTimezone() string {
+	if d.Timezone == "" {
+		return DefaultDigestTimezone
+	}
+	return d.Timezone
+}
+
+// NextSend returns the first time the digest is sent after t, or nil when it is never sent again
+func (d ProjectDigestSpec) NextSend(t time.Time) (*time.Time, error) {
+	cron, err := ParseCron(d.GetCronExpression())
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(d.GetTimezone())
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", d.Timezone)
+	}
+	next := cron.Next(t.In(location))
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// ProjectEscalationSpec notifies a channel, such as a pager webhook, when a deployment of the
+// project stays failed: no later deployment of its environment completed or failed within
+// AfterMinutes of the failure
+type ProjectEscalationSpec struct {
+	// Environments are the deployment names the policy applies to; all of them when empty
+	Environments []string `yaml:"environments,omitempty" json:"environments,omitempty"`
+	AfterMinutes int      `yaml:"after_minutes" json:"after_minutes"`
+	Channel      string   `yaml:"channel" json:"channel"`
+}
+
+// ProjectDigest is the digest of a project and when it is sent next
+type ProjectDigest struct {
+	ProjectID   uuid.UUID
+	ProjectName string
+	ProjectDigestSpec
+	// NextSendAt is unset until the digest is first scheduled, and after its schedule changed
+	NextSendAt *time.Time
+	LastSentAt *time.Time
+}
+
+// DueEscalation is a failed deployment an escalation policy is due for
+type DueEscalation struct {
+	EscalationID uuid.UUID
+	Channel      string
+	AfterMinutes int
+	ProjectName  string
+	DeploymentID uuid.UUID
+}
+
+// Notification is the JSON document posted to a notification channel. Text is a readable summary,
+// so chat webhooks such as Slack's show it as the message.
+type Notification struct {
+	Event      string                  `json:"event"`
+	Text       string                  `json:"text"`
+	Project    string                  `json:"project"`
+	SentAt     time.Time               `json:"sent_at"`
+	Digest     *DeploymentDigest       `json:"digest,omitempty"`
+	Deployment *NotificationDeployment `json:"deployment,omitempty"`
+	// Contacts are the owner of the project and who is on call for it
+	Contacts *ProjectContacts `json:"contacts,omitempty"`
+}
+
+// DeploymentDigest summarizes the deployments of a project over a period
+type DeploymentDigest struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Total int       `json:"total"`
+	// Statuses counts the deployments by status
+	Statuses map[DeploymentStatus]int `json:"statuses"`
+	// Environments is the status of the latest deployment of each environment
+	Environments map[string]DeploymentStatus `json:"environments"`
+	// Failures are the latest failed deployments
+	Failures []NotificationDeployment `json:"failures,omitempty"`
+}
+
+// NotificationDeployment is a deployment as described in a notification
+type NotificationDeployment struct {
+	ID           uuid.UUID        `json:"id"`
+	Environment  string           `json:"environment,omitempty"`
+	Status       DeploymentStatus `json:"status"`
+	GitHubBranch string           `json:"github_branch"`
+	CommitSHA    *string          `json:"commit_sha,omitempty"`
+	ErrorMessage *string          `json:"error_message,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	CompletedAt  *time.Time       `json:"completed_at,omitempty"`
+	// Changelog is the commits the deployment ships, when it has a changelog
+	Changelog *DeploymentChangelog `json:"changelog,omitempty"`
+}
+
+// NewNotificationDeployment describes a deployment in a notification
+func NewNotificationDeployment(deployment *Deployment) NotificationDeployment {
+	described := NotificationDeployment{
+		ID:           deployment.ID,
+		Status:       deployment.Status,
+		GitHubBranch: deployment.GitHubBranch,
+		CommitSHA:    deployment.CommitSHA,
+		ErrorMessage: deployment.ErrorMessage,
+		CreatedAt:    deployment.CreatedAt,
+		CompletedAt:  deployment.CompletedAt,
+	}
+	if deployment.DeploymentName != nil {
+		described.Environment = *deployment.DeploymentName
+	}
+	return described
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuth providers users can sign in with
+const (
+	OAuthProviderGitHub = "github"
+	OAuthProviderGoogle = "google"
+	OAuthProviderOIDC   = "oidc"
+)
+
+// UserIdentity links a user to an account at an OAuth or OIDC provider
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"subject" db:"subject"`
+	Email       *string    `json:"email,omitempty" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// ExternalIdentity is what a provider reports about the user who signed in
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+	// Organizations are the organization slugs taken from the configured OIDC claim
+	Organizations []string
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IsolationMode controls how an organization's data is separated from other organizations
+type IsolationMode string
+
+const (
+	// IsolationShared keeps the organization's data in the shared tables, separated by the application only
+	IsolationShared IsolationMode = "shared"
+	// IsolationRLS additionally enforces separation in PostgreSQL through row-level security policies
+	IsolationRLS IsolationMode = "rls"
+)
+
+// Organization groups users and their deployments
+type Organization struct {
+	ID            uuid.UUID     `json:"id" db:"id"`
+	Name          string        `json:"name" db:"name"`
+	Slug          string        `json:"slug" db:"slug"`
+	IsolationMode IsolationMode `json:"isolation_mode" db:"isolation_mode"`
+	AllowedCIDRs  []string      `json:"allowed_cidrs" db:"allowed_cidrs"`
+	CreatedAt     time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// CreateOrganizationRequest represents the request to create an organization.
+// The isolation mode cannot be changed after creation.
+type CreateOrganizationRequest struct {
+	Name          string        `json:"name" binding:"required,max=255"`
+	Slug          string        `json:"slug" binding:"required,min=2,max=100"`
+	IsolationMode IsolationMode `json:"isolation_mode"`
+}
+
+// AssignOrganizationRequest represents the request to move a user into an organization;
+// a null organization_id removes the user from their organization
+type AssignOrganizationRequest struct {
+	OrganizationID *uuid.UUID `json:"organization_id"`
+}
+
+// UpdateIPAllowlistRequest represents the request to set the networks an organization's members may
+// create deployments and reach targets from; an empty list allows any network
+type UpdateIPAllowlistRequest struct {
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
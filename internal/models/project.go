@@ -0,0 +1,136 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProjectConfig document identifiers
+const (
+	ProjectConfigAPIVersion = "deployknot/v1"
+	ProjectConfigKind       = "Project"
+)
+
+// Project represents a project in the system
+type Project struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description *string   `json:"description,omitempty" db:"description"`
+	IsActive    bool      `json:"is_active" db:"is_active"`
+	WorkerPool  *string   `json:"worker_pool,omitempty" db:"worker_pool"`
+	// Owner is the team or person responsible for the project
+	Owner *string `json:"owner,omitempty" db:"owner"`
+	// OrganizationID is the organization whose members deploy the project
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"`
+	// PublicStatus publishes the project's deployment status on the public status page
+	PublicStatus bool `json:"public_status" db:"public_status"`
+	// ImageSignaturePolicy is whether the images of the project's deployments must be signed by one
+	// of its signing keys
+	ImageSignaturePolicy ImageSignaturePolicy `json:"image_signature_policy" db:"image_signature_policy"`
+	CreatedAt            time.Time            `json:"created_at" db:"created_at"`
+	UpdatedAt            time.Time            `json:"updated_at" db:"updated_at"`
+}
+
+// ProjectTarget is a named deployment target of a project
+type ProjectTarget struct {
+	ID        uuid.UUID `json:"id"`
+	ProjectID uuid.UUID `json:"project_id"`
+	ProjectTargetSpec
+	// SSHKeyFingerprint and SSHHostKeyFingerprint are recorded when the target is bootstrapped
+	SSHKeyFingerprint     *string    `json:"ssh_key_fingerprint,omitempty"`
+	SSHHostKeyFingerprint *string    `json:"ssh_host_key_fingerprint,omitempty"`
+	BootstrappedAt        *time.Time `json:"bootstrapped_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// ProjectTemplate is a deployment template of a project
+type ProjectTemplate struct {
+	ID        uuid.UUID `json:"id"`
+	ProjectID uuid.UUID `json:"project_id"`
+	ProjectTemplateSpec
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProjectConfig is the portable configuration of a project, exported and imported as YAML
+type ProjectConfig struct {
+	APIVersion string                `yaml:"apiVersion" json:"api_version"`
+	Kind       string                `yaml:"kind" json:"kind"`
+	Project    ProjectSpec           `yaml:"project" json:"project"`
+	Templates  []ProjectTemplateSpec `yaml:"templates,omitempty" json:"templates,omitempty"`
+	Targets    []ProjectTargetSpec   `yaml:"targets,omitempty" json:"targets,omitempty"`
+	// FreezeWindows are periods in which deployments of the project are rejected
+	FreezeWindows []ProjectFreezeWindowSpec `yaml:"freeze_windows,omitempty" json:"freeze_windows,omitempty"`
+	// Gates are external checks every deployment of the project waits for before it starts
+	Gates []ProjectGateSpec `yaml:"gates,omitempty" json:"gates,omitempty"`
+	// Notifications are the digest and escalation policies of the project
+	Notifications *ProjectNotificationsSpec `yaml:"notifications,omitempty" json:"notifications,omitempty"`
+	// Incidents raises incidents in PagerDuty or Opsgenie for failed deployments of the project
+	Incidents *ProjectIncidentSpec `yaml:"incidents,omitempty" json:"incidents,omitempty"`
+}
+
+// ProjectSpec describes the project itself
+type ProjectSpec struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// WorkerPool is the worker pool every deployment of the project must run on
+	WorkerPool string `yaml:"worker_pool,omitempty" json:"worker_pool,omitempty"`
+	// Owner is the team or person responsible for the project, such as "payments-team"
+	Owner string `yaml:"owner,omitempty" json:"owner,omitempty"`
+	// Organization is the slug of the organization whose members deploy the project. Without one,
+	// any user may deploy under the project's name and the project has no status page or badge.
+	Organization string `yaml:"organization,omitempty" json:"organization,omitempty"`
+	// PublicStatus shows the deployment status of the project on the status page, without an account
+	PublicStatus bool `yaml:"public_status,omitempty" json:"public_status,omitempty"`
+	// ImageSignaturePolicy is off (the default), warn or enforce; see ImageSignaturePolicy
+	ImageSignaturePolicy ImageSignaturePolicy `yaml:"image_signature_policy,omitempty" json:"image_signature_policy,omitempty"`
+}
+
+// ProjectTemplateSpec describes a deployment template of a project
+type ProjectTemplateSpec struct {
+	Name             string                 `yaml:"name" json:"name"`
+	Description      string                 `yaml:"description,omitempty" json:"description,omitempty"`
+	PlaybookTemplate string                 `yaml:"playbook_template" json:"playbook_template"`
+	DefaultVars      map[string]interface{} `yaml:"default_vars,omitempty" json:"default_vars,omitempty"`
+}
+
+// ProjectTargetSpec describes a named deployment target of a project; credentials are never included
+type ProjectTargetSpec struct {
+	Name                string     `yaml:"name" json:"name"`
+	TargetType          TargetType `yaml:"target_type,omitempty" json:"target_type,omitempty"`
+	TargetIP            string     `yaml:"target_ip,omitempty" json:"target_ip,omitempty"`
+	SSHUsername         string     `yaml:"ssh_username,omitempty" json:"ssh_username,omitempty"`
+	Port                int        `yaml:"port,omitempty" json:"port,omitempty"`
+	KubernetesNamespace string     `yaml:"kubernetes_namespace,omitempty" json:"kubernetes_namespace,omitempty"`
+	// WorkerPool is the worker pool deployments to this target must run on, e.g. one inside its network
+	WorkerPool string `yaml:"worker_pool,omitempty" json:"worker_pool,omitempty"`
+}
+
+// ProjectFreezeWindowSpec describes a change freeze of a project, such as a holiday or a release
+// weekend. It is in effect from StartsAt up to, but not including, EndsAt.
+type ProjectFreezeWindowSpec struct {
+	StartsAt time.Time `yaml:"starts_at" json:"starts_at"`
+	EndsAt   time.Time `yaml:"ends_at" json:"ends_at"`
+	Reason   string    `yaml:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// Active reports whether the freeze window is in effect at t
+func (w ProjectFreezeWindowSpec) Active(t time.Time) bool {
+	return !t.Before(w.StartsAt) && t.Before(w.EndsAt)
+}
+
+// ProjectImportResult summarizes an imported project configuration
+type ProjectImportResult struct {
+	Project   *Project `json:"project"`
+	Created   bool     `json:"created"`
+	Templates int      `json:"templates"`
+	Targets   int      `json:"targets"`
+	// FreezeWindows is the number of freeze windows imported
+	FreezeWindows int `json:"freeze_windows"`
+	// Gates is the number of gates imported
+	Gates int `json:"gates"`
+	// Escalations is the number of escalation policies imported
+	Escalations int `json:"escalations"`
+}
@@ -0,0 +1,324 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RepoConfigFileNames are the configuration files looked up at the root of a cloned repository, in order
+var RepoConfigFileNames = []string{"deployknot.yaml", "deployknot.yml"}
+
+// healthCheckPathPattern restricts health check paths to an absolute URL path with an optional query
+var healthCheckPathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/%&=?+-]{0,255}$`)
+
+// smokeHostPattern restricts the hosts TCP smoke tests connect to to host names and IP addresses
+var smokeHostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.:-]{0,252}$`)
+
+// maxSmokeTests bounds the number of smoke tests of a repository
+const maxSmokeTests = 50
+
+// Limits of the latency check of a repository
+const (
+	defaultLatencyCheckSeconds = 30
+	maxLatencyCheckSeconds     = 600
+)
+
+// RepoConfig is the application configuration a repository carries in its deployknot.yaml.
+// Parameters of the deployment request take precedence over it.
+type RepoConfig struct {
+	Port            int            `yaml:"port,omitempty" json:"port,omitempty"`
+	Dockerfile      string         `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
+	HealthCheckPath string         `yaml:"health_check_path,omitempty" json:"health_check_path,omitempty"`
+	Hooks           RepoHooks      `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+	Env             []RepoEnvEntry `yaml:"env,omitempty" json:"env,omitempty"`
+	SmokeTests      RepoSmokeTests `yaml:"smoke_tests,omitempty" json:"smoke_tests,omitempty"`
+	LatencyCheck    LatencyCheck   `yaml:"latency_check,omitempty" json:"latency_check,omitempty"`
+	SecretScan      RepoSecretScan `yaml:"secret_scan,omitempty" json:"secret_scan,omitempty"`
+}
+
+// LatencyCheck measures the latency of the health endpoint for a while after the smoke tests and
+// fails the deployment when its 95th percentile exceeds a threshold. It is off without a threshold.
+type LatencyCheck struct {
+	// Path defaults to the health check path
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// DurationSeconds is how long requests are sent, 30 seconds by default
+	DurationSeconds int `yaml:"duration_seconds,omitempty" json:"duration_seconds,omitempty"`
+	P95ThresholdMs  int `yaml:"p95_threshold_ms,omitempty" json:"p95_threshold_ms,omitempty"`
+	// Rollback restores the previously deployed image when the check fails
+	Rollback bool `yaml:"rollback,omitempty" json:"rollback,omitempty"`
+}
+
+// Enabled reports whether the latency check is configured
+func (l LatencyCheck) Enabled() bool {
+	return l.P95ThresholdMs > 0
+}
+
+// Duration returns how long the latency check sends requests
+func (l LatencyCheck) Duration() time.Duration {
+	if l.DurationSeconds == 0 {
+		return defaultLatencyCheckSeconds * time.Second
+	}
+	return time.Duration(l.DurationSeconds) * time.Second
+}
+
+// Threshold returns the highest acceptable 95th percentile latency
+func (l LatencyCheck) Threshold() time.Duration {
+	return time.Duration(l.P95ThresholdMs) * time.Millisecond
+}
+
+// validate returns the problems of the latency check; healthCheckPath is the path it defaults to
+func (l LatencyCheck) validate(healthCheckPath string) []string {
+	var problems []string
+	if l.P95ThresholdMs < 0 {
+		problems = append(problems, "latency_check.p95_threshold_ms must be positive")
+	}
+	if l.DurationSeconds < 0 || l.DurationSeconds > maxLatencyCheckSeconds {
+		problems = append(problems, fmt.Sprintf("latency_check.duration_seconds must be between 1 and %d", maxLatencyCheckSeconds))
+	}
+	if l.Path != "" && !healthCheckPathPattern.MatchString(l.Path) {
+		problems = append(problems, "latency_check.path must be a URL path starting with /")
+	}
+	if l.Enabled() && l.Path == "" && healthCheckPath == "" {
+		problems = append(problems, "latency_check.path is required without health_check_path")
+	}
+	if !l.Enabled() && (l.Path != "" || l.DurationSeconds != 0 || l.Rollback) {
+		problems = append(problems, "latency_check needs p95_threshold_ms")
+	}
+	return problems
+}
+
+// RepoSmokeTests are checks run against the application after its health check has passed
+type RepoSmokeTests struct {
+	// Rollback restores the previously deployed image when a smoke test fails
+	Rollback bool        `yaml:"rollback,omitempty" json:"rollback,omitempty"`
+	Checks   []SmokeTest `yaml:"checks,omitempty" json:"checks,omitempty"`
+}
+
+// SmokeTest is a single smoke test; exactly one of HTTP, TCP and Command is set
+type SmokeTest struct {
+	Name    string            `yaml:"name" json:"name"`
+	HTTP    *HTTPSmokeTest    `yaml:"http,omitempty" json:"http,omitempty"`
+	TCP     *TCPSmokeTest     `yaml:"tcp,omitempty" json:"tcp,omitempty"`
+	Command *CommandSmokeTest `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// HTTPSmokeTest requests a path of the application on the target
+type HTTPSmokeTest struct {
+	Path string `yaml:"path" json:"path"`
+	// Port defaults to the application's port
+	Port int `yaml:"port,omitempty" json:"port,omitempty"`
+	// Status is the expected status code, 200 by default
+	Status       int    `yaml:"status,omitempty" json:"status,omitempty"`
+	BodyContains string `yaml:"body_contains,omitempty" json:"body_contains,omitempty"`
+}
+
+// TCPSmokeTest connects to a port from the target
+type TCPSmokeTest struct {
+	// Host defaults to 127.0.0.1
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	Port int    `yaml:"port" json:"port"`
+}
+
+// CommandSmokeTest runs a command on the target from the repository root; it passes when the
+// command succeeds and its output contains OutputContains
+type CommandSmokeTest struct {
+	Run            string `yaml:"run" json:"run"`
+	OutputContains string `yaml:"output_contains,omitempty" json:"output_contains,omitempty"`
+}
+
+// Type returns the kind of the smoke test: "http", "tcp" or "command"
+func (t SmokeTest) Type() string {
+	switch {
+	case t.HTTP != nil:
+		return "http"
+	case t.TCP != nil:
+		return "tcp"
+	default:
+		return "command"
+	}
+}
+
+// ExpectedStatus returns the status code the HTTP smoke test expects
+func (t *HTTPSmokeTest) ExpectedStatus() int {
+	if t.Status == 0 {
+		return 200
+	}
+	return t.Status
+}
+
+// TargetHost returns the host the TCP smoke test connects to
+func (t *TCPSmokeTest) TargetHost() string {
+	if t.Host == "" {
+		return "127.0.0.1"
+	}
+	return t.Host
+}
+
+// validate returns the problems of the smoke tests
+func (s RepoSmokeTests) validate() []string {
+	var problems []string
+	if len(s.Checks) > maxSmokeTests {
+		problems = append(problems, fmt.Sprintf("smoke_tests.checks may hold at most %d checks", maxSmokeTests))
+	}
+	names := make(map[string]bool)
+	for i, check := range s.Checks {
+		field := fmt.Sprintf("smoke_tests.checks[%d]", i)
+		switch name := strings.TrimSpace(check.Name); {
+		case name == "" || len(name) > 100 || strings.ContainsAny(name, "\r\n"):
+			problems = append(problems, field+".name must be a single line of at most 100 characters")
+		case names[name]:
+			problems = append(problems, fmt.Sprintf("%s.name %q is duplicated", field, name))
+		default:
+			names[name] = true
+		}
+
+		kinds := 0
+		if check.HTTP != nil {
+			kinds++
+			if !healthCheckPathPattern.MatchString(check.HTTP.Path) {
+				problems = append(problems, field+".http.path must be a URL path starting with /")
+			}
+			if check.HTTP.Port < 0 || check.HTTP.Port > 65535 {
+				problems = append(problems, field+".http.port must be between 1 and 65535")
+			}
+			if check.HTTP.Status != 0 && (check.HTTP.Status < 100 || check.HTTP.Status > 599) {
+				problems = append(problems, field+".http.status must be an HTTP status code")
+			}
+		}
+		if check.TCP != nil {
+			kinds++
+			if check.TCP.Host != "" && !smokeHostPattern.MatchString(check.TCP.Host) {
+				problems = append(problems, field+".tcp.host must be a host name or IP address")
+			}
+			if check.TCP.Port < 1 || check.TCP.Port > 65535 {
+				problems = append(problems, field+".tcp.port must be between 1 and 65535")
+			}
+		}
+		if check.Command != nil {
+			kinds++
+			if strings.TrimSpace(check.Command.Run) == "" {
+				problems = append(problems, field+".command.run is empty")
+			}
+		}
+		if kinds != 1 {
+			problems = append(problems, field+" must have exactly one of http, tcp and command")
+		}
+	}
+	return problems
+}
+
+// RepoHooks are shell commands run on the target from the repository root
+type RepoHooks struct {
+	PreBuild   []string `yaml:"pre_build,omitempty" json:"pre_build,omitempty"`
+	PostDeploy []string `yaml:"post_deploy,omitempty" json:"post_deploy,omitempty"`
+}
+
+// RepoEnvEntry declares an environment variable the application expects
+type RepoEnvEntry struct {
+	Name        string  `yaml:"name" json:"name"`
+	Required    bool    `yaml:"required,omitempty" json:"required,omitempty"`
+	Default     *string `yaml:"default,omitempty" json:"default,omitempty"`
+	Description string  `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// Validate checks a repository configuration before any of it is used on the target
+func (c *RepoConfig) Validate() error {
+	var problems []string
+	if c.Port < 0 || c.Port > 65535 {
+		problems = append(problems, "port must be between 1 and 65535")
+	}
+	if c.Dockerfile != "" {
+		if err := validateRepoPath("dockerfile", c.Dockerfile); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.HealthCheckPath != "" && !healthCheckPathPattern.MatchString(c.HealthCheckPath) {
+		problems = append(problems, "health_check_path must be a URL path starting with /")
+	}
+	for i, hook := range c.Hooks.PreBuild {
+		if strings.TrimSpace(hook) == "" {
+			problems = append(problems, fmt.Sprintf("hooks.pre_build[%d] is empty", i))
+		}
+	}
+	for i, hook := range c.Hooks.PostDeploy {
+		if strings.TrimSpace(hook) == "" {
+			problems = append(problems, fmt.Sprintf("hooks.post_deploy[%d] is empty", i))
+		}
+	}
+
+	problems = append(problems, c.SmokeTests.validate()...)
+	problems = append(problems, c.LatencyCheck.validate(c.HealthCheckPath)...)
+	problems = append(problems, c.SecretScan.validate()...)
+
+	names := make(map[string]bool)
+	for i, env := range c.Env {
+		switch {
+		case ValidateEnvKey(env.Name) != nil:
+			problems = append(problems, fmt.Sprintf("env[%d].name %q is not a valid variable name", i, env.Name))
+		case names[env.Name]:
+			problems = append(problems, fmt.Sprintf("env[%d].name %q is duplicated", i, env.Name))
+		}
+		names[env.Name] = true
+		if env.Default != nil && strings.ContainsAny(*env.Default, "\r\n") {
+			problems = append(problems, fmt.Sprintf("env[%d].default must be a single line", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ApplyEnv merges the declared defaults into .env content; variables already set keep their value.
+// It returns the merged content and the required variables that are still missing.
+func (c *RepoConfig) ApplyEnv(content string) (string, []string) {
+	set := make(map[string]bool)
+	for _, env := range FromEnvFile(content) {
+		set[env.Key] = true
+	}
+
+	var defaults []string
+	var missing []string
+	for _, env := range c.Env {
+		if set[env.Name] {
+			continue
+		}
+		switch {
+		case env.Default != nil:
+			defaults = append(defaults, env.Name+"="+*env.Default)
+		case env.Required:
+			missing = append(missing, env.Name)
+		}
+	}
+
+	return AddEnvDefaults(content, defaults), missing
+}
+
+// AddEnvDefaults appends the KEY=VALUE defaults whose keys .env content does not set to it
+func AddEnvDefaults(content string, defaults []string) string {
+	set := make(map[string]bool)
+	for _, env := range FromEnvFile(content) {
+		set[env.Key] = true
+	}
+
+	var added []string
+	for _, line := range defaults {
+		key, _, _ := strings.Cut(line, "=")
+		if set[key] {
+			continue
+		}
+		set[key] = true
+		added = append(added, line)
+	}
+	if len(added) == 0 {
+		return content
+	}
+	merged := strings.TrimRight(content, "\n")
+	if merged != "" {
+		merged += "\n"
+	}
+	return merged + strings.Join(added, "\n")
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Limits of the extra docker run arguments of a deployment
+const (
+	maxExtraRunArgsLength = 1024
+	maxExtraRunArgs       = 32
+)
+
+var (
+	// runArgsPattern restricts the characters of extra docker run arguments before any parsing
+	runArgsPattern = regexp.MustCompile(`^[A-Za-z0-9 \t\n:=.,_-]*$`)
+	// extraHostPattern matches the host name of an --add-host entry
+	extraHostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]{0,252}$`)
+	// ulimitPattern matches an --ulimit value such as "nofile=1024:2048" or "memlock=-1"
+	ulimitPattern = regexp.MustCompile(`^([a-z]+)=(-1|[0-9]{1,19})(?::(-1|[0-9]{1,19}))?$`)
+	// byteSizePattern matches sizes such as "512m" or "2g"
+	byteSizePattern = regexp.MustCompile(`^([0-9]{1,15})([bkmgBKMG]?)$`)
+	// cpusPattern matches CPU counts such as "0.5" or "2"
+	cpusPattern = regexp.MustCompile(`^[0-9]{1,4}(\.[0-9]{1,3})?$`)
+	// restartPattern matches restart policies
+	restartPattern = regexp.MustCompile(`^(no|always|unless-stopped|on-failure(:[0-9]{1,4})?)$`)
+)
+
+// ulimitNames are the resource limits docker accepts for --ulimit
+var ulimitNames = map[string]bool{
+	"core": true, "cpu": true, "data": true, "fsize": true, "locks": true, "memlock": true,
+	"msgqueue": true, "nice": true, "nofile": true, "nproc": true, "rss": true, "rtprio": true,
+	"rttime": true, "sigpending": true, "stack": true,
+}
+
+// runFlag describes a docker run flag deployments may add; flags without a validator take no value
+type runFlag struct {
+	validate func(value string) error
+}
+
+// allowedRunFlags are the docker run flags deployments may add. Flags that weaken the isolation of
+// the container or conflict with the flags the worker sets, such as --privileged, --volume,
+// --network, --name or --publish, are deliberately missing.
+var allowedRunFlags = map[string]runFlag{
+	"--add-host":   {validate: validateExtraHost},
+	"--ulimit":     {validate: validateUlimit},
+	"--shm-size":   {validate: validateByteSize},
+	"--memory":     {validate: validateByteSize},
+	"--cpus":       {validate: validateCPUs},
+	"--pids-limit": {validate: validatePidsLimit},
+	"--restart":    {validate: validateRestart},
+	"--init":       {},
+	"--read-only":  {},
+}
+
+// RunArg is a docker run flag with its value, if it takes one
+type RunArg struct {
+	Flag  string
+	Value string
+}
+
+// String returns the argument in its --flag=value form
+func (a RunArg) String() string {
+	if a.Value == "" {
+		return a.Flag
+	}
+	return a.Flag + "=" + a.Value
+}
+
+// ParseExtraRunArgs parses whitespace-separated docker run arguments such as
+// "--add-host=db:10.0.0.5 --shm-size 1g --init". Only allowlisted flags with values of a strict
+// format are accepted, and there is no quoting: every argument becomes a single word.
+func ParseExtraRunArgs(raw string) ([]RunArg, error) {
+	if len(raw) > maxExtraRunArgsLength {
+		return nil, fmt.Errorf("extra_run_args must be at most %d characters", maxExtraRunArgsLength)
+	}
+	if !runArgsPattern.MatchString(raw) {
+		return nil, fmt.Errorf("extra_run_args may only contain letters, digits, whitespace and ':=.,_-'")
+	}
+
+	fields := strings.Fields(raw)
+	var args []RunArg
+	for i := 0; i < len(fields); i++ {
+		name, value, hasValue := strings.Cut(fields[i], "=")
+		flag, ok := allowedRunFlags[name]
+		if !ok {
+			return nil, fmt.Errorf("extra_run_args: %s is not an allowed docker run flag", name)
+		}
+
+		if flag.validate == nil {
+			if hasValue {
+				return nil, fmt.Errorf("extra_run_args: %s takes no value", name)
+			}
+			args = append(args, RunArg{Flag: name})
+			continue
+		}
+
+		if !hasValue {
+			if i+1 == len(fields) || strings.HasPrefix(fields[i+1], "--") {
+				return nil, fmt.Errorf("extra_run_args: %s needs a value", name)
+			}
+			i++
+			value = fields[i]
+		}
+		if err := flag.validate(value); err != nil {
+			return nil, fmt.Errorf("extra_run_args: invalid %s value %q: %w", name, value, err)
+		}
+		args = append(args, RunArg{Flag: name, Value: value})
+	}
+
+	if len(args) > maxExtraRunArgs {
+		return nil, fmt.Errorf("extra_run_args may hold at most %d arguments", maxExtraRunArgs)
+	}
+	return args, nil
+}
+
+// FormatRunArgs joins arguments into the normalized form ParseExtraRunArgs accepts
+func FormatRunArgs(args []RunArg) string {
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		formatted[i] = arg.String()
+	}
+	return strings.Join(formatted, " ")
+}
+
+// SplitExtraHost splits an --add-host value into its host name and address
+func SplitExtraHost(value string) (string, string) {
+	host, address, _ := strings.Cut(value, ":")
+	return host, address
+}
+
+// ParseUlimit parses an --ulimit value into its name and soft and hard limits; without a hard
+// limit the soft limit is used for both
+func ParseUlimit(value string) (string, int64, int64, error) {
+	match := ulimitPattern.FindStringSubmatch(value)
+	if match == nil || !ulimitNames[match[1]] {
+		return "", 0, 0, fmt.Errorf("must be name=soft[:hard] with a resource such as nofile or nproc")
+	}
+	soft, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	hard := soft
+	if match[3] != "" {
+		if hard, err = strconv.ParseInt(match[3], 10, 64); err != nil {
+			return "", 0, 0, err
+		}
+	}
+	if soft != -1 && hard != -1 && soft > hard {
+		return "", 0, 0, fmt.Errorf("soft limit is above the hard limit")
+	}
+	return match[1], soft, hard, nil
+}
+
+// ParseByteSize parses a size such as "512m" or "2g" with docker's binary units into bytes
+func ParseByteSize(value string) (int64, error) {
+	match := byteSizePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("must be a number with an optional unit of b, k, m or g")
+	}
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	shift := map[string]uint{"": 0, "b": 0, "k": 10, "m": 20, "g": 30}[strings.ToLower(match[2])]
+	if size <= 0 || size > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("must be positive and at most 8 exabytes")
+	}
+	return size << shift, nil
+}
+
+// ParseRestartPolicy splits a --restart value into the policy and its maximum retry count
+func ParseRestartPolicy(value string) (string, int) {
+	policy, retries, _ := strings.Cut(value, ":")
+	count, _ := strconv.Atoi(retries)
+	return policy, count
+}
+
+func validateExtraHost(value string) error {
+	host, address := SplitExtraHost(value)
+	if !extraHostPattern.MatchString(host) {
+		return fmt.Errorf("must be host:ip with a valid host name")
+	}
+	if address != "host-gateway" && net.ParseIP(address) == nil {
+		return fmt.Errorf("must be host:ip with an IP address or host-gateway")
+	}
+	return nil
+}
+
+func validateUlimit(value string) error {
+	_, _, _, err := ParseUlimit(value)
+	return err
+}
+
+func validateByteSize(value string) error {
+	_, err := ParseByteSize(value)
+	return err
+}
+
+func validateCPUs(value string) error {
+	if !cpusPattern.MatchString(value) {
+		return fmt.Errorf("must be a number of CPUs such as 0.5 or 2")
+	}
+	if cpus, _ := strconv.ParseFloat(value, 64); cpus <= 0 || cpus > 1024 {
+		return fmt.Errorf("must be a number of CPUs such as 0.5 or 2")
+	}
+	return nil
+}
+
+func validatePidsLimit(value string) error {
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || (limit < 1 && limit != -1) {
+		return fmt.Errorf("must be a positive number or -1")
+	}
+	return nil
+}
+
+func validateRestart(value string) error {
+	if !restartPattern.MatchString(value) {
+		return fmt.Errorf("must be no, always, unless-stopped or on-failure[:max-retries]")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeploymentSchedule redeploys the parameters of a source deployment on a cron schedule, such as a
+// nightly redeploy of main. Each run creates a new deployment that records the schedule.
+type DeploymentSchedule struct {
+	ID     uuid.UUID `json:"id" db:"id"`
+	UserID uuid.UUID `json:"user_id" db:"user_id"`
+	Name   string    `json:"name" db:"name"`
+	// Project is the project key of the source deployment: its project name, else its repository URL
+	Project            string    `json:"project" db:"project"`
+	SourceDeploymentID uuid.UUID `json:"source_deployment_id" db:"source_deployment_id"`
+	// GitHubBranch overrides the branch of the source deployment
+	GitHubBranch     *string    `json:"github_branch,omitempty" db:"github_branch"`
+	CronExpression   string     `json:"cron_expression" db:"cron_expression"`
+	Timezone         string     `json:"timezone" db:"timezone"`
+	Enabled          bool       `json:"enabled" db:"enabled"`
+	NextRunAt        *time.Time `json:"next_run_at,omitempty" db:"next_run_at"`
+	LastRunAt        *time.Time `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastDeploymentID *uuid.UUID `json:"last_deployment_id,omitempty" db:"last_deployment_id"`
+	// LastError is why the last run did not create a deployment
+	LastError *string   `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DeploymentScheduleRequest represents the request to create or replace a deployment schedule
+type DeploymentScheduleRequest struct {
+	Name               string    `json:"name" binding:"required,max=100"`
+	SourceDeploymentID uuid.UUID `json:"source_deployment_id" binding:"required"`
+	GitHubBranch       string    `json:"github_branch" binding:"max=255"`
+	CronExpression     string    `json:"cron_expression" binding:"required,max=100"`
+	// Timezone is an IANA time zone name the cron expression is evaluated in, UTC by default
+	Timezone string `json:"timezone" binding:"max=64"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// Validate checks the schedule request
+func (r *DeploymentScheduleRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name must not be empty")
+	}
+	if r.GitHubBranch != "" && strings.TrimSpace(r.GitHubBranch) != r.GitHubBranch {
+		return fmt.Errorf("github_branch must not start or end with whitespace")
+	}
+	cron, err := ParseCron(r.CronExpression)
+	if err != nil {
+		return err
+	}
+	location, err := time.LoadLocation(r.GetTimezone())
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", r.Timezone)
+	}
+	if cron.Next(time.Now().In(location)).IsZero() {
+		return fmt.Errorf("cron expression %q never runs", r.CronExpression)
+	}
+	return nil
+}
+
+// GetTimezone returns the time zone of the schedule, UTC by default
+func (r *DeploymentScheduleRequest) GetTimezone() string {
+	if r.Timezone == "" {
+		return "UTC"
+	}
+	return r.Timezone
+}
+
+// IsEnabled reports whether the schedule should run, true by default
+func (r *DeploymentScheduleRequest) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// NextRun returns the first run of the schedule after t, or nil when it never runs again
+func (s *DeploymentSchedule) NextRun(t time.Time) (*time.Time, error) {
+	cron, err := ParseCron(s.CronExpression)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	next := cron.Next(t.In(location))
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// secretScanExcludePattern restricts secret scan exclusions to relative paths and globs
+var secretScanExcludePattern = regexp.MustCompile(`^[A-Za-z0-9._/*?-]+$`)
+
+// maxSecretScanExcludes bounds the exclusions of a repository's secret scan
+const maxSecretScanExcludes = 100
+
+// SecretScanPolicy is what a deployment does about secrets committed to its repository
+type SecretScanPolicy string
+
+const (
+	// SecretScanOff skips the scan
+	SecretScanOff SecretScanPolicy = "off"
+	// SecretScanWarn logs the secrets found and goes on with the deployment
+	SecretScanWarn SecretScanPolicy = "warn"
+	// SecretScanFail fails the deployment before the image is built when a secret is found
+	SecretScanFail SecretScanPolicy = "fail"
+)
+
+// IsValid reports whether the policy is known; empty is not
+func (p SecretScanPolicy) IsValid() bool {
+	switch p {
+	case SecretScanOff, SecretScanWarn, SecretScanFail:
+		return true
+	}
+	return false
+}
+
+// Stricter returns the stricter of two policies; an empty policy counts as off
+func (p SecretScanPolicy) Stricter(other SecretScanPolicy) SecretScanPolicy {
+	rank := map[SecretScanPolicy]int{SecretScanWarn: 1, SecretScanFail: 2}
+	if rank[other] > rank[p] {
+		return other
+	}
+	if p == "" {
+		return SecretScanOff
+	}
+	return p
+}
+
+// RepoSecretScan configures the scan of the repository for committed secrets in deployknot.yaml.
+// A repository can make the worker's policy stricter, not weaker.
+type RepoSecretScan struct {
+	Policy SecretScanPolicy `yaml:"policy,omitempty" json:"policy,omitempty"`
+	// Exclude are paths relative to the application root, or globs, whose files are not scanned,
+	// such as test fixtures with fake keys. Entries without a slash match file names anywhere.
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+}
+
+// validate returns the problems of the secret scan configuration
+func (s RepoSecretScan) validate() []string {
+	var problems []string
+	if s.Policy != "" && !s.Policy.IsValid() {
+		problems = append(problems, fmt.Sprintf("secret_scan.policy must be %q, %q or %q", SecretScanOff, SecretScanWarn, SecretScanFail))
+	}
+	if len(s.Exclude) > maxSecretScanExcludes {
+		problems = append(problems, fmt.Sprintf("secret_scan.exclude may hold at most %d entries", maxSecretScanExcludes))
+	}
+	for i, entry := range s.Exclude {
+		cleaned := path.Clean(entry)
+		if !secretScanExcludePattern.MatchString(entry) || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			problems = append(problems, fmt.Sprintf("secret_scan.exclude[%d] must be a path or glob relative to the application root", i))
+			continue
+		}
+		if _, err := path.Match(cleaned, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("secret_scan.exclude[%d] is not a valid glob", i))
+		}
+	}
+	return problems
+}
+
+// Excludes reports whether a file, given relative to the application root, is left out of the scan
+func (s RepoSecretScan) Excludes(file string) bool {
+	file = path.Clean(file)
+	for _, entry := range s.Exclude {
+		entry = path.Clean(entry)
+		if !strings.Contains(entry, "/") {
+			if ok, _ := path.Match(entry, path.Base(file)); ok {
+				return true
+			}
+		}
+		if ok, _ := path.Match(entry, file); ok || strings.HasPrefix(file, entry+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a token issued to a user at sign-in
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	IssuedAt   time.Time  `json:"issued_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+// userAgentClients maps User-Agent fragments to client names, most specific first
+var userAgentClients = []struct{ fragment, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"python-requests", "Python"},
+	{"Go-http-client", "Go"},
+	{"PostmanRuntime", "Postman"},
+}
+
+// userAgentSystems maps User-Agent fragments to operating systems, most specific first
+var userAgentSystems = []struct{ fragment, name string }{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// DescribeDevice summarizes a User-Agent header, such as "Chrome on macOS"
+func DescribeDevice(userAgent string) string {
+	client, system := "", ""
+	for _, c := range userAgentClients {
+		if strings.Contains(userAgent, c.fragment) {
+			client = c.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.fragment) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case client != "" && system != "":
+		return client + " on " + system
+	case client != "":
+		return client
+	case system != "":
+		return system
+	case userAgent != "":
+		return "Unknown client"
+	}
+	return "Unknown"
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImageSignaturePolicy is whether the images of a project's deployments must be signed with cosign
+type ImageSignaturePolicy string
+
+const (
+	// ImageSignatureOff deploys images without verifying their signatures
+	ImageSignatureOff ImageSignaturePolicy = "off"
+	// ImageSignatureWarn verifies signatures and logs a warning for images failing the verification
+	ImageSignatureWarn ImageSignaturePolicy = "warn"
+	// ImageSignatureEnforce fails deployments of images failing the verification
+	ImageSignatureEnforce ImageSignaturePolicy = "enforce"
+)
+
+// IsValid reports whether the policy is known; empty is not
+func (p ImageSignaturePolicy) IsValid() bool {
+	switch p {
+	case ImageSignatureOff, ImageSignatureWarn, ImageSignatureEnforce:
+		return true
+	}
+	return false
+}
+
+// OrDefault returns the policy, or off when it is empty
+func (p ImageSignaturePolicy) OrDefault() ImageSignaturePolicy {
+	if p == "" {
+		return ImageSignatureOff
+	}
+	return p
+}
+
+// ProjectSigningKey is a cosign public key the images of a project's deployments are verified with
+type ProjectSigningKey struct {
+	ID        uuid.UUID `json:"id"`
+	ProjectID uuid.UUID `json:"project_id"`
+	Name      string    `json:"name"`
+	// PublicKey is the PEM encoded key, as written by cosign generate-key-pair to cosign.pub
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateProjectSigningKeyRequest adds a signing key to a project
+type CreateProjectSigningKeyRequest struct {
+	Name      string `json:"name" binding:"required,max=200"`
+	PublicKey string `json:"public_key" binding:"required"`
+}
+
+// SigningKeyFingerprint parses a PEM encoded public key and returns the hex encoded SHA-256 of its
+// DER encoding. Cosign keys are ECDSA P-256 keys, but RSA and Ed25519 keys are accepted as well.
+func SigningKeyFingerprint(publicKey string) (string, error) {
+	block, rest := pem.Decode([]byte(strings.TrimSpace(publicKey)))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return "", fmt.Errorf("public_key must be a PEM encoded PUBLIC KEY")
+	}
+	if len(strings.TrimSpace(string(rest))) > 0 {
+		return "", fmt.Errorf("public_key must hold a single key")
+	}
+	if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return "", fmt.Errorf("public_key is not a valid public key: %v", err)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// IdentityProviderSlack is the provider of the identities linking Slack accounts to users. Slack
+// identities authorize slash commands; they cannot be used to sign in.
+const IdentityProviderSlack = "slack"
+
+// Slack slash command response types
+const (
+	// SlackResponseEphemeral responses are only shown to the user who ran the command
+	SlackResponseEphemeral = "ephemeral"
+	// SlackResponseInChannel responses are shown to everyone in the channel
+	SlackResponseInChannel = "in_channel"
+)
+
+// SlackCommand is the payload Slack posts when a user runs a slash command
+type SlackCommand struct {
+	TeamID      string `form:"team_id" binding:"required"`
+	UserID      string `form:"user_id" binding:"required"`
+	UserName    string `form:"user_name"`
+	Command     string `form:"command"`
+	Text        string `form:"text"`
+	ResponseURL string `form:"response_url"`
+}
+
+// SlackSubject identifies the Slack user who ran the command across workspaces
+func (c *SlackCommand) SlackSubject() string {
+	return c.TeamID + ":" + c.UserID
+}
+
+// SlackResponse is the immediate reply to a slash command
+type SlackResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// SlackLinkCode is a one-time code that links the Slack account running it to a user
+type SlackLinkCode struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
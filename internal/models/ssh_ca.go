@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SSHCAKeyStatus is the part a key of the SSH certificate authority plays in a rotation
+type SSHCAKeyStatus string
+
+const (
+	// SSHCAKeyPending is trusted by the targets listing it but does not sign yet
+	SSHCAKeyPending SSHCAKeyStatus = "pending"
+	// SSHCAKeyActive signs the certificates of new SSH connections; there is at most one
+	SSHCAKeyActive SSHCAKeyStatus = "active"
+	// SSHCAKeyRetiring signed certificates before the active key and is still trusted until deleted
+	SSHCAKeyRetiring SSHCAKeyStatus = "retiring"
+)
+
+// SSHCAKey is a key of the SSH certificate authority DeployKnot signs short-lived certificates
+// for its SSH connections with. Targets trust it by listing its public key in TrustedUserCAKeys.
+type SSHCAKey struct {
+	ID   uuid.UUID `json:"id" db:"id"`
+	Name string    `json:"name" db:"name"`
+	// PublicKey is the key in authorized_keys format
+	PublicKey           string         `json:"public_key" db:"public_key"`
+	PrivateKeyEncrypted string         `json:"-" db:"private_key_encrypted"`
+	Fingerprint         string         `json:"fingerprint" db:"fingerprint"`
+	Status              SSHCAKeyStatus `json:"status" db:"status"`
+	CreatedBy           *string        `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt           time.Time      `json:"created_at" db:"created_at"`
+	ActivatedAt         *time.Time     `json:"activated_at,omitempty" db:"activated_at"`
+}
+
+// CreateSSHCAKeyRequest represents the request to generate a key of the SSH certificate authority
+type CreateSSHCAKeyRequest struct {
+	Name string `json:"name" binding:"required,max=200"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// StatusDayState summarizes the finished deployments of a project on one day of its status page
+type StatusDayState string
+
+const (
+	// StatusDayNone is a day without finished deployments
+	StatusDayNone StatusDayState = "none"
+	// StatusDayHealthy is a day on which every finished deployment completed
+	StatusDayHealthy StatusDayState = "healthy"
+	// StatusDayDegraded is a day on which some, but not all, finished deployments failed
+	StatusDayDegraded StatusDayState = "degraded"
+	// StatusDayFailing is a day on which every finished deployment failed
+	StatusDayFailing StatusDayState = "failing"
+)
+
+// ProjectStatusPage is the public status of a project: where each environment stands and how its
+// deployments went over the last days. It leaves out everything not meant for people without an
+// account, such as repositories, authors, targets and error messages.
+type ProjectStatusPage struct {
+	Project     string  `json:"project"`
+	Description *string `json:"description,omitempty"`
+	// Environments are the deployment names of the project, by name
+	Environments []*EnvironmentStatus `json:"environments"`
+	// History has one entry per day, oldest first, including days without deployments
+	History []*StatusDay `json:"history"`
+	// SuccessRate is the share of the finished deployments in History that completed
+	SuccessRate *float64  `json:"success_rate,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// EnvironmentStatus is the state of one environment of a project on its status page
+type EnvironmentStatus struct {
+	// Environment is the deployment name, empty for deployments without one
+	Environment string `json:"environment"`
+	// Status is the status of the latest deployment of the environment
+	Status       DeploymentStatus `json:"status"`
+	GitHubBranch string           `json:"github_branch"`
+	CommitSHA    *string          `json:"commit_sha,omitempty"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	// DeployedCommitSHA is the commit of the latest completed deployment, the version that is live
+	DeployedCommitSHA *string    `json:"deployed_commit_sha,omitempty"`
+	DeployedAt        *time.Time `json:"deployed_at,omitempty"`
+}
+
+// StatusDay counts the deployments of a project on one day of its status page
+type StatusDay struct {
+	Date        string         `json:"date"`
+	Deployments int            `json:"deployments"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	State       StatusDayState `json:"state"`
+}
+
+// NewStatusDay summarizes the deployments of a project on a day of its status page
+func NewStatusDay(date string, deployments, succeeded, failed int) *StatusDay {
+	day := &StatusDay{Date: date, Deployments: deployments, Succeeded: succeeded, Failed: failed}
+	switch {
+	case succeeded+failed == 0:
+		day.State = StatusDayNone
+	case failed == 0:
+		day.State = StatusDayHealthy
+	case succeeded == 0:
+		day.State = StatusDayFailing
+	default:
+		day.State = StatusDayDegraded
+	}
+	return day
+}
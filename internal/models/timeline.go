@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TimelineEventType is the kind of an event on a project's release timeline
+type TimelineEventType string
+
+const (
+	// TimelineEventDeployment is a deployment of the project, from its creation to its completion
+	TimelineEventDeployment TimelineEventType = "deployment"
+	// TimelineEventRollback is a step that restored the previous image of a deployment
+	TimelineEventRollback TimelineEventType = "rollback"
+	// TimelineEventIncident is a failed deployment, at the time it failed
+	TimelineEventIncident TimelineEventType = "incident"
+	// TimelineEventFreezeWindow is a change freeze of the project
+	TimelineEventFreezeWindow TimelineEventType = "freeze_window"
+)
+
+// TimelineEvent is one entry of a project's release timeline. Events with a duration, such as
+// deployments and freeze windows, also have an end.
+type TimelineEvent struct {
+	Type           TimelineEventType `json:"type"`
+	At             time.Time         `json:"at"`
+	EndsAt         *time.Time        `json:"ends_at,omitempty"`
+	DeploymentID   *uuid.UUID        `json:"deployment_id,omitempty"`
+	DeploymentName *string           `json:"deployment_name,omitempty"`
+	Status         *DeploymentStatus `json:"status,omitempty"`
+	GitHubBranch   string            `json:"github_branch,omitempty"`
+	CreatedBy      *string           `json:"created_by,omitempty"`
+	// Step is the step that rolled back
+	Step string `json:"step,omitempty"`
+	// Message is the error of an incident or rollback, or the reason of a freeze window
+	Message string `json:"message,omitempty"`
+}
+
+// ProjectTimeline lists the events of a project between Since and Until, oldest first
+type ProjectTimeline struct {
+	Project   string           `json:"project"`
+	ProjectID *uuid.UUID       `json:"project_id,omitempty"`
+	Since     time.Time        `json:"since"`
+	Until     time.Time        `json:"until"`
+	Events    []*TimelineEvent `json:"events"`
+	// Truncated is set when the period has more deployments than the timeline holds
+	Truncated bool `json:"truncated"`
+}
@@ -6,12 +6,21 @@ import (
 	"github.com/google/uuid"
 )
 
+// Role represents the permissions level of a user
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
 // User represents a user in the system
 type User struct {
 	ID           uuid.UUID `json:"id" db:"id"`
 	Username     string    `json:"username" db:"username"`
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         Role      `json:"role" db:"role"`
 	IsActive     bool      `json:"is_active" db:"is_active"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
@@ -42,6 +51,7 @@ type UserInfo struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
 	IsActive  bool      `json:"is_active"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -51,6 +61,29 @@ type UserResponse struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
+	Role      Role      `json:"role"`
 	IsActive  bool      `json:"is_active"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// UserFilter narrows a user listing; nil fields are not filtered on. Usernames and emails match case-insensitively.
+type UserFilter struct {
+	Username *string
+	Email    *string
+	Active   *bool
+}
+
+// CreateUserRequest represents an administrator's request to create a user. Without a password
+// the user can only sign in through OAuth or OIDC.
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=100"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"omitempty,min=6"`
+	Role     Role   `json:"role"`
+}
+
+// UpdateUserRequest represents an administrator's request to activate, deactivate or change the role of a user
+type UpdateUserRequest struct {
+	IsActive *bool `json:"is_active"`
+	Role     *Role `json:"role"`
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Deployment parameters end up in commands executed on target hosts, so every value
+// that is not shell-escaped by construction is restricted to a strict whitelist.
+var (
+	// containerNamePattern mirrors Docker's container name rules
+	containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,127}$`)
+	// gitBranchPattern restricts branch names to a safe subset of git ref names
+	gitBranchPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,254}$`)
+	// commitSHAPattern matches a full, lowercase SHA-1 commit ID
+	commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// repoSlugPattern matches a GitHub "owner/repo" slug
+	repoSlugPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,38}/[A-Za-z0-9._-]{1,100}$`)
+	// githubPATPattern matches classic and fine-grained GitHub tokens
+	githubPATPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,255}$`)
+	// envKeyPattern matches portable environment variable names
+	envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// workerPoolPattern matches worker pool names such as "eu-west" or "gpu-builders"
+	workerPoolPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+	// gpuDevicePattern matches GPU indexes such as "0" and UUIDs such as "GPU-8f3c..." or "MIG-..."
+	gpuDevicePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,63}$`)
+	// gateNamePattern matches gate names such as "tests-passed" or "security.scan"
+	gateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,99}$`)
+	// channelNamePattern matches notification channel and incident service names such as "ops" or
+	// "pager-primary"
+	channelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+)
+
+// DefaultWorkerPool names the pool of workers started without WORKER_POOL; it is stored as no pool
+const DefaultWorkerPool = "default"
+
+// NormalizeRepoURL converts various GitHub URL formats to "owner/repo"
+func NormalizeRepoURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err == nil && u.Host != "" {
+		raw = strings.TrimPrefix(u.Path, "/")
+	}
+	raw = strings.TrimPrefix(raw, "/")
+	raw = strings.TrimSuffix(raw, ".git")
+	return raw
+}
+
+// ValidateRepoURL validates that a repository URL resolves to a GitHub "owner/repo" slug
+func ValidateRepoURL(repoURL string) error {
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+		if u.Scheme != "https" || !strings.EqualFold(u.Host, "github.com") {
+			return fmt.Errorf("github_repo_url must be an https://github.com repository URL")
+		}
+	}
+	slug := NormalizeRepoURL(repoURL)
+	if !repoSlugPattern.MatchString(slug) || strings.HasSuffix(slug, "/.") || strings.HasSuffix(slug, "/..") {
+		return fmt.Errorf("github_repo_url must be in the form owner/repo")
+	}
+	return nil
+}
+
+// ValidateGitHubPAT validates the character set of a GitHub personal access token
+func ValidateGitHubPAT(pat string) error {
+	if !githubPATPattern.MatchString(pat) {
+		return fmt.Errorf("github_pat contains invalid characters")
+	}
+	return nil
+}
+
+// ValidateGitBranch validates a branch name against a safe subset of git's ref name rules
+func ValidateGitBranch(branch string) error {
+	if !gitBranchPattern.MatchString(branch) {
+		return fmt.Errorf("github_branch contains invalid characters")
+	}
+	if strings.Contains(branch, "..") || strings.Contains(branch, "//") ||
+		strings.HasSuffix(branch, "/") || strings.HasSuffix(branch, ".") ||
+		strings.HasSuffix(branch, ".lock") || strings.Contains(branch, "/.") {
+		return fmt.Errorf("github_branch is not a valid branch name")
+	}
+	return nil
+}
+
+// ValidateCommitSHA validates a full commit SHA
+func ValidateCommitSHA(sha string) error {
+	if !commitSHAPattern.MatchString(sha) {
+		return fmt.Errorf("commit_sha must be a full 40-character lowercase commit SHA")
+	}
+	return nil
+}
+
+// ValidateContainerName validates a Docker container name
+func ValidateContainerName(name string) error {
+	if !containerNamePattern.MatchString(name) {
+		return fmt.Errorf("container_name must start with a letter or digit and contain only letters, digits, '_', '.' and '-'")
+	}
+	return nil
+}
+
+// ValidateEnvKey validates an environment variable name
+func ValidateEnvKey(key string) error {
+	if !envKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid environment variable name: %q", key)
+	}
+	return nil
+}
+
+// EnvFileDir is the directory, relative to the working directory of the server, uploaded env files
+// are stored in until their deployment's worker reads them
+const EnvFileDir = "temp_env_files"
+
+// ValidateEnvContent validates every variable name of .env file content
+func ValidateEnvContent(content string) error {
+	for _, env := range FromEnvFile(content) {
+		if err := ValidateEnvKey(env.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateWorkerPool validates the name of a worker pool
+func ValidateWorkerPool(pool string) error {
+	if pool == DefaultWorkerPool {
+		return fmt.Errorf("worker pool %q is reserved; leave it empty to use the default pool", pool)
+	}
+	if !workerPoolPattern.MatchString(pool) {
+		return fmt.Errorf("worker pool %q must start with a lowercase letter or digit and contain only lowercase letters, digits, '_', '.' and '-'", pool)
+	}
+	return nil
+}
+
+// ValidateGateName validates the name of a deployment gate, which is part of the URL it is reported to
+func ValidateGateName(name string) error {
+	if !gateNamePattern.MatchString(name) {
+		return fmt.Errorf("gate name %q must start with a letter or digit and contain only letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// ValidateChannelName validates the name of a notification channel
+func ValidateChannelName(name string) error {
+	if !channelNamePattern.MatchString(name) {
+		return fmt.Errorf("channel name %q must start with a lowercase letter or digit and contain only lowercase letters, digits, '_' and '-'", name)
+	}
+	return nil
+}
+
+// AllGPUs requests every GPU of the target for a container
+const AllGPUs = "all"
+
+// ValidateGPUs validates the GPUs requested for a container: "all" or a comma-separated list of
+// device indexes or UUIDs
+func ValidateGPUs(gpus string) error {
+	if gpus == AllGPUs {
+		return nil
+	}
+	if len(gpus) > 255 {
+		return fmt.Errorf("gpus must be at most 255 characters")
+	}
+	for _, device := range strings.Split(gpus, ",") {
+		if !gpuDevicePattern.MatchString(device) {
+			return fmt.Errorf("gpus must be %q or a comma-separated list of GPU indexes or UUIDs, got device %q", AllGPUs, device)
+		}
+	}
+	return nil
+}
+
+// GPUDevices returns the devices of a GPU request, or nil when it requests all GPUs
+func GPUDevices(gpus string) []string {
+	if gpus == "" || gpus == AllGPUs {
+		return nil
+	}
+	return strings.Split(gpus, ",")
+}
+
+// ParseCIDRs parses CIDR blocks such as "10.0.0.0/8"; a bare IP address is a network of that address alone
+func ParseCIDRs(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR block: %q", entry)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR block: %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
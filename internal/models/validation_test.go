@@ -0,0 +1,161 @@
+package models
+
+import "testing"
+
+// hostileInputs try to break out of the shell words the validated values end up in
+var hostileInputs = []string{
+	"main; rm -rf /",
+	"main && id",
+	"main | id",
+	"$(id)",
+	"main$(id)",
+	"`id`",
+	"main`id`",
+	"main\nid",
+	"main\r\nid",
+	"main'id",
+	`main"id`,
+	"main id",
+	"main>out",
+	"-main",
+	"--upload-pack=id",
+	"",
+}
+
+func TestValidateGitBranch(t *testing.T) {
+	for _, branch := range []string{"main", "release/1.2", "feature/new_ui", "v1.0.0-rc.1", "1-hotfix"} {
+		if err := ValidateGitBranch(branch); err != nil {
+			t.Errorf("ValidateGitBranch(%q) = %v, want nil", branch, err)
+		}
+	}
+	rejected := append([]string{
+		"main..other",
+		"../../etc/passwd",
+		"release//1",
+		"release/",
+		"main.",
+		"main.lock",
+		"release/.hidden",
+	}, hostileInputs...)
+	for _, branch := range rejected {
+		if err := ValidateGitBranch(branch); err == nil {
+			t.Errorf("ValidateGitBranch(%q) = nil, want an error", branch)
+		}
+	}
+}
+
+func TestValidateContainerName(t *testing.T) {
+	for _, name := range []string{"app", "my-app", "my_app.v2", "1app"} {
+		if err := ValidateContainerName(name); err != nil {
+			t.Errorf("ValidateContainerName(%q) = %v, want nil", name, err)
+		}
+	}
+	rejected := append([]string{".app", "_app", "app/other", "../app"}, hostileInputs...)
+	for _, name := range rejected {
+		if err := ValidateContainerName(name); err == nil {
+			t.Errorf("ValidateContainerName(%q) = nil, want an error", name)
+		}
+	}
+}
+
+func TestValidateRepoURL(t *testing.T) {
+	for _, repoURL := range []string{
+		"https://github.com/owner/repo",
+		"https://github.com/owner/repo.git",
+		"owner/repo",
+		"owner/my.repo_2",
+	} {
+		if err := ValidateRepoURL(repoURL); err != nil {
+			t.Errorf("ValidateRepoURL(%q) = %v, want nil", repoURL, err)
+		}
+	}
+	for _, repoURL := range []string{
+		"http://github.com/owner/repo",
+		"https://evil.example/owner/repo",
+		"https://github.com/owner/repo;id",
+		"https://github.com/owner/$(id)",
+		"https://github.com/owner/`id`",
+		"https://github.com/owner/repo\nid",
+		"owner/repo/../../other",
+		"../owner/repo",
+		"-owner/repo",
+		"owner/..",
+		"owner/.",
+		"owner",
+		"owner/repo extra",
+		"owner/repo'id",
+		"",
+	} {
+		if err := ValidateRepoURL(repoURL); err == nil {
+			t.Errorf("ValidateRepoURL(%q) = nil, want an error", repoURL)
+		}
+	}
+}
+
+func TestValidateEnvKey(t *testing.T) {
+	for _, key := range []string{"PORT", "_SECRET", "db_url2"} {
+		if err := ValidateEnvKey(key); err != nil {
+			t.Errorf("ValidateEnvKey(%q) = %v, want nil", key, err)
+		}
+	}
+	rejected := append([]string{"1KEY", "KEY-NAME", "KEY.NAME", "KEY=VALUE", "KEY.lock", "..", "-KEY"}, hostileInputs...)
+	for _, key := range rejected {
+		if err := ValidateEnvKey(key); err == nil {
+			t.Errorf("ValidateEnvKey(%q) = nil, want an error", key)
+		}
+	}
+}
+
+func TestValidateKubeconfig(t *testing.T) {
+	const valid = `apiVersion: v1
+kind: Config
+clusters:
+  - name: prod
+    cluster:
+      server: https://203.0.113.10:6443
+      certificate-authority-data: LS0tLS1CRUdJTg==
+contexts:
+  - name: prod
+    context:
+      cluster: prod
+      user: deployer
+      namespace: apps
+current-context: prod
+preferences: {}
+users:
+  - name: deployer
+    user:
+      token: secret-token
+`
+	if err := ValidateKubeconfig(valid); err != nil {
+		t.Fatalf("ValidateKubeconfig(valid) = %v", err)
+	}
+	if err := ValidateKubeconfig(`{"apiVersion": "v1", "users": [{"name": "ci", "user": {"client-certificate-data": "Y2VydA==", "client-key-data": "a2V5"}}]}`); err != nil {
+		t.Errorf("ValidateKubeconfig(JSON with client certificate data) = %v", err)
+	}
+
+	for name, kubeconfig := range map[string]string{
+		"empty":                 "  \n",
+		"not yaml":              "users: [",
+		"not a mapping":         "- just a list",
+		"exec plugin":           "users:\n  - name: x\n    user:\n      exec:\n        command: sh\n        args: [-c, id]\n",
+		"auth provider":         "users:\n  - name: x\n    user:\n      auth-provider:\n        name: gcp\n        config: {cmd-path: /bin/sh}\n",
+		"token file":            "users:\n  - name: x\n    user:\n      tokenFile: /proc/self/environ\n",
+		"client key file":       "users:\n  - name: x\n    user:\n      client-key: /etc/shadow\n",
+		"client certificate":    "users:\n  - name: x\n    user:\n      client-certificate: /etc/passwd\n",
+		"certificate authority": "clusters:\n  - name: x\n    cluster:\n      server: https://k8s\n      certificate-authority: /etc/passwd\n",
+		"username and password": "users:\n  - name: x\n    user:\n      username: admin\n      password: admin\n",
+		"proxy":                 "clusters:\n  - name: x\n    cluster:\n      server: https://k8s\n      proxy-url: socks5://127.0.0.1:1080\n",
+		"impersonation":         "users:\n  - name: x\n    user:\n      token: t\n      as: system:admin\n",
+		"case variant":          "users:\n  - name: x\n    user:\n      Exec:\n        command: sh\n",
+		"extensions":            "extensions:\n  - name: x\n    extension: {}\n",
+		"preferences":           "preferences:\n  extensions: [{name: x}]\n",
+		"users not a list":      "users:\n  user:\n    token: t\n",
+		"token as mapping":      "users:\n  - name: x\n    user:\n      token: {command: sh}\n",
+		"merged exec":           "base: &base\n  exec: {command: sh}\nusers:\n  - name: x\n    user:\n      <<: *base\n",
+	} {
+		if err := ValidateKubeconfig(kubeconfig); err == nil {
+			t.Errorf("ValidateKubeconfig(%s) accepted it", name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SavedView is a named set of deployment filters a user saved, such as "my failing prod deploys"
+type SavedView struct {
+	ID        uuid.UUID        `json:"id" db:"id"`
+	UserID    uuid.UUID        `json:"user_id" db:"user_id"`
+	Name      string           `json:"name" db:"name"`
+	Filters   SavedViewFilters `json:"filters" db:"filters"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// SavedViewFilters are the filters of a saved view; empty fields are not filtered on.
+// Since and Until are fixed RFC 3339 timestamps or YYYY-MM-DD dates, Within is a window
+// relative to the time the view is opened, such as "24h" or "7d".
+type SavedViewFilters struct {
+	Status         DeploymentStatus `json:"status,omitempty"`
+	Project        string           `json:"project,omitempty"`
+	DeploymentName string           `json:"deployment_name,omitempty"`
+	Target         string           `json:"target,omitempty"`
+	TargetType     TargetType       `json:"target_type,omitempty"`
+	Since          string           `json:"since,omitempty"`
+	Until          string           `json:"until,omitempty"`
+	Within         string           `json:"within,omitempty"`
+}
+
+// SavedViewRequest represents the request to create or replace a saved view
+type SavedViewRequest struct {
+	Name    string           `json:"name" binding:"required,max=100"`
+	Filters SavedViewFilters `json:"filters"`
+}
+
+// Validate checks that the filters can be applied
+func (f *SavedViewFilters) Validate() error {
+	switch f.Status {
+	case "", DeploymentStatusPending, DeploymentStatusRunning, DeploymentStatusCompleted,
+		DeploymentStatusFailed, DeploymentStatusCancelled, DeploymentStatusAborted:
+	default:
+		return fmt.Errorf("invalid status: %s", f.Status)
+	}
+	switch f.TargetType {
+	case "", TargetTypeSSH, TargetTypeKubernetes:
+	default:
+		return fmt.Errorf("invalid target_type: %s", f.TargetType)
+	}
+	if _, err := parseViewTime(f.Since); err != nil {
+		return fmt.Errorf("invalid since: %w", err)
+	}
+	if _, err := parseViewTime(f.Until); err != nil {
+		return fmt.Errorf("invalid until: %w", err)
+	}
+	if _, err := parseViewWindow(f.Within); err != nil {
+		return fmt.Errorf("invalid within: %w", err)
+	}
+	if f.Within != "" && f.Since != "" {
+		return fmt.Errorf("since and within cannot be combined")
+	}
+	return nil
+}
+
+// DeploymentFilter turns the filters into a deployment filter for userID's deployments, resolving
+// the relative window against now
+func (f *SavedViewFilters) DeploymentFilter(userID uuid.UUID, now time.Time) (DeploymentFilter, error) {
+	if err := f.Validate(); err != nil {
+		return DeploymentFilter{}, err
+	}
+
+	filter := DeploymentFilter{UserID: &userID}
+	if f.Status != "" {
+		status := f.Status
+		filter.Status = &status
+	}
+	if f.Project != "" {
+		project := f.Project
+		filter.ProjectName = &project
+	}
+	if f.DeploymentName != "" {
+		name := f.DeploymentName
+		filter.DeploymentName = &name
+	}
+	if f.Target != "" {
+		target := f.Target
+		filter.TargetIP = &target
+	}
+	if f.TargetType != "" {
+		targetType := f.TargetType
+		filter.TargetType = &targetType
+	}
+	filter.CreatedAfter, _ = parseViewTime(f.Since)
+	filter.CreatedBefore, _ = parseViewTime(f.Until)
+	if window, _ := parseViewWindow(f.Within); window > 0 {
+		after := now.Add(-window)
+		filter.CreatedAfter = &after
+	}
+	return filter, nil
+}
+
+// parseViewTime parses an optional RFC 3339 timestamp or YYYY-MM-DD date
+func parseViewTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not an RFC 3339 timestamp or a YYYY-MM-DD date", value)
+}
+
+// parseViewWindow parses an optional Go duration, additionally accepting a number of days such as "7d"
+func parseViewWindow(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	var window time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration such as 24h or 7d", value)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration such as 24h or 7d", value)
+		}
+		window = d
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("%q must be positive", value)
+	}
+	return window, nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VolumeBackupStatus is the status of a backup, or of its latest restore
+type VolumeBackupStatus string
+
+const (
+	VolumeBackupStatusPending   VolumeBackupStatus = "pending"
+	VolumeBackupStatusRunning   VolumeBackupStatus = "running"
+	VolumeBackupStatusCompleted VolumeBackupStatus = "completed"
+	VolumeBackupStatusFailed    VolumeBackupStatus = "failed"
+)
+
+// What started a backup
+const (
+	VolumeBackupTriggerScheduled = "scheduled"
+	VolumeBackupTriggerManual    = "manual"
+)
+
+// ManagedBackup describes how the data of a managed service is backed up and restored
+type ManagedBackup struct {
+	// Method names the format of the backup: pg_dump, mysqldump or tar
+	Method string
+	// Extension is the file extension of the stored backup
+	Extension string
+	// Dump is a shell command run in the container of the service that writes the backup to stdout
+	Dump string
+	// Load is a shell command that restores the backup it reads from stdin
+	Load string
+	// Compress gzips the output of Dump before it is stored, and unpacks the backup again before
+	// it is loaded
+	Compress bool
+	// Offline backups are loaded with the service stopped, in a container of its image that mounts
+	// its volume, instead of in the running container
+	Offline bool
+}
+
+// ManagedBackupFor returns how the data of an engine is backed up
+func ManagedBackupFor(engine ManagedEngine) (*ManagedBackup, error) {
+	spec, ok := managedEngines[engine]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q", engine)
+	}
+	backup := spec.backup
+	return &backup, nil
+}
+
+// VolumeBackup is a backup of the data of a managed service, stored as an object in S3-compatible
+// storage
+type VolumeBackup struct {
+	ID               uuid.UUID          `json:"id" db:"id"`
+	ManagedServiceID uuid.UUID          `json:"managed_service_id" db:"managed_service_id"`
+	Method           string             `json:"method" db:"method"`
+	Trigger          string             `json:"trigger" db:"trigger_type"`
+	Status           VolumeBackupStatus `json:"status" db:"status"`
+	// ObjectKey is the key of the object in the backup bucket
+	ObjectKey    string     `json:"object_key" db:"object_key"`
+	SizeBytes    int64      `json:"size_bytes" db:"size_bytes"`
+	SHA256       *string    `json:"sha256,omitempty" db:"sha256"`
+	ErrorMessage *string    `json:"error_message,omitempty" db:"error_message"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	// RestoreStatus, RestoreError and RestoredAt describe the latest restore of the backup
+	RestoreStatus *VolumeBackupStatus `json:"restore_status,omitempty" db:"restore_status"`
+	RestoreError  *string             `json:"restore_error,omitempty" db:"restore_error"`
+	RestoredAt    *time.Time          `json:"restored_at,omitempty" db:"restored_at"`
+}
+
+// IsActive reports whether the backup, or a restore of it, is still running
+func (b *VolumeBackup) IsActive() bool {
+	return b.Status == VolumeBackupStatusPending || b.Status == VolumeBackupStatusRunning ||
+		(b.RestoreStatus != nil && *b.RestoreStatus == VolumeBackupStatusRunning)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkerCapabilities is what a worker advertises about the jobs it can run when it registers
+type WorkerCapabilities struct {
+	// DockerBuild is whether the worker runs Docker deployments to SSH targets, which build images
+	DockerBuild bool `json:"docker_build"`
+	// MaxConcurrentJobs is how many deployments the worker processes at once
+	MaxConcurrentJobs int `json:"max_concurrent_jobs"`
+	// Networks are the IP addresses and CIDR blocks of the SSH targets the worker can reach; empty
+	// for any target
+	Networks []string `json:"networks,omitempty"`
+}
+
+// CanRun returns why the worker cannot run a deployment of the given type to the given target, or
+// nil when it can
+func (c WorkerCapabilities) CanRun(deploymentType DeploymentType, targetType TargetType, targetIP string) error {
+	if targetType == TargetTypeKubernetes {
+		return nil
+	}
+	if (deploymentType == "" || deploymentType == DeploymentTypeDocker || deploymentType == DeploymentTypeCron) && !c.DockerBuild {
+		return fmt.Errorf("the worker does not build Docker images")
+	}
+	if len(c.Networks) == 0 {
+		return nil
+	}
+
+	networks, err := ParseCIDRs(c.Networks)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(targetIP); ip != nil {
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the worker cannot reach %s, only %s", targetIP, strings.Join(c.Networks, ", "))
+}
+
+// WorkerInfo is a live worker as listed by the workers API
+type WorkerInfo struct {
+	ID           string             `json:"id"`
+	Pool         string             `json:"pool"`
+	Capabilities WorkerCapabilities `json:"capabilities"`
+	// Deployments are the deployments the worker is processing
+	Deployments   []uuid.UUID `json:"deployments"`
+	LastHeartbeat time.Time   `json:"last_heartbeat"`
+}
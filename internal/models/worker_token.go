@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkerTokenPrefix starts every worker token, so leaked tokens are easy to recognize
+const WorkerTokenPrefix = "dkw_"
+
+// WorkerToken authenticates one worker to the worker API. Only a hash of the token is stored; the
+// token itself is shown once, when it is created. Revoked tokens are kept as the revocation list
+// of decommissioned workers.
+type WorkerToken struct {
+	ID uuid.UUID `json:"id" db:"id"`
+	// WorkerID is the worker the token belongs to; requests authenticated with the token must
+	// use it as their worker_id
+	WorkerID string `json:"worker_id" db:"worker_id"`
+	// Prefix is the start of the token, to tell tokens apart
+	Prefix     string     `json:"prefix" db:"token_prefix"`
+	CreatedBy  *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedBy  *string    `json:"revoked_by,omitempty" db:"revoked_by"`
+}
+
+// CreateWorkerTokenRequest represents the request to create a worker token
+type CreateWorkerTokenRequest struct {
+	WorkerID string `json:"worker_id" binding:"required,max=100"`
+}
+
+// CreatedWorkerToken is a newly created worker token together with the token itself
+type CreatedWorkerToken struct {
+	WorkerToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrAPIKeyExists is returned when the user already has an API key with the same name
+	ErrAPIKeyExists = errors.New("an API key with this name already exists")
+	// ErrAPIKeyNotFound is returned when an API key does not exist or belongs to another user
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// apiKeyPrefixLength is the number of characters of a key kept to tell keys apart
+const apiKeyPrefixLength = 12
+
+// APIKeyService manages the API keys CI pipelines authenticate with
+type APIKeyService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(repo *database.Repository, logger *logrus.Logger) *APIKeyService {
+	return &APIKeyService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateAPIKey creates an API key for userID. The key is only returned here; DeployKnot keeps a hash.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, userID uuid.UUID, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	existing, err := s.repo.GetAPIKeyByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrAPIKeyExists
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	created := &models.CreatedAPIKey{
+		APIKey: models.APIKey{
+			ID:        uuid.New(),
+			UserID:    userID,
+			Name:      name,
+			Prefix:    key[:apiKeyPrefixLength],
+			CreatedAt: now,
+		},
+		Key: key,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		created.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateAPIKey(&created.APIKey, hashAPIKey(key)); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"api_key_id": created.ID,
+		"user_id":    userID,
+		"name":       name,
+	}).Info("API key created")
+	return created, nil
+}
+
+// ListAPIKeys returns userID's API keys, without the keys themselves
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	return s.repo.ListAPIKeys(userID)
+}
+
+// DeleteAPIKey revokes one of userID's API keys
+func (s *APIKeyService) DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	found, err := s.repo.DeleteAPIKey(id, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"api_key_id": id,
+		"user_id":    userID,
+	}).Info("API key revoked")
+	return nil
+}
+
+// Authenticate returns the active user an API key belongs to, or nil when the key is unknown or
+// has expired
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*models.User, error) {
+	if !strings.HasPrefix(key, models.APIKeyPrefix) {
+		return nil, nil
+	}
+	apiKey, err := s.repo.GetAPIKeyByHash(hashAPIKey(key))
+	if err != nil || apiKey == nil || apiKey.Expired(time.Now()) {
+		return nil, err
+	}
+	user, err := s.repo.GetUserByID(apiKey.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil
+	}
+
+	if err := s.repo.TouchAPIKey(apiKey.ID); err != nil {
+		s.logger.WithError(err).Warn("Failed to record API key use")
+	}
+	return user, nil
+}
+
+// hashAPIKey returns the hash an API key is stored as. Keys are random, so a fast hash is enough.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,559 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidApplication is returned when an application request is invalid
+	ErrInvalidApplication = errors.New("invalid application")
+	// ErrApplicationExists is returned when the user already has an application with the same name
+	ErrApplicationExists = errors.New("an application with this name already exists")
+	// ErrApplicationNotFound is returned when an application does not exist or the user may not see it
+	ErrApplicationNotFound = errors.New("application not found")
+	// ErrInvalidRelease is returned when an application release request is invalid
+	ErrInvalidRelease = errors.New("invalid application release")
+	// ErrReleaseNotFound is returned when an application has no release with the given ID
+	ErrReleaseNotFound = errors.New("application release not found")
+)
+
+const (
+	// releaseBatchSize bounds the number of waiting releases handled per sweep
+	releaseBatchSize = 50
+	// releaseListLimit bounds the number of releases listed per application
+	releaseListLimit = 50
+)
+
+// ApplicationService manages applications and releases them: every service becomes a deployment
+// that waits for the deployments of the services it depends on, or of the service before it, to
+// complete
+type ApplicationService struct {
+	repo        *database.Repository
+	deployments *DeploymentService
+	gates       *GateService
+	config      config.ApplicationConfig
+	logger      *logrus.Logger
+}
+
+// NewApplicationService creates a new application service
+func NewApplicationService(repo *database.Repository, deployments *DeploymentService, gates *GateService, cfg config.ApplicationConfig, logger *logrus.Logger) *ApplicationService {
+	return &ApplicationService{
+		repo:        repo,
+		deployments: deployments,
+		gates:       gates,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// CreateApplication creates an application owned by userID
+func (s *ApplicationService) CreateApplication(ctx context.Context, userID uuid.UUID, req *models.ApplicationRequest) (*models.Application, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidApplication, err)
+	}
+	existing, err := s.repo.GetApplicationByName(userID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrApplicationExists
+	}
+
+	now := time.Now()
+	application := &models.Application{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        req.Name,
+		Description: optionalString(strings.TrimSpace(req.Description)),
+		Services:    req.Services,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.CreateApplication(application); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"application_id": application.ID,
+		"user_id":        userID,
+		"services":       len(application.Services),
+	}).Info("Application created")
+
+	return application, nil
+}
+
+// ListApplications returns the applications userID may see; administrators see every application
+func (s *ApplicationService) ListApplications(ctx context.Context, userID uuid.UUID) ([]*models.Application, error) {
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	applications, err := s.repo.ListApplications(owner)
+	if err != nil {
+		return nil, err
+	}
+	if applications == nil {
+		applications = []*models.Application{}
+	}
+	return applications, nil
+}
+
+// GetApplication returns an application userID owns, or any application to an administrator
+func (s *ApplicationService) GetApplication(ctx context.Context, userID, id uuid.UUID) (*models.Application, error) {
+	application, err := s.repo.GetApplication(id)
+	if err != nil {
+		return nil, err
+	}
+	if application == nil {
+		return nil, ErrApplicationNotFound
+	}
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && application.UserID != *owner {
+		return nil, ErrApplicationNotFound
+	}
+	return application, nil
+}
+
+// UpdateApplication replaces the name, description and services of an application; releases
+// already created keep the services they were created with. With ifMatch set, the application
+// must not have changed since it was last updated at that time.
+func (s *ApplicationService) UpdateApplication(ctx context.Context, userID, id uuid.UUID, req *models.ApplicationRequest, ifMatch *time.Time) (*models.Application, error) {
+	application, err := s.GetApplication(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidApplication, err)
+	}
+	existing, err := s.repo.GetApplicationByName(application.UserID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != id {
+		return nil, ErrApplicationExists
+	}
+
+	application.Name = req.Name
+	application.Description = optionalString(strings.TrimSpace(req.Description))
+	application.Services = req.Services
+	updated, err := s.repo.UpdateApplication(application, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, unchanged(ifMatch, ErrApplicationNotFound)
+	}
+	return application, nil
+}
+
+// DeleteApplication deletes an application and its releases; their deployments keep a null
+// application_release_id. With ifMatch set, the application must not have changed since it was
+// last updated at that time.
+func (s *ApplicationService) DeleteApplication(ctx context.Context, userID, id uuid.UUID, ifMatch *time.Time) error {
+	if _, err := s.GetApplication(ctx, userID, id); err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteApplication(id, ifMatch)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return unchanged(ifMatch, ErrApplicationNotFound)
+	}
+	return nil
+}
+
+// CreateRelease deploys every service of an application to a target on behalf of userID. All
+// deployments are created up front, each held by a gate until the deployments of the services it
+// depends on, or of the service before it, have completed; the first is queued right away.
+func (s *ApplicationService) CreateRelease(ctx context.Context, userID, applicationID uuid.UUID, req *models.ApplicationReleaseRequest) (*models.ApplicationRelease, error) {
+	application, err := s.GetApplication(ctx, userID, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Validate(application); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRelease, err)
+	}
+
+	services, err := application.ReleaseOrder()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRelease, err)
+	}
+
+	now := time.Now()
+	release := &models.ApplicationRelease{
+		ID:            uuid.New(),
+		ApplicationID: application.ID,
+		UserID:        userID,
+		TargetIP:      req.TargetIP,
+		Dependencies:  application.Dependencies(),
+		CreatedAt:     now,
+	}
+	waitUntil := now.Add(s.config.ReleaseTimeout)
+
+	// Every deployment is validated before any is created
+	requests := make([]*models.CreateDeploymentRequest, len(services))
+	for i, service := range services {
+		requests[i] = releaseDeploymentRequest(application, service, release, req, waitUntil)
+		if err := requests[i].Validate(); err != nil {
+			return nil, fmt.Errorf("%w: service %q: %v", ErrInvalidRelease, service.Name, err)
+		}
+		release.Services = append(release.Services, service.Name)
+	}
+	if err := s.repo.CreateApplicationRelease(release); err != nil {
+		return nil, err
+	}
+
+	var created []uuid.UUID
+	for i, deploymentReq := range requests {
+		deployment, err := s.deployments.CreateDeploymentWithEnvFile(ctx, deploymentReq, "", userID)
+		if err != nil {
+			message := fmt.Sprintf("Application release %s was not created: service %q was refused: %v", release.ID, release.Services[i], err)
+			for _, id := range created {
+				if err := s.gates.failDeployment(ctx, id, message); err != nil {
+					s.logger.WithError(err).WithField("deployment_id", id).Error("Failed to fail deployment of a refused application release")
+				}
+			}
+			return nil, fmt.Errorf("service %q: %w", release.Services[i], err)
+		}
+		created = append(created, deployment.ID)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"application_id": application.ID,
+		"release_id":     release.ID,
+		"user_id":        userID,
+		"target_ip":      req.TargetIP,
+		"services":       len(release.Services),
+	}).Info("Application release created")
+
+	if err := s.advance(ctx, release); err != nil {
+		s.logger.WithError(err).WithField("release_id", release.ID).Warn("Failed to queue the first service of application release, leaving it to the release monitor")
+	}
+	return s.GetRelease(ctx, userID, applicationID, release.ID)
+}
+
+// releaseDeploymentRequest builds the deployment request of one service of a release. The service
+// is named after the application and the service, and reachable by the service name on the
+// application's network. The worker checks the containers of its dependencies are ready before
+// it starts the container.
+func releaseDeploymentRequest(application *models.Application, service models.ApplicationService, release *models.ApplicationRelease, req *models.ApplicationReleaseRequest, waitUntil time.Time) *models.CreateDeploymentRequest {
+	containerName := application.ContainerName(service.Name)
+	projectName := application.Name
+	deploymentName := service.Name
+	deploymentReq := &models.CreateDeploymentRequest{
+		TargetIP:       req.TargetIP,
+		SSHUsername:    req.SSHUsername,
+		SSHPassword:    req.SSHPassword,
+		GitHubRepoURL:  service.GitHubRepoURL,
+		GitHubPAT:      req.GitHubPAT,
+		GitHubBranch:   service.GitHubBranch,
+		Port:           service.PortString(),
+		ContainerName:  &containerName,
+		ProjectName:    &projectName,
+		DeploymentName: &deploymentName,
+		Release: &models.ApplicationReleaseMember{
+			ReleaseID:       release.ID,
+			Service:         service.Name,
+			Network:         application.Network(),
+			EnvironmentVars: req.ServiceEnv(service.Name),
+			WaitUntil:       &waitUntil,
+		},
+	}
+	for _, dependency := range service.DependsOn {
+		container := models.ContainerDependency{
+			Container: application.ContainerName(dependency.Service),
+			Condition: dependency.OrDefault(),
+		}
+		if container.Condition == models.DependencyPortOpen {
+			container.Port = application.Service(dependency.Service).Port
+		}
+		deploymentReq.Release.DependsOn = append(deploymentReq.Release.DependsOn, container)
+	}
+	if service.RepoSubdirectory != "" {
+		subdirectory := service.RepoSubdirectory
+		deploymentReq.RepoSubdirectory = &subdirectory
+	}
+	return deploymentReq
+}
+
+// ListReleases returns the latest releases of an application userID may see, newest first
+func (s *ApplicationService) ListReleases(ctx context.Context, userID, applicationID uuid.UUID) ([]*models.ApplicationRelease, error) {
+	if _, err := s.GetApplication(ctx, userID, applicationID); err != nil {
+		return nil, err
+	}
+	releases, err := s.repo.ListApplicationReleases(applicationID, releaseListLimit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.resolveStatus(releases); err != nil {
+		return nil, err
+	}
+	if releases == nil {
+		releases = []*models.ApplicationRelease{}
+	}
+	return releases, nil
+}
+
+// GetRelease returns a release of an application userID may see, with the status of each service
+func (s *ApplicationService) GetRelease(ctx context.Context, userID, applicationID, releaseID uuid.UUID) (*models.ApplicationRelease, error) {
+	if _, err := s.GetApplication(ctx, userID, applicationID); err != nil {
+		return nil, err
+	}
+	release, err := s.repo.GetApplicationRelease(releaseID)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil || release.ApplicationID != applicationID {
+		return nil, ErrReleaseNotFound
+	}
+	if err := s.resolveStatus([]*models.ApplicationRelease{release}); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// resolveStatus sets the status of every service of the releases and their aggregate status
+func (s *ApplicationService) resolveStatus(releases []*models.ApplicationRelease) error {
+	if len(releases) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(releases))
+	for i, release := range releases {
+		ids[i] = release.ID
+	}
+	deployments, err := s.repo.GetApplicationReleaseDeployments(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, release := range releases {
+		byService := releaseDeployments(release, deployments)
+		release.Members = []models.ApplicationReleaseStatus{}
+		var statuses []models.DeploymentStatus
+		for _, name := range release.Services {
+			deployment := byService[name]
+			if deployment == nil {
+				continue
+			}
+			release.Members = append(release.Members, models.ApplicationReleaseStatus{
+				Service:      name,
+				DeploymentID: deployment.ID,
+				Status:       deployment.Status,
+				ErrorMessage: deployment.ErrorMessage,
+				StartedAt:    deployment.StartedAt,
+				CompletedAt:  deployment.CompletedAt,
+			})
+			statuses = append(statuses, deployment.Status)
+		}
+		release.Status = models.AggregateReleaseStatus(statuses)
+	}
+	return nil
+}
+
+// releaseDeployments returns the deployments of a release by service
+func releaseDeployments(release *models.ApplicationRelease, deployments []*models.Deployment) map[string]*models.Deployment {
+	byService := make(map[string]*models.Deployment, len(release.Services))
+	for _, deployment := range deployments {
+		if deployment.ApplicationReleaseID == nil || *deployment.ApplicationReleaseID != release.ID || deployment.ApplicationService == nil {
+			continue
+		}
+		byService[*deployment.ApplicationService] = deployment
+	}
+	return byService
+}
+
+// advance queues each service of a release whose dependencies, or the service before it when it
+// has none, have completed. It fails the waiting services that wait for one that failed or was
+// cancelled.
+func (s *ApplicationService) advance(ctx context.Context, release *models.ApplicationRelease) error {
+	deployments, err := s.repo.GetApplicationReleaseDeployments([]uuid.UUID{release.ID})
+	if err != nil {
+		return err
+	}
+	byService := releaseDeployments(release, deployments)
+
+	for i, name := range release.Services {
+		deployment := byService[name]
+		if deployment == nil || deployment.Status != models.DeploymentStatusPending {
+			continue
+		}
+		waiting, err := s.waitingForRelease(deployment.ID)
+		if err != nil {
+			return err
+		}
+		if !waiting {
+			continue
+		}
+
+		awaited := release.Dependencies[name]
+		dependencies := len(awaited) > 0
+		if !dependencies && i > 0 {
+			awaited = []models.ApplicationDependency{{Service: release.Services[i-1]}}
+		}
+
+		ready, missing := true, false
+		var stopped *models.Deployment
+		var stoppedService string
+		for _, dependency := range awaited {
+			previous := byService[dependency.Service]
+			switch {
+			case previous == nil:
+				missing = true
+			case previous.Status == models.DeploymentStatusFailed || previous.Status == models.DeploymentStatusCancelled || previous.Status == models.DeploymentStatusAborted:
+				if stopped == nil {
+					stopped, stoppedService = previous, dependency.Service
+				}
+			case previous.Status != models.DeploymentStatusCompleted:
+				ready = false
+			}
+		}
+		switch {
+		case stopped != nil:
+			message := fmt.Sprintf("Service %q of application release %s did not complete (%s), so service %q was not deployed", stoppedService, release.ID, stopped.Status, name)
+			if dependencies {
+				message = fmt.Sprintf("Dependency error: service %q depends on service %q of application release %s, which did not complete (%s), so it was not deployed", name, stoppedService, release.ID, stopped.Status)
+			}
+			if err := s.gates.failDeployment(ctx, deployment.ID, message); err != nil {
+				return err
+			}
+			// The services waiting for this one fail in the same pass
+			deployment.Status = models.DeploymentStatusFailed
+		case missing:
+			continue
+		case ready:
+			if err := s.pass(ctx, release, deployment, i, awaited, dependencies); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// waitingForRelease reports whether a deployment still waits for its release gate
+func (s *ApplicationService) waitingForRelease(deploymentID uuid.UUID) (bool, error) {
+	gates, err := s.repo.GetDeploymentGates(deploymentID)
+	if err != nil {
+		return false, err
+	}
+	for _, gate := range gates {
+		if gate.Name == models.ApplicationReleaseGate {
+			return gate.Status == models.GateStatusWaiting, nil
+		}
+	}
+	return false, nil
+}
+
+// pass passes the release gate of the deployment of the service at index i, which waited for the
+// awaited services, and queues the deployment once its other gates have passed too
+func (s *ApplicationService) pass(ctx context.Context, release *models.ApplicationRelease, deployment *models.Deployment, i int, awaited []models.ApplicationDependency, dependencies bool) error {
+	details := "First service of the release"
+	switch {
+	case dependencies:
+		names := make([]string, len(awaited))
+		for j, dependency := range awaited {
+			names[j] = fmt.Sprintf("%q (%s)", dependency.Service, dependency.OrDefault())
+		}
+		details = fmt.Sprintf("Dependencies completed: %s", strings.Join(names, ", "))
+	case len(awaited) > 0:
+		details = fmt.Sprintf("Service %q completed", awaited[0].Service)
+	}
+	gate, err := s.repo.ReportDeploymentGate(deployment.ID, models.ApplicationReleaseGate, models.GateStatusPassed, &details, nil, release.UserID)
+	if err != nil || gate == nil {
+		// Another server passed the gate
+		return err
+	}
+
+	message := fmt.Sprintf("Application release %s: deploying service %q (%d of %d)", release.ID, release.Services[i], i+1, len(release.Services))
+	if err := s.deployments.AddDeploymentLog(ctx, deployment.ID, "info", message, "gates", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log application release progress")
+	}
+	return s.gates.release(ctx, deployment.ID)
+}
+
+// ownerFilter returns nil for administrators, who see every application, and userID otherwise
+func (s *ApplicationService) ownerFilter(userID uuid.UUID) (*uuid.UUID, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && user.Role == models.RoleAdmin {
+		return nil, nil
+	}
+	return &userID, nil
+}
+
+// ReleaseMonitor moves application releases forward: it queues each service of a release once the
+// services it waits for have completed. Releases whose services wait too long fail by their gates
+// timing out.
+type ReleaseMonitor struct {
+	applications *ApplicationService
+	config       config.ApplicationConfig
+	logger       *logrus.Logger
+}
+
+// NewReleaseMonitor creates a new application release monitor
+func NewReleaseMonitor(applications *ApplicationService, cfg config.ApplicationConfig, logger *logrus.Logger) *ReleaseMonitor {
+	return &ReleaseMonitor{
+		applications: applications,
+		config:       cfg,
+		logger:       logger,
+	}
+}
+
+// Run advances waiting releases every interval until ctx is cancelled
+func (m *ReleaseMonitor) Run(ctx context.Context) {
+	m.logger.WithField("interval", m.config.Interval).Info("Starting application release monitor")
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Sweep(ctx); err != nil && ctx.Err() == nil {
+			m.logger.WithError(err).Error("Application release sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep advances every release with a service still waiting and returns how many it looked at
+func (m *ReleaseMonitor) Sweep(ctx context.Context) (int, error) {
+	repo := m.applications.repo
+	ids, err := repo.GetWaitingApplicationReleases(releaseBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		release, err := repo.GetApplicationRelease(id)
+		if err != nil || release == nil {
+			if err != nil {
+				m.logger.WithError(err).WithField("release_id", id).Error("Failed to get application release")
+			}
+			continue
+		}
+		if err := m.applications.advance(ctx, release); err != nil {
+			m.logger.WithError(err).WithField("release_id", id).Error("Failed to advance application release")
+		}
+	}
+	return len(ids), nil
+}
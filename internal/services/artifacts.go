@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrArtifactNotFound is returned when a deployment has no artifact of the requested name
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// artifactCleanupInterval is how often artifacts past their retention are deleted
+const artifactCleanupInterval = time.Hour
+
+// ArtifactService keeps files with deployments, such as the full output of image builds, so that
+// huge builds do not turn into millions of log rows. Artifacts are stored gzip-compressed.
+type ArtifactService struct {
+	repo   *database.Repository
+	config config.ArtifactsConfig
+	logger *logrus.Logger
+}
+
+// NewArtifactService creates a new artifact service
+func NewArtifactService(repo *database.Repository, cfg config.ArtifactsConfig, logger *logrus.Logger) *ArtifactService {
+	return &ArtifactService{
+		repo:   repo,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// BuildLogsEnabled reports whether the full output of image builds is kept as an artifact
+func (s *ArtifactService) BuildLogsEnabled() bool {
+	return s.config.BuildLogs
+}
+
+// SaveBuildLog stores the full output of a deployment's image build as its build.log artifact
+func (s *ArtifactService) SaveBuildLog(ctx context.Context, deploymentID uuid.UUID, output []byte) (*models.DeploymentArtifact, error) {
+	return s.SaveArtifact(ctx, deploymentID, models.BuildLogArtifact, "text/plain; charset=utf-8", output)
+}
+
+// SaveArtifact compresses and stores an artifact of a deployment, replacing the artifact of the same
+// name. Content beyond the maximum size is cut from the front, since the end of a log explains a failure.
+func (s *ArtifactService) SaveArtifact(ctx context.Context, deploymentID uuid.UUID, name, contentType string, content []byte) (*models.DeploymentArtifact, error) {
+	truncated := false
+	if s.config.MaxSize > 0 && int64(len(content)) > s.config.MaxSize {
+		marker := fmt.Sprintf("[output truncated to the last %d bytes]\n", s.config.MaxSize)
+		content = append([]byte(marker), content[int64(len(content))-s.config.MaxSize:]...)
+		truncated = true
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(content); err != nil {
+		return nil, fmt.Errorf("failed to compress artifact: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress artifact: %w", err)
+	}
+
+	artifact := &models.DeploymentArtifact{
+		ID:             uuid.New(),
+		DeploymentID:   deploymentID,
+		Name:           name,
+		ContentType:    contentType,
+		Size:           int64(len(content)),
+		CompressedSize: int64(compressed.Len()),
+		Truncated:      truncated,
+		Content:        compressed.Bytes(),
+		CreatedAt:      time.Now(),
+	}
+	if err := s.repo.SaveDeploymentArtifact(artifact); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id":   deploymentID,
+		"artifact":        name,
+		"size":            artifact.Size,
+		"compressed_size": artifact.CompressedSize,
+		"truncated":       truncated,
+	}).Info("Deployment artifact stored")
+
+	return artifact, nil
+}
+
+// GetDeploymentArtifacts lists the artifacts of a deployment without their content
+func (s *ArtifactService) GetDeploymentArtifacts(ctx context.Context, deploymentID uuid.UUID) ([]*models.DeploymentArtifact, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := repo.GetDeployment(deploymentID); err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	return repo.GetDeploymentArtifacts(deploymentID)
+}
+
+// GetDeploymentArtifact returns an artifact of a deployment with its gzip-compressed content
+func (s *ArtifactService) GetDeploymentArtifact(ctx context.Context, deploymentID uuid.UUID, name string) (*models.DeploymentArtifact, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := repo.GetDeployment(deploymentID); err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	artifact, err := repo.GetDeploymentArtifact(deploymentID, name)
+	if err != nil {
+		return nil, err
+	}
+	if artifact == nil {
+		return nil, ErrArtifactNotFound
+	}
+	return artifact, nil
+}
+
+// Run deletes artifacts past their retention every hour until ctx is cancelled
+func (s *ArtifactService) Run(ctx context.Context) {
+	s.logger.WithField("retention", s.config.Retention).Info("Starting deployment artifact cleanup")
+
+	ticker := time.NewTicker(artifactCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.repo.DeleteDeploymentArtifacts(time.Now().Add(-s.config.Retention))
+		if err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("Failed to clean up deployment artifacts")
+		} else if deleted > 0 {
+			s.logger.WithField("deleted", deleted).Info("Deleted deployment artifacts past their retention")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditService records and lists security-relevant events
+type AuditService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo *database.Repository, logger *logrus.Logger) *AuditService {
+	return &AuditService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// RecordEvent stores an audit event. Failing to store it is logged rather than returned, so the
+// request being audited is answered the same either way.
+func (s *AuditService) RecordEvent(ctx context.Context, event *models.AuditEvent) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	fields := logrus.Fields{
+		"event_type":      event.EventType,
+		"user_id":         event.UserID,
+		"organization_id": event.OrganizationID,
+		"ip_address":      event.IPAddress,
+		"method":          event.Method,
+		"path":            event.Path,
+		"reason":          event.Reason,
+	}
+	s.logger.WithFields(fields).Warn("Audit event")
+
+	if err := s.repo.CreateAuditEvent(event); err != nil {
+		s.logger.WithError(err).WithFields(fields).Error("Failed to record audit event")
+	}
+}
+
+// ListEvents returns the audit events matching the filter and the total number of matches
+func (s *AuditService) ListEvents(ctx context.Context, filter models.AuditEventFilter, limit, offset int) ([]*models.AuditEvent, int, error) {
+	events, total, err := s.repo.ListAuditEvents(filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if events == nil {
+		events = []*models.AuditEvent{}
+	}
+	return events, total, nil
+}
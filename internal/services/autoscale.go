@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"deployknot/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// ScalingAction is the change to the worker fleet an advisory recommends
+type ScalingAction string
+
+const (
+	ScalingActionNone      ScalingAction = "none"
+	ScalingActionScaleUp   ScalingAction = "scale_up"
+	ScalingActionScaleDown ScalingAction = "scale_down"
+)
+
+// autoscaleWebhookTimeout bounds how long delivering an advisory to the webhook may take
+const autoscaleWebhookTimeout = 10 * time.Second
+
+// scalingAdvisoryKey is held for the cooldown after an advisory in a direction is emitted for a
+// worker pool, so replicas of the server do not repeat it
+func scalingAdvisoryKey(pool string, action ScalingAction) string {
+	return "deployknot:autoscale:advisory:" + pool + ":" + string(action)
+}
+
+// ScalingAdvice recommends a worker count for the current backlog, in total and per worker pool
+type ScalingAdvice struct {
+	Pool           string           `json:"pool,omitempty"`
+	Action         ScalingAction    `json:"action"`
+	CurrentWorkers int64            `json:"current_workers"`
+	DesiredWorkers int64            `json:"desired_workers"`
+	Reason         string           `json:"reason"`
+	Pools          []*ScalingAdvice `json:"pools,omitempty"`
+}
+
+// ScalingAdvisory is the event emitted when the worker fleet should be resized
+type ScalingAdvisory struct {
+	ScalingAdvice
+	Queue     *QueueHealth `json:"queue"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Autoscaler derives worker scaling advice from the queue and emits advisories when the fleet
+// should grow or shrink. It never starts or stops workers itself.
+type Autoscaler struct {
+	queue      *QueueService
+	redis      *redis.Client
+	config     config.AutoscaleConfig
+	staleAfter time.Duration
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewAutoscaler creates a new autoscaler; workers without a heartbeat within staleAfter are not counted
+func NewAutoscaler(queue *QueueService, redisClient *redis.Client, cfg config.AutoscaleConfig, staleAfter time.Duration, logger *logrus.Logger) *Autoscaler {
+	return &Autoscaler{
+		queue:      queue,
+		redis:      redisClient,
+		config:     cfg,
+		staleAfter: staleAfter,
+		httpClient: &http.Client{Timeout: autoscaleWebhookTimeout},
+		logger:     logger,
+	}
+}
+
+// Evaluate returns the state of the queue and the scaling advice for it
+func (a *Autoscaler) Evaluate(ctx context.Context) (*QueueHealth, *ScalingAdvice, error) {
+	health, err := a.queue.Health(ctx, a.staleAfter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return health, a.Advise(health), nil
+}
+
+// Advise recommends for each worker pool one worker for every running deployment plus enough
+// workers for the pending jobs at JobsPerWorker each, within MinWorkers and MaxWorkers. The total
+// recommendation is the sum over the pools.
+func (a *Autoscaler) Advise(health *QueueHealth) *ScalingAdvice {
+	if len(health.Pools) == 0 {
+		return a.advisePool(health)
+	}
+
+	var desired int64
+	pools := make([]*ScalingAdvice, 0, len(health.Pools))
+	for _, pool := range health.Pools {
+		advice := a.advisePool(pool)
+		desired += advice.DesiredWorkers
+		pools = append(pools, advice)
+	}
+
+	advice := newScalingAdvice(health, desired)
+	advice.Pools = pools
+	return advice
+}
+
+// advisePool recommends a worker count for the queue of one pool
+func (a *Autoscaler) advisePool(health *QueueHealth) *ScalingAdvice {
+	perWorker := int64(a.config.JobsPerWorker)
+	desired := health.InFlight + (health.Depth+perWorker-1)/perWorker
+	desired = max(desired, int64(a.config.MinWorkers))
+	desired = min(desired, int64(a.config.MaxWorkers))
+	return newScalingAdvice(health, desired)
+}
+
+// newScalingAdvice compares the active workers of a queue with the desired count
+func newScalingAdvice(health *QueueHealth, desired int64) *ScalingAdvice {
+	advice := &ScalingAdvice{
+		Pool:           health.Pool,
+		Action:         ScalingActionNone,
+		CurrentWorkers: health.ActiveWorkers,
+		DesiredWorkers: desired,
+		Reason:         fmt.Sprintf("%d pending and %d running deployments need %d workers, %d are active", health.Depth, health.InFlight, desired, health.ActiveWorkers),
+	}
+	switch {
+	case desired > health.ActiveWorkers:
+		advice.Action = ScalingActionScaleUp
+	case desired < health.ActiveWorkers:
+		advice.Action = ScalingActionScaleDown
+	}
+	return advice
+}
+
+// Run evaluates the queue every interval and emits advisories until ctx is cancelled
+func (a *Autoscaler) Run(ctx context.Context) {
+	a.logger.WithFields(logrus.Fields{
+		"interval":        a.config.Interval,
+		"cooldown":        a.config.Cooldown,
+		"jobs_per_worker": a.config.JobsPerWorker,
+		"min_workers":     a.config.MinWorkers,
+		"max_workers":     a.config.MaxWorkers,
+	}).Info("Starting worker scaling advisories")
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.evaluateAndAdvise(ctx); err != nil && ctx.Err() == nil {
+			a.logger.WithError(err).Error("Worker scaling evaluation failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evaluateAndAdvise emits an advisory for every worker pool that should be resized
+func (a *Autoscaler) evaluateAndAdvise(ctx context.Context) error {
+	health, advice, err := a.Evaluate(ctx)
+	if err != nil {
+		return err
+	}
+	if len(advice.Pools) == 0 {
+		return a.advise(ctx, health, advice)
+	}
+	for i, pool := range advice.Pools {
+		if err := a.advise(ctx, health.Pools[i], pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advise emits an advisory when a pool should be resized and no advisory in the same direction was
+// emitted for it within the cooldown
+func (a *Autoscaler) advise(ctx context.Context, health *QueueHealth, advice *ScalingAdvice) error {
+	if advice.Action == ScalingActionNone {
+		return nil
+	}
+
+	if a.config.Cooldown > 0 {
+		claimed, err := a.redis.SetNX(ctx, scalingAdvisoryKey(advice.Pool, advice.Action), time.Now().Unix(), a.config.Cooldown).Result()
+		if err != nil {
+			return fmt.Errorf("failed to claim scaling advisory: %w", err)
+		}
+		if !claimed {
+			return nil
+		}
+	}
+
+	advisory := &ScalingAdvisory{
+		ScalingAdvice: *advice,
+		Queue:         health,
+		Timestamp:     time.Now(),
+	}
+	a.logger.WithFields(logrus.Fields{
+		"pool":            advisory.Pool,
+		"action":          advisory.Action,
+		"current_workers": advisory.CurrentWorkers,
+		"desired_workers": advisory.DesiredWorkers,
+		"queue_depth":     health.Depth,
+		"in_flight":       health.InFlight,
+	}).Info("Worker scaling advisory: " + advisory.Reason)
+
+	if a.config.WebhookURL != "" {
+		if err := a.sendWebhook(ctx, advisory); err != nil {
+			a.logger.WithError(err).Warn("Failed to deliver worker scaling advisory")
+		}
+	}
+	return nil
+}
+
+// sendWebhook posts an advisory to the configured webhook
+func (a *Autoscaler) sendWebhook(ctx context.Context, advisory *ScalingAdvisory) error {
+	body, err := json.Marshal(advisory)
+	if err != nil {
+		return fmt.Errorf("failed to marshal advisory: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+
+	"filippo.io/age"
+	"github.com/sirupsen/logrus"
+)
+
+// MinBackupPassphraseLength is the minimum length of the passphrase a backup is encrypted with
+const MinBackupPassphraseLength = 16
+
+// backupKeyCheck is encrypted with ENCRYPTION_KEY into the manifest of every backup
+const backupKeyCheck = "deployknot-backup"
+
+// backupLogsTable is left out of backups without logs
+const backupLogsTable = "deployment_logs"
+
+// ErrBackupSQLite is returned for backups of a SQLite database, which are taken by copying its file
+var ErrBackupSQLite = errors.New("backups are not supported with DB_DRIVER sqlite; copy the database file instead")
+
+// ErrBackupPassphraseTooShort is returned for a backup passphrase shorter than MinBackupPassphraseLength
+var ErrBackupPassphraseTooShort = fmt.Errorf("the backup passphrase must be at least %d characters", MinBackupPassphraseLength)
+
+// backupRecord is one line of a backup archive: the manifest first, then one line per row, and a
+// final line with the row counts, so a truncated archive is recognized
+type backupRecord struct {
+	Manifest *models.BackupManifest `json:"manifest,omitempty"`
+	Table    string                 `json:"table,omitempty"`
+	Row      json.RawMessage        `json:"row,omitempty"`
+	End      bool                   `json:"end,omitempty"`
+	Rows     map[string]int64       `json:"rows,omitempty"`
+}
+
+// BackupService writes and restores backups of DeployKnot's own state: every table of the
+// database, such as users, projects and their targets, and deployments with their steps and logs.
+// An archive is a gzipped stream of JSON lines, encrypted with a passphrase using age, so it can
+// also be opened with "age -d". Stored secrets stay encrypted with ENCRYPTION_KEY inside it.
+type BackupService struct {
+	repo      *database.Repository
+	encryptor *encryption.Encryptor
+	logger    *logrus.Logger
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(repo *database.Repository, encryptor *encryption.Encryptor, logger *logrus.Logger) *BackupService {
+	return &BackupService{
+		repo:      repo,
+		encryptor: encryptor,
+		logger:    logger,
+	}
+}
+
+// Export writes a backup of the database, read from one consistent snapshot, to w
+func (s *BackupService) Export(ctx context.Context, w io.Writer, passphrase string, withoutLogs bool) (*models.BackupSummary, error) {
+	if s.repo.IsSQLite() {
+		return nil, ErrBackupSQLite
+	}
+	if len(passphrase) < MinBackupPassphraseLength {
+		return nil, ErrBackupPassphraseTooShort
+	}
+	version, dirty, err := s.repo.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("migration %d failed halfway; fix the database before backing it up", version)
+	}
+	plan, err := s.repo.GetBackupPlan()
+	if err != nil {
+		return nil, err
+	}
+	keyCheck, err := s.encryptor.Encrypt(backupKeyCheck)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key check: %w", err)
+	}
+
+	manifest := &models.BackupManifest{
+		FormatVersion:      models.BackupFormatVersion,
+		SchemaVersion:      version,
+		CreatedAt:          time.Now().UTC(),
+		EncryptionKeyCheck: keyCheck,
+	}
+	for _, table := range plan.Tables {
+		if withoutLogs && table == backupLogsTable {
+			continue
+		}
+		manifest.Tables = append(manifest.Tables, table)
+	}
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup recipient: %w", err)
+	}
+	encrypted, err := age.Encrypt(w, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	compressed := gzip.NewWriter(encrypted)
+	encoder := json.NewEncoder(compressed)
+
+	snapshot, err := s.repo.BeginBackupSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Close()
+
+	summary := &models.BackupSummary{SchemaVersion: version, Rows: map[string]int64{}}
+	if err := encoder.Encode(backupRecord{Manifest: manifest}); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	for _, table := range manifest.Tables {
+		summary.Rows[table] = 0
+		err := snapshot.ExportTable(table, func(row json.RawMessage) error {
+			summary.Rows[table]++
+			if err := encoder.Encode(backupRecord{Table: table, Row: row}); err != nil {
+				return fmt.Errorf("failed to write backup: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Encode(backupRecord{End: true, Rows: summary.Rows}); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"schema_version": version,
+		"tables":         len(manifest.Tables),
+		"without_logs":   withoutLogs,
+	}).Info("Backup written")
+	return summary, nil
+}
+
+// Restore restores a backup into a database that holds no rows yet, in one transaction. migrateTo
+// is called with the schema version of the backup before anything is restored; it must migrate the
+// database up to exactly that version.
+func (s *BackupService) Restore(ctx context.Context, r io.Reader, passphrase string, migrateTo func(version uint) error) (*models.BackupSummary, error) {
+	if s.repo.IsSQLite() {
+		return nil, ErrBackupSQLite
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup identity: %w", err)
+	}
+	decrypted, err := age.Decrypt(r, identity)
+	if err != nil {
+		var wrongPassphrase *age.NoIdentityMatchError
+		if errors.As(err, &wrongPassphrase) {
+			return nil, fmt.Errorf("the passphrase does not open the backup")
+		}
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	decompressed, err := gzip.NewReader(bufio.NewReader(decrypted))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	decoder := json.NewDecoder(decompressed)
+
+	var first backupRecord
+	if err := decoder.Decode(&first); err != nil || first.Manifest == nil {
+		return nil, fmt.Errorf("the backup has no manifest")
+	}
+	manifest := first.Manifest
+	if manifest.FormatVersion != models.BackupFormatVersion {
+		return nil, fmt.Errorf("backup format version %d is not supported", manifest.FormatVersion)
+	}
+	if keyCheck, err := s.encryptor.Decrypt(manifest.EncryptionKeyCheck); err != nil || keyCheck != backupKeyCheck {
+		return nil, fmt.Errorf("the backup was taken with a different ENCRYPTION_KEY; the stored secrets in it could not be decrypted")
+	}
+
+	// Never migrate down, which would drop the data of a database that is in use
+	version, _, err := s.repo.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > manifest.SchemaVersion {
+		return nil, fmt.Errorf("the database is at schema version %d, newer than the backup's %d; restore into a new database", version, manifest.SchemaVersion)
+	}
+	if err := migrateTo(manifest.SchemaVersion); err != nil {
+		return nil, err
+	}
+	version, dirty, err := s.repo.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version != manifest.SchemaVersion || dirty {
+		return nil, fmt.Errorf("the database is at schema version %d, the backup at %d", version, manifest.SchemaVersion)
+	}
+	plan, err := s.repo.GetBackupPlan()
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, table := range plan.Tables {
+		known[table] = true
+	}
+	for _, table := range manifest.Tables {
+		if !known[table] {
+			return nil, fmt.Errorf("the backup holds table %s, which the database does not have", table)
+		}
+	}
+
+	restore, err := s.repo.BeginBackupRestore(ctx, plan)
+	if err != nil {
+		return nil, err
+	}
+	defer restore.Rollback()
+
+	summary := &models.BackupSummary{SchemaVersion: manifest.SchemaVersion, Rows: map[string]int64{}}
+	for {
+		var record backupRecord
+		if err := decoder.Decode(&record); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("the backup is truncated")
+			}
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		if record.End {
+			for _, table := range manifest.Tables {
+				if summary.Rows[table] != record.Rows[table] {
+					return nil, fmt.Errorf("the backup lists %d rows of %s but holds %d", record.Rows[table], table, summary.Rows[table])
+				}
+			}
+			break
+		}
+		if !known[record.Table] {
+			return nil, fmt.Errorf("the backup holds a row of unknown table %q", record.Table)
+		}
+		if err := restore.InsertRow(record.Table, record.Row); err != nil {
+			return nil, err
+		}
+		summary.Rows[record.Table]++
+	}
+	if err := restore.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"schema_version": manifest.SchemaVersion,
+		"created_at":     manifest.CreatedAt,
+		"tables":         len(manifest.Tables),
+	}).Info("Backup restored")
+	return summary, nil
+}
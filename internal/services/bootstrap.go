@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// bootstrapKeyComment marks the keys authorized by a bootstrap, so running it again replaces them
+const bootstrapKeyComment = "deployknot-bootstrap"
+
+// bootstrapScript creates or updates the deploy user on a target as root. It takes the user and
+// the authorized key as arguments and reads the password from stdin, so the password does not
+// show up in the target's process list. The user gets Docker access and nothing else: it is taken
+// out of the administrator groups and must not be able to run anything with sudo.
+const bootstrapScript = `set -eu
+user="$1"
+key="$2"
+IFS= read -r password
+
+if ! getent group docker >/dev/null 2>&1; then
+	echo "the docker group does not exist; install Docker first" >&2
+	exit 1
+fi
+
+if ! id "$user" >/dev/null 2>&1; then
+	shell=/bin/sh
+	[ -x /bin/bash ] && shell=/bin/bash
+	if command -v useradd >/dev/null 2>&1; then
+		useradd --create-home --shell "$shell" "$user"
+	else
+		adduser -D -s "$shell" "$user"
+	fi
+fi
+printf '%s:%s\n' "$user" "$password" | chpasswd
+
+if command -v usermod >/dev/null 2>&1; then
+	usermod -aG docker "$user"
+else
+	addgroup "$user" docker
+fi
+for group in sudo wheel admin; do
+	if command -v gpasswd >/dev/null 2>&1; then
+		gpasswd -d "$user" "$group" >/dev/null 2>&1 || true
+	else
+		delgroup "$user" "$group" >/dev/null 2>&1 || true
+	fi
+done
+rm -f "/etc/sudoers.d/$user"
+if command -v sudo >/dev/null 2>&1 && sudo -l -U "$user" 2>/dev/null | grep -q 'may run'; then
+	echo "$user can still run commands with sudo; remove its rules from /etc/sudoers" >&2
+	exit 1
+fi
+
+home=$(getent passwd "$user" | cut -d: -f6)
+keys="$home/.ssh/authorized_keys"
+mkdir -p "$home/.ssh"
+touch "$keys"
+grep -v ' ` + bootstrapKeyComment + `$' "$keys" > "$keys.tmp" || true
+printf '%s\n' "$key" >> "$keys.tmp"
+mv "$keys.tmp" "$keys"
+chown -R "$user" "$home/.ssh"
+chmod 700 "$home/.ssh"
+chmod 600 "$keys"
+`
+
+// TargetBootstrapOptions are how a target is bootstrapped
+type TargetBootstrapOptions struct {
+	// AdminUser logs in to set the target up; users other than root need passwordless sudo
+	AdminUser string
+	AdminAuth []ssh.AuthMethod
+	// DeployUser is the user created for deployments, models.DefaultDeployUser when empty
+	DeployUser string
+	Timeout    time.Duration
+}
+
+// BootstrapTarget prepares an SSH target of a project for deployments with least privilege: it
+// creates a dedicated deploy user with a new password and SSH key, gives it access to Docker but
+// not to sudo, and checks it can log in. The target then deploys as that user, and the fingerprints
+// of its key and of the host key are recorded with the target. The credentials are only returned.
+// Bootstrapping a target again rotates them.
+func (s *ProjectService) BootstrapTarget(ctx context.Context, idOrName, targetName string, opts TargetBootstrapOptions) (*models.TargetBootstrap, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.repo.GetProjectTargetByName(project.ID, targetName)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrProjectTargetNotFound
+	}
+	if target.TargetType == models.TargetTypeKubernetes {
+		return nil, fmt.Errorf("%w: only SSH targets can be bootstrapped", ErrInvalidProjectConfig)
+	}
+	if opts.DeployUser == "" {
+		opts.DeployUser = models.DefaultDeployUser
+	}
+	if err := models.ValidateDeployUser(opts.DeployUser); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProjectConfig, err)
+	}
+
+	password, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, bootstrapKeyComment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH key: %w", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH key: %w", err)
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " " + bootstrapKeyComment
+
+	// The host key seen by the administrator's connection is the one the deploy user must see too
+	var hostKey ssh.PublicKey
+	address := net.JoinHostPort(target.TargetIP, "22")
+	admin, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User: opts.AdminUser,
+		Auth: opts.AdminAuth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return nil
+		},
+		Timeout: opts.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s as %s: %w", target.TargetIP, opts.AdminUser, err)
+	}
+	defer admin.Close()
+
+	session, err := admin.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+	session.Stdin = strings.NewReader(password + "\n")
+	cmd := shellquote.Quote("sh") + " -c " + shellquote.Quote(bootstrapScript) + " sh " + shellquote.Quote(opts.DeployUser) + " " + shellquote.Quote(authorizedKey)
+	if opts.AdminUser != "root" {
+		cmd = "sudo -n " + cmd
+	}
+	if output, err := session.CombinedOutput(cmd); err != nil {
+		return nil, fmt.Errorf("failed to set up deploy user: %w, output: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	result := &models.TargetBootstrap{
+		Username:      opts.DeployUser,
+		Password:      password,
+		PrivateKey:    string(pem.EncodeToMemory(block)),
+		AuthorizedKey: authorizedKey,
+	}
+
+	// The deploy user must log in with its key and reach Docker without sudo
+	deployer, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            opts.DeployUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         opts.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deploy user %s cannot log in with its key: %w", opts.DeployUser, err)
+	}
+	defer deployer.Close()
+	check, err := deployer.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer check.Close()
+	output, err := check.CombinedOutput("docker version --format '{{.Server.Version}}'")
+	if err != nil {
+		return nil, fmt.Errorf("deploy user %s cannot reach Docker: %w, output: %s", opts.DeployUser, err, strings.TrimSpace(string(output)))
+	}
+	result.DockerVersion = strings.TrimSpace(string(output))
+
+	// Deployments log in with the password, which the SSH server may not accept
+	if client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{
+		User:            opts.DeployUser,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         opts.Timeout,
+	}); err == nil {
+		result.PasswordLogin = true
+		client.Close()
+	}
+
+	keyFingerprint := ssh.FingerprintSHA256(sshPublicKey)
+	hostKeyFingerprint := ssh.FingerprintSHA256(hostKey)
+	target.SSHUsername = opts.DeployUser
+	target.SSHKeyFingerprint = &keyFingerprint
+	target.SSHHostKeyFingerprint = &hostKeyFingerprint
+	if err := s.repo.RecordProjectTargetBootstrap(target); err != nil {
+		return nil, err
+	}
+	result.Target = target
+
+	s.logger.WithFields(logrus.Fields{
+		"project":         project.Name,
+		"target":          target.Name,
+		"deploy_user":     opts.DeployUser,
+		"key_fingerprint": keyFingerprint,
+		"host_key":        hostKeyFingerprint,
+	}).Info("Project target bootstrapped")
+	return result, nil
+}
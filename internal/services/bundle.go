@@ -0,0 +1,143 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// bundleArtifacts are the artifacts copied into post-mortem bundles when a deployment has them
+var bundleArtifacts = []string{models.ContainerInspectArtifact, models.BuildLogArtifact}
+
+// WriteDeploymentBundle writes the post-mortem bundle of a deployment to w as a zip archive: the
+// deployment, its effective configuration without secrets, its steps, its full log as text and as
+// NDJSON, and the docker inspect output and build log when they were kept. Nothing is written when
+// the deployment does not exist.
+func (s *DeploymentService) WriteDeploymentBundle(ctx context.Context, id uuid.UUID, w io.Writer) error {
+	response, err := s.GetDeployment(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(id)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	steps, err := repo.GetDeploymentSteps(id)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment steps: %w", err)
+	}
+	if steps == nil {
+		steps = []*models.DeploymentStep{}
+	}
+
+	archive := zip.NewWriter(w)
+	modified := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	}
+	writeJSON := func(name string, value interface{}) error {
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		file, err := create(name)
+		if err != nil {
+			return err
+		}
+		_, err = file.Write(content)
+		return err
+	}
+
+	if err := writeJSON("deployment.json", response); err != nil {
+		return err
+	}
+	if err := writeJSON("config.json", models.NewDeploymentConfigSnapshot(deployment)); err != nil {
+		return err
+	}
+	if err := writeJSON("steps.json", steps); err != nil {
+		return err
+	}
+
+	// The log is streamed twice rather than held in memory
+	text, err := create("logs.txt")
+	if err != nil {
+		return err
+	}
+	if err := repo.StreamDeploymentLogs(id, func(log *models.DeploymentLog) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(text, bundleLogLine(log)+"\n")
+		return err
+	}); err != nil {
+		return err
+	}
+	ndjson, err := create("logs.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(ndjson)
+	if err := repo.StreamDeploymentLogs(id, func(log *models.DeploymentLog) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return encoder.Encode(log)
+	}); err != nil {
+		return err
+	}
+
+	for _, name := range bundleArtifacts {
+		artifact, err := repo.GetDeploymentArtifact(id, name)
+		if err != nil {
+			return err
+		}
+		if artifact == nil {
+			continue
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(artifact.Content))
+		if err != nil {
+			return fmt.Errorf("failed to decompress artifact %s: %w", name, err)
+		}
+		file, err := create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			return fmt.Errorf("failed to decompress artifact %s: %w", name, err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// bundleLogLine formats a log entry as a line of the plain text log of a post-mortem bundle
+func bundleLogLine(log *models.DeploymentLog) string {
+	var b strings.Builder
+	b.WriteString(log.CreatedAt.UTC().Format(time.RFC3339Nano))
+	b.WriteString(" " + strings.ToUpper(string(log.LogLevel)))
+	if log.Category != nil {
+		b.WriteString(" [" + string(*log.Category) + "]")
+	}
+	if log.TaskName != nil && *log.TaskName != "" {
+		b.WriteString(" " + *log.TaskName + ":")
+	}
+	b.WriteString(" " + log.Message)
+	return b.String()
+}
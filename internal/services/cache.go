@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// deploymentCacheKeyPrefix prefixes the Redis hash holding the cached state of a deployment
+const deploymentCacheKeyPrefix = "deployment_cache:"
+
+// DeploymentCache keeps the state of deployments that dashboards poll, their row and steps, in Redis
+// so that every client following a running deployment does not read it from PostgreSQL each second.
+// Each deployment's entries live in one hash, which every change of the deployment's status, steps
+// or gates deletes; the TTL bounds how long a change made outside of these paths goes unseen. A nil
+// cache or a zero TTL caches nothing.
+type DeploymentCache struct {
+	redis  *redis.Client
+	ttl    time.Duration
+	logger *logrus.Logger
+}
+
+// NewDeploymentCache creates a new deployment cache
+func NewDeploymentCache(redisClient *redis.Client, cfg config.CacheConfig, logger *logrus.Logger) *DeploymentCache {
+	return &DeploymentCache{
+		redis:  redisClient,
+		ttl:    cfg.DeploymentTTL,
+		logger: logger,
+	}
+}
+
+func (c *DeploymentCache) enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+func deploymentCacheKey(id uuid.UUID) string {
+	return deploymentCacheKeyPrefix + id.String()
+}
+
+// scopedField names an entry as read in ctx; entries read on behalf of an isolated organization are
+// kept apart, since row-level security may have hidden what another reader sees
+func scopedField(ctx context.Context, name string) string {
+	if organizationID, ok := database.OrganizationFromContext(ctx); ok {
+		return name + ":" + organizationID.String()
+	}
+	return name
+}
+
+// get decodes the entry field of a deployment into v and reports whether it was cached
+func (c *DeploymentCache) get(ctx context.Context, id uuid.UUID, field string, v interface{}) bool {
+	if !c.enabled() {
+		return false
+	}
+	data, err := c.redis.HGet(ctx, deploymentCacheKey(id), field).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			c.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to read deployment cache")
+		}
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// set caches v as the entry field of a deployment. The hash expires ttl after its first entry was
+// set, so entries never outlive the TTL however often they are refilled.
+func (c *DeploymentCache) set(ctx context.Context, id uuid.UUID, field string, v interface{}) {
+	if !c.enabled() {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	key := deploymentCacheKey(id)
+	pipe := c.redis.TxPipeline()
+	pipe.HSet(ctx, key, field, data)
+	pipe.ExpireNX(ctx, key, c.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		c.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to write deployment cache")
+	}
+}
+
+// Invalidate drops the cached state of a deployment after it changed
+func (c *DeploymentCache) Invalidate(ctx context.Context, id uuid.UUID) {
+	if !c.enabled() {
+		return
+	}
+	if err := c.redis.Del(ctx, deploymentCacheKey(id)).Err(); err != nil {
+		c.logger.WithError(err).WithField("deployment_id", id).Warn("Failed to invalidate deployment cache")
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrChangelogNotFound is returned for a deployment without a changelog
+var ErrChangelogNotFound = errors.New("deployment has no changelog")
+
+// ChangelogService records which commits a deployment of a commit ships: the range between the
+// commit of the last completed deployment of its environment and its own, as GitHub compares them
+type ChangelogService struct {
+	repo       *database.Repository
+	config     config.ChangelogConfig
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewChangelogService creates a new changelog service
+func NewChangelogService(repo *database.Repository, cfg config.ChangelogConfig, logger *logrus.Logger) *ChangelogService {
+	return &ChangelogService{
+		repo:       repo,
+		config:     cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+	}
+}
+
+// githubCompare is the part of a GitHub compare API response a changelog is made of
+type githubCompare struct {
+	HTMLURL      string `json:"html_url"`
+	TotalCommits int    `json:"total_commits"`
+	Commits      []struct {
+		SHA     string `json:"sha"`
+		HTMLURL string `json:"html_url"`
+		Commit  struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"commit"`
+		Author *struct {
+			Login string `json:"login"`
+		} `json:"author"`
+	} `json:"commits"`
+}
+
+// Record stores the changelog of a new deployment of a commit. Deployments of a branch, and the
+// first deployment of a commit to an environment, have nothing to compare and get none. A
+// changelog is informational, so failures are logged and do not affect the deployment.
+func (s *ChangelogService) Record(ctx context.Context, deployment *models.Deployment, pat string) {
+	if !s.config.Enabled || deployment.CommitSHA == nil || *deployment.CommitSHA == "" {
+		return
+	}
+	logger := s.logger.WithField("deployment_id", deployment.ID)
+
+	project := deployment.GitHubRepoURL
+	if deployment.ProjectName != nil && *deployment.ProjectName != "" {
+		project = *deployment.ProjectName
+	}
+	environment := ""
+	if deployment.DeploymentName != nil {
+		environment = *deployment.DeploymentName
+	}
+	baseID, baseSHA, err := s.repo.GetLastCompletedCommit(project, environment, deployment.GitHubRepoURL, deployment.CreatedAt)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to find the previous deployment for the changelog")
+		return
+	}
+	if baseID == nil {
+		return
+	}
+
+	changelog := &models.DeploymentChangelog{
+		DeploymentID:     deployment.ID,
+		BaseDeploymentID: baseID,
+		BaseCommitSHA:    baseSHA,
+		HeadCommitSHA:    *deployment.CommitSHA,
+		Commits:          []models.ChangelogEntry{},
+		CreatedAt:        time.Now(),
+	}
+	if !strings.EqualFold(baseSHA, *deployment.CommitSHA) {
+		if err := s.compare(ctx, pat, models.NormalizeRepoURL(deployment.GitHubRepoURL), changelog); err != nil {
+			logger.WithError(err).Warn("Failed to get the commits of the deployment changelog")
+			return
+		}
+	}
+
+	if err := s.repo.CreateDeploymentChangelog(changelog); err != nil {
+		logger.WithError(err).Warn("Failed to store deployment changelog")
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"base_commit_sha": baseSHA,
+		"commits":         changelog.TotalCommits,
+	}).Info("Deployment changelog recorded")
+}
+
+// compare fills a changelog in with the commits GitHub lists between its base and head commits
+func (s *ChangelogService) compare(ctx context.Context, pat, repo string, changelog *models.DeploymentChangelog) error {
+	url := s.config.GitHubAPIURL + "/repos/" + repo + "/compare/" + changelog.BaseCommitSHA + "..." + changelog.HeadCommitSHA
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pat)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "DeployKnot")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("GitHub responded with status %d: %s", resp.StatusCode, failure.Message)
+	}
+	var compared githubCompare
+	if err := json.NewDecoder(resp.Body).Decode(&compared); err != nil {
+		return fmt.Errorf("failed to decode GitHub response: %w", err)
+	}
+
+	// Pull requests are linked next to the compare page: https://github.com/<owner>/<repo>/pull/<n>
+	repoPage, _, _ := strings.Cut(compared.HTMLURL, "/compare/")
+	for _, commit := range compared.Commits {
+		subject, _, _ := strings.Cut(commit.Commit.Message, "\n")
+		entry := models.ChangelogEntry{
+			SHA:         commit.SHA,
+			Subject:     strings.TrimSpace(subject),
+			Author:      commit.Commit.Author.Name,
+			URL:         commit.HTMLURL,
+			PullRequest: models.PullRequestNumber(subject),
+		}
+		if commit.Author != nil && commit.Author.Login != "" {
+			entry.Author = commit.Author.Login
+		}
+		if entry.PullRequest > 0 && repoPage != "" {
+			entry.PullRequestURL = repoPage + "/pull/" + strconv.Itoa(entry.PullRequest)
+		}
+		changelog.Commits = append(changelog.Commits, entry)
+	}
+	changelog.TotalCommits = compared.TotalCommits
+	if compared.HTMLURL != "" {
+		changelog.CompareURL = &compared.HTMLURL
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidCIDeploy is returned when a CI deploy request is invalid
+	ErrInvalidCIDeploy = errors.New("invalid CI deploy request")
+	// ErrCISourceNotFound is returned when the user never deployed the repository to the environment
+	ErrCISourceNotFound = errors.New("no successful deployment of the repository to the environment to deploy from")
+	// ErrCISourceUnusable is returned when the deployment to the environment cannot be repeated
+	ErrCISourceUnusable = errors.New("the last deployment to the environment cannot be repeated")
+	// ErrCIDeploymentNotFound is returned when a deployment does not exist or the user may not see it
+	ErrCIDeploymentNotFound = errors.New("deployment not found")
+)
+
+// CIService deploys commits on behalf of CI pipelines. A pipeline names an environment instead of
+// passing credentials; the deployment repeats the user's last successful deployment to it.
+type CIService struct {
+	repo        *database.Repository
+	deployments *DeploymentService
+	logger      *logrus.Logger
+}
+
+// NewCIService creates a new CI service
+func NewCIService(repo *database.Repository, deployments *DeploymentService, logger *logrus.Logger) *CIService {
+	return &CIService{
+		repo:        repo,
+		deployments: deployments,
+		logger:      logger,
+	}
+}
+
+// Deploy deploys a commit of a repository to an environment, with the parameters and stored
+// credentials of userID's last successful deployment of the repository to that environment
+func (s *CIService) Deploy(ctx context.Context, userID uuid.UUID, req *models.CIDeployRequest) (*models.CIDeployResponse, error) {
+	repo := models.NormalizeRepoURL(strings.TrimSpace(req.Repo))
+	sha := strings.ToLower(strings.TrimSpace(req.SHA))
+	if err := models.ValidateRepoURL(req.Repo); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCIDeploy, err)
+	}
+	if err := models.ValidateCommitSHA(sha); err != nil {
+		return nil, fmt.Errorf("%w: sha must be a full 40-character commit SHA", ErrInvalidCIDeploy)
+	}
+	var branch *string
+	if req.Ref != "" {
+		ref := strings.TrimPrefix(req.Ref, "refs/heads/")
+		if err := models.ValidateGitBranch(ref); err != nil {
+			return nil, fmt.Errorf("%w: ref: %v", ErrInvalidCIDeploy, err)
+		}
+		branch = &ref
+	}
+
+	source, err := s.repo.GetLatestEnvironmentDeployment(userID, repo, req.Environment, req.Project, models.DeploymentStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("%w: deploy %s to %q once through the API first", ErrCISourceNotFound, repo, req.Environment)
+	}
+
+	deployReq, err := replayRequest(s.deployments.encryptor, source, branch)
+	if err == nil {
+		deployReq.CommitSHA = &sha
+		err = deployReq.Validate()
+	}
+	if err == nil {
+		err = s.deployments.ValidateDeploymentRequest(deployReq)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCISourceUnusable, err)
+	}
+
+	deployment, err := s.deployments.CreateDeploymentWithEnvFile(ctx, deployReq, "", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Deployment of commit %s requested by CI from deployment %s", sha, source.ID)
+	if err := s.deployments.AddDeploymentLog(ctx, deployment.ID, "info", message, "ci", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log CI deployment")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deployment.ID,
+		"user_id":       userID,
+		"repo":          repo,
+		"environment":   req.Environment,
+		"commit_sha":    sha,
+	}).Info("Deployment created from CI")
+
+	statusURL := "/api/v1/ci/deployments/" + deployment.ID.String()
+	return &models.CIDeployResponse{
+		DeploymentID:       deployment.ID,
+		Status:             deployment.Status,
+		CommitSHA:          sha,
+		GitHubBranch:       deployReq.GitHubBranch,
+		SourceDeploymentID: source.ID,
+		StatusURL:          statusURL,
+		StreamURL:          statusURL + "/logs",
+	}, nil
+}
+
+// GetDeployment returns a deployment userID created, or any deployment to an administrator
+func (s *CIService) GetDeployment(ctx context.Context, userID, id uuid.UUID) (*models.Deployment, error) {
+	deployment, err := s.repo.GetDeployment(id)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			return nil, ErrCIDeploymentNotFound
+		}
+		return nil, err
+	}
+	user, err := authorizeTargetAccess(s.repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrCIDeploymentNotFound
+	}
+	return deployment, nil
+}
+
+// Status reports the status of a deployment userID may see, with an exit code once it finished
+func (s *CIService) Status(ctx context.Context, userID, id uuid.UUID) (*models.CIDeploymentStatus, error) {
+	deployment, err := s.GetDeployment(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.CIDeploymentStatus{
+		DeploymentID: deployment.ID,
+		Status:       deployment.Status,
+		CommitSHA:    deployment.CommitSHA,
+		ErrorMessage: deployment.ErrorMessage,
+		SupersededBy: deployment.SupersededBy,
+	}
+	if code, done := models.CIExitCode(deployment.Status); done {
+		status.Done = true
+		status.ExitCode = &code
+	}
+	if deployment.Status == models.DeploymentStatusFailed {
+		steps, err := s.repo.GetDeploymentSteps(deployment.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, step := range steps {
+			if step.Status == models.DeploymentStatusFailed {
+				status.FailedStep = step.StepName
+				break
+			}
+		}
+	}
+	return status, nil
+}
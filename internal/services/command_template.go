@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidCommandTemplate is returned when a command template does not parse or names an unknown step
+	ErrInvalidCommandTemplate = errors.New("invalid command template")
+	// ErrCommandTemplateNotFound is returned when a step has no command template set through the API
+	ErrCommandTemplateNotFound = errors.New("command template not found")
+)
+
+// CommandTemplateService manages the command templates that override the commands workers run on
+// targets. Templates set through the API take precedence over the installation's configured ones.
+type CommandTemplateService struct {
+	repo     *database.Repository
+	defaults map[string]string
+	logger   *logrus.Logger
+}
+
+// NewCommandTemplateService creates a new command template service
+func NewCommandTemplateService(repo *database.Repository, cfg config.CommandTemplateConfig, logger *logrus.Logger) *CommandTemplateService {
+	return &CommandTemplateService{
+		repo:     repo,
+		defaults: cfg.Templates(),
+		logger:   logger,
+	}
+}
+
+// ListTemplates returns every step whose command can be overridden with its effective template;
+// steps running their built-in command have an empty template
+func (s *CommandTemplateService) ListTemplates(ctx context.Context) ([]*models.CommandTemplate, error) {
+	stored, err := s.repo.ListCommandTemplates()
+	if err != nil {
+		return nil, err
+	}
+	byStep := make(map[string]*models.CommandTemplate, len(stored))
+	for _, tmpl := range stored {
+		byStep[tmpl.Step] = tmpl
+	}
+
+	steps := models.CommandTemplateSteps()
+	templates := make([]*models.CommandTemplate, 0, len(steps))
+	for _, step := range steps {
+		tmpl, ok := byStep[step]
+		if !ok {
+			tmpl = &models.CommandTemplate{Step: step}
+			if text, ok := s.defaults[step]; ok {
+				tmpl.Template = text
+				tmpl.Source = models.CommandTemplateSourceConfig
+			}
+		}
+		tmpl.Variables, _ = models.CommandTemplateVars(step)
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+// SetTemplate validates and stores the command template of a step
+func (s *CommandTemplateService) SetTemplate(ctx context.Context, step, text, updatedBy string) (*models.CommandTemplate, error) {
+	if _, err := models.ParseCommandTemplate(step, text); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCommandTemplate, err)
+	}
+
+	var by *string
+	if updatedBy != "" {
+		by = &updatedBy
+	}
+	if err := s.repo.SetCommandTemplate(step, text, by); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"step":       step,
+		"updated_by": updatedBy,
+	}).Info("Command template updated")
+
+	tmpl, err := s.repo.GetCommandTemplate(step)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, ErrCommandTemplateNotFound
+	}
+	tmpl.Variables, _ = models.CommandTemplateVars(step)
+	return tmpl, nil
+}
+
+// DeleteTemplate removes the command template of a step set through the API, so the step falls
+// back to the configured template or its built-in command
+func (s *CommandTemplateService) DeleteTemplate(ctx context.Context, step string) error {
+	if _, ok := models.CommandTemplateVars(step); !ok {
+		return fmt.Errorf("%w: step %q has no command template", ErrInvalidCommandTemplate, step)
+	}
+	deleted, err := s.repo.DeleteCommandTemplate(step)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCommandTemplateNotFound
+	}
+
+	s.logger.WithField("step", step).Info("Command template deleted")
+	return nil
+}
+
+// Template returns the parsed command template a worker runs for a step, or nil when the step runs
+// its built-in command
+func (s *CommandTemplateService) Template(ctx context.Context, step string) (*template.Template, error) {
+	text, ok := s.defaults[step]
+	stored, err := s.repo.GetCommandTemplate(step)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		text, ok = stored.Template, true
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	tmpl, err := models.ParseCommandTemplate(step, text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCommandTemplate, err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"deployknot/pkg/encryption"
+
+	"github.com/sirupsen/logrus"
+)
+
+// oneTimeCredentialsKey is the job data key holding the sealed credentials of a one-time deployment
+const oneTimeCredentialsKey = "one_time_credentials"
+
+// ErrCredentialsExpired is returned when the credentials of a one-time deployment are opened after they expired
+var ErrCredentialsExpired = errors.New("one-time credentials have expired")
+
+// oneTimeCredentials are the secrets of a deployment that are not stored with it. The expiry is
+// sealed with them, so it cannot be extended without the encryption key.
+type oneTimeCredentials struct {
+	SSHPassword         string    `json:"ssh_password,omitempty"`
+	GitHubPAT           string    `json:"github_pat"`
+	KubeconfigEncrypted string    `json:"kubeconfig_encrypted,omitempty"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+// sealOneTimeCredentials encrypts the credentials of a one-time deployment for its job
+func sealOneTimeCredentials(encryptor *encryption.Encryptor, credentials *oneTimeCredentials) (string, error) {
+	credentialsJSON, err := json.Marshal(credentials)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+	sealed, err := encryptor.Encrypt(string(credentialsJSON))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	return sealed, nil
+}
+
+// HasOneTimeCredentials reports whether a job carries sealed one-time credentials
+func HasOneTimeCredentials(job *Job) bool {
+	_, ok := job.Data[oneTimeCredentialsKey].(string)
+	return ok
+}
+
+// OpenOneTimeCredentials decrypts the sealed credentials of a one-time deployment job into its data
+// under the keys used for stored credentials. The opened credentials are only kept in memory; the
+// job must not be enqueued again afterwards.
+func OpenOneTimeCredentials(encryptor *encryption.Encryptor, job *Job) error {
+	sealed, ok := job.Data[oneTimeCredentialsKey].(string)
+	if !ok {
+		return nil
+	}
+
+	credentialsJSON, err := encryptor.Decrypt(sealed)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	var credentials oneTimeCredentials
+	if err := json.Unmarshal([]byte(credentialsJSON), &credentials); err != nil {
+		return fmt.Errorf("failed to unmarshal credentials: %w", err)
+	}
+	if time.Now().After(credentials.ExpiresAt) {
+		return fmt.Errorf("%w at %s", ErrCredentialsExpired, credentials.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	job.Data["ssh_password"] = credentials.SSHPassword
+	job.Data["github_pat"] = credentials.GitHubPAT
+	if credentials.KubeconfigEncrypted != "" {
+		job.Data["kubeconfig_encrypted"] = credentials.KubeconfigEncrypted
+	}
+	return nil
+}
+
+// WipeOneTimeCredentials removes the sealed credentials of a finished one-time deployment from
+// the job kept in Redis and deletes the deployment's outbox entries, which hold a copy of the job
+func (s *DeploymentService) WipeOneTimeCredentials(ctx context.Context, job *Job) {
+	if err := s.queue.RemoveJobData(ctx, job.ID, oneTimeCredentialsKey); err != nil {
+		s.logger.WithError(err).WithField("job_id", job.ID).Error("Failed to wipe one-time credentials from job")
+	}
+	if _, err := s.repo.DeleteDeploymentOutboxEntries(job.DeploymentID); err != nil {
+		s.logger.WithError(err).WithField("deployment_id", job.DeploymentID).Error("Failed to wipe one-time credentials from job outbox")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"job_id":        job.ID,
+		"deployment_id": job.DeploymentID,
+	}).Info("Wiped one-time credentials")
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrCronJobForbidden is returned when the user may not remove the deployment's cron job
+	ErrCronJobForbidden = errors.New("only the owner of the deployment or an administrator may remove its cron job")
+	// ErrCronJobUnavailable is returned when the deployment has no installed cron job
+	ErrCronJobUnavailable = errors.New("cron job is not available")
+)
+
+// cronJobRunBatchSize bounds how many new runs of a job one collection stores, so a job whose
+// runs were not collected for long catches up over several sweeps
+const cronJobRunBatchSize = 100
+
+// CronJobService collects the runs of cron deployments from the run logs on their targets and
+// removes their crontab entries
+type CronJobService struct {
+	repo    *database.Repository
+	sshCA   *SSHCAService
+	targets *SSHTargetLimiter
+	config  config.CronJobConfig
+	logger  *logrus.Logger
+}
+
+// NewCronJobService creates a new cron job service
+func NewCronJobService(repo *database.Repository, sshCA *SSHCAService, targets *SSHTargetLimiter, cfg config.CronJobConfig, logger *logrus.Logger) *CronJobService {
+	return &CronJobService{
+		repo:    repo,
+		sshCA:   sshCA,
+		targets: targets,
+		config:  cfg,
+		logger:  logger,
+	}
+}
+
+// ListRuns returns the latest limit collected runs of a cron deployment, newest first
+func (s *CronJobService) ListRuns(ctx context.Context, deploymentID uuid.UUID, limit int) ([]*models.CronJobRun, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if deployment.DeploymentType != models.DeploymentTypeCron {
+		return nil, fmt.Errorf("%w: not a cron deployment", ErrCronJobUnavailable)
+	}
+	return repo.GetCronJobRuns(deploymentID, limit)
+}
+
+// RemoveJob removes the crontab entry and the job directory of a cron deployment from its target,
+// after collecting the runs it has not collected yet. The deployment and its runs are kept.
+func (s *CronJobService) RemoveJob(ctx context.Context, userID, deploymentID uuid.UUID) (*models.DeploymentResponse, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := authorizeTargetAccess(repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrCronJobForbidden
+	}
+	name, err := s.installedJob(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dialDeploymentTarget(ctx, s.sshCA, s.targets, deployment, "cron", s.config.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if _, err := s.collect(client, deployment, name); err != nil {
+		s.logger.WithError(err).WithField("deployment_id", deploymentID).Warn("Failed to collect the runs of the cron job before removing it")
+	}
+	remove := "{ " + models.CronJobOtherEntries(name) + "; } | crontab - && rm -rf \"$HOME\"/" + shellquote.Quote(path.Join(models.CronJobDir, name))
+	if output, err := runRemoteCommand(client, remove); err != nil {
+		return nil, fmt.Errorf("failed to remove the cron job from %s: %v, output: %s", deployment.TargetIP, err, output)
+	}
+
+	now := time.Now()
+	if err := repo.MarkCronJobRemoved(deploymentID, now); err != nil {
+		return nil, err
+	}
+	deployment.CronRemovedAt = &now
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"user_id":       userID,
+		"target_ip":     deployment.TargetIP,
+	}).Info("Removed cron job")
+	return toDeploymentResponse(deployment), nil
+}
+
+// installedJob returns the name of the cron job of a deployment, or why the deployment has no job
+// installed on its target
+func (s *CronJobService) installedJob(deployment *models.Deployment) (string, error) {
+	switch {
+	case deployment.DeploymentType != models.DeploymentTypeCron:
+		return "", fmt.Errorf("%w: not a cron deployment", ErrCronJobUnavailable)
+	case deployment.Status != models.DeploymentStatusCompleted:
+		return "", fmt.Errorf("%w: deployment is %s", ErrCronJobUnavailable, deployment.Status)
+	case deployment.CronRemovedAt != nil:
+		return "", fmt.Errorf("%w: the job was removed", ErrCronJobUnavailable)
+	case deployment.OneTimeCredentials:
+		return "", fmt.Errorf("%w: the deployment's credentials were used once and not stored", ErrCronJobUnavailable)
+	case deployment.ContainerName == nil || models.ValidateContainerName(*deployment.ContainerName) != nil:
+		return "", fmt.Errorf("%w: deployment has no valid container name", ErrCronJobUnavailable)
+	}
+
+	latest, err := s.repo.GetLatestCronDeployment(deployment.TargetIP, *deployment.ContainerName)
+	if err != nil {
+		return "", err
+	}
+	if latest != deployment.ID {
+		return "", fmt.Errorf("%w: the job was replaced by a later deployment", ErrCronJobUnavailable)
+	}
+	return *deployment.ContainerName, nil
+}
+
+// Run collects the runs of the installed cron jobs every interval until ctx is cancelled
+func (s *CronJobService) Run(ctx context.Context) {
+	s.logger.WithField("interval", s.config.Interval).Info("Starting cron job run collector")
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("Cron job run collection failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep collects the new runs of every installed cron job and returns how many it stored. Runs
+// are stored once however many servers collect them.
+func (s *CronJobService) Sweep(ctx context.Context) (int, error) {
+	deployments, err := s.repo.GetActiveCronDeployments()
+	if err != nil {
+		return 0, err
+	}
+
+	stored := 0
+	for _, deployment := range deployments {
+		if ctx.Err() != nil {
+			return stored, ctx.Err()
+		}
+		logger := s.logger.WithField("deployment_id", deployment.ID)
+		if deployment.ContainerName == nil || models.ValidateContainerName(*deployment.ContainerName) != nil {
+			continue
+		}
+
+		client, err := dialDeploymentTarget(ctx, s.sshCA, s.targets, deployment, "cron", s.config.ConnectTimeout)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to connect to the target of cron job")
+			continue
+		}
+		count, err := s.collect(client, deployment, *deployment.ContainerName)
+		client.Close()
+		if err != nil {
+			logger.WithError(err).Warn("Failed to collect the runs of cron job")
+		}
+		stored += count
+	}
+	return stored, nil
+}
+
+// collect reads the run log of the job name on the target of deployment and stores the runs after
+// the latest one collected, with the end of their output. Runs logged by earlier deployments of the
+// job that were replaced before their last runs were collected are stored with them.
+func (s *CronJobService) collect(client *ssh.Client, deployment *models.Deployment, name string) (int, error) {
+	dir := "\"$HOME\"/" + shellquote.Quote(path.Join(models.CronJobDir, name))
+	log, err := runRemoteCommand(client, "cd "+dir+" && { cat "+models.CronJobRunLog+" 2>/dev/null || true; }")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the run log: %v, output: %s", err, log)
+	}
+
+	// The run log is appended to, so the runs of each deployment are in order
+	latest := map[uuid.UUID]*time.Time{}
+	owners := map[uuid.UUID]bool{deployment.ID: true}
+	var runs []*models.CronJobRun
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	for scanner.Scan() {
+		run, err := models.ParseCronJobRunLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+		owned, known := owners[run.DeploymentID]
+		if !known {
+			owned = s.ownsJob(run.DeploymentID, deployment)
+			owners[run.DeploymentID] = owned
+		}
+		if !owned {
+			continue
+		}
+		start, ok := latest[run.DeploymentID]
+		if !ok {
+			if start, err = s.repo.GetLatestCronJobRunStart(run.DeploymentID); err != nil {
+				return 0, err
+			}
+			latest[run.DeploymentID] = start
+		}
+		if start == nil || run.StartedAt.After(*start) {
+			runs = append(runs, run)
+		}
+	}
+	if len(runs) > cronJobRunBatchSize {
+		runs = runs[:cronJobRunBatchSize]
+	}
+
+	stored := 0
+	for _, run := range runs {
+		output, truncated, err := s.readOutput(client, dir, run.StartedAt.Unix())
+		if err != nil {
+			return stored, err
+		}
+		run.ID = uuid.New()
+		run.Output = output
+		run.OutputTruncated = truncated
+		run.CollectedAt = time.Now()
+		created, err := s.repo.CreateCronJobRun(run)
+		if err != nil {
+			return stored, err
+		}
+		if created {
+			stored++
+		}
+	}
+	return stored, nil
+}
+
+// ownsJob reports whether the deployment id is an earlier cron deployment of the same job as
+// deployment, which logged runs before deployment replaced it
+func (s *CronJobService) ownsJob(id uuid.UUID, deployment *models.Deployment) bool {
+	earlier, err := s.repo.GetDeployment(id)
+	if err != nil {
+		return false
+	}
+	return earlier.DeploymentType == models.DeploymentTypeCron &&
+		earlier.TargetIP == deployment.TargetIP &&
+		earlier.ContainerName != nil && deployment.ContainerName != nil &&
+		*earlier.ContainerName == *deployment.ContainerName
+}
+
+// readOutput returns the end of the output of the run started at start, and whether it was cut to
+// the configured limit. Outputs the job already pruned are nil.
+func (s *CronJobService) readOutput(client *ssh.Client, dir string, start int64) (*string, bool, error) {
+	file := path.Join(models.CronJobOutputDir, models.CronJobOutputFile(start))
+	limit := strconv.FormatInt(s.config.OutputLimit, 10)
+	cmd := "cd " + dir + " && if [ -f " + file + " ]; then wc -c <" + file + " && tail -c " + limit + " " + file + "; fi"
+	output, err := runRemoteCommand(client, cmd)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read the output of the run: %v, output: %s", err, output)
+	}
+	if output == "" {
+		return nil, false, nil
+	}
+
+	size, content, _ := strings.Cut(output, "\n")
+	total, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+	if err != nil {
+		return nil, false, fmt.Errorf("unexpected output size %q", size)
+	}
+	// The cut may split a character, and containers write whatever bytes they like
+	content = strings.ReplaceAll(strings.ToValidUTF8(content, "\uFFFD"), "\x00", "")
+	return &content, total > s.config.OutputLimit, nil
+}
@@ -3,11 +3,14 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
+	"deployknot/internal/config"
 	"deployknot/internal/database"
 	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -15,35 +18,242 @@ import (
 
 // DeploymentService handles deployment business logic
 type DeploymentService struct {
-	repo   *database.Repository
-	queue  *QueueService
-	logger *logrus.Logger
+	repo        *database.Repository
+	queue       *QueueService
+	encryptor   *encryption.Encryptor
+	quotas      config.QuotaConfig
+	credentials config.CredentialsConfig
+	changelogs  *ChangelogService
+	sshCA       *SSHCAService
+	cache       *DeploymentCache
+	logger      *logrus.Logger
+}
+
+// DefaultStatsWindow is the number of recent finished deployments statistics and estimates are based on
+const DefaultStatsWindow = 20
+
+// QuotaError is returned when creating a deployment would exceed a user's quota
+type QuotaError struct {
+	Message string
+}
+
+func (e *QuotaError) Error() string {
+	return e.Message
+}
+
+// ConcurrencyError is returned when a deployment with the reject policy is created while other
+// deployments of its concurrency group are active
+type ConcurrencyError struct {
+	Group  string
+	Active []uuid.UUID
+}
+
+func (e *ConcurrencyError) Error() string {
+	return fmt.Sprintf("concurrency group %q already has %d active deployment(s)", e.Group, len(e.Active))
+}
+
+// WorkerPoolError is returned when a deployment asks for a worker pool other than the one its
+// project or target requires
+type WorkerPoolError struct {
+	Requested string
+	Required  string
+	// RequiredBy names the project or target that requires the pool
+	RequiredBy string
+}
+
+func (e *WorkerPoolError) Error() string {
+	return fmt.Sprintf("%s requires worker pool %q, not %q", e.RequiredBy, e.Required, e.Requested)
+}
+
+// ProjectAccessError is returned when a deployment names a project of an organization its user is
+// not a member of
+type ProjectAccessError struct {
+	Project string
+}
+
+func (e *ProjectAccessError) Error() string {
+	return fmt.Sprintf("project %q belongs to an organization you are not a member of", e.Project)
+}
+
+// FreezeError is returned when a deployment of a project is created during one of its freeze windows
+type FreezeError struct {
+	Project string
+	Window  models.ProjectFreezeWindowSpec
+}
+
+func (e *FreezeError) Error() string {
+	message := fmt.Sprintf("project %q is frozen until %s", e.Project, e.Window.EndsAt.UTC().Format(time.RFC3339))
+	if e.Window.Reason != "" {
+		message += ": " + e.Window.Reason
+	}
+	return message
 }
 
 // NewDeploymentService creates a new deployment service
-func NewDeploymentService(repo *database.Repository, queue *QueueService, logger *logrus.Logger) *DeploymentService {
+func NewDeploymentService(repo *database.Repository, queue *QueueService, encryptor *encryption.Encryptor, quotas config.QuotaConfig, credentials config.CredentialsConfig, changelogs *ChangelogService, sshCA *SSHCAService, cache *DeploymentCache, logger *logrus.Logger) *DeploymentService {
 	return &DeploymentService{
-		repo:   repo,
-		queue:  queue,
-		logger: logger,
+		repo:        repo,
+		queue:       queue,
+		encryptor:   encryptor,
+		quotas:      quotas,
+		credentials: credentials,
+		changelogs:  changelogs,
+		sshCA:       sshCA,
+		cache:       cache,
+		logger:      logger,
 	}
 }
 
 // CreateDeployment creates a new deployment
 func (s *DeploymentService) CreateDeployment(ctx context.Context, req *models.CreateDeploymentRequest) (*models.DeploymentResponse, error) {
+	return s.createDeployment(ctx, req, "", nil)
+}
+
+// CreateDeploymentWithEnvFile creates a new deployment and handles env_file uploads
+func (s *DeploymentService) CreateDeploymentWithEnvFile(ctx context.Context, req *models.CreateDeploymentRequest, envFilePath string, userID uuid.UUID) (*models.DeploymentResponse, error) {
+	return s.createDeployment(ctx, req, envFilePath, &userID)
+}
+
+// createDeployment stores a new deployment with its initial steps and enqueues the deployment job
+func (s *DeploymentService) createDeployment(ctx context.Context, req *models.CreateDeploymentRequest, envFilePath string, userID *uuid.UUID) (*models.DeploymentResponse, error) {
+	var organizationID *uuid.UUID
+	if userID != nil {
+		if err := s.checkQuota(*userID); err != nil {
+			return nil, err
+		}
+
+		org, err := s.repo.GetUserOrganization(*userID)
+		if err != nil {
+			return nil, err
+		}
+		if org != nil {
+			organizationID = &org.ID
+		}
+	}
+	if err := s.checkProjectAccess(req, organizationID); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkSSHCredentials(ctx, req); err != nil {
+		return nil, err
+	}
+
 	// Convert port string to int
-	port, err := req.GetPortAsInt()
+	port, err := resolvePort(req)
 	if err != nil {
 		return nil, fmt.Errorf("invalid port: %w", err)
 	}
 
+	deploymentType := req.GetDeploymentType()
+	targetType := req.GetTargetType()
+	scriptPath, scriptContent := resolveScript(req)
+	var repoSubdirectory *string
+	if subdirectory := req.GetRepoSubdirectory(); subdirectory != "" {
+		repoSubdirectory = &subdirectory
+	}
+	var commitSHA *string
+	if req.CommitSHA != nil && *req.CommitSHA != "" {
+		commitSHA = req.CommitSHA
+	}
+	var gpus *string
+	if req.GPUs != nil && *req.GPUs != "" {
+		gpus = req.GPUs
+	}
+	var extraRunArgs *string
+	if req.ExtraRunArgs != nil && strings.TrimSpace(*req.ExtraRunArgs) != "" {
+		args, err := models.ParseExtraRunArgs(*req.ExtraRunArgs)
+		if err != nil {
+			return nil, err
+		}
+		normalized := models.FormatRunArgs(args)
+		extraRunArgs = &normalized
+	}
+	var managedServices *string
+	var managedEnv string
+	if req.ManagedServices != nil && strings.TrimSpace(*req.ManagedServices) != "" {
+		names, err := models.ParseManagedServiceNames(*req.ManagedServices)
+		if err != nil {
+			return nil, err
+		}
+		managedEnv, err = s.managedServiceEnv(userID, req.TargetIP, names)
+		if err != nil {
+			return nil, err
+		}
+		joined := strings.Join(names, ",")
+		managedServices = &joined
+	}
+
+	var cronSchedule *string
+	if deploymentType == models.DeploymentTypeCron && req.CronSchedule != nil {
+		schedule := strings.Join(strings.Fields(*req.CronSchedule), " ")
+		cronSchedule = &schedule
+	}
+
+	workerPool, err := s.resolveWorkerPool(req)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate deployment ID
 	deploymentID := uuid.New()
 	now := time.Now()
 
+	if err := s.checkFreeze(req, now); err != nil {
+		return nil, err
+	}
+	gates, err := s.requiredGates(req, deploymentID, now)
+	if err != nil {
+		return nil, err
+	}
+	if req.Release != nil && req.Release.WaitUntil != nil {
+		gates = append(gates, &models.DeploymentGate{
+			DeploymentID: deploymentID,
+			Name:         models.ApplicationReleaseGate,
+			Status:       models.GateStatusWaiting,
+			ExpiresAt:    *req.Release.WaitUntil,
+			CreatedAt:    now,
+		})
+	}
+
+	concurrencyGroup := req.GetConcurrencyGroup()
+	if err := s.applyConcurrencyPolicy(ctx, deploymentID, concurrencyGroup, req.GetConcurrencyPolicy(), organizationID, userID); err != nil {
+		return nil, err
+	}
+
 	// Generate container name if not provided
 	containerName := s.generateContainerName(deploymentID, req.ContainerName, req.ProjectName, req.DeploymentName)
 
+	// Kubernetes credentials are only ever stored and queued encrypted
+	var kubeconfigEncrypted, namespace *string
+	if targetType == models.TargetTypeKubernetes {
+		encrypted, err := s.encryptor.Encrypt(req.Kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt kubeconfig: %w", err)
+		}
+		kubeconfigEncrypted = &encrypted
+		ns := req.GetKubernetesNamespace()
+		namespace = &ns
+	}
+
+	// One-time credentials are only sealed into the job; the deployment record keeps none
+	sshPassword, githubPAT, storedKubeconfig := &req.SSHPassword, &req.GitHubPAT, kubeconfigEncrypted
+	var sealedCredentials string
+	if req.OneTimeCredentials {
+		credentials := &oneTimeCredentials{
+			SSHPassword: req.SSHPassword,
+			GitHubPAT:   req.GitHubPAT,
+			ExpiresAt:   now.Add(s.credentials.OneTimeTTL),
+		}
+		if kubeconfigEncrypted != nil {
+			credentials.KubeconfigEncrypted = *kubeconfigEncrypted
+		}
+		sealedCredentials, err = sealOneTimeCredentials(s.encryptor, credentials)
+		if err != nil {
+			return nil, err
+		}
+		sshPassword, githubPAT, storedKubeconfig = nil, nil, nil
+	}
+
 	// Create deployment record (no env vars stored in DB)
 	deployment := &models.Deployment{
 		ID:                   deploymentID,
@@ -52,25 +262,40 @@ func (s *DeploymentService) CreateDeployment(ctx context.Context, req *models.Cr
 		Status:               models.DeploymentStatusPending,
 		TargetIP:             req.TargetIP,
 		SSHUsername:          req.SSHUsername,
-		SSHPasswordEncrypted: &req.SSHPassword,
+		SSHPasswordEncrypted: sshPassword,
 		GitHubRepoURL:        req.GitHubRepoURL,
-		GitHubPATEncrypted:   &req.GitHubPAT,
+		GitHubPATEncrypted:   githubPAT,
 		GitHubBranch:         req.GitHubBranch,
 		Port:                 port,
 		ContainerName:        &containerName,
 		ProjectName:          req.ProjectName,
 		DeploymentName:       req.DeploymentName,
 		AdditionalVars:       req.AdditionalVars,
+		UserID:               userID,
+		DeploymentType:       deploymentType,
+		ScriptPath:           scriptPath,
+		ScriptContent:        scriptContent,
+		TargetType:           targetType,
+		KubeconfigEncrypted:  storedKubeconfig,
+		KubernetesNamespace:  namespace,
+		Image:                req.Image,
+		ManifestsPath:        req.ManifestsPath,
+		OrganizationID:       organizationID,
+		RepoSubdirectory:     repoSubdirectory,
+		GitLFS:               req.GitLFS,
+		ConcurrencyGroup:     &concurrencyGroup,
+		OneTimeCredentials:   req.OneTimeCredentials,
+		WorkerPool:           workerPool,
+		GPUs:                 gpus,
+		ExtraRunArgs:         extraRunArgs,
+		ScheduleID:           req.ScheduleID,
+		CommitSHA:            commitSHA,
+		ManagedServices:      managedServices,
+		CronSchedule:         cronSchedule,
 	}
-
-	// Save to database
-	if err := s.repo.CreateDeployment(deployment); err != nil {
-		return nil, fmt.Errorf("failed to create deployment: %w", err)
-	}
-
-	// Create initial deployment steps
-	if err := s.createInitialSteps(deploymentID); err != nil {
-		s.logger.WithError(err).Error("Failed to create initial deployment steps")
+	if req.Release != nil {
+		deployment.ApplicationReleaseID = &req.Release.ReleaseID
+		deployment.ApplicationService = &req.Release.Service
 	}
 
 	// Enqueue deployment job
@@ -86,170 +311,522 @@ func (s *DeploymentService) CreateDeployment(ctx context.Context, req *models.Cr
 		"project_name":    req.ProjectName,
 		"deployment_name": req.DeploymentName,
 		"additional_vars": req.AdditionalVars,
+		"deployment_type": string(deploymentType),
+		"target_type":     string(targetType),
+		"concurrency_key": models.ConcurrencyKey(concurrencyGroup, organizationID, userID),
+	}
+	if envFilePath != "" {
+		deploymentData["env_file_path"] = envFilePath
+	}
+	if scriptPath != nil {
+		deploymentData["script_path"] = *scriptPath
+	}
+	if scriptContent != nil {
+		deploymentData["script_content"] = *scriptContent
+	}
+	if repoSubdirectory != nil {
+		deploymentData["repo_subdirectory"] = *repoSubdirectory
+	}
+	if commitSHA != nil {
+		deploymentData["commit_sha"] = *commitSHA
+	}
+	if req.GitLFS {
+		deploymentData["git_lfs"] = true
+	}
+	if gpus != nil {
+		deploymentData["gpus"] = *gpus
+	}
+	if extraRunArgs != nil {
+		deploymentData["extra_run_args"] = *extraRunArgs
+	}
+	if req.Release != nil {
+		deploymentData["network"] = req.Release.Network
+		deploymentData["network_alias"] = req.Release.Service
+		if req.Release.EnvironmentVars != "" {
+			deploymentData["environment_vars"] = req.Release.EnvironmentVars
+		}
+		if len(req.Release.DependsOn) > 0 {
+			dependsOn := make([]string, len(req.Release.DependsOn))
+			for i, dependency := range req.Release.DependsOn {
+				dependsOn[i] = dependency.String()
+			}
+			deploymentData["depends_on"] = dependsOn
+		}
+	}
+	if managedEnv != "" {
+		deploymentData["managed_environment_vars"] = managedEnv
+	}
+	if cronSchedule != nil {
+		deploymentData["cron_schedule"] = *cronSchedule
+	}
+	if req.Managed != nil {
+		deploymentData["managed_engine"] = string(req.Managed.Engine)
+		deploymentData["managed_version"] = req.Managed.Version
+		deploymentData["managed_volume"] = req.Managed.Volume
+		deploymentData["environment_vars"] = req.Managed.EnvironmentVars
+	}
+	if req.OneTimeCredentials {
+		delete(deploymentData, "ssh_password")
+		delete(deploymentData, "github_pat")
+		deploymentData[oneTimeCredentialsKey] = sealedCredentials
+	}
+	if targetType == models.TargetTypeKubernetes {
+		if !req.OneTimeCredentials {
+			deploymentData["kubeconfig_encrypted"] = *kubeconfigEncrypted
+		}
+		deploymentData["kubernetes_namespace"] = *namespace
+		if req.Image != nil {
+			deploymentData["image"] = *req.Image
+		}
+		if req.ManifestsPath != nil {
+			deploymentData["manifests_path"] = *req.ManifestsPath
+		}
+		policy, keys, err := s.imageSigning(req)
+		if err != nil {
+			return nil, err
+		}
+		if policy != models.ImageSignatureOff {
+			deploymentData["image_signature_policy"] = string(policy)
+			deploymentData["image_signing_keys"] = keys
+		}
 	}
 
-	if err := s.queue.EnqueueDeploymentJob(ctx, deploymentID, deploymentData); err != nil {
-		s.logger.WithError(err).Error("Failed to enqueue deployment job")
+	// Record the deployment, its steps and its job atomically, then publish the job right away;
+	// if Redis is unavailable the outbox publisher enqueues it once Redis is back. The job of a
+	// deployment with gates is held until they have all passed.
+	job := NewDeploymentJob(deploymentID, deploymentData)
+	if workerPool != nil {
+		job.Pool = *workerPool
+	}
+	entry, err := newOutboxEntry(s.encryptor, job)
+	if err != nil {
+		return nil, err
+	}
+	entry.Held = len(gates) > 0
+	if err := s.repo.CreateDeploymentWithJob(deployment, initialSteps(deploymentID, stepsFor(targetType, deploymentType)), gates, entry); err != nil {
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+	deferred := false
+	if entry.Held {
+		names := make([]string, len(gates))
+		for i, gate := range gates {
+			names[i] = gate.Name
+		}
+		message := fmt.Sprintf("Waiting for gates: %s", strings.Join(names, ", "))
+		if err := s.AddDeploymentLog(ctx, deploymentID, "info", message, "gates", nil); err != nil {
+			s.logger.WithError(err).Warn("Failed to log deployment gates")
+		}
+	} else {
+		deferred = !s.publishJob(ctx, entry.ID, job)
 	}
+	superseded := s.supersedePendingDeployments(ctx, deployment)
+	s.changelogs.Record(ctx, deployment, req.GitHubPAT)
 
 	// Log the deployment creation
 	s.logger.WithFields(logrus.Fields{
-		"deployment_id": deploymentID,
-		"target_ip":     req.TargetIP,
-		"repo_url":      req.GitHubRepoURL,
-		"branch":        req.GitHubBranch,
+		"deployment_id":    deploymentID,
+		"user_id":          userID,
+		"target_type":      targetType,
+		"target_ip":        req.TargetIP,
+		"repo_url":         req.GitHubRepoURL,
+		"branch":           req.GitHubBranch,
+		"worker_pool":      job.Pool,
+		"enqueue_deferred": deferred,
+		"gates":            len(gates),
 	}).Info("Deployment created and enqueued successfully")
 
 	// Return response
 	response := &models.DeploymentResponse{
-		ID:             deploymentID,
-		Status:         models.DeploymentStatusPending,
-		TargetIP:       req.TargetIP,
-		GitHubRepoURL:  req.GitHubRepoURL,
-		GitHubBranch:   req.GitHubBranch,
-		Port:           port,
-		ContainerName:  &containerName,
-		CreatedAt:      now,
-		ProjectName:    req.ProjectName,
-		DeploymentName: req.DeploymentName,
+		ID:                 deploymentID,
+		Status:             models.DeploymentStatusPending,
+		TargetIP:           req.TargetIP,
+		GitHubRepoURL:      req.GitHubRepoURL,
+		GitHubBranch:       req.GitHubBranch,
+		Port:               port,
+		ContainerName:      &containerName,
+		CreatedAt:          now,
+		ProjectName:        req.ProjectName,
+		DeploymentName:     req.DeploymentName,
+		DeploymentType:     deploymentType,
+		ScriptPath:         scriptPath,
+		TargetType:         targetType,
+		Namespace:          namespace,
+		Image:              req.Image,
+		ManifestsPath:      req.ManifestsPath,
+		UserID:             userID,
+		RepoSubdirectory:   repoSubdirectory,
+		GitLFS:             req.GitLFS,
+		ConcurrencyGroup:   &concurrencyGroup,
+		OneTimeCredentials: req.OneTimeCredentials,
+		WorkerPool:         workerPool,
+		GPUs:               gpus,
+		ExtraRunArgs:       extraRunArgs,
+		ScheduleID:         req.ScheduleID,
+		CommitSHA:          commitSHA,
+		ManagedServices:    managedServices,
+		CronSchedule:       cronSchedule,
+	}
+	if req.Release != nil {
+		response.ApplicationReleaseID = deployment.ApplicationReleaseID
+		response.ApplicationService = deployment.ApplicationService
+	}
+
+	progress := 0
+	response.Progress = &progress
+	response.EnqueueDeferred = deferred
+	response.Superseded = superseded
+	response.Gates = gates
+	if userID != nil {
+		response.EstimatedDurationSeconds = s.estimateDuration(*userID, req.ProjectKey())
 	}
 
 	return response, nil
 }
 
-// CreateDeploymentWithEnvFile creates a new deployment and handles env_file uploads
-func (s *DeploymentService) CreateDeploymentWithEnvFile(ctx context.Context, req *models.CreateDeploymentRequest, envFilePath string, userID uuid.UUID) (*models.DeploymentResponse, error) {
-	// Convert port string to int
-	port, err := req.GetPortAsInt()
-	if err != nil {
-		return nil, fmt.Errorf("invalid port: %w", err)
+// resolveWorkerPool returns the worker pool a deployment runs on: the pool required by the project
+// target it deploys to, else the pool required by its project, else the requested one. Nil means
+// the default pool.
+func (s *DeploymentService) resolveWorkerPool(req *models.CreateDeploymentRequest) (*string, error) {
+	requested := ""
+	if req.WorkerPool != nil {
+		requested = strings.TrimSpace(*req.WorkerPool)
 	}
 
-	// Generate deployment ID
-	deploymentID := uuid.New()
-	now := time.Now()
+	required, requiredBy := "", ""
+	if req.ProjectName != nil && *req.ProjectName != "" {
+		project, err := s.repo.GetProjectByName(*req.ProjectName)
+		if err != nil {
+			return nil, err
+		}
+		if project != nil {
+			targets, err := s.repo.GetProjectTargets(project.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, target := range targets {
+				if target.WorkerPool != "" && targetMatches(target, req) {
+					required, requiredBy = target.WorkerPool, fmt.Sprintf("target %q of project %q", target.Name, project.Name)
+					break
+				}
+			}
+			if required == "" && project.WorkerPool != nil {
+				required, requiredBy = *project.WorkerPool, fmt.Sprintf("project %q", project.Name)
+			}
+		}
+	}
 
-	// Generate container name if not provided
-	containerName := s.generateContainerName(deploymentID, req.ContainerName, req.ProjectName, req.DeploymentName)
+	switch {
+	case required != "" && requested != "" && requested != required:
+		return nil, &WorkerPoolError{Requested: requested, Required: required, RequiredBy: requiredBy}
+	case required != "":
+		return &required, nil
+	case requested != "":
+		return &requested, nil
+	}
+	return nil, nil
+}
 
-	// Create deployment record (no env vars stored in DB)
-	deployment := &models.Deployment{
-		ID:                   deploymentID,
-		CreatedAt:            now,
-		UpdatedAt:            now,
-		Status:               models.DeploymentStatusPending,
-		TargetIP:             req.TargetIP,
-		SSHUsername:          req.SSHUsername,
-		SSHPasswordEncrypted: &req.SSHPassword,
-		GitHubRepoURL:        req.GitHubRepoURL,
-		GitHubPATEncrypted:   &req.GitHubPAT,
-		GitHubBranch:         req.GitHubBranch,
-		Port:                 port,
-		ContainerName:        &containerName,
-		ProjectName:          req.ProjectName,
-		DeploymentName:       req.DeploymentName,
-		AdditionalVars:       req.AdditionalVars,
-		UserID:               &userID,
+// checkProjectAccess rejects a deployment under the name of a project of another organization, so
+// the project's status page and badge only show deployments of its organization's members.
+// Projects without an organization may be deployed by anyone.
+func (s *DeploymentService) checkProjectAccess(req *models.CreateDeploymentRequest, organizationID *uuid.UUID) error {
+	if req.ProjectName == nil || *req.ProjectName == "" {
+		return nil
 	}
+	project, err := s.repo.GetProjectByName(*req.ProjectName)
+	if err != nil || project == nil || project.OrganizationID == nil {
+		return err
+	}
+	if organizationID == nil || *organizationID != *project.OrganizationID {
+		return &ProjectAccessError{Project: project.Name}
+	}
+	return nil
+}
 
-	// Save to database
-	if err := s.repo.CreateDeployment(deployment); err != nil {
-		return nil, fmt.Errorf("failed to create deployment: %w", err)
+// checkFreeze rejects a deployment of a project during one of the project's freeze windows
+func (s *DeploymentService) checkFreeze(req *models.CreateDeploymentRequest, now time.Time) error {
+	if req.ProjectName == nil || *req.ProjectName == "" {
+		return nil
+	}
+	project, err := s.repo.GetProjectByName(*req.ProjectName)
+	if err != nil || project == nil {
+		return err
 	}
+	window, err := s.repo.GetActiveProjectFreezeWindow(project.ID, now)
+	if err != nil || window == nil {
+		return err
+	}
+	return &FreezeError{Project: project.Name, Window: *window}
+}
 
-	// Create initial deployment steps
-	if err := s.createInitialSteps(deploymentID); err != nil {
-		s.logger.WithError(err).Error("Failed to create initial deployment steps")
+// imageSigning returns the image signature policy of a deployment's project and the public keys
+// its images are verified with, which travel with the job so workers need no database access
+func (s *DeploymentService) imageSigning(req *models.CreateDeploymentRequest) (models.ImageSignaturePolicy, []string, error) {
+	if req.ProjectName == nil || *req.ProjectName == "" {
+		return models.ImageSignatureOff, nil, nil
+	}
+	project, err := s.repo.GetProjectByName(*req.ProjectName)
+	if err != nil || project == nil || project.ImageSignaturePolicy == models.ImageSignatureOff {
+		return models.ImageSignatureOff, nil, err
 	}
+	signingKeys, err := s.repo.ListProjectSigningKeys(project.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	keys := make([]string, len(signingKeys))
+	for i, key := range signingKeys {
+		keys[i] = key.PublicKey
+	}
+	return project.ImageSignaturePolicy, keys, nil
+}
 
-	// Enqueue deployment job
-	deploymentData := map[string]interface{}{
-		"target_ip":       req.TargetIP,
-		"ssh_username":    req.SSHUsername,
-		"ssh_password":    req.SSHPassword,
-		"github_repo_url": req.GitHubRepoURL,
-		"github_pat":      req.GitHubPAT,
-		"github_branch":   req.GitHubBranch,
-		"port":            port,
-		"container_name":  containerName,
-		"project_name":    req.ProjectName,
-		"deployment_name": req.DeploymentName,
-		"additional_vars": req.AdditionalVars,
+// requiredGates returns the gates a new deployment of a project waits for, one for each gate of the
+// project, expiring after the gate's timeout
+func (s *DeploymentService) requiredGates(req *models.CreateDeploymentRequest, deploymentID uuid.UUID, now time.Time) ([]*models.DeploymentGate, error) {
+	if req.ProjectName == nil || *req.ProjectName == "" {
+		return nil, nil
 	}
-	if envFilePath != "" {
-		deploymentData["env_file_path"] = envFilePath
+	project, err := s.repo.GetProjectByName(*req.ProjectName)
+	if err != nil || project == nil {
+		return nil, err
+	}
+	specs, err := s.repo.GetProjectGates(project.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.queue.EnqueueDeploymentJob(ctx, deploymentID, deploymentData); err != nil {
-		s.logger.WithError(err).Error("Failed to enqueue deployment job")
+	gates := make([]*models.DeploymentGate, len(specs))
+	for i, spec := range specs {
+		gates[i] = &models.DeploymentGate{
+			DeploymentID: deploymentID,
+			Name:         spec.Name,
+			Status:       models.GateStatusWaiting,
+			ExpiresAt:    now.Add(time.Duration(spec.TimeoutMinutes) * time.Minute),
+			CreatedAt:    now,
+		}
 	}
+	return gates, nil
+}
 
-	// Log the deployment creation
-	s.logger.WithFields(logrus.Fields{
-		"deployment_id": deploymentID,
-		"user_id":       userID,
-		"target_ip":     req.TargetIP,
-		"repo_url":      req.GitHubRepoURL,
-		"branch":        req.GitHubBranch,
-	}).Info("Deployment created and enqueued successfully")
+// targetMatches reports whether a deployment request deploys to a project target
+func targetMatches(target models.ProjectTargetSpec, req *models.CreateDeploymentRequest) bool {
+	if req.GetTargetType() == models.TargetTypeKubernetes {
+		return target.TargetType == models.TargetTypeKubernetes && target.KubernetesNamespace == req.GetKubernetesNamespace()
+	}
+	return target.TargetType != models.TargetTypeKubernetes && target.TargetIP == req.TargetIP
+}
 
-	// Return response
-	response := &models.DeploymentResponse{
-		ID:             deploymentID,
-		Status:         models.DeploymentStatusPending,
-		TargetIP:       req.TargetIP,
-		GitHubRepoURL:  req.GitHubRepoURL,
-		GitHubBranch:   req.GitHubBranch,
-		Port:           port,
-		ContainerName:  &containerName,
-		CreatedAt:      now,
-		ProjectName:    req.ProjectName,
-		DeploymentName: req.DeploymentName,
+// applyConcurrencyPolicy enforces the policy of a new deployment against the active deployments of
+// its concurrency group. Queued deployments are held back by the worker, so nothing happens here.
+func (s *DeploymentService) applyConcurrencyPolicy(ctx context.Context, deploymentID uuid.UUID, group string, policy models.ConcurrencyPolicy, organizationID, userID *uuid.UUID) error {
+	switch policy {
+	case models.ConcurrencyReject:
+		active, err := s.repo.GetActiveDeploymentsInGroup(group, organizationID, userID)
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			return &ConcurrencyError{Group: group, Active: active}
+		}
+	case models.ConcurrencyReplace:
+		reason := fmt.Sprintf("Cancelled: replaced by deployment %s in concurrency group %q", deploymentID, group)
+		cancelled, err := s.repo.CancelActiveDeploymentsInGroup(group, organizationID, userID, reason)
+		if err != nil {
+			return err
+		}
+		for _, id := range cancelled {
+			s.cache.Invalidate(ctx, id)
+			if err := s.AddDeploymentLog(ctx, id, "warn", reason, "concurrency", nil); err != nil {
+				s.logger.WithError(err).Warn("Failed to log deployment cancellation")
+			}
+		}
+		if len(cancelled) > 0 {
+			s.logger.WithFields(logrus.Fields{
+				"deployment_id":     deploymentID,
+				"concurrency_group": group,
+				"cancelled":         cancelled,
+			}).Info("Cancelled active deployments replaced by a new deployment")
+		}
 	}
+	return nil
+}
 
-	return response, nil
+// supersedePendingDeployments cancels the older deployments of the same project, branch and target
+// still waiting in the queue, since the new deployment makes them redundant. The worker skips their
+// jobs. Failures are logged only: the new deployment has been created either way.
+func (s *DeploymentService) supersedePendingDeployments(ctx context.Context, deployment *models.Deployment) []uuid.UUID {
+	reason := fmt.Sprintf("Superseded by newer deployment %s", deployment.ID)
+	superseded, err := s.repo.SupersedePendingDeployments(deployment, reason)
+	if err != nil {
+		s.logger.WithError(err).WithField("deployment_id", deployment.ID).Warn("Failed to supersede pending deployments")
+		return nil
+	}
+	for _, id := range superseded {
+		s.cache.Invalidate(ctx, id)
+		if err := s.AddDeploymentLog(ctx, id, "warn", reason, "superseded", nil); err != nil {
+			s.logger.WithError(err).Warn("Failed to log deployment superseding")
+		}
+	}
+	if len(superseded) > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"deployment_id": deployment.ID,
+			"superseded":    superseded,
+		}).Info("Superseded pending deployments")
+	}
+	return superseded
+}
+
+// publishJob pushes a freshly recorded job onto the queue and marks its outbox entry published.
+// It reports false when the job was left in the outbox for the publisher.
+func (s *DeploymentService) publishJob(ctx context.Context, entryID uuid.UUID, job *Job) bool {
+	published, err := s.repo.PublishOutboxEntry(entryID, func(*models.OutboxEntry) error {
+		return s.queue.EnqueueJob(ctx, job)
+	})
+	if err != nil {
+		s.logger.WithError(err).WithField("deployment_id", job.DeploymentID).Warn("Failed to enqueue deployment job, leaving it in the outbox")
+		return false
+	}
+	return published
 }
 
 // GetDeployment retrieves a deployment by ID
 func (s *DeploymentService) GetDeployment(ctx context.Context, id uuid.UUID) (*models.DeploymentResponse, error) {
-	deployment, err := s.repo.GetDeployment(id)
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment: %w", err)
 	}
 
-	// Convert to response format
-	response := &models.DeploymentResponse{
-		ID:             deployment.ID,
-		Status:         deployment.Status,
-		TargetIP:       deployment.TargetIP,
-		GitHubRepoURL:  deployment.GitHubRepoURL,
-		GitHubBranch:   deployment.GitHubBranch,
-		Port:           deployment.Port,
-		ContainerName:  deployment.ContainerName,
-		CreatedAt:      deployment.CreatedAt,
-		StartedAt:      deployment.StartedAt,
-		CompletedAt:    deployment.CompletedAt,
-		ErrorMessage:   deployment.ErrorMessage,
-		ProjectName:    deployment.ProjectName,
-		DeploymentName: deployment.DeploymentName,
+	response := toDeploymentResponse(deployment)
+
+	progress, err := s.deploymentProgress(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+	response.Progress = &progress
+
+	response.Gates, err = repo.GetDeploymentGates(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if deployment.ProjectName != nil {
+		response.Contacts, err = repo.GetProjectContacts(*deployment.ProjectName, time.Now())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return response, nil
 }
 
-// GetDeploymentLogs retrieves logs for a deployment
-func (s *DeploymentService) GetDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, limit int) ([]*models.DeploymentLog, error) {
-	logs, err := s.repo.GetDeploymentLogs(deploymentID, limit)
+// GetDeploymentDetail retrieves a deployment together with its steps and its latest logLimit logs
+func (s *DeploymentService) GetDeploymentDetail(ctx context.Context, id uuid.UUID, logLimit int) (*models.DeploymentDetail, error) {
+	deployment, err := s.GetDeployment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	steps, err := repo.GetDeploymentSteps(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment steps: %w", err)
+	}
+	if steps == nil {
+		steps = []*models.DeploymentStep{}
+	}
+
+	logs, err := repo.GetLatestDeploymentLogs(id, logLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment logs: %w", err)
+	}
+
+	comments, err := repo.GetDeploymentComments(id)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.DeploymentDetail{
+		Deployment: deployment,
+		Steps:      steps,
+		Logs:       logs,
+		Comments:   comments,
+	}
+	if len(logs) > 0 {
+		detail.NextAfterSeq = logs[len(logs)-1].Seq
+	}
+
+	return detail, nil
+}
+
+// GetDeploymentLogPage retrieves the page of logs for a deployment selected by filter that follows
+// afterSeq. Logs are read from the read replica, so that clients following a deployment's logs do
+// not load the primary the deployment writes to.
+func (s *DeploymentService) GetDeploymentLogPage(ctx context.Context, deploymentID uuid.UUID, afterSeq int64, pageSize int, filter models.DeploymentLogFilter) (*models.DeploymentLogPage, error) {
+	repo, release, err := s.repo.Replica().Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	page, err := repo.GetDeploymentLogPage(deploymentID, afterSeq, pageSize, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment logs: %w", err)
 	}
 
-	return logs, nil
+	return page, nil
 }
 
 // GetDeploymentSteps retrieves steps for a deployment
 func (s *DeploymentService) GetDeploymentSteps(ctx context.Context, deploymentID uuid.UUID) ([]*models.DeploymentStep, error) {
-	steps, err := s.repo.GetDeploymentSteps(deploymentID)
+	return s.getDeploymentSteps(ctx, s.repo, deploymentID)
+}
+
+// ListDeploymentSteps retrieves steps for a deployment for showing them, from the deployment cache
+// or else the read replica. The steps may lag behind the primary; the worker updating them uses
+// GetDeploymentSteps.
+func (s *DeploymentService) ListDeploymentSteps(ctx context.Context, deploymentID uuid.UUID) ([]*models.DeploymentStep, error) {
+	field := scopedField(ctx, "steps")
+	var steps []*models.DeploymentStep
+	if s.cache.get(ctx, deploymentID, field, &steps) {
+		return steps, nil
+	}
+	steps, err := s.getDeploymentSteps(ctx, s.displayRepo(), deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.set(ctx, deploymentID, field, steps)
+	return steps, nil
+}
+
+// displayRepo returns the repository that the state shown to users is read from: the read replica,
+// unless the deployment cache is enabled. The cache is then filled from the primary, as a fill from
+// a lagging replica right after an invalidation would keep the old state cached.
+func (s *DeploymentService) displayRepo() *database.Repository {
+	if s.cache.enabled() {
+		return s.repo
+	}
+	return s.repo.Replica()
+}
+
+func (s *DeploymentService) getDeploymentSteps(ctx context.Context, repo *database.Repository, deploymentID uuid.UUID) ([]*models.DeploymentStep, error) {
+	repo, release, err := repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	steps, err := repo.GetDeploymentSteps(deploymentID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployment steps: %w", err)
 	}
@@ -257,11 +834,103 @@ func (s *DeploymentService) GetDeploymentSteps(ctx context.Context, deploymentID
 	return steps, nil
 }
 
+// AddDeploymentComment stores a comment by userID on a deployment. Only @mentions of existing users are recorded.
+func (s *DeploymentService) AddDeploymentComment(ctx context.Context, deploymentID, userID uuid.UUID, body string) (*models.DeploymentComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("comment body is required")
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := repo.GetDeployment(deploymentID); err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	user, err := repo.GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	mentions, err := repo.GetExistingUsernames(models.ParseMentions(body))
+	if err != nil {
+		return nil, err
+	}
+	if mentions == nil {
+		mentions = []string{}
+	}
+
+	comment := &models.DeploymentComment{
+		ID:           uuid.New(),
+		DeploymentID: deploymentID,
+		UserID:       &userID,
+		Username:     user.Username,
+		Body:         body,
+		Mentions:     mentions,
+		CreatedAt:    time.Now(),
+	}
+	if err := repo.CreateDeploymentComment(comment); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"comment_id":    comment.ID,
+		"user_id":       userID,
+		"mentions":      mentions,
+	}).Info("Deployment comment added")
+
+	return comment, nil
+}
+
+// GetDeploymentComments retrieves the comments on a deployment, oldest first
+func (s *DeploymentService) GetDeploymentComments(ctx context.Context, deploymentID uuid.UUID) ([]*models.DeploymentComment, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := repo.GetDeployment(deploymentID); err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	return repo.GetDeploymentComments(deploymentID)
+}
+
+// GetDeploymentChangelog retrieves the commits a deployment ships since the last completed
+// deployment of its environment
+func (s *DeploymentService) GetDeploymentChangelog(ctx context.Context, deploymentID uuid.UUID) (*models.DeploymentChangelog, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if _, err := repo.GetDeployment(deploymentID); err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	changelog, err := repo.GetDeploymentChangelog(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if changelog == nil {
+		return nil, ErrChangelogNotFound
+	}
+	return changelog, nil
+}
+
 // UpdateDeploymentStatus updates the deployment status
 func (s *DeploymentService) UpdateDeploymentStatus(ctx context.Context, deploymentID uuid.UUID, status models.DeploymentStatus, errorMessage *string) error {
 	if err := s.repo.UpdateDeploymentStatus(deploymentID, status, errorMessage); err != nil {
 		return fmt.Errorf("failed to update deployment status: %w", err)
 	}
+	s.cache.Invalidate(ctx, deploymentID)
 
 	s.logger.WithFields(logrus.Fields{
 		"deployment_id": deploymentID,
@@ -272,8 +941,9 @@ func (s *DeploymentService) UpdateDeploymentStatus(ctx context.Context, deployme
 	return nil
 }
 
-// AddDeploymentLog adds a log entry to a deployment
-func (s *DeploymentService) AddDeploymentLog(ctx context.Context, deploymentID uuid.UUID, level, message, taskName string, stepOrder *int) error {
+// AddDeploymentLog adds a free-text log entry to a deployment; its category follows from the task
+func (s *DeploymentService) AddDeploymentLog(ctx context.Context, deploymentID uuid.UUID, level models.LogLevel, message, taskName string, stepOrder *int) error {
+	category := models.LogCategoryForTask(taskName)
 	log := &models.DeploymentLog{
 		ID:           uuid.New(),
 		DeploymentID: deploymentID,
@@ -282,6 +952,31 @@ func (s *DeploymentService) AddDeploymentLog(ctx context.Context, deploymentID u
 		Message:      message,
 		TaskName:     &taskName,
 		StepOrder:    stepOrder,
+		Category:     &category,
+	}
+
+	if err := s.repo.CreateDeploymentLog(log); err != nil {
+		return fmt.Errorf("failed to create deployment log: %w", err)
+	}
+
+	return nil
+}
+
+// AddDeploymentEvent adds a log entry for an event code to a deployment. The entry's level and
+// category are the code's, and its message is the code's English template filled in with params.
+func (s *DeploymentService) AddDeploymentEvent(ctx context.Context, deploymentID uuid.UUID, code models.LogEventCode, params map[string]string, taskName string, stepOrder *int) error {
+	event := code.Event()
+	log := &models.DeploymentLog{
+		ID:           uuid.New(),
+		DeploymentID: deploymentID,
+		CreatedAt:    time.Now(),
+		LogLevel:     event.Level,
+		Message:      code.Render(params),
+		TaskName:     &taskName,
+		StepOrder:    stepOrder,
+		Category:     &event.Category,
+		EventCode:    &code,
+		Params:       params,
 	}
 
 	if err := s.repo.CreateDeploymentLog(log); err != nil {
@@ -296,52 +991,139 @@ func (s *DeploymentService) UpdateDeploymentStep(ctx context.Context, step *mode
 	if err := s.repo.UpdateDeploymentStep(step); err != nil {
 		return fmt.Errorf("failed to update deployment step: %w", err)
 	}
+	s.cache.Invalidate(ctx, step.DeploymentID)
 
 	return nil
 }
 
-// createInitialSteps creates the initial deployment steps
-func (s *DeploymentService) createInitialSteps(deploymentID uuid.UUID) error {
-	steps := []struct {
-		name  string
-		order int
-	}{
-		{"validate_credentials", 1},
-		{"git_clone", 2},
-		{"docker_build", 3},
-		{"docker_run", 4},
-		{"health_check", 5},
+// RecordStepOutput adds structured results to the output of a deployment's step
+func (s *DeploymentService) RecordStepOutput(ctx context.Context, deploymentID uuid.UUID, stepOrder int, output map[string]interface{}) error {
+	if err := s.repo.MergeDeploymentStepOutput(deploymentID, stepOrder, output); err != nil {
+		return fmt.Errorf("failed to record deployment step output: %w", err)
+	}
+	s.cache.Invalidate(ctx, deploymentID)
+
+	return nil
+}
+
+// stepDefinition describes a deployment step created ahead of execution
+type stepDefinition struct {
+	name  string
+	order int
+	// dependsOn are the orders of the steps the step waits for
+	dependsOn []int
+}
+
+// dockerSteps are the steps of a docker deployment. The base images are pulled while the
+// repository is cloned, the clone is scanned for secrets before it is built, and the smoke tests
+// and the latency check run once the health check passed.
+var dockerSteps = []stepDefinition{
+	{"validate_credentials", 1, nil},
+	{"git_clone", 2, []int{1}},
+	{"docker_build", 3, []int{2, 6, 9}},
+	{"docker_run", 4, []int{3}},
+	{"health_check", 5, []int{4}},
+	{"pull_base_images", 6, []int{1}},
+	{"smoke_tests", 7, []int{5}},
+	{"latency_check", 8, []int{7}},
+	{"secret_scan", 9, []int{2}},
+}
+
+// scriptSteps are the steps of a script deployment
+var scriptSteps = []stepDefinition{
+	{"validate_credentials", 1, nil},
+	{"git_clone", 2, []int{1}},
+	{"run_script", 3, []int{2}},
+}
+
+// managedSteps are the steps of a managed service deployment. The image is pulled while the
+// volume is created.
+var managedSteps = []stepDefinition{
+	{"validate_credentials", 1, nil},
+	{"pull_image", 2, []int{1}},
+	{"create_volume", 3, []int{1}},
+	{"docker_run", 4, []int{2, 3}},
+}
+
+// cronSteps are the steps of a cron deployment: the image is built like that of a docker
+// deployment, then the job running it is installed in the crontab of the target
+var cronSteps = []stepDefinition{
+	{"validate_credentials", 1, nil},
+	{"git_clone", 2, []int{1}},
+	{"docker_build", 3, []int{2}},
+	{"install_cron", 4, []int{3}},
+}
+
+// kubernetesSteps are the steps of a deployment to a Kubernetes target
+var kubernetesSteps = []stepDefinition{
+	{"validate_credentials", 1, nil},
+	{"git_clone", 2, []int{1}},
+	{"kubectl_apply", 3, []int{2}},
+	{"rollout_status", 4, []int{3}},
+}
+
+// stepsFor returns the step definitions for a target and deployment type
+func stepsFor(targetType models.TargetType, deploymentType models.DeploymentType) []stepDefinition {
+	if targetType == models.TargetTypeKubernetes {
+		return kubernetesSteps
+	}
+	switch deploymentType {
+	case models.DeploymentTypeScript:
+		return scriptSteps
+	case models.DeploymentTypeManaged:
+		return managedSteps
+	case models.DeploymentTypeCron:
+		return cronSteps
 	}
+	return dockerSteps
+}
 
+// initialSteps builds the pending steps a new deployment starts with
+func initialSteps(deploymentID uuid.UUID, steps []stepDefinition) []*models.DeploymentStep {
+	result := make([]*models.DeploymentStep, 0, len(steps))
 	for _, stepInfo := range steps {
-		step := &models.DeploymentStep{
+		result = append(result, &models.DeploymentStep{
 			ID:           uuid.New(),
 			DeploymentID: deploymentID,
 			StepName:     stepInfo.name,
 			Status:       models.DeploymentStatusPending,
 			StepOrder:    stepInfo.order,
-		}
-
-		if err := s.repo.CreateDeploymentStep(step); err != nil {
-			return fmt.Errorf("failed to create step %s: %w", stepInfo.name, err)
-		}
+			DependsOn:    stepInfo.dependsOn,
+		})
 	}
+	return result
+}
 
+// checkSSHCredentials verifies an SSH deployment can log in to its target: with its password, or
+// with a certificate of the SSH certificate authority
+func (s *DeploymentService) checkSSHCredentials(ctx context.Context, req *models.CreateDeploymentRequest) error {
+	if req.GetTargetType() != models.TargetTypeSSH || req.SSHPassword != "" {
+		return nil
+	}
+	enabled, err := s.sshCA.Enabled(ctx)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrSSHCredentialsRequired
+	}
 	return nil
 }
 
 // ValidateDeploymentRequest validates the deployment request
 func (s *DeploymentService) ValidateDeploymentRequest(req *models.CreateDeploymentRequest) error {
-	if req.TargetIP == "" {
-		return fmt.Errorf("target_ip is required")
-	}
+	if req.GetTargetType() == models.TargetTypeSSH {
+		if req.TargetIP == "" {
+			return fmt.Errorf("target_ip is required")
+		}
 
-	if req.SSHUsername == "" {
-		return fmt.Errorf("ssh_username is required")
-	}
+		if req.SSHUsername == "" {
+			return fmt.Errorf("ssh_username is required")
+		}
 
-	if req.SSHPassword == "" {
-		return fmt.Errorf("ssh_password is required")
+		if err := s.checkSSHCredentials(context.Background(), req); err != nil {
+			return err
+		}
 	}
 
 	if req.GitHubRepoURL == "" {
@@ -357,13 +1139,42 @@ func (s *DeploymentService) ValidateDeploymentRequest(req *models.CreateDeployme
 	}
 
 	// Validate port using the new conversion method
-	if _, err := req.GetPortAsInt(); err != nil {
+	if _, err := resolvePort(req); err != nil {
 		return fmt.Errorf("port validation failed: %w", err)
 	}
 
+	if req.WorkerPool != nil && strings.TrimSpace(*req.WorkerPool) != "" {
+		if err := models.ValidateWorkerPool(strings.TrimSpace(*req.WorkerPool)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// resolvePort returns the deployment port, which is optional for deployments that do not require one
+func resolvePort(req *models.CreateDeploymentRequest) (int, error) {
+	if !req.RequiresPort() && req.Port == "" {
+		return 0, nil
+	}
+	return req.GetPortAsInt()
+}
+
+// resolveScript returns the script path or inline script content of a script deployment
+func resolveScript(req *models.CreateDeploymentRequest) (*string, *string) {
+	if req.GetDeploymentType() != models.DeploymentTypeScript {
+		return nil, nil
+	}
+
+	if req.Script != nil && strings.TrimSpace(*req.Script) != "" {
+		content := *req.Script
+		return nil, &content
+	}
+
+	scriptPath := req.GetScriptPath()
+	return &scriptPath, nil
+}
+
 // generateContainerName generates a unique container name for the deployment
 func (s *DeploymentService) generateContainerName(deploymentID uuid.UUID, containerName, projectName, deploymentName *string) string {
 	// If container name is provided, use it
@@ -412,30 +1223,149 @@ func sanitizeContainerName(name string) string {
 
 // GetDeploymentsByUser gets deployments for a specific user
 func (s *DeploymentService) GetDeploymentsByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*models.DeploymentResponse, error) {
-	deployments, err := s.repo.GetDeploymentsByUserID(userID, limit, offset)
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployments, err := repo.GetDeploymentsByUserID(userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get deployments by user: %w", err)
 	}
 
 	var responses []*models.DeploymentResponse
 	for _, deployment := range deployments {
-		response := &models.DeploymentResponse{
-			ID:             deployment.ID,
-			Status:         deployment.Status,
-			TargetIP:       deployment.TargetIP,
-			GitHubRepoURL:  deployment.GitHubRepoURL,
-			GitHubBranch:   deployment.GitHubBranch,
-			Port:           deployment.Port,
-			ContainerName:  deployment.ContainerName,
-			CreatedAt:      deployment.CreatedAt,
-			StartedAt:      deployment.StartedAt,
-			CompletedAt:    deployment.CompletedAt,
-			ErrorMessage:   deployment.ErrorMessage,
-			ProjectName:    deployment.ProjectName,
-			DeploymentName: deployment.DeploymentName,
-		}
-		responses = append(responses, response)
+		responses = append(responses, toDeploymentResponse(deployment))
+	}
+
+	return responses, nil
+}
+
+// ListDeployments lists deployments across all users matching the filter
+func (s *DeploymentService) ListDeployments(ctx context.Context, filter models.DeploymentFilter, limit, offset int) ([]*models.DeploymentResponse, error) {
+	deployments, err := s.repo.ListDeployments(filter, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	responses := make([]*models.DeploymentResponse, 0, len(deployments))
+	for _, deployment := range deployments {
+		responses = append(responses, toDeploymentResponse(deployment))
 	}
 
 	return responses, nil
 }
+
+// GetUserQuotas reports every user's deployment usage against the configured quotas
+func (s *DeploymentService) GetUserQuotas(ctx context.Context) ([]*models.UserQuota, error) {
+	quotas, err := s.repo.GetUserQuotaUsage(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user quotas: %w", err)
+	}
+
+	for _, quota := range quotas {
+		quota.MaxActiveDeployments = s.quotas.MaxActiveDeployments
+		quota.MaxDeploymentsPerDay = s.quotas.MaxDeploymentsPerDay
+	}
+
+	return quotas, nil
+}
+
+// checkQuota returns a QuotaError when the user has reached a configured deployment limit
+func (s *DeploymentService) checkQuota(userID uuid.UUID) error {
+	if s.quotas.MaxActiveDeployments == 0 && s.quotas.MaxDeploymentsPerDay == 0 {
+		return nil
+	}
+
+	active, recent, err := s.repo.CountUserDeployments(userID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to check deployment quota: %w", err)
+	}
+
+	if s.quotas.MaxActiveDeployments > 0 && active >= s.quotas.MaxActiveDeployments {
+		return &QuotaError{Message: fmt.Sprintf("active deployment limit of %d reached", s.quotas.MaxActiveDeployments)}
+	}
+	if s.quotas.MaxDeploymentsPerDay > 0 && recent >= s.quotas.MaxDeploymentsPerDay {
+		return &QuotaError{Message: fmt.Sprintf("daily deployment limit of %d reached", s.quotas.MaxDeploymentsPerDay)}
+	}
+
+	return nil
+}
+
+// toDeploymentResponse converts a stored deployment to its API representation
+func toDeploymentResponse(deployment *models.Deployment) *models.DeploymentResponse {
+	return &models.DeploymentResponse{
+		ID:                   deployment.ID,
+		Status:               deployment.Status,
+		TargetIP:             deployment.TargetIP,
+		GitHubRepoURL:        deployment.GitHubRepoURL,
+		GitHubBranch:         deployment.GitHubBranch,
+		Port:                 deployment.Port,
+		ContainerName:        deployment.ContainerName,
+		CreatedAt:            deployment.CreatedAt,
+		StartedAt:            deployment.StartedAt,
+		CompletedAt:          deployment.CompletedAt,
+		ErrorMessage:         deployment.ErrorMessage,
+		ProjectName:          deployment.ProjectName,
+		DeploymentName:       deployment.DeploymentName,
+		DeploymentType:       deployment.DeploymentType,
+		ScriptPath:           deployment.ScriptPath,
+		TargetType:           deployment.TargetType,
+		Namespace:            deployment.KubernetesNamespace,
+		Image:                deployment.Image,
+		ManifestsPath:        deployment.ManifestsPath,
+		UserID:               deployment.UserID,
+		RepoSubdirectory:     deployment.RepoSubdirectory,
+		GitLFS:               deployment.GitLFS,
+		ConcurrencyGroup:     deployment.ConcurrencyGroup,
+		SupersededBy:         deployment.SupersededBy,
+		CommentCount:         deployment.CommentCount,
+		OneTimeCredentials:   deployment.OneTimeCredentials,
+		WorkerPool:           deployment.WorkerPool,
+		GPUs:                 deployment.GPUs,
+		ExtraRunArgs:         deployment.ExtraRunArgs,
+		ScheduleID:           deployment.ScheduleID,
+		CommitSHA:            deployment.CommitSHA,
+		FailureCategory:      deployment.FailureCategory,
+		ApplicationReleaseID: deployment.ApplicationReleaseID,
+		ApplicationService:   deployment.ApplicationService,
+		ManagedServices:      deployment.ManagedServices,
+		CronSchedule:         deployment.CronSchedule,
+		CronRemovedAt:        deployment.CronRemovedAt,
+	}
+}
+
+// GetProjectStats returns rolling statistics over the last window finished deployments of a project
+// and a daily trend over the last days days, read from the read replica
+func (s *DeploymentService) GetProjectStats(ctx context.Context, userID uuid.UUID, project string, window, days int) (*models.ProjectStats, error) {
+	reads := s.repo.Replica()
+	stats, err := reads.GetProjectStats(userID, project, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project stats: %w", err)
+	}
+
+	stats.Trend, err = reads.GetProjectTrend(&userID, nil, project, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project trend: %w", err)
+	}
+
+	return stats, nil
+}
+
+// estimateDuration returns the average duration of recent successful deployments of the project,
+// or nil when there is no history to base an estimate on
+func (s *DeploymentService) estimateDuration(userID uuid.UUID, project string) *int {
+	stats, err := s.repo.Replica().GetProjectStats(userID, project, DefaultStatsWindow)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to estimate deployment duration")
+		return nil
+	}
+
+	if stats.AvgDurationSeconds == nil {
+		return nil
+	}
+
+	seconds := int(math.Round(*stats.AvgDurationSeconds))
+	return &seconds
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrExecDisabled is returned when interactive shells are turned off
+	ErrExecDisabled = errors.New("interactive exec is disabled")
+	// ErrExecForbidden is returned when the user may not open a shell in the deployment's container
+	ErrExecForbidden = errors.New("only the owner of the deployment or an administrator may open a shell in its container")
+	// ErrExecSessionsForbidden is returned when the user may not see the shells opened in the
+	// deployment's container, whose records hold everything typed in them
+	ErrExecSessionsForbidden = errors.New("only the owner of the deployment or an administrator may see the shells opened in its container")
+	// ErrExecUnavailable is returned when the deployment has no running container to open a shell in
+	ErrExecUnavailable = errors.New("deployment has no running container")
+)
+
+// execShellCommand starts bash in the container when it has one, otherwise sh
+const execShellCommand = `if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi`
+
+// Default terminal size when the client does not send one
+const (
+	defaultExecCols = 80
+	defaultExecRows = 24
+)
+
+// ExecService opens audited interactive shells in the containers of deployments
+type ExecService struct {
+	repo        *database.Repository
+	deployments *DeploymentService
+	targets     *SSHTargetLimiter
+	config      config.ExecConfig
+	logger      *logrus.Logger
+}
+
+// NewExecService creates a new exec service
+func NewExecService(repo *database.Repository, deployments *DeploymentService, targets *SSHTargetLimiter, cfg config.ExecConfig, logger *logrus.Logger) *ExecService {
+	return &ExecService{
+		repo:        repo,
+		deployments: deployments,
+		targets:     targets,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// Config returns the exec configuration
+func (s *ExecService) Config() config.ExecConfig {
+	return s.config
+}
+
+// ExecSession is an interactive shell running in a deployment's container through an SSH PTY.
+// Reads return terminal output and writes send terminal input, which is recorded for the audit trail.
+type ExecSession struct {
+	record        *models.ExecSession
+	client        *ssh.Client
+	session       *ssh.Session
+	stdin         io.WriteCloser
+	stdout        io.Reader
+	maxTranscript int64
+
+	mu          sync.Mutex
+	transcript  strings.Builder
+	truncated   bool
+	outputBytes atomic.Int64
+}
+
+// ID returns the ID of the session's audit record
+func (e *ExecSession) ID() uuid.UUID {
+	return e.record.ID
+}
+
+// Read reads terminal output
+func (e *ExecSession) Read(p []byte) (int, error) {
+	n, err := e.stdout.Read(p)
+	e.outputBytes.Add(int64(n))
+	return n, err
+}
+
+// Write sends terminal input and records it in the transcript
+func (e *ExecSession) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	if remaining := e.maxTranscript - int64(e.transcript.Len()); remaining < int64(len(p)) {
+		e.transcript.Write(p[:max(remaining, 0)])
+		e.truncated = true
+	} else {
+		e.transcript.Write(p)
+	}
+	e.mu.Unlock()
+
+	return e.stdin.Write(p)
+}
+
+// Resize changes the size of the terminal
+func (e *ExecSession) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("invalid terminal size %dx%d", cols, rows)
+	}
+	return e.session.WindowChange(rows, cols)
+}
+
+// Open starts an interactive shell in the running container of a deployment on behalf of a user.
+// The session is recorded before it starts and must be ended with Finish.
+func (s *ExecService) Open(ctx context.Context, deploymentID, userID uuid.UUID, clientIP string, cols, rows int) (*ExecSession, error) {
+	if !s.config.Enabled {
+		return nil, ErrExecDisabled
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := authorizeTargetAccess(repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrExecForbidden
+	}
+
+	if deployment.OneTimeCredentials {
+		return nil, fmt.Errorf("%w: the deployment's credentials were used once and not stored", ErrExecUnavailable)
+	}
+	containerName, err := runningContainer(deployment)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExecUnavailable, err)
+	}
+	if cols <= 0 || rows <= 0 {
+		cols, rows = defaultExecCols, defaultExecRows
+	}
+
+	client, err := dialDeploymentTarget(ctx, s.deployments.sshCA, s.targets, deployment, "exec", s.config.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	exec, err := startExecShell(client, containerName, cols, rows)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	exec.maxTranscript = s.config.MaxTranscriptSize
+	exec.record = &models.ExecSession{
+		ID:            uuid.New(),
+		DeploymentID:  deploymentID,
+		UserID:        &userID,
+		Username:      user.Username,
+		ClientIP:      clientIP,
+		ContainerName: containerName,
+		StartedAt:     time.Now(),
+	}
+
+	// No shell is handed out without its audit record
+	if err := repo.CreateExecSession(exec.record); err != nil {
+		exec.session.Close()
+		client.Close()
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Exec session %s opened in container %s by %s from %s", exec.record.ID, containerName, user.Username, clientIP)
+	if err := s.deployments.AddDeploymentLog(ctx, deploymentID, "warn", message, "exec", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log exec session start")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"exec_session_id": exec.record.ID,
+		"deployment_id":   deploymentID,
+		"user_id":         userID,
+		"container":       containerName,
+		"client_ip":       clientIP,
+	}).Info("Exec session opened")
+
+	return exec, nil
+}
+
+// startExecShell runs docker exec with a PTY of the given size on the target
+func startExecShell(client *ssh.Client, containerName string, cols, rows int) (*ExecSession, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", rows, cols, modes); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to request PTY: %w", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open stdout: %w", err)
+	}
+
+	command := "docker exec -it " + shellquote.Quote(containerName) + " sh -c " + shellquote.Quote(execShellCommand)
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	return &ExecSession{
+		client:  client,
+		session: session,
+		stdin:   stdin,
+		stdout:  stdout,
+	}, nil
+}
+
+// Finish ends a session, unless the shell already exited, and completes its audit record.
+// It returns the exit code of the shell when it is known.
+func (s *ExecService) Finish(ctx context.Context, exec *ExecSession, reason string) *int {
+	// Closing the connection hangs up the PTY, which ends the shell if it is still running
+	exec.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- exec.session.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(time.Second):
+		exec.client.Close()
+		err = <-done
+	}
+	exec.client.Close()
+
+	var exitCode *int
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		code := 0
+		exitCode = &code
+	case errors.As(err, &exitErr):
+		code := exitErr.ExitStatus()
+		exitCode = &code
+	}
+
+	now := time.Now()
+	exec.mu.Lock()
+	exec.record.InputTranscript = strings.ToValidUTF8(strings.ReplaceAll(exec.transcript.String(), "\x00", ""), "\uFFFD")
+	exec.record.InputTruncated = exec.truncated
+	exec.mu.Unlock()
+	exec.record.EndedAt = &now
+	exec.record.ExitCode = exitCode
+	exec.record.EndReason = &reason
+	exec.record.OutputBytes = exec.outputBytes.Load()
+
+	if err := s.repo.FinishExecSession(exec.record); err != nil {
+		s.logger.WithError(err).WithField("exec_session_id", exec.record.ID).Error("Failed to record the end of an exec session")
+	}
+
+	message := fmt.Sprintf("Exec session %s by %s ended after %s: %s", exec.record.ID, exec.record.Username,
+		now.Sub(exec.record.StartedAt).Round(time.Second), reason)
+	if exitCode != nil {
+		message += fmt.Sprintf(" (exit code %d)", *exitCode)
+	}
+	if err := s.deployments.AddDeploymentLog(ctx, exec.record.DeploymentID, "info", message, "exec", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log exec session end")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"exec_session_id": exec.record.ID,
+		"deployment_id":   exec.record.DeploymentID,
+		"reason":          reason,
+		"output_bytes":    exec.record.OutputBytes,
+	}).Info("Exec session ended")
+
+	return exitCode
+}
+
+// GetExecSessions returns the audit records of the shells opened in a deployment's container to a
+// user who may open one there
+func (s *ExecService) GetExecSessions(ctx context.Context, deploymentID, userID uuid.UUID) ([]*models.ExecSession, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := authorizeTargetAccess(repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrExecSessionsForbidden
+	}
+	return repo.GetExecSessions(deploymentID)
+}
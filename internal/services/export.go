@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ExportDeployments calls fn for every deployment matching the filter, newest first, as it is read
+// from the database. Credentials are never included.
+func (s *DeploymentService) ExportDeployments(ctx context.Context, filter models.DeploymentFilter, fn func(*models.DeploymentResponse) error) error {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return repo.StreamDeployments(filter, func(deployment *models.Deployment) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(toDeploymentResponse(deployment))
+	})
+}
+
+// ExportDeploymentLogs calls fn for every log of a deployment in order, as it is read from the database
+func (s *DeploymentService) ExportDeploymentLogs(ctx context.Context, deploymentID uuid.UUID, fn func(*models.DeploymentLog) error) error {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Report a missing deployment instead of an empty export
+	if _, err := repo.GetDeployment(deploymentID); err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	return repo.StreamDeploymentLogs(deploymentID, func(log *models.DeploymentLog) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(log)
+	})
+}
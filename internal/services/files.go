@@ -0,0 +1,469 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrFilesDisabled is returned when the file browser is turned off
+	ErrFilesDisabled = errors.New("the file browser is disabled")
+	// ErrFilesForbidden is returned when the user may not browse the deployment's files
+	ErrFilesForbidden = errors.New("only the owner of the deployment or an administrator may browse its files")
+	// ErrFilesUnavailable is returned when the requested source cannot be browsed for the deployment
+	ErrFilesUnavailable = errors.New("files are not available")
+	// ErrFileNotFound is returned when the requested path does not exist
+	ErrFileNotFound = errors.New("file not found")
+	// ErrNotDirectory is returned when a path listed as a directory is not one
+	ErrNotDirectory = errors.New("not a directory")
+	// ErrIsDirectory is returned when a path fetched as a file is a directory
+	ErrIsDirectory = errors.New("is a directory")
+	// ErrFileTooLarge is returned when a file exceeds the configured download size
+	ErrFileTooLarge = errors.New("file is too large")
+)
+
+// maxContainerListTransfer bounds how much of a container directory docker cp may stream while
+// it is listed; the listing is truncated beyond it
+const maxContainerListTransfer = 256 << 20
+
+// errEmptyArchive reports that docker cp produced no archive, i.e. the copy failed
+var errEmptyArchive = errors.New("empty archive")
+
+// FileService lists and fetches files from the workspace on a deployment's target and from its
+// running container. Access is read-only.
+type FileService struct {
+	repo    *database.Repository
+	sshCA   *SSHCAService
+	targets *SSHTargetLimiter
+	config  config.FilesConfig
+	logger  *logrus.Logger
+}
+
+// NewFileService creates a new file service
+func NewFileService(repo *database.Repository, sshCA *SSHCAService, targets *SSHTargetLimiter, cfg config.FilesConfig, logger *logrus.Logger) *FileService {
+	return &FileService{
+		repo:    repo,
+		sshCA:   sshCA,
+		targets: targets,
+		config:  cfg,
+		logger:  logger,
+	}
+}
+
+// fileTarget is a deployment whose files are being browsed, with a connection to its target
+type fileTarget struct {
+	deployment *models.Deployment
+	client     *ssh.Client
+	// container is set when browsing the container
+	container string
+}
+
+// connect authorizes the user, checks the source is available and connects to the target
+func (s *FileService) connect(ctx context.Context, deploymentID, userID uuid.UUID, source models.FileSource) (*fileTarget, error) {
+	if !s.config.Enabled {
+		return nil, ErrFilesDisabled
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := authorizeTargetAccess(repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrFilesForbidden
+	}
+
+	if deployment.OneTimeCredentials {
+		return nil, fmt.Errorf("%w: the deployment's credentials were used once and not stored", ErrFilesUnavailable)
+	}
+
+	target := &fileTarget{deployment: deployment}
+	switch source {
+	case models.FileSourceContainer:
+		target.container, err = runningContainer(deployment)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFilesUnavailable, err)
+		}
+	default:
+		if err := s.checkWorkspace(deployment); err != nil {
+			return nil, err
+		}
+	}
+
+	target.client, err = dialDeploymentTarget(ctx, s.sshCA, s.targets, deployment, "files", s.config.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// checkWorkspace verifies the workspace on the target still holds the deployment's checkout.
+// Every deployment on a target clones into the same directory, so only the latest one qualifies.
+func (s *FileService) checkWorkspace(deployment *models.Deployment) error {
+	if targetTypeOf(deployment) != models.TargetTypeSSH {
+		return fmt.Errorf("%w: only deployments on SSH targets have a workspace", ErrFilesUnavailable)
+	}
+	if deployment.StartedAt == nil {
+		return fmt.Errorf("%w: deployment has not started yet", ErrFilesUnavailable)
+	}
+
+	// Deployments of other organizations on the same target replace the workspace too
+	latest, err := s.repo.GetLatestStartedDeploymentOnTarget(deployment.TargetIP)
+	if err != nil {
+		return err
+	}
+	if latest != deployment.ID {
+		return fmt.Errorf("%w: the workspace now holds the checkout of a later deployment on this target", ErrFilesUnavailable)
+	}
+	return nil
+}
+
+// List lists a directory of the workspace or the container
+func (s *FileService) List(ctx context.Context, deploymentID, userID uuid.UUID, source models.FileSource, p string) (*models.FileListing, error) {
+	if err := models.ValidateFilePath(p); err != nil {
+		return nil, err
+	}
+	target, err := s.connect(ctx, deploymentID, userID, source)
+	if err != nil {
+		return nil, err
+	}
+	defer target.client.Close()
+
+	listing := &models.FileListing{DeploymentID: deploymentID, Source: source, Path: cleanFilePath(p)}
+	if source == models.FileSourceContainer {
+		err = s.listContainer(target, listing)
+	} else {
+		err = s.listWorkspace(target, listing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// Fetch returns the content of a file of the workspace or the container, up to the configured size
+func (s *FileService) Fetch(ctx context.Context, deploymentID, userID uuid.UUID, source models.FileSource, p string) (*models.FileEntry, []byte, error) {
+	if err := models.ValidateFilePath(p); err != nil {
+		return nil, nil, err
+	}
+	target, err := s.connect(ctx, deploymentID, userID, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer target.client.Close()
+
+	var entry *models.FileEntry
+	var content []byte
+	if source == models.FileSourceContainer {
+		entry, content, err = s.fetchContainer(target, cleanFilePath(p))
+	} else {
+		entry, content, err = s.fetchWorkspace(target, cleanFilePath(p))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"user_id":       userID,
+		"source":        source,
+		"path":          entry.Path,
+		"size":          len(content),
+	}).Info("Deployment file fetched")
+	return entry, content, nil
+}
+
+// cleanFilePath turns a requested path into a clean absolute path
+func cleanFilePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// resolveWorkspacePath maps a workspace path onto the target, refusing symlinks that lead out of the workspace
+func resolveWorkspacePath(sftpClient *sftp.Client, p string) (string, error) {
+	resolved, err := sftpClient.RealPath(path.Join(models.RemoteWorkspaceDir, p))
+	if err != nil {
+		return "", fileError(err)
+	}
+	if resolved != models.RemoteWorkspaceDir && !strings.HasPrefix(resolved, models.RemoteWorkspaceDir+"/") {
+		return "", fmt.Errorf("%w: path leads outside the workspace", ErrFileNotFound)
+	}
+	return resolved, nil
+}
+
+// fileError maps SFTP errors onto the file browser errors
+func fileError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrFileNotFound
+	}
+	var statusErr *sftp.StatusError
+	if errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxNoSuchFile {
+		return ErrFileNotFound
+	}
+	return err
+}
+
+// listWorkspace lists a workspace directory over SFTP
+func (s *FileService) listWorkspace(target *fileTarget, listing *models.FileListing) error {
+	sftpClient, err := sftp.NewClient(target.client)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	dir, err := resolveWorkspacePath(sftpClient, listing.Path)
+	if err != nil {
+		return err
+	}
+	info, err := sftpClient.Stat(dir)
+	if err != nil {
+		return fileError(err)
+	}
+	if !info.IsDir() {
+		return ErrNotDirectory
+	}
+
+	infos, err := sftpClient.ReadDir(dir)
+	if err != nil {
+		return fileError(err)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	if len(infos) > s.config.MaxEntries {
+		infos = infos[:s.config.MaxEntries]
+		listing.Truncated = true
+	}
+
+	listing.Entries = make([]models.FileEntry, 0, len(infos))
+	for _, info := range infos {
+		entry := fileInfoEntry(info, path.Join(listing.Path, info.Name()))
+		if entry.Type == models.FileTypeSymlink {
+			if linkTarget, err := sftpClient.ReadLink(path.Join(dir, info.Name())); err == nil {
+				entry.LinkTarget = linkTarget
+			}
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return nil
+}
+
+// fetchWorkspace reads a workspace file over SFTP
+func (s *FileService) fetchWorkspace(target *fileTarget, p string) (*models.FileEntry, []byte, error) {
+	sftpClient, err := sftp.NewClient(target.client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	resolved, err := resolveWorkspacePath(sftpClient, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := sftpClient.Stat(resolved)
+	if err != nil {
+		return nil, nil, fileError(err)
+	}
+	if info.IsDir() {
+		return nil, nil, ErrIsDirectory
+	}
+	if info.Size() > s.config.MaxFileSize {
+		return nil, nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrFileTooLarge, info.Size(), s.config.MaxFileSize)
+	}
+
+	file, err := sftpClient.Open(resolved)
+	if err != nil {
+		return nil, nil, fileError(err)
+	}
+	defer file.Close()
+
+	content, err := readLimited(file, s.config.MaxFileSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry := fileInfoEntry(info, p)
+	return &entry, content, nil
+}
+
+// listContainer lists a container directory from the archive docker cp streams out of it
+func (s *FileService) listContainer(target *fileTarget, listing *models.FileListing) error {
+	listing.Entries = []models.FileEntry{}
+	return copyFromContainer(target.client, target.container, listing.Path, func(stream io.Reader) error {
+		limited := &io.LimitedReader{R: stream, N: maxContainerListTransfer}
+		tr := tar.NewReader(limited)
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return errEmptyArchive
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read container archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeDir {
+			return ErrNotDirectory
+		}
+
+		// Entries are named after the directory itself; only its direct children are listed
+		base := strings.TrimSuffix(header.Name, "/") + "/"
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				if limited.N <= 0 {
+					listing.Truncated = true
+					return nil
+				}
+				return fmt.Errorf("failed to read container archive: %w", err)
+			}
+
+			name := strings.TrimPrefix(strings.TrimSuffix(header.Name, "/"), base)
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			if len(listing.Entries) >= s.config.MaxEntries {
+				listing.Truncated = true
+				return nil
+			}
+			listing.Entries = append(listing.Entries, tarEntry(header, path.Join(listing.Path, name)))
+		}
+	})
+}
+
+// fetchContainer reads a container file from the archive docker cp streams out of it
+func (s *FileService) fetchContainer(target *fileTarget, p string) (*models.FileEntry, []byte, error) {
+	var entry models.FileEntry
+	var content []byte
+	err := copyFromContainer(target.client, target.container, p, func(stream io.Reader) error {
+		tr := tar.NewReader(stream)
+		header, err := tr.Next()
+		if err == io.EOF {
+			return errEmptyArchive
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read container archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			return ErrIsDirectory
+		}
+		if header.Size > s.config.MaxFileSize {
+			return fmt.Errorf("%w: %d bytes, the limit is %d", ErrFileTooLarge, header.Size, s.config.MaxFileSize)
+		}
+
+		entry = tarEntry(header, p)
+		content, err = readLimited(tr, s.config.MaxFileSize)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &entry, content, nil
+}
+
+// copyFromContainer runs docker cp on the target to stream a path out of a container as a tar
+// archive, and hands the stream to read. A symlinked path is followed. The transfer is aborted
+// once read returns.
+func copyFromContainer(client *ssh.Client, container, p string, read func(io.Reader) error) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open stdout: %w", err)
+	}
+
+	if err := session.Start("docker cp -L " + shellquote.Quote(container+":"+p) + " -"); err != nil {
+		return fmt.Errorf("failed to run docker cp: %w", err)
+	}
+
+	err = read(stdout)
+	if !errors.Is(err, errEmptyArchive) {
+		return err
+	}
+
+	// Nothing was copied: docker cp explains why on stderr
+	waitErr := session.Wait()
+	message := strings.TrimSpace(stderr.String())
+	switch {
+	case strings.Contains(message, "No such container") || strings.Contains(message, "is not running"):
+		return fmt.Errorf("%w: container %s is not running", ErrFilesUnavailable, container)
+	case strings.Contains(message, "Could not find the file") || strings.Contains(message, "No such file"):
+		return ErrFileNotFound
+	case waitErr != nil:
+		return fmt.Errorf("docker cp failed: %v: %s", waitErr, message)
+	}
+	return ErrFileNotFound
+}
+
+// readLimited reads everything from r, failing when it holds more than limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", ErrFileTooLarge, limit)
+	}
+	return content, nil
+}
+
+// fileInfoEntry describes a file listed over SFTP
+func fileInfoEntry(info os.FileInfo, p string) models.FileEntry {
+	modifiedAt := info.ModTime()
+	entry := models.FileEntry{
+		Name:       info.Name(),
+		Path:       p,
+		Size:       info.Size(),
+		Mode:       info.Mode().String(),
+		ModifiedAt: &modifiedAt,
+	}
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		entry.Type = models.FileTypeDir
+	case mode&os.ModeSymlink != 0:
+		entry.Type = models.FileTypeSymlink
+	case mode.IsRegular():
+		entry.Type = models.FileTypeFile
+	default:
+		entry.Type = models.FileTypeOther
+	}
+	return entry
+}
+
+// tarEntry describes a file read from a docker cp archive
+func tarEntry(header *tar.Header, p string) models.FileEntry {
+	entry := fileInfoEntry(header.FileInfo(), p)
+	entry.Name = path.Base(p)
+	entry.LinkTarget = header.Linkname
+	return entry
+}
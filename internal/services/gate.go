@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrGateNotFound is returned when a deployment has no gate with the given name
+	ErrGateNotFound = errors.New("gate not found")
+	// ErrGateDeploymentNotFound is returned when a deployment does not exist or the user may not see it
+	ErrGateDeploymentNotFound = errors.New("deployment not found")
+	// ErrGateClosed is returned when a gate can no longer be reported, because another result was
+	// reported, it timed out or its deployment stopped waiting
+	ErrGateClosed = errors.New("gate is no longer waiting")
+)
+
+// gateBatchSize bounds the number of expired gates handled per query
+const gateBatchSize = 100
+
+// GateService records the results of the external checks deployments wait for, and queues a
+// deployment once all of its gates have passed
+type GateService struct {
+	repo        *database.Repository
+	deployments *DeploymentService
+	logger      *logrus.Logger
+}
+
+// NewGateService creates a new gate service
+func NewGateService(repo *database.Repository, deployments *DeploymentService, logger *logrus.Logger) *GateService {
+	return &GateService{
+		repo:        repo,
+		deployments: deployments,
+		logger:      logger,
+	}
+}
+
+// ListGates returns the gates of a deployment userID may see
+func (s *GateService) ListGates(ctx context.Context, userID, deploymentID uuid.UUID) ([]*models.DeploymentGate, error) {
+	if _, err := s.deployment(userID, deploymentID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDeploymentGates(deploymentID)
+}
+
+// ReportGate records the result of a gate of a deployment userID may see. A failed gate fails the
+// deployment; once every gate has passed, the deployment is queued. Reporting the result a gate
+// already has again succeeds, so retried CI jobs do not fail.
+func (s *GateService) ReportGate(ctx context.Context, userID, deploymentID uuid.UUID, name string, req *models.ReportGateRequest) (*models.DeploymentGate, error) {
+	if name == models.ApplicationReleaseGate {
+		return nil, fmt.Errorf("%w: gate %q is passed by the application release once the service before it has completed", ErrGateClosed, name)
+	}
+	deployment, err := s.deployment(userID, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if deployment.Status != models.DeploymentStatusPending {
+		return s.reported(ctx, deployment, name, req.Status)
+	}
+
+	gate, err := s.repo.ReportDeploymentGate(deploymentID, name, req.Status, optionalString(req.Details), optionalString(req.URL), userID)
+	if err != nil {
+		return nil, err
+	}
+	if gate == nil {
+		return s.reported(ctx, deployment, name, req.Status)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"gate":          name,
+		"status":        gate.Status,
+		"reported_by":   userID,
+	}).Info("Deployment gate reported")
+
+	message := fmt.Sprintf("Gate %q %s", name, gate.Status)
+	if req.Details != "" {
+		message += ": " + req.Details
+	}
+	if gate.Status == models.GateStatusFailed {
+		return gate, s.failDeployment(ctx, deploymentID, message)
+	}
+	if err := s.deployments.AddDeploymentLog(ctx, deploymentID, "info", message, "gates", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log deployment gate")
+	}
+	return gate, s.release(ctx, deploymentID)
+}
+
+// reported handles a report for a gate that is no longer waiting, or whose deployment no longer
+// waits: repeating the gate's result succeeds, anything else is refused
+func (s *GateService) reported(ctx context.Context, deployment *models.Deployment, name string, status models.GateStatus) (*models.DeploymentGate, error) {
+	deploymentID := deployment.ID
+	gates, err := s.repo.GetDeploymentGates(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, gate := range gates {
+		if gate.Name != name {
+			continue
+		}
+		switch {
+		case gate.Status == models.GateStatusWaiting && deployment.Status != models.DeploymentStatusPending:
+			return nil, fmt.Errorf("%w: the deployment is %s", ErrGateClosed, deployment.Status)
+		case gate.Status == models.GateStatusWaiting:
+			return nil, fmt.Errorf("%w: gate %q expired at %s", ErrGateClosed, name, gate.ExpiresAt.UTC().Format(time.RFC3339))
+		case gate.Status != status:
+			return nil, fmt.Errorf("%w: gate %q already %s", ErrGateClosed, name, gate.Status)
+		case status == models.GateStatusPassed && deployment.Status == models.DeploymentStatusPending:
+			// The earlier report may have failed to queue the deployment
+			return gate, s.release(ctx, deploymentID)
+		}
+		return gate, nil
+	}
+	return nil, fmt.Errorf("%w: the deployment has no gate %q", ErrGateNotFound, name)
+}
+
+// release queues a deployment once all of its gates have passed. Jobs that cannot be enqueued
+// right away are published by the outbox publisher.
+func (s *GateService) release(ctx context.Context, deploymentID uuid.UUID) error {
+	gates, err := s.repo.GetDeploymentGates(deploymentID)
+	if err != nil {
+		return err
+	}
+	for _, gate := range gates {
+		if gate.Status != models.GateStatusPassed {
+			return nil
+		}
+	}
+
+	// Only one of concurrent reports gets the held jobs
+	ids, err := s.repo.ReleaseHeldOutboxEntries(deploymentID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	for _, id := range ids {
+		_, err := s.repo.PublishOutboxEntry(id, func(entry *models.OutboxEntry) error {
+			job, err := decodeOutboxEntry(s.deployments.encryptor, entry)
+			if err != nil {
+				return err
+			}
+			return s.deployments.queue.EnqueueJob(ctx, job)
+		})
+		if err != nil {
+			s.logger.WithError(err).WithField("deployment_id", deploymentID).Warn("Failed to enqueue deployment job, leaving it in the outbox")
+		}
+	}
+
+	if err := s.deployments.AddDeploymentLog(ctx, deploymentID, "info", "All gates passed; deployment queued", "gates", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log deployment gates")
+	}
+	s.logger.WithField("deployment_id", deploymentID).Info("Deployment gates passed")
+	return nil
+}
+
+// failDeployment fails a deployment still waiting for its gates
+func (s *GateService) failDeployment(ctx context.Context, deploymentID uuid.UUID, message string) error {
+	failed, err := s.repo.FailGatedDeployment(deploymentID, message)
+	if err != nil || !failed {
+		return err
+	}
+	s.deployments.cache.Invalidate(ctx, deploymentID)
+
+	if err := s.deployments.AddDeploymentLog(ctx, deploymentID, "error", message, "gates", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log deployment gate failure")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"reason":        message,
+	}).Info("Deployment failed by its gates")
+	return nil
+}
+
+// deployment returns a deployment userID created, or any deployment to an administrator
+func (s *GateService) deployment(userID, deploymentID uuid.UUID) (*models.Deployment, error) {
+	deployment, err := s.repo.GetDeployment(deploymentID)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			return nil, ErrGateDeploymentNotFound
+		}
+		return nil, err
+	}
+	user, err := authorizeTargetAccess(s.repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrGateDeploymentNotFound
+	}
+	return deployment, nil
+}
+
+// GateMonitor fails deployments whose gates were not reported before they timed out
+type GateMonitor struct {
+	gates  *GateService
+	config config.GateConfig
+	logger *logrus.Logger
+}
+
+// NewGateMonitor creates a new gate monitor
+func NewGateMonitor(gates *GateService, cfg config.GateConfig, logger *logrus.Logger) *GateMonitor {
+	return &GateMonitor{
+		gates:  gates,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Run times out expired gates every interval until ctx is cancelled
+func (m *GateMonitor) Run(ctx context.Context) {
+	m.logger.WithField("interval", m.config.Interval).Info("Starting deployment gate monitor")
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Sweep(ctx); err != nil && ctx.Err() == nil {
+			m.logger.WithError(err).Error("Deployment gate sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep marks every expired gate as timed out, fails its deployment and returns how many gates
+// timed out. Each gate is claimed by one server.
+func (m *GateMonitor) Sweep(ctx context.Context) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		expired, err := m.gates.repo.ExpireDeploymentGates(time.Now(), gateBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += len(expired)
+
+		for _, gate := range expired {
+			message := fmt.Sprintf("Gate %q was not reported before it timed out at %s", gate.Name, gate.ExpiresAt.UTC().Format(time.RFC3339))
+			if err := m.gates.failDeployment(ctx, gate.DeploymentID, message); err != nil {
+				m.logger.WithError(err).WithField("deployment_id", gate.DeploymentID).Error("Failed to fail deployment with a timed out gate")
+			}
+		}
+		if len(expired) < gateBatchSize {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+
+	"github.com/sirupsen/logrus"
+)
+
+// githubDeploymentBatchSize is the number of deployment statuses reported per sweep
+const githubDeploymentBatchSize = 100
+
+// githubDeploymentLookback is how old a deployment may be for its statuses to be reported; older
+// deployments, such as the ones from before reporting was enabled, are left alone
+const githubDeploymentLookback = 24 * time.Hour
+
+// githubDeploymentMaxAttempts is how often reporting a status is tried before it is given up on
+const githubDeploymentMaxAttempts = 5
+
+// githubMaxDescription is the longest description GitHub accepts for a deployment status
+const githubMaxDescription = 140
+
+// errGitHubRejected is returned when GitHub rejects a request in a way retrying cannot fix, such
+// as a token without access to the repository's deployments
+var errGitHubRejected = errors.New("GitHub rejected the request")
+
+// GitHubDeploymentReporter mirrors deployments to GitHub's Deployments API: it creates a GitHub
+// deployment for each deployment and reports its status changes, so the environments of the
+// source repository show the live status with a link back to DeployKnot. Statuses are looked up in
+// the database, so changes made by any worker are reported and failed reports are retried.
+type GitHubDeploymentReporter struct {
+	repo       *database.Repository
+	encryptor  *encryption.Encryptor
+	config     config.GitHubDeploymentsConfig
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewGitHubDeploymentReporter creates a new reporter of deployments to GitHub
+func NewGitHubDeploymentReporter(repo *database.Repository, encryptor *encryption.Encryptor, cfg config.GitHubDeploymentsConfig, logger *logrus.Logger) *GitHubDeploymentReporter {
+	return &GitHubDeploymentReporter{
+		repo:       repo,
+		encryptor:  encryptor,
+		config:     cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+	}
+}
+
+// Run reports deployment status changes every interval until ctx is cancelled
+func (r *GitHubDeploymentReporter) Run(ctx context.Context) {
+	r.logger.WithFields(logrus.Fields{
+		"interval": r.config.Interval,
+		"api_url":  r.config.APIURL,
+	}).Info("Starting GitHub deployment reporter")
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sweep(ctx); err != nil && ctx.Err() == nil {
+			r.logger.WithError(err).Error("GitHub deployment sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep reports the deployment statuses GitHub has not seen yet and returns how many were reported
+func (r *GitHubDeploymentReporter) Sweep(ctx context.Context) (int, error) {
+	updates, err := r.repo.GetPendingGitHubDeploymentUpdates(time.Now().Add(-githubDeploymentLookback), githubDeploymentMaxAttempts, githubDeploymentBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	reported := 0
+	for _, update := range updates {
+		if ctx.Err() != nil {
+			break
+		}
+		logger := r.logger.WithFields(logrus.Fields{
+			"deployment_id": update.DeploymentID,
+			"status":        update.Status,
+			"repository":    models.NormalizeRepoURL(update.RepoURL),
+		})
+
+		err := r.report(ctx, update)
+		switch {
+		case err == nil:
+			if err := r.repo.CompleteGitHubDeploymentUpdate(update.DeploymentID, update.Status); err != nil {
+				return reported, err
+			}
+			logger.Debug("Deployment status reported to GitHub")
+			reported++
+		case errors.Is(err, errGitHubRejected):
+			logger.WithError(err).Warn("GitHub rejected the deployment status; it will not be retried")
+			if err := r.repo.FailGitHubDeploymentUpdate(update.DeploymentID, update.Status, err.Error(), false, githubDeploymentMaxAttempts); err != nil {
+				return reported, err
+			}
+		default:
+			logger.WithError(err).Warn("Failed to report deployment status to GitHub; it will be retried")
+			if err := r.repo.FailGitHubDeploymentUpdate(update.DeploymentID, update.Status, err.Error(), true, githubDeploymentMaxAttempts); err != nil {
+				return reported, err
+			}
+		}
+	}
+	return reported, nil
+}
+
+// report creates the GitHub deployment of a deployment if it has none yet, and adds a status for
+// the deployment's current status to it
+func (r *GitHubDeploymentReporter) report(ctx context.Context, update *models.GitHubDeploymentUpdate) error {
+	pat, err := r.encryptor.Decrypt(update.PATEncrypted)
+	if err != nil {
+		return fmt.Errorf("%w: failed to decrypt GitHub token: %v", errGitHubRejected, err)
+	}
+	repo := models.NormalizeRepoURL(update.RepoURL)
+
+	if update.GitHubDeploymentID == nil {
+		var created struct {
+			ID int64 `json:"id"`
+		}
+		err := r.post(ctx, pat, "/repos/"+repo+"/deployments", map[string]interface{}{
+			"ref":               update.Ref(),
+			"environment":       update.Environment(),
+			"description":       "Deployed by DeployKnot",
+			"auto_merge":        false,
+			"required_contexts": []string{},
+			"payload":           map[string]string{"deployknot_deployment_id": update.DeploymentID.String()},
+		}, &created)
+		if err != nil {
+			return fmt.Errorf("failed to create GitHub deployment: %w", err)
+		}
+		if err := r.repo.RecordGitHubDeployment(update.DeploymentID, created.ID); err != nil {
+			return err
+		}
+		update.GitHubDeploymentID = &created.ID
+	}
+
+	body := map[string]interface{}{
+		"state":       update.Status.GitHubDeploymentState(),
+		"description": truncateText(r.describe(update), githubMaxDescription),
+	}
+	if r.config.PublicURL != "" {
+		body["log_url"] = r.config.PublicURL + "/api/v1/deployments/" + update.DeploymentID.String() + "/logs"
+	}
+	if update.TargetType != models.TargetTypeKubernetes && update.TargetIP != "" && update.Port > 0 {
+		body["environment_url"] = "http://" + net.JoinHostPort(update.TargetIP, strconv.Itoa(update.Port))
+	}
+	path := "/repos/" + repo + "/deployments/" + strconv.FormatInt(*update.GitHubDeploymentID, 10) + "/statuses"
+	if err := r.post(ctx, pat, path, body, nil); err != nil {
+		return fmt.Errorf("failed to create GitHub deployment status: %w", err)
+	}
+	return nil
+}
+
+// describe returns the description of a deployment status
+func (r *GitHubDeploymentReporter) describe(update *models.GitHubDeploymentUpdate) string {
+	switch update.Status {
+	case models.DeploymentStatusPending:
+		return "Deployment queued"
+	case models.DeploymentStatusRunning:
+		return "Deployment running"
+	case models.DeploymentStatusCompleted:
+		return "Deployment completed"
+	case models.DeploymentStatusCancelled:
+		return "Deployment cancelled"
+	case models.DeploymentStatusAborted:
+		return "Deployment aborted"
+	}
+	if update.ErrorMessage != nil && *update.ErrorMessage != "" {
+		return *update.ErrorMessage
+	}
+	return "Deployment failed"
+}
+
+// post sends a JSON request to the GitHub API and decodes the response into result, if given.
+// Client errors other than rate limiting wrap errGitHubRejected.
+func (r *GitHubDeploymentReporter) post(ctx context.Context, pat, path string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal GitHub request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.config.APIURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pat)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DeployKnot")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&failure)
+		err := fmt.Errorf("GitHub responded with status %d: %s", resp.StatusCode, failure.Message)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			// A 403 caused by the rate limit says so in its remaining quota, and is retried
+			if resp.StatusCode != http.StatusForbidden || resp.Header.Get("X-RateLimit-Remaining") != "0" {
+				err = fmt.Errorf("%w: %v", errGitHubRejected, err)
+			}
+		}
+		return err
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode GitHub response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// incidentBatchSize is the number of failures recorded, and incident events delivered, per query
+const incidentBatchSize = 100
+
+// Limits of the incident management APIs
+const (
+	pagerDutyMaxSummary = 1024
+	opsgenieMaxMessage  = 130
+)
+
+// incidentSource names DeployKnot as the origin of incidents
+const incidentSource = "deployknot"
+
+// errIncidentServiceUnknown is returned for an incident whose service is not configured
+var errIncidentServiceUnknown = errors.New("incident service is not configured")
+
+// IncidentReporter raises incidents in PagerDuty or Opsgenie for the failed deployments of projects
+// with an incident policy, and resolves them once a later deployment of the environment completes.
+// Events are recorded in the database before they are delivered, so failed deliveries are retried.
+type IncidentReporter struct {
+	repo       *database.Repository
+	services   map[string]config.IncidentService
+	config     config.IncidentConfig
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewIncidentReporter creates a new incident reporter delivering to the configured incident services
+func NewIncidentReporter(repo *database.Repository, cfg config.IncidentConfig, logger *logrus.Logger) *IncidentReporter {
+	return &IncidentReporter{
+		repo:       repo,
+		services:   cfg.ServiceKeys(),
+		config:     cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+	}
+}
+
+// Run records failures and fixes and delivers incident events every interval until ctx is cancelled
+func (r *IncidentReporter) Run(ctx context.Context) {
+	r.logger.WithFields(logrus.Fields{
+		"interval": r.config.Interval,
+		"services": len(r.services),
+	}).Info("Starting incident reporter")
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sweep(ctx); err != nil && ctx.Err() == nil {
+			r.logger.WithError(err).Error("Incident sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep adds new failures to incidents, resolves the incidents of fixed environments, delivers
+// pending incident events and returns how many were delivered
+func (r *IncidentReporter) Sweep(ctx context.Context) (int, error) {
+	for ctx.Err() == nil {
+		failures, err := r.repo.GetUnreportedIncidentFailures(incidentBatchSize)
+		if err != nil {
+			return 0, err
+		}
+		for _, failure := range failures {
+			if _, err := r.repo.RecordIncidentFailure(failure); err != nil {
+				return 0, err
+			}
+		}
+		if len(failures) < incidentBatchSize {
+			break
+		}
+	}
+
+	if _, err := r.repo.ResolveDeploymentIncidents(); err != nil {
+		return 0, err
+	}
+
+	incidents, err := r.repo.GetPendingIncidentEvents(incidentBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, incident := range incidents {
+		if ctx.Err() != nil {
+			break
+		}
+		event := *incident.PendingEvent
+		logger := r.logger.WithFields(logrus.Fields{
+			"incident_id": incident.ID,
+			"project":     incident.ProjectName,
+			"environment": incident.Environment,
+			"service":     incident.Service,
+			"event":       event,
+		})
+
+		err := r.deliver(ctx, incident, event)
+		switch {
+		case err == nil:
+			if err := r.repo.CompleteIncidentEvent(incident.ID, event); err != nil {
+				return delivered, err
+			}
+			logger.Info("Incident event delivered")
+			delivered++
+		case errors.Is(err, errIncidentServiceUnknown):
+			// Retrying cannot help a policy naming a service this server does not know
+			logger.Warn("Incident event dropped: incident service is not configured")
+			if err := r.repo.FailIncidentEvent(incident.ID, event, err.Error(), false); err != nil {
+				return delivered, err
+			}
+		default:
+			logger.WithError(err).Error("Failed to deliver incident event; it will be retried")
+			if err := r.repo.FailIncidentEvent(incident.ID, event, err.Error(), true); err != nil {
+				return delivered, err
+			}
+		}
+	}
+	return delivered, nil
+}
+
+// incidentContext describes the deployment behind an incident event
+type incidentContext struct {
+	summary string
+	// class is deployment_failure, or post_deploy_health when a step checking the deployed
+	// application failed
+	class   string
+	details map[string]string
+}
+
+// deliver sends an incident event to the incident's service
+func (r *IncidentReporter) deliver(ctx context.Context, incident *models.DeploymentIncident, event models.IncidentEvent) error {
+	service, ok := r.services[incident.Service]
+	if !ok {
+		return errIncidentServiceUnknown
+	}
+	described, err := r.describe(incident, event)
+	if err != nil {
+		return err
+	}
+
+	switch service.Provider {
+	case config.IncidentProviderOpsgenie:
+		return r.sendOpsgenie(ctx, service.Key, incident, event, described)
+	default:
+		return r.sendPagerDuty(ctx, service.Key, incident, event, described)
+	}
+}
+
+// describe summarizes the failed deployment of a trigger event, or the deployment that fixed the
+// environment of a resolve event
+func (r *IncidentReporter) describe(incident *models.DeploymentIncident, event models.IncidentEvent) (*incidentContext, error) {
+	environment := incident.Environment
+	if environment == "" {
+		environment = "(unnamed)"
+	}
+	described := &incidentContext{
+		class: "deployment_failure",
+		details: map[string]string{
+			"project":     incident.ProjectName,
+			"environment": environment,
+			"failures":    strconv.Itoa(incident.Failures),
+		},
+	}
+
+	contacts, err := r.repo.GetProjectContacts(incident.ProjectName, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if contacts != nil {
+		if contacts.Owner != nil {
+			described.details["owner"] = *contacts.Owner
+		}
+		if contacts.OnCall != nil {
+			described.details["on_call"] = contacts.OnCall.Name
+			if contacts.OnCall.Contact != nil {
+				described.details["on_call_contact"] = *contacts.OnCall.Contact
+			}
+		}
+	}
+
+	if event == models.IncidentEventResolve {
+		described.summary = fmt.Sprintf("%s %s: fixed by a later deployment", incident.ProjectName, environment)
+		if incident.ResolvedByDeploymentID != nil {
+			described.summary = fmt.Sprintf("%s %s: fixed by deployment %s", incident.ProjectName, environment, *incident.ResolvedByDeploymentID)
+			described.details["resolved_by_deployment_id"] = incident.ResolvedByDeploymentID.String()
+		}
+		return described, nil
+	}
+
+	described.summary = fmt.Sprintf("%s %s: deployment failed", incident.ProjectName, environment)
+	if incident.DeploymentID == nil {
+		return described, nil
+	}
+	deployment, err := r.repo.GetDeployment(*incident.DeploymentID)
+	if err != nil {
+		return nil, err
+	}
+	if deployment == nil {
+		return described, nil
+	}
+	steps, err := r.repo.GetDeploymentSteps(deployment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	described.details["deployment_id"] = deployment.ID.String()
+	described.details["github_repo_url"] = deployment.GitHubRepoURL
+	described.details["github_branch"] = deployment.GitHubBranch
+	if deployment.CommitSHA != nil {
+		described.details["commit_sha"] = *deployment.CommitSHA
+	}
+	if deployment.CreatedBy != nil {
+		described.details["created_by"] = *deployment.CreatedBy
+	}
+	if deployment.ErrorMessage != nil {
+		described.details["error_message"] = *deployment.ErrorMessage
+	}
+
+	for _, step := range steps {
+		if step.Status != models.DeploymentStatusFailed {
+			continue
+		}
+		described.details["failed_step"] = step.StepName
+		if models.IsPostDeployStep(step.StepName) {
+			described.class = "post_deploy_health"
+			described.summary = fmt.Sprintf("%s %s: post-deploy %s failed", incident.ProjectName, environment, step.StepName)
+		} else {
+			described.summary = fmt.Sprintf("%s %s: deployment failed in %s", incident.ProjectName, environment, step.StepName)
+		}
+		break
+	}
+	if rolledBack(steps) {
+		described.summary += " (rolled back to the previous image)"
+		described.details["rolled_back"] = "true"
+	}
+	return described, nil
+}
+
+// sendPagerDuty sends an event to the PagerDuty Events API v2; the incident's dedup key makes
+// repeated triggers update one PagerDuty incident
+func (r *IncidentReporter) sendPagerDuty(ctx context.Context, routingKey string, incident *models.DeploymentIncident, event models.IncidentEvent, described *incidentContext) error {
+	body := map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": string(event),
+		"dedup_key":    incident.DedupKey(),
+	}
+	if event == models.IncidentEventTrigger {
+		body["payload"] = map[string]interface{}{
+			"summary":        truncateText(described.summary, pagerDutyMaxSummary),
+			"source":         incidentSource,
+			"severity":       string(incident.Severity),
+			"component":      incident.ProjectName,
+			"group":          incident.Environment,
+			"class":          described.class,
+			"custom_details": described.details,
+		}
+	}
+	return r.post(ctx, r.config.PagerDutyEventsURL, nil, body)
+}
+
+// sendOpsgenie creates or closes an Opsgenie alert; the incident's dedup key is the alert alias, so
+// repeated triggers add to one alert
+func (r *IncidentReporter) sendOpsgenie(ctx context.Context, apiKey string, incident *models.DeploymentIncident, event models.IncidentEvent, described *incidentContext) error {
+	headers := map[string]string{"Authorization": "GenieKey " + apiKey}
+	if event == models.IncidentEventResolve {
+		endpoint := r.config.OpsgenieAPIURL + "/v2/alerts/" + url.PathEscape(incident.DedupKey()) + "/close?identifierType=alias"
+		return r.post(ctx, endpoint, headers, map[string]interface{}{
+			"source": incidentSource,
+			"note":   described.summary,
+		})
+	}
+
+	tags := []string{incidentSource, described.class}
+	if incident.Environment != "" {
+		tags = append(tags, incident.Environment)
+	}
+	return r.post(ctx, r.config.OpsgenieAPIURL+"/v2/alerts", headers, map[string]interface{}{
+		"message":     truncateText(described.summary, opsgenieMaxMessage),
+		"alias":       incident.DedupKey(),
+		"description": described.summary,
+		"priority":    incident.Severity.OpsgeniePriority(),
+		"source":      incidentSource,
+		"entity":      incident.ProjectName,
+		"tags":        tags,
+		"details":     described.details,
+	})
+}
+
+// post sends a JSON request to an incident management API
+func (r *IncidentReporter) post(ctx context.Context, endpoint string, headers map[string]string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal incident event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create incident request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("incident request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("incident service responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// truncateText shortens text to at most max characters
+func truncateText(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
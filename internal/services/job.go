@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// JobService serves the history of deployment jobs kept in the jobs table
+type JobService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewJobService creates a new job service
+func NewJobService(repo *database.Repository, logger *logrus.Logger) *JobService {
+	return &JobService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ListJobs returns the jobs of userID's deployments matching filter, newest first. Administrators
+// see every job.
+func (s *JobService) ListJobs(ctx context.Context, userID uuid.UUID, filter models.JobFilter, limit, offset int) ([]*models.JobRecord, error) {
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	filter.UserID = owner
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return repo.ListJobs(filter, limit, offset)
+}
+
+// GetJob returns a job of one of userID's deployments, or any job to an administrator
+func (s *JobService) GetJob(ctx context.Context, userID, id uuid.UUID) (*models.JobRecord, error) {
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	job, err := repo.GetJobRecord(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// ownerFilter returns nil for administrators, who see every job, and userID otherwise
+func (s *JobService) ownerFilter(userID uuid.UUID) (*uuid.UUID, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && user.Role == models.RoleAdmin {
+		return nil, nil
+	}
+	return &userID, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"deployknot/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// JobQueue holds the pending jobs of each worker pool in the order they run; "" is the default
+// pool. Whatever the backend, the jobs themselves, locks and worker heartbeats stay in Redis.
+type JobQueue interface {
+	// Push appends a job to the queue of a pool
+	Push(ctx context.Context, pool string, job []byte) error
+	// Pop removes the next job from the queue of a pool, waiting up to timeout for one; it
+	// returns nil when none arrived
+	Pop(ctx context.Context, pool string, timeout time.Duration) ([]byte, error)
+	// Len returns the number of jobs in the queue of a pool
+	Len(ctx context.Context, pool string) (int64, error)
+	// Oldest returns the job that has waited longest in the queue of a pool, or nil when it is empty
+	Oldest(ctx context.Context, pool string) ([]byte, error)
+	// Close releases the connections of the backend
+	Close() error
+}
+
+// NewJobQueue creates the job queue backend selected by QUEUE_BACKEND
+func NewJobQueue(cfg config.QueueConfig, redisClient *redis.Client, logger *logrus.Logger) (JobQueue, error) {
+	switch cfg.Backend {
+	case "", config.QueueBackendRedis:
+		return &redisJobQueue{redis: redisClient}, nil
+	case config.QueueBackendMemory:
+		logger.Info("Keeping the deployment queue in memory")
+		return newMemoryJobQueue(), nil
+	case config.QueueBackendNATS:
+		return newNATSJobQueue(cfg, logger)
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.Backend)
+	}
+}
+
+// redisJobQueue keeps each pool's queue in a Redis list; jobs are pushed on the left and popped
+// from the right
+type redisJobQueue struct {
+	redis *redis.Client
+}
+
+func (q *redisJobQueue) Push(ctx context.Context, pool string, job []byte) error {
+	return q.redis.LPush(ctx, poolQueueKey(pool), job).Err()
+}
+
+func (q *redisJobQueue) Pop(ctx context.Context, pool string, timeout time.Duration) ([]byte, error) {
+	result, err := q.redis.BRPop(ctx, timeout, poolQueueKey(pool)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(result) < 2 {
+		return nil, fmt.Errorf("invalid queue result")
+	}
+	return []byte(result[1]), nil
+}
+
+func (q *redisJobQueue) Len(ctx context.Context, pool string) (int64, error) {
+	return q.redis.LLen(ctx, poolQueueKey(pool)).Result()
+}
+
+func (q *redisJobQueue) Oldest(ctx context.Context, pool string) ([]byte, error) {
+	job, err := q.redis.LIndex(ctx, poolQueueKey(pool), -1).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return []byte(job), nil
+}
+
+// Close leaves the Redis client to its owner
+func (q *redisJobQueue) Close() error {
+	return nil
+}
+
+// memoryJobQueue keeps each pool's queue in the server's memory, for single-binary installs where
+// the embedded worker and the worker API are the only consumers. Queued jobs are lost on restart.
+type memoryJobQueue struct {
+	mu     sync.Mutex
+	queues map[string][][]byte
+	// pushed is closed and replaced whenever a job is pushed, to wake the waiting consumers
+	pushed chan struct{}
+}
+
+func newMemoryJobQueue() *memoryJobQueue {
+	return &memoryJobQueue{
+		queues: make(map[string][][]byte),
+		pushed: make(chan struct{}),
+	}
+}
+
+func (q *memoryJobQueue) Push(ctx context.Context, pool string, job []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queues[pool] = append(q.queues[pool], job)
+	close(q.pushed)
+	q.pushed = make(chan struct{})
+	return nil
+}
+
+func (q *memoryJobQueue) Pop(ctx context.Context, pool string, timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		if queue := q.queues[pool]; len(queue) > 0 {
+			job := queue[0]
+			queue[0] = nil
+			q.queues[pool] = queue[1:]
+			q.mu.Unlock()
+			return job, nil
+		}
+		pushed := q.pushed
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, nil
+		case <-pushed:
+		}
+	}
+}
+
+func (q *memoryJobQueue) Len(ctx context.Context, pool string) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.queues[pool])), nil
+}
+
+func (q *memoryJobQueue) Oldest(ctx context.Context, pool string) ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queue := q.queues[pool]; len(queue) > 0 {
+		return queue[0], nil
+	}
+	return nil, nil
+}
+
+func (q *memoryJobQueue) Close() error {
+	return nil
+}
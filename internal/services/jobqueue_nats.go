@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"deployknot/internal/config"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/sirupsen/logrus"
+)
+
+// natsJobSubject is the subject of the default pool's jobs; the jobs of a named pool are published
+// below it
+const natsJobSubject = "deployknot.jobs"
+
+// natsFetchWait bounds each wait for a job, since fetches do not stop when their context is cancelled
+const natsFetchWait = 5 * time.Second
+
+// natsJobQueue keeps the queues in a JetStream work-queue stream, which removes a job once a worker
+// acknowledged it, for installations running several servers on a replicated NATS cluster. Each
+// pool has a durable consumer shared by all of its workers.
+type natsJobQueue struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	stream jetstream.Stream
+	// consumers caches the consumer of each pool
+	consumers sync.Map
+}
+
+func newNATSJobQueue(cfg config.QueueConfig, logger *logrus.Logger) (*natsJobQueue, error) {
+	conn, err := nats.Connect(cfg.NATSURL, nats.Name("deployknot"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        cfg.NATSStream,
+		Description: "DeployKnot deployment jobs",
+		Subjects:    []string{natsJobSubject, natsJobSubject + ".>"},
+		Retention:   jetstream.WorkQueuePolicy,
+		Storage:     jetstream.FileStorage,
+		Replicas:    cfg.NATSReplicas,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream stream %s: %w", cfg.NATSStream, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"stream":   cfg.NATSStream,
+		"replicas": cfg.NATSReplicas,
+	}).Info("Keeping the deployment queue in NATS JetStream")
+	return &natsJobQueue{conn: conn, js: js, stream: stream}, nil
+}
+
+// natsPoolSubject is the subject the jobs of a pool are published on
+func natsPoolSubject(pool string) string {
+	if pool == "" {
+		return natsJobSubject
+	}
+	return natsJobSubject + "." + pool
+}
+
+// natsPoolConsumer names the durable consumer of a pool. Consumer names cannot contain dots, which
+// pool names can, and "~" cannot appear in a pool name.
+func natsPoolConsumer(pool string) string {
+	if pool == "" {
+		return "deployknot-jobs"
+	}
+	return "deployknot-jobs-" + strings.ReplaceAll(pool, ".", "~")
+}
+
+// consumer returns the consumer of a pool, creating it on first use
+func (q *natsJobQueue) consumer(ctx context.Context, pool string) (jetstream.Consumer, error) {
+	if consumer, ok := q.consumers.Load(pool); ok {
+		return consumer.(jetstream.Consumer), nil
+	}
+	consumer, err := q.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       natsPoolConsumer(pool),
+		FilterSubject: natsPoolSubject(pool),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream consumer: %w", err)
+	}
+	q.consumers.Store(pool, consumer)
+	return consumer, nil
+}
+
+func (q *natsJobQueue) Push(ctx context.Context, pool string, job []byte) error {
+	_, err := q.js.Publish(ctx, natsPoolSubject(pool), job)
+	return err
+}
+
+func (q *natsJobQueue) Pop(ctx context.Context, pool string, timeout time.Duration) ([]byte, error) {
+	consumer, err := q.consumer(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for wait := time.Until(deadline); wait > 0 && ctx.Err() == nil; wait = time.Until(deadline) {
+		batch, err := consumer.Fetch(1, jetstream.FetchMaxWait(min(wait, natsFetchWait)))
+		if err != nil {
+			return nil, err
+		}
+		for msg := range batch.Messages() {
+			// Like a pop from a Redis list, the job leaves the queue at once; the deployment lock
+			// and the watchdog cover a worker that dies holding it
+			if err := msg.DoubleAck(ctx); err != nil {
+				return nil, fmt.Errorf("failed to acknowledge job: %w", err)
+			}
+			return msg.Data(), nil
+		}
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+			return nil, err
+		}
+	}
+	return nil, ctx.Err()
+}
+
+func (q *natsJobQueue) Len(ctx context.Context, pool string) (int64, error) {
+	consumer, err := q.consumer(ctx, pool)
+	if err != nil {
+		return 0, err
+	}
+	info, err := consumer.Info(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int64(info.NumPending), nil
+}
+
+func (q *natsJobQueue) Oldest(ctx context.Context, pool string) ([]byte, error) {
+	msg, err := q.stream.GetMsg(ctx, 1, jetstream.WithGetMsgSubject(natsPoolSubject(pool)))
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return msg.Data, nil
+}
+
+func (q *natsJobQueue) Close() error {
+	return q.conn.Drain()
+}
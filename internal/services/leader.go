@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"deployknot/internal/config"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// leaderKey holds the ID of the server that runs the background components
+const leaderKey = "deployknot:leader"
+
+// renewLeaseScript extends the lease only if it is still held by the given owner
+var renewLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// LeaderElector elects one of the servers sharing a Redis to run the background components, which
+// would duplicate their work on every server otherwise. The leader holds a lease in Redis and
+// renews it; when it stops renewing, another server takes over once the lease expires.
+type LeaderElector struct {
+	redis  *redis.Client
+	config config.LeaderElectionConfig
+	id     string
+	leader atomic.Bool
+	logger *logrus.Logger
+}
+
+// NewLeaderElector creates a new leader elector
+func NewLeaderElector(redisClient *redis.Client, cfg config.LeaderElectionConfig, logger *logrus.Logger) *LeaderElector {
+	hostname, _ := os.Hostname()
+	return &LeaderElector{
+		redis:  redisClient,
+		config: cfg,
+		// A restarted server must not mistake its predecessor's lease for its own
+		id:     fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8]),
+		logger: logger,
+	}
+}
+
+// IsLeader reports whether the server currently runs the background components
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run calls lead whenever the server becomes the leader, and cancels the context passed to it when
+// the server loses leadership; lead must return once its context is done. Without leader election
+// the server always leads. Run returns when ctx is cancelled, after lead returned and the lease
+// was released.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	if !e.config.Enabled {
+		e.leader.Store(true)
+		lead(ctx)
+		e.leader.Store(false)
+		return
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"id":             e.id,
+		"lease_ttl":      e.config.LeaseTTL,
+		"renew_interval": e.config.RenewInterval,
+	}).Info("Starting leader election")
+
+	ticker := time.NewTicker(e.config.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.redis.SetNX(ctx, leaderKey, e.id, e.config.LeaseTTL).Result()
+		if err != nil && ctx.Err() == nil {
+			e.logger.WithError(err).Warn("Failed to acquire leadership")
+		}
+		if acquired {
+			e.leadUntilLost(ctx, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// leadUntilLost runs lead while the server keeps renewing its lease, and releases the lease when
+// ctx is cancelled
+func (e *LeaderElector) leadUntilLost(ctx context.Context, lead func(ctx context.Context)) {
+	e.logger.WithField("id", e.id).Info("Became leader, starting background components")
+	e.leader.Store(true)
+	leaderCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leaderCtx)
+	}()
+	defer func() {
+		stop()
+		<-done
+		e.leader.Store(false)
+	}()
+
+	// Stop leading one renewal before the lease would expire, so the components have stopped by
+	// the time another server can take over
+	renewed := time.Now()
+	ticker := time.NewTicker(e.config.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stop()
+			<-done
+			// Hand over at once instead of leaving the other servers to wait for the lease to expire
+			release, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := releaseLockScript.Run(release, e.redis, []string{leaderKey}, e.id).Err(); err != nil {
+				e.logger.WithError(err).Warn("Failed to release leadership")
+			} else {
+				e.logger.WithField("id", e.id).Info("Released leadership")
+			}
+			return
+		case <-ticker.C:
+		}
+
+		held, err := renewLeaseScript.Run(ctx, e.redis, []string{leaderKey}, e.id, e.config.LeaseTTL.Milliseconds()).Int()
+		switch {
+		case err == nil && held == 1:
+			renewed = time.Now()
+		case err == nil:
+			e.logger.WithField("id", e.id).Warn("Lost leadership, stopping background components")
+			return
+		case ctx.Err() != nil:
+		case time.Since(renewed) >= e.config.LeaseTTL-e.config.RenewInterval:
+			e.logger.WithError(err).Warn("Could not renew leadership in time, stopping background components")
+			return
+		default:
+			e.logger.WithError(err).Warn("Failed to renew leadership")
+		}
+	}
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// logSinkSettle is how old a log entry must be before it is shipped. Entries are numbered when
+// they are inserted, so one committed late could otherwise fall behind a sink's cursor.
+const logSinkSettle = time.Second
+
+// Limits of the log sink APIs
+const (
+	// shippedMessageMax caps a shipped message; CloudWatch Logs rejects events over 256 KB
+	shippedMessageMax = 200 * 1024
+	// cloudWatchMaxBatchBytes is the size limit of a PutLogEvents request, counting 26 bytes per event
+	cloudWatchMaxBatchBytes = 1024 * 1024
+	cloudWatchEventOverhead = 26
+)
+
+// cloudWatchLogStream is the log stream DeployKnot writes to in a CloudWatch Logs log group
+const cloudWatchLogStream = "deployknot"
+
+// logSinkClient sends deployment logs to one external logging system
+type logSinkClient interface {
+	send(ctx context.Context, logs []*models.ShippedLog) error
+}
+
+// logSink is a configured log sink and its retry state
+type logSink struct {
+	name     string
+	kind     string
+	client   logSinkClient
+	failures int
+	retryAt  time.Time
+}
+
+// LogShipper mirrors deployment logs to external logging systems such as Loki, Elasticsearch and
+// CloudWatch Logs. PostgreSQL stays the source of truth: each sink has a cursor in the database
+// that only moves once a batch was accepted, so a sink that is down receives the logs it missed
+// when it comes back.
+type LogShipper struct {
+	repo   *database.Repository
+	sinks  []*logSink
+	config config.LogSinkConfig
+	logger *logrus.Logger
+}
+
+// NewLogShipper creates a new log shipper for the configured log sinks
+func NewLogShipper(repo *database.Repository, cfg config.LogSinkConfig, logger *logrus.Logger) *LogShipper {
+	httpClient := &http.Client{Timeout: cfg.Timeout}
+	shipper := &LogShipper{repo: repo, config: cfg, logger: logger}
+	for _, sink := range cfg.SinkTargets() {
+		var client logSinkClient
+		switch sink.Kind {
+		case config.LogSinkLoki:
+			client = newLokiSink(httpClient, sink.Target)
+		case config.LogSinkElasticsearch:
+			client = newElasticsearchSink(httpClient, sink.Target)
+		case config.LogSinkCloudWatch:
+			client = newCloudWatchSink(httpClient, sink.Target, cfg)
+		default:
+			continue
+		}
+		shipper.sinks = append(shipper.sinks, &logSink{name: sink.Name, kind: sink.Kind, client: client})
+	}
+	return shipper
+}
+
+// Run ships new deployment logs every interval until ctx is cancelled
+func (s *LogShipper) Run(ctx context.Context) {
+	s.logger.WithFields(logrus.Fields{
+		"interval":   s.config.Interval,
+		"batch_size": s.config.BatchSize,
+		"sinks":      len(s.sinks),
+	}).Info("Starting log shipper")
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Ship(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ship sends every sink the logs it has not received yet, batch by batch, and returns how many
+// entries were shipped. A sink that fails is retried after a delay that doubles with every
+// failure, up to the maximum backoff, while the other sinks carry on.
+func (s *LogShipper) Ship(ctx context.Context) int {
+	total := 0
+	for _, sink := range s.sinks {
+		if ctx.Err() != nil {
+			break
+		}
+		if time.Now().Before(sink.retryAt) {
+			continue
+		}
+
+		for ctx.Err() == nil {
+			shipped, err := s.repo.ShipDeploymentLogs(sink.name, s.config.BatchSize, time.Now().Add(-logSinkSettle), func(logs []*models.ShippedLog) error {
+				return sink.client.send(ctx, logs)
+			})
+			total += shipped
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				sink.failures++
+				backoff := s.backoff(sink.failures)
+				sink.retryAt = time.Now().Add(backoff)
+				s.logger.WithError(err).WithFields(logrus.Fields{
+					"sink":     sink.name,
+					"kind":     sink.kind,
+					"failures": sink.failures,
+					"retry_in": backoff.String(),
+				}).Error("Failed to ship deployment logs; they will be retried")
+				break
+			}
+			if sink.failures > 0 {
+				s.logger.WithFields(logrus.Fields{
+					"sink":     sink.name,
+					"failures": sink.failures,
+				}).Info("Log sink recovered")
+				sink.failures = 0
+			}
+			if shipped < s.config.BatchSize {
+				break
+			}
+		}
+	}
+	return total
+}
+
+// backoff is the delay before retrying a sink after its nth consecutive failure
+func (s *LogShipper) backoff(failures int) time.Duration {
+	backoff := s.config.Interval
+	for i := 1; i < failures && backoff < s.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.config.MaxBackoff {
+		return s.config.MaxBackoff
+	}
+	return backoff
+}
+
+// shippedLogRecord is the JSON document of a deployment log entry in a log sink
+type shippedLogRecord struct {
+	Timestamp    time.Time            `json:"@timestamp"`
+	Seq          int64                `json:"seq"`
+	DeploymentID uuid.UUID            `json:"deployment_id"`
+	Project      *string              `json:"project,omitempty"`
+	Deployment   *string              `json:"deployment,omitempty"`
+	Level        models.LogLevel      `json:"level"`
+	Category     *models.LogCategory  `json:"category,omitempty"`
+	EventCode    *models.LogEventCode `json:"event_code,omitempty"`
+	Params       map[string]string    `json:"params,omitempty"`
+	Task         *string              `json:"task,omitempty"`
+	StepOrder    *int                 `json:"step_order,omitempty"`
+	Message      string               `json:"message"`
+}
+
+// newShippedLogRecord describes a log entry for a sink, shortening very long messages
+func newShippedLogRecord(log *models.ShippedLog) *shippedLogRecord {
+	message := log.Message
+	if len(message) > shippedMessageMax {
+		message = truncateText(message, shippedMessageMax/4)
+	}
+	return &shippedLogRecord{
+		Timestamp:    log.CreatedAt.UTC(),
+		Seq:          log.Seq,
+		DeploymentID: log.DeploymentID,
+		Project:      log.ProjectName,
+		Deployment:   log.DeploymentName,
+		Level:        log.LogLevel,
+		Category:     log.Category,
+		EventCode:    log.EventCode,
+		Params:       log.Params,
+		Task:         log.TaskName,
+		StepOrder:    log.StepOrder,
+		Message:      message,
+	}
+}
+
+// sinkEndpoint splits the basic auth credentials off a sink URL
+func sinkEndpoint(target string) (string, *url.Userinfo) {
+	u, err := url.Parse(target)
+	if err != nil || u.User == nil {
+		return target, nil
+	}
+	user := u.User
+	u.User = nil
+	return u.String(), user
+}
+
+// postToSink sends a request body to a log sink and returns the response body of a successful
+// response
+func postToSink(ctx context.Context, client *http.Client, endpoint string, user *url.Userinfo, headers map[string]string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log sink request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("log sink request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A bulk response has an item per entry
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 16*1024*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("log sink responded with status %d: %s", resp.StatusCode, truncateText(strings.TrimSpace(string(respBody)), 200))
+	}
+	return respBody, nil
+}
+
+// lokiSink pushes deployment logs to the Loki push API. Entries are grouped into streams labeled
+// with their project, level and category; everything else is in the JSON line.
+type lokiSink struct {
+	client   *http.Client
+	endpoint string
+	user     *url.Userinfo
+}
+
+func newLokiSink(client *http.Client, target string) *lokiSink {
+	endpoint, user := sinkEndpoint(target)
+	return &lokiSink{client: client, endpoint: endpoint, user: user}
+}
+
+func (s *lokiSink) send(ctx context.Context, logs []*models.ShippedLog) error {
+	type lokiStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, log := range logs {
+		labels := map[string]string{
+			"source": "deployknot",
+			"level":  string(log.LogLevel),
+		}
+		if log.ProjectName != nil {
+			labels["project"] = *log.ProjectName
+		}
+		if log.Category != nil {
+			labels["category"] = string(*log.Category)
+		}
+		key := labels["project"] + "\x00" + labels["level"] + "\x00" + labels["category"]
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+
+		line, err := json.Marshal(newShippedLogRecord(log))
+		if err != nil {
+			return fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(log.CreatedAt.UnixNano(), 10), string(line)})
+	}
+
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		push.Streams = append(push.Streams, streams[key])
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Loki push: %w", err)
+	}
+	_, err = postToSink(ctx, s.client, s.endpoint, s.user, map[string]string{"Content-Type": "application/json"}, body)
+	return err
+}
+
+// elasticsearchSink indexes deployment logs with the Elasticsearch bulk API. Documents are
+// created with the ID of their log entry, so a retried batch does not index entries twice.
+type elasticsearchSink struct {
+	client   *http.Client
+	endpoint string
+	user     *url.Userinfo
+}
+
+func newElasticsearchSink(client *http.Client, target string) *elasticsearchSink {
+	endpoint, user := sinkEndpoint(strings.TrimSuffix(target, "/"))
+	return &elasticsearchSink{client: client, endpoint: endpoint + "/_bulk", user: user}
+}
+
+func (s *elasticsearchSink) send(ctx context.Context, logs []*models.ShippedLog) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, log := range logs {
+		action := map[string]map[string]string{"create": {"_id": log.ID.String()}}
+		if err := encoder.Encode(action); err != nil {
+			return fmt.Errorf("failed to marshal bulk action: %w", err)
+		}
+		if err := encoder.Encode(newShippedLogRecord(log)); err != nil {
+			return fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+	}
+
+	respBody, err := postToSink(ctx, s.client, s.endpoint, s.user, map[string]string{"Content-Type": "application/x-ndjson"}, body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, item := range result.Items {
+		for _, outcome := range item {
+			// A conflict is an entry indexed by an earlier attempt of the batch
+			if outcome.Error == nil || outcome.Status == http.StatusConflict {
+				continue
+			}
+			return fmt.Errorf("elasticsearch rejected a log entry: %s: %s", outcome.Error.Type, outcome.Error.Reason)
+		}
+	}
+	return nil
+}
+
+// cloudWatchSink puts deployment logs into a CloudWatch Logs log group, creating its log stream on
+// first use. Requests are signed with AWS Signature Version 4.
+type cloudWatchSink struct {
+	client       *http.Client
+	endpoint     string
+	region       string
+	logGroup     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	streamReady  bool
+}
+
+func newCloudWatchSink(client *http.Client, target string, cfg config.LogSinkConfig) *cloudWatchSink {
+	region, logGroup, _ := strings.Cut(target, ":")
+	return &cloudWatchSink{
+		client:       client,
+		endpoint:     "https://logs." + region + ".amazonaws.com/",
+		region:       region,
+		logGroup:     logGroup,
+		accessKey:    cfg.AWSAccessKeyID,
+		secretKey:    cfg.AWSSecretAccessKey,
+		sessionToken: cfg.AWSSessionToken,
+	}
+}
+
+func (s *cloudWatchSink) send(ctx context.Context, logs []*models.ShippedLog) error {
+	if !s.streamReady {
+		err := s.call(ctx, "CreateLogStream", map[string]string{
+			"logGroupName":  s.logGroup,
+			"logStreamName": cloudWatchLogStream,
+		})
+		if err != nil && !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
+			return err
+		}
+		s.streamReady = true
+	}
+
+	// Events of a request must be in chronological order
+	sorted := make([]*models.ShippedLog, len(logs))
+	copy(sorted, logs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	type logEvent struct {
+		Timestamp int64  `json:"timestamp"`
+		Message   string `json:"message"`
+	}
+	var events []logEvent
+	size := 0
+	for _, log := range sorted {
+		message, err := json.Marshal(newShippedLogRecord(log))
+		if err != nil {
+			return fmt.Errorf("failed to marshal log entry: %w", err)
+		}
+		if size+len(message)+cloudWatchEventOverhead > cloudWatchMaxBatchBytes {
+			if err := s.putEvents(ctx, events); err != nil {
+				return err
+			}
+			events, size = nil, 0
+		}
+		events = append(events, logEvent{Timestamp: log.CreatedAt.UnixMilli(), Message: string(message)})
+		size += len(message) + cloudWatchEventOverhead
+	}
+	return s.putEvents(ctx, events)
+}
+
+// putEvents sends one PutLogEvents request
+func (s *cloudWatchSink) putEvents(ctx context.Context, events interface{}) error {
+	err := s.call(ctx, "PutLogEvents", map[string]interface{}{
+		"logGroupName":  s.logGroup,
+		"logStreamName": cloudWatchLogStream,
+		"logEvents":     events,
+	})
+	if err != nil && strings.Contains(err.Error(), "ResourceNotFoundException") {
+		// The log stream was deleted; create it again on the next attempt
+		s.streamReady = false
+	}
+	return err
+}
+
+// call invokes a CloudWatch Logs API action
+func (s *cloudWatchSink) call(ctx context.Context, action string, input interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CloudWatch Logs request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create CloudWatch Logs request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	signAWSRequest(req, body, s.region, "logs", s.accessKey, s.secretKey, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("CloudWatch Logs request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return fmt.Errorf("CloudWatch Logs %s responded with status %d: %s", action, resp.StatusCode, truncateText(strings.TrimSpace(string(respBody)), 200))
+	}
+	return nil
+}
+
+// signAWSRequest adds an AWS Signature Version 4 Authorization header to a request, signing all of
+// its headers and the host
+func signAWSRequest(req *http.Request, body []byte, region, service, accessKey, secretKey string, now time.Time) {
+	bodyHash := sha256.Sum256(body)
+	signAWSPayload(req, hex.EncodeToString(bodyHash[:]), region, service, accessKey, secretKey, now)
+}
+
+// signAWSPayload signs a request like signAWSRequest, given the hex SHA-256 of its body, so large
+// bodies can be hashed while they are written
+func signAWSPayload(req *http.Request, payloadHash, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
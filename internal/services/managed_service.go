@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidManagedService is returned when a managed service request is invalid
+	ErrInvalidManagedService = errors.New("invalid managed service")
+	// ErrManagedServiceExists is returned when the user already has a managed service with the same
+	// name on the target
+	ErrManagedServiceExists = errors.New("a managed service with this name already exists on the target")
+	// ErrManagedServiceNotFound is returned when a managed service does not exist or the user may
+	// not see it
+	ErrManagedServiceNotFound = errors.New("managed service not found")
+	// ErrUnknownManagedService is returned when a deployment uses a managed service its user does
+	// not have on the target
+	ErrUnknownManagedService = errors.New("unknown managed service")
+)
+
+// managedPasswordBytes is the number of random bytes of a generated password, which is hex encoded
+// so it needs no escaping in connection URLs
+const managedPasswordBytes = 24
+
+// ManagedServiceService manages the databases DeployKnot runs on targets. Deploying one runs its
+// official image with its volume; deployments on the same target that use it get its connection
+// variables.
+type ManagedServiceService struct {
+	repo        *database.Repository
+	deployments *DeploymentService
+	encryptor   *encryption.Encryptor
+	logger      *logrus.Logger
+}
+
+// NewManagedServiceService creates a new managed service service
+func NewManagedServiceService(repo *database.Repository, deployments *DeploymentService, encryptor *encryption.Encryptor, logger *logrus.Logger) *ManagedServiceService {
+	return &ManagedServiceService{
+		repo:        repo,
+		deployments: deployments,
+		encryptor:   encryptor,
+		logger:      logger,
+	}
+}
+
+// CreateManagedService creates a managed service owned by userID with a generated password. It is
+// not deployed until DeployManagedService is called.
+func (s *ManagedServiceService) CreateManagedService(ctx context.Context, userID uuid.UUID, req *models.ManagedServiceRequest) (*models.ManagedService, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManagedService, err)
+	}
+	existing, err := s.repo.GetManagedServiceByName(userID, req.TargetIP, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrManagedServiceExists
+	}
+
+	password, err := generateManagedPassword()
+	if err != nil {
+		return nil, err
+	}
+	passwordEncrypted, err := s.encryptor.Encrypt(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt managed service password: %w", err)
+	}
+
+	now := time.Now()
+	service := &models.ManagedService{
+		ID:                uuid.New(),
+		UserID:            userID,
+		Name:              req.Name,
+		Engine:            models.ManagedEngine(req.Engine),
+		Version:           req.Version,
+		TargetIP:          req.TargetIP,
+		Port:              req.Port,
+		Database:          req.Database,
+		Username:          req.Username,
+		PasswordEncrypted: passwordEncrypted,
+		Volume:            models.ManagedServiceVolume(req.Name),
+		BackupSchedule:    optionalString(strings.TrimSpace(req.BackupSchedule)),
+		BackupRetention:   req.BackupRetention,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if service.NextBackupAt, err = service.NextBackup(now); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManagedService, err)
+	}
+	if err := s.repo.CreateManagedService(service); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"managed_service_id": service.ID,
+		"user_id":            userID,
+		"engine":             service.Engine,
+		"target_ip":          service.TargetIP,
+	}).Info("Managed service created")
+
+	return service, nil
+}
+
+// ListManagedServices returns the managed services userID may see; administrators see every one
+func (s *ManagedServiceService) ListManagedServices(ctx context.Context, userID uuid.UUID) ([]*models.ManagedService, error) {
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	services, err := s.repo.ListManagedServices(owner)
+	if err != nil {
+		return nil, err
+	}
+	if services == nil {
+		services = []*models.ManagedService{}
+	}
+	return services, nil
+}
+
+// GetManagedService returns a managed service userID owns, or any one to an administrator
+func (s *ManagedServiceService) GetManagedService(ctx context.Context, userID, id uuid.UUID) (*models.ManagedService, error) {
+	service, err := s.repo.GetManagedService(id)
+	if err != nil {
+		return nil, err
+	}
+	if service == nil {
+		return nil, ErrManagedServiceNotFound
+	}
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && service.UserID != *owner {
+		return nil, ErrManagedServiceNotFound
+	}
+	return service, nil
+}
+
+// UpdateManagedService changes the version, port and backup configuration of a managed service,
+// computing its next backup again. The running container keeps its version and port until the
+// service is deployed again.
+func (s *ManagedServiceService) UpdateManagedService(ctx context.Context, userID, id uuid.UUID, req *models.ManagedServiceUpdateRequest) (*models.ManagedService, error) {
+	service, err := s.GetManagedService(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Validate(service.Engine); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManagedService, err)
+	}
+
+	service.Version = req.Version
+	service.Port = req.Port
+	service.BackupSchedule = optionalString(strings.TrimSpace(req.BackupSchedule))
+	service.BackupRetention = req.BackupRetention
+	if service.NextBackupAt, err = service.NextBackup(time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManagedService, err)
+	}
+	updated, err := s.repo.UpdateManagedService(service)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrManagedServiceNotFound
+	}
+	return service, nil
+}
+
+// DeleteManagedService deletes a managed service. Its container and volume stay on the target, so
+// no data is lost by deleting the record.
+func (s *ManagedServiceService) DeleteManagedService(ctx context.Context, userID, id uuid.UUID) error {
+	if _, err := s.GetManagedService(ctx, userID, id); err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteManagedService(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrManagedServiceNotFound
+	}
+	return nil
+}
+
+// DeployManagedService deploys a managed service to its target on behalf of userID: its container
+// is replaced by one running the configured version with the service's volume, so the data
+// survives redeployments
+func (s *ManagedServiceService) DeployManagedService(ctx context.Context, userID, id uuid.UUID, req *models.ManagedServiceDeployRequest) (*models.DeploymentResponse, error) {
+	service, err := s.GetManagedService(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	password, err := s.encryptor.Decrypt(service.PasswordEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt managed service password: %w", err)
+	}
+
+	name := service.Name
+	deploymentName := string(service.Engine)
+	deploymentReq := &models.CreateDeploymentRequest{
+		TargetIP:       service.TargetIP,
+		SSHUsername:    req.SSHUsername,
+		SSHPassword:    req.SSHPassword,
+		Port:           strconv.Itoa(service.Port),
+		ContainerName:  &name,
+		ProjectName:    &name,
+		DeploymentName: &deploymentName,
+		DeploymentType: string(models.DeploymentTypeManaged),
+		Managed: &models.ManagedServiceMember{
+			ServiceID:       service.ID,
+			Engine:          service.Engine,
+			Version:         service.Version,
+			Volume:          service.Volume,
+			EnvironmentVars: service.ContainerEnv(password),
+		},
+	}
+	if err := deploymentReq.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManagedService, err)
+	}
+
+	deployment, err := s.deployments.CreateDeploymentWithEnvFile(ctx, deploymentReq, "", userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetManagedServiceDeployment(service.ID, deployment.ID); err != nil {
+		s.logger.WithError(err).WithField("managed_service_id", service.ID).Warn("Failed to record managed service deployment")
+	}
+	return deployment, nil
+}
+
+// GetConnection returns the variables applications connect to a managed service with, the same
+// ones deployments using it get
+func (s *ManagedServiceService) GetConnection(ctx context.Context, userID, id uuid.UUID) (map[string]string, error) {
+	service, err := s.GetManagedService(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	password, err := s.encryptor.Decrypt(service.PasswordEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt managed service password: %w", err)
+	}
+	connection := map[string]string{}
+	for _, env := range models.FromEnvFile(strings.Join(service.ConnectionEnv(service.TargetIP, password), "\n")) {
+		connection[env.Key] = env.Value
+	}
+	return connection, nil
+}
+
+// ownerFilter returns the owner managed services are filtered by for userID, or nil for
+// administrators, who see every service
+func (s *ManagedServiceService) ownerFilter(userID uuid.UUID) (*uuid.UUID, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && user.Role == models.RoleAdmin {
+		return nil, nil
+	}
+	return &userID, nil
+}
+
+// managedServiceEnv returns the connection variables of the managed services a deployment uses,
+// which userID must have on the deployment's target. The URL of a service is also passed as
+// DATABASE_URL or REDIS_URL when it is the only one of its kind.
+func (s *DeploymentService) managedServiceEnv(userID *uuid.UUID, targetIP string, names []string) (string, error) {
+	if userID == nil {
+		return "", fmt.Errorf("%w: managed services belong to users, and the deployment has none", ErrUnknownManagedService)
+	}
+
+	var lines []string
+	conventional := map[string][]string{}
+	for _, name := range names {
+		service, err := s.repo.GetManagedServiceByName(*userID, targetIP, name)
+		if err != nil {
+			return "", err
+		}
+		if service == nil {
+			return "", fmt.Errorf("%w %q on %s", ErrUnknownManagedService, name, targetIP)
+		}
+		password, err := s.encryptor.Decrypt(service.PasswordEncrypted)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt managed service password: %w", err)
+		}
+		lines = append(lines, service.ConnectionEnv(targetIP, password)...)
+		envName := service.ConventionalEnvName()
+		conventional[envName] = append(conventional[envName], envName+"="+service.URL(targetIP, password))
+	}
+	for _, envName := range []string{"DATABASE_URL", "REDIS_URL"} {
+		if len(conventional[envName]) == 1 {
+			lines = append(lines, conventional[envName][0])
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// generateManagedPassword returns a random password for a managed service
+func generateManagedPassword() (string, error) {
+	buf := make([]byte, managedPasswordBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate managed service password: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
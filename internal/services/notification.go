@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// escalationBatchSize is the number of due escalations sent per query
+const escalationBatchSize = 100
+
+// Bounds of a deployment digest: how far back the first digest of a project looks, how many
+// deployments it summarizes and how many failures it lists
+const (
+	digestDefaultPeriod  = 24 * time.Hour
+	digestMaxDeployments = 1000
+	digestMaxFailures    = 10
+)
+
+// digestStatusOrder is the order statuses are listed in digests
+var digestStatusOrder = []models.DeploymentStatus{
+	models.DeploymentStatusCompleted,
+	models.DeploymentStatusFailed,
+	models.DeploymentStatusCancelled,
+	models.DeploymentStatusAborted,
+	models.DeploymentStatusRunning,
+	models.DeploymentStatusPending,
+}
+
+// Notifier sends the notifications projects configure beyond the immediate ones: deployment digests
+// on their cron schedule, and escalations of deployments that stay failed
+type Notifier struct {
+	repo       *database.Repository
+	channels   map[string]string
+	config     config.NotificationConfig
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewNotifier creates a new notifier delivering to the configured notification channels
+func NewNotifier(repo *database.Repository, cfg config.NotificationConfig, logger *logrus.Logger) *Notifier {
+	return &Notifier{
+		repo:       repo,
+		channels:   cfg.ChannelURLs(),
+		config:     cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+	}
+}
+
+// Run sends due digests and escalations every interval until ctx is cancelled
+func (n *Notifier) Run(ctx context.Context) {
+	n.logger.WithFields(logrus.Fields{
+		"interval": n.config.Interval,
+		"channels": len(n.channels),
+	}).Info("Starting notifier")
+
+	ticker := time.NewTicker(n.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := n.Sweep(ctx); err != nil && ctx.Err() == nil {
+			n.logger.WithError(err).Error("Notification sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep sends every due digest and escalation and returns how many notifications were sent. Each
+// notification is claimed by one server before it is sent.
+func (n *Notifier) Sweep(ctx context.Context) (int, error) {
+	digests, err := n.sendDigests(ctx)
+	if err != nil {
+		return digests, err
+	}
+	escalations, err := n.sendEscalations(ctx)
+	return digests + escalations, err
+}
+
+// sendDigests schedules new digests and sends the due ones, returning how many were sent
+func (n *Notifier) sendDigests(ctx context.Context) (int, error) {
+	digests, err := n.repo.ListProjectDigests()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	now := time.Now()
+	for _, digest := range digests {
+		if ctx.Err() != nil {
+			break
+		}
+		logger := n.logger.WithField("project", digest.ProjectName)
+
+		next, err := digest.NextSend(now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to schedule deployment digest")
+			continue
+		}
+		if digest.NextSendAt == nil {
+			if _, err := n.repo.AdvanceProjectDigest(digest.ProjectID, nil, next, false); err != nil {
+				logger.WithError(err).Error("Failed to schedule deployment digest")
+			}
+			continue
+		}
+		if digest.NextSendAt.After(now) {
+			continue
+		}
+
+		claimed, err := n.repo.AdvanceProjectDigest(digest.ProjectID, digest.NextSendAt, next, true)
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim deployment digest")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		from := now.Add(-digestDefaultPeriod)
+		if digest.LastSentAt != nil {
+			from = *digest.LastSentAt
+		}
+		notification, err := n.digest(digest.ProjectName, from, now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to build deployment digest")
+			continue
+		}
+		// A project without deployments in the period has nothing to report
+		if notification == nil {
+			continue
+		}
+		if err := n.addContacts(notification); err != nil {
+			logger.WithError(err).Error("Failed to get project contacts for deployment digest")
+			continue
+		}
+		if err := n.send(ctx, digest.Channel, notification); err != nil {
+			logger.WithError(err).WithField("channel", digest.Channel).Error("Failed to send deployment digest")
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// digest summarizes the deployments of a project created from from up to to, or returns nil when
+// there were none
+func (n *Notifier) digest(project string, from, to time.Time) (*models.Notification, error) {
+	deployments, err := n.repo.ListDeployments(models.DeploymentFilter{
+		ProjectName:   &project,
+		CreatedAfter:  &from,
+		CreatedBefore: &to,
+	}, digestMaxDeployments, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(deployments) == 0 {
+		return nil, nil
+	}
+
+	summary := &models.DeploymentDigest{
+		From:         from,
+		To:           to,
+		Total:        len(deployments),
+		Statuses:     make(map[models.DeploymentStatus]int),
+		Environments: make(map[string]models.DeploymentStatus),
+	}
+	// Deployments are listed newest first
+	for _, deployment := range deployments {
+		summary.Statuses[deployment.Status]++
+		if deployment.DeploymentName != nil {
+			if _, seen := summary.Environments[*deployment.DeploymentName]; !seen {
+				summary.Environments[*deployment.DeploymentName] = deployment.Status
+			}
+		}
+		if deployment.Status == models.DeploymentStatusFailed && len(summary.Failures) < digestMaxFailures {
+			summary.Failures = append(summary.Failures, models.NewNotificationDeployment(deployment))
+		}
+	}
+
+	return &models.Notification{
+		Event:   models.NotificationEventDigest,
+		Text:    digestText(project, summary),
+		Project: project,
+		SentAt:  time.Now().UTC(),
+		Digest:  summary,
+	}, nil
+}
+
+// digestText renders a digest as a short readable message
+func digestText(project string, summary *models.DeploymentDigest) string {
+	var counts []string
+	for _, status := range digestStatusOrder {
+		if count := summary.Statuses[status]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, status))
+		}
+	}
+
+	text := fmt.Sprintf("Deployments of %s since %s: %d (%s)", project, summary.From.UTC().Format(time.RFC3339), summary.Total, strings.Join(counts, ", "))
+	if len(summary.Environments) > 0 {
+		environments := make([]string, 0, len(summary.Environments))
+		for environment, status := range summary.Environments {
+			environments = append(environments, fmt.Sprintf("%s %s", environment, status))
+		}
+		sort.Strings(environments)
+		text += ". Latest: " + strings.Join(environments, ", ")
+	}
+	return text
+}
+
+// sendEscalations sends every due escalation and returns how many were sent
+func (n *Notifier) sendEscalations(ctx context.Context) (int, error) {
+	sent := 0
+	for ctx.Err() == nil {
+		due, err := n.repo.GetDueEscalations(time.Now(), escalationBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		progressed := false
+		for _, escalation := range due {
+			claimed, err := n.repo.ClaimDeploymentEscalation(escalation.DeploymentID, escalation.EscalationID)
+			if err != nil {
+				return sent, err
+			}
+			if !claimed {
+				continue
+			}
+
+			// Retrying cannot help a policy naming a channel this server does not know
+			if _, ok := n.channels[escalation.Channel]; !ok {
+				n.logger.WithFields(logrus.Fields{
+					"deployment_id": escalation.DeploymentID,
+					"channel":       escalation.Channel,
+				}).Warn("Escalation skipped: notification channel is not configured")
+				progressed = true
+				continue
+			}
+			if err := n.escalate(ctx, escalation); err != nil {
+				n.logger.WithError(err).WithFields(logrus.Fields{
+					"deployment_id": escalation.DeploymentID,
+					"channel":       escalation.Channel,
+				}).Error("Failed to send escalation; it will be retried")
+				if err := n.repo.ReleaseDeploymentEscalation(escalation.DeploymentID, escalation.EscalationID); err != nil {
+					return sent, err
+				}
+				continue
+			}
+			progressed = true
+			sent++
+		}
+		// Released escalations stay due until the next sweep, so stop once a batch made no progress
+		if len(due) < escalationBatchSize || !progressed {
+			break
+		}
+	}
+	return sent, nil
+}
+
+// escalate notifies the channel of an escalation policy that a deployment stayed failed
+func (n *Notifier) escalate(ctx context.Context, escalation *models.DueEscalation) error {
+	deployment, err := n.repo.GetDeployment(escalation.DeploymentID)
+	if err != nil {
+		return err
+	}
+	if deployment == nil {
+		return nil
+	}
+
+	described := models.NewNotificationDeployment(deployment)
+	if described.Changelog, err = n.repo.GetDeploymentChangelog(deployment.ID); err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Deployment %s of %s", deployment.ID, escalation.ProjectName)
+	if described.Environment != "" {
+		text += " to " + described.Environment
+	}
+	text += fmt.Sprintf(" is still failed more than %d minutes after it failed", escalation.AfterMinutes)
+	if deployment.ErrorMessage != nil {
+		text += ": " + *deployment.ErrorMessage
+	}
+	if described.Changelog != nil {
+		text += ". It shipped " + described.Changelog.Summary()
+	}
+
+	notification := &models.Notification{
+		Event:      models.NotificationEventEscalation,
+		Text:       text,
+		Project:    escalation.ProjectName,
+		SentAt:     time.Now().UTC(),
+		Deployment: &described,
+	}
+	if err := n.addContacts(notification); err != nil {
+		return err
+	}
+	return n.send(ctx, escalation.Channel, notification)
+}
+
+// addContacts adds the owner of the notification's project and who is on call for it, so
+// responders know who to contact
+func (n *Notifier) addContacts(notification *models.Notification) error {
+	contacts, err := n.repo.GetProjectContacts(notification.Project, time.Now())
+	if err != nil {
+		return err
+	}
+	notification.Contacts = contacts
+	if text := contacts.String(); text != "" {
+		notification.Text += ". " + text
+	}
+	return nil
+}
+
+// send posts a notification to a channel as JSON
+func (n *Notifier) send(ctx context.Context, channel string, notification *models.Notification) error {
+	url, ok := n.channels[channel]
+	if !ok {
+		return fmt.Errorf("notification channel %q is not configured", channel)
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("notification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification channel responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
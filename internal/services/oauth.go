@@ -0,0 +1,572 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrOAuthProviderNotFound is returned for providers that are not configured
+	ErrOAuthProviderNotFound = errors.New("OAuth provider is not configured")
+	// ErrOAuthStateInvalid is returned when a callback's state is unknown, expired or already used
+	ErrOAuthStateInvalid = errors.New("OAuth state is invalid or has expired")
+	// ErrOAuthFailed is returned when the provider does not complete the sign-in
+	ErrOAuthFailed = errors.New("OAuth sign-in failed")
+	// ErrOAuthNotAllowed is returned when the identity may not sign in
+	ErrOAuthNotAllowed = errors.New("OAuth sign-in is not allowed")
+	// ErrOAuthAccountExists is returned when an unlinked identity's email belongs to an existing user
+	ErrOAuthAccountExists = errors.New("an account with this email address already exists; sign in with your password and link the provider")
+	// ErrIdentityLinked is returned when an identity is already linked to another user or the user already has one at the provider
+	ErrIdentityLinked = errors.New("identity is already linked")
+	// ErrIdentityNotFound is returned when the user has no identity at the provider
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastSignInMethod is returned when unlinking would leave the user unable to sign in
+	ErrLastSignInMethod = errors.New("cannot unlink the only way to sign in; set a password or link another provider first")
+)
+
+// usernameDisallowedPattern matches characters not used in provisioned usernames
+var usernameDisallowedPattern = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// OAuthStateCookie is the cookie binding a sign-in to the browser that started it. It holds a hash of
+// the state, so a callback URL only completes the sign-in in that browser.
+const OAuthStateCookie = "deployknot_oauth_state"
+
+// oauthStateKey holds the state of a sign-in started with the provider
+func oauthStateKey(state string) string {
+	return "deployknot:oauth:state:" + state
+}
+
+// oauthState is kept in Redis between starting a sign-in and its callback
+type oauthState struct {
+	Provider     string     `json:"provider"`
+	CodeVerifier string     `json:"code_verifier"`
+	Nonce        string     `json:"nonce"`
+	LinkUserID   *uuid.UUID `json:"link_user_id,omitempty"`
+}
+
+// OAuthResult is the outcome of an OAuth callback
+type OAuthResult struct {
+	User *models.User
+	// Created is set when the user was provisioned by this sign-in
+	Created bool
+	// Linked is set when the identity was linked to an existing user by this sign-in
+	Linked bool
+}
+
+// OAuthService signs users in with GitHub, Google and OIDC providers
+type OAuthService struct {
+	repo      *database.Repository
+	redis     *redis.Client
+	cfg       config.OAuthConfig
+	providers map[string]oauthProvider
+	logger    *logrus.Logger
+}
+
+// NewOAuthService creates a new OAuth service with the providers enabled in cfg
+func NewOAuthService(repo *database.Repository, redisClient *redis.Client, cfg config.OAuthConfig, logger *logrus.Logger) *OAuthService {
+	client := &http.Client{Timeout: cfg.HTTPTimeout}
+	providers := make(map[string]oauthProvider)
+	if cfg.GitHubClientID != "" {
+		providers[models.OAuthProviderGitHub] = &githubProvider{
+			clientID:     cfg.GitHubClientID,
+			clientSecret: cfg.GitHubClientSecret,
+			baseURL:      cfg.GitHubURL,
+			apiURL:       cfg.GitHubAPIURL,
+			client:       client,
+		}
+	}
+	if cfg.GoogleClientID != "" {
+		providers[models.OAuthProviderGoogle] = &oidcProvider{
+			name:              models.OAuthProviderGoogle,
+			issuerURL:         googleIssuerURL,
+			clientID:          cfg.GoogleClientID,
+			clientSecret:      cfg.GoogleClientSecret,
+			scopes:            []string{"openid", "profile", "email"},
+			organizationClaim: cfg.OrganizationClaim,
+			client:            client,
+		}
+	}
+	if cfg.OIDCClientID != "" {
+		providers[models.OAuthProviderOIDC] = &oidcProvider{
+			name:              models.OAuthProviderOIDC,
+			issuerURL:         cfg.OIDCIssuerURL,
+			clientID:          cfg.OIDCClientID,
+			clientSecret:      cfg.OIDCClientSecret,
+			scopes:            cfg.OIDCScopes,
+			organizationClaim: cfg.OrganizationClaim,
+			client:            client,
+		}
+	}
+
+	return &OAuthService{
+		repo:      repo,
+		redis:     redisClient,
+		cfg:       cfg,
+		providers: providers,
+		logger:    logger,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *OAuthService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SuccessRedirectURL returns the URL users are sent to after signing in, or "" to respond with JSON
+func (s *OAuthService) SuccessRedirectURL() string {
+	return s.cfg.SuccessRedirectURL
+}
+
+// Start begins a sign-in with a provider and returns the URL to send the user to along with the
+// cookie binding the sign-in to their browser. With linkUserID set, the callback links the identity
+// to that user instead of signing in.
+func (s *OAuthService) Start(ctx context.Context, providerName string, linkUserID *uuid.UUID) (string, *http.Cookie, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", nil, ErrOAuthProviderNotFound
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	stateJSON, err := json.Marshal(oauthState{
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal OAuth state: %w", err)
+	}
+	if err := s.redis.Set(ctx, oauthStateKey(state), stateJSON, s.cfg.StateTTL).Err(); err != nil {
+		return "", nil, fmt.Errorf("failed to store OAuth state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL, err := provider.authorizationURL(ctx, state, base64.RawURLEncoding.EncodeToString(challenge[:]), nonce, s.redirectURI(providerName))
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrOAuthFailed, err)
+	}
+	return authURL, s.stateCookie(oauthStateBinding(state), int(s.cfg.StateTTL.Seconds())), nil
+}
+
+// ClearStateCookie returns the cookie removing the binding of a finished sign-in
+func (s *OAuthService) ClearStateCookie() *http.Cookie {
+	return s.stateCookie("", -1)
+}
+
+// stateCookie returns the state cookie with the given value, sent back only to the OAuth routes
+func (s *OAuthService) stateCookie(value string, maxAge int) *http.Cookie {
+	path := "/api/v1/auth/oauth/"
+	secure := false
+	if base, err := url.Parse(s.cfg.RedirectBaseURL); err == nil {
+		path = strings.TrimSuffix(base.Path, "/") + path
+		secure = base.Scheme == "https"
+	}
+	return &http.Cookie{
+		Name:     OAuthStateCookie,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		// Lax cookies are still sent on the provider's top-level redirect back to the callback
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oauthStateBinding returns the value of the state cookie of a sign-in
+func oauthStateBinding(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Callback completes a sign-in: it redeems the authorization code and returns the user, provisioning
+// one or linking the identity as needed. binding is the state cookie sent by the browser; a state
+// started in another browser is rejected.
+func (s *OAuthService) Callback(ctx context.Context, providerName, code, state, binding string) (*OAuthResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrOAuthProviderNotFound
+	}
+
+	// A victim's browser must not complete a sign-in or link started by someone else
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(oauthStateBinding(state))) != 1 {
+		return nil, fmt.Errorf("%w: the sign-in was not started in this browser", ErrOAuthStateInvalid)
+	}
+
+	// Each state is used once, so a leaked callback URL cannot be replayed
+	stateJSON, err := s.redis.GetDel(ctx, oauthStateKey(state)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrOAuthStateInvalid
+		}
+		return nil, fmt.Errorf("failed to load OAuth state: %w", err)
+	}
+	var saved oauthState
+	if err := json.Unmarshal(stateJSON, &saved); err != nil || saved.Provider != providerName {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	external, err := provider.identity(ctx, code, saved.CodeVerifier, saved.Nonce, s.redirectURI(providerName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOAuthFailed, err)
+	}
+
+	if saved.LinkUserID != nil {
+		return s.link(*saved.LinkUserID, external)
+	}
+	return s.signIn(external)
+}
+
+// signIn returns the user linked to the identity, linking or provisioning one when there is none
+func (s *OAuthService) signIn(external *models.ExternalIdentity) (*OAuthResult, error) {
+	if err := s.checkDomain(external); err != nil {
+		return nil, err
+	}
+
+	identity, err := s.repo.GetUserIdentity(external.Provider, external.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OAuthResult{}
+	if identity != nil {
+		result.User, err = s.repo.GetUserByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if result.User == nil {
+			return nil, fmt.Errorf("%w: the linked user no longer exists", ErrOAuthNotAllowed)
+		}
+		if err := s.repo.TouchUserIdentity(identity.ID, optionalEmail(external.Email)); err != nil {
+			return nil, err
+		}
+	} else {
+		result, err = s.linkOrProvision(external)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !result.User.IsActive {
+		return nil, fmt.Errorf("%w: account is deactivated", ErrOAuthNotAllowed)
+	}
+	if err := s.mapOrganization(result.User, external); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  result.User.ID,
+		"username": result.User.Username,
+		"provider": external.Provider,
+		"created":  result.Created,
+		"linked":   result.Linked,
+	}).Info("User signed in with OAuth")
+
+	return result, nil
+}
+
+// linkOrProvision handles the first sign-in with an identity: it is linked to the user with the same
+// verified email when that is allowed, otherwise a new user is created
+func (s *OAuthService) linkOrProvision(external *models.ExternalIdentity) (*OAuthResult, error) {
+	if external.Email == "" {
+		return nil, fmt.Errorf("%w: the provider did not return a verified email address", ErrOAuthFailed)
+	}
+
+	existing, err := s.repo.GetUserByEmail(external.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if !s.cfg.LinkVerifiedEmails || !external.EmailVerified {
+			return nil, ErrOAuthAccountExists
+		}
+		if err := s.createIdentity(existing.ID, external); err != nil {
+			return nil, err
+		}
+		return &OAuthResult{User: existing, Linked: true}, nil
+	}
+
+	if !s.cfg.AutoProvision {
+		return nil, fmt.Errorf("%w: no account is linked to this identity", ErrOAuthNotAllowed)
+	}
+
+	username, err := s.uniqueUsername(external)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user := &models.User{
+		ID:       uuid.New(),
+		Username: username,
+		Email:    external.Email,
+		// Provisioned users have no password until they set one; password login fails for them
+		PasswordHash: "",
+		Role:         models.RoleUser,
+		IsActive:     true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.repo.CreateUser(user); err != nil {
+		return nil, err
+	}
+	if err := s.createIdentity(user.ID, external); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"provider": external.Provider,
+	}).Info("User provisioned from OAuth identity")
+
+	return &OAuthResult{User: user, Created: true}, nil
+}
+
+// link links the identity to the user who started the sign-in from their session
+func (s *OAuthService) link(userID uuid.UUID, external *models.ExternalIdentity) (*OAuthResult, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, ErrUserNotFound
+	}
+
+	identity, err := s.repo.GetUserIdentity(external.Provider, external.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if identity.UserID != userID {
+			return nil, fmt.Errorf("%w: this %s account belongs to another user", ErrIdentityLinked, external.Provider)
+		}
+		return &OAuthResult{User: user}, nil
+	}
+
+	identities, err := s.repo.GetUserIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range identities {
+		if existing.Provider == external.Provider {
+			return nil, fmt.Errorf("%w: a different %s account is linked already", ErrIdentityLinked, external.Provider)
+		}
+	}
+
+	if err := s.createIdentity(userID, external); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"provider": external.Provider,
+	}).Info("OAuth identity linked")
+
+	return &OAuthResult{User: user, Linked: true}, nil
+}
+
+// GetIdentities returns the identities linked to a user
+func (s *OAuthService) GetIdentities(ctx context.Context, userID uuid.UUID) ([]*models.UserIdentity, error) {
+	identities, err := s.repo.GetUserIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+	if identities == nil {
+		identities = []*models.UserIdentity{}
+	}
+	return identities, nil
+}
+
+// Unlink removes a user's identity at a provider, unless it is the only way the user can sign in
+func (s *OAuthService) Unlink(ctx context.Context, userID uuid.UUID, providerName string) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	identities, err := s.repo.GetUserIdentities(userID)
+	if err != nil {
+		return err
+	}
+	// Slack identities only authorize slash commands, so they are no way to sign in
+	var signIn []*models.UserIdentity
+	for _, identity := range identities {
+		if identity.Provider != models.IdentityProviderSlack {
+			signIn = append(signIn, identity)
+		}
+	}
+	if user.PasswordHash == "" && len(signIn) == 1 && signIn[0].Provider == providerName {
+		return ErrLastSignInMethod
+	}
+
+	found, err := s.repo.DeleteUserIdentity(userID, providerName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrIdentityNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"provider": providerName,
+	}).Info("OAuth identity unlinked")
+
+	return nil
+}
+
+// createIdentity links the external identity to a user
+func (s *OAuthService) createIdentity(userID uuid.UUID, external *models.ExternalIdentity) error {
+	now := time.Now()
+	return s.repo.CreateUserIdentity(&models.UserIdentity{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Provider:    external.Provider,
+		Subject:     external.Subject,
+		Email:       optionalEmail(external.Email),
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	})
+}
+
+// checkDomain enforces OAUTH_ALLOWED_DOMAINS on the identity's verified email address
+func (s *OAuthService) checkDomain(external *models.ExternalIdentity) error {
+	if len(s.cfg.AllowedDomains) == 0 {
+		return nil
+	}
+	_, domain, _ := strings.Cut(external.Email, "@")
+	if external.EmailVerified {
+		for _, allowed := range s.cfg.AllowedDomains {
+			if strings.EqualFold(domain, allowed) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: a verified email address in an allowed domain is required", ErrOAuthNotAllowed)
+}
+
+// mapOrganization moves the user into the first organization named by the identity's organization
+// claim. Users whose identity names no existing organization keep their current one.
+func (s *OAuthService) mapOrganization(user *models.User, external *models.ExternalIdentity) error {
+	for _, slug := range external.Organizations {
+		org, err := s.repo.GetOrganizationBySlug(slug)
+		if err != nil {
+			return err
+		}
+		if org == nil {
+			continue
+		}
+
+		current, err := s.repo.GetUserOrganization(user.ID)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.ID == org.ID {
+			return nil
+		}
+		if _, err := s.repo.SetUserOrganization(user.ID, &org.ID); err != nil {
+			return err
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"user_id":         user.ID,
+			"organization_id": org.ID,
+			"slug":            org.Slug,
+		}).Info("User organization mapped from OIDC claim")
+		return nil
+	}
+	return nil
+}
+
+// uniqueUsername derives an unused username from the identity's username or email address
+func (s *OAuthService) uniqueUsername(external *models.ExternalIdentity) (string, error) {
+	base := external.Username
+	if base == "" {
+		base, _, _ = strings.Cut(external.Email, "@")
+	}
+	base = usernameDisallowedPattern.ReplaceAllString(base, "-")
+	base = strings.Trim(base, "-.")
+	if len(base) > 90 {
+		base = base[:90]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		existing, err := s.repo.GetUserByUsername(candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+	return fmt.Sprintf("%s-%s", base, uuid.New().String()[:8]), nil
+}
+
+// redirectURI is the callback URL registered with the provider
+func (s *OAuthService) redirectURI(providerName string) string {
+	return s.cfg.RedirectBaseURL + "/api/v1/auth/oauth/" + providerName + "/callback"
+}
+
+// optionalEmail returns nil for an empty email address
+func optionalEmail(email string) *string {
+	if email == "" {
+		return nil
+	}
+	return &email
+}
+
+// randomToken returns 32 random bytes encoded for use in URLs
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"deployknot/internal/models"
+)
+
+// maxOAuthResponseSize bounds the responses read from providers
+const maxOAuthResponseSize = 1 << 20
+
+// googleIssuerURL is the OIDC issuer of Google accounts
+const googleIssuerURL = "https://accounts.google.com"
+
+// oauthProvider runs the authorization code flow with one identity provider
+type oauthProvider interface {
+	// authorizationURL returns the URL the user is sent to in order to sign in
+	authorizationURL(ctx context.Context, state, codeChallenge, nonce, redirectURI string) (string, error)
+	// identity exchanges the authorization code and returns the signed-in user's identity
+	identity(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (*models.ExternalIdentity, error)
+}
+
+// tokenResponse is the token endpoint response of OAuth 2.0 and OIDC providers
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at a token endpoint
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	if err := doOAuthRequest(client, req, &token); err != nil && token.Error == "" {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("provider rejected the authorization code: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("provider returned no access token")
+	}
+	return &token, nil
+}
+
+// getJSON fetches a JSON document, authenticating with accessToken when it is set
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return doOAuthRequest(client, req, out)
+}
+
+// doOAuthRequest sends req and decodes the JSON response into out. The body is decoded for error
+// responses too, since token endpoints describe errors in it.
+func doOAuthRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOAuthResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	decodeErr := json.Unmarshal(body, out)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d", req.Method, req.URL.Redacted(), resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to decode response: %w", decodeErr)
+	}
+	return nil
+}
+
+// githubProvider signs users in with GitHub or GitHub Enterprise OAuth apps
+type githubProvider struct {
+	clientID     string
+	clientSecret string
+	baseURL      string
+	apiURL       string
+	client       *http.Client
+}
+
+func (p *githubProvider) authorizationURL(ctx context.Context, state, codeChallenge, nonce, redirectURI string) (string, error) {
+	query := url.Values{
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"read:user user:email"},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+		"allow_signup":          {"false"},
+	}
+	return p.baseURL + "/login/oauth/authorize?" + query.Encode(), nil
+}
+
+func (p *githubProvider) identity(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (*models.ExternalIdentity, error) {
+	token, err := exchangeCode(ctx, p.client, p.baseURL+"/login/oauth/access_token", url.Values{
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, p.client, p.apiURL+"/user", token.AccessToken, &user); err != nil {
+		return nil, fmt.Errorf("failed to get GitHub user: %w", err)
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("GitHub returned no user ID")
+	}
+
+	// The profile email is optional and may be unverified, so use the verified primary address
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.client, p.apiURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return nil, fmt.Errorf("failed to get GitHub email addresses: %w", err)
+	}
+
+	identity := &models.ExternalIdentity{
+		Provider: models.OAuthProviderGitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Username: user.Login,
+		Name:     user.Name,
+	}
+	for _, email := range emails {
+		if email.Verified && (email.Primary || identity.Email == "") {
+			identity.Email = email.Email
+			identity.EmailVerified = true
+		}
+	}
+	return identity, nil
+}
+
+// oidcDiscovery is the part of an OpenID provider configuration document that is used
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// oidcProvider signs users in with an OpenID Connect provider such as Google, Okta or Keycloak
+type oidcProvider struct {
+	name              string
+	issuerURL         string
+	clientID          string
+	clientSecret      string
+	scopes            []string
+	organizationClaim string
+	client            *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+}
+
+// discover fetches the provider configuration once it is first needed and caches it
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, p.client, p.issuerURL+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %w", p.issuerURL, err)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return nil, fmt.Errorf("OIDC provider %s has no authorization or token endpoint", p.issuerURL)
+	}
+	if discovery.Issuer == "" {
+		discovery.Issuer = p.issuerURL
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (p *oidcProvider) authorizationURL(ctx context.Context, state, codeChallenge, nonce, redirectURI string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *oidcProvider) identity(ctx context.Context, code, codeVerifier, nonce, redirectURI string) (*models.ExternalIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := exchangeCode(ctx, p.client, discovery.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("provider returned no ID token; is the openid scope requested?")
+	}
+
+	claims, err := p.idTokenClaims(token.IDToken, discovery.Issuer, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ID token may carry only some claims; the userinfo endpoint returns the rest
+	if discovery.UserinfoEndpoint != "" {
+		var userinfo map[string]interface{}
+		if err := getJSON(ctx, p.client, discovery.UserinfoEndpoint, token.AccessToken, &userinfo); err != nil {
+			return nil, fmt.Errorf("failed to get OIDC user info: %w", err)
+		}
+		if sub, _ := userinfo["sub"].(string); sub != claims["sub"] {
+			return nil, fmt.Errorf("user info subject does not match the ID token")
+		}
+		for name, value := range userinfo {
+			if _, ok := claims[name]; !ok {
+				claims[name] = value
+			}
+		}
+	}
+
+	identity := &models.ExternalIdentity{
+		Provider:      p.name,
+		Subject:       stringClaim(claims, "sub"),
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		Username:      stringClaim(claims, "preferred_username"),
+		Name:          stringClaim(claims, "name"),
+	}
+	if p.organizationClaim != "" {
+		identity.Organizations = stringListClaim(claims, p.organizationClaim)
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("ID token has no subject")
+	}
+	return identity, nil
+}
+
+// idTokenClaims decodes an ID token and checks its issuer, audience, expiry and nonce. The token
+// comes straight from the token endpoint over TLS, which OIDC Core (3.1.3.7) accepts in place of
+// verifying its signature.
+func (p *oidcProvider) idTokenClaims(idToken, issuer, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("ID token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ID token: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	if stringClaim(claims, "iss") != issuer {
+		return nil, fmt.Errorf("ID token was issued by %q, expected %q", stringClaim(claims, "iss"), issuer)
+	}
+	if !slices.Contains(stringListClaim(claims, "aud"), p.clientID) {
+		return nil, fmt.Errorf("ID token was not issued for this client")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Unix(int64(exp), 0).Before(time.Now()) {
+		return nil, fmt.Errorf("ID token has expired")
+	}
+	if stringClaim(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// stringClaim returns a string claim, or "" when it is missing
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// boolClaim returns a boolean claim; some providers send booleans as strings
+func boolClaim(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+// stringListClaim returns a claim that is either a string or a list of strings
+func stringListClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		if value != "" {
+			return []string{value}
+		}
+	case []interface{}:
+		var list []string
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"deployknot/internal/services"
+)
+
+func TestOAuthCallbackRequiresTheStartingBrowser(t *testing.T) {
+	t.Setenv("OAUTH_REDIRECT_BASE_URL", "https://deploy.example.com/knot")
+	t.Setenv("OAUTH_GITHUB_CLIENT_ID", "client")
+	t.Setenv("OAUTH_GITHUB_CLIENT_SECRET", "secret")
+	// The code exchange fails fast against a closed port
+	t.Setenv("OAUTH_GITHUB_URL", "http://127.0.0.1:1")
+	application := newTestApp(t)
+	ctx := context.Background()
+
+	authURL, cookie, err := application.OAuthService.Start(ctx, "github", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie.Name != services.OAuthStateCookie || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/knot/api/v1/auth/oauth/" {
+		t.Errorf("state cookie = %+v, want an HttpOnly, Secure, SameSite=Lax cookie for /knot/api/v1/auth/oauth/", cookie)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := parsed.Query().Get("state")
+	if cookie.Value == "" || cookie.Value == state {
+		t.Fatalf("state cookie value %q must be a hash of the state", cookie.Value)
+	}
+
+	_, other, err := application.OAuthService.Start(ctx, "github", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, binding := range map[string]string{"no cookie": "", "another sign-in's cookie": other.Value} {
+		if _, err := application.OAuthService.Callback(ctx, "github", "code", state, binding); !errors.Is(err, services.ErrOAuthStateInvalid) {
+			t.Errorf("callback with %s: got %v, want ErrOAuthStateInvalid", name, err)
+		}
+	}
+	// The state survives rejected callbacks and is accepted from the browser that started the sign-in
+	if _, err := application.OAuthService.Callback(ctx, "github", "code", state, cookie.Value); !errors.Is(err, services.ErrOAuthFailed) {
+		t.Errorf("callback with the state cookie: got %v, want the code exchange to fail with ErrOAuthFailed", err)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+)
+
+// emptyPayloadHash is the hex SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Bucket stores objects in a bucket of S3-compatible storage, such as AWS S3 or MinIO. Objects
+// are addressed path-style, as endpoint/bucket/key, which every implementation supports.
+type s3Bucket struct {
+	client    *http.Client
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+// newS3Bucket creates a client of the volume backup bucket. Requests are bounded by their context
+// rather than a client timeout, since objects may take long to transfer.
+func newS3Bucket(cfg config.VolumeBackupConfig) *s3Bucket {
+	return &s3Bucket{
+		client:    &http.Client{},
+		endpoint:  strings.TrimRight(cfg.Endpoint, "/"),
+		bucket:    cfg.Bucket,
+		region:    cfg.Region,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.SecretAccessKey,
+	}
+}
+
+// put uploads size bytes of body as the object key; payloadHash is the hex SHA-256 of the bytes
+func (b *s3Bucket) put(ctx context.Context, key string, body io.Reader, size int64, payloadHash string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, b.objectURL(key), body)
+	if err != nil {
+		return fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := b.do(req, payloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// get downloads the object key; the caller closes the returned body
+func (b *s3Bucket) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.objectURL(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	resp, err := b.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// delete deletes the object key; deleting an object that does not exist succeeds
+func (b *s3Bucket) delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, b.objectURL(key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	resp, err := b.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do signs and sends a request, returning the response when its status is 2xx
+func (b *s3Bucket) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signAWSPayload(req, payloadHash, b.region, "s3", b.accessKey, b.secretKey, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, fmt.Errorf("S3 %s %s responded with status %d: %s", req.Method, req.URL.Path, resp.StatusCode, truncateText(strings.TrimSpace(string(respBody)), 200))
+	}
+	return resp, nil
+}
+
+// objectURL returns the path-style URL of the object key
+func (b *s3Bucket) objectURL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return b.endpoint + "/" + url.PathEscape(b.bucket) + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidOrganization is returned when an organization request is invalid
+	ErrInvalidOrganization = errors.New("invalid organization")
+	// ErrOrganizationExists is returned when an organization with the same slug already exists
+	ErrOrganizationExists = errors.New("organization slug already exists")
+	// ErrOrganizationNotFound is returned when an organization does not exist
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// organizationSlugPattern matches lowercase slugs such as "acme-corp"
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OrganizationService handles organization management and tenant isolation lookups
+type OrganizationService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(repo *database.Repository, logger *logrus.Logger) *OrganizationService {
+	return &OrganizationService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateOrganization creates an organization with the requested isolation mode, which defaults to shared
+func (s *OrganizationService) CreateOrganization(ctx context.Context, req *models.CreateOrganizationRequest) (*models.Organization, error) {
+	if !organizationSlugPattern.MatchString(req.Slug) {
+		return nil, fmt.Errorf("%w: slug must contain only lowercase letters, digits and single hyphens", ErrInvalidOrganization)
+	}
+
+	mode := req.IsolationMode
+	if mode == "" {
+		mode = models.IsolationShared
+	}
+	if mode != models.IsolationShared && mode != models.IsolationRLS {
+		return nil, fmt.Errorf("%w: isolation_mode must be %q or %q", ErrInvalidOrganization, models.IsolationShared, models.IsolationRLS)
+	}
+	if mode == models.IsolationRLS && s.repo.IsSQLite() {
+		return nil, fmt.Errorf("%w: isolation_mode %q requires PostgreSQL", ErrInvalidOrganization, models.IsolationRLS)
+	}
+
+	existing, err := s.repo.GetOrganizationBySlug(req.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrOrganizationExists
+	}
+
+	now := time.Now()
+	org := &models.Organization{
+		ID:            uuid.New(),
+		Name:          req.Name,
+		Slug:          req.Slug,
+		IsolationMode: mode,
+		AllowedCIDRs:  []string{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.repo.CreateOrganization(org); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": org.ID,
+		"slug":            org.Slug,
+		"isolation_mode":  org.IsolationMode,
+	}).Info("Organization created")
+
+	return org, nil
+}
+
+// ListOrganizations returns all organizations
+func (s *OrganizationService) ListOrganizations(ctx context.Context) ([]*models.Organization, error) {
+	orgs, err := s.repo.ListOrganizations()
+	if err != nil {
+		return nil, err
+	}
+	if orgs == nil {
+		orgs = []*models.Organization{}
+	}
+	return orgs, nil
+}
+
+// AssignUser moves a user into an organization, or out of any when organizationID is nil.
+// Deployments the user created earlier stay with the organization they were created in.
+func (s *OrganizationService) AssignUser(ctx context.Context, userID uuid.UUID, organizationID *uuid.UUID) error {
+	if organizationID != nil {
+		org, err := s.repo.GetOrganization(*organizationID)
+		if err != nil {
+			return err
+		}
+		if org == nil {
+			return ErrOrganizationNotFound
+		}
+	}
+
+	found, err := s.repo.SetUserOrganization(userID, organizationID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":         userID,
+		"organization_id": organizationID,
+	}).Info("User organization updated")
+
+	return nil
+}
+
+// IsolatedOrganization returns the organization of a user when it uses row-level isolation, and nil otherwise
+func (s *OrganizationService) IsolatedOrganization(ctx context.Context, userID uuid.UUID) (*uuid.UUID, error) {
+	org, err := s.repo.GetUserOrganization(userID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil || org.IsolationMode != models.IsolationRLS {
+		return nil, nil
+	}
+	return &org.ID, nil
+}
+
+// maxAllowedCIDRs caps the size of an organization's IP allowlist
+const maxAllowedCIDRs = 100
+
+// SetIPAllowlist replaces the networks an organization's members may create deployments and reach
+// targets from. Entries are stored in canonical form; an empty list allows any network.
+func (s *OrganizationService) SetIPAllowlist(ctx context.Context, organizationID uuid.UUID, cidrs []string) (*models.Organization, error) {
+	if len(cidrs) > maxAllowedCIDRs {
+		return nil, fmt.Errorf("%w: at most %d allowed_cidrs entries are supported", ErrInvalidOrganization, maxAllowedCIDRs)
+	}
+	networks, err := models.ParseCIDRs(cidrs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOrganization, err)
+	}
+	canonical := make([]string, len(networks))
+	for i, network := range networks {
+		canonical[i] = network.String()
+	}
+
+	found, err := s.repo.SetOrganizationAllowedCIDRs(organizationID, canonical)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrOrganizationNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": organizationID,
+		"allowed_cidrs":   canonical,
+	}).Info("Organization IP allowlist updated")
+
+	org, err := s.repo.GetOrganization(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrganizationNotFound
+	}
+	return org, nil
+}
+
+// AllowedNetworks returns the organization of a user and the networks it restricts sensitive
+// requests to; both are nil when the user has no organization, and the networks are empty when
+// the organization allows any network
+func (s *OrganizationService) AllowedNetworks(ctx context.Context, userID uuid.UUID) (*uuid.UUID, []*net.IPNet, error) {
+	org, err := s.repo.GetUserOrganization(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if org == nil {
+		return nil, nil, nil
+	}
+	networks, err := models.ParseCIDRs(org.AllowedCIDRs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("organization %s has an invalid IP allowlist: %w", org.Slug, err)
+	}
+	return &org.ID, networks, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// outboxCleanupInterval is how often published outbox entries past their retention are deleted
+const outboxCleanupInterval = time.Hour
+
+// newOutboxEntry serializes and encrypts a job for the outbox; job data carries credentials
+func newOutboxEntry(encryptor *encryption.Encryptor, job *Job) (*models.OutboxEntry, error) {
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	payload, err := encryptor.Encrypt(string(jobJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt job: %w", err)
+	}
+
+	return &models.OutboxEntry{
+		ID:               uuid.New(),
+		DeploymentID:     job.DeploymentID,
+		PayloadEncrypted: payload,
+		CreatedAt:        time.Now(),
+	}, nil
+}
+
+// OutboxPublisher enqueues deployment jobs that were buffered in PostgreSQL while Redis was
+// unavailable, and jobs whose gates passed but could not be enqueued right away
+type OutboxPublisher struct {
+	repo      *database.Repository
+	queue     *QueueService
+	encryptor *encryption.Encryptor
+	config    config.OutboxConfig
+	logger    *logrus.Logger
+}
+
+// NewOutboxPublisher creates a new outbox publisher
+func NewOutboxPublisher(repo *database.Repository, queue *QueueService, encryptor *encryption.Encryptor, cfg config.OutboxConfig, logger *logrus.Logger) *OutboxPublisher {
+	return &OutboxPublisher{
+		repo:      repo,
+		queue:     queue,
+		encryptor: encryptor,
+		config:    cfg,
+		logger:    logger,
+	}
+}
+
+// Run publishes pending outbox entries every interval until ctx is cancelled
+func (p *OutboxPublisher) Run(ctx context.Context) {
+	p.logger.WithFields(logrus.Fields{
+		"interval":   p.config.PublishInterval,
+		"batch_size": p.config.BatchSize,
+	}).Info("Starting job outbox publisher")
+
+	ticker := time.NewTicker(p.config.PublishInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		if _, err := p.Publish(ctx); err != nil && ctx.Err() == nil {
+			p.logger.WithError(err).Error("Job outbox publish failed")
+		}
+
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			lastCleanup = time.Now()
+			deleted, err := p.repo.DeletePublishedOutboxEntries(time.Now().Add(-p.config.Retention))
+			if err != nil {
+				p.logger.WithError(err).Error("Failed to clean up job outbox")
+			} else if deleted > 0 {
+				p.logger.WithField("deleted", deleted).Info("Cleaned up published outbox entries")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish enqueues pending outbox entries batch by batch until none are left or publishing fails,
+// and returns how many were published
+func (p *OutboxPublisher) Publish(ctx context.Context) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		published, err := p.repo.PublishOutboxEntries(p.config.BatchSize, func(entry *models.OutboxEntry) error {
+			return p.publishEntry(ctx, entry)
+		})
+		total += published
+		if err != nil {
+			return total, err
+		}
+		if published < p.config.BatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		p.logger.WithField("published", total).Info("Published buffered deployment jobs")
+	}
+	return total, nil
+}
+
+// decodeOutboxEntry decrypts and deserializes the job of an outbox entry
+func decodeOutboxEntry(encryptor *encryption.Encryptor, entry *models.OutboxEntry) (*Job, error) {
+	jobJSON, err := encryptor.Decrypt(entry.PayloadEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(jobJSON), &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return &job, nil
+}
+
+// publishEntry decrypts a buffered job and pushes it onto the queue
+func (p *OutboxPublisher) publishEntry(ctx context.Context, entry *models.OutboxEntry) error {
+	job, err := decodeOutboxEntry(p.encryptor, entry)
+	if err != nil {
+		return err
+	}
+
+	if err := p.queue.EnqueueJob(ctx, job); err != nil {
+		return err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"job_id":        job.ID,
+		"deployment_id": entry.DeploymentID,
+		"buffered_for":  time.Since(entry.CreatedAt).Round(time.Second).String(),
+	}).Info("Buffered deployment job published")
+	return nil
+}
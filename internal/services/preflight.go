@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// PreflightFailure describes a single failed pre-flight check
+type PreflightFailure struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// PreflightError is returned when a deployment request fails its pre-flight checks
+type PreflightError struct {
+	Failures []PreflightFailure
+}
+
+func (e *PreflightError) Error() string {
+	messages := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		messages = append(messages, fmt.Sprintf("%s: %s", f.Check, f.Message))
+	}
+	return "pre-flight checks failed: " + strings.Join(messages, "; ")
+}
+
+// PreflightService verifies deployment credentials before a deployment is enqueued
+type PreflightService struct {
+	config     config.PreflightConfig
+	sshCA      *SSHCAService
+	targets    *SSHTargetLimiter
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewPreflightService creates a new pre-flight service
+func NewPreflightService(cfg config.PreflightConfig, sshCA *SSHCAService, targets *SSHTargetLimiter, logger *logrus.Logger) *PreflightService {
+	return &PreflightService{
+		config:     cfg,
+		sshCA:      sshCA,
+		targets:    targets,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		logger:     logger,
+	}
+}
+
+// Check runs the pre-flight checks for a deployment request
+func (s *PreflightService) Check(ctx context.Context, req *models.CreateDeploymentRequest) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	var failures []PreflightFailure
+	if failure := s.checkGitHubAccess(ctx, req.GitHubPAT, models.NormalizeRepoURL(req.GitHubRepoURL), req.GitHubBranch); failure != nil {
+		failures = append(failures, *failure)
+	}
+
+	if s.config.SSHCheck && req.GetTargetType() == models.TargetTypeSSH {
+		if failure := s.checkSSH(ctx, req.TargetIP, req.SSHUsername, req.SSHPassword); failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+
+	if len(failures) > 0 {
+		return &PreflightError{Failures: failures}
+	}
+	return nil
+}
+
+// checkGitHubAccess verifies the PAT can read the repository and that the branch exists
+func (s *PreflightService) checkGitHubAccess(ctx context.Context, pat, repo, branch string) *PreflightFailure {
+	status, message, err := s.githubGet(ctx, pat, "/repos/"+repo)
+	if err != nil {
+		// GitHub being unreachable says nothing about the credentials, so don't block the deployment
+		s.logger.WithError(err).Warn("Skipping GitHub pre-flight check")
+		return nil
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return &PreflightFailure{Check: "github_pat", Message: "GitHub rejected the personal access token; it may be invalid or expired"}
+	case http.StatusNotFound:
+		return &PreflightFailure{Check: "github_repo", Message: fmt.Sprintf("repository %s was not found or the token cannot read it", repo)}
+	case http.StatusForbidden:
+		return &PreflightFailure{Check: "github_repo", Message: fmt.Sprintf("access to repository %s was denied: %s", repo, message)}
+	default:
+		s.logger.WithFields(logrus.Fields{"status": status, "message": message}).Warn("Unexpected GitHub response during pre-flight check")
+		return nil
+	}
+
+	status, message, err = s.githubGet(ctx, pat, "/repos/"+repo+"/branches/"+branch)
+	if err != nil {
+		s.logger.WithError(err).Warn("Skipping GitHub branch pre-flight check")
+		return nil
+	}
+	switch status {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return &PreflightFailure{Check: "github_branch", Message: fmt.Sprintf("branch %s does not exist in %s", branch, repo)}
+	default:
+		s.logger.WithFields(logrus.Fields{"status": status, "message": message}).Warn("Unexpected GitHub response during branch pre-flight check")
+		return nil
+	}
+}
+
+// githubGet performs an authenticated GET against the GitHub API and returns the status and error message
+func (s *PreflightService) githubGet(ctx context.Context, pat, path string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.config.GitHubAPIURL, "/")+path, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create GitHub request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pat)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "DeployKnot")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("GitHub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+	}
+	return resp.StatusCode, body.Message, nil
+}
+
+// checkSSH verifies the SSH credentials by opening and closing a connection to the target
+func (s *PreflightService) checkSSH(ctx context.Context, host, username, password string) *PreflightFailure {
+	auth, err := s.sshCA.AuthMethods(ctx, username, password, "deployknot preflight")
+	if err != nil {
+		return &PreflightFailure{Check: "ssh", Message: err.Error()}
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         s.config.Timeout,
+	}
+
+	// The check is part of creating the deployment, so it does not queue behind a busy target
+	dialCtx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	client, err := s.targets.Dial(dialCtx, host, sshConfig)
+	if errors.Is(err, ErrSSHTargetBusy) {
+		s.logger.WithField("host", host).Warn("Skipping the SSH pre-flight check, the target is busy")
+		return nil
+	}
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return &PreflightFailure{Check: "ssh", Message: fmt.Sprintf("timed out connecting to %s after %s", host, s.config.Timeout)}
+		}
+		return &PreflightFailure{Check: "ssh", Message: fmt.Sprintf("failed to connect to %s: %v", host, err)}
+	}
+	client.Close()
+	return nil
+}
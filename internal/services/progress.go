@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// runningStepCap is the largest share of a running step counted as done, so that a step running
+// longer than usual never reports as finished
+const runningStepCap = 0.95
+
+// GetDeploymentProgress returns the deployment's current status and completion percentage. The log
+// stream reports them every second, so the deployment is read through the deployment cache.
+func (s *DeploymentService) GetDeploymentProgress(ctx context.Context, id uuid.UUID) (models.DeploymentStatus, int, error) {
+	field := scopedField(ctx, "deployment")
+	deployment := &models.Deployment{}
+	if !s.cache.get(ctx, id, field, deployment) {
+		repo, release, err := s.repo.Scoped(ctx)
+		if err != nil {
+			return "", 0, err
+		}
+		deployment, err = repo.GetDeployment(id)
+		release()
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to get deployment: %w", err)
+		}
+		s.cache.set(ctx, id, field, deployment)
+	}
+
+	progress, err := s.deploymentProgress(ctx, deployment)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return deployment.Status, progress, nil
+}
+
+// deploymentProgress computes the completion percentage of a deployment from its steps, weighting
+// each step by its average duration in the project's recent deployments. The log stream computes the
+// progress of every followed deployment each second, so the steps are read through the deployment
+// cache and the durations from the read replica.
+func (s *DeploymentService) deploymentProgress(ctx context.Context, deployment *models.Deployment) (int, error) {
+	if deployment.Status == models.DeploymentStatusCompleted {
+		return 100, nil
+	}
+
+	var steps []*models.DeploymentStep
+	if !s.cache.get(ctx, deployment.ID, "steps", &steps) {
+		var err error
+		steps, err = s.displayRepo().GetDeploymentSteps(deployment.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get deployment steps: %w", err)
+		}
+		s.cache.set(ctx, deployment.ID, "steps", steps)
+	}
+
+	var history map[string]float64
+	if deployment.UserID != nil {
+		var err error
+		history, err = s.repo.Replica().GetProjectStepDurations(*deployment.UserID, deployment.ProjectKey(), DefaultStatsWindow)
+		if err != nil {
+			// Progress is still meaningful with equally weighted steps
+			s.logger.WithError(err).Warn("Failed to get historical step durations")
+		}
+	}
+
+	return calculateProgress(steps, history, time.Now()), nil
+}
+
+// calculateProgress returns the percentage of the expected work that is done. Steps without history
+// are weighted by the mean of the known step durations, or equally when there is no history at all.
+// A running step contributes its elapsed share of its expected duration, capped at runningStepCap.
+func calculateProgress(steps []*models.DeploymentStep, history map[string]float64, now time.Time) int {
+	if len(steps) == 0 {
+		return 0
+	}
+
+	fallback := 1.0
+	if len(history) > 0 {
+		var sum float64
+		for _, seconds := range history {
+			sum += seconds
+		}
+		fallback = math.Max(sum/float64(len(history)), 1)
+	}
+
+	var total, done float64
+	for _, step := range steps {
+		weight := fallback
+		if seconds, ok := history[step.StepName]; ok && seconds > 0 {
+			weight = seconds
+		}
+		total += weight
+
+		switch step.Status {
+		case models.DeploymentStatusCompleted:
+			done += weight
+		case models.DeploymentStatusRunning:
+			if step.StartedAt != nil && len(history) > 0 {
+				elapsed := now.Sub(*step.StartedAt).Seconds()
+				done += weight * math.Min(elapsed/weight, runningStepCap)
+			}
+		}
+	}
+
+	progress := int(math.Floor(done / total * 100))
+	if progress > 99 {
+		// Only a completed deployment reports 100
+		progress = 99
+	}
+	return progress
+}
@@ -0,0 +1,1102 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrProjectNotFound is returned when a project does not exist
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrInvalidProjectConfig is returned when a project configuration document or resource is invalid
+	ErrInvalidProjectConfig = errors.New("invalid project configuration")
+	// ErrProjectExists is returned when another project has the same name
+	ErrProjectExists = errors.New("a project with this name already exists")
+	// ErrProjectTargetNotFound is returned when a project has no such deployment target
+	ErrProjectTargetNotFound = errors.New("project target not found")
+	// ErrProjectTargetExists is returned when the project has another target with the same name
+	ErrProjectTargetExists = errors.New("a target with this name already exists in the project")
+	// ErrProjectTemplateNotFound is returned when a project has no such deployment template
+	ErrProjectTemplateNotFound = errors.New("project template not found")
+	// ErrProjectTemplateExists is returned when the project has another template with the same name
+	ErrProjectTemplateExists = errors.New("a template with this name already exists in the project")
+	// ErrProjectSigningKeyNotFound is returned when a project has no such signing key
+	ErrProjectSigningKeyNotFound = errors.New("project signing key not found")
+	// ErrProjectSigningKeyExists is returned when the project has another signing key with the same name
+	ErrProjectSigningKeyExists = errors.New("a signing key with this name already exists in the project")
+	// ErrPreconditionFailed is returned when a resource changed since the version the caller
+	// expected, as given by If-Match
+	ErrPreconditionFailed = errors.New("the resource was changed since it was read")
+)
+
+// ProjectService manages projects with their templates and targets, and exports and imports their
+// configuration
+type ProjectService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewProjectService creates a new project service
+func NewProjectService(repo *database.Repository, logger *logrus.Logger) *ProjectService {
+	return &ProjectService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// ExportProject returns the configuration of a project, given by its ID or name: its templates,
+// targets, freeze windows, gates, notifications and incident policy
+func (s *ProjectService) ExportProject(ctx context.Context, idOrName string) (*models.ProjectConfig, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := s.repo.GetProjectTemplates(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := s.repo.GetProjectTargets(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	freezeWindows, err := s.repo.GetProjectFreezeWindows(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	gates, err := s.repo.GetProjectGates(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifications, err := s.repo.GetProjectNotifications(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := s.repo.GetProjectIncidentPolicy(project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &models.ProjectConfig{
+		APIVersion:    models.ProjectConfigAPIVersion,
+		Kind:          models.ProjectConfigKind,
+		Project:       models.ProjectSpec{Name: project.Name},
+		Templates:     templates,
+		Targets:       targets,
+		FreezeWindows: freezeWindows,
+		Gates:         gates,
+		Notifications: notifications,
+		Incidents:     incidents,
+	}
+	if project.Description != nil {
+		cfg.Project.Description = *project.Description
+	}
+	if project.WorkerPool != nil {
+		cfg.Project.WorkerPool = *project.WorkerPool
+	}
+	if project.Owner != nil {
+		cfg.Project.Owner = *project.Owner
+	}
+	if project.OrganizationID != nil {
+		org, err := s.repo.GetOrganization(*project.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		if org != nil {
+			cfg.Project.Organization = org.Slug
+		}
+	}
+	cfg.Project.PublicStatus = project.PublicStatus
+	if project.ImageSignaturePolicy != models.ImageSignatureOff {
+		cfg.Project.ImageSignaturePolicy = project.ImageSignaturePolicy
+	}
+	return cfg, nil
+}
+
+// ImportProject creates or updates a project from its configuration. The project's templates and
+// targets are replaced with the ones in the configuration; those whose name stays the same keep
+// their IDs.
+func (s *ProjectService) ImportProject(ctx context.Context, cfg *models.ProjectConfig) (*models.ProjectImportResult, error) {
+	if err := ValidateProjectConfig(cfg); err != nil {
+		return nil, err
+	}
+	organizationID, err := s.projectOrganization(&cfg.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.repo.ImportProjectConfig(cfg, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"project":        cfg.Project.Name,
+		"created":        result.Created,
+		"templates":      result.Templates,
+		"targets":        result.Targets,
+		"freeze_windows": result.FreezeWindows,
+		"gates":          result.Gates,
+		"escalations":    result.Escalations,
+	}).Info("Project configuration imported")
+
+	return result, nil
+}
+
+// GetProject returns a project given by its ID or name
+func (s *ProjectService) GetProject(ctx context.Context, idOrName string) (*models.Project, error) {
+	var project *models.Project
+	var err error
+	if id, parseErr := uuid.Parse(idOrName); parseErr == nil {
+		project, err = s.repo.GetProjectByID(id)
+	} else {
+		project, err = s.repo.GetProjectByName(idOrName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, ErrProjectNotFound
+	}
+	return project, nil
+}
+
+// GetContacts returns the owner of a project, given by its ID or name, and who is on call for it
+func (s *ProjectService) GetContacts(ctx context.Context, idOrName string) (*models.ProjectContacts, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	contacts, err := s.repo.GetProjectContacts(project.Name, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if contacts == nil {
+		return nil, ErrProjectNotFound
+	}
+	return contacts, nil
+}
+
+// SetOnCall records who is on call for a project, given by its ID or name, as reported by an
+// external schedule, and returns the project's contacts
+func (s *ProjectService) SetOnCall(ctx context.Context, idOrName string, req *models.ProjectOnCallRequest) (*models.ProjectContacts, error) {
+	if err := req.Validate(time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProjectConfig, err)
+	}
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := s.repo.GetProjectOnCall(project.ID)
+	if err != nil {
+		return nil, err
+	}
+	onCall, err := s.repo.SetProjectOnCall(project.ID, req)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil || previous.Name != onCall.Name {
+		s.logger.WithFields(logrus.Fields{
+			"project":  project.Name,
+			"on_call":  onCall.Name,
+			"previous": onCall.PreviousName,
+		}).Info("Project on-call handed off")
+	}
+	return &models.ProjectContacts{Project: project.Name, Owner: project.Owner, OnCall: onCall}, nil
+}
+
+// ClearOnCall records that nobody is on call for a project, given by its ID or name
+func (s *ProjectService) ClearOnCall(ctx context.Context, idOrName string) error {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.DeleteProjectOnCall(project.ID)
+	return err
+}
+
+// ListProjects returns every project ordered by name
+func (s *ProjectService) ListProjects(ctx context.Context) ([]*models.Project, error) {
+	return s.repo.ListProjects()
+}
+
+// CreateProject creates a project without templates or targets
+func (s *ProjectService) CreateProject(ctx context.Context, spec *models.ProjectSpec) (*models.Project, error) {
+	if problems := projectSpecProblems("", *spec); len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProjectConfig, strings.Join(problems, "; "))
+	}
+	existing, err := s.repo.GetProjectByName(spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrProjectExists
+	}
+	organizationID, err := s.projectOrganization(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	project := &models.Project{
+		Name:           spec.Name,
+		Description:    optionalString(spec.Description),
+		IsActive:       true,
+		WorkerPool:     optionalString(spec.WorkerPool),
+		Owner:          optionalString(spec.Owner),
+		OrganizationID: organizationID,
+		PublicStatus:   spec.PublicStatus,
+		// Signing keys are added once the project exists
+		ImageSignaturePolicy: spec.ImageSignaturePolicy.OrDefault(),
+	}
+	if err := s.repo.CreateProject(project); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"project_id": project.ID,
+		"project":    project.Name,
+	}).Info("Project created")
+	return project, nil
+}
+
+// UpdateProject replaces the name, description, worker pool, owner, organization, status page
+// setting and image signature policy of a project. With ifMatch set, the project must not have
+// changed since it was last updated at that time.
+func (s *ProjectService) UpdateProject(ctx context.Context, idOrName string, spec *models.ProjectSpec, ifMatch *time.Time) (*models.Project, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if problems := projectSpecProblems("", *spec); len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProjectConfig, strings.Join(problems, "; "))
+	}
+	existing, err := s.repo.GetProjectByName(spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != project.ID {
+		return nil, ErrProjectExists
+	}
+	organizationID, err := s.projectOrganization(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	project.Name = spec.Name
+	project.Description = optionalString(spec.Description)
+	project.WorkerPool = optionalString(spec.WorkerPool)
+	project.Owner = optionalString(spec.Owner)
+	project.OrganizationID = organizationID
+	project.PublicStatus = spec.PublicStatus
+	project.ImageSignaturePolicy = spec.ImageSignaturePolicy.OrDefault()
+	updated, err := s.repo.UpdateProject(project, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, unchanged(ifMatch, ErrProjectNotFound)
+	}
+	return project, nil
+}
+
+// projectOrganization returns the ID of the organization a project belongs to, nil for none
+func (s *ProjectService) projectOrganization(spec *models.ProjectSpec) (*uuid.UUID, error) {
+	if spec.Organization == "" {
+		return nil, nil
+	}
+	org, err := s.repo.GetOrganizationBySlug(spec.Organization)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, fmt.Errorf("%w: organization %q does not exist", ErrInvalidProjectConfig, spec.Organization)
+	}
+	return &org.ID, nil
+}
+
+// DeleteProject deletes a project with its templates, targets and freeze windows. Deployments of
+// the project are kept. With ifMatch set, the project must not have changed since it was last
+// updated at that time.
+func (s *ProjectService) DeleteProject(ctx context.Context, idOrName string, ifMatch *time.Time) error {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteProject(project.ID, ifMatch)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return unchanged(ifMatch, ErrProjectNotFound)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"project_id": project.ID,
+		"project":    project.Name,
+	}).Info("Project deleted")
+	return nil
+}
+
+// ListTargets returns the deployment targets of a project
+func (s *ProjectService) ListTargets(ctx context.Context, idOrName string) ([]*models.ProjectTarget, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListProjectTargets(project.ID)
+}
+
+// GetTarget returns a deployment target of a project
+func (s *ProjectService) GetTarget(ctx context.Context, idOrName string, targetID uuid.UUID) (*models.ProjectTarget, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.repo.GetProjectTarget(project.ID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrProjectTargetNotFound
+	}
+	return target, nil
+}
+
+// CreateTarget adds a deployment target to a project
+func (s *ProjectService) CreateTarget(ctx context.Context, idOrName string, spec *models.ProjectTargetSpec) (*models.ProjectTarget, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTarget(project.ID, uuid.Nil, spec); err != nil {
+		return nil, err
+	}
+
+	target := &models.ProjectTarget{ProjectID: project.ID, ProjectTargetSpec: *spec}
+	if err := s.repo.CreateProjectTarget(target); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// UpdateTarget replaces a deployment target of a project. With ifMatch set, the target must not
+// have changed since it was last updated at that time.
+func (s *ProjectService) UpdateTarget(ctx context.Context, idOrName string, targetID uuid.UUID, spec *models.ProjectTargetSpec, ifMatch *time.Time) (*models.ProjectTarget, error) {
+	target, err := s.GetTarget(ctx, idOrName, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTarget(target.ProjectID, target.ID, spec); err != nil {
+		return nil, err
+	}
+
+	target.ProjectTargetSpec = *spec
+	updated, err := s.repo.UpdateProjectTarget(target, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, unchanged(ifMatch, ErrProjectTargetNotFound)
+	}
+	return target, nil
+}
+
+// DeleteTarget deletes a deployment target of a project. With ifMatch set, the target must not
+// have changed since it was last updated at that time.
+func (s *ProjectService) DeleteTarget(ctx context.Context, idOrName string, targetID uuid.UUID, ifMatch *time.Time) error {
+	target, err := s.GetTarget(ctx, idOrName, targetID)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteProjectTarget(target.ProjectID, target.ID, ifMatch)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return unchanged(ifMatch, ErrProjectTargetNotFound)
+	}
+	return nil
+}
+
+// checkTarget validates a target of a project and checks no other target, than the one with
+// targetID, has its name
+func (s *ProjectService) checkTarget(projectID, targetID uuid.UUID, spec *models.ProjectTargetSpec) error {
+	if problems := targetProblems("", *spec); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidProjectConfig, strings.Join(problems, "; "))
+	}
+	existing, err := s.repo.GetProjectTargetByName(projectID, spec.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != targetID {
+		return ErrProjectTargetExists
+	}
+	return nil
+}
+
+// ListTemplates returns the deployment templates of a project
+func (s *ProjectService) ListTemplates(ctx context.Context, idOrName string) ([]*models.ProjectTemplate, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListProjectTemplates(project.ID)
+}
+
+// GetTemplate returns a deployment template of a project
+func (s *ProjectService) GetTemplate(ctx context.Context, idOrName string, templateID uuid.UUID) (*models.ProjectTemplate, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	template, err := s.repo.GetProjectTemplate(project.ID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, ErrProjectTemplateNotFound
+	}
+	return template, nil
+}
+
+// CreateTemplate adds a deployment template to a project
+func (s *ProjectService) CreateTemplate(ctx context.Context, idOrName string, spec *models.ProjectTemplateSpec) (*models.ProjectTemplate, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTemplate(project.ID, uuid.Nil, spec); err != nil {
+		return nil, err
+	}
+
+	template := &models.ProjectTemplate{ProjectID: project.ID, ProjectTemplateSpec: *spec}
+	if err := s.repo.CreateProjectTemplate(template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// UpdateTemplate replaces a deployment template of a project. With ifMatch set, the template must
+// not have changed since it was last updated at that time.
+func (s *ProjectService) UpdateTemplate(ctx context.Context, idOrName string, templateID uuid.UUID, spec *models.ProjectTemplateSpec, ifMatch *time.Time) (*models.ProjectTemplate, error) {
+	template, err := s.GetTemplate(ctx, idOrName, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTemplate(template.ProjectID, template.ID, spec); err != nil {
+		return nil, err
+	}
+
+	template.ProjectTemplateSpec = *spec
+	updated, err := s.repo.UpdateProjectTemplate(template, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, unchanged(ifMatch, ErrProjectTemplateNotFound)
+	}
+	return template, nil
+}
+
+// DeleteTemplate deletes a deployment template of a project. With ifMatch set, the template must
+// not have changed since it was last updated at that time.
+func (s *ProjectService) DeleteTemplate(ctx context.Context, idOrName string, templateID uuid.UUID, ifMatch *time.Time) error {
+	template, err := s.GetTemplate(ctx, idOrName, templateID)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteProjectTemplate(template.ProjectID, template.ID, ifMatch)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return unchanged(ifMatch, ErrProjectTemplateNotFound)
+	}
+	return nil
+}
+
+// checkTemplate validates a template of a project and checks no other template, than the one with
+// templateID, has its name
+func (s *ProjectService) checkTemplate(projectID, templateID uuid.UUID, spec *models.ProjectTemplateSpec) error {
+	if problems := templateProblems("", *spec); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidProjectConfig, strings.Join(problems, "; "))
+	}
+	existing, err := s.repo.GetProjectTemplateByName(projectID, spec.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != templateID {
+		return ErrProjectTemplateExists
+	}
+	return nil
+}
+
+// unchanged is the error for a conditional update or delete that matched no row: the resource
+// changed when ifMatch was given, otherwise it was deleted meanwhile
+func unchanged(ifMatch *time.Time, notFound error) error {
+	if ifMatch != nil {
+		return ErrPreconditionFailed
+	}
+	return notFound
+}
+
+// optionalString returns nil for an empty string
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// maxTimelineDeployments bounds the number of deployments on a project timeline
+const maxTimelineDeployments = 1000
+
+// Timeline returns the deployments, rollbacks, incidents and freeze windows of a project between
+// since and until, oldest first. The project is given by its ID or its name; a name without a
+// project record still matches deployments by project name. Users see their own deployments,
+// administrators everyone's.
+func (s *ProjectService) Timeline(ctx context.Context, userID uuid.UUID, idOrName string, since, until time.Time) (*models.ProjectTimeline, error) {
+	timeline := &models.ProjectTimeline{Project: idOrName, Since: since, Until: until, Events: []*models.TimelineEvent{}}
+
+	var project *models.Project
+	var err error
+	if id, parseErr := uuid.Parse(idOrName); parseErr == nil {
+		if project, err = s.repo.GetProjectByID(id); err != nil {
+			return nil, err
+		}
+		if project == nil {
+			return nil, ErrProjectNotFound
+		}
+	} else if project, err = s.repo.GetProjectByName(idOrName); err != nil {
+		return nil, err
+	}
+	if project != nil {
+		timeline.Project = project.Name
+		timeline.ProjectID = &project.ID
+
+		windows, err := s.repo.GetProjectFreezeWindows(project.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, window := range windows {
+			if !window.EndsAt.After(since) || !window.StartsAt.Before(until) {
+				continue
+			}
+			endsAt := window.EndsAt
+			timeline.Events = append(timeline.Events, &models.TimelineEvent{
+				Type:    models.TimelineEventFreezeWindow,
+				At:      window.StartsAt,
+				EndsAt:  &endsAt,
+				Message: window.Reason,
+			})
+		}
+	}
+
+	owner := &userID
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && user.Role == models.RoleAdmin {
+		owner = nil
+	}
+
+	deployments, err := s.repo.GetProjectTimelineDeployments(timeline.Project, owner, since, until, maxTimelineDeployments+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(deployments) > maxTimelineDeployments {
+		deployments = deployments[:maxTimelineDeployments]
+		timeline.Truncated = true
+	}
+
+	ids := make([]uuid.UUID, 0, len(deployments))
+	byID := make(map[uuid.UUID]*models.Deployment, len(deployments))
+	for _, deployment := range deployments {
+		ids = append(ids, deployment.ID)
+		byID[deployment.ID] = deployment
+		timeline.Events = append(timeline.Events, timelineEvent(models.TimelineEventDeployment, deployment, deployment.CreatedAt))
+
+		if deployment.Status == models.DeploymentStatusFailed {
+			at := deployment.UpdatedAt
+			if deployment.CompletedAt != nil {
+				at = *deployment.CompletedAt
+			}
+			incident := timelineEvent(models.TimelineEventIncident, deployment, at)
+			incident.EndsAt = nil
+			if deployment.ErrorMessage != nil {
+				incident.Message = *deployment.ErrorMessage
+			}
+			timeline.Events = append(timeline.Events, incident)
+		}
+	}
+
+	steps, err := s.repo.GetRolledBackSteps(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		deployment := byID[step.DeploymentID]
+		at := deployment.UpdatedAt
+		if step.CompletedAt != nil {
+			at = *step.CompletedAt
+		}
+		rollback := timelineEvent(models.TimelineEventRollback, deployment, at)
+		rollback.EndsAt = nil
+		rollback.Step = step.StepName
+		if step.ErrorMessage != nil {
+			rollback.Message = *step.ErrorMessage
+		}
+		timeline.Events = append(timeline.Events, rollback)
+	}
+
+	sort.SliceStable(timeline.Events, func(i, j int) bool {
+		return timeline.Events[i].At.Before(timeline.Events[j].At)
+	})
+	return timeline, nil
+}
+
+// timelineEvent describes a deployment on the timeline at the given time
+func timelineEvent(eventType models.TimelineEventType, deployment *models.Deployment, at time.Time) *models.TimelineEvent {
+	status := deployment.Status
+	return &models.TimelineEvent{
+		Type:           eventType,
+		At:             at,
+		EndsAt:         deployment.CompletedAt,
+		DeploymentID:   &deployment.ID,
+		DeploymentName: deployment.DeploymentName,
+		Status:         &status,
+		GitHubBranch:   deployment.GitHubBranch,
+		CreatedBy:      deployment.CreatedBy,
+	}
+}
+
+// maxStatusEnvironments bounds the number of environments on a status page
+const maxStatusEnvironments = 50
+
+// StatusPage returns the public status of a project, given by its ID or name, with the given number
+// of days of history, built from the deployments of the project's organization. Projects that did
+// not opt in to a status page or have no organization are reported as not found, so their existence
+// is not revealed either.
+func (s *ProjectService) StatusPage(ctx context.Context, idOrName string, days int) (*models.ProjectStatusPage, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if !project.PublicStatus || project.OrganizationID == nil {
+		return nil, ErrProjectNotFound
+	}
+
+	now := time.Now().UTC()
+	page := &models.ProjectStatusPage{
+		Project:     project.Name,
+		Description: project.Description,
+		GeneratedAt: now,
+	}
+	// Status pages are public and may be polled often, so they are built from the read replica
+	reads := s.repo.Replica()
+	if page.Environments, err = reads.GetProjectEnvironmentStatuses(project.Name, *project.OrganizationID, maxStatusEnvironments); err != nil {
+		return nil, err
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	since := today.AddDate(0, 0, 1-days)
+	trend, err := reads.GetProjectTrend(nil, project.OrganizationID, project.Name, since)
+	if err != nil {
+		return nil, err
+	}
+	points := make(map[string]*models.ProjectTrendPoint, len(trend))
+	for _, point := range trend {
+		points[point.Date] = point
+	}
+
+	succeeded, finished := 0, 0
+	page.History = make([]*models.StatusDay, 0, days)
+	for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		point, ok := points[date]
+		if !ok {
+			page.History = append(page.History, models.NewStatusDay(date, 0, 0, 0))
+			continue
+		}
+		page.History = append(page.History, models.NewStatusDay(date, point.Deployments, point.Succeeded, point.Failed))
+		succeeded += point.Succeeded
+		finished += point.Succeeded + point.Failed
+	}
+	if finished > 0 {
+		rate := float64(succeeded) / float64(finished)
+		page.SuccessRate = &rate
+	}
+	return page, nil
+}
+
+// defaultBadgeLabel labels the badge of a project's latest deployment in any environment
+const defaultBadgeLabel = "deploy"
+
+// Badge returns the status badge of a project, given by its ID or name: the latest deployment of
+// environment, or of the whole project when environment is empty, by a member of the project's
+// organization. Projects without a public status page need their badge token. A missing or wrong
+// token, or a project without an organization, is reported as the project not being found, so
+// private projects are not revealed.
+func (s *ProjectService) Badge(ctx context.Context, idOrName, token, environment string) (*models.ProjectBadge, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	if project.OrganizationID == nil {
+		return nil, ErrProjectNotFound
+	}
+	if !project.PublicStatus {
+		tokenHash, err := s.repo.GetProjectBadgeTokenHash(project.ID)
+		if err != nil {
+			return nil, err
+		}
+		if token == "" || tokenHash == "" || subtle.ConstantTimeCompare([]byte(hashAPIKey(token)), []byte(tokenHash)) != 1 {
+			return nil, ErrProjectNotFound
+		}
+	}
+
+	statuses, err := s.repo.Replica().GetProjectEnvironmentStatuses(project.Name, *project.OrganizationID, maxStatusEnvironments)
+	if err != nil {
+		return nil, err
+	}
+	var latest *models.EnvironmentStatus
+	for _, status := range statuses {
+		if environment != "" {
+			if status.Environment == environment {
+				latest = status
+				break
+			}
+			continue
+		}
+		if latest == nil || status.UpdatedAt.After(latest.UpdatedAt) {
+			latest = status
+		}
+	}
+
+	label := defaultBadgeLabel
+	if environment != "" {
+		label = environment
+	}
+	badge := models.NewProjectBadge(label, latest)
+	badge.Public = project.PublicStatus
+	return badge, nil
+}
+
+// RotateBadgeToken creates a new badge token for a project, given by its ID or name, replacing its
+// previous one. The token is only returned here; DeployKnot keeps a hash.
+func (s *ProjectService) RotateBadgeToken(ctx context.Context, idOrName string) (*models.ProjectBadgeToken, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate badge token: %w", err)
+	}
+	token := models.BadgeTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	created, err := s.repo.SetProjectBadgeToken(project.ID, hashAPIKey(token), token[:apiKeyPrefixLength])
+	if err != nil {
+		return nil, err
+	}
+	created.Project = project.Name
+	created.Token = token
+
+	s.logger.WithFields(logrus.Fields{
+		"project": project.Name,
+		"prefix":  created.Prefix,
+	}).Info("Project badge token rotated")
+	return created, nil
+}
+
+// RevokeBadgeToken deletes the badge token of a project, given by its ID or name
+func (s *ProjectService) RevokeBadgeToken(ctx context.Context, idOrName string) error {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.DeleteProjectBadgeToken(project.ID)
+	return err
+}
+
+// ListSigningKeys returns the signing keys of a project, given by its ID or name
+func (s *ProjectService) ListSigningKeys(ctx context.Context, idOrName string) ([]*models.ProjectSigningKey, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListProjectSigningKeys(project.ID)
+}
+
+// AddSigningKey adds a cosign public key to a project, given by its ID or name. Images of the
+// project's deployments pass the verification when one of its keys signed them.
+func (s *ProjectService) AddSigningKey(ctx context.Context, idOrName string, req *models.CreateProjectSigningKeyRequest) (*models.ProjectSigningKey, error) {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := models.SigningKeyFingerprint(req.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProjectConfig, err)
+	}
+
+	key := &models.ProjectSigningKey{
+		ProjectID:   project.ID,
+		Name:        strings.TrimSpace(req.Name),
+		PublicKey:   strings.TrimSpace(req.PublicKey) + "\n",
+		Fingerprint: fingerprint,
+	}
+	if key.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidProjectConfig)
+	}
+	created, err := s.repo.CreateProjectSigningKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrProjectSigningKeyExists
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"project":     project.Name,
+		"key":         key.Name,
+		"fingerprint": key.Fingerprint,
+	}).Info("Project signing key added")
+	return key, nil
+}
+
+// DeleteSigningKey deletes a signing key of a project, given by its ID or name
+func (s *ProjectService) DeleteSigningKey(ctx context.Context, idOrName string, keyID uuid.UUID) error {
+	project, err := s.GetProject(ctx, idOrName)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteProjectSigningKey(project.ID, keyID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrProjectSigningKeyNotFound
+	}
+	s.logger.WithFields(logrus.Fields{
+		"project": project.Name,
+		"key_id":  keyID,
+	}).Info("Project signing key deleted")
+	return nil
+}
+
+// MarshalProjectConfig renders a project configuration as YAML
+func MarshalProjectConfig(cfg *models.ProjectConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to marshal project configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal project configuration: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseProjectConfig parses a YAML project configuration, rejecting unknown fields
+func ParseProjectConfig(data []byte) (*models.ProjectConfig, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var cfg models.ProjectConfig
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProjectConfig, err)
+	}
+	return &cfg, nil
+}
+
+// ValidateProjectConfig checks a project configuration before it is imported
+func ValidateProjectConfig(cfg *models.ProjectConfig) error {
+	var problems []string
+	if cfg.APIVersion != models.ProjectConfigAPIVersion {
+		problems = append(problems, fmt.Sprintf("apiVersion must be %q", models.ProjectConfigAPIVersion))
+	}
+	if cfg.Kind != models.ProjectConfigKind {
+		problems = append(problems, fmt.Sprintf("kind must be %q", models.ProjectConfigKind))
+	}
+	problems = append(problems, projectSpecProblems("project.", cfg.Project)...)
+
+	templateNames := make(map[string]bool)
+	for i, template := range cfg.Templates {
+		prefix := fmt.Sprintf("templates[%d].", i)
+		if templateNames[template.Name] {
+			problems = append(problems, fmt.Sprintf("%sname %q is duplicated", prefix, template.Name))
+		}
+		templateNames[template.Name] = true
+		problems = append(problems, templateProblems(prefix, template)...)
+	}
+
+	targetNames := make(map[string]bool)
+	for i, target := range cfg.Targets {
+		prefix := fmt.Sprintf("targets[%d].", i)
+		if targetNames[target.Name] {
+			problems = append(problems, fmt.Sprintf("%sname %q is duplicated", prefix, target.Name))
+		}
+		targetNames[target.Name] = true
+		problems = append(problems, targetProblems(prefix, target)...)
+	}
+
+	for i, window := range cfg.FreezeWindows {
+		switch {
+		case window.StartsAt.IsZero() || window.EndsAt.IsZero():
+			problems = append(problems, fmt.Sprintf("freeze_windows[%d] needs starts_at and ends_at", i))
+		case !window.EndsAt.After(window.StartsAt):
+			problems = append(problems, fmt.Sprintf("freeze_windows[%d].ends_at must be after starts_at", i))
+		}
+		if len(window.Reason) > 500 {
+			problems = append(problems, fmt.Sprintf("freeze_windows[%d].reason must be at most 500 characters", i))
+		}
+	}
+
+	gateNames := make(map[string]bool)
+	for i, gate := range cfg.Gates {
+		prefix := fmt.Sprintf("gates[%d].", i)
+		if err := models.ValidateGateName(gate.Name); err != nil {
+			problems = append(problems, prefix+"name: "+err.Error())
+		} else if gateNames[gate.Name] {
+			problems = append(problems, fmt.Sprintf("%sname %q is duplicated", prefix, gate.Name))
+		}
+		gateNames[gate.Name] = true
+		if gate.TimeoutMinutes < 1 || gate.TimeoutMinutes > 7*24*60 {
+			problems = append(problems, prefix+"timeout_minutes must be between 1 and 10080 (one week)")
+		}
+		if len(gate.Description) > 500 {
+			problems = append(problems, prefix+"description must be at most 500 characters")
+		}
+	}
+
+	if cfg.Notifications != nil {
+		problems = append(problems, notificationProblems("notifications.", cfg.Notifications)...)
+	}
+	if cfg.Incidents != nil {
+		if err := cfg.Incidents.Validate(); err != nil {
+			problems = append(problems, "incidents: "+err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidProjectConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// notificationProblems lists what is wrong with the notifications of a project, prefixing field
+// names with prefix
+func notificationProblems(prefix string, spec *models.ProjectNotificationsSpec) []string {
+	var problems []string
+	if digest := spec.Digest; digest != nil {
+		if err := models.ValidateChannelName(digest.Channel); err != nil {
+			problems = append(problems, prefix+"digest.channel: "+err.Error())
+		}
+		if next, err := digest.NextSend(time.Now()); err != nil {
+			problems = append(problems, prefix+"digest: "+err.Error())
+		} else if next == nil {
+			problems = append(problems, fmt.Sprintf("%sdigest.cron_expression %q never runs", prefix, digest.CronExpression))
+		}
+	}
+	for i, escalation := range spec.Escalations {
+		escalationPrefix := fmt.Sprintf("%sescalations[%d].", prefix, i)
+		if err := models.ValidateChannelName(escalation.Channel); err != nil {
+			problems = append(problems, escalationPrefix+"channel: "+err.Error())
+		}
+		if escalation.AfterMinutes < 1 || escalation.AfterMinutes > 7*24*60 {
+			problems = append(problems, escalationPrefix+"after_minutes must be between 1 and 10080 (one week)")
+		}
+		for _, environment := range escalation.Environments {
+			if strings.TrimSpace(environment) == "" || len(environment) > 200 {
+				problems = append(problems, escalationPrefix+"environments must be non-empty deployment names of at most 200 characters")
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// projectSpecProblems lists what is wrong with a project, prefixing field names with prefix
+func projectSpecProblems(prefix string, spec models.ProjectSpec) []string {
+	var problems []string
+	if strings.TrimSpace(spec.Name) == "" || len(spec.Name) > 200 {
+		problems = append(problems, prefix+"name is required and must be at most 200 characters")
+	}
+	if spec.WorkerPool != "" {
+		if err := models.ValidateWorkerPool(spec.WorkerPool); err != nil {
+			problems = append(problems, prefix+"worker_pool: "+err.Error())
+		}
+	}
+	if len(spec.Owner) > 200 {
+		problems = append(problems, prefix+"owner must be at most 200 characters")
+	}
+	if spec.PublicStatus && spec.Organization == "" {
+		problems = append(problems, prefix+"public_status needs an organization, whose members' deployments the status page shows")
+	}
+	if spec.ImageSignaturePolicy != "" && !spec.ImageSignaturePolicy.IsValid() {
+		problems = append(problems, fmt.Sprintf("%simage_signature_policy must be %q, %q or %q", prefix, models.ImageSignatureOff, models.ImageSignatureWarn, models.ImageSignatureEnforce))
+	}
+	return problems
+}
+
+// templateProblems lists what is wrong with a deployment template, prefixing field names with prefix
+func templateProblems(prefix string, template models.ProjectTemplateSpec) []string {
+	var problems []string
+	if strings.TrimSpace(template.Name) == "" || len(template.Name) > 200 {
+		problems = append(problems, prefix+"name is required and must be at most 200 characters")
+	}
+	if strings.TrimSpace(template.PlaybookTemplate) == "" {
+		problems = append(problems, prefix+"playbook_template is required")
+	}
+	return problems
+}
+
+// targetProblems lists what is wrong with a deployment target, prefixing field names with prefix
+func targetProblems(prefix string, target models.ProjectTargetSpec) []string {
+	var problems []string
+	if strings.TrimSpace(target.Name) == "" || len(target.Name) > 200 {
+		problems = append(problems, prefix+"name is required and must be at most 200 characters")
+	}
+	switch target.TargetType {
+	case "", models.TargetTypeSSH:
+		if target.TargetIP == "" || target.SSHUsername == "" {
+			subject := strings.TrimSuffix(prefix, ".")
+			if subject == "" {
+				subject = "target"
+			}
+			problems = append(problems, subject+" needs target_ip and ssh_username")
+		}
+	case models.TargetTypeKubernetes:
+	default:
+		problems = append(problems, fmt.Sprintf("%starget_type must be %q or %q", prefix, models.TargetTypeSSH, models.TargetTypeKubernetes))
+	}
+	if target.Port < 0 || target.Port > 65535 {
+		problems = append(problems, prefix+"port must be between 1 and 65535")
+	}
+	if target.WorkerPool != "" {
+		if err := models.ValidateWorkerPool(target.WorkerPool); err != nil {
+			problems = append(problems, fmt.Sprintf("%sworker_pool: %s", prefix, err))
+		}
+	}
+	return problems
+}
@@ -3,9 +3,17 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -39,25 +47,179 @@ type Job struct {
 	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
 	ErrorMessage *string                `json:"error_message,omitempty"`
 	DeploymentID uuid.UUID              `json:"deployment_id"`
+	Pool         string                 `json:"pool,omitempty"`
+	Requeues     int                    `json:"requeues,omitempty"`
+	Deferrals    int                    `json:"deferrals,omitempty"`
+	// PassedOver counts how often workers that cannot run the job put it back for the others
+	PassedOver int `json:"passed_over,omitempty"`
+	// ResumeFrom is the order of the step a resumed deployment starts from; earlier steps are skipped
+	ResumeFrom int `json:"resume_from,omitempty"`
+}
+
+// ErrJobNotFound is returned when a job, or the job of a deployment, is no longer in Redis
+var ErrJobNotFound = errors.New("job not found")
+
+// Redis keys used by the queue
+const (
+	deploymentQueueKey = "deployknot:queue:deployments"
+	// deploymentPoolsKey lists the named worker pools jobs have been queued for or workers consume
+	deploymentPoolsKey = "deployknot:queue:pools"
+	workerHeartbeatKey = "deployknot:workers:heartbeats"
+	// workerJobsKey maps each busy worker to the deployment it is processing
+	workerJobsKey = "deployknot:workers:jobs"
+	// workerPoolsKey maps each worker to the pool it consumes
+	workerPoolsKey = "deployknot:workers:pools"
+	// workerCapabilitiesKey maps each worker to the JSON capabilities it advertises
+	workerCapabilitiesKey = "deployknot:workers:capabilities"
+)
+
+// poolQueueKey is the queue of a worker pool; the default pool keeps the original queue
+func poolQueueKey(pool string) string {
+	if pool == "" {
+		return deploymentQueueKey
+	}
+	return deploymentQueueKey + ":" + pool
+}
+
+// poolName names a pool in reports, where the default pool has no empty name
+func poolName(pool string) string {
+	if pool == "" {
+		return models.DefaultWorkerPool
+	}
+	return pool
+}
+
+// deploymentJobKey maps a deployment to the ID of its latest job
+func deploymentJobKey(deploymentID uuid.UUID) string {
+	return fmt.Sprintf("deployknot:deployment:%s:job", deploymentID.String())
+}
+
+// deploymentLockKey is held by the worker processing a deployment
+func deploymentLockKey(deploymentID uuid.UUID) string {
+	return fmt.Sprintf("deployknot:lock:deployment:%s", deploymentID.String())
+}
+
+// concurrencyLockKey is held by the deployment running in a concurrency group
+func concurrencyLockKey(key string) string {
+	return "deployknot:lock:concurrency:" + key
+}
+
+// releaseLockScript deletes a lock only if it is still held by the given owner
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// QueueHealth describes the deployment queue and the workers consuming it, in total and per worker pool
+type QueueHealth struct {
+	Pool                    string     `json:"pool,omitempty"`
+	Depth                   int64      `json:"depth"`
+	OldestPendingAgeSeconds *float64   `json:"oldest_pending_age_seconds,omitempty"`
+	ActiveWorkers           int64      `json:"active_workers"`
+	InFlight                int64      `json:"in_flight"`
+	LastWorkerHeartbeat     *time.Time `json:"last_worker_heartbeat,omitempty"`
+	// Pools breaks the totals down by worker pool, the default pool first
+	Pools []*QueueHealth `json:"pools,omitempty"`
 }
 
 // QueueService handles job queue operations
 type QueueService struct {
-	redis  *redis.Client
-	logger *logrus.Logger
+	redis *redis.Client
+	// jobs holds the pending jobs of each worker pool
+	jobs JobQueue
+	// repo keeps the history of jobs in the jobs table
+	repo *database.Repository
+	// encryptor encrypts the data of the jobs kept in Redis, which carries credentials
+	encryptor *encryption.Encryptor
+	config    config.QueueConfig
+	logger    *logrus.Logger
 }
 
 // NewQueueService creates a new queue service
-func NewQueueService(redis *redis.Client, logger *logrus.Logger) *QueueService {
+func NewQueueService(redis *redis.Client, jobs JobQueue, repo *database.Repository, encryptor *encryption.Encryptor, cfg config.QueueConfig, logger *logrus.Logger) *QueueService {
 	return &QueueService{
-		redis:  redis,
-		logger: logger,
+		redis:     redis,
+		jobs:      jobs,
+		repo:      repo,
+		encryptor: encryptor,
+		config:    cfg,
+		logger:    logger,
 	}
 }
 
-// EnqueueDeploymentJob enqueues a deployment job
-func (q *QueueService) EnqueueDeploymentJob(ctx context.Context, deploymentID uuid.UUID, deploymentData map[string]interface{}) error {
-	job := &Job{
+// queuedJob is a job as kept in Redis. Its data carries SSH passwords and GitHub tokens, so it is
+// stored encrypted with the server's key; Data is only set by jobs queued before data was encrypted.
+type queuedJob struct {
+	Job
+	Data          map[string]interface{} `json:"data,omitempty"`
+	DataEncrypted string                 `json:"data_encrypted,omitempty"`
+}
+
+// marshalJob serializes a job for Redis with its data encrypted
+func (q *QueueService) marshalJob(job *Job) ([]byte, error) {
+	dataJSON, err := json.Marshal(job.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job data: %w", err)
+	}
+	dataEncrypted, err := q.encryptor.Encrypt(string(dataJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt job data: %w", err)
+	}
+
+	jobJSON, err := json.Marshal(queuedJob{Job: *job, DataEncrypted: dataEncrypted})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job: %w", err)
+	}
+	return jobJSON, nil
+}
+
+// unmarshalJob deserializes a job kept in Redis and decrypts its data
+func (q *QueueService) unmarshalJob(jobJSON string) (*Job, error) {
+	var queued queuedJob
+	if err := json.Unmarshal([]byte(jobJSON), &queued); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+
+	job := queued.Job
+	job.Data = queued.Data
+	if queued.DataEncrypted != "" {
+		dataJSON, err := q.encryptor.Decrypt(queued.DataEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt job data: %w", err)
+		}
+		if err := json.Unmarshal([]byte(dataJSON), &job.Data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job data: %w", err)
+		}
+	}
+	return &job, nil
+}
+
+// recordJob keeps the current state of a job in the jobs table. Failures are only logged, so the
+// queue keeps working while PostgreSQL is unavailable.
+func (q *QueueService) recordJob(job *Job) {
+	record := &models.JobRecord{
+		ID:           job.ID,
+		DeploymentID: job.DeploymentID,
+		Type:         string(job.Type),
+		Status:       string(job.Status),
+		Pool:         job.Pool,
+		Requeues:     job.Requeues,
+		Deferrals:    job.Deferrals,
+		ErrorMessage: job.ErrorMessage,
+		CreatedAt:    job.CreatedAt,
+		StartedAt:    job.StartedAt,
+		CompletedAt:  job.CompletedAt,
+	}
+	if err := q.repo.RecordJob(record); err != nil {
+		q.logger.WithError(err).WithField("job_id", job.ID).Warn("Failed to record job history")
+	}
+}
+
+// NewDeploymentJob builds a pending deployment job without enqueuing it
+func NewDeploymentJob(deploymentID uuid.UUID, deploymentData map[string]interface{}) *Job {
+	return &Job{
 		ID:           uuid.New(),
 		Type:         JobTypeDeployment,
 		Status:       JobStatusPending,
@@ -65,58 +227,70 @@ func (q *QueueService) EnqueueDeploymentJob(ctx context.Context, deploymentID uu
 		CreatedAt:    time.Now(),
 		DeploymentID: deploymentID,
 	}
+}
+
+// EnqueueDeploymentJob enqueues a deployment job
+func (q *QueueService) EnqueueDeploymentJob(ctx context.Context, deploymentID uuid.UUID, deploymentData map[string]interface{}) error {
+	return q.EnqueueJob(ctx, NewDeploymentJob(deploymentID, deploymentData))
+}
+
+// EnqueueJob pushes an already built job onto the queue
+func (q *QueueService) EnqueueJob(ctx context.Context, job *Job) error {
+	deploymentID := job.DeploymentID
 
 	// Serialize job to JSON
-	jobJSON, err := json.Marshal(job)
+	jobJSON, err := q.marshalJob(job)
 	if err != nil {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
-	// Add to Redis queue
-	queueKey := "deployknot:queue:deployments"
-	err = q.redis.LPush(ctx, queueKey, jobJSON).Err()
+	// Add to the queue of the job's worker pool
+	err = q.jobs.Push(ctx, job.Pool, jobJSON)
 	if err != nil {
 		return fmt.Errorf("failed to enqueue job: %w", err)
 	}
+	if job.Pool != "" {
+		if err := q.redis.SAdd(ctx, deploymentPoolsKey, job.Pool).Err(); err != nil {
+			q.logger.WithError(err).Error("Failed to register worker pool")
+		}
+	}
 
 	// Store job details for tracking
 	jobKey := fmt.Sprintf("deployknot:job:%s", job.ID.String())
-	err = q.redis.Set(ctx, jobKey, jobJSON, 24*time.Hour).Err()
+	err = q.redis.Set(ctx, jobKey, jobJSON, q.config.JobTTL).Err()
 	if err != nil {
 		q.logger.WithError(err).Error("Failed to store job details")
 	}
+	if err := q.redis.Set(ctx, deploymentJobKey(deploymentID), job.ID.String(), q.config.JobTTL).Err(); err != nil {
+		q.logger.WithError(err).Error("Failed to index job by deployment")
+	}
+	q.recordJob(job)
 
 	q.logger.WithFields(logrus.Fields{
 		"job_id":        job.ID,
 		"deployment_id": deploymentID,
 		"type":          job.Type,
+		"pool":          poolName(job.Pool),
 	}).Info("Job enqueued successfully")
 
 	return nil
 }
 
-// DequeueJob dequeues a job from the queue
-func (q *QueueService) DequeueJob(ctx context.Context) (*Job, error) {
-	queueKey := "deployknot:queue:deployments"
-
-	// Use BRPOP to block until a job is available
-	result, err := q.redis.BRPop(ctx, 30*time.Second, queueKey).Result()
+// DequeueJob dequeues a job from the queue of a worker pool; "" is the default pool
+func (q *QueueService) DequeueJob(ctx context.Context, pool string) (*Job, error) {
+	// Block until a job is available
+	jobJSON, err := q.jobs.Pop(ctx, pool, 30*time.Second)
 	if err != nil {
-		if err == redis.Nil {
-			return nil, nil // No jobs available
-		}
 		return nil, fmt.Errorf("failed to dequeue job: %w", err)
 	}
-
-	if len(result) < 2 {
-		return nil, fmt.Errorf("invalid queue result")
+	if jobJSON == nil {
+		return nil, nil // No jobs available
 	}
 
 	// Parse job JSON
-	var job Job
-	err = json.Unmarshal([]byte(result[1]), &job)
+	job, err := q.unmarshalJob(string(jobJSON))
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+		return nil, err
 	}
 
 	// Update job status
@@ -125,9 +299,11 @@ func (q *QueueService) DequeueJob(ctx context.Context) (*Job, error) {
 	job.StartedAt = &now
 
 	// Update job in Redis
-	jobJSON, _ := json.Marshal(job)
-	jobKey := fmt.Sprintf("deployknot:job:%s", job.ID.String())
-	q.redis.Set(ctx, jobKey, jobJSON, 24*time.Hour)
+	if jobJSON, err := q.marshalJob(job); err == nil {
+		jobKey := fmt.Sprintf("deployknot:job:%s", job.ID.String())
+		q.redis.Set(ctx, jobKey, jobJSON, q.config.JobTTL)
+	}
+	q.recordJob(job)
 
 	q.logger.WithFields(logrus.Fields{
 		"job_id":        job.ID,
@@ -135,7 +311,7 @@ func (q *QueueService) DequeueJob(ctx context.Context) (*Job, error) {
 		"type":          job.Type,
 	}).Info("Job dequeued and started")
 
-	return &job, nil
+	return job, nil
 }
 
 // UpdateJobStatus updates the status of a job
@@ -148,10 +324,9 @@ func (q *QueueService) UpdateJobStatus(ctx context.Context, jobID uuid.UUID, sta
 		return fmt.Errorf("failed to get job: %w", err)
 	}
 
-	var job Job
-	err = json.Unmarshal([]byte(jobJSON), &job)
+	job, err := q.unmarshalJob(jobJSON)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal job: %w", err)
+		return err
 	}
 
 	// Update job status
@@ -164,11 +339,15 @@ func (q *QueueService) UpdateJobStatus(ctx context.Context, jobID uuid.UUID, sta
 	}
 
 	// Save updated job
-	updatedJobJSON, _ := json.Marshal(job)
-	err = q.redis.Set(ctx, jobKey, updatedJobJSON, 24*time.Hour).Err()
+	updatedJobJSON, err := q.marshalJob(job)
+	if err != nil {
+		return err
+	}
+	err = q.redis.Set(ctx, jobKey, updatedJobJSON, q.config.JobTTL).Err()
 	if err != nil {
 		return fmt.Errorf("failed to update job: %w", err)
 	}
+	q.recordJob(job)
 
 	q.logger.WithFields(logrus.Fields{
 		"job_id":        jobID,
@@ -180,6 +359,37 @@ func (q *QueueService) UpdateJobStatus(ctx context.Context, jobID uuid.UUID, sta
 	return nil
 }
 
+// RemoveJobData deletes a key from the data of the job kept for tracking; missing jobs are ignored
+func (q *QueueService) RemoveJobData(ctx context.Context, jobID uuid.UUID, key string) error {
+	jobKey := fmt.Sprintf("deployknot:job:%s", jobID.String())
+
+	jobJSON, err := q.redis.Get(ctx, jobKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	job, err := q.unmarshalJob(jobJSON)
+	if err != nil {
+		return err
+	}
+	if _, ok := job.Data[key]; !ok {
+		return nil
+	}
+	delete(job.Data, key)
+
+	updatedJobJSON, err := q.marshalJob(job)
+	if err != nil {
+		return err
+	}
+	if err := q.redis.SetArgs(ctx, jobKey, updatedJobJSON, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err(); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	return nil
+}
+
 // GetJob retrieves a job by ID
 func (q *QueueService) GetJob(ctx context.Context, jobID uuid.UUID) (*Job, error) {
 	jobKey := fmt.Sprintf("deployknot:job:%s", jobID.String())
@@ -187,26 +397,503 @@ func (q *QueueService) GetJob(ctx context.Context, jobID uuid.UUID) (*Job, error
 	jobJSON, err := q.redis.Get(ctx, jobKey).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("job not found")
+			return nil, ErrJobNotFound
 		}
 		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
 
+	return q.unmarshalJob(jobJSON)
+}
+
+// GetQueueLength returns the number of jobs in the queue of a worker pool
+func (q *QueueService) GetQueueLength(ctx context.Context, pool string) (int64, error) {
+	length, err := q.jobs.Len(ctx, pool)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue length: %w", err)
+	}
+	return length, nil
+}
+
+// GetOldestPendingJobAge returns how long the oldest job queued for a worker pool has been waiting;
+// ok is false when the queue is empty
+func (q *QueueService) GetOldestPendingJobAge(ctx context.Context, pool string) (age time.Duration, ok bool, err error) {
+	jobJSON, err := q.jobs.Oldest(ctx, pool)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get oldest job: %w", err)
+	}
+	if jobJSON == nil {
+		return 0, false, nil
+	}
+
 	var job Job
-	err = json.Unmarshal([]byte(jobJSON), &job)
+	if err := json.Unmarshal(jobJSON, &job); err != nil {
+		return 0, false, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+
+	return time.Since(job.CreatedAt), true, nil
+}
+
+// RecordWorkerHeartbeat records that the given worker of a pool is alive with the capabilities it
+// advertises; entries older than expireAfter are pruned
+func (q *QueueService) RecordWorkerHeartbeat(ctx context.Context, workerID, pool string, capabilities models.WorkerCapabilities, expireAfter time.Duration) error {
+	capabilitiesJSON, err := json.Marshal(capabilities)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+		return fmt.Errorf("failed to marshal worker capabilities: %w", err)
 	}
 
-	return &job, nil
+	now := time.Now()
+	pipe := q.redis.TxPipeline()
+	pipe.ZAdd(ctx, workerHeartbeatKey, redis.Z{Score: float64(now.Unix()), Member: workerID})
+	pipe.ZRemRangeByScore(ctx, workerHeartbeatKey, "-inf", fmt.Sprintf("(%d", now.Add(-expireAfter).Unix()))
+	pipe.HSet(ctx, workerPoolsKey, workerID, pool)
+	pipe.HSet(ctx, workerCapabilitiesKey, workerID, capabilitiesJSON)
+	if pool != "" {
+		pipe.SAdd(ctx, deploymentPoolsKey, pool)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record worker heartbeat: %w", err)
+	}
+	return nil
 }
 
-// GetQueueLength returns the number of jobs in the queue
-func (q *QueueService) GetQueueLength(ctx context.Context) (int64, error) {
-	queueKey := "deployknot:queue:deployments"
-	length, err := q.redis.LLen(ctx, queueKey).Result()
+// workerJobField is the field of workerJobsKey recording the deployment a worker processes in one
+// of its slots; the first slot keeps the worker's ID
+func workerJobField(workerID string, slot int) string {
+	if slot == 0 {
+		return workerID
+	}
+	return fmt.Sprintf("%s#%d", workerID, slot)
+}
+
+// SetWorkerJob records the deployment a worker is processing in one of its slots
+func (q *QueueService) SetWorkerJob(ctx context.Context, workerID string, slot int, deploymentID uuid.UUID) error {
+	if err := q.redis.HSet(ctx, workerJobsKey, workerJobField(workerID, slot), deploymentID.String()).Err(); err != nil {
+		return fmt.Errorf("failed to record worker job: %w", err)
+	}
+	return nil
+}
+
+// ClearWorkerJob records that a worker is no longer processing a deployment in one of its slots
+func (q *QueueService) ClearWorkerJob(ctx context.Context, workerID string, slot int) error {
+	if err := q.redis.HDel(ctx, workerJobsKey, workerJobField(workerID, slot)).Err(); err != nil {
+		return fmt.Errorf("failed to clear worker job: %w", err)
+	}
+	return nil
+}
+
+// busyWorkers returns the deployments each of the given live workers is processing. Entries of
+// workers that stopped sending heartbeats are pruned, since workers that died mid-job never clear them.
+func (q *QueueService) busyWorkers(ctx context.Context, live map[string]bool) (map[string][]uuid.UUID, error) {
+	jobs, err := q.redis.HGetAll(ctx, workerJobsKey).Result()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get queue length: %w", err)
+		return nil, fmt.Errorf("failed to list worker jobs: %w", err)
 	}
-	return length, nil
+
+	busy := make(map[string][]uuid.UUID)
+	var stale []string
+	for field, deployment := range jobs {
+		worker, _, _ := strings.Cut(field, "#")
+		if !live[worker] {
+			stale = append(stale, field)
+			continue
+		}
+		if deploymentID, err := uuid.Parse(deployment); err == nil {
+			busy[worker] = append(busy[worker], deploymentID)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := q.redis.HDel(ctx, workerJobsKey, stale...).Err(); err != nil {
+			q.logger.WithError(err).Debug("Failed to prune stale worker jobs")
+		}
+	}
+	return busy, nil
+}
+
+// Health reports queue depth, the age of the oldest pending job, how many workers sent a heartbeat
+// within staleAfter and how many of them are processing a deployment, in total and per worker pool
+func (q *QueueService) Health(ctx context.Context, staleAfter time.Duration) (*QueueHealth, error) {
+	health := &QueueHealth{}
+
+	named, err := q.redis.SMembers(ctx, deploymentPoolsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker pools: %w", err)
+	}
+	sort.Strings(named)
+
+	pools := make(map[string]*QueueHealth)
+	for _, pool := range append([]string{""}, named...) {
+		poolHealth := &QueueHealth{Pool: poolName(pool)}
+		pools[pool] = poolHealth
+		health.Pools = append(health.Pools, poolHealth)
+
+		poolHealth.Depth, err = q.GetQueueLength(ctx, pool)
+		if err != nil {
+			return nil, err
+		}
+		health.Depth += poolHealth.Depth
+
+		age, ok, err := q.GetOldestPendingJobAge(ctx, pool)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			seconds := age.Seconds()
+			poolHealth.OldestPendingAgeSeconds = &seconds
+			if health.OldestPendingAgeSeconds == nil || seconds > *health.OldestPendingAgeSeconds {
+				health.OldestPendingAgeSeconds = &seconds
+			}
+		}
+	}
+
+	since := time.Now().Add(-staleAfter).Unix()
+	heartbeats, err := q.redis.ZRangeByScoreWithScores(ctx, workerHeartbeatKey, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", since),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active workers: %w", err)
+	}
+	workerPools, err := q.redis.HGetAll(ctx, workerPoolsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker pools: %w", err)
+	}
+
+	live := make(map[string]bool, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		live[heartbeat.Member.(string)] = true
+	}
+	busy, err := q.busyWorkers(ctx, live)
+	if err != nil {
+		return nil, err
+	}
+
+	// Live workers record their pool and capabilities with every heartbeat, so those of the others can go
+	var gone []string
+	for worker := range workerPools {
+		if !live[worker] {
+			gone = append(gone, worker)
+		}
+	}
+	if len(gone) > 0 {
+		pipe := q.redis.Pipeline()
+		pipe.HDel(ctx, workerPoolsKey, gone...)
+		pipe.HDel(ctx, workerCapabilitiesKey, gone...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			q.logger.WithError(err).Debug("Failed to prune stale worker pools")
+		}
+	}
+
+	for _, heartbeat := range heartbeats {
+		worker := heartbeat.Member.(string)
+		last := time.Unix(int64(heartbeat.Score), 0)
+
+		health.ActiveWorkers++
+		health.InFlight += int64(len(busy[worker]))
+
+		// A worker registered after the pools were listed is only counted in the totals
+		poolHealth, ok := pools[workerPools[worker]]
+		if !ok {
+			continue
+		}
+		poolHealth.ActiveWorkers++
+		poolHealth.InFlight += int64(len(busy[worker]))
+		if poolHealth.LastWorkerHeartbeat == nil || last.After(*poolHealth.LastWorkerHeartbeat) {
+			poolHealth.LastWorkerHeartbeat = &last
+		}
+	}
+
+	latest, err := q.redis.ZRevRangeWithScores(ctx, workerHeartbeatKey, 0, 0).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last worker heartbeat: %w", err)
+	}
+	if len(latest) > 0 {
+		last := time.Unix(int64(latest[0].Score), 0)
+		health.LastWorkerHeartbeat = &last
+	}
+
+	return health, nil
+}
+
+// Workers lists the workers that sent a heartbeat within staleAfter with their pools, advertised
+// capabilities and the deployments they are processing, by pool and ID
+func (q *QueueService) Workers(ctx context.Context, staleAfter time.Duration) ([]*models.WorkerInfo, error) {
+	heartbeats, err := q.redis.ZRangeByScoreWithScores(ctx, workerHeartbeatKey, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", time.Now().Add(-staleAfter).Unix()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active workers: %w", err)
+	}
+	workerPools, err := q.redis.HGetAll(ctx, workerPoolsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker pools: %w", err)
+	}
+	capabilities, err := q.redis.HGetAll(ctx, workerCapabilitiesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worker capabilities: %w", err)
+	}
+
+	live := make(map[string]bool, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		live[heartbeat.Member.(string)] = true
+	}
+	busy, err := q.busyWorkers(ctx, live)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]*models.WorkerInfo, 0, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		id := heartbeat.Member.(string)
+		worker := &models.WorkerInfo{
+			ID:            id,
+			Pool:          poolName(workerPools[id]),
+			Deployments:   busy[id],
+			LastHeartbeat: time.Unix(int64(heartbeat.Score), 0),
+		}
+		if worker.Deployments == nil {
+			worker.Deployments = []uuid.UUID{}
+		}
+		// Workers that registered before capabilities were advertised ran one Docker job at a time
+		worker.Capabilities = models.WorkerCapabilities{DockerBuild: true, MaxConcurrentJobs: 1}
+		if raw, ok := capabilities[id]; ok {
+			if err := json.Unmarshal([]byte(raw), &worker.Capabilities); err != nil {
+				q.logger.WithError(err).WithField("worker_id", id).Debug("Failed to parse worker capabilities")
+			}
+		}
+		workers = append(workers, worker)
+	}
+
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].Pool != workers[j].Pool {
+			return workers[i].Pool < workers[j].Pool
+		}
+		return workers[i].ID < workers[j].ID
+	})
+	return workers, nil
+}
+
+// HasCapableWorker reports whether a worker of the job's pool that sent a heartbeat within
+// staleAfter can run the job
+func (q *QueueService) HasCapableWorker(ctx context.Context, job *Job, staleAfter time.Duration) (bool, error) {
+	workers, err := q.Workers(ctx, staleAfter)
+	if err != nil {
+		return false, err
+	}
+	for _, worker := range workers {
+		if worker.Pool == poolName(job.Pool) && job.CanRunOn(worker.Capabilities) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CanRunOn returns why a worker with the given capabilities cannot run the job, or nil when it can
+func (j *Job) CanRunOn(capabilities models.WorkerCapabilities) error {
+	deploymentType, _ := j.Data["deployment_type"].(string)
+	targetType, _ := j.Data["target_type"].(string)
+	targetIP, _ := j.Data["target_ip"].(string)
+	return capabilities.CanRun(models.DeploymentType(deploymentType), models.TargetType(targetType), targetIP)
+}
+
+// GetDeploymentJob returns the latest job of a deployment
+func (q *QueueService) GetDeploymentJob(ctx context.Context, deploymentID uuid.UUID) (*Job, error) {
+	jobIDStr, err := q.redis.Get(ctx, deploymentJobKey(deploymentID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get deployment job: %w", err)
+	}
+
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job ID for deployment: %w", err)
+	}
+
+	return q.GetJob(ctx, jobID)
+}
+
+// RequeueDeploymentJob pushes the latest job of a deployment back onto the queue and returns it.
+// The job runs every step again.
+func (q *QueueService) RequeueDeploymentJob(ctx context.Context, deploymentID uuid.UUID) (*Job, error) {
+	job, err := q.GetDeploymentJob(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Requeues++
+	job.ResumeFrom = 0
+	if err := q.pushPendingJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to requeue job: %w", err)
+	}
+
+	q.logger.WithFields(logrus.Fields{
+		"job_id":        job.ID,
+		"deployment_id": deploymentID,
+		"requeues":      job.Requeues,
+	}).Info("Job requeued")
+
+	return job, nil
+}
+
+// ResumeDeploymentJob pushes the latest job of a failed deployment back onto the queue to run
+// from the given step on, and returns it
+func (q *QueueService) ResumeDeploymentJob(ctx context.Context, deploymentID uuid.UUID, fromStep int) (*Job, error) {
+	job, err := q.GetDeploymentJob(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	job.ResumeFrom = fromStep
+	if err := q.pushPendingJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("failed to resume job: %w", err)
+	}
+
+	q.logger.WithFields(logrus.Fields{
+		"job_id":        job.ID,
+		"deployment_id": deploymentID,
+		"resume_from":   fromStep,
+	}).Info("Job resumed")
+
+	return job, nil
+}
+
+// pushPendingJob resets a job to pending, stores it and pushes it onto the queue of its pool
+func (q *QueueService) pushPendingJob(ctx context.Context, job *Job) error {
+	job.Status = JobStatusPending
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.ErrorMessage = nil
+
+	jobJSON, err := q.marshalJob(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	if err := q.storeAndPush(ctx, job, jobJSON); err != nil {
+		return err
+	}
+	q.recordJob(job)
+	return nil
+}
+
+// storeAndPush stores a job for tracking and pushes it onto the queue of its pool, in one
+// transaction with the Redis backend and one after the other otherwise
+func (q *QueueService) storeAndPush(ctx context.Context, job *Job, jobJSON []byte) error {
+	jobKey := fmt.Sprintf("deployknot:job:%s", job.ID.String())
+	if _, ok := q.jobs.(*redisJobQueue); ok {
+		pipe := q.redis.TxPipeline()
+		pipe.Set(ctx, jobKey, jobJSON, q.config.JobTTL)
+		pipe.LPush(ctx, poolQueueKey(job.Pool), jobJSON)
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	if err := q.redis.Set(ctx, jobKey, jobJSON, q.config.JobTTL).Err(); err != nil {
+		return err
+	}
+	return q.jobs.Push(ctx, job.Pool, jobJSON)
+}
+
+// GetDeploymentJobRequeues returns how many times the latest job of a deployment has been requeued
+func (q *QueueService) GetDeploymentJobRequeues(ctx context.Context, deploymentID uuid.UUID) (int, error) {
+	job, err := q.GetDeploymentJob(ctx, deploymentID)
+	if err != nil {
+		return 0, err
+	}
+
+	return job.Requeues, nil
+}
+
+// AcquireDeploymentLock takes the processing lock for a deployment; it returns false when
+// another worker already holds it
+func (q *QueueService) AcquireDeploymentLock(ctx context.Context, deploymentID uuid.UUID, owner string, ttl time.Duration) (bool, error) {
+	acquired, err := q.redis.SetNX(ctx, deploymentLockKey(deploymentID), owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire deployment lock: %w", err)
+	}
+	return acquired, nil
+}
+
+// OwnsDeploymentLock reports whether owner still holds the processing lock for a deployment
+func (q *QueueService) OwnsDeploymentLock(ctx context.Context, deploymentID uuid.UUID, owner string) (bool, error) {
+	holder, err := q.redis.Get(ctx, deploymentLockKey(deploymentID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get deployment lock: %w", err)
+	}
+	return holder == owner, nil
+}
+
+// ReleaseDeploymentLock releases the processing lock for a deployment if owner still holds it
+func (q *QueueService) ReleaseDeploymentLock(ctx context.Context, deploymentID uuid.UUID, owner string) error {
+	if err := releaseLockScript.Run(ctx, q.redis, []string{deploymentLockKey(deploymentID)}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release deployment lock: %w", err)
+	}
+	return nil
+}
+
+// ForceReleaseDeploymentLock releases the processing lock for a deployment regardless of its owner
+func (q *QueueService) ForceReleaseDeploymentLock(ctx context.Context, deploymentID uuid.UUID) error {
+	if err := q.redis.Del(ctx, deploymentLockKey(deploymentID)).Err(); err != nil {
+		return fmt.Errorf("failed to release deployment lock: %w", err)
+	}
+	return nil
+}
+
+// AcquireConcurrencyLock takes the lock of a concurrency group for a deployment; it returns false
+// while another deployment of the group holds it
+func (q *QueueService) AcquireConcurrencyLock(ctx context.Context, key string, deploymentID uuid.UUID, ttl time.Duration) (bool, error) {
+	acquired, err := q.redis.SetNX(ctx, concurrencyLockKey(key), deploymentID.String(), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire concurrency lock: %w", err)
+	}
+	return acquired, nil
+}
+
+// ReleaseConcurrencyLock releases the lock of a concurrency group if the deployment still holds it
+func (q *QueueService) ReleaseConcurrencyLock(ctx context.Context, key string, deploymentID uuid.UUID) error {
+	if err := releaseLockScript.Run(ctx, q.redis, []string{concurrencyLockKey(key)}, deploymentID.String()).Err(); err != nil {
+		return fmt.Errorf("failed to release concurrency lock: %w", err)
+	}
+	return nil
+}
+
+// PassOverJob puts a dequeued job the worker cannot run back at the end of the queue for the other
+// workers of its pool
+func (q *QueueService) PassOverJob(ctx context.Context, job *Job) error {
+	job.Status = JobStatusPending
+	job.StartedAt = nil
+	job.PassedOver++
+
+	jobJSON, err := q.marshalJob(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	if err := q.storeAndPush(ctx, job, jobJSON); err != nil {
+		return fmt.Errorf("failed to pass over job: %w", err)
+	}
+	return nil
+}
+
+// DeferJob puts a dequeued job back at the end of the queue, e.g. while its concurrency group is busy
+func (q *QueueService) DeferJob(ctx context.Context, job *Job) error {
+	job.Status = JobStatusPending
+	job.StartedAt = nil
+	job.Deferrals++
+
+	jobJSON, err := q.marshalJob(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	if err := q.storeAndPush(ctx, job, jobJSON); err != nil {
+		return fmt.Errorf("failed to defer job: %w", err)
+	}
+	q.recordJob(job)
+	return nil
 }
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// dialDeploymentTarget opens an SSH connection to the target of a deployment with its stored
+// credentials, or a certificate of the SSH certificate authority naming purpose, within the limits
+// of the target
+func dialDeploymentTarget(ctx context.Context, ca *SSHCAService, targets *SSHTargetLimiter, deployment *models.Deployment, purpose string, timeout time.Duration) (*ssh.Client, error) {
+	var password string
+	if deployment.SSHPasswordEncrypted != nil {
+		password = *deployment.SSHPasswordEncrypted
+	}
+	auth, err := ca.AuthMethods(ctx, deployment.SSHUsername, password, fmt.Sprintf("deployknot %s %s", purpose, deployment.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:            deployment.SSHUsername,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         timeout,
+	}
+
+	client, err := targets.Dial(ctx, deployment.TargetIP, sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", deployment.TargetIP, err)
+	}
+	return client, nil
+}
+
+// runRemoteCommand runs a command on an SSH connection and returns its trimmed combined output
+func runRemoteCommand(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(cmd)
+	return strings.TrimSpace(string(output)), err
+}
+
+// authorizeTargetAccess returns the user when they may reach the deployment's target on its behalf:
+// they own the deployment or are an administrator. It returns nil when they may not.
+func authorizeTargetAccess(repo *database.Repository, deployment *models.Deployment, userID uuid.UUID) (*models.User, error) {
+	user, err := repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil
+	}
+	if user.Role != models.RoleAdmin && (deployment.UserID == nil || *deployment.UserID != userID) {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// runningContainer returns the container of a completed Docker deployment on an SSH target,
+// or why the deployment has none
+func runningContainer(deployment *models.Deployment) (string, error) {
+	switch {
+	case targetTypeOf(deployment) != models.TargetTypeSSH:
+		return "", fmt.Errorf("only deployments on SSH targets have a container")
+	case deployment.DeploymentType == models.DeploymentTypeScript:
+		return "", fmt.Errorf("script deployments do not run a managed container")
+	case deployment.DeploymentType == models.DeploymentTypeCron:
+		return "", fmt.Errorf("cron deployments only run a container while their job runs")
+	case deployment.Status != models.DeploymentStatusCompleted:
+		return "", fmt.Errorf("deployment is %s", deployment.Status)
+	case deployment.ContainerName == nil || *deployment.ContainerName == "":
+		return "", fmt.Errorf("deployment has no container name")
+	}
+	if err := models.ValidateContainerName(*deployment.ContainerName); err != nil {
+		return "", fmt.Errorf("invalid container name: %w", err)
+	}
+	return *deployment.ContainerName, nil
+}
+
+// targetTypeOf returns the target type of a stored deployment, falling back to ssh
+func targetTypeOf(deployment *models.Deployment) models.TargetType {
+	if deployment.TargetType == "" {
+		return models.TargetTypeSSH
+	}
+	return deployment.TargetType
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+)
+
+// replayable reports why a deployment cannot be replayed, if it cannot
+func replayable(source *models.Deployment) error {
+	switch {
+	case source.DeploymentType == models.DeploymentTypeManaged:
+		return fmt.Errorf("managed service deployments are repeated by deploying the managed service")
+	case source.OneTimeCredentials:
+		return fmt.Errorf("the source deployment used one-time credentials, which were not stored")
+	case source.GitHubPATEncrypted == nil || *source.GitHubPATEncrypted == "":
+		return fmt.Errorf("the source deployment has no stored GitHub token")
+	case targetTypeOf(source) == models.TargetTypeKubernetes && source.KubeconfigEncrypted == nil:
+		return fmt.Errorf("the source deployment has no stored kubeconfig")
+	}
+	return nil
+}
+
+// replayRequest rebuilds the request of a source deployment from the parameters and credentials
+// stored with it, on the given branch when one is set. Uploaded env files are not stored, so they
+// are not part of the new deployment.
+func replayRequest(encryptor *encryption.Encryptor, source *models.Deployment, branch *string) (*models.CreateDeploymentRequest, error) {
+	if err := replayable(source); err != nil {
+		return nil, err
+	}
+
+	req := &models.CreateDeploymentRequest{
+		TargetIP:            source.TargetIP,
+		SSHUsername:         source.SSHUsername,
+		GitHubRepoURL:       source.GitHubRepoURL,
+		GitHubPAT:           *source.GitHubPATEncrypted,
+		GitHubBranch:        source.GitHubBranch,
+		ContainerName:       source.ContainerName,
+		ProjectName:         source.ProjectName,
+		DeploymentName:      source.DeploymentName,
+		DeploymentType:      string(source.DeploymentType),
+		ScriptPath:          source.ScriptPath,
+		Script:              source.ScriptContent,
+		TargetType:          string(targetTypeOf(source)),
+		KubernetesNamespace: source.KubernetesNamespace,
+		Image:               source.Image,
+		ManifestsPath:       source.ManifestsPath,
+		RepoSubdirectory:    source.RepoSubdirectory,
+		GitLFS:              source.GitLFS,
+		ConcurrencyGroup:    source.ConcurrencyGroup,
+		WorkerPool:          source.WorkerPool,
+		GPUs:                source.GPUs,
+		ExtraRunArgs:        source.ExtraRunArgs,
+		AdditionalVars:      source.AdditionalVars,
+		ManagedServices:     source.ManagedServices,
+		CronSchedule:        source.CronSchedule,
+	}
+	if source.SSHPasswordEncrypted != nil {
+		req.SSHPassword = *source.SSHPasswordEncrypted
+	}
+	if source.Port > 0 {
+		req.Port = strconv.Itoa(source.Port)
+	}
+	if branch != nil && *branch != "" {
+		req.GitHubBranch = *branch
+	}
+	if source.KubeconfigEncrypted != nil {
+		kubeconfig, err := encryptor.Decrypt(*source.KubeconfigEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt the kubeconfig of the source deployment: %w", err)
+		}
+		req.Kubeconfig = kubeconfig
+	}
+	return req, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrResumeForbidden is returned when the user may not resume the deployment
+	ErrResumeForbidden = errors.New("only the owner of the deployment or an administrator may resume it")
+	// ErrResumeUnavailable is returned when the deployment cannot be resumed
+	ErrResumeUnavailable = errors.New("deployment cannot be resumed")
+)
+
+// ResumeDeployment puts a failed Docker deployment back onto the queue to continue from the step
+// that failed. The worker skips the steps that completed before as long as the workspace, image
+// or container they produced is still on the target, and otherwise runs them again.
+func (s *DeploymentService) ResumeDeployment(ctx context.Context, deploymentID, userID uuid.UUID) (*models.DeploymentResponse, error) {
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	deployment, err := repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	user, err := authorizeTargetAccess(repo, deployment, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrResumeForbidden
+	}
+
+	switch {
+	case deployment.Status != models.DeploymentStatusFailed:
+		return nil, fmt.Errorf("%w: only failed deployments can be resumed, this one is %s", ErrResumeUnavailable, deployment.Status)
+	case targetTypeOf(deployment) != models.TargetTypeSSH || deployment.DeploymentType == models.DeploymentTypeScript || deployment.DeploymentType == models.DeploymentTypeManaged || deployment.DeploymentType == models.DeploymentTypeCron:
+		return nil, fmt.Errorf("%w: only Docker deployments on SSH targets can be resumed", ErrResumeUnavailable)
+	case deployment.OneTimeCredentials:
+		return nil, fmt.Errorf("%w: the deployment's credentials were used once and not stored", ErrResumeUnavailable)
+	}
+
+	steps, err := repo.GetDeploymentSteps(deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment steps: %w", err)
+	}
+	step := resumeStep(steps)
+	if step == nil {
+		return nil, fmt.Errorf("%w: the deployment has no steps", ErrResumeUnavailable)
+	}
+	if rolledBack(steps) {
+		return nil, fmt.Errorf("%w: the deployment was rolled back to the previous image, create a new deployment instead", ErrResumeUnavailable)
+	}
+
+	// The job holds the deployment's parameters and is only kept in Redis for a day
+	if _, err := s.queue.GetDeploymentJob(ctx, deploymentID); err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			return nil, fmt.Errorf("%w: its job has expired, create a new deployment instead", ErrResumeUnavailable)
+		}
+		return nil, err
+	}
+
+	reset, err := repo.ResetDeploymentForResume(deploymentID, step.StepOrder)
+	if err != nil {
+		return nil, err
+	}
+	if !reset {
+		return nil, fmt.Errorf("%w: the deployment is no longer failed", ErrResumeUnavailable)
+	}
+	defer s.cache.Invalidate(ctx, deploymentID)
+
+	if _, err := s.queue.ResumeDeploymentJob(ctx, deploymentID, step.StepOrder); err != nil {
+		message := fmt.Sprintf("Resuming the deployment failed: %v", err)
+		if updateErr := repo.UpdateDeploymentStatus(deploymentID, models.DeploymentStatusFailed, &message); updateErr != nil {
+			s.logger.WithError(updateErr).Error("Failed to mark deployment as failed after resume error")
+		}
+		return nil, fmt.Errorf("failed to resume deployment job: %w", err)
+	}
+
+	message := fmt.Sprintf("Deployment resumed from step %s by %s", step.StepName, user.Username)
+	if err := s.AddDeploymentLog(ctx, deploymentID, "info", message, "deployment_resume", &step.StepOrder); err != nil {
+		s.logger.WithError(err).Warn("Failed to log deployment resume")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"user_id":       userID,
+		"resume_from":   step.StepName,
+	}).Info("Deployment resumed")
+
+	deployment, err = repo.GetDeployment(deploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+	return toDeploymentResponse(deployment), nil
+}
+
+// resumeStep returns the step a failed deployment resumes from: the first step that did not
+// complete, or the last step when all of them did
+func resumeStep(steps []*models.DeploymentStep) *models.DeploymentStep {
+	for _, step := range steps {
+		if step.Status != models.DeploymentStatusCompleted {
+			return step
+		}
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+	return steps[len(steps)-1]
+}
+
+// rolledBack reports whether failed smoke tests rolled the deployment back. The target then runs
+// the previous image, so resuming would skip a build the deployment needs.
+func rolledBack(steps []*models.DeploymentStep) bool {
+	for _, step := range steps {
+		if rolled, _ := step.Output["rolled_back"].(bool); rolled {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidSchedule is returned when a deployment schedule request is invalid
+	ErrInvalidSchedule = errors.New("invalid deployment schedule")
+	// ErrScheduleExists is returned when the user already has a schedule with the same name
+	ErrScheduleExists = errors.New("a deployment schedule with this name already exists")
+	// ErrScheduleNotFound is returned when a schedule does not exist or the user may not see it
+	ErrScheduleNotFound = errors.New("deployment schedule not found")
+)
+
+// scheduleBatchSize bounds the number of due schedules handled per sweep
+const scheduleBatchSize = 50
+
+// ScheduleService manages cron schedules that redeploy a source deployment
+type ScheduleService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewScheduleService creates a new schedule service
+func NewScheduleService(repo *database.Repository, logger *logrus.Logger) *ScheduleService {
+	return &ScheduleService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateSchedule creates a schedule for userID, who must be allowed to redeploy the source deployment
+func (s *ScheduleService) CreateSchedule(ctx context.Context, userID uuid.UUID, req *models.DeploymentScheduleRequest) (*models.DeploymentSchedule, error) {
+	name := strings.TrimSpace(req.Name)
+	existing, err := s.repo.GetDeploymentScheduleByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrScheduleExists
+	}
+
+	now := time.Now()
+	schedule := &models.DeploymentSchedule{
+		ID:        uuid.New(),
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.apply(ctx, userID, schedule, req, now); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateDeploymentSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"schedule_id": schedule.ID,
+		"user_id":     userID,
+		"project":     schedule.Project,
+		"cron":        schedule.CronExpression,
+	}).Info("Deployment schedule created")
+
+	return schedule, nil
+}
+
+// ListSchedules returns the schedules userID may see, only the project's when project is not
+// empty. Administrators see every schedule.
+func (s *ScheduleService) ListSchedules(ctx context.Context, userID uuid.UUID, project string) ([]*models.DeploymentSchedule, error) {
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := s.repo.ListDeploymentSchedules(owner, project)
+	if err != nil {
+		return nil, err
+	}
+	if schedules == nil {
+		schedules = []*models.DeploymentSchedule{}
+	}
+	return schedules, nil
+}
+
+// GetSchedule returns a schedule userID owns, or any schedule to an administrator
+func (s *ScheduleService) GetSchedule(ctx context.Context, userID, id uuid.UUID) (*models.DeploymentSchedule, error) {
+	schedule, err := s.repo.GetDeploymentSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, ErrScheduleNotFound
+	}
+	owner, err := s.ownerFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && schedule.UserID != *owner {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule, nil
+}
+
+// UpdateSchedule replaces the settings of a schedule and computes its next run again. With ifMatch
+// set, the schedule must not have changed since it was last updated at that time.
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, userID, id uuid.UUID, req *models.DeploymentScheduleRequest, ifMatch *time.Time) (*models.DeploymentSchedule, error) {
+	schedule, err := s.GetSchedule(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetDeploymentScheduleByName(schedule.UserID, strings.TrimSpace(req.Name))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != id {
+		return nil, ErrScheduleExists
+	}
+
+	if err := s.apply(ctx, userID, schedule, req, time.Now()); err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateDeploymentSchedule(schedule, ifMatch)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, unchanged(ifMatch, ErrScheduleNotFound)
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule deletes a schedule; the deployments it created keep a null schedule_id. With
+// ifMatch set, the schedule must not have changed since it was last updated at that time.
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, userID, id uuid.UUID, ifMatch *time.Time) error {
+	if _, err := s.GetSchedule(ctx, userID, id); err != nil {
+		return err
+	}
+	deleted, err := s.repo.DeleteDeploymentSchedule(id, ifMatch)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return unchanged(ifMatch, ErrScheduleNotFound)
+	}
+	return nil
+}
+
+// apply validates req and copies it onto the schedule together with the project of the source
+// deployment and the next run after now
+func (s *ScheduleService) apply(ctx context.Context, userID uuid.UUID, schedule *models.DeploymentSchedule, req *models.DeploymentScheduleRequest, now time.Time) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	source, err := repo.GetDeployment(req.SourceDeploymentID)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			return fmt.Errorf("%w: source deployment not found", ErrInvalidSchedule)
+		}
+		return err
+	}
+	user, err := authorizeTargetAccess(repo, source, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("%w: only the owner of the source deployment or an administrator may schedule it", ErrInvalidSchedule)
+	}
+	if err := replayable(source); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	schedule.Name = strings.TrimSpace(req.Name)
+	schedule.Project = source.ProjectKey()
+	schedule.SourceDeploymentID = source.ID
+	schedule.GitHubBranch = nil
+	if req.GitHubBranch != "" {
+		branch := req.GitHubBranch
+		schedule.GitHubBranch = &branch
+	}
+	schedule.CronExpression = strings.TrimSpace(req.CronExpression)
+	schedule.Timezone = req.GetTimezone()
+	schedule.Enabled = req.IsEnabled()
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		if schedule.NextRunAt, err = schedule.NextRun(now); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+	return nil
+}
+
+// ownerFilter returns nil for administrators, who see every schedule, and userID otherwise
+func (s *ScheduleService) ownerFilter(userID uuid.UUID) (*uuid.UUID, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && user.Role == models.RoleAdmin {
+		return nil, nil
+	}
+	return &userID, nil
+}
+
+// Scheduler creates the deployments of cron schedules when they are due
+type Scheduler struct {
+	repo        *database.Repository
+	deployments *DeploymentService
+	config      config.SchedulerConfig
+	logger      *logrus.Logger
+}
+
+// NewScheduler creates a new deployment scheduler
+func NewScheduler(repo *database.Repository, deployments *DeploymentService, cfg config.SchedulerConfig, logger *logrus.Logger) *Scheduler {
+	return &Scheduler{
+		repo:        repo,
+		deployments: deployments,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// Run creates the deployments of due schedules every interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.WithField("interval", s.config.Interval).Info("Starting deployment scheduler")
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("Deployment scheduler sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep runs every due schedule once and returns how many deployments were created. Runs missed
+// while no server was up are not made up for: a schedule that is overdue runs once.
+func (s *Scheduler) Sweep(ctx context.Context) (int, error) {
+	now := time.Now()
+	due, err := s.repo.GetDueDeploymentSchedules(now, scheduleBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, schedule := range due {
+		logger := s.logger.WithField("schedule_id", schedule.ID)
+
+		next, err := schedule.NextRun(now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to compute the next run of deployment schedule")
+			continue
+		}
+		// Another server may be handling the same run
+		claimed, err := s.repo.ClaimDeploymentScheduleRun(schedule.ID, *schedule.NextRunAt, next)
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim deployment schedule run")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		deploymentID, runErr := s.runSchedule(ctx, schedule)
+		var message *string
+		if runErr != nil {
+			text := runErr.Error()
+			message = &text
+			logger.WithError(runErr).Warn("Deployment schedule run did not create a deployment")
+		} else {
+			created++
+			logger.WithField("deployment_id", deploymentID).Info("Deployment schedule run created a deployment")
+		}
+		if err := s.repo.RecordDeploymentScheduleRun(schedule.ID, deploymentID, message); err != nil {
+			logger.WithError(err).Error("Failed to record deployment schedule run")
+		}
+	}
+	return created, nil
+}
+
+// runSchedule creates the deployment of one run of a schedule on behalf of its owner
+func (s *Scheduler) runSchedule(ctx context.Context, schedule *models.DeploymentSchedule) (*uuid.UUID, error) {
+	user, err := s.repo.GetUserByID(schedule.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, fmt.Errorf("the owner of the schedule is no longer active")
+	}
+
+	source, err := s.repo.GetDeployment(schedule.SourceDeploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the source deployment: %w", err)
+	}
+	req, err := replayRequest(s.deployments.encryptor, source, schedule.GitHubBranch)
+	if err != nil {
+		return nil, err
+	}
+	req.ScheduleID = &schedule.ID
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.deployments.ValidateDeploymentRequest(req); err != nil {
+		return nil, err
+	}
+
+	deployment, err := s.deployments.CreateDeploymentWithEnvFile(ctx, req, "", schedule.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Deployment created by schedule %q (%s) from deployment %s", schedule.Name, schedule.CronExpression, source.ID)
+	if err := s.deployments.AddDeploymentLog(ctx, deployment.ID, "info", message, "schedule", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log scheduled deployment")
+	}
+	return &deployment.ID, nil
+}
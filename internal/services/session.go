@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrSessionNotFound is returned when the user has no active session with the ID
+var ErrSessionNotFound = errors.New("session not found")
+
+const (
+	// sessionTouchInterval is how often a session's last seen time is updated
+	sessionTouchInterval = time.Minute
+	// sessionRevocationTTL outlives every token issued before all of a user's sessions were revoked
+	sessionRevocationTTL = 7 * 24 * time.Hour
+)
+
+// sessionKey holds a session, expiring with its token
+func sessionKey(sessionID string) string {
+	return "deployknot:session:" + sessionID
+}
+
+// userSessionsKey indexes a user's session IDs, scored by when they expire
+func userSessionsKey(userID uuid.UUID) string {
+	return "deployknot:user:" + userID.String() + ":sessions"
+}
+
+// userSessionsRevokedKey holds the Unix time at which all of a user's sessions were revoked
+func userSessionsRevokedKey(userID uuid.UUID) string {
+	return "deployknot:user:" + userID.String() + ":sessions_revoked_before"
+}
+
+// SessionService keeps the tokens issued to users in Redis so they can be listed and revoked
+type SessionService struct {
+	redis  *redis.Client
+	logger *logrus.Logger
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(redisClient *redis.Client, logger *logrus.Logger) *SessionService {
+	return &SessionService{
+		redis:  redisClient,
+		logger: logger,
+	}
+}
+
+// CreateSession records a newly issued token
+func (s *SessionService) CreateSession(ctx context.Context, session *models.Session) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("session has already expired")
+	}
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	indexKey := userSessionsKey(session.UserID)
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, sessionKey(session.ID), sessionJSON, ttl)
+	pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(session.ExpiresAt.Unix()), Member: session.ID})
+	pipe.ZRemRangeByScore(ctx, indexKey, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	// Tokens share one lifetime, so the newest session is the last to expire
+	pipe.Expire(ctx, indexKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// ValidateSession reports whether a token is still valid. Tokens with a session ID are valid while
+// their session exists; tokens without one are valid unless all of the user's sessions were
+// revoked after they were issued.
+func (s *SessionService) ValidateSession(ctx context.Context, userID uuid.UUID, sessionID string, issuedAt time.Time) (bool, error) {
+	if sessionID == "" {
+		revokedBefore, err := s.redis.Get(ctx, userSessionsRevokedKey(userID)).Int64()
+		if err == redis.Nil {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get session revocation: %w", err)
+		}
+		return issuedAt.Unix() > revokedBefore, nil
+	}
+
+	session, err := s.getSession(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+	if session == nil || session.UserID != userID {
+		return false, nil
+	}
+
+	now := time.Now()
+	if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) >= sessionTouchInterval {
+		session.LastSeenAt = &now
+		if err := s.touchSession(ctx, session); err != nil {
+			s.logger.WithError(err).WithField("session_id", sessionID).Debug("Failed to update session last seen time")
+		}
+	}
+	return true, nil
+}
+
+// ListSessions returns a user's active sessions, newest first
+func (s *SessionService) ListSessions(ctx context.Context, userID uuid.UUID) ([]*models.Session, error) {
+	indexKey := userSessionsKey(userID)
+	ids, err := s.redis.ZRangeByScore(ctx, indexKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := []*models.Session{}
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	var revoked []interface{}
+	for i, value := range values {
+		sessionJSON, ok := value.(string)
+		if !ok {
+			revoked = append(revoked, ids[i])
+			continue
+		}
+		var session models.Session
+		if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	// Sessions revoked without going through the index are dropped from it
+	if len(revoked) > 0 {
+		if err := s.redis.ZRem(ctx, indexKey, revoked...).Err(); err != nil {
+			s.logger.WithError(err).WithField("user_id", userID).Debug("Failed to prune session index")
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].IssuedAt.After(sessions[j].IssuedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession revokes one of a user's sessions
+func (s *SessionService) RevokeSession(ctx context.Context, userID uuid.UUID, sessionID string) error {
+	session, err := s.getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.ZRem(ctx, userSessionsKey(userID), sessionID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"session_id": sessionID,
+	}).Info("Session revoked")
+	return nil
+}
+
+// RevokeAllSessions revokes all of a user's sessions except keepSessionID, when it is set, and
+// returns how many were revoked. Tokens issued without a session are revoked as well.
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID uuid.UUID, keepSessionID string) (int, error) {
+	indexKey := userSessionsKey(userID)
+	ids, err := s.redis.ZRange(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	var keys []string
+	var members []interface{}
+	for _, id := range ids {
+		if id == keepSessionID {
+			continue
+		}
+		keys = append(keys, sessionKey(id))
+		members = append(members, id)
+	}
+
+	pipe := s.redis.TxPipeline()
+	var deleted *redis.IntCmd
+	if len(keys) > 0 {
+		deleted = pipe.Del(ctx, keys...)
+		pipe.ZRem(ctx, indexKey, members...)
+	}
+	pipe.Set(ctx, userSessionsRevokedKey(userID), time.Now().Unix(), sessionRevocationTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	revoked := 0
+	if deleted != nil {
+		revoked = int(deleted.Val())
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"revoked": revoked,
+	}).Info("Sessions revoked")
+	return revoked, nil
+}
+
+// getSession returns a session by ID, or nil when it does not exist
+func (s *SessionService) getSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	sessionJSON, err := s.redis.Get(ctx, sessionKey(sessionID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var session models.Session
+	if err := json.Unmarshal(sessionJSON, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return &session, nil
+}
+
+// touchSession stores a session's last seen time. The session is only overwritten while it exists,
+// so a concurrent revocation is not undone.
+func (s *SessionService) touchSession(ctx context.Context, session *models.Session) error {
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	err = s.redis.SetArgs(ctx, sessionKey(session.ID), sessionJSON, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
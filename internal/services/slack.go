@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// slackLinkCodeAlphabet leaves out characters that are easily confused, such as 0 and O
+const slackLinkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// slackLinkCodeLength is the number of characters of a link code
+const slackLinkCodeLength = 8
+
+// slackUsage lists the slash commands
+const slackUsage = "Usage:\n" +
+	"• `/deployknot deploy <project> [branch]` redeploys your last successful deployment of the project, on another branch if given\n" +
+	"• `/deployknot status <deployment-id>` shows the status of a deployment\n" +
+	"• `/deployknot link <code>` links your Slack account to DeployKnot, with a code from `POST /api/v1/slack/link`\n" +
+	"• `/deployknot help` shows this message"
+
+// slackLinkKey holds the user a link code was created for
+func slackLinkKey(code string) string {
+	return "deployknot:slack:link:" + code
+}
+
+// SlackService runs the commands Slack users send with the /deployknot slash command
+type SlackService struct {
+	repo        *database.Repository
+	redis       *redis.Client
+	deployments *DeploymentService
+	cfg         config.SlackConfig
+	logger      *logrus.Logger
+}
+
+// NewSlackService creates a new Slack service
+func NewSlackService(repo *database.Repository, redisClient *redis.Client, deployments *DeploymentService, cfg config.SlackConfig, logger *logrus.Logger) *SlackService {
+	return &SlackService{
+		repo:        repo,
+		redis:       redisClient,
+		deployments: deployments,
+		cfg:         cfg,
+		logger:      logger,
+	}
+}
+
+// CreateLinkCode returns a one-time code that links the Slack account running
+// `/deployknot link <code>` to the user
+func (s *SlackService) CreateLinkCode(ctx context.Context, userID uuid.UUID) (*models.SlackLinkCode, error) {
+	code := make([]byte, slackLinkCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(slackLinkCodeAlphabet))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate link code: %w", err)
+		}
+		code[i] = slackLinkCodeAlphabet[n.Int64()]
+	}
+
+	if err := s.redis.Set(ctx, slackLinkKey(string(code)), userID.String(), s.cfg.LinkCodeTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store link code: %w", err)
+	}
+	return &models.SlackLinkCode{
+		Code:      string(code),
+		Command:   "/deployknot link " + string(code),
+		ExpiresAt: time.Now().Add(s.cfg.LinkCodeTTL),
+	}, nil
+}
+
+// HandleCommand runs a slash command and returns the reply. Problems with the command, such as an
+// unlinked account or an unknown project, are replies as well; only failures of DeployKnot itself
+// are returned as errors.
+func (s *SlackService) HandleCommand(ctx context.Context, cmd *models.SlackCommand) (*models.SlackResponse, error) {
+	args := strings.Fields(cmd.Text)
+	if len(args) == 0 || strings.EqualFold(args[0], "help") {
+		return slackReply(slackUsage), nil
+	}
+	action, args := strings.ToLower(args[0]), args[1:]
+
+	if action == "link" {
+		if len(args) != 1 {
+			return slackReply("Usage: `/deployknot link <code>`"), nil
+		}
+		return s.link(ctx, cmd, args[0])
+	}
+
+	user, err := s.slackUser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return slackReply("Your Slack account is not linked to a DeployKnot user. Create a code with `POST /api/v1/slack/link`, then run `/deployknot link <code>`."), nil
+	}
+
+	switch action {
+	case "deploy":
+		if len(args) < 1 || len(args) > 2 {
+			return slackReply("Usage: `/deployknot deploy <project> [branch]`"), nil
+		}
+		var branch *string
+		if len(args) == 2 {
+			branch = &args[1]
+		}
+		return s.deploy(ctx, cmd, user, args[0], branch)
+	case "status":
+		if len(args) != 1 {
+			return slackReply("Usage: `/deployknot status <deployment-id>`"), nil
+		}
+		return s.status(user, args[0])
+	}
+	return slackReply(fmt.Sprintf("Unknown command %q.\n%s", action, slackUsage)), nil
+}
+
+// slackUser returns the active user the Slack account is linked to, or nil
+func (s *SlackService) slackUser(cmd *models.SlackCommand) (*models.User, error) {
+	identity, err := s.repo.GetUserIdentity(models.IdentityProviderSlack, cmd.SlackSubject())
+	if err != nil || identity == nil {
+		return nil, err
+	}
+	user, err := s.repo.GetUserByID(identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// link links the Slack account to the user a link code was created for
+func (s *SlackService) link(ctx context.Context, cmd *models.SlackCommand, code string) (*models.SlackResponse, error) {
+	// Each code is used once
+	value, err := s.redis.GetDel(ctx, slackLinkKey(strings.ToUpper(code))).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return slackReply("The link code is invalid or has expired. Create a new one with `POST /api/v1/slack/link`."), nil
+		}
+		return nil, fmt.Errorf("failed to load link code: %w", err)
+	}
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link code: %w", err)
+	}
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.IsActive {
+		return slackReply("The DeployKnot user of this link code is no longer active."), nil
+	}
+
+	existing, err := s.repo.GetUserIdentity(models.IdentityProviderSlack, cmd.SlackSubject())
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.UserID == user.ID {
+			return slackReply(fmt.Sprintf("Your Slack account is already linked to %s.", user.Username)), nil
+		}
+		return slackReply("Your Slack account is linked to another DeployKnot user. Unlink it there first with `DELETE /api/v1/auth/identities/slack`."), nil
+	}
+	identities, err := s.repo.GetUserIdentities(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		if identity.Provider == models.IdentityProviderSlack {
+			return slackReply(fmt.Sprintf("%s is linked to another Slack account. Unlink it first with `DELETE /api/v1/auth/identities/slack`.", user.Username)), nil
+		}
+	}
+
+	if err := s.repo.CreateUserIdentity(&models.UserIdentity{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Provider:  models.IdentityProviderSlack,
+		Subject:   cmd.SlackSubject(),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":       user.ID,
+		"slack_subject": cmd.SlackSubject(),
+	}).Info("Slack account linked")
+	return slackReply(fmt.Sprintf("Your Slack account is now linked to %s.", user.Username)), nil
+}
+
+// deploy redeploys the user's last successful deployment of a project
+func (s *SlackService) deploy(ctx context.Context, cmd *models.SlackCommand, user *models.User, project string, branch *string) (*models.SlackResponse, error) {
+	// The command arrives from Slack, not from one of the organization's networks
+	org, err := s.repo.GetUserOrganization(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if org != nil && len(org.AllowedCIDRs) > 0 {
+		return slackReply(fmt.Sprintf("Organization %s only allows deployments from its networks. Deploy through the API instead.", org.Slug)), nil
+	}
+
+	source, err := s.repo.GetLatestProjectDeployment(user.ID, project, models.DeploymentStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return slackReply(fmt.Sprintf("You have no successful deployment of project %q to repeat.", project)), nil
+	}
+
+	req, err := replayRequest(s.deployments.encryptor, source, branch)
+	if err == nil {
+		err = req.Validate()
+	}
+	if err == nil {
+		err = s.deployments.ValidateDeploymentRequest(req)
+	}
+	if err != nil {
+		return slackReply(fmt.Sprintf("Cannot deploy %s: %v", project, err)), nil
+	}
+
+	deployment, err := s.deployments.CreateDeploymentWithEnvFile(ctx, req, "", user.ID)
+	if err != nil {
+		var quotaErr *QuotaError
+		var concurrencyErr *ConcurrencyError
+		var poolErr *WorkerPoolError
+		var freezeErr *FreezeError
+		var projectErr *ProjectAccessError
+		if errors.As(err, &quotaErr) || errors.As(err, &concurrencyErr) || errors.As(err, &poolErr) || errors.As(err, &freezeErr) ||
+			errors.As(err, &projectErr) {
+			return slackReply(fmt.Sprintf("Cannot deploy %s: %v", project, err)), nil
+		}
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Deployment requested in Slack by %s (%s) from deployment %s", cmd.UserName, cmd.SlackSubject(), source.ID)
+	if err := s.deployments.AddDeploymentLog(ctx, deployment.ID, "info", message, "slack", nil); err != nil {
+		s.logger.WithError(err).Warn("Failed to log Slack deployment")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"deployment_id": deployment.ID,
+		"user_id":       user.ID,
+		"slack_subject": cmd.SlackSubject(),
+	}).Info("Deployment created from Slack")
+
+	return &models.SlackResponse{
+		ResponseType: models.SlackResponseInChannel,
+		Text:         fmt.Sprintf("<@%s> is deploying %s (branch %s) as deployment %s", cmd.UserID, project, req.GitHubBranch, deployment.ID),
+	}, nil
+}
+
+// status describes a deployment the user may see
+func (s *SlackService) status(user *models.User, id string) (*models.SlackResponse, error) {
+	deploymentID, err := uuid.Parse(id)
+	if err != nil {
+		return slackReply("The deployment ID must be a UUID."), nil
+	}
+	deployment, err := s.repo.GetDeployment(deploymentID)
+	if err != nil {
+		if errors.Is(err, database.ErrDeploymentNotFound) {
+			return slackReply("Deployment not found."), nil
+		}
+		return nil, err
+	}
+	allowed, err := authorizeTargetAccess(s.repo, deployment, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if allowed == nil {
+		return slackReply("Deployment not found."), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Deployment %s of %s (branch %s) is *%s*", deployment.ID, deployment.ProjectKey(), deployment.GitHubBranch, deployment.Status)
+	steps, err := s.repo.GetDeploymentSteps(deployment.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range steps {
+		if step.Status == models.DeploymentStatusRunning || step.Status == models.DeploymentStatusFailed {
+			fmt.Fprintf(&b, "\nStep %s: %s", step.StepName, step.Status)
+		}
+	}
+	if deployment.ErrorMessage != nil {
+		fmt.Fprintf(&b, "\nError: %s", *deployment.ErrorMessage)
+	}
+	return slackReply(b.String()), nil
+}
+
+// slackReply is a reply only the user who ran the command sees
+func slackReply(text string) *models.SlackResponse {
+	return &models.SlackResponse{ResponseType: models.SlackResponseEphemeral, Text: text}
+}
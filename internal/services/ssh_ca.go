@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/pkg/encryption"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrSSHCAKeyExists is returned when a key of the SSH certificate authority with the name exists
+	ErrSSHCAKeyExists = errors.New("an SSH CA key with this name already exists")
+	// ErrSSHCAKeyNotFound is returned when a key of the SSH certificate authority does not exist
+	ErrSSHCAKeyNotFound = errors.New("SSH CA key not found")
+	// ErrSSHCAKeyActive is returned when deleting the key that signs certificates
+	ErrSSHCAKeyActive = errors.New("the active SSH CA key cannot be deleted, activate another key first")
+	// ErrSSHCredentialsRequired is returned for an SSH deployment without a password while the SSH
+	// certificate authority has no active key
+	ErrSSHCredentialsRequired = errors.New("ssh_password is required unless the SSH certificate authority has an active key")
+)
+
+// sshCAClockSkew backdates certificates, so targets whose clocks run slightly behind accept them
+const sshCAClockSkew = time.Minute
+
+// SSHCAService manages the SSH certificate authority. Instead of a password, SSH connections to
+// targets log in with a fresh key and a certificate for it, signed by the active CA key and valid
+// for a few minutes. Targets trust the certificates by listing the CA's public keys in the
+// TrustedUserCAKeys of their sshd.
+type SSHCAService struct {
+	repo      *database.Repository
+	encryptor *encryption.Encryptor
+	certTTL   time.Duration
+	logger    *logrus.Logger
+}
+
+// NewSSHCAService creates a new SSH certificate authority service
+func NewSSHCAService(repo *database.Repository, encryptor *encryption.Encryptor, cfg config.CredentialsConfig, logger *logrus.Logger) *SSHCAService {
+	return &SSHCAService{
+		repo:      repo,
+		encryptor: encryptor,
+		certTTL:   cfg.SSHCertTTL,
+		logger:    logger,
+	}
+}
+
+// ListKeys returns every key of the certificate authority without its private key
+func (s *SSHCAService) ListKeys(ctx context.Context) ([]*models.SSHCAKey, error) {
+	return s.repo.ListSSHCAKeys()
+}
+
+// CreateKey generates a key of the certificate authority. The first key becomes active right away;
+// later keys are pending, so targets can trust them before they are activated in a rotation.
+func (s *SSHCAService) CreateKey(ctx context.Context, req *models.CreateSSHCAKeyRequest, createdBy string) (*models.SSHCAKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH CA key: %w", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH CA key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH CA key: %w", err)
+	}
+	encrypted, err := s.encryptor.Encrypt(string(pem.EncodeToMemory(block)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt SSH CA key: %w", err)
+	}
+
+	active, err := s.repo.GetActiveSSHCAKey()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key := &models.SSHCAKey{
+		ID:                  uuid.New(),
+		Name:                strings.TrimSpace(req.Name),
+		PublicKey:           strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " deployknot-ca",
+		PrivateKeyEncrypted: encrypted,
+		Fingerprint:         ssh.FingerprintSHA256(sshPublicKey),
+		Status:              models.SSHCAKeyPending,
+		CreatedAt:           now,
+	}
+	if active == nil {
+		key.Status = models.SSHCAKeyActive
+		key.ActivatedAt = &now
+	}
+	if createdBy != "" {
+		key.CreatedBy = &createdBy
+	}
+	created, err := s.repo.CreateSSHCAKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrSSHCAKeyExists
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"ssh_ca_key_id": key.ID,
+		"fingerprint":   key.Fingerprint,
+		"status":        key.Status,
+		"created_by":    createdBy,
+	}).Info("SSH CA key created")
+	return key, nil
+}
+
+// ActivateKey makes a key sign the certificates of new connections. The key that was active until
+// then is retiring: targets still trust it until it is deleted.
+func (s *SSHCAService) ActivateKey(ctx context.Context, id uuid.UUID, activatedBy string) (*models.SSHCAKey, error) {
+	activated, err := s.repo.ActivateSSHCAKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if !activated {
+		return nil, ErrSSHCAKeyNotFound
+	}
+	key, err := s.repo.GetSSHCAKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrSSHCAKeyNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"ssh_ca_key_id": id,
+		"fingerprint":   key.Fingerprint,
+		"activated_by":  activatedBy,
+	}).Info("SSH CA key activated")
+	return key, nil
+}
+
+// DeleteKey deletes a pending or retiring key, which targets then stop trusting once they fetch
+// the trusted keys again
+func (s *SSHCAService) DeleteKey(ctx context.Context, id uuid.UUID, deletedBy string) error {
+	key, err := s.repo.GetSSHCAKey(id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return ErrSSHCAKeyNotFound
+	}
+	if key.Status == models.SSHCAKeyActive {
+		return ErrSSHCAKeyActive
+	}
+	deleted, err := s.repo.DeleteSSHCAKey(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrSSHCAKeyNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"ssh_ca_key_id": id,
+		"fingerprint":   key.Fingerprint,
+		"deleted_by":    deletedBy,
+	}).Info("SSH CA key deleted")
+	return nil
+}
+
+// TrustedKeys returns the public keys targets must trust, one per line as TrustedUserCAKeys
+// expects them: the active key and the pending and retiring keys of a rotation
+func (s *SSHCAService) TrustedKeys(ctx context.Context) (string, error) {
+	keys, err := s.repo.ListSSHCAKeys()
+	if err != nil {
+		return "", err
+	}
+	var trusted strings.Builder
+	for _, key := range keys {
+		trusted.WriteString(key.PublicKey)
+		trusted.WriteString("\n")
+	}
+	return trusted.String(), nil
+}
+
+// Enabled reports whether the certificate authority has an active key to sign certificates with
+func (s *SSHCAService) Enabled(ctx context.Context) (bool, error) {
+	key, err := s.repo.GetActiveSSHCAKey()
+	return key != nil, err
+}
+
+// AuthMethods returns how a connection logs in to a target as username: with a certificate signed
+// for the connection when the certificate authority has an active key, and with the password when
+// there is one. keyID names the connection in the certificate, so the target's sshd logs it.
+func (s *SSHCAService) AuthMethods(ctx context.Context, username, password, keyID string) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	signer, err := s.certificateSigner(username, keyID)
+	if err != nil {
+		if password == "" {
+			return nil, err
+		}
+		s.logger.WithError(err).Warn("Failed to sign SSH certificate, logging in with the password")
+	} else if signer != nil {
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+	if len(methods) == 0 {
+		return nil, ErrSSHCredentialsRequired
+	}
+	return methods, nil
+}
+
+// certificateSigner generates a key and signs a certificate for it with the active key, valid for
+// username only and for the certificate TTL. It returns nil when there is no active key.
+func (s *SSHCAService) certificateSigner(username, keyID string) (ssh.Signer, error) {
+	caKey, err := s.repo.GetActiveSSHCAKey()
+	if err != nil || caKey == nil {
+		return nil, err
+	}
+	caPEM, err := s.encryptor.Decrypt(caKey.PrivateKeyEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SSH CA key: %w", err)
+	}
+	caSigner, err := ssh.ParsePrivateKey([]byte(caPEM))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH CA key: %w", err)
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial: %w", err)
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: []string{username},
+		ValidAfter:      uint64(now.Add(-sshCAClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(s.certTTL).Unix()),
+		// Interactive exec opens a terminal; nothing else needs to be permitted
+		Permissions: ssh.Permissions{Extensions: map[string]string{"permit-pty": ""}},
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		return nil, fmt.Errorf("failed to sign SSH certificate: %w", err)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign SSH certificate: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"key_id":      keyID,
+		"principal":   username,
+		"serial":      cert.Serial,
+		"ca_key":      caKey.Fingerprint,
+		"valid_until": time.Unix(int64(cert.ValidBefore), 0).UTC(),
+	}).Info("SSH certificate signed")
+	return certSigner, nil
+}
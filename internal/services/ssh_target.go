@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"deployknot/internal/config"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSSHTargetBusy is returned when a target had no free SSH connection or session for the wait timeout
+var ErrSSHTargetBusy = errors.New("SSH target is busy")
+
+// sshTargetConnectionsKey is the sorted set of the SSH connections open to a target, scored by the
+// unix milliseconds their slot expires at unless renewed
+func sshTargetConnectionsKey(host string) string {
+	return "deployknot:ssh:connections:" + host
+}
+
+// sshTargetSessionsKey is the sorted set of the SSH sessions recently opened on a target, scored by
+// the unix milliseconds they were opened at
+func sshTargetSessionsKey(host string) string {
+	return "deployknot:ssh:sessions:" + host
+}
+
+const (
+	// sshTargetSlotTTL is how long the connection slot of a process that died stays taken
+	sshTargetSlotTTL = time.Minute
+	// sshTargetSlotRenewInterval is how often an open connection renews its slot
+	sshTargetSlotRenewInterval = 20 * time.Second
+	// sshTargetSessionWindow is the window SSH_TARGET_SESSION_RATE applies to
+	sshTargetSessionWindow = time.Second
+	// sshTargetPollInterval bounds how long a waiting operation sleeps between attempts
+	sshTargetPollInterval = 2 * time.Second
+)
+
+// acquireConnectionSlotScript takes a connection slot of a target for ARGV[1] unless ARGV[2] slots
+// that have not expired at ARGV[3] are taken, and returns 1 when it took one
+var acquireConnectionSlotScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[3])
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], tonumber(ARGV[3]) + tonumber(ARGV[4]), ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return 1
+`)
+
+// openSessionScript records the session ARGV[1] opened on a target at ARGV[3] unless ARGV[2]
+// sessions were opened within the last ARGV[4] milliseconds, and returns 0 when it recorded it or
+// the milliseconds until the oldest of them leaves the window
+var openSessionScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+local window = tonumber(ARGV[4])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+	return math.max(1, tonumber(oldest[2]) + window - now)
+end
+redis.call("ZADD", KEYS[1], now, ARGV[1])
+redis.call("PEXPIRE", KEYS[1], window)
+return 0
+`)
+
+// SSHTargetLimiter keeps the servers and workers sharing a Redis from overwhelming one SSH target:
+// it caps the connections open to the target and the rate sessions are opened on it, and retries
+// sessions the target refuses for exceeding sshd's MaxSessions. Operations over a limit wait for
+// their turn instead of failing.
+type SSHTargetLimiter struct {
+	redis  *redis.Client
+	config config.SSHTargetConfig
+	logger *logrus.Logger
+}
+
+// NewSSHTargetLimiter creates a new SSH target limiter
+func NewSSHTargetLimiter(redisClient *redis.Client, cfg config.SSHTargetConfig, logger *logrus.Logger) *SSHTargetLimiter {
+	return &SSHTargetLimiter{
+		redis:  redisClient,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Dial opens an SSH connection to port 22 of host once the target has a free connection slot and
+// its session rate allows. The slot is held until the connection is closed.
+func (l *SSHTargetLimiter) Dial(ctx context.Context, host string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	address := net.JoinHostPort(host, "22")
+	if !l.config.LimitsEnabled {
+		return ssh.Dial("tcp", address, sshConfig)
+	}
+
+	slot := uuid.New().String()
+	if err := l.acquireSlot(ctx, host, slot); err != nil {
+		return nil, err
+	}
+	if err := l.openSession(ctx, host); err != nil {
+		l.releaseSlot(host, slot)
+		return nil, err
+	}
+
+	netConn, err := net.DialTimeout("tcp", address, sshConfig.Timeout)
+	if err != nil {
+		l.releaseSlot(host, slot)
+		return nil, err
+	}
+	conn, chans, reqs, err := ssh.NewClientConn(netConn, address, sshConfig)
+	if err != nil {
+		netConn.Close()
+		l.releaseSlot(host, slot)
+		return nil, err
+	}
+
+	limited := &limitedSSHConn{Conn: conn, limiter: l, host: host}
+	go l.holdSlot(limited, host, slot)
+	return ssh.NewClient(limited, chans, reqs), nil
+}
+
+// acquireSlot waits until it takes a connection slot of the target for slot
+func (l *SSHTargetLimiter) acquireSlot(ctx context.Context, host, slot string) error {
+	ctx, cancel := context.WithTimeout(ctx, l.config.WaitTimeout)
+	defer cancel()
+
+	started := time.Now()
+	delay := 100 * time.Millisecond
+	logged := false
+	for {
+		now := time.Now().UnixMilli()
+		acquired, err := acquireConnectionSlotScript.Run(ctx, l.redis, []string{sshTargetConnectionsKey(host)},
+			slot, l.config.MaxConnections, now, sshTargetSlotTTL.Milliseconds()).Int()
+		if err != nil {
+			if ctx.Err() != nil {
+				return l.busy(ctx, host, "connection", started)
+			}
+			// The limits are a courtesy to the target; without Redis the connection goes ahead
+			l.logger.WithError(err).WithField("host", host).Warn("Failed to take an SSH connection slot, connecting anyway")
+			return nil
+		}
+		if acquired == 1 {
+			if waited := time.Since(started); waited > time.Second {
+				l.logger.WithFields(logrus.Fields{"host": host, "waited": waited.Round(time.Millisecond)}).Info("Took an SSH connection slot after waiting")
+			}
+			return nil
+		}
+		if !logged {
+			logged = true
+			l.logger.WithFields(logrus.Fields{"host": host, "max_connections": l.config.MaxConnections}).Info("Waiting for a free SSH connection slot on target")
+		}
+
+		select {
+		case <-ctx.Done():
+			return l.busy(ctx, host, "connection", started)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, sshTargetPollInterval)
+	}
+}
+
+// holdSlot renews the connection slot of conn until the connection ends, then releases it
+func (l *SSHTargetLimiter) holdSlot(conn ssh.Conn, host, slot string) {
+	closed := make(chan struct{})
+	go func() {
+		conn.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(sshTargetSlotRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			l.releaseSlot(host, slot)
+			return
+		case <-ticker.C:
+			expires := time.Now().Add(sshTargetSlotTTL).UnixMilli()
+			key := sshTargetConnectionsKey(host)
+			pipe := l.redis.TxPipeline()
+			pipe.ZAddXX(context.Background(), key, redis.Z{Score: float64(expires), Member: slot})
+			pipe.PExpire(context.Background(), key, sshTargetSlotTTL)
+			if _, err := pipe.Exec(context.Background()); err != nil {
+				l.logger.WithError(err).WithField("host", host).Warn("Failed to renew SSH connection slot")
+			}
+		}
+	}
+}
+
+// releaseSlot frees a connection slot of the target
+func (l *SSHTargetLimiter) releaseSlot(host, slot string) {
+	if err := l.redis.ZRem(context.Background(), sshTargetConnectionsKey(host), slot).Err(); err != nil {
+		l.logger.WithError(err).WithField("host", host).Warn("Failed to release SSH connection slot")
+	}
+}
+
+// openSession waits until the session rate of the target allows opening a session
+func (l *SSHTargetLimiter) openSession(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, l.config.WaitTimeout)
+	defer cancel()
+
+	started := time.Now()
+	session := uuid.New().String()
+	for {
+		wait, err := openSessionScript.Run(ctx, l.redis, []string{sshTargetSessionsKey(host)},
+			session, l.config.SessionRate, time.Now().UnixMilli(), sshTargetSessionWindow.Milliseconds()).Int64()
+		if err != nil {
+			if ctx.Err() != nil {
+				return l.busy(ctx, host, "session", started)
+			}
+			l.logger.WithError(err).WithField("host", host).Warn("Failed to check the SSH session rate, opening the session anyway")
+			return nil
+		}
+		if wait == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return l.busy(ctx, host, "session", started)
+		case <-time.After(time.Duration(wait) * time.Millisecond):
+		}
+	}
+}
+
+// busy returns why waiting for a connection or session of the target ended
+func (l *SSHTargetLimiter) busy(ctx context.Context, host, what string, started time.Time) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: no SSH %s to %s was free within %s", ErrSSHTargetBusy, what, host, time.Since(started).Round(time.Second))
+	}
+	return ctx.Err()
+}
+
+// limitedSSHConn is an SSH connection opened by the limiter. Its sessions are opened within the
+// session rate of the target, and those the target refuses because the connection has as many
+// sessions open as sshd's MaxSessions allows are retried until one closes.
+type limitedSSHConn struct {
+	ssh.Conn
+	limiter *SSHTargetLimiter
+	host    string
+}
+
+// OpenChannel opens a channel on the connection; ssh.Client opens its sessions with it
+func (c *limitedSSHConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	if name != "session" {
+		return c.Conn.OpenChannel(name, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.limiter.config.WaitTimeout)
+	defer cancel()
+
+	started := time.Now()
+	delay := 100 * time.Millisecond
+	for {
+		if err := c.limiter.openSession(ctx, c.host); err != nil {
+			return nil, nil, err
+		}
+		channel, requests, err := c.Conn.OpenChannel(name, data)
+		var openErr *ssh.OpenChannelError
+		if !errors.As(err, &openErr) || openErr.Reason != ssh.Prohibited {
+			return channel, requests, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("%w: %s refused SSH sessions for %s: %v", ErrSSHTargetBusy, c.host, time.Since(started).Round(time.Second), err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, sshTargetPollInterval)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"deployknot/internal/database"
@@ -15,6 +17,15 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	// ErrInvalidUser is returned when a user provisioning request is invalid
+	ErrInvalidUser = errors.New("invalid user")
+	// ErrUsernameTaken is returned when another user already has the username
+	ErrUsernameTaken = errors.New("username already exists")
+	// ErrEmailTaken is returned when another user already has the email address
+	ErrEmailTaken = errors.New("email already exists")
+)
+
 // UserService handles user-related business logic
 type UserService struct {
 	repo   *database.Repository
@@ -55,6 +66,7 @@ func (s *UserService) RegisterUser(ctx context.Context, req *models.RegisterRequ
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: string(hashedPassword),
+		Role:         models.RoleUser,
 		IsActive:     true,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
@@ -74,6 +86,7 @@ func (s *UserService) RegisterUser(ctx context.Context, req *models.RegisterRequ
 		ID:        user.ID,
 		Username:  user.Username,
 		Email:     user.Email,
+		Role:      user.Role,
 		IsActive:  user.IsActive,
 		CreatedAt: user.CreatedAt,
 	}, nil
@@ -107,6 +120,7 @@ func (s *UserService) LoginUser(ctx context.Context, req *models.LoginRequest) (
 			ID:        user.ID,
 			Username:  user.Username,
 			Email:     user.Email,
+			Role:      user.Role,
 			IsActive:  user.IsActive,
 			CreatedAt: user.CreatedAt,
 		},
@@ -128,11 +142,208 @@ func (s *UserService) GetUserByID(ctx context.Context, userID uuid.UUID) (*model
 		ID:        user.ID,
 		Username:  user.Username,
 		Email:     user.Email,
+		Role:      user.Role,
 		IsActive:  user.IsActive,
 		CreatedAt: user.CreatedAt,
 	}, nil
 }
 
+// GetUserRole returns the role of an active user
+func (s *UserService) GetUserRole(ctx context.Context, userID uuid.UUID) (models.Role, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user == nil || !user.IsActive {
+		return "", fmt.Errorf("user not found")
+	}
+
+	return user.Role, nil
+}
+
+// PromoteAdmins grants the admin role to the configured usernames
+func (s *UserService) PromoteAdmins(ctx context.Context, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	promoted, err := s.repo.PromoteUsersToAdmin(usernames)
+	if err != nil {
+		return err
+	}
+
+	if promoted > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"usernames": usernames,
+			"promoted":  promoted,
+		}).Info("Granted admin role to configured users")
+	}
+
+	return nil
+}
+
+// IsUserActive reports whether a user exists and is active
+func (s *UserService) IsUserActive(ctx context.Context, userID uuid.UUID) (bool, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user != nil && user.IsActive, nil
+}
+
+// CreateUser provisions a user on behalf of an administrator or identity provider. Without a
+// password the user can only sign in through OAuth or OIDC.
+func (s *UserService) CreateUser(ctx context.Context, req *models.CreateUserRequest, active bool) (*models.User, error) {
+	now := time.Now()
+	user := &models.User{
+		ID:        uuid.New(),
+		Username:  strings.TrimSpace(req.Username),
+		Email:     strings.TrimSpace(req.Email),
+		Role:      req.Role,
+		IsActive:  active,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if err := s.checkUser(user); err != nil {
+		return nil, err
+	}
+	if err := setPassword(user, req.Password); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateUser(user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"active":   user.IsActive,
+	}).Info("User provisioned")
+
+	return user, nil
+}
+
+// GetUser returns a user by ID
+func (s *UserService) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ListUsers returns the users matching the filter and the total number of matches
+func (s *UserService) ListUsers(ctx context.Context, filter models.UserFilter, limit, offset int) ([]*models.User, int, error) {
+	users, total, err := s.repo.ListUsers(filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+	return users, total, nil
+}
+
+// UpdateUser activates, deactivates or changes the role of a user
+func (s *UserService) UpdateUser(ctx context.Context, userID uuid.UUID, req *models.UpdateUserRequest) (*models.User, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if req.IsActive != nil {
+		user.IsActive = *req.IsActive
+	}
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+	return s.SaveUser(ctx, user, "")
+}
+
+// SaveUser stores changes to a user's username, email, role and active flag, and sets a new
+// password when one is given. Deactivated users are signed out on their next request.
+func (s *UserService) SaveUser(ctx context.Context, user *models.User, password string) (*models.User, error) {
+	user.Username = strings.TrimSpace(user.Username)
+	user.Email = strings.TrimSpace(user.Email)
+	if err := s.checkUser(user); err != nil {
+		return nil, err
+	}
+	if password != "" {
+		if err := setPassword(user, password); err != nil {
+			return nil, err
+		}
+	}
+
+	found, err := s.repo.UpdateUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUserNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"active":   user.IsActive,
+	}).Info("User updated")
+
+	return user, nil
+}
+
+// checkUser validates a user's fields and that no other user has the same username or email
+func (s *UserService) checkUser(user *models.User) error {
+	if len(user.Username) < 3 || len(user.Username) > 100 {
+		return fmt.Errorf("%w: username must be between 3 and 100 characters", ErrInvalidUser)
+	}
+	if !strings.Contains(user.Email, "@") || len(user.Email) > 255 {
+		return fmt.Errorf("%w: a valid email address is required", ErrInvalidUser)
+	}
+	if user.Role != models.RoleUser && user.Role != models.RoleAdmin {
+		return fmt.Errorf("%w: role must be %q or %q", ErrInvalidUser, models.RoleUser, models.RoleAdmin)
+	}
+
+	existing, err := s.repo.GetUserByUsername(user.Username)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return ErrUsernameTaken
+	}
+	existing, err = s.repo.GetUserByEmail(user.Email)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// setPassword hashes a new password into the user; an empty password leaves the user without one
+func setPassword(user *models.User, password string) error {
+	if password == "" {
+		return nil
+	}
+	if len(password) < 6 {
+		return fmt.Errorf("%w: password must be at least 6 characters", ErrInvalidUser)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.PasswordHash = string(hashed)
+	return nil
+}
+
 // generateRandomString generates a random string for JWT secret
 func generateRandomString(length int) (string, error) {
 	bytes := make([]byte, length)
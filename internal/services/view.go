@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidSavedView is returned when a saved view request is invalid
+	ErrInvalidSavedView = errors.New("invalid saved view")
+	// ErrSavedViewExists is returned when the user already has a saved view with the same name
+	ErrSavedViewExists = errors.New("a saved view with this name already exists")
+	// ErrSavedViewNotFound is returned when a saved view does not exist or belongs to another user
+	ErrSavedViewNotFound = errors.New("saved view not found")
+)
+
+// ViewService manages users' saved deployment views
+type ViewService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewViewService creates a new view service
+func NewViewService(repo *database.Repository, logger *logrus.Logger) *ViewService {
+	return &ViewService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateView saves a named set of deployment filters for userID
+func (s *ViewService) CreateView(ctx context.Context, userID uuid.UUID, req *models.SavedViewRequest) (*models.SavedView, error) {
+	name, err := s.validate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetSavedViewByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrSavedViewExists
+	}
+
+	now := time.Now()
+	view := &models.SavedView{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Filters:   req.Filters,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateSavedView(view); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"view_id": view.ID,
+		"user_id": userID,
+		"name":    view.Name,
+	}).Info("Saved view created")
+
+	return view, nil
+}
+
+// ListViews returns userID's saved views
+func (s *ViewService) ListViews(ctx context.Context, userID uuid.UUID) ([]*models.SavedView, error) {
+	views, err := s.repo.ListSavedViews(userID)
+	if err != nil {
+		return nil, err
+	}
+	if views == nil {
+		views = []*models.SavedView{}
+	}
+	return views, nil
+}
+
+// GetView returns one of userID's saved views
+func (s *ViewService) GetView(ctx context.Context, userID, id uuid.UUID) (*models.SavedView, error) {
+	view, err := s.repo.GetSavedView(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if view == nil {
+		return nil, ErrSavedViewNotFound
+	}
+	return view, nil
+}
+
+// UpdateView replaces the name and filters of one of userID's saved views
+func (s *ViewService) UpdateView(ctx context.Context, userID, id uuid.UUID, req *models.SavedViewRequest) (*models.SavedView, error) {
+	name, err := s.validate(req)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetSavedViewByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != id {
+		return nil, ErrSavedViewExists
+	}
+
+	view := &models.SavedView{
+		ID:      id,
+		UserID:  userID,
+		Name:    name,
+		Filters: req.Filters,
+	}
+	found, err := s.repo.UpdateSavedView(view)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSavedViewNotFound
+	}
+	return view, nil
+}
+
+// DeleteView deletes one of userID's saved views
+func (s *ViewService) DeleteView(ctx context.Context, userID, id uuid.UUID) error {
+	found, err := s.repo.DeleteSavedView(id, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSavedViewNotFound
+	}
+	return nil
+}
+
+// GetViewDeployments returns userID's deployments matching one of their saved views, newest first
+func (s *ViewService) GetViewDeployments(ctx context.Context, userID, id uuid.UUID, limit, offset int) (*models.SavedView, []*models.DeploymentResponse, error) {
+	view, err := s.GetView(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter, err := view.Filters.DeploymentFilter(userID, time.Now())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidSavedView, err)
+	}
+
+	repo, release, err := s.repo.Scoped(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer release()
+
+	deployments, err := repo.ListDeployments(filter, limit, offset)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	responses := make([]*models.DeploymentResponse, 0, len(deployments))
+	for _, deployment := range deployments {
+		responses = append(responses, toDeploymentResponse(deployment))
+	}
+	return view, responses, nil
+}
+
+// validate checks a saved view request and returns the trimmed name
+func (s *ViewService) validate(req *models.SavedViewRequest) (string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", fmt.Errorf("%w: name must not be empty", ErrInvalidSavedView)
+	}
+	if err := req.Filters.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSavedView, err)
+	}
+	return name, nil
+}
@@ -0,0 +1,609 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrVolumeBackupsDisabled is returned when no backup bucket is configured
+	ErrVolumeBackupsDisabled = errors.New("volume backups are not configured; set VOLUME_BACKUP_S3_BUCKET")
+	// ErrVolumeBackupNotFound is returned when a managed service has no backup with the requested ID
+	ErrVolumeBackupNotFound = errors.New("backup not found")
+	// ErrVolumeBackupBusy is returned when a backup or restore of the managed service is running
+	ErrVolumeBackupBusy = errors.New("a backup or restore of the managed service is already running")
+	// ErrVolumeBackupUnavailable is returned when a backup cannot be taken or restored in the state
+	// the managed service or the backup is in
+	ErrVolumeBackupUnavailable = errors.New("backup unavailable")
+)
+
+// volumeBackupBatchSize bounds the number of due backups handled per sweep
+const volumeBackupBatchSize = 20
+
+// VolumeBackupService backs up the data of managed services to S3-compatible storage and restores
+// it. Postgres is backed up with pg_dump and MySQL with mysqldump, in the running container; Redis
+// by archiving its data directory. The server takes the backup over SSH with the credentials of the
+// service's latest deployment, so the target never needs credentials of the bucket.
+type VolumeBackupService struct {
+	repo    *database.Repository
+	managed *ManagedServiceService
+	sshCA   *SSHCAService
+	targets *SSHTargetLimiter
+	bucket  *s3Bucket
+	config  config.VolumeBackupConfig
+	logger  *logrus.Logger
+}
+
+// NewVolumeBackupService creates a new volume backup service
+func NewVolumeBackupService(repo *database.Repository, managed *ManagedServiceService, sshCA *SSHCAService, targets *SSHTargetLimiter, cfg config.VolumeBackupConfig, logger *logrus.Logger) *VolumeBackupService {
+	return &VolumeBackupService{
+		repo:    repo,
+		managed: managed,
+		sshCA:   sshCA,
+		targets: targets,
+		bucket:  newS3Bucket(cfg),
+		config:  cfg,
+		logger:  logger,
+	}
+}
+
+// ListBackups returns the backups of a managed service userID may see, newest first
+func (s *VolumeBackupService) ListBackups(ctx context.Context, userID, serviceID uuid.UUID) ([]*models.VolumeBackup, error) {
+	if _, err := s.managed.GetManagedService(ctx, userID, serviceID); err != nil {
+		return nil, err
+	}
+	backups, err := s.repo.ListVolumeBackups(serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if backups == nil {
+		backups = []*models.VolumeBackup{}
+	}
+	return backups, nil
+}
+
+// GetBackup returns a backup of a managed service userID may see
+func (s *VolumeBackupService) GetBackup(ctx context.Context, userID, serviceID, backupID uuid.UUID) (*models.VolumeBackup, error) {
+	if _, err := s.managed.GetManagedService(ctx, userID, serviceID); err != nil {
+		return nil, err
+	}
+	return s.getBackup(serviceID, backupID)
+}
+
+// CreateBackup starts a backup of a managed service on behalf of userID. The backup runs in the
+// background; the returned record is pending.
+func (s *VolumeBackupService) CreateBackup(ctx context.Context, userID, serviceID uuid.UUID) (*models.VolumeBackup, error) {
+	if !s.config.Enabled() {
+		return nil, ErrVolumeBackupsDisabled
+	}
+	service, err := s.managed.GetManagedService(ctx, userID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	if service.DeploymentID == nil {
+		return nil, fmt.Errorf("%w: the managed service has not been deployed", ErrVolumeBackupUnavailable)
+	}
+	if err := s.checkIdle(service.ID); err != nil {
+		return nil, err
+	}
+
+	backup, err := s.startBackup(service, models.VolumeBackupTriggerManual, &userID)
+	if err != nil {
+		return nil, err
+	}
+	go s.runBackup(context.Background(), service, backup)
+	return backup, nil
+}
+
+// RestoreBackup starts restoring a completed backup into its managed service on behalf of userID,
+// replacing the data the service holds. The restore runs in the background; the returned record's
+// restore is running.
+func (s *VolumeBackupService) RestoreBackup(ctx context.Context, userID, serviceID, backupID uuid.UUID) (*models.VolumeBackup, error) {
+	if !s.config.Enabled() {
+		return nil, ErrVolumeBackupsDisabled
+	}
+	service, err := s.managed.GetManagedService(ctx, userID, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	backup, err := s.getBackup(serviceID, backupID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case backup.Status != models.VolumeBackupStatusCompleted:
+		return nil, fmt.Errorf("%w: the backup is %s; only completed backups can be restored", ErrVolumeBackupUnavailable, backup.Status)
+	case service.DeploymentID == nil:
+		return nil, fmt.Errorf("%w: the managed service has not been deployed", ErrVolumeBackupUnavailable)
+	}
+	if err := s.checkIdle(service.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	running := models.VolumeBackupStatusRunning
+	backup.RestoreStatus, backup.RestoreError, backup.RestoredAt = &running, nil, &now
+	if err := s.repo.UpdateVolumeBackupRestore(backup); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"managed_service_id": service.ID,
+		"backup_id":          backup.ID,
+		"user_id":            userID,
+	}).Info("Restoring managed service backup")
+
+	go s.runRestore(context.Background(), service, backup)
+	return backup, nil
+}
+
+// DeleteBackup deletes a backup of a managed service and its object in the bucket
+func (s *VolumeBackupService) DeleteBackup(ctx context.Context, userID, serviceID, backupID uuid.UUID) error {
+	if !s.config.Enabled() {
+		return ErrVolumeBackupsDisabled
+	}
+	if _, err := s.managed.GetManagedService(ctx, userID, serviceID); err != nil {
+		return err
+	}
+	backup, err := s.getBackup(serviceID, backupID)
+	if err != nil {
+		return err
+	}
+	if backup.IsActive() {
+		return ErrVolumeBackupBusy
+	}
+	return s.deleteBackup(ctx, backup)
+}
+
+// Run takes the due scheduled backups every interval until ctx is cancelled
+func (s *VolumeBackupService) Run(ctx context.Context) {
+	s.logger.WithFields(logrus.Fields{
+		"interval": s.config.Interval,
+		"bucket":   s.config.Bucket,
+	}).Info("Starting volume backup scheduler")
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("Volume backup sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep takes the backup of every managed service whose scheduled backup is due and returns how
+// many completed. Like deployment schedules, backups missed while no server was up run once.
+// Backups and restores left running by a server that stopped are failed first.
+func (s *VolumeBackupService) Sweep(ctx context.Context) (int, error) {
+	now := time.Now()
+	stale, err := s.repo.FailStaleVolumeBackups(now.Add(-2*s.config.Timeout), "the server running it stopped before it finished")
+	if err != nil {
+		return 0, err
+	}
+	if stale > 0 {
+		s.logger.WithField("count", stale).Warn("Failed volume backups and restores that never finished")
+	}
+
+	due, err := s.repo.GetDueManagedServiceBackups(now, volumeBackupBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, service := range due {
+		logger := s.logger.WithField("managed_service_id", service.ID)
+
+		next, err := service.NextBackup(now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to compute the next backup of managed service")
+			continue
+		}
+		// Another server may be handling the same backup
+		claimed, err := s.repo.ClaimManagedServiceBackup(service.ID, *service.NextBackupAt, next)
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim managed service backup")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.checkIdle(service.ID); err != nil {
+			logger.WithError(err).Warn("Skipping scheduled backup of managed service")
+			continue
+		}
+
+		backup, err := s.startBackup(service, models.VolumeBackupTriggerScheduled, nil)
+		if err != nil {
+			logger.WithError(err).Error("Failed to start scheduled backup of managed service")
+			continue
+		}
+		if s.runBackup(ctx, service, backup) == nil {
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// getBackup returns a backup of a managed service
+func (s *VolumeBackupService) getBackup(serviceID, backupID uuid.UUID) (*models.VolumeBackup, error) {
+	backup, err := s.repo.GetVolumeBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	if backup == nil || backup.ManagedServiceID != serviceID {
+		return nil, ErrVolumeBackupNotFound
+	}
+	return backup, nil
+}
+
+// checkIdle fails with ErrVolumeBackupBusy while a backup or restore of the service is running
+func (s *VolumeBackupService) checkIdle(serviceID uuid.UUID) error {
+	backups, err := s.repo.ListVolumeBackups(serviceID)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		if backup.IsActive() {
+			return ErrVolumeBackupBusy
+		}
+	}
+	return nil
+}
+
+// startBackup records a pending backup of a managed service
+func (s *VolumeBackupService) startBackup(service *models.ManagedService, trigger string, createdBy *uuid.UUID) (*models.VolumeBackup, error) {
+	method, err := models.ManagedBackupFor(service.Engine)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	backup := &models.VolumeBackup{
+		ID:               uuid.New(),
+		ManagedServiceID: service.ID,
+		Method:           method.Method,
+		Trigger:          trigger,
+		Status:           models.VolumeBackupStatusPending,
+		CreatedBy:        createdBy,
+		CreatedAt:        now,
+	}
+	backup.ObjectKey = fmt.Sprintf("%s%s/%s-%s%s", s.config.Prefix, service.ID, now.UTC().Format("20060102T150405Z"), backup.ID, method.Extension)
+	if err := s.repo.CreateVolumeBackup(backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// runBackup takes a pending backup and records its outcome. The backups beyond the service's
+// retention are deleted afterwards.
+func (s *VolumeBackupService) runBackup(ctx context.Context, service *models.ManagedService, backup *models.VolumeBackup) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	logger := s.logger.WithFields(logrus.Fields{
+		"managed_service_id": service.ID,
+		"backup_id":          backup.ID,
+	})
+
+	started := time.Now()
+	backup.Status, backup.StartedAt = models.VolumeBackupStatusRunning, &started
+	if err := s.repo.UpdateVolumeBackup(backup); err != nil {
+		logger.WithError(err).Error("Failed to record volume backup start")
+	}
+
+	backupErr := s.takeBackup(ctx, service, backup)
+	completed := time.Now()
+	backup.CompletedAt = &completed
+	if backupErr != nil {
+		message := backupErr.Error()
+		backup.Status, backup.ErrorMessage = models.VolumeBackupStatusFailed, &message
+		logger.WithError(backupErr).Warn("Volume backup failed")
+	} else {
+		backup.Status = models.VolumeBackupStatusCompleted
+		logger.WithFields(logrus.Fields{
+			"size_bytes": backup.SizeBytes,
+			"duration":   completed.Sub(started).Round(time.Second),
+		}).Info("Volume backup completed")
+	}
+	if err := s.repo.UpdateVolumeBackup(backup); err != nil {
+		logger.WithError(err).Error("Failed to record volume backup outcome")
+	}
+
+	s.prune(ctx, service)
+	return backupErr
+}
+
+// takeBackup dumps the data of the service on its target into a temporary file, hashing it as it
+// is written, and uploads the file to the bucket
+func (s *VolumeBackupService) takeBackup(ctx context.Context, service *models.ManagedService, backup *models.VolumeBackup) error {
+	method, err := models.ManagedBackupFor(service.Engine)
+	if err != nil {
+		return err
+	}
+	client, err := s.dial(ctx, service)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	file, err := os.CreateTemp("", "deployknot-backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	checksum := sha256.New()
+	var out io.Writer = io.MultiWriter(file, checksum)
+	var compressor *gzip.Writer
+	if method.Compress {
+		compressor = gzip.NewWriter(out)
+		out = compressor
+	}
+
+	cmd := "docker exec " + shellquote.Quote(service.ContainerName()) + " sh -c " + shellquote.Quote(method.Dump)
+	if err := runRemoteStream(ctx, client, cmd, nil, out); err != nil {
+		return fmt.Errorf("%s failed: %w", method.Method, err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return fmt.Errorf("failed to compress backup: %w", err)
+		}
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	if size == 0 {
+		return fmt.Errorf("%s wrote nothing", method.Method)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	sum := hex.EncodeToString(checksum.Sum(nil))
+	if err := s.bucket.put(ctx, backup.ObjectKey, file, size, sum); err != nil {
+		return err
+	}
+	backup.SizeBytes, backup.SHA256 = size, &sum
+	return nil
+}
+
+// runRestore restores a backup and records the outcome of the restore
+func (s *VolumeBackupService) runRestore(ctx context.Context, service *models.ManagedService, backup *models.VolumeBackup) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	logger := s.logger.WithFields(logrus.Fields{
+		"managed_service_id": service.ID,
+		"backup_id":          backup.ID,
+	})
+
+	restoreErr := s.restoreBackup(ctx, service, backup)
+	now := time.Now()
+	status := models.VolumeBackupStatusCompleted
+	backup.RestoreError, backup.RestoredAt = nil, &now
+	if restoreErr != nil {
+		message := restoreErr.Error()
+		status, backup.RestoreError = models.VolumeBackupStatusFailed, &message
+		logger.WithError(restoreErr).Warn("Volume backup restore failed")
+	} else {
+		logger.Info("Volume backup restored")
+	}
+	backup.RestoreStatus = &status
+	if err := s.repo.UpdateVolumeBackupRestore(backup); err != nil {
+		logger.WithError(err).Error("Failed to record volume backup restore outcome")
+	}
+}
+
+// restoreBackup downloads a backup into a temporary file, verifies its checksum and loads it into
+// the service on its target. Offline backups are loaded with the container stopped, which is
+// started again afterwards even when loading failed.
+func (s *VolumeBackupService) restoreBackup(ctx context.Context, service *models.ManagedService, backup *models.VolumeBackup) error {
+	method, err := models.ManagedBackupFor(service.Engine)
+	if err != nil {
+		return err
+	}
+	container, err := models.ManagedContainerFor(service.Engine, service.Version)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.download(ctx, backup)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	var in io.Reader = file
+	if method.Compress {
+		decompressor, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		defer decompressor.Close()
+		in = decompressor
+	}
+
+	client, err := s.dial(ctx, service)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	name := shellquote.Quote(service.ContainerName())
+	if !method.Offline {
+		if err := runRemoteStream(ctx, client, "docker exec -i "+name+" sh -c "+shellquote.Quote(method.Load), in, io.Discard); err != nil {
+			return fmt.Errorf("failed to load backup: %w", err)
+		}
+		return nil
+	}
+
+	if err := runRemoteStream(ctx, client, "docker stop "+name, nil, io.Discard); err != nil {
+		return fmt.Errorf("failed to stop the managed service: %w", err)
+	}
+	// The data is loaded with the image the container runs, which is already on the target
+	load := fmt.Sprintf(`docker run --rm -i -v %s --entrypoint sh "$(docker inspect --format '{{.Config.Image}}' %s)" -c %s`,
+		shellquote.Quote(service.Volume+":"+container.DataDir), name, shellquote.Quote(method.Load))
+	loadErr := runRemoteStream(ctx, client, load, in, io.Discard)
+	if err := runRemoteStream(ctx, client, "docker start "+name, nil, io.Discard); err != nil {
+		return fmt.Errorf("failed to start the managed service again: %w", err)
+	}
+	if loadErr != nil {
+		return fmt.Errorf("failed to load backup: %w", loadErr)
+	}
+	return nil
+}
+
+// download copies the object of a backup into a temporary file and checks it against the
+// checksum recorded when it was uploaded. The caller closes and removes the file.
+func (s *VolumeBackupService) download(ctx context.Context, backup *models.VolumeBackup) (*os.File, error) {
+	body, err := s.bucket.get(ctx, backup.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp("", "deployknot-restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	fail := func(err error) (*os.File, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	checksum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, checksum), body); err != nil {
+		return fail(fmt.Errorf("failed to download backup: %w", err))
+	}
+	if backup.SHA256 != nil && !checksumMatches(checksum, *backup.SHA256) {
+		return fail(fmt.Errorf("the downloaded backup does not match its checksum"))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("failed to read temporary file: %w", err))
+	}
+	return file, nil
+}
+
+// prune keeps the newest completed backups of a service up to its retention and deletes the
+// others. Failed backups are kept up to the retention as well, as long as they are newer than the
+// oldest completed backup kept, so a target that keeps failing does not pile them up.
+func (s *VolumeBackupService) prune(ctx context.Context, service *models.ManagedService) {
+	backups, err := s.repo.ListVolumeBackups(service.ID)
+	if err != nil {
+		s.logger.WithError(err).WithField("managed_service_id", service.ID).Error("Failed to list volume backups to prune")
+		return
+	}
+
+	kept, keptFailed := 0, 0
+	for _, backup := range backups {
+		switch {
+		case backup.IsActive():
+			continue
+		case backup.Status == models.VolumeBackupStatusCompleted && kept < service.BackupRetention:
+			kept++
+			continue
+		case backup.Status == models.VolumeBackupStatusFailed && kept < service.BackupRetention && keptFailed < service.BackupRetention:
+			keptFailed++
+			continue
+		}
+		if err := s.deleteBackup(ctx, backup); err != nil {
+			s.logger.WithError(err).WithField("backup_id", backup.ID).Warn("Failed to delete volume backup beyond retention")
+		}
+	}
+}
+
+// deleteBackup deletes the object of a backup, if it was uploaded, and then its record
+func (s *VolumeBackupService) deleteBackup(ctx context.Context, backup *models.VolumeBackup) error {
+	if backup.Status == models.VolumeBackupStatusCompleted {
+		if err := s.bucket.delete(ctx, backup.ObjectKey); err != nil {
+			return err
+		}
+	}
+	deleted, err := s.repo.DeleteVolumeBackup(backup.ID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrVolumeBackupNotFound
+	}
+	return nil
+}
+
+// dial connects to the target of a managed service with the credentials of its latest deployment
+func (s *VolumeBackupService) dial(ctx context.Context, service *models.ManagedService) (*ssh.Client, error) {
+	if service.DeploymentID == nil {
+		return nil, fmt.Errorf("the managed service has not been deployed")
+	}
+	deployment, err := s.repo.GetDeployment(*service.DeploymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the deployment of the managed service: %w", err)
+	}
+	return dialDeploymentTarget(ctx, s.sshCA, s.targets, deployment, "backup", s.config.ConnectTimeout)
+}
+
+// runRemoteStream runs cmd on the target with stdin and stdout connected to in and out. The command
+// is ended when ctx is done, and its error includes the end of what it wrote to stderr.
+func runRemoteStream(ctx context.Context, client *ssh.Client, cmd string, in io.Reader, out io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin, session.Stdout, session.Stderr = in, out, &stderr
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	if err := session.Run(cmd); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > 500 {
+			message = "..." + message[len(message)-500:]
+		}
+		return fmt.Errorf("%v: %s", err, message)
+	}
+	return nil
+}
+
+// checksumMatches reports whether the hex digest of h is expected
+func checksumMatches(h hash.Hash, expected string) bool {
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), expected)
+}
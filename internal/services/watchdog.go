@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// DeploymentTimeoutPrefix starts the error message of every deployment failed by the watchdog
+const DeploymentTimeoutPrefix = "Deployment timed out"
+
+// Watchdog fails or requeues deployments that have been running longer than the maximum duration,
+// which happens when a worker dies mid-job
+type Watchdog struct {
+	repo   *database.Repository
+	queue  *QueueService
+	cache  *DeploymentCache
+	config config.WatchdogConfig
+	logger *logrus.Logger
+}
+
+// NewWatchdog creates a new deployment watchdog
+func NewWatchdog(repo *database.Repository, queue *QueueService, cache *DeploymentCache, cfg config.WatchdogConfig, logger *logrus.Logger) *Watchdog {
+	return &Watchdog{
+		repo:   repo,
+		queue:  queue,
+		cache:  cache,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// Run sweeps for stuck deployments every interval until ctx is cancelled
+func (w *Watchdog) Run(ctx context.Context) {
+	w.logger.WithFields(logrus.Fields{
+		"interval":     w.config.Interval,
+		"max_duration": w.config.MaxDuration,
+		"requeue":      w.config.Requeue,
+	}).Info("Starting deployment watchdog")
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Sweep(ctx); err != nil && ctx.Err() == nil {
+			w.logger.WithError(err).Error("Deployment watchdog sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep handles every deployment running longer than the maximum duration and returns how many were handled
+func (w *Watchdog) Sweep(ctx context.Context) (int, error) {
+	stuck, err := w.repo.GetStuckDeployments(time.Now().Add(-w.config.MaxDuration))
+	if err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	for _, deployment := range stuck {
+		ok, err := w.handleStuckDeployment(ctx, deployment)
+		if err != nil {
+			w.logger.WithError(err).WithField("deployment_id", deployment.ID).Error("Failed to handle stuck deployment")
+			continue
+		}
+		if ok {
+			handled++
+		}
+	}
+
+	return handled, nil
+}
+
+// handleStuckDeployment requeues the deployment when allowed, and otherwise fails it with a timeout error
+func (w *Watchdog) handleStuckDeployment(ctx context.Context, deployment *models.Deployment) (bool, error) {
+	logger := w.logger.WithField("deployment_id", deployment.ID)
+
+	// The worker that held the deployment is gone or overdue; free the deployment for others
+	if err := w.queue.ForceReleaseDeploymentLock(ctx, deployment.ID); err != nil {
+		return false, err
+	}
+	if key := deployment.ConcurrencyKey(); key != "" {
+		if err := w.queue.ReleaseConcurrencyLock(ctx, key, deployment.ID); err != nil {
+			return false, err
+		}
+	}
+
+	if w.config.Requeue {
+		requeued, err := w.requeue(ctx, deployment)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to requeue stuck deployment, failing it instead")
+		} else if requeued {
+			return true, nil
+		}
+	}
+
+	message := fmt.Sprintf("%s: still running after the maximum duration of %s", DeploymentTimeoutPrefix, w.config.MaxDuration)
+	timedOut, err := w.repo.TimeOutDeployment(deployment.ID, message)
+	if err != nil || !timedOut {
+		return false, err
+	}
+	w.cache.Invalidate(ctx, deployment.ID)
+
+	w.addLog(deployment, "error", message)
+	logger.Warn("Marked stuck deployment as timed out")
+	return true, nil
+}
+
+// requeue resets the deployment to pending and pushes its job back onto the queue, unless the
+// job has already been requeued the maximum number of times
+func (w *Watchdog) requeue(ctx context.Context, deployment *models.Deployment) (bool, error) {
+	requeues, err := w.queue.GetDeploymentJobRequeues(ctx, deployment.ID)
+	if err != nil {
+		return false, err
+	}
+	if requeues >= w.config.MaxRequeues {
+		return false, nil
+	}
+
+	reset, err := w.repo.ResetDeploymentForRequeue(deployment.ID)
+	if err != nil || !reset {
+		return false, err
+	}
+	defer w.cache.Invalidate(ctx, deployment.ID)
+
+	if _, err := w.queue.RequeueDeploymentJob(ctx, deployment.ID); err != nil {
+		message := fmt.Sprintf("%s: requeue failed: %v", DeploymentTimeoutPrefix, err)
+		if updateErr := w.repo.UpdateDeploymentStatus(deployment.ID, models.DeploymentStatusFailed, &message); updateErr != nil {
+			w.logger.WithError(updateErr).Error("Failed to mark deployment as failed after requeue error")
+		}
+		return true, nil
+	}
+
+	w.addLog(deployment, "warn", fmt.Sprintf("%s after %s; requeued (attempt %d of %d)", DeploymentTimeoutPrefix, w.config.MaxDuration, requeues+1, w.config.MaxRequeues))
+	w.logger.WithField("deployment_id", deployment.ID).Warn("Requeued stuck deployment")
+	return true, nil
+}
+
+// addLog records a watchdog message in the deployment's log
+func (w *Watchdog) addLog(deployment *models.Deployment, level models.LogLevel, message string) {
+	taskName := "watchdog"
+	category := models.LogCategoryDeployment
+	log := &models.DeploymentLog{
+		ID:           uuid.New(),
+		DeploymentID: deployment.ID,
+		CreatedAt:    time.Now(),
+		LogLevel:     level,
+		Message:      message,
+		TaskName:     &taskName,
+		Category:     &category,
+	}
+	if err := w.repo.CreateDeploymentLog(log); err != nil {
+		w.logger.WithError(err).Error("Failed to add watchdog log entry")
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/database"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrWorkerTokenExists is returned when the worker already has an active token
+	ErrWorkerTokenExists = errors.New("the worker already has an active token")
+	// ErrWorkerTokenNotFound is returned when a worker token does not exist or is already revoked
+	ErrWorkerTokenNotFound = errors.New("worker token not found")
+)
+
+// WorkerTokenService manages the tokens workers authenticate to the worker API with
+type WorkerTokenService struct {
+	repo   *database.Repository
+	logger *logrus.Logger
+}
+
+// NewWorkerTokenService creates a new worker token service
+func NewWorkerTokenService(repo *database.Repository, logger *logrus.Logger) *WorkerTokenService {
+	return &WorkerTokenService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// CreateToken creates the token of a worker. The token is only returned here; DeployKnot keeps a hash.
+func (s *WorkerTokenService) CreateToken(ctx context.Context, req *models.CreateWorkerTokenRequest, createdBy string) (*models.CreatedWorkerToken, error) {
+	workerID := strings.TrimSpace(req.WorkerID)
+	existing, err := s.repo.GetActiveWorkerToken(workerID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrWorkerTokenExists
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate worker token: %w", err)
+	}
+	token := models.WorkerTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	created := &models.CreatedWorkerToken{
+		WorkerToken: models.WorkerToken{
+			ID:        uuid.New(),
+			WorkerID:  workerID,
+			Prefix:    token[:apiKeyPrefixLength],
+			CreatedAt: time.Now(),
+		},
+		Token: token,
+	}
+	if createdBy != "" {
+		created.CreatedBy = &createdBy
+	}
+	if err := s.repo.CreateWorkerToken(&created.WorkerToken, hashAPIKey(token)); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"worker_token_id": created.ID,
+		"worker_id":       workerID,
+		"created_by":      createdBy,
+	}).Info("Worker token created")
+	return created, nil
+}
+
+// ListTokens returns every worker token without the tokens themselves; revoked tokens form the
+// revocation list
+func (s *WorkerTokenService) ListTokens(ctx context.Context) ([]*models.WorkerToken, error) {
+	return s.repo.ListWorkerTokens()
+}
+
+// RevokeToken revokes a worker token, e.g. when its worker is decommissioned
+func (s *WorkerTokenService) RevokeToken(ctx context.Context, id uuid.UUID, revokedBy string) error {
+	var by *string
+	if revokedBy != "" {
+		by = &revokedBy
+	}
+	revoked, err := s.repo.RevokeWorkerToken(id, by)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrWorkerTokenNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"worker_token_id": id,
+		"revoked_by":      revokedBy,
+	}).Info("Worker token revoked")
+	return nil
+}
+
+// Authenticate returns the token a worker presented, or nil when it is unknown or revoked
+func (s *WorkerTokenService) Authenticate(ctx context.Context, token string) (*models.WorkerToken, error) {
+	if !strings.HasPrefix(token, models.WorkerTokenPrefix) {
+		return nil, nil
+	}
+	workerToken, err := s.repo.GetWorkerTokenByHash(hashAPIKey(token))
+	if err != nil || workerToken == nil || workerToken.RevokedAt != nil {
+		return nil, err
+	}
+
+	if err := s.repo.TouchWorkerToken(workerToken.ID); err != nil {
+		s.logger.WithError(err).Warn("Failed to record worker token use")
+	}
+	return workerToken, nil
+}
@@ -0,0 +1,19 @@
+// Package shellquote quotes words for POSIX shells. Every command DeployKnot runs on a target
+// quotes its arguments with it, so the quoting rules live in one place.
+package shellquote
+
+import "strings"
+
+// Quote quotes a string so it is passed to a POSIX shell as a single literal word
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// Join builds a shell command line from a program and its arguments, quoting every word
+func Join(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
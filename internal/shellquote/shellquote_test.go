@@ -0,0 +1,73 @@
+package shellquote
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// words are arguments a shell must see unchanged once quoted
+var words = []string{
+	"",
+	"plain",
+	"two words",
+	"it's",
+	"''",
+	`'"'"'`,
+	`"double"`,
+	"$(id)",
+	"${HOME}",
+	"`id`",
+	"a; rm -rf /",
+	"a && b || c",
+	"a | b > c < d",
+	"line\nbreak",
+	"tab\there",
+	`back\slash`,
+	"*?[a-z]",
+	"~root",
+	"-n",
+	"#comment",
+	"!event",
+}
+
+func TestQuoteRoundTrip(t *testing.T) {
+	for _, word := range words {
+		out, err := exec.Command("sh", "-c", "printf %s "+Quote(word)).Output()
+		if err != nil {
+			t.Fatalf("sh -c printf %%s %s: %v", Quote(word), err)
+		}
+		if string(out) != word {
+			t.Errorf("Quote(%q) reached the shell as %q", word, out)
+		}
+	}
+}
+
+func TestJoinRoundTrip(t *testing.T) {
+	// Every word is printed on a line of its own, so the words must reach printf one each
+	args := append([]string{"printf", `%s\n`}, words...)
+	out, err := exec.Command("sh", "-c", Join(args...)).Output()
+	if err != nil {
+		t.Fatalf("sh -c %s: %v", Join(args...), err)
+	}
+	want := ""
+	for _, word := range words {
+		want += word + "\n"
+	}
+	if string(out) != want {
+		t.Errorf("Join(%q) printed %q, want %q", args, out, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "''"},
+		{"abc", "'abc'"},
+		{"it's", `'it'"'"'s'`},
+		{"$(id)", "'$(id)'"},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// baseImageStore checks for and pulls images on the target, through the docker CLI or the
+// Docker Engine API
+type baseImageStore struct {
+	present func(ref string) error
+	pull    func(ref string) error
+}
+
+// cliBaseImageStore handles images through the docker CLI on the target
+func cliBaseImageStore(sshClient *targetConn) baseImageStore {
+	return baseImageStore{
+		present: func(ref string) error {
+			_, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "image", "inspect", ref))
+			return err
+		},
+		pull: func(ref string) error {
+			output, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "pull", ref))
+			if err != nil {
+				return fmt.Errorf("%w: %s", err, output)
+			}
+			return nil
+		},
+	}
+}
+
+// pullBaseImages pulls the base images of the repository's Dockerfile that are not on the target
+// yet while the repository is cloned, so the build does not wait for them. The Dockerfile is
+// fetched on its own since the clone is not there yet. Nothing here fails the deployment: whatever
+// could not be pulled is pulled by the build.
+func (w *Worker) pullBaseImages(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, repoURL, pat, branch string, checkout repoCheckout, images baseImageStore) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepPullBaseImages, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+	defer func() {
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepPullBaseImages, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+	}()
+
+	dockerfile, err := fetchDockerfile(sshClient, repoURL, pat, branch, checkout)
+	if err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Could not fetch the Dockerfile ahead of the clone, the build pulls its base images: %v", err), "pull_base_images", intPtr(stepPullBaseImages))
+		return nil
+	}
+
+	refs := baseImages(dockerfile)
+	var pulled []string
+	for _, ref := range refs {
+		if images.present(ref) == nil {
+			continue
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Pulling base image %s", ref), "pull_base_images", intPtr(stepPullBaseImages))
+		if err := images.pull(ref); err != nil {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Failed to pull base image %s, the build tries again: %v", ref, err), "pull_base_images", intPtr(stepPullBaseImages))
+			continue
+		}
+		pulled = append(pulled, ref)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Pulled %d of %d base images, the others were already on the target", len(pulled), len(refs)), "pull_base_images", intPtr(stepPullBaseImages))
+	w.recordStepOutput(ctx, deploymentID, stepPullBaseImages, map[string]interface{}{
+		"base_images": refs,
+		"pulled":      pulled,
+	})
+	return nil
+}
+
+// fetchDockerfile downloads the default Dockerfile of the branch, or of the pinned commit, from
+// GitHub on the target. A Dockerfile configured in deployknot.yaml is only known once the
+// repository is cloned.
+func fetchDockerfile(sshClient *targetConn, repoURL, pat, branch string, checkout repoCheckout) (string, error) {
+	ref := branch
+	if checkout.commit != "" {
+		ref = checkout.commit
+	}
+	rawURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s", models.NormalizeRepoURL(repoURL), ref, path.Join(checkout.subdirectory, "Dockerfile"))
+
+	var stdout, stderr bytes.Buffer
+	cmd := sshClient.shell.httpGet(rawURL, map[string]string{"Authorization": "token " + pat})
+	if err := sshClient.RunWithStream(context.Background(), cmd, nil, &stdout, &stderr); err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(strings.ReplaceAll(stderr.String(), pat, "***")))
+	}
+	return stdout.String(), nil
+}
+
+// baseImages returns the images a Dockerfile builds from, leaving out scratch, earlier build
+// stages and references using build arguments, which only the build can resolve
+func baseImages(dockerfile string) []string {
+	stages := map[string]bool{}
+	seen := map[string]bool{}
+	var images []string
+	for _, line := range strings.Split(dockerfile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+
+		args := fields[1:]
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		ref := args[0]
+		skip := strings.EqualFold(ref, "scratch") || stages[strings.ToLower(ref)] || strings.Contains(ref, "$") || strings.HasPrefix(ref, "-") || seen[ref]
+		if len(args) >= 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = true
+		}
+		if skip {
+			continue
+		}
+		seen[ref] = true
+		images = append(images, ref)
+	}
+	return images
+}
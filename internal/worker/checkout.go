@@ -0,0 +1,63 @@
+package worker
+
+import "path"
+
+// repoCheckout controls how the repository is checked out on the target
+type repoCheckout struct {
+	// root is where the repository is cloned, the workspace directory of the target's shell
+	root string
+	// subdirectory limits the checkout to one directory of a monorepo, which becomes the application root
+	subdirectory string
+	// lfs fetches Git LFS objects (only those under subdirectory, when set)
+	lfs bool
+	// commit is checked out instead of the head of the branch, when set
+	commit string
+}
+
+// appDir returns the application root on the target
+func (c repoCheckout) appDir() string {
+	return path.Join(c.root, c.subdirectory)
+}
+
+// cloneCommand builds the command that checks out branch, or the pinned commit, into the
+// workspace. A subdirectory is fetched with a shallow, blobless clone and a cone-mode sparse
+// checkout so the rest of the repository is never downloaded.
+func (c repoCheckout) cloneCommand(shell remoteShell, cloneURL, branch string) string {
+	var steps []string
+	if c.lfs {
+		// LFS objects are pulled once, after checkout, for the checked-out paths only
+		steps = append(steps, shell.setEnv("GIT_LFS_SKIP_SMUDGE", "1"))
+	}
+	if c.subdirectory == "" {
+		steps = append(steps, shell.command("git", "clone", cloneURL, c.root))
+		if branch != "main" {
+			steps = append(steps, shell.inDir(c.root, shell.command("git", "checkout", branch)))
+		}
+		if c.commit != "" {
+			steps = append(steps, shell.inDir(c.root, shell.command("git", "checkout", "--detach", c.commit)))
+		}
+	} else {
+		steps = append(steps,
+			shell.command("git", "clone", "--depth", "1", "--filter=blob:none", "--sparse", "--branch", branch, cloneURL, c.root),
+			shell.inDir(c.root, shell.command("git", "sparse-checkout", "set", c.subdirectory)),
+		)
+		if c.commit != "" {
+			// The shallow clone only has the head of the branch
+			steps = append(steps,
+				shell.inDir(c.root, shell.command("git", "fetch", "--depth", "1", "--filter=blob:none", "origin", c.commit)),
+				shell.inDir(c.root, shell.command("git", "checkout", "--detach", c.commit)),
+			)
+		}
+		steps = append(steps, shell.requireDir(c.subdirectory, "repo_subdirectory "+c.subdirectory+" does not exist on branch "+branch))
+	}
+
+	if c.lfs {
+		pull := shell.command("git", "lfs", "pull")
+		if c.subdirectory != "" {
+			pull = shell.command("git", "lfs", "pull", "--include", c.subdirectory+"/**")
+		}
+		steps = append(steps, shell.inDir(c.root, shell.command("git", "lfs", "install", "--local")), pull)
+	}
+
+	return shell.all(steps...)
+}
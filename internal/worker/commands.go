@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// stepCommand returns the command a step runs on the target: the installation's command template
+// of the step when one is set, or command. The template's variables are quoted for the target's
+// shell; Command is the built-in command and Args its arguments without the program.
+func (w *Worker) stepCommand(ctx context.Context, deploymentID uuid.UUID, shell remoteShell, step string, stepOrder int, command string, args []string, vars map[string]string) string {
+	tmpl, err := w.commandTemplates.Template(ctx, step)
+	if err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Ignoring the command template of %s: %v", step, err), step, intPtr(stepOrder))
+		return command
+	}
+	if tmpl == nil {
+		return command
+	}
+
+	data := make(map[string]string, len(vars)+2)
+	for name, value := range vars {
+		data[name] = shell.quote(value)
+	}
+	data["Command"] = command
+	if len(args) > 1 {
+		quoted := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			quoted[i] = shell.quote(arg)
+		}
+		data["Args"] = strings.Join(quoted, " ")
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Ignoring the command template of %s: %v", step, err), step, intPtr(stepOrder))
+		return command
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Running %s with the installation's command template", step), step, intPtr(stepOrder))
+	return rendered.String()
+}
+
+// dockerRunCommand returns the command that starts the container from runArgs, a docker run
+// command line
+func (w *Worker) dockerRunCommand(ctx context.Context, deploymentID uuid.UUID, shell remoteShell, runArgs []string, containerName string, port int) string {
+	envFile := ""
+	for i, arg := range runArgs {
+		if arg == "--env-file" && i+1 < len(runArgs) {
+			envFile = runArgs[i+1]
+		}
+	}
+	return w.stepCommand(ctx, deploymentID, shell, models.CommandStepDockerRun, stepDockerRun, shell.command(runArgs...), runArgs, map[string]string{
+		"Name":    containerName,
+		"Image":   containerName + ":latest",
+		"Port":    strconv.Itoa(port),
+		"EnvFile": envFile,
+	})
+}
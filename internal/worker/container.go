@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+
+	"deployknot/internal/dockerapi"
+	"deployknot/internal/models"
+)
+
+// containerOptions are the options of a deployment that shape how its container is run
+type containerOptions struct {
+	// gpus is "all" or a comma-separated list of GPU indexes or UUIDs
+	gpus string
+	// extraRunArgs are the allowlisted docker run flags the deployment adds
+	extraRunArgs []models.RunArg
+	// network is the network of the application the deployment releases a service of, which the
+	// other services reach the container on by networkAlias
+	network      string
+	networkAlias string
+	// dependencies are the containers that must be ready before the container starts
+	dependencies []models.ContainerDependency
+}
+
+// containerOptionsFromJob reads the container options of a deployment job. They reach the docker
+// command line on the target, so they are validated again rather than trusted.
+func containerOptionsFromJob(data map[string]interface{}) (containerOptions, error) {
+	options := containerOptions{
+		gpus: getStringFromMap(data, "gpus"),
+	}
+	if options.gpus != "" {
+		if err := models.ValidateGPUs(options.gpus); err != nil {
+			return options, err
+		}
+	}
+
+	extraRunArgs, err := models.ParseExtraRunArgs(getStringFromMap(data, "extra_run_args"))
+	if err != nil {
+		return options, err
+	}
+	options.extraRunArgs = extraRunArgs
+
+	options.network = getStringFromMap(data, "network")
+	options.networkAlias = getStringFromMap(data, "network_alias")
+	for _, name := range []string{options.network, options.networkAlias} {
+		if name == "" {
+			continue
+		}
+		if err := models.ValidateContainerName(name); err != nil {
+			return options, fmt.Errorf("invalid network: %w", err)
+		}
+	}
+
+	for _, value := range getStringsFromMap(data, "depends_on") {
+		dependency, err := models.ParseContainerDependency(value)
+		if err != nil {
+			return options, err
+		}
+		options.dependencies = append(options.dependencies, dependency)
+	}
+	return options, nil
+}
+
+// runArgs returns the docker run arguments for the options. Each GPU gets a --gpus flag of its
+// own, since a single "device=0,1" value needs quotes that do not survive every shell.
+func (o containerOptions) runArgs() []string {
+	var args []string
+	if o.gpus == models.AllGPUs {
+		args = append(args, "--gpus", models.AllGPUs)
+	}
+	for _, device := range models.GPUDevices(o.gpus) {
+		args = append(args, "--gpus", "device="+device)
+	}
+	for _, arg := range o.extraRunArgs {
+		args = append(args, arg.String())
+	}
+	if o.network != "" {
+		args = append(args, "--network", o.network)
+		if o.networkAlias != "" {
+			args = append(args, "--network-alias", o.networkAlias)
+		}
+	}
+	return args
+}
+
+// apply sets the options on a container created through the Docker Engine API
+func (o containerOptions) apply(cfg *dockerapi.ContainerConfig) error {
+	cfg.AllGPUs = o.gpus == models.AllGPUs
+	cfg.GPUDevices = models.GPUDevices(o.gpus)
+	cfg.Network = o.network
+	if o.networkAlias != "" {
+		cfg.NetworkAliases = []string{o.networkAlias}
+	}
+
+	for _, arg := range o.extraRunArgs {
+		switch arg.Flag {
+		case "--add-host":
+			cfg.ExtraHosts = append(cfg.ExtraHosts, arg.Value)
+		case "--ulimit":
+			name, soft, hard, err := models.ParseUlimit(arg.Value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", arg, err)
+			}
+			cfg.Ulimits = append(cfg.Ulimits, dockerapi.Ulimit{Name: name, Soft: soft, Hard: hard})
+		case "--shm-size", "--memory":
+			size, err := models.ParseByteSize(arg.Value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", arg, err)
+			}
+			if arg.Flag == "--shm-size" {
+				cfg.ShmSize = size
+			} else {
+				cfg.Memory = size
+			}
+		case "--cpus":
+			cpus, err := strconv.ParseFloat(arg.Value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", arg, err)
+			}
+			cfg.NanoCPUs = int64(cpus * 1e9)
+		case "--pids-limit":
+			limit, err := strconv.ParseInt(arg.Value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", arg, err)
+			}
+			cfg.PidsLimit = limit
+		case "--restart":
+			policy, retries := models.ParseRestartPolicy(arg.Value)
+			cfg.RestartPolicy = &dockerapi.RestartPolicy{Name: policy, MaximumRetryCount: retries}
+		case "--init":
+			cfg.Init = true
+		case "--read-only":
+			cfg.ReadonlyRootfs = true
+		default:
+			return fmt.Errorf("%s is not supported by the Docker Engine API backend", arg.Flag)
+		}
+	}
+	return nil
+}
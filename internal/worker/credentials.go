@@ -0,0 +1,217 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// credentialCheck holds the parameters verified by the validate_credentials step
+type credentialCheck struct {
+	repoURL        string
+	pat            string
+	branch         string
+	port           int
+	containerName  string
+	deploymentType models.DeploymentType
+	gitLFS         bool
+	gpus           string
+}
+
+// validateCredentials verifies the target and repository are usable before anything on the target is modified
+func (w *Worker) validateCredentials(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params credentialCheck) error {
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "SSH login verified", "validate_credentials", intPtr(stepValidateCredentials))
+
+	checks := []func(context.Context, uuid.UUID, *targetConn, credentialCheck) error{
+		w.checkGitAvailable,
+		w.checkRepositoryAccess,
+	}
+	if params.deploymentType == models.DeploymentTypeManaged {
+		// Managed services run an official image, so there is no repository to check
+		checks = nil
+	}
+	if params.gitLFS {
+		checks = append(checks, w.checkGitLFSAvailable)
+	}
+	switch params.deploymentType {
+	case models.DeploymentTypeScript:
+	case models.DeploymentTypeCron:
+		// Cron jobs publish no port; cron starts them with the docker CLI
+		checks = append(checks, w.checkDockerAvailable, w.checkCrontabAvailable)
+	default:
+		checks = append(checks, w.checkDockerAvailable, w.checkPortAvailable)
+	}
+	if params.gpus != "" {
+		checks = append(checks, w.checkGPUsAvailable)
+	}
+
+	for _, check := range checks {
+		if err := check(ctx, deploymentID, sshClient, params); err != nil {
+			errorMsg := fmt.Sprintf("Credential validation failed: %v", err)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "validate_credentials", intPtr(stepValidateCredentials))
+			w.updateDeploymentStep(ctx, deploymentID, stepValidateCredentials, models.DeploymentStatusFailed, &errorMsg)
+			w.markRemainingStepsAsFailed(ctx, deploymentID, stepValidateCredentials)
+			return fmt.Errorf("credential validation failed: %w", err)
+		}
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Credentials validated successfully", "validate_credentials", intPtr(stepValidateCredentials))
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepValidateCredentials, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// checkGitAvailable verifies git is installed on the target
+func (w *Worker) checkGitAvailable(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, _ credentialCheck) error {
+	output, err := runRemoteCommand(sshClient, sshClient.shell.command("git", "--version"))
+	if err != nil {
+		return fmt.Errorf("git is not available on the target: %v, output: %s", err, output)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Git available: %s", output), "validate_credentials", intPtr(stepValidateCredentials))
+	return nil
+}
+
+// checkGitLFSAvailable verifies Git LFS is installed on the target
+func (w *Worker) checkGitLFSAvailable(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, _ credentialCheck) error {
+	output, err := runRemoteCommand(sshClient, sshClient.shell.command("git", "lfs", "version"))
+	if err != nil {
+		return fmt.Errorf("git lfs is not available on the target: %v, output: %s", err, output)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Git LFS available: %s", output), "validate_credentials", intPtr(stepValidateCredentials))
+	return nil
+}
+
+// checkRepositoryAccess verifies the PAT can read the repository and branch from the target
+func (w *Worker) checkRepositoryAccess(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params credentialCheck) error {
+	repoURL := fmt.Sprintf("https://%s@github.com/%s.git", params.pat, models.NormalizeRepoURL(params.repoURL))
+	shell := sshClient.shell
+	cmd := shell.all(shell.setEnv("GIT_TERMINAL_PROMPT", "0"), shell.command("git", "ls-remote", "--heads", repoURL, "refs/heads/"+params.branch))
+
+	output, err := runRemoteCommand(sshClient, cmd)
+	if err != nil {
+		return fmt.Errorf("cannot access repository with the provided PAT: %v, output: %s", err, output)
+	}
+	if output == "" {
+		return fmt.Errorf("branch %s does not exist in the repository", params.branch)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Repository access verified for branch %s", params.branch), "validate_credentials", intPtr(stepValidateCredentials))
+	return nil
+}
+
+// checkDockerAvailable verifies the SSH user can talk to the Docker daemon
+func (w *Worker) checkDockerAvailable(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, _ credentialCheck) error {
+	if w.workerConfig.DockerBackend == config.DockerBackendAPI {
+		docker := w.newDockerAPIClient(sshClient)
+		defer docker.Close()
+
+		version, err := docker.Version(ctx)
+		if err != nil {
+			return fmt.Errorf("docker engine api is not reachable at %s: %v", w.workerConfig.DockerSocket, err)
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker available: %s", version.Version), "validate_credentials", intPtr(stepValidateCredentials))
+		return nil
+	}
+
+	output, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "version", "--format", "{{.Server.Version}}"))
+	if err != nil {
+		// Point out when the daemon is only reachable through sudo, which deployments do not use
+		if sshClient.shell.name() != shellPOSIX {
+			return fmt.Errorf("docker is not available to the SSH user: %v, output: %s", err, output)
+		}
+		if _, sudoErr := runRemoteCommand(sshClient, "sudo -n docker version --format '{{.Server.Version}}'"); sudoErr == nil {
+			return fmt.Errorf("docker is only usable with sudo; add the SSH user to the docker group")
+		}
+		return fmt.Errorf("docker is not available to the SSH user: %v, output: %s", err, output)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker available: %s", output), "validate_credentials", intPtr(stepValidateCredentials))
+	return nil
+}
+
+// checkPortAvailable verifies the host port is free or held by the container being replaced
+func (w *Worker) checkPortAvailable(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params credentialCheck) error {
+	if params.port <= 0 {
+		return nil
+	}
+	port := strconv.Itoa(params.port)
+
+	output, err := runRemoteCommand(sshClient, sshClient.shell.portListeners(params.port))
+	if err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Could not check port %s: %v", port, err), "validate_credentials", intPtr(stepValidateCredentials))
+		return nil
+	}
+	if output == "" {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Port %s is available", port), "validate_credentials", intPtr(stepValidateCredentials))
+		return nil
+	}
+
+	// A port published by the container being redeployed is released during cleanup
+	if params.containerName != "" {
+		published, err := runRemoteCommand(sshClient, sshClient.shell.ignoreErrors(sshClient.shell.command("docker", "port", params.containerName)))
+		if err == nil && strings.Contains(published, ":"+port) {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Port %s is held by %s, which will be replaced", port, params.containerName), "validate_credentials", intPtr(stepValidateCredentials))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("port %s is already in use on the target", port)
+}
+
+// checkCrontabAvailable verifies the SSH user can install cron jobs and run the docker CLI they
+// use, whatever the Docker backend of the worker
+func (w *Worker) checkCrontabAvailable(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, _ credentialCheck) error {
+	if output, err := runRemoteCommand(sshClient, "command -v crontab"); err != nil {
+		return fmt.Errorf("crontab is not available on the target, install cron to run cron deployments: %v, output: %s", err, output)
+	}
+	if output, err := runRemoteCommand(sshClient, "command -v docker"); err != nil {
+		return fmt.Errorf("the docker CLI is not available on the target, cron jobs run their container with it: %v, output: %s", err, output)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "crontab available", "validate_credentials", intPtr(stepValidateCredentials))
+	return nil
+}
+
+// checkGPUsAvailable verifies the target has the requested GPUs and the NVIDIA Container Toolkit
+// docker needs to pass them to containers
+func (w *Worker) checkGPUsAvailable(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params credentialCheck) error {
+	output, err := runRemoteCommand(sshClient, sshClient.shell.command("nvidia-smi", "-L"))
+	if err != nil {
+		return fmt.Errorf("nvidia-smi failed on the target, install the NVIDIA driver to use gpus: %v, output: %s", err, output)
+	}
+
+	// nvidia-smi -L lists lines such as "GPU 0: NVIDIA A10 (UUID: GPU-8f3c...)"
+	for _, device := range models.GPUDevices(params.gpus) {
+		if !strings.Contains(output, "GPU "+device+":") && !strings.Contains(output, "UUID: "+device+")") {
+			return fmt.Errorf("GPU %s does not exist on the target; it has:\n%s", device, output)
+		}
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("GPUs available:\n%s", output), "validate_credentials", intPtr(stepValidateCredentials))
+
+	toolkit, err := runRemoteCommand(sshClient, sshClient.shell.command("nvidia-container-cli", "--version"))
+	if err != nil {
+		var ctkErr error
+		if toolkit, ctkErr = runRemoteCommand(sshClient, sshClient.shell.command("nvidia-ctk", "--version")); ctkErr != nil {
+			return fmt.Errorf("the NVIDIA Container Toolkit is not installed on the target, docker cannot pass GPUs to containers without it: %v", err)
+		}
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("NVIDIA Container Toolkit available: %s", strings.SplitN(toolkit, "\n", 2)[0]), "validate_credentials", intPtr(stepValidateCredentials))
+	return nil
+}
+
+// runRemoteCommand runs a command on the target and returns its trimmed combined output, retrying
+// sessions that fail for a transient reason. A cancelled deployment closes the connection, which
+// ends the retries.
+func runRemoteCommand(sshClient *targetConn, cmd string) (string, error) {
+	output, err := sshClient.Run(context.Background(), cmd)
+	return strings.TrimSpace(string(output)), err
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+)
+
+// How much history a cron job keeps on its target; the server collects runs long before either
+// limit is reached
+const (
+	cronJobKeptOutputs = 100
+	cronJobKeptRuns    = 1000
+)
+
+// cronJobPath is the PATH the wrapper script runs with; cron starts jobs with a minimal one that
+// may not include docker
+const cronJobPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// cronDeployment holds the parameters of a cron deployment job
+type cronDeployment struct {
+	repoURL       string
+	pat           string
+	branch        string
+	checkout      repoCheckout
+	envFilePath   string
+	envVars       string
+	containerName string
+	schedule      string
+	metadata      deploymentMetadata
+}
+
+// validateCronSchedule checks the schedule of a cron deployment job before it reaches the crontab
+// of the target, where a line break would add an entry of its own
+func validateCronSchedule(schedule string) error {
+	if schedule == "" {
+		return fmt.Errorf("cron_schedule is required for cron deployments")
+	}
+	if strings.ContainsAny(schedule, "\r\n%") {
+		return fmt.Errorf("invalid cron_schedule")
+	}
+	if _, err := models.ParseCron(schedule); err != nil {
+		return fmt.Errorf("invalid cron_schedule: %w", err)
+	}
+	return nil
+}
+
+// executeCronDeploymentSteps builds the image of a cron deployment like a docker deployment does,
+// then installs the crontab entry that runs it as a one-shot container on schedule
+func (w *Worker) executeCronDeploymentSteps(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params cronDeployment) error {
+	if params.containerName == "" {
+		params.containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name: %s", params.containerName), "docker_build", intPtr(stepDockerBuild))
+	}
+
+	resolveSettings := w.lazyAppSettings(ctx, deploymentID, sshClient, params.checkout.appDir(), params.envFilePath, params.envVars, 0, params.metadata)
+
+	return w.runPipeline(ctx, deploymentID, map[string]func() error{
+		"git_clone": func() error {
+			if err := w.cloneRepository(ctx, deploymentID, sshClient, params.repoURL, params.pat, params.branch, params.checkout); err != nil {
+				return fmt.Errorf("failed to clone repository: %w", err)
+			}
+			return nil
+		},
+		"docker_build": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			if err := w.runHooks(ctx, deploymentID, sshClient, settings.appDir, "pre_build", settings.hooks.PreBuild, stepDockerBuild); err != nil {
+				return err
+			}
+			if err := w.buildDockerImage(ctx, deploymentID, sshClient, params.containerName, settings.appDir, settings.dockerfile); err != nil {
+				return fmt.Errorf("failed to build Docker image: %w", err)
+			}
+			return nil
+		},
+		"install_cron": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.installCronJob(ctx, deploymentID, sshClient, params, settings)
+		},
+	}, 0)
+}
+
+// installCronJob writes the wrapper script and environment of the job to its directory on the
+// target and points its crontab entry at the script, replacing the entry of an earlier deployment
+// of the same container
+func (w *Worker) installCronJob(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params cronDeployment, settings *appSettings) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepInstallCron, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+	fail := func(errorMsg string) error {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "install_cron", intPtr(stepInstallCron))
+		w.updateDeploymentStep(ctx, deploymentID, stepInstallCron, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	env := settings.envVars
+	if settings.envFilePath != "" {
+		data, err := os.ReadFile(settings.envFilePath)
+		if err != nil {
+			return fail(fmt.Sprintf("Failed to read env file: %v", err))
+		}
+		env = string(data)
+	}
+
+	home, err := runRemoteCommand(sshClient, `printf '%s' "$HOME"`)
+	if err != nil || !path.IsAbs(home) {
+		return fail(fmt.Sprintf("Failed to find the home directory of the SSH user: %v, output: %s", err, home))
+	}
+	dir := path.Join(home, models.CronJobDir, params.containerName)
+	if output, err := runRemoteCommand(sshClient, shellquote.Join("mkdir", "-p", path.Join(dir, models.CronJobOutputDir))); err != nil {
+		return fail(fmt.Sprintf("Failed to create the job directory %s: %v, output: %s", dir, err, output))
+	}
+	if err := sshClient.CopyFile(ctx, path.Join(dir, models.CronJobEnvFile), strings.NewReader(env+"\n"), 0600); err != nil {
+		return fail(fmt.Sprintf("Failed to upload the job environment: %v", err))
+	}
+	script := cronJobScript(deploymentID, dir, params.containerName, params.schedule)
+	if err := sshClient.CopyFile(ctx, path.Join(dir, models.CronJobScript), strings.NewReader(script), 0700); err != nil {
+		return fail(fmt.Sprintf("Failed to upload the job script: %v", err))
+	}
+
+	entry := params.schedule + " " + shellquote.Quote(path.Join(dir, models.CronJobScript)) + " " + models.CronJobMarker(params.containerName)
+	if output, err := runRemoteCommand(sshClient, cronInstallCommand(params.containerName, entry)); err != nil {
+		return fail(fmt.Sprintf("Failed to install the crontab entry: %v, output: %s", err, output))
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Installed crontab entry: %s", entry), "install_cron", intPtr(stepInstallCron))
+	w.recordStepOutput(ctx, deploymentID, stepInstallCron, map[string]interface{}{
+		"schedule": params.schedule,
+		"image":    params.containerName + ":latest",
+		"job_dir":  dir,
+	})
+
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepInstallCron, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+	return nil
+}
+
+// cronJobScript is the wrapper the crontab entry of a job runs. It runs the image as a one-shot
+// container, keeps its output and appends the run to the run log, which the server collects the
+// history of the job from. A run still in progress makes the next one skip rather than overlap it.
+func cronJobScript(deploymentID uuid.UUID, dir, name, schedule string) string {
+	lines := []string{
+		"#!/bin/sh",
+		fmt.Sprintf("# Installed by DeployKnot deployment %s: runs %s:latest on %q", deploymentID, name, schedule),
+		"PATH=" + cronJobPath,
+		"export PATH",
+		"cd " + shellquote.Quote(dir) + " || exit 1",
+		"if command -v flock >/dev/null 2>&1; then",
+		"\texec 9>lock",
+		"\tflock -n 9 || exit 0",
+		"fi",
+		"mkdir -p " + models.CronJobOutputDir,
+		"start=$(date +%s)",
+		shellquote.Join("docker", "run", "--rm", "--env-file", models.CronJobEnvFile, "--label", "deployknot.cron="+name, name+":latest") +
+			` >"` + models.CronJobOutputDir + `/$start.log" 2>&1`,
+		"code=$?",
+		"end=$(date +%s)",
+		fmt.Sprintf(`echo "%s $start $end $code" >>%s`, deploymentID, models.CronJobRunLog),
+		fmt.Sprintf(`ls -1t %s | tail -n +%d | while read -r f; do rm -f "%s/$f"; done`, models.CronJobOutputDir, cronJobKeptOutputs+1, models.CronJobOutputDir),
+		fmt.Sprintf(`if [ "$(wc -l <%[1]s)" -gt %[2]d ]; then tail -n %[2]d %[1]s >%[1]s.tmp && mv %[1]s.tmp %[1]s; fi`, models.CronJobRunLog, cronJobKeptRuns),
+		"exit $code",
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// cronInstallCommand replaces the crontab entry of the job name with entry, keeping the others
+func cronInstallCommand(name, entry string) string {
+	return "{ " + models.CronJobOtherEntries(name) + "; echo " + shellquote.Quote(entry) + "; } | crontab -"
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// waitForDependencies waits for the containers the deployment's container depends on to be ready
+// before it starts, so a service never starts ahead of its database or cache. A dependency that is
+// missing, stopped or unhealthy fails the docker_run step right away; one that is still starting
+// is waited for up to the dependency timeout.
+func (w *Worker) waitForDependencies(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, dependencies []models.ContainerDependency, readState func(container string) containerStateReader) error {
+	fail := func(errorMsg string) error {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "dependencies", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	timeout := w.workerConfig.DependencyTimeout
+	for _, dependency := range dependencies {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Waiting up to %s for dependency %s to be %s", timeout, dependency.Container, dependency.Condition), "dependencies", intPtr(stepDockerRun))
+
+		started := time.Now()
+		deadline := started.Add(timeout)
+		for {
+			ready, retry, reason := dependencyReady(sshClient, dependency, readState(dependency.Container))
+			if ready {
+				w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Dependency %s is %s after %s", dependency.Container, dependency.Condition, time.Since(started).Round(time.Second)), "dependencies", intPtr(stepDockerRun))
+				break
+			}
+			if !retry {
+				return fail(fmt.Sprintf("Dependency error: %s is not %s: %s", dependency.Container, dependency.Condition, reason))
+			}
+			if time.Now().After(deadline) {
+				return fail(fmt.Sprintf("Dependency error: %s was not %s within %s: %s", dependency.Container, dependency.Condition, timeout, reason))
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(healthyPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// dependencyReady reports whether a dependency is ready and, when it is not, whether it may still
+// become ready and why it is not
+func dependencyReady(sshClient *targetConn, dependency models.ContainerDependency, readState containerStateReader) (bool, bool, string) {
+	state, err := readState()
+	if err != nil {
+		return false, false, fmt.Sprintf("failed to inspect the container: %v", err)
+	}
+	switch {
+	case state.Restarting:
+		return false, true, "the container is restarting"
+	case !state.Running:
+		return false, false, fmt.Sprintf("the container is %s (exit code %d)", state.Status, state.ExitCode)
+	}
+
+	if dependency.Condition == models.DependencyPortOpen {
+		output, err := runRemoteCommand(sshClient, sshClient.shell.tcpConnect("127.0.0.1", dependency.Port))
+		if err != nil {
+			return false, true, fmt.Sprintf("port %d does not accept connections: %s", dependency.Port, output)
+		}
+		return true, false, ""
+	}
+
+	if state.Health == nil {
+		return true, false, ""
+	}
+	switch state.Health.Status {
+	case "healthy":
+		return true, false, ""
+	case "unhealthy":
+		return false, false, fmt.Sprintf("the container is unhealthy%s", lastHealthOutput(state.Health))
+	}
+	return false, true, fmt.Sprintf("its health is %s%s", state.Health.Status, lastHealthOutput(state.Health))
+}
@@ -0,0 +1,331 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"deployknot/internal/app"
+	"deployknot/internal/config"
+	"deployknot/internal/faketarget"
+	"deployknot/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestMain(m *testing.M) { faketarget.Main(m) }
+
+const (
+	testPAT  = "ghp_faketargetpat0123456789"
+	testPort = "39871"
+)
+
+// testDockerfile builds the fake repository's app
+const testDockerfile = "FROM alpine:3.20\nCOPY . /app\nCMD [\"/app/run\"]\n"
+
+// deploymentHarness runs deployments through a worker against a fake target
+type deploymentHarness struct {
+	app    *app.App
+	worker *Worker
+	target *faketarget.Target
+}
+
+// newDeploymentHarness starts a fake target and a worker with an SQLite database, an embedded
+// Redis and an in-memory queue, which connects to the fake target for every deployment
+func newDeploymentHarness(t *testing.T, opts faketarget.Options) *deploymentHarness {
+	t.Helper()
+	for key, value := range map[string]string{
+		"DB_DRIVER":                    "sqlite",
+		"SQLITE_PATH":                  filepath.Join(t.TempDir(), "deployknot.db"),
+		"REDIS_EMBEDDED":               "true",
+		"QUEUE_BACKEND":                "memory",
+		"SERVER_WITH_WORKER":           "true",
+		"JWT_SECRET":                   "worker-test-jwt-secret-0123456789abcdef",
+		"ENCRYPTION_KEY":               "0123456789abcdef0123456789abcdef",
+		"WORKER_SSH_RETRY_ATTEMPTS":    "3",
+		"WORKER_SSH_RETRY_BACKOFF":     "10ms",
+		"WORKER_SSH_RETRY_MAX_BACKOFF": "50ms",
+	} {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	application, err := app.New(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(application.Close)
+	if err := application.Migrate("../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.Files == nil {
+		opts.Files = map[string]string{"Dockerfile": testDockerfile, "run": "#!/bin/sh\n"}
+	}
+	if opts.PAT == "" {
+		opts.PAT = testPAT
+	}
+	target, err := faketarget.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { target.Close() })
+
+	worker := NewWorker(application.QueueService, application.DeploymentService, application.ArtifactService, application.SSHCAService, application.SSHTargetLimiter, application.CommandTemplateService, application.Encryptor, cfg.Worker, logger)
+	worker.sandbox, err = newLocalSandbox(cfg.Worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker.dialTarget = func(ctx context.Context, host string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		return ssh.Dial("tcp", target.Addr(), config)
+	}
+	return &deploymentHarness{app: application, worker: worker, target: target}
+}
+
+// deployment is the outcome of a deployment the harness ran
+type deployment struct {
+	*models.DeploymentResponse
+	steps map[string]*models.DeploymentStep
+	logs  []*models.DeploymentLog
+}
+
+// deploy creates a deployment of the fake repository with pat and runs its job
+func (h *deploymentHarness) deploy(t *testing.T, pat string) *deployment {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	containerName := "my-app"
+	created, err := h.app.DeploymentService.CreateDeployment(ctx, &models.CreateDeploymentRequest{
+		TargetIP:      "127.0.0.1",
+		SSHUsername:   h.target.User,
+		SSHPassword:   h.target.Password,
+		GitHubRepoURL: "https://github.com/owner/repo",
+		GitHubPAT:     pat,
+		GitHubBranch:  "main",
+		Port:          testPort,
+		ContainerName: &containerName,
+	})
+	if err != nil {
+		t.Fatalf("failed to create deployment: %v", err)
+	}
+	job, err := h.app.QueueService.DequeueJob(ctx, "")
+	if err != nil || job == nil {
+		t.Fatalf("failed to dequeue the deployment job: %v", err)
+	}
+	if job.DeploymentID != created.ID {
+		t.Fatalf("dequeued the job of deployment %s, want %s", job.DeploymentID, created.ID)
+	}
+	// Like consume, hold the deployment lock the outcome is only recorded under
+	if acquired, err := h.app.QueueService.AcquireDeploymentLock(ctx, job.DeploymentID, h.worker.id, time.Minute); err != nil || !acquired {
+		t.Fatalf("failed to acquire the deployment lock: %v", err)
+	}
+	// The job's error repeats the deployment's, which the tests check
+	h.worker.processDeploymentJob(ctx, job)
+	h.app.QueueService.ReleaseDeploymentLock(ctx, job.DeploymentID, h.worker.id)
+
+	result := &deployment{steps: map[string]*models.DeploymentStep{}}
+	if result.DeploymentResponse, err = h.app.DeploymentService.GetDeployment(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	steps, err := h.app.DeploymentService.GetDeploymentSteps(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range steps {
+		result.steps[step.StepName] = step
+	}
+	if result.logs, err = h.app.DB.Repository.GetDeploymentLogs(created.ID, 0, 10000, models.DeploymentLogFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// requireStatus fails the test unless the deployment ended with status, printing its logs
+func (d *deployment) requireStatus(t *testing.T, status models.DeploymentStatus) {
+	t.Helper()
+	if d.Status == status {
+		return
+	}
+	for _, entry := range d.logs {
+		t.Logf("[%s] %s", entry.LogLevel, entry.Message)
+	}
+	message := ""
+	if d.ErrorMessage != nil {
+		message = *d.ErrorMessage
+	}
+	t.Fatalf("deployment ended %s (%s), want %s", d.Status, message, status)
+}
+
+// stepStatus returns the status of a step of the deployment
+func (d *deployment) stepStatus(name string) models.DeploymentStatus {
+	if step, ok := d.steps[name]; ok {
+		return step.Status
+	}
+	return ""
+}
+
+// requireNoSecrets fails the test when the PAT or SSH password reached the deployment's logs or
+// error
+func (d *deployment) requireNoSecrets(t *testing.T, secrets ...string) {
+	t.Helper()
+	texts := []string{}
+	if d.ErrorMessage != nil {
+		texts = append(texts, *d.ErrorMessage)
+	}
+	for _, entry := range d.logs {
+		texts = append(texts, entry.Message)
+	}
+	for _, step := range d.steps {
+		if step.ErrorMessage != nil {
+			texts = append(texts, *step.ErrorMessage)
+		}
+	}
+	for _, text := range texts {
+		for _, secret := range secrets {
+			if strings.Contains(text, secret) {
+				t.Fatalf("%q contains a secret of the deployment", text)
+			}
+		}
+	}
+}
+
+// countCommands returns how many commands run on the target contain substr
+func countCommands(target *faketarget.Target, substr string) int {
+	n := 0
+	for _, cmd := range target.Commands() {
+		if strings.Contains(cmd, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDeploymentSucceeds(t *testing.T) {
+	h := newDeploymentHarness(t, faketarget.Options{})
+	d := h.deploy(t, testPAT)
+	d.requireStatus(t, models.DeploymentStatusCompleted)
+	d.requireNoSecrets(t, testPAT, h.target.Password)
+
+	for _, name := range []string{"validate_credentials", "git_clone", "docker_build", "docker_run", "health_check"} {
+		if status := d.stepStatus(name); status != models.DeploymentStatusCompleted {
+			t.Errorf("step %s is %s, want completed", name, status)
+		}
+	}
+	if commit := d.steps["git_clone"].Output["commit_sha"]; commit == nil || len(commit.(string)) != 40 {
+		t.Errorf("git_clone output commit_sha = %v, want the commit of main", commit)
+	}
+
+	containers, err := h.target.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name != "my-app" || !containers[0].Running || containers[0].Image != "my-app:latest" {
+		t.Fatalf("containers on the target = %+v, want my-app running my-app:latest", containers)
+	}
+	if !slices.Contains(containers[0].Ports, testPort+":"+testPort) {
+		t.Errorf("my-app publishes %v, want %s:%s", containers[0].Ports, testPort, testPort)
+	}
+
+	images, err := h.target.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := slices.ContainsFunc(images, func(image faketarget.Image) bool {
+		return slices.Contains(image.Tags, "my-app:latest") && image.Dockerfile == testDockerfile
+	})
+	if !built {
+		t.Errorf("images on the target = %+v, want my-app:latest built from the repository's Dockerfile", images)
+	}
+
+	// Redeploying replaces the container
+	d = h.deploy(t, testPAT)
+	d.requireStatus(t, models.DeploymentStatusCompleted)
+	if containers, _ = h.target.Containers(); len(containers) != 1 {
+		t.Fatalf("containers after redeploying = %+v, want one", containers)
+	}
+}
+
+func TestDeploymentFailsBuild(t *testing.T) {
+	h := newDeploymentHarness(t, faketarget.Options{Files: map[string]string{
+		"Dockerfile": "FROM alpine:3.20\nRUN false\n",
+	}})
+	d := h.deploy(t, testPAT)
+	d.requireStatus(t, models.DeploymentStatusFailed)
+
+	if status := d.stepStatus("docker_build"); status != models.DeploymentStatusFailed {
+		t.Errorf("docker_build is %s, want failed", status)
+	}
+	if status := d.stepStatus("docker_run"); status == models.DeploymentStatusCompleted {
+		t.Error("docker_run completed after the build failed")
+	}
+	if containers, _ := h.target.Containers(); len(containers) != 0 {
+		t.Errorf("containers on the target = %+v, want none", containers)
+	}
+}
+
+func TestDeploymentRejectsBadPAT(t *testing.T) {
+	h := newDeploymentHarness(t, faketarget.Options{})
+	const wrongPAT = "ghp_wrongpat0123456789"
+	d := h.deploy(t, wrongPAT)
+	d.requireStatus(t, models.DeploymentStatusFailed)
+	d.requireNoSecrets(t, wrongPAT, h.target.Password)
+
+	if status := d.stepStatus("validate_credentials"); status != models.DeploymentStatusFailed {
+		t.Errorf("validate_credentials is %s, want failed", status)
+	}
+	if d.ErrorMessage == nil || !strings.Contains(*d.ErrorMessage, "Authentication failed") {
+		t.Errorf("error = %v, want git's authentication failure", d.ErrorMessage)
+	}
+	if n := countCommands(h.target, "'git' 'clone'"); n != 0 {
+		t.Errorf("the repository was cloned %d times with a rejected PAT", n)
+	}
+}
+
+func TestDeploymentRetriesRefusedSessions(t *testing.T) {
+	h := newDeploymentHarness(t, faketarget.Options{})
+	// Fewer refusals than WORKER_SSH_RETRY_ATTEMPTS for the first command
+	h.target.RefuseSessions(2)
+	d := h.deploy(t, testPAT)
+	d.requireStatus(t, models.DeploymentStatusCompleted)
+}
+
+func TestDeploymentFailsWhenRetriesRunOut(t *testing.T) {
+	h := newDeploymentHarness(t, faketarget.Options{})
+	h.target.RefuseSessions(1000)
+	d := h.deploy(t, testPAT)
+	d.requireStatus(t, models.DeploymentStatusFailed)
+
+	if status := d.stepStatus("validate_credentials"); status != models.DeploymentStatusFailed {
+		t.Errorf("validate_credentials is %s, want failed", status)
+	}
+	if len(h.target.Commands()) != 0 {
+		t.Errorf("ran %q on a target refusing every session", h.target.Commands())
+	}
+}
+
+func TestDeploymentRetriesCommandsWithoutExitStatus(t *testing.T) {
+	h := newDeploymentHarness(t, faketarget.Options{})
+	// The first command, the shell probe, ends without its exit status and runs again
+	h.target.DropExitStatus(1)
+	d := h.deploy(t, testPAT)
+	d.requireStatus(t, models.DeploymentStatusCompleted)
+
+	commands := h.target.Commands()
+	if len(commands) < 2 || commands[0] != commands[1] {
+		t.Fatalf("commands start with %q, want the first one run twice", commands[:min(2, len(commands))])
+	}
+}
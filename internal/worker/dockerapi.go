@@ -0,0 +1,386 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"deployknot/internal/dockerapi"
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+)
+
+// executeDockerAPIDeploymentSteps executes the deployment steps against the target's Docker Engine API
+// tunnelled over SSH instead of running docker CLI commands through the shell
+func (w *Worker) executeDockerAPIDeploymentSteps(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, repoURL, pat, branch string, checkout repoCheckout, envFilePath, envVars string, port int, containerName string, options containerOptions, metadata deploymentMetadata, resumeFrom int) error {
+	// Ensure we have a valid container name
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name: %s", containerName), "docker_build", intPtr(stepDockerBuild))
+	}
+
+	docker := w.newDockerAPIClient(sshClient)
+	defer docker.Close()
+
+	// A resumed deployment skips the steps whose results are still on the target
+	resumeFrom = w.resumePoint(ctx, deploymentID, resumeFrom, dockerAPIResumeRequirements(ctx, sshClient, docker, checkout.appDir(), containerName))
+
+	// Merge the repository's deployknot.yaml with the request parameters once the clone is there
+	resolveSettings := w.lazyAppSettings(ctx, deploymentID, sshClient, checkout.appDir(), envFilePath, envVars, port, metadata)
+
+	images := baseImageStore{
+		present: func(ref string) error { return docker.InspectImage(ctx, ref) },
+		pull:    func(ref string) error { return docker.PullImage(ctx, ref) },
+	}
+
+	runContainer := func() error {
+		settings, err := resolveSettings()
+		if err != nil {
+			return err
+		}
+		readState := func(container string) containerStateReader {
+			return func() (*dockerapi.ContainerState, error) {
+				info, err := docker.InspectContainer(ctx, container)
+				if err != nil {
+					return nil, err
+				}
+				return &info.State, nil
+			}
+		}
+		if err := w.waitForDependencies(ctx, deploymentID, sshClient, options.dependencies, readState); err != nil {
+			return err
+		}
+		if err := w.runDockerContainerAPI(ctx, deploymentID, docker, settings.envFilePath, settings.envVars, settings.port, containerName, options); err != nil {
+			return fmt.Errorf("failed to run Docker container: %w", err)
+		}
+		return nil
+	}
+	rollback := apiImageRollback(ctx, docker, containerName, runContainer)
+
+	return w.runPipeline(ctx, deploymentID, map[string]func() error{
+		"git_clone": func() error {
+			if err := w.cloneRepository(ctx, deploymentID, sshClient, repoURL, pat, branch, checkout); err != nil {
+				return fmt.Errorf("failed to clone repository: %w", err)
+			}
+			return nil
+		},
+		"secret_scan": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.scanSecrets(ctx, deploymentID, sshClient, settings)
+		},
+		"pull_base_images": func() error {
+			return w.pullBaseImages(ctx, deploymentID, sshClient, repoURL, pat, branch, checkout, images)
+		},
+		"docker_build": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			if err := w.runHooks(ctx, deploymentID, sshClient, settings.appDir, "pre_build", settings.hooks.PreBuild, stepDockerBuild); err != nil {
+				return err
+			}
+			w.preservePreviousImage(ctx, deploymentID, settings, containerName, rollback)
+			if err := w.buildDockerImageAPI(ctx, deploymentID, sshClient, docker, containerName, settings.appDir, settings.dockerfile); err != nil {
+				return fmt.Errorf("failed to build Docker image: %w", err)
+			}
+			return nil
+		},
+		"docker_run": runContainer,
+		"health_check": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			if err := w.healthCheckAPI(ctx, deploymentID, sshClient, docker, containerName, settings.port, settings.healthCheckPath); err != nil {
+				return fmt.Errorf("health check failed: %w", err)
+			}
+			return w.runHooks(ctx, deploymentID, sshClient, settings.appDir, "post_deploy", settings.hooks.PostDeploy, stepHealthCheck)
+		},
+		"smoke_tests": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.runSmokeTests(ctx, deploymentID, sshClient, settings, rollback)
+		},
+		"latency_check": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.runLatencyCheck(ctx, deploymentID, sshClient, settings, rollback)
+		},
+	}, resumeFrom)
+}
+
+// newDockerAPIClient creates a Docker Engine API client dialing the target's Docker socket through SSH
+func (w *Worker) newDockerAPIClient(sshClient *targetConn) *dockerapi.Client {
+	socket := w.workerConfig.DockerSocket
+	return dockerapi.NewClient(func(ctx context.Context) (net.Conn, error) {
+		return sshClient.dial("unix", socket)
+	})
+}
+
+// buildDockerImageAPI builds the image by streaming the cloned repository to the Docker Engine API
+func (w *Worker) buildDockerImageAPI(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, docker *dockerapi.Client, containerName, appDir, dockerfile string) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Starting Docker build via Docker Engine API", "docker_build", intPtr(stepDockerBuild))
+
+	version, err := docker.Version(ctx)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Failed to reach Docker Engine API: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_build", intPtr(stepDockerBuild))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to reach docker engine api: %w", err)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Connected to Docker Engine %s (API %s, %s/%s)", version.Version, version.APIVersion, version.Os, version.Arch), "docker_build", intPtr(stepDockerBuild))
+
+	// Cleanup to ensure a fresh deployment
+	imageTag := containerName + ":latest"
+	if err := docker.RemoveContainer(ctx, containerName); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Remove existing container warning: %v", err), "docker_rm", intPtr(stepDockerBuild))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Existing container removed successfully", "docker_rm", intPtr(stepDockerBuild))
+	}
+	if err := docker.RemoveImage(ctx, imageTag); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Remove existing image warning: %v", err), "docker_rmi", intPtr(stepDockerBuild))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Existing image removed successfully", "docker_rmi", intPtr(stepDockerBuild))
+	}
+	if err := docker.PruneContainers(ctx); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Docker container prune warning: %v", err), "docker_prune", intPtr(stepDockerBuild))
+	}
+	if err := docker.PruneImages(ctx); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Docker image prune warning: %v", err), "docker_prune", intPtr(stepDockerBuild))
+	}
+
+	// Stream the build context as a tar archive straight from the target
+	buildContext, archive := io.Pipe()
+	var tarStderr bytes.Buffer
+	archiveCtx, stopArchive := context.WithCancel(ctx)
+	defer stopArchive()
+	archived := make(chan error, 1)
+	go func() {
+		err := sshClient.RunWithStream(archiveCtx, fmt.Sprintf("tar -C %s -cf - .", shellquote.Quote(appDir)), nil, archive, &tarStderr)
+		archive.CloseWithError(err)
+		archived <- err
+	}()
+
+	var output strings.Builder
+	var imageID string
+	buildErr := docker.BuildImage(ctx, imageTag, dockerfile, buildContext, func(msg dockerapi.BuildMessage) {
+		if msg.Aux != nil && msg.Aux.ID != "" {
+			imageID = msg.Aux.ID
+		}
+		if msg.Stream == "" {
+			return
+		}
+		output.WriteString(msg.Stream)
+		// Surface each Dockerfile instruction as a separate progress entry
+		if line := strings.TrimSpace(msg.Stream); strings.HasPrefix(line, "Step ") {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", line, "docker_build", intPtr(stepDockerBuild))
+		}
+	})
+	buildOutput := w.buildOutputForLog(ctx, deploymentID, output.String())
+	if buildErr != nil {
+		// The build may have stopped reading the archive before tar finished writing it
+		stopArchive()
+		buildContext.Close()
+		<-archived
+		errorMsg := fmt.Sprintf("Docker build failed: %v, output: %s", buildErr, buildOutput)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_build", intPtr(stepDockerBuild))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker build failed: %w", buildErr)
+	}
+
+	if archiveErr := <-archived; archiveErr != nil {
+		errorMsg := fmt.Sprintf("Failed to archive build context: %v, output: %s", archiveErr, tarStderr.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_build", intPtr(stepDockerBuild))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to archive build context: %w", archiveErr)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker image built successfully: %s", buildOutput), "docker_build", intPtr(stepDockerBuild))
+	stepOutput := map[string]interface{}{"image": imageTag}
+	if imageID != "" {
+		stepOutput["image_id"] = imageID
+	}
+	w.recordStepOutput(ctx, deploymentID, stepDockerBuild, stepOutput)
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// runDockerContainerAPI creates and starts the container through the Docker Engine API
+func (w *Worker) runDockerContainerAPI(ctx context.Context, deploymentID uuid.UUID, docker *dockerapi.Client, envFilePath, envVars string, port int, containerName string, options containerOptions) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Starting Docker container via Docker Engine API", "docker_run", intPtr(stepDockerRun))
+
+	env, err := w.containerEnvironment(envFilePath, envVars)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Failed to prepare container environment: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to prepare container environment: %w", err)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Passing %d environment variables to container", len(env)), "docker_run", intPtr(stepDockerRun))
+
+	containerConfig := dockerapi.ContainerConfig{
+		Image: containerName + ":latest",
+		Env:   env,
+		Port:  port,
+	}
+	if err := options.apply(&containerConfig); err != nil {
+		errorMsg := fmt.Sprintf("Failed to prepare container options: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to prepare container options: %w", err)
+	}
+	if containerConfig.Network != "" {
+		if err := docker.EnsureNetwork(ctx, containerConfig.Network); err != nil {
+			errorMsg := fmt.Sprintf("Failed to create network %s: %v", containerConfig.Network, err)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+			w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+			return fmt.Errorf("failed to create network: %w", err)
+		}
+	}
+	containerID, err := docker.CreateContainer(ctx, containerName, containerConfig)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Docker container create failed: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker container create failed: %w", err)
+	}
+
+	if err := docker.StartContainer(ctx, containerID); err != nil {
+		errorMsg := fmt.Sprintf("Docker container start failed: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker container start failed: %w", err)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker container started successfully: %s", containerID), "docker_run", intPtr(stepDockerRun))
+	w.recordStepOutput(ctx, deploymentID, stepDockerRun, map[string]interface{}{
+		"container_id":   containerID,
+		"container_name": containerName,
+	})
+
+	readState := func() (*dockerapi.ContainerState, error) {
+		info, err := docker.InspectContainer(ctx, containerID)
+		if err != nil {
+			return nil, err
+		}
+		return &info.State, nil
+	}
+	if err := w.waitForHealthy(ctx, deploymentID, containerName, readState); err != nil {
+		return err
+	}
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// healthCheckAPI verifies the container is running by inspecting it through the Docker Engine API;
+// with a health check path the application must also answer HTTP requests on it
+func (w *Worker) healthCheckAPI(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, docker *dockerapi.Client, containerName string, port int, healthCheckPath string) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Starting health check", "health_check", intPtr(stepHealthCheck))
+
+	info, err := docker.InspectContainer(ctx, containerName)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Health check failed: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "health_check", intPtr(stepHealthCheck))
+		w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("health check failed: %w", err)
+	}
+
+	if !info.State.Running {
+		errorMsg := fmt.Sprintf("Health check failed: container is %s (exit code %d) %s", info.State.Status, info.State.ExitCode, info.State.Error)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "health_check", intPtr(stepHealthCheck))
+		w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("container %s is not running: %s", containerName, info.State.Status)
+	}
+
+	healthOutput := map[string]interface{}{
+		"container_name":   containerName,
+		"container_id":     info.ID,
+		"container_status": info.State.Status,
+	}
+	if healthCheckPath != "" {
+		latency, err := w.checkHealthEndpoint(ctx, deploymentID, sshClient, port, healthCheckPath)
+		if err != nil {
+			errorMsg := fmt.Sprintf("Health check failed: %v", err)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "health_check", intPtr(stepHealthCheck))
+			w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusFailed, &errorMsg)
+			return err
+		}
+		healthOutput["health_check_path"] = healthCheckPath
+		healthOutput["latency_ms"] = latency.Milliseconds()
+	}
+
+	status := info.State.Status
+	if info.State.Health != nil {
+		status = fmt.Sprintf("%s (%s)", status, info.State.Health.Status)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Health check passed: %s %s", containerName, status), "health_check", intPtr(stepHealthCheck))
+	w.recordStepOutput(ctx, deploymentID, stepHealthCheck, healthOutput)
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// containerEnvironment builds the KEY=VALUE list passed to the container from the env file or inline variables
+func (w *Worker) containerEnvironment(envFilePath, envVars string) ([]string, error) {
+	// Uploaded env files take precedence over inline environment variables
+	content := envVars
+	if envFilePath != "" {
+		data, err := os.ReadFile(envFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env file: %w", err)
+		}
+		content = string(data)
+	}
+
+	var env []string
+	for _, v := range models.FromEnvFile(content) {
+		if models.ValidateEnvKey(v.Key) != nil {
+			w.logger.WithField("key", v.Key).Warn("Skipping invalid environment variable name")
+			continue
+		}
+		env = append(env, v.Key+"="+v.Value)
+	}
+	return env, nil
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// fakeRunner is a RemoteRunner that records what a step runs on its target and answers from
+// canned responses instead of SSH sessions
+type fakeRunner struct {
+	mu sync.Mutex
+	// commands are the commands run so far, in order
+	commands []string
+	// respond answers a command with its output and error; nil succeeds with no output
+	respond func(cmd string) (string, error)
+	// files are the files of the target by path
+	files map[string][]byte
+}
+
+func newFakeRunner(respond func(cmd string) (string, error)) *fakeRunner {
+	return &fakeRunner{respond: respond, files: map[string][]byte{}}
+}
+
+// conn returns a target connection for steps that reach the target through the runner
+func (f *fakeRunner) conn() *targetConn {
+	return &targetConn{RemoteRunner: f, shell: posixShell{}}
+}
+
+func (f *fakeRunner) run(cmd string) (string, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, cmd)
+	respond := f.respond
+	f.mu.Unlock()
+	if respond == nil {
+		return "", nil
+	}
+	return respond(cmd)
+}
+
+func (f *fakeRunner) Run(ctx context.Context, cmd string) ([]byte, error) {
+	output, err := f.run(cmd)
+	return []byte(output), err
+}
+
+func (f *fakeRunner) RunWithStream(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	output, err := f.run(cmd)
+	out := stdout
+	if err != nil {
+		out = stderr
+	}
+	if out != nil {
+		io.WriteString(out, output)
+	}
+	return err
+}
+
+func (f *fakeRunner) CopyFile(ctx context.Context, remotePath string, content io.Reader, mode os.FileMode) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[remotePath] = data
+	return nil
+}
+
+func (f *fakeRunner) ReadFile(ctx context.Context, remotePath string, limit int64) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.files[remotePath]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: remotePath, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data[:min(int64(len(data)), limit)]), nil
+}
+
+// ran returns the commands run so far
+func (f *fakeRunner) ran() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// exitError is the error of a command that exited with status
+func exitError(status int) error {
+	return fmt.Errorf("Process exited with status %d", status)
+}
+
+// hasPrefix reports whether cmd starts with the quoted program and arguments
+func hasPrefix(cmd string, args ...string) bool {
+	return strings.HasPrefix(cmd, posixShell{}.command(args...))
+}
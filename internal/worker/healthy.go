@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"deployknot/internal/dockerapi"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// healthyPollInterval is how often the health of a starting container is inspected
+const healthyPollInterval = 2 * time.Second
+
+// containerStateReader inspects the state of the deployment's container, through the docker CLI or
+// the Docker Engine API
+type containerStateReader func() (*dockerapi.ContainerState, error)
+
+// cliContainerState inspects a container through the docker CLI on the target
+func cliContainerState(sshClient *targetConn, containerName string) containerStateReader {
+	return func() (*dockerapi.ContainerState, error) {
+		output, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "inspect", "--format", "{{json .State}}", containerName))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, output)
+		}
+		var state dockerapi.ContainerState
+		if err := json.Unmarshal([]byte(output), &state); err != nil {
+			return nil, fmt.Errorf("failed to parse container state: %w", err)
+		}
+		return &state, nil
+	}
+}
+
+// waitForHealthy waits for a container whose image defines a HEALTHCHECK to report healthy, so
+// docker_run only completes once the application is up. Containers without a health check are
+// left alone. On failure the docker_run step is marked failed.
+func (w *Worker) waitForHealthy(ctx context.Context, deploymentID uuid.UUID, containerName string, readState containerStateReader) error {
+	fail := func(errorMsg string) error {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_health", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	state, err := readState()
+	if err != nil {
+		return fail(fmt.Sprintf("Failed to inspect container %s: %v", containerName, err))
+	}
+	if state.Health == nil {
+		return nil
+	}
+
+	timeout := w.workerConfig.HealthyTimeout
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Container %s defines a HEALTHCHECK, waiting up to %s for it to become healthy", containerName, timeout), "docker_health", intPtr(stepDockerRun))
+
+	started := time.Now()
+	deadline := started.Add(timeout)
+	for {
+		switch {
+		case !state.Running && !state.Restarting:
+			return fail(fmt.Sprintf("Container %s stopped before becoming healthy: %s (exit code %d)%s", containerName, state.Status, state.ExitCode, lastHealthOutput(state.Health)))
+		case state.Health.Status == "healthy":
+			elapsed := time.Since(started)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Container %s is healthy after %s", containerName, elapsed.Round(time.Second)), "docker_health", intPtr(stepDockerRun))
+			w.recordStepOutput(ctx, deploymentID, stepDockerRun, map[string]interface{}{
+				"health_status":    state.Health.Status,
+				"healthy_after_ms": elapsed.Milliseconds(),
+			})
+			return nil
+		case state.Health.Status == "unhealthy":
+			return fail(fmt.Sprintf("Container %s is unhealthy after %d failed health checks%s", containerName, state.Health.FailingStreak, lastHealthOutput(state.Health)))
+		case time.Now().After(deadline):
+			return fail(fmt.Sprintf("Container %s did not become healthy within %s, its health is %s%s", containerName, timeout, state.Health.Status, lastHealthOutput(state.Health)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(healthyPollInterval):
+		}
+
+		if state, err = readState(); err != nil {
+			return fail(fmt.Sprintf("Failed to inspect container %s: %v", containerName, err))
+		}
+		if state.Health == nil {
+			return fail(fmt.Sprintf("Container %s no longer reports its health", containerName))
+		}
+	}
+}
+
+// lastHealthOutput returns the output of the latest health check probe, for error messages
+func lastHealthOutput(health *dockerapi.ContainerHealth) string {
+	if health == nil || len(health.Log) == 0 {
+		return ""
+	}
+	probe := health.Log[len(health.Log)-1]
+	return fmt.Sprintf(", last health check exited with %d: %s", probe.ExitCode, strings.TrimSpace(probe.Output))
+}
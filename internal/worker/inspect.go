@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// saveContainerInspect keeps the docker inspect output of the deployment's container as its
+// container.json artifact, for the deployment's post-mortem bundle. The values of the container's
+// environment variables are redacted before it is stored. A container that was never created is
+// skipped, and failures are only logged since the deployment's outcome does not depend on them.
+func (w *Worker) saveContainerInspect(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, containerName string) {
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+	}
+	logger := w.logger.WithFields(logrus.Fields{
+		"deployment_id":  deploymentID,
+		"container_name": containerName,
+	})
+
+	var raw []byte
+	if w.workerConfig.DockerBackend == config.DockerBackendAPI {
+		docker := w.newDockerAPIClient(sshClient)
+		defer docker.Close()
+		inspect, err := docker.InspectContainerJSON(ctx, containerName)
+		if err != nil {
+			logger.WithError(err).Debug("Container not inspected")
+			return
+		}
+		raw = inspect
+	} else {
+		output, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "inspect", containerName))
+		if err != nil {
+			logger.WithError(err).Debug("Container not inspected")
+			return
+		}
+		raw = []byte(output)
+	}
+
+	content, err := models.RedactContainerInspect(raw)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read docker inspect output")
+		return
+	}
+	if _, err := w.artifactService.SaveArtifact(ctx, deploymentID, models.ContainerInspectArtifact, "application/json", content); err != nil {
+		logger.WithError(err).Warn("Failed to store the container inspect artifact")
+	}
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// envPlaceholderPattern matches a placeholder such as {{deployment.id}} in an env value
+var envPlaceholderPattern = regexp.MustCompile(`\{\{\s*([a-z_.]+)\s*\}\}`)
+
+// deploymentMetadata describes the deployment to the application it deploys. Env values reference it
+// through placeholders, so an application can report which deployment it runs as.
+type deploymentMetadata struct {
+	deploymentID uuid.UUID
+	projectName  string
+	// targetIP is empty for Kubernetes targets
+	targetIP string
+}
+
+// placeholders returns the value of each placeholder for an application listening on port
+func (m deploymentMetadata) placeholders(port int) map[string]string {
+	values := map[string]string{
+		"deployment.id": m.deploymentID.String(),
+		"project.name":  m.projectName,
+		"target.ip":     m.targetIP,
+		"port":          "",
+	}
+	if port > 0 {
+		values["port"] = strconv.Itoa(port)
+	}
+	return values
+}
+
+// interpolateEnv replaces the placeholders in the values of env file content. Comments, names and
+// unknown placeholders are left as they are.
+func (m deploymentMetadata) interpolateEnv(content string, port int) string {
+	if !strings.Contains(content, "{{") {
+		return content
+	}
+	values := m.placeholders(port)
+
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = envPlaceholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			name := envPlaceholderPattern.FindStringSubmatch(placeholder)[1]
+			if resolved, ok := values[name]; ok {
+				return resolved
+			}
+			return placeholder
+		})
+		lines[i] = key + "=" + value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveEnv interpolates the placeholders of the environment variables, read from the uploaded env
+// file when there is one. Variables with placeholders are returned inline with an empty env file
+// path, since the uploaded file is passed to the target as it is.
+func (m deploymentMetadata) resolveEnv(envFilePath, envVars string, port int) (string, string, error) {
+	content := envVars
+	if envFilePath != "" {
+		data, err := os.ReadFile(envFilePath)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read env file: %w", err)
+		}
+		content = string(data)
+	}
+
+	interpolated := m.interpolateEnv(content, port)
+	if interpolated == content {
+		return envFilePath, envVars, nil
+	}
+	return "", interpolated, nil
+}
@@ -0,0 +1,462 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/google/uuid"
+)
+
+// kubernetesRolloutTimeout bounds how long the worker waits for each Deployment rollout
+const kubernetesRolloutTimeout = "5m"
+
+// kubernetesDeployment holds the parameters of a deployment to a Kubernetes target
+type kubernetesDeployment struct {
+	kubeconfigPath string
+	namespace      string
+	name           string
+	image          string
+	port           int
+	repoURL        string
+	pat            string
+	branch         string
+	commit         string
+	manifestsPath  string
+	envFilePath    string
+	envVars        string
+	workDir        string
+	// homeDir is the directory inside workDir local commands run in and clone the repository to
+	homeDir string
+	// signaturePolicy and signingKeys are the project's image signature policy and cosign public keys
+	signaturePolicy models.ImageSignaturePolicy
+	signingKeys     []string
+	metadata        deploymentMetadata
+}
+
+// executeKubernetesDeployment applies the deployment to a Kubernetes cluster and tracks its rollout
+func (w *Worker) executeKubernetesDeployment(ctx context.Context, job *services.Job) error {
+	deploymentID := job.DeploymentID
+
+	params := kubernetesDeployment{
+		namespace:       getStringFromMap(job.Data, "kubernetes_namespace"),
+		name:            kubernetesName(getStringFromMap(job.Data, "container_name")),
+		image:           getStringFromMap(job.Data, "image"),
+		port:            getIntFromMap(job.Data, "port"),
+		repoURL:         getStringFromMap(job.Data, "github_repo_url"),
+		pat:             getStringFromMap(job.Data, "github_pat"),
+		branch:          getStringFromMap(job.Data, "github_branch"),
+		commit:          getStringFromMap(job.Data, "commit_sha"),
+		manifestsPath:   getStringFromMap(job.Data, "manifests_path"),
+		envFilePath:     getStringFromMap(job.Data, "env_file_path"),
+		envVars:         getStringFromMap(job.Data, "environment_vars"),
+		signaturePolicy: models.ImageSignaturePolicy(getStringFromMap(job.Data, "image_signature_policy")).OrDefault(),
+		signingKeys:     getStringsFromMap(job.Data, "image_signing_keys"),
+		metadata: deploymentMetadata{
+			deploymentID: deploymentID,
+			projectName:  getStringFromMap(job.Data, "project_name"),
+		},
+	}
+	if params.namespace == "" {
+		params.namespace = models.DefaultKubernetesNamespace
+	}
+
+	// Reject parameters that could be interpreted as git options
+	err := validateJobParameters(params.repoURL, params.pat, params.branch, "", "")
+	if err == nil && params.commit != "" {
+		err = models.ValidateCommitSHA(params.commit)
+	}
+	if err == nil && params.manifestsPath != "" {
+		err = models.ValidateManifestsPath(params.manifestsPath)
+	}
+	if err == nil && params.envFilePath != "" {
+		params.envFilePath, err = w.sandbox.localFile(params.envFilePath)
+	}
+	if err != nil {
+		errorMsg := fmt.Sprintf("invalid deployment parameters: %v", err)
+		w.markAllStepsAsFailed(ctx, deploymentID, errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	// git, kubectl and cosign run locally, including the image signature checks
+	if err := w.sandbox.checkIsolated(); err != nil {
+		errorMsg := fmt.Sprintf("Kubernetes deployments are disabled on this worker: %v", err)
+		w.markAllStepsAsFailed(ctx, deploymentID, errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	// The kubeconfig only ever leaves the database encrypted; decrypt it into a private work directory
+	workDir, homeDir, err := w.sandbox.workDir("deployknot-k8s-")
+	if err != nil {
+		w.markAllStepsAsFailed(ctx, deploymentID, "failed to create work directory")
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	params.workDir = workDir
+	params.homeDir = homeDir
+
+	kubeconfig, err := w.encryptor.Decrypt(getStringFromMap(job.Data, "kubeconfig_encrypted"))
+	if err != nil {
+		errorMsg := "Failed to decrypt kubeconfig"
+		w.markStepAsFailed(ctx, stepValidateCredentials, deploymentID, errorMsg)
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepValidateCredentials)
+		return fmt.Errorf("failed to decrypt kubeconfig: %w", err)
+	}
+	// Checked again here, since the job may come from a server that did not check it or be tampered with
+	if err := models.ValidateKubeconfig(kubeconfig); err != nil {
+		errorMsg := fmt.Sprintf("Invalid kubeconfig: %v", err)
+		w.markStepAsFailed(ctx, stepValidateCredentials, deploymentID, errorMsg)
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepValidateCredentials)
+		return fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+
+	params.kubeconfigPath = filepath.Join(workDir, "kubeconfig")
+	if err := w.sandbox.writeShared(params.kubeconfigPath, kubeconfig); err != nil {
+		errorMsg := "Failed to write kubeconfig"
+		w.markStepAsFailed(ctx, stepValidateCredentials, deploymentID, errorMsg)
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepValidateCredentials)
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+
+	// Step 1: Validate cluster access
+	if err := w.validateKubernetesAccess(ctx, deploymentID, params); err != nil {
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepValidateCredentials)
+		return fmt.Errorf("failed to validate cluster access: %w", err)
+	}
+
+	// Step 2: Clone the repository when manifests are taken from it
+	if err := w.cloneManifests(ctx, deploymentID, params); err != nil {
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepGitClone)
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	// Step 3: Apply manifests
+	deployments, err := w.applyKubernetesManifests(ctx, deploymentID, params)
+	if err != nil {
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepKubectlApply)
+		return fmt.Errorf("failed to apply manifests: %w", err)
+	}
+
+	// Step 4: Track the rollout
+	if err := w.waitForRollout(ctx, deploymentID, params, deployments); err != nil {
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepRolloutStatus)
+		return fmt.Errorf("rollout failed: %w", err)
+	}
+
+	return nil
+}
+
+// validateKubernetesAccess checks the cluster is reachable and the credentials may create Deployments
+func (w *Worker) validateKubernetesAccess(ctx context.Context, deploymentID uuid.UUID, params kubernetesDeployment) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepValidateCredentials, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Validating Kubernetes cluster access", "validate_credentials", intPtr(stepValidateCredentials))
+
+	output, err := w.runKubectl(ctx, params, "", "version", "--request-timeout=30s")
+	if err != nil {
+		errorMsg := fmt.Sprintf("Kubernetes cluster unreachable: %v, output: %s", err, output)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "validate_credentials", intPtr(stepValidateCredentials))
+		w.updateDeploymentStep(ctx, deploymentID, stepValidateCredentials, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("kubernetes cluster unreachable: %w, output: %s", err, output)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Kubernetes cluster reachable: %s", output), "validate_credentials", intPtr(stepValidateCredentials))
+
+	output, err = w.runKubectl(ctx, params, "", "auth", "can-i", "create", "deployments.apps", "--namespace", params.namespace)
+	if err != nil || strings.TrimSpace(output) != "yes" {
+		errorMsg := fmt.Sprintf("Credentials may not create deployments in namespace %s: %s", params.namespace, strings.TrimSpace(output))
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "validate_credentials", intPtr(stepValidateCredentials))
+		w.updateDeploymentStep(ctx, deploymentID, stepValidateCredentials, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("insufficient permissions in namespace %s", params.namespace)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Credentials may create deployments in namespace %s", params.namespace), "validate_credentials", intPtr(stepValidateCredentials))
+
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepValidateCredentials, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// cloneManifests clones the repository into the work directory when manifests_path is used
+func (w *Worker) cloneManifests(ctx context.Context, deploymentID uuid.UUID, params kubernetesDeployment) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	if params.manifestsPath == "" {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Skipping repository clone, deploying image %s", params.image), "git_clone", intPtr(stepGitClone))
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Starting repository clone", "git_clone", intPtr(stepGitClone))
+
+	cloneURL := fmt.Sprintf("https://%s@github.com/%s.git", params.pat, models.NormalizeRepoURL(params.repoURL))
+	repoDir := filepath.Join(params.homeDir, "repo")
+	outputBytes, err := w.sandbox.command(ctx, params.homeDir, "git", "clone", "--depth", "1", "--branch", params.branch, cloneURL, repoDir).CombinedOutput()
+	if err == nil && params.commit != "" {
+		// The shallow clone only has the head of the branch
+		var fetchOutput []byte
+		fetchOutput, err = w.sandbox.command(ctx, params.homeDir, "git", "-C", repoDir, "fetch", "--depth", "1", "origin", params.commit).CombinedOutput()
+		outputBytes = append(outputBytes, fetchOutput...)
+		if err == nil {
+			var checkoutOutput []byte
+			checkoutOutput, err = w.sandbox.command(ctx, params.homeDir, "git", "-C", repoDir, "checkout", "--detach", params.commit).CombinedOutput()
+			outputBytes = append(outputBytes, checkoutOutput...)
+		}
+	}
+	output := strings.ReplaceAll(string(outputBytes), params.pat, "***")
+	if err != nil {
+		errorMsg := fmt.Sprintf("Git clone failed: %v, output: %s", err, output)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "git_clone", intPtr(stepGitClone))
+		w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("git clone failed: %w, output: %s", err, output)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Repository cloned successfully: %s", output), "git_clone", intPtr(stepGitClone))
+
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// applyKubernetesManifests applies the generated or repository manifests and returns the applied Deployment names
+func (w *Worker) applyKubernetesManifests(ctx context.Context, deploymentID uuid.UUID, params kubernetesDeployment) ([]string, error) {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepKubectlApply, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	// The image is verified, and pinned to the verified digest, before anything is applied
+	image, err := w.verifyImageSignature(ctx, deploymentID, params)
+	if err != nil {
+		errorMsg := err.Error()
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "image_signature", intPtr(stepKubectlApply))
+		w.updateDeploymentStep(ctx, deploymentID, stepKubectlApply, models.DeploymentStatusFailed, &errorMsg)
+		return nil, err
+	}
+	params.image = image
+
+	var output string
+	if params.manifestsPath != "" {
+		manifestsDir := filepath.Join(params.homeDir, "repo", filepath.FromSlash(params.manifestsPath))
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Applying repository manifests from %s", params.manifestsPath), "kubectl_apply", intPtr(stepKubectlApply))
+		output, err = w.runKubectl(ctx, params, "", "apply", "--namespace", params.namespace, "--recursive", "--filename", manifestsDir, "--output", "name")
+	} else {
+		manifest, buildErr := w.buildKubernetesManifest(deploymentID, params)
+		if buildErr != nil {
+			errorMsg := fmt.Sprintf("Failed to generate manifests: %v", buildErr)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "kubectl_apply", intPtr(stepKubectlApply))
+			w.updateDeploymentStep(ctx, deploymentID, stepKubectlApply, models.DeploymentStatusFailed, &errorMsg)
+			return nil, fmt.Errorf("failed to generate manifests: %w", buildErr)
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Applying generated Deployment and Service %s for image %s", params.name, params.image), "kubectl_apply", intPtr(stepKubectlApply))
+		output, err = w.runKubectl(ctx, params, string(manifest), "apply", "--namespace", params.namespace, "--filename", "-", "--output", "name")
+	}
+
+	if err != nil {
+		errorMsg := fmt.Sprintf("kubectl apply failed: %v, output: %s", err, output)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "kubectl_apply", intPtr(stepKubectlApply))
+		w.updateDeploymentStep(ctx, deploymentID, stepKubectlApply, models.DeploymentStatusFailed, &errorMsg)
+		return nil, fmt.Errorf("kubectl apply failed: %w, output: %s", err, output)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Manifests applied successfully: %s", output), "kubectl_apply", intPtr(stepKubectlApply))
+
+	var deployments []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "deployment.apps/") {
+			deployments = append(deployments, strings.TrimPrefix(line, "deployment.apps/"))
+		}
+	}
+
+	w.recordStepOutput(ctx, deploymentID, stepKubectlApply, map[string]interface{}{
+		"namespace":   params.namespace,
+		"deployments": deployments,
+	})
+
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepKubectlApply, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return deployments, nil
+}
+
+// waitForRollout waits until every applied Deployment has finished rolling out
+func (w *Worker) waitForRollout(ctx context.Context, deploymentID uuid.UUID, params kubernetesDeployment, deployments []string) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepRolloutStatus, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	if len(deployments) == 0 {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", "No Deployments were applied, nothing to track", "rollout_status", intPtr(stepRolloutStatus))
+	}
+
+	for _, name := range deployments {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Waiting for rollout of deployment/%s", name), "rollout_status", intPtr(stepRolloutStatus))
+
+		output, err := w.runKubectl(ctx, params, "", "rollout", "status", "deployment/"+name, "--namespace", params.namespace, "--timeout", kubernetesRolloutTimeout)
+		if err != nil {
+			errorMsg := fmt.Sprintf("Rollout of deployment/%s failed: %v, output: %s", name, err, output)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "rollout_status", intPtr(stepRolloutStatus))
+			w.updateDeploymentStep(ctx, deploymentID, stepRolloutStatus, models.DeploymentStatusFailed, &errorMsg)
+			return fmt.Errorf("rollout of deployment/%s failed: %w, output: %s", name, err, output)
+		}
+
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Rollout complete: %s", output), "rollout_status", intPtr(stepRolloutStatus))
+	}
+
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepRolloutStatus, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// buildKubernetesManifest generates a Deployment and Service (plus a Secret for environment variables) as a JSON List
+func (w *Worker) buildKubernetesManifest(deploymentID uuid.UUID, params kubernetesDeployment) ([]byte, error) {
+	userEnv := params.envVars
+	if params.envFilePath != "" {
+		content, err := os.ReadFile(params.envFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env file: %w", err)
+		}
+		userEnv = string(content)
+	}
+	userEnv = params.metadata.interpolateEnv(userEnv, params.port)
+
+	labels := map[string]string{
+		"app.kubernetes.io/name":       params.name,
+		"app.kubernetes.io/managed-by": "deployknot",
+	}
+	annotations := map[string]string{
+		"deployknot.io/deployment-id": deploymentID.String(),
+	}
+
+	container := map[string]interface{}{
+		"name":  params.name,
+		"image": params.image,
+		"ports": []map[string]interface{}{
+			{"containerPort": params.port},
+		},
+	}
+
+	var items []interface{}
+
+	envVars := models.FromEnvFile(userEnv)
+	if len(envVars) > 0 {
+		secretName := params.name + "-env"
+		data := make(map[string]string, len(envVars))
+		for _, env := range envVars {
+			data[env.Key] = env.Value
+		}
+		items = append(items, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":        secretName,
+				"labels":      labels,
+				"annotations": annotations,
+			},
+			"type":       "Opaque",
+			"stringData": data,
+		})
+		container["envFrom"] = []map[string]interface{}{
+			{"secretRef": map[string]string{"name": secretName}},
+		}
+	}
+
+	items = append(items,
+		map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":        params.name,
+				"labels":      labels,
+				"annotations": annotations,
+			},
+			"spec": map[string]interface{}{
+				"replicas": 1,
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]string{"app.kubernetes.io/name": params.name},
+				},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"labels":      labels,
+						"annotations": annotations,
+					},
+					"spec": map[string]interface{}{
+						"containers": []interface{}{container},
+					},
+				},
+			},
+		},
+		map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata": map[string]interface{}{
+				"name":        params.name,
+				"labels":      labels,
+				"annotations": annotations,
+			},
+			"spec": map[string]interface{}{
+				"selector": map[string]string{"app.kubernetes.io/name": params.name},
+				"ports": []map[string]interface{}{
+					{"port": params.port, "targetPort": params.port},
+				},
+			},
+		},
+	)
+
+	return json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+	})
+}
+
+// runKubectl runs kubectl against the deployment's cluster and returns its combined output
+func (w *Worker) runKubectl(ctx context.Context, params kubernetesDeployment, stdin string, args ...string) (string, error) {
+	cmd := w.sandbox.command(ctx, params.homeDir, "kubectl", append([]string{"--kubeconfig", params.kubeconfigPath}, args...)...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// kubernetesName converts a container name into a valid Kubernetes resource name
+func kubernetesName(name string) string {
+	var result []rune
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			result = append(result, r)
+		} else {
+			result = append(result, '-')
+		}
+	}
+
+	sanitized := strings.Trim(string(result), "-")
+	if len(sanitized) > 63 {
+		sanitized = strings.Trim(sanitized[:63], "-")
+	}
+	if sanitized == "" {
+		sanitized = "deployknot-app"
+	}
+
+	return sanitized
+}
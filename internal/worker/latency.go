@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// latencyCheckInterval is the least time between two requests of the latency check
+const latencyCheckInterval = 250 * time.Millisecond
+
+// latencyStats summarizes the request latencies of a latency check
+type latencyStats struct {
+	p50, p95, max time.Duration
+}
+
+// runLatencyCheck requests the health endpoint one request after another for the configured
+// duration and fails the step when the 95th percentile of their latencies exceeds the threshold,
+// catching deployments that work but got slower. A failed request fails the check as well. When
+// rollback is enabled, a failure restores the previous image.
+func (w *Worker) runLatencyCheck(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, settings *appSettings, rollback imageRollback) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepLatencyCheck, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	check := settings.latencyCheck
+	if !check.Enabled() {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "No latency check defined in deployknot.yaml", "latency_check", intPtr(stepLatencyCheck))
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepLatencyCheck, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	path := check.Path
+	if path == "" {
+		path = settings.healthCheckPath
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", settings.port, path)
+	checkCmd := sshClient.shell.httpTime(url)
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Measuring the latency of %s for %s, the p95 must stay within %dms", path, check.Duration(), check.P95ThresholdMs), "latency_check", intPtr(stepLatencyCheck))
+
+	var latencies []time.Duration
+	failures := 0
+	var lastErr string
+	deadline := time.Now().Add(check.Duration())
+	for time.Now().Before(deadline) {
+		started := time.Now()
+		latency, output, err := requestLatency(sshClient, checkCmd)
+		if err != nil {
+			failures++
+			lastErr = fmt.Sprintf("%v, output: %s", err, output)
+		} else {
+			latencies = append(latencies, latency)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(latencyCheckInterval - time.Since(started)):
+		}
+	}
+
+	stats := summarizeLatencies(latencies)
+	output := map[string]interface{}{
+		"path":         path,
+		"requests":     len(latencies) + failures,
+		"failures":     failures,
+		"p50_ms":       stats.p50.Milliseconds(),
+		"p95_ms":       stats.p95.Milliseconds(),
+		"max_ms":       stats.max.Milliseconds(),
+		"threshold_ms": check.P95ThresholdMs,
+	}
+
+	var errorMsg string
+	switch {
+	case failures > 0:
+		errorMsg = fmt.Sprintf("%d of %d requests to %s failed during the latency check, last error: %s", failures, len(latencies)+failures, path, lastErr)
+	case len(latencies) == 0:
+		errorMsg = fmt.Sprintf("No request to %s completed during the latency check", path)
+	case stats.p95 > check.Threshold():
+		errorMsg = fmt.Sprintf("p95 latency of %s is %dms over %d requests, above the threshold of %dms", path, stats.p95.Milliseconds(), len(latencies), check.P95ThresholdMs)
+	}
+
+	if errorMsg == "" {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("p95 latency of %s is %dms over %d requests (p50 %dms, max %dms), within the threshold of %dms", path, stats.p95.Milliseconds(), len(latencies), stats.p50.Milliseconds(), stats.max.Milliseconds(), check.P95ThresholdMs), "latency_check", intPtr(stepLatencyCheck))
+		w.recordStepOutput(ctx, deploymentID, stepLatencyCheck, output)
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepLatencyCheck, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	if check.Rollback {
+		errorMsg += w.rollBack(ctx, deploymentID, stepLatencyCheck, rollback, output)
+	}
+	w.recordStepOutput(ctx, deploymentID, stepLatencyCheck, output)
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "latency_check", intPtr(stepLatencyCheck))
+	w.updateDeploymentStep(ctx, deploymentID, stepLatencyCheck, models.DeploymentStatusFailed, &errorMsg)
+	return fmt.Errorf("%s", errorMsg)
+}
+
+// summarizeLatencies returns the nearest-rank percentiles of the latencies
+func summarizeLatencies(latencies []time.Duration) latencyStats {
+	if len(latencies) == 0 {
+		return latencyStats{}
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(percentile int) time.Duration {
+		return sorted[(percentile*len(sorted)+99)/100-1]
+	}
+	return latencyStats{p50: rank(50), p95: rank(95), max: sorted[len(sorted)-1]}
+}
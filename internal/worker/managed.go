@@ -0,0 +1,293 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/dockerapi"
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Health check timing of managed service containers, the equivalents of docker run --health-*
+const (
+	managedHealthInterval    = 5 * time.Second
+	managedHealthTimeout     = 5 * time.Second
+	managedHealthStartPeriod = 10 * time.Second
+	managedHealthRetries     = 10
+)
+
+// managedServiceJob is the database container of a managed service deployment
+type managedServiceJob struct {
+	container     *models.ManagedContainer
+	containerName string
+	volume        string
+	// port is the port the database is published on on the target
+	port int
+	// env is the .env content the container is created with, its credentials among them
+	env string
+}
+
+// managedServiceFromJob reads the managed service of a deployment job. Its names reach the docker
+// command line on the target, so they are validated again rather than trusted.
+func managedServiceFromJob(data map[string]interface{}, containerName string, port int) (*managedServiceJob, error) {
+	container, err := models.ManagedContainerFor(models.ManagedEngine(getStringFromMap(data, "managed_engine")), getStringFromMap(data, "managed_version"))
+	if err != nil {
+		return nil, err
+	}
+	if err := models.ValidateContainerName(containerName); err != nil {
+		return nil, fmt.Errorf("invalid container name: %w", err)
+	}
+	volume := getStringFromMap(data, "managed_volume")
+	if err := models.ValidateContainerName(volume); err != nil {
+		return nil, fmt.Errorf("invalid volume: %w", err)
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("port must be between 1 and 65535")
+	}
+	return &managedServiceJob{
+		container:     container,
+		containerName: containerName,
+		volume:        volume,
+		port:          port,
+		env:           getStringFromMap(data, "environment_vars"),
+	}, nil
+}
+
+// withManagedEnv adds the connection variables of the managed services a deployment uses to its
+// environment variables, read from the uploaded env file when there is one. Variables the
+// deployment sets itself keep their value.
+func withManagedEnv(envFilePath, envVars, managedEnv string) (string, string, error) {
+	if managedEnv == "" {
+		return envFilePath, envVars, nil
+	}
+	content := envVars
+	if envFilePath != "" {
+		data, err := os.ReadFile(envFilePath)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read env file: %w", err)
+		}
+		content = string(data)
+	}
+
+	var defaults []string
+	for _, env := range models.FromEnvFile(managedEnv) {
+		defaults = append(defaults, env.Key+"="+env.Value)
+	}
+	merged := models.AddEnvDefaults(content, defaults)
+	if merged == content {
+		return envFilePath, envVars, nil
+	}
+	return "", merged, nil
+}
+
+// executeManagedServiceSteps runs the database of a managed service from its official image: the
+// image is pulled while the volume is created, then the container is replaced by one using the
+// volume, and docker_run completes once the database accepts connections
+func (w *Worker) executeManagedServiceSteps(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, service *managedServiceJob) error {
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Running managed service %s from %s with volume %s on port %d", service.containerName, service.container.Image, service.volume, service.port), "managed_service", nil)
+
+	if w.workerConfig.DockerBackend == config.DockerBackendAPI {
+		docker := w.newDockerAPIClient(sshClient)
+		defer docker.Close()
+
+		return w.runPipeline(ctx, deploymentID, map[string]func() error{
+			"pull_image": func() error {
+				return w.managedStep(ctx, deploymentID, stepPullImage, "pull_image", func() (string, error) {
+					return fmt.Sprintf("Pulled %s", service.container.Image), docker.PullImage(ctx, service.container.Image)
+				})
+			},
+			"create_volume": func() error {
+				return w.managedStep(ctx, deploymentID, stepCreateVolume, "create_volume", func() (string, error) {
+					return fmt.Sprintf("Volume %s is ready", service.volume), docker.CreateVolume(ctx, service.volume)
+				})
+			},
+			"docker_run": func() error {
+				return w.runManagedContainerAPI(ctx, deploymentID, docker, service)
+			},
+		}, 0)
+	}
+
+	shell := sshClient.shell
+	return w.runPipeline(ctx, deploymentID, map[string]func() error{
+		"pull_image": func() error {
+			return w.managedStep(ctx, deploymentID, stepPullImage, "pull_image", func() (string, error) {
+				output, err := runRemoteCommand(sshClient, shell.command("docker", "pull", service.container.Image))
+				if err != nil {
+					return "", fmt.Errorf("%v, output: %s", err, output)
+				}
+				return fmt.Sprintf("Pulled %s", service.container.Image), nil
+			})
+		},
+		"create_volume": func() error {
+			return w.managedStep(ctx, deploymentID, stepCreateVolume, "create_volume", func() (string, error) {
+				output, err := runRemoteCommand(sshClient, shell.command("docker", "volume", "create", service.volume))
+				if err != nil {
+					return "", fmt.Errorf("%v, output: %s", err, output)
+				}
+				return fmt.Sprintf("Volume %s is ready", service.volume), nil
+			})
+		},
+		"docker_run": func() error {
+			return w.runManagedContainer(ctx, deploymentID, sshClient, service)
+		},
+	}, 0)
+}
+
+// managedStep runs one step of a managed service deployment, recording its outcome on the step
+func (w *Worker) managedStep(ctx context.Context, deploymentID uuid.UUID, stepOrder int, taskName string, run func() (string, error)) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepOrder, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	message, err := run()
+	if err != nil {
+		errorMsg := fmt.Sprintf("%s failed: %v", taskName, err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, taskName, intPtr(stepOrder))
+		w.updateDeploymentStep(ctx, deploymentID, stepOrder, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s failed: %w", taskName, err)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", message, taskName, intPtr(stepOrder))
+
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepOrder, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+	return nil
+}
+
+// runManagedContainer replaces the container of a managed service through the docker CLI. The
+// credentials reach the container through an env file uploaded over SFTP, which is removed once
+// the container is created.
+func (w *Worker) runManagedContainer(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, service *managedServiceJob) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+	fail := func(errorMsg string) error {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	shell := sshClient.shell
+	if _, err := runRemoteCommand(sshClient, shell.ignoreErrors(shell.command("docker", "rm", "-f", service.containerName))); err != nil {
+		w.logger.WithError(err).Warn("Failed to remove the previous managed service container")
+	}
+
+	envFilePath := path.Join(shell.tempDir(), fmt.Sprintf("deployknot-managed-%s.env", deploymentID.String()))
+	if err := sshClient.CopyFile(ctx, envFilePath, strings.NewReader(service.env+"\n"), 0600); err != nil {
+		return fail(fmt.Sprintf("Failed to create .env file: %v", err))
+	}
+	defer w.removeRemoteFiles(ctx, deploymentID, sshClient, envFilePath)
+
+	container := service.container
+	runArgs := []string{
+		"docker", "run", "-d",
+		"--name", service.containerName,
+		"--restart", "unless-stopped",
+		"-p", fmt.Sprintf("%d:%d", service.port, container.Port),
+		"-v", service.volume + ":" + container.DataDir,
+		"--env-file", envFilePath,
+		"--health-cmd", container.HealthCheck,
+		"--health-interval", managedHealthInterval.String(),
+		"--health-timeout", managedHealthTimeout.String(),
+		"--health-start-period", managedHealthStartPeriod.String(),
+		"--health-retries", strconv.Itoa(managedHealthRetries),
+		container.Image,
+	}
+	output, err := runRemoteCommand(sshClient, shell.command(append(runArgs, container.Command...)...))
+	if err != nil {
+		w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunFailed, map[string]string{"error": fmt.Sprintf("%v, output: %s", err, output)}, "docker_run", intPtr(stepDockerRun))
+		return fail(fmt.Sprintf("Docker run failed: %v, output: %s", err, output))
+	}
+
+	containerID := strings.TrimSpace(output)
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunSucceeded, map[string]string{"container_id": containerID}, "docker_run", intPtr(stepDockerRun))
+	w.recordStepOutput(ctx, deploymentID, stepDockerRun, map[string]interface{}{
+		"container_id":   containerID,
+		"container_name": service.containerName,
+		"image":          container.Image,
+		"volume":         service.volume,
+	})
+
+	if err := w.waitForHealthy(ctx, deploymentID, service.containerName, cliContainerState(sshClient, service.containerName)); err != nil {
+		return err
+	}
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+	return nil
+}
+
+// runManagedContainerAPI replaces the container of a managed service through the Docker Engine API
+func (w *Worker) runManagedContainerAPI(ctx context.Context, deploymentID uuid.UUID, docker *dockerapi.Client, service *managedServiceJob) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+	fail := func(errorMsg string) error {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	if err := docker.RemoveContainer(ctx, service.containerName); err != nil {
+		return fail(fmt.Sprintf("Failed to remove the previous container: %v", err))
+	}
+
+	var env []string
+	for _, v := range models.FromEnvFile(service.env) {
+		env = append(env, v.Key+"="+v.Value)
+	}
+	container := service.container
+	containerID, err := docker.CreateContainer(ctx, service.containerName, dockerapi.ContainerConfig{
+		Image:         container.Image,
+		Env:           env,
+		Port:          service.port,
+		ContainerPort: container.Port,
+		Cmd:           container.Command,
+		Binds:         []string{service.volume + ":" + container.DataDir},
+		Healthcheck: &dockerapi.Healthcheck{
+			Test:        []string{"CMD-SHELL", container.HealthCheck},
+			Interval:    managedHealthInterval,
+			Timeout:     managedHealthTimeout,
+			StartPeriod: managedHealthStartPeriod,
+			Retries:     managedHealthRetries,
+		},
+		RestartPolicy: &dockerapi.RestartPolicy{Name: "unless-stopped"},
+	})
+	if err != nil {
+		return fail(fmt.Sprintf("Docker container create failed: %v", err))
+	}
+	if err := docker.StartContainer(ctx, containerID); err != nil {
+		return fail(fmt.Sprintf("Docker container start failed: %v", err))
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker container started successfully: %s", containerID), "docker_run", intPtr(stepDockerRun))
+	w.recordStepOutput(ctx, deploymentID, stepDockerRun, map[string]interface{}{
+		"container_id":   containerID,
+		"container_name": service.containerName,
+		"image":          container.Image,
+		"volume":         service.volume,
+	})
+
+	readState := func() (*dockerapi.ContainerState, error) {
+		info, err := docker.InspectContainer(ctx, containerID)
+		if err != nil {
+			return nil, err
+		}
+		return &info.State, nil
+	}
+	if err := w.waitForHealthy(ctx, deploymentID, service.containerName, readState); err != nil {
+		return err
+	}
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+	return nil
+}
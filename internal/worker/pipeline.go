@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// pipelineResult is the outcome of one step of a deployment pipeline
+type pipelineResult struct {
+	step *models.DeploymentStep
+	err  error
+}
+
+// runPipeline runs a deployment's steps as a graph: each step starts as soon as the steps it
+// depends on have completed, so steps that do not depend on each other run in parallel. nodes maps
+// step names to the functions running them. Steps without a function, such as credential validation
+// which runs before the pipeline, and steps before resumeFrom count as completed.
+//
+// When a step fails, the steps already running are left to finish, the steps that never started
+// are marked failed and the first failure is returned.
+func (w *Worker) runPipeline(ctx context.Context, deploymentID uuid.UUID, nodes map[string]func() error, resumeFrom int) error {
+	steps, err := w.deploymentService.GetDeploymentSteps(ctx, deploymentID)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment steps: %w", err)
+	}
+
+	known := map[int]bool{}
+	done := map[int]bool{}
+	var pending []*models.DeploymentStep
+	for _, step := range steps {
+		known[step.StepOrder] = true
+		if nodes[step.StepName] == nil || step.StepOrder < resumeFrom {
+			done[step.StepOrder] = true
+			continue
+		}
+		pending = append(pending, step)
+	}
+
+	// A dependency on a step the deployment does not have is treated as met
+	ready := func(step *models.DeploymentStep) bool {
+		for _, order := range step.DependsOn {
+			if known[order] && !done[order] {
+				return false
+			}
+		}
+		return true
+	}
+
+	results := make(chan pipelineResult)
+	running := 0
+	var failed *pipelineResult
+	for {
+		if failed == nil {
+			var waiting []*models.DeploymentStep
+			var started []string
+			for _, step := range pending {
+				if !ready(step) {
+					waiting = append(waiting, step)
+					continue
+				}
+				running++
+				started = append(started, step.StepName)
+				go func(step *models.DeploymentStep, run func() error) {
+					results <- pipelineResult{step: step, err: run()}
+				}(step, nodes[step.StepName])
+			}
+			pending = waiting
+			if len(started) > 1 {
+				w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Running steps %s in parallel", strings.Join(started, ", ")), "pipeline", nil)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+
+		if result.err != nil {
+			w.failUnfinishedStep(ctx, deploymentID, result.step.StepOrder, result.err)
+			if failed == nil {
+				failed = &result
+			}
+			continue
+		}
+		done[result.step.StepOrder] = true
+	}
+
+	if failed != nil {
+		errorMsg := fmt.Sprintf("Step abandoned due to failure in step %d", failed.step.StepOrder)
+		for _, step := range pending {
+			if err := w.updateDeploymentStep(ctx, deploymentID, step.StepOrder, models.DeploymentStatusFailed, &errorMsg); err != nil {
+				w.logger.WithError(err).WithField("step_order", step.StepOrder).Error("Failed to mark step as failed")
+			}
+		}
+		return failed.err
+	}
+
+	// Steps still pending here depend on each other in a cycle
+	if len(pending) > 0 {
+		names := make([]string, len(pending))
+		for i, step := range pending {
+			names[i] = step.StepName
+		}
+		errorMsg := fmt.Sprintf("Steps %s can never start, their dependencies form a cycle", strings.Join(names, ", "))
+		for _, step := range pending {
+			if err := w.updateDeploymentStep(ctx, deploymentID, step.StepOrder, models.DeploymentStatusFailed, &errorMsg); err != nil {
+				w.logger.WithError(err).WithField("step_order", step.StepOrder).Error("Failed to mark step as failed")
+			}
+		}
+		return fmt.Errorf("steps %s have cyclic dependencies", strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// failUnfinishedStep marks a step that failed as failed, unless it already recorded its outcome.
+// Steps mark themselves failed when their main command fails, but not when, say, their hooks do.
+func (w *Worker) failUnfinishedStep(ctx context.Context, deploymentID uuid.UUID, stepOrder int, stepErr error) {
+	steps, err := w.deploymentService.GetDeploymentSteps(ctx, deploymentID)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to get deployment steps")
+		return
+	}
+
+	for _, step := range steps {
+		if step.StepOrder != stepOrder || (step.Status != models.DeploymentStatusPending && step.Status != models.DeploymentStatusRunning) {
+			continue
+		}
+		errorMsg := stepErr.Error()
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepOrder, models.DeploymentStatusFailed, &errorMsg); err != nil {
+			w.logger.WithError(err).WithFields(logrus.Fields{
+				"deployment_id": deploymentID,
+				"step_order":    stepOrder,
+			}).Error("Failed to mark step as failed")
+		}
+	}
+}
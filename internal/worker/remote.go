@@ -0,0 +1,227 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteRunner runs commands on a deployment target and transfers files to and from it. The
+// deployment steps only reach the target through it, so they are written against the commands they
+// run rather than SSH sessions, and a fake runner can stand in for the target.
+type RemoteRunner interface {
+	// Run runs cmd and returns its combined output. A session that fails for a transient reason
+	// is retried, running cmd again, so cmd must be safe to repeat.
+	Run(ctx context.Context, cmd string) ([]byte, error)
+	// RunWithStream runs cmd once with stdin, stdout and stderr connected to the given reader and
+	// writers, any of which may be nil. Only opening its session is retried.
+	RunWithStream(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error
+	// CopyFile writes content to remotePath on the target, replacing it, with the given mode
+	CopyFile(ctx context.Context, remotePath string, content io.Reader, mode os.FileMode) error
+	// ReadFile reads at most limit bytes of remotePath on the target. A file that does not exist
+	// is an error matching fs.ErrNotExist.
+	ReadFile(ctx context.Context, remotePath string, limit int64) ([]byte, error)
+}
+
+// sshRunner is the RemoteRunner of an SSH connection to a target
+type sshRunner struct {
+	client *ssh.Client
+	retry  sshRetryPolicy
+	// timeout bounds every command and file transfer
+	timeout time.Duration
+	logger  *logrus.Entry
+	// secrets are replaced in the output of commands and in what is logged about them
+	secrets []string
+}
+
+// newSSHRunner creates the runner of an SSH connection. secrets, such as the PAT and the SSH
+// password of the deployment, never appear in the output it returns or the commands it logs.
+func newSSHRunner(client *ssh.Client, retry sshRetryPolicy, timeout time.Duration, logger *logrus.Entry, secrets ...string) *sshRunner {
+	runner := &sshRunner{client: client, retry: retry, timeout: timeout, logger: logger}
+	for _, secret := range secrets {
+		if secret != "" {
+			runner.secrets = append(runner.secrets, secret)
+		}
+	}
+	return runner
+}
+
+// Run runs cmd and returns its combined output
+func (r *sshRunner) Run(ctx context.Context, cmd string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	started := time.Now()
+	var output []byte
+	err := r.retry.do(ctx, func() error {
+		session, err := r.client.NewSession()
+		if err != nil {
+			return fmt.Errorf("failed to create SSH session: %w", err)
+		}
+		defer session.Close()
+
+		// The session copies both streams at once
+		var buf bytes.Buffer
+		combined := &lockedWriter{w: &buf}
+		session.Stdout = combined
+		session.Stderr = combined
+		err = runSession(ctx, session, cmd)
+		output = buf.Bytes()
+		return err
+	})
+	output = []byte(r.redact(string(output)))
+	r.logCommand(cmd, started, err)
+	return output, err
+}
+
+// RunWithStream runs cmd once with the given standard streams
+func (r *sshRunner) RunWithStream(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	started := time.Now()
+	var session *ssh.Session
+	err := r.retry.do(ctx, func() error {
+		var err error
+		session, err = r.client.NewSession()
+		return err
+	})
+	if err != nil {
+		r.logCommand(cmd, started, err)
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	if stdout != nil && stdout == stderr {
+		// The session copies both streams at once
+		stdout = &lockedWriter{w: stdout}
+		stderr = stdout
+	}
+	session.Stdout = stdout
+	session.Stderr = stderr
+	err = runSession(ctx, session, cmd)
+	r.logCommand(cmd, started, err)
+	return err
+}
+
+// CopyFile writes content to remotePath over SFTP
+func (r *sshRunner) CopyFile(ctx context.Context, remotePath string, content io.Reader, mode os.FileMode) error {
+	return r.withSFTP(ctx, func(sftpClient *sftp.Client) error {
+		remoteFile, err := sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return fmt.Errorf("failed to create remote file: %w", err)
+		}
+		defer remoteFile.Close()
+
+		if err := remoteFile.Chmod(mode); err != nil {
+			return fmt.Errorf("failed to set remote file mode: %w", err)
+		}
+		if _, err := io.Copy(remoteFile, content); err != nil {
+			return fmt.Errorf("failed to write remote file: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReadFile reads remotePath over SFTP
+func (r *sshRunner) ReadFile(ctx context.Context, remotePath string, limit int64) ([]byte, error) {
+	var data []byte
+	err := r.withSFTP(ctx, func(sftpClient *sftp.Client) error {
+		file, err := sftpClient.Open(remotePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		data, err = io.ReadAll(io.LimitReader(file, limit))
+		return err
+	})
+	return data, err
+}
+
+// withSFTP calls transfer with an SFTP client on the connection, which is closed when ctx ends or
+// the runner's timeout passes
+func (r *sshRunner) withSFTP(ctx context.Context, transfer func(*sftp.Client) error) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	sftpClient, err := sftp.NewClient(r.client)
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+	stop := context.AfterFunc(ctx, func() { sftpClient.Close() })
+	defer stop()
+
+	err = transfer(sftpClient)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
+}
+
+// runSession runs cmd in session, closing the session when ctx ends so the command is abandoned
+func runSession(ctx context.Context, session *ssh.Session, cmd string) error {
+	stop := context.AfterFunc(ctx, func() {
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+	})
+	defer stop()
+
+	err := session.Run(cmd)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return fmt.Errorf("command timed out: %w", ctxErr)
+		}
+		return ctxErr
+	}
+	return err
+}
+
+// logCommand logs a command the runner ran with its secrets replaced
+func (r *sshRunner) logCommand(cmd string, started time.Time, err error) {
+	entry := r.logger.WithFields(logrus.Fields{
+		"command":  r.redact(cmd),
+		"duration": time.Since(started).Round(time.Millisecond),
+	})
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		entry.Debug("Ran command on target")
+	case errors.As(err, &exitErr):
+		entry.WithField("exit_status", exitErr.ExitStatus()).Debug("Command on target failed")
+	default:
+		entry.WithError(errors.New(r.redact(err.Error()))).Debug("Command on target failed")
+	}
+}
+
+// redact replaces the runner's secrets in s
+func (r *sshRunner) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return s
+}
+
+// lockedWriter serializes writes to a writer both output streams of a session write to
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,239 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// maxRepoConfigSize bounds how much of deployknot.yaml is read from the target
+const maxRepoConfigSize = 64 * 1024
+
+// Health check endpoint polling after the container has started
+const (
+	healthCheckAttempts = 10
+	healthCheckInterval = 3 * time.Second
+)
+
+// appSettings are the parameters of a docker deployment after merging the repository's deployknot.yaml
+type appSettings struct {
+	appDir          string
+	envFilePath     string
+	envVars         string
+	port            int
+	dockerfile      string
+	healthCheckPath string
+	hooks           models.RepoHooks
+	smokeTests      models.RepoSmokeTests
+	latencyCheck    models.LatencyCheck
+	secretScan      models.RepoSecretScan
+}
+
+// rollbackEnabled reports whether a failed verification rolls the deployment back, which needs the
+// previous image kept before the build
+func (s *appSettings) rollbackEnabled() bool {
+	return s.smokeTests.Rollback || s.latencyCheck.Rollback
+}
+
+// loadRepoConfig reads deployknot.yaml from the application root of the cloned repository.
+// It returns nil when the repository does not have one.
+func loadRepoConfig(ctx context.Context, sshClient *targetConn, appDir string) (*models.RepoConfig, string, error) {
+	for _, name := range models.RepoConfigFileNames {
+		data, err := sshClient.ReadFile(ctx, path.Join(appDir, name), maxRepoConfigSize+1)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, name, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if len(data) > maxRepoConfigSize {
+			return nil, name, fmt.Errorf("%s is larger than %d bytes", name, maxRepoConfigSize)
+		}
+
+		cfg, err := parseRepoConfig(data)
+		if err != nil {
+			return nil, name, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return cfg, name, nil
+	}
+	return nil, "", nil
+}
+
+// parseRepoConfig parses and validates deployknot.yaml, rejecting unknown fields
+func parseRepoConfig(data []byte) (*models.RepoConfig, error) {
+	var cfg models.RepoConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// lazyAppSettings returns a function resolving the app settings the first time it is called. The
+// pipeline steps using it depend on each other, so it is never called concurrently.
+func (w *Worker) lazyAppSettings(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, appDir, envFilePath, envVars string, port int, metadata deploymentMetadata) func() (*appSettings, error) {
+	var settings *appSettings
+	return func() (*appSettings, error) {
+		if settings != nil {
+			return settings, nil
+		}
+		resolved, err := w.resolveAppSettings(ctx, deploymentID, sshClient, appDir, envFilePath, envVars, port, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load repository configuration: %w", err)
+		}
+		settings = resolved
+		return settings, nil
+	}
+}
+
+// resolveAppSettings merges the repository's deployknot.yaml with the request parameters; the request wins.
+// The placeholders of the environment variables are then resolved with the deployment's metadata.
+// It is the first part of the build step, so failures are reported against that step.
+func (w *Worker) resolveAppSettings(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, appDir, envFilePath, envVars string, port int, metadata deploymentMetadata) (*appSettings, error) {
+	settings := &appSettings{appDir: appDir, envFilePath: envFilePath, envVars: envVars, port: port}
+	fail := func(err error) (*appSettings, error) {
+		errorMsg := err.Error()
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "repo_config", intPtr(stepDockerBuild))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusFailed, &errorMsg)
+		return nil, err
+	}
+	interpolate := func() (*appSettings, error) {
+		envFilePath, envVars, err := metadata.resolveEnv(settings.envFilePath, settings.envVars, settings.port)
+		if err != nil {
+			return fail(err)
+		}
+		if envFilePath != settings.envFilePath || envVars != settings.envVars {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Resolved deployment placeholders in environment variables", "env_setup", intPtr(stepDockerBuild))
+		}
+		settings.envFilePath, settings.envVars = envFilePath, envVars
+		return settings, nil
+	}
+
+	cfg, name, err := loadRepoConfig(ctx, sshClient, appDir)
+	if err != nil {
+		return fail(err)
+	}
+	if cfg == nil {
+		if port <= 0 {
+			return fail(fmt.Errorf("port is required: set it on the deployment or in deployknot.yaml"))
+		}
+		return interpolate()
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using repository configuration from %s", name), "repo_config", intPtr(stepDockerBuild))
+
+	if settings.port <= 0 {
+		settings.port = cfg.Port
+	}
+	if settings.port <= 0 {
+		return fail(fmt.Errorf("port is required: set it on the deployment or in %s", name))
+	}
+	settings.dockerfile = cfg.Dockerfile
+	settings.healthCheckPath = cfg.HealthCheckPath
+	settings.hooks = cfg.Hooks
+	settings.smokeTests = cfg.SmokeTests
+	settings.latencyCheck = cfg.LatencyCheck
+	settings.secretScan = cfg.SecretScan
+
+	if len(cfg.Env) > 0 {
+		// Uploaded env files take precedence over inline environment variables
+		content := envVars
+		if envFilePath != "" {
+			data, err := os.ReadFile(envFilePath)
+			if err != nil {
+				return fail(fmt.Errorf("failed to read env file: %w", err))
+			}
+			content = string(data)
+		}
+
+		merged, missing := cfg.ApplyEnv(content)
+		if len(missing) > 0 {
+			return fail(fmt.Errorf("missing required environment variables declared in %s: %s", name, strings.Join(missing, ", ")))
+		}
+		if merged != content {
+			// Defaults were added, so the variables are passed inline instead of the uploaded file
+			settings.envFilePath = ""
+			settings.envVars = merged
+		}
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Resolved settings: port %d, dockerfile %q, health check path %q, %d pre-build and %d post-deploy hooks, %d smoke tests, latency check %t",
+		settings.port, settings.dockerfile, settings.healthCheckPath, len(settings.hooks.PreBuild), len(settings.hooks.PostDeploy), len(settings.smokeTests.Checks), settings.latencyCheck.Enabled()), "repo_config", intPtr(stepDockerBuild))
+	return interpolate()
+}
+
+// runHooks runs deployknot.yaml hooks on the target from the application root, stopping at the first failure
+func (w *Worker) runHooks(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, appDir, stage string, hooks []string, stepOrder int) error {
+	taskName := "hook_" + stage
+	for i, hook := range hooks {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Running %s hook %d: %s", stage, i+1, hook), taskName, intPtr(stepOrder))
+
+		output, err := runRemoteCommand(sshClient, sshClient.shell.inDir(appDir, sshClient.shell.runScript(hook)))
+		if err != nil {
+			errorMsg := fmt.Sprintf("%s hook %d failed: %v, output: %s", stage, i+1, err, output)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, taskName, intPtr(stepOrder))
+			w.updateDeploymentStep(ctx, deploymentID, stepOrder, models.DeploymentStatusFailed, &errorMsg)
+			return fmt.Errorf("%s hook %d failed: %w", stage, i+1, err)
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("%s hook %d completed: %s", stage, i+1, output), taskName, intPtr(stepOrder))
+	}
+	return nil
+}
+
+// checkHealthEndpoint polls the application's health check path on the target until it answers
+// successfully, and returns how long the successful request took.
+func (w *Worker) checkHealthEndpoint(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, port int, healthCheckPath string) (time.Duration, error) {
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, healthCheckPath)
+	checkCmd := sshClient.shell.httpTime(url)
+
+	var lastErr error
+	for attempt := 1; attempt <= healthCheckAttempts; attempt++ {
+		latency, output, err := requestLatency(sshClient, checkCmd)
+		if err == nil {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Health check endpoint %s responded in %dms", healthCheckPath, latency.Milliseconds()), "health_check", intPtr(stepHealthCheck))
+			return latency, nil
+		}
+		lastErr = fmt.Errorf("%v, output: %s", err, output)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Health check endpoint %s not ready (attempt %d/%d): %v", healthCheckPath, attempt, healthCheckAttempts, lastErr), "health_check", intPtr(stepHealthCheck))
+
+		if attempt < healthCheckAttempts {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(healthCheckInterval):
+			}
+		}
+	}
+	return 0, fmt.Errorf("health check endpoint %s did not respond: %v", healthCheckPath, lastErr)
+}
+
+// requestLatency runs an httpTime command and returns how long the request took. When the target
+// does not report the request time itself, the round trip over SSH is measured instead.
+func requestLatency(sshClient *targetConn, checkCmd string) (time.Duration, string, error) {
+	started := time.Now()
+	output, err := runRemoteCommand(sshClient, checkCmd)
+	if err != nil {
+		return 0, output, err
+	}
+	latency := time.Since(started)
+	if seconds, parseErr := strconv.ParseFloat(output, 64); parseErr == nil {
+		latency = time.Duration(seconds * float64(time.Second))
+	}
+	return latency, output, nil
+}
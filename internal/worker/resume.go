@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"deployknot/internal/dockerapi"
+
+	"github.com/google/uuid"
+)
+
+// resumeRequirement is something a step leaves on the target that later steps build on
+type resumeRequirement struct {
+	// producedBy is the order of the step that produces it
+	producedBy int
+	what       string
+	present    func() error
+}
+
+// resumePoint returns the step a resumed deployment can start from: resumeFrom, unless something
+// an earlier step produced is gone from the target, in which case that step runs again
+func (w *Worker) resumePoint(ctx context.Context, deploymentID uuid.UUID, resumeFrom int, requirements []resumeRequirement) int {
+	for _, requirement := range requirements {
+		if resumeFrom <= requirement.producedBy {
+			break
+		}
+		if err := requirement.present(); err != nil {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("The %s is no longer on the target (%v), resuming from step %d instead", requirement.what, err, requirement.producedBy), "deployment_resume", intPtr(requirement.producedBy))
+			return requirement.producedBy
+		}
+	}
+	if resumeFrom > 0 {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Resuming from step %d, skipping the steps completed before", resumeFrom), "deployment_resume", intPtr(resumeFrom))
+	}
+	return resumeFrom
+}
+
+// dockerResumeRequirements are what a Docker deployment's clone, build and run steps leave on the
+// target, checked through the docker CLI
+func dockerResumeRequirements(sshClient *targetConn, appDir, containerName string) []resumeRequirement {
+	return []resumeRequirement{
+		{stepGitClone, "workspace", func() error {
+			_, err := runRemoteCommand(sshClient, sshClient.shell.isDir(appDir))
+			return err
+		}},
+		{stepDockerBuild, "image", func() error {
+			_, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "image", "inspect", containerName+":latest"))
+			return err
+		}},
+		{stepDockerRun, "container", func() error {
+			_, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "container", "inspect", containerName))
+			return err
+		}},
+	}
+}
+
+// dockerAPIResumeRequirements are what a Docker deployment's clone, build and run steps leave on
+// the target, checked through the Docker Engine API
+func dockerAPIResumeRequirements(ctx context.Context, sshClient *targetConn, docker *dockerapi.Client, appDir, containerName string) []resumeRequirement {
+	return []resumeRequirement{
+		{stepGitClone, "workspace", func() error {
+			_, err := runRemoteCommand(sshClient, sshClient.shell.isDir(appDir))
+			return err
+		}},
+		{stepDockerBuild, "image", func() error {
+			return docker.InspectImage(ctx, containerName+":latest")
+		}},
+		{stepDockerRun, "container", func() error {
+			_, err := docker.InspectContainer(ctx, containerName)
+			return err
+		}},
+	}
+}
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"deployknot/internal/config"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshRetryPolicy is how commands on a target are retried when their session fails for a
+// transient reason
+type sshRetryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// newSSHRetryPolicy returns the retry policy of the worker configuration
+func newSSHRetryPolicy(cfg config.WorkerConfig) sshRetryPolicy {
+	return sshRetryPolicy{
+		attempts:   cfg.SSHRetryAttempts,
+		backoff:    cfg.SSHRetryBackoff,
+		maxBackoff: cfg.SSHRetryMaxBackoff,
+	}
+}
+
+// delay returns how long to wait before the retry following attempt, counted from 1: the backoff
+// doubled for every earlier retry up to the maximum, of which a random half is waited so workers
+// that failed together do not retry together
+func (p sshRetryPolicy) delay(attempt int) time.Duration {
+	delay := p.backoff
+	for i := 1; i < attempt && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.maxBackoff)
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// do calls attempt until it succeeds, fails with an error that is not transient, runs out of
+// attempts or ctx is cancelled, and returns its last error
+func (p sshRetryPolicy) do(ctx context.Context, attempt func() error) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= p.attempts || !transientSSHError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(p.delay(n)):
+		}
+	}
+}
+
+// transientSSHError reports whether a session failed in a way another session on the same
+// connection may not: the target refused to open it, it timed out, or it ended without the exit
+// status of its command. Commands that exited with a status and closed connections are final.
+func transientSSHError(err error) bool {
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		return openErr.Reason == ssh.Prohibited || openErr.Reason == ssh.ResourceShortage || openErr.Reason == ssh.ConnectionFailed
+	}
+	var exitMissing *ssh.ExitMissingError
+	if errors.As(err, &exitMissing) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTransientSSHError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"prohibited", &ssh.OpenChannelError{Reason: ssh.Prohibited}, true},
+		{"resource shortage", &ssh.OpenChannelError{Reason: ssh.ResourceShortage}, true},
+		{"connection failed", &ssh.OpenChannelError{Reason: ssh.ConnectionFailed}, true},
+		{"unknown channel type", &ssh.OpenChannelError{Reason: ssh.UnknownChannelType}, false},
+		{"exit status missing", &ssh.ExitMissingError{}, true},
+		{"wrapped exit status missing", fmt.Errorf("failed: %w", &ssh.ExitMissingError{}), true},
+		{"timeout", timeoutError{}, true},
+		{"wrapped timeout", fmt.Errorf("failed to create SSH session: %w", timeoutError{}), true},
+		{"exit status", &ssh.ExitError{Waitmsg: ssh.Waitmsg{}}, false},
+		{"closed connection", io.EOF, false},
+		{"deadline", os.ErrDeadlineExceeded, true},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("permission denied"), false},
+	}
+	for _, tt := range tests {
+		if got := transientSSHError(tt.err); got != tt.want {
+			t.Errorf("%s: transientSSHError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSSHRetryPolicyDelay(t *testing.T) {
+	p := sshRetryPolicy{attempts: 10, backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	for attempt, full := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for range 200 {
+			// Equal jitter: a random wait between half the backoff and all of it
+			if d := p.delay(attempt); d < full/2 || d > full {
+				t.Fatalf("delay(%d) = %v, want between %v and %v", attempt, d, full/2, full)
+			}
+		}
+	}
+}
+
+func TestSSHRetryPolicyDo(t *testing.T) {
+	p := sshRetryPolicy{attempts: 3, backoff: time.Millisecond, maxBackoff: 2 * time.Millisecond}
+	transient := &ssh.OpenChannelError{Reason: ssh.Prohibited}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		calls := 0
+		err := p.do(context.Background(), func() error {
+			calls++
+			if calls < 3 {
+				return transient
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Fatalf("do = %v after %d calls, want nil after 3", err, calls)
+		}
+	})
+
+	t.Run("stops at the attempt limit", func(t *testing.T) {
+		calls := 0
+		err := p.do(context.Background(), func() error {
+			calls++
+			return transient
+		})
+		if !errors.Is(err, transient) || calls != 3 {
+			t.Fatalf("do = %v after %d calls, want the transient error after 3", err, calls)
+		}
+	})
+
+	t.Run("stops at a non-transient error", func(t *testing.T) {
+		final := &ssh.ExitError{Waitmsg: ssh.Waitmsg{}}
+		calls := 0
+		err := p.do(context.Background(), func() error {
+			calls++
+			return final
+		})
+		if !errors.Is(err, final) || calls != 1 {
+			t.Fatalf("do = %v after %d calls, want the exit error after 1", err, calls)
+		}
+	})
+
+	t.Run("stops when the context ends", func(t *testing.T) {
+		slow := sshRetryPolicy{attempts: 5, backoff: time.Hour, maxBackoff: time.Hour}
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := slow.do(ctx, func() error {
+			calls++
+			cancel()
+			return transient
+		})
+		if !errors.Is(err, transient) || calls != 1 {
+			t.Fatalf("do = %v after %d calls, want the transient error after 1", err, calls)
+		}
+	})
+
+	t.Run("a single attempt is never retried", func(t *testing.T) {
+		calls := 0
+		(sshRetryPolicy{attempts: 1}).do(context.Background(), func() error {
+			calls++
+			return transient
+		})
+		if calls != 1 {
+			t.Fatalf("do called attempt %d times, want 1", calls)
+		}
+	})
+}
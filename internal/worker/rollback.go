@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"deployknot/internal/dockerapi"
+
+	"github.com/google/uuid"
+)
+
+// previousImageTag tags the image a deployment replaces, so a failed verification can roll back to it
+const previousImageTag = "previous"
+
+// imageRollback keeps the image a deployment replaces and restores it, through the docker CLI or
+// the Docker Engine API
+type imageRollback struct {
+	// preserve tags the current image as the previous one before the build replaces it
+	preserve func() error
+	// restore replaces the new container with one running the previous image
+	restore func() error
+}
+
+// cliImageRollback handles the previous image through the docker CLI on the target; run starts
+// the container again once the previous image is tagged as the latest one
+func cliImageRollback(sshClient *targetConn, containerName string, run func() error) imageRollback {
+	shell := sshClient.shell
+	latest, previous := containerName+":latest", containerName+":"+previousImageTag
+	return imageRollback{
+		preserve: func() error {
+			// Without a current image, a previous image left by an older deployment must not survive
+			cmd := shell.all(shell.ignoreErrors(shell.command("docker", "rmi", previous)), shell.command("docker", "tag", latest, previous))
+			if output, err := runRemoteCommand(sshClient, cmd); err != nil {
+				return fmt.Errorf("%w: %s", err, output)
+			}
+			return nil
+		},
+		restore: func() error {
+			if _, err := runRemoteCommand(sshClient, shell.command("docker", "image", "inspect", previous)); err != nil {
+				return fmt.Errorf("there is no previous image to roll back to")
+			}
+			cmd := shell.all(shell.ignoreErrors(shell.command("docker", "rm", "-f", containerName)), shell.command("docker", "tag", previous, latest))
+			if output, err := runRemoteCommand(sshClient, cmd); err != nil {
+				return fmt.Errorf("%w: %s", err, output)
+			}
+			return run()
+		},
+	}
+}
+
+// apiImageRollback handles the previous image through the Docker Engine API
+func apiImageRollback(ctx context.Context, docker *dockerapi.Client, containerName string, run func() error) imageRollback {
+	latest, previous := containerName+":latest", containerName+":"+previousImageTag
+	return imageRollback{
+		preserve: func() error {
+			if err := docker.RemoveImage(ctx, previous); err != nil {
+				return err
+			}
+			return docker.TagImage(ctx, latest, containerName, previousImageTag)
+		},
+		restore: func() error {
+			if err := docker.InspectImage(ctx, previous); err != nil {
+				return fmt.Errorf("there is no previous image to roll back to")
+			}
+			if err := docker.RemoveContainer(ctx, containerName); err != nil {
+				return err
+			}
+			if err := docker.TagImage(ctx, previous, containerName, "latest"); err != nil {
+				return err
+			}
+			return run()
+		},
+	}
+}
+
+// preservePreviousImage keeps the image about to be replaced when the repository enables rollback
+func (w *Worker) preservePreviousImage(ctx context.Context, deploymentID uuid.UUID, settings *appSettings, containerName string, rollback imageRollback) {
+	if !settings.rollbackEnabled() {
+		return
+	}
+	if err := rollback.preserve(); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("No current image to keep for rollback, the deployment cannot roll back: %v", err), "docker_build", intPtr(stepDockerBuild))
+		return
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Kept the current image as %s:%s for rollback", containerName, previousImageTag), "docker_build", intPtr(stepDockerBuild))
+}
+
+// rollBack restores the previous image after a verification step failed. It records the outcome in
+// output and returns what to add to the step's error message.
+func (w *Worker) rollBack(ctx context.Context, deploymentID uuid.UUID, stepOrder int, rollback imageRollback, output map[string]interface{}) string {
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", "Rolling back to the previous image", "rollback", intPtr(stepOrder))
+	if err := rollback.restore(); err != nil {
+		output["rollback_error"] = err.Error()
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", fmt.Sprintf("Rolling back failed: %v", err), "rollback", intPtr(stepOrder))
+		return fmt.Sprintf(", rolling back failed: %v", err)
+	}
+	output["rolled_back"] = true
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Rolled back to the previous image", "rollback", intPtr(stepOrder))
+	return ", rolled back to the previous image"
+}
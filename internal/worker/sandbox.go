@@ -0,0 +1,238 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/config"
+)
+
+// errLocalPathDenied is returned for a local file named by a job outside the directories the
+// worker may read
+var errLocalPathDenied = errors.New("local file is outside the directories the worker may read")
+
+// errLocalCommandsUnisolated is returned for a job that needs local commands on a worker that would
+// run them as its own user
+var errLocalCommandsUnisolated = errors.New("local commands would run as the worker's own user, who can read the worker's secrets; run the worker as root, or set WORKER_ALLOW_UNISOLATED_COMMANDS=true to accept that")
+
+// defaultExecUser is the user local commands run as when the worker runs as root and
+// WORKER_EXEC_USER is empty
+const defaultExecUser = "nobody"
+
+// localCommandEnv are the variables of the worker's environment local commands inherit; the rest,
+// such as ENCRYPTION_KEY and the database credentials, are not theirs to read
+var localCommandEnv = []string{
+	"PATH", "LANG", "LC_ALL", "TZ",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR",
+}
+
+// localSandbox confines what job data can make the worker do on its own host. Jobs name local
+// files, such as uploaded env files, and make the worker run tools such as git, kubectl and
+// cosign. A tampered job must not read other files of the host. Those tools must not run with
+// the worker's privileges either, since a process running as the worker's user can read the
+// worker's environment, ENCRYPTION_KEY included, from /proc. Only a worker running as root can
+// run them as another user; elsewhere jobs needing them are refused unless
+// WORKER_ALLOW_UNISOLATED_COMMANDS accepts running them as the worker's user.
+type localSandbox struct {
+	// dirs are the absolute directories local files named by jobs must be in
+	dirs []string
+	// user is who local commands run as; nil runs them as the worker's user
+	user *execUser
+	// allowUnisolated lets local commands run as the worker's user when user is nil
+	allowUnisolated bool
+}
+
+// execUser is the unprivileged user local commands run as
+type execUser struct {
+	name string
+	uid  uint32
+	gid  uint32
+}
+
+// newLocalSandbox creates the sandbox of the worker from its configuration. A worker running as
+// root drops privileges for local commands even when no user is configured.
+func newLocalSandbox(cfg config.WorkerConfig) (*localSandbox, error) {
+	sandbox := &localSandbox{allowUnisolated: cfg.AllowUnisolatedCommands}
+	for _, dir := range cfg.LocalFileDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WORKER_LOCAL_FILE_DIRS entry %q: %w", dir, err)
+		}
+		sandbox.dirs = append(sandbox.dirs, abs)
+	}
+
+	name := cfg.ExecUser
+	root := os.Geteuid() == 0
+	if name == "" {
+		if !root {
+			return sandbox, nil
+		}
+		name = defaultExecUser
+	}
+	if !canDropPrivileges {
+		return nil, fmt.Errorf("WORKER_EXEC_USER is not supported on this platform")
+	}
+
+	execUser, err := lookupExecUser(name)
+	if err != nil {
+		if cfg.ExecUser == "" {
+			return nil, fmt.Errorf("the worker runs as root and user %q to run local commands as does not exist, set WORKER_EXEC_USER: %w", name, err)
+		}
+		return nil, fmt.Errorf("invalid WORKER_EXEC_USER: %w", err)
+	}
+	if execUser.uid == 0 {
+		return nil, fmt.Errorf("WORKER_EXEC_USER must not be root")
+	}
+	if !root {
+		if int(execUser.uid) != os.Geteuid() {
+			return nil, fmt.Errorf("running local commands as %s requires running the worker as root", name)
+		}
+		// Already unprivileged
+		return sandbox, nil
+	}
+	sandbox.user = execUser
+	return sandbox, nil
+}
+
+// lookupExecUser resolves a user name or numeric user ID
+func lookupExecUser(name string) (*execUser, error) {
+	var u *user.User
+	var err error
+	if _, numErr := strconv.ParseUint(name, 10, 32); numErr == nil {
+		u, err = user.LookupId(name)
+	} else {
+		u, err = user.Lookup(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s has no numeric user ID", name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s has no numeric group ID", name)
+	}
+	return &execUser{name: u.Username, uid: uint32(uid), gid: uint32(gid)}, nil
+}
+
+// checkIsolated returns errLocalCommandsUnisolated unless local commands run as another user than
+// the worker's or running them as the worker's user was allowed
+func (s *localSandbox) checkIsolated() error {
+	if s.user == nil && !s.allowUnisolated {
+		return errLocalCommandsUnisolated
+	}
+	return nil
+}
+
+// userName returns who local commands run as, for logging
+func (s *localSandbox) userName() string {
+	if s.user == nil {
+		return ""
+	}
+	return s.user.name
+}
+
+// localFile checks that a local file named by a job is a regular file inside the directories the
+// worker may read, and returns its path with symlinks resolved so it cannot be swapped for one
+// pointing elsewhere afterwards
+func (s *localSandbox) localFile(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", errLocalPathDenied, name)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve local file %s: %w", name, err)
+	}
+
+	for _, dir := range s.dirs {
+		// A directory that does not exist yet holds no files
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return "", fmt.Errorf("failed to read local file %s: %w", name, err)
+		}
+		if !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%w: %s is not a regular file", errLocalPathDenied, name)
+		}
+		return resolved, nil
+	}
+	return "", fmt.Errorf("%w: %s", errLocalPathDenied, name)
+}
+
+// workDir creates a private work directory for the local commands of a job, and the home
+// directory inside it the commands run in and may write to. The work directory itself stays the
+// worker's, so the commands cannot plant symlinks where the worker writes the files it shares.
+func (s *localSandbox) workDir(prefix string) (string, string, error) {
+	dir, err := os.MkdirTemp("", prefix)
+	if err != nil {
+		return "", "", err
+	}
+	home := filepath.Join(dir, "home")
+	if err = os.Mkdir(home, 0700); err == nil && s.user != nil {
+		// The commands reach their home directory and the files shared with them, and nothing else
+		if err = os.Chmod(dir, 0711); err == nil {
+			err = s.share(home)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return dir, home, nil
+}
+
+// share hands a file or directory the worker created for a local command over to the user the
+// command runs as
+func (s *localSandbox) share(name string) error {
+	if s.user == nil {
+		return nil
+	}
+	if err := os.Chown(name, int(s.user.uid), int(s.user.gid)); err != nil {
+		return fmt.Errorf("failed to hand %s over to %s: %w", name, s.user.name, err)
+	}
+	return nil
+}
+
+// writeShared writes a private file the worker creates for a local command, such as a kubeconfig,
+// and hands it over to the user the command runs as
+func (s *localSandbox) writeShared(name, content string) error {
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		return err
+	}
+	return s.share(name)
+}
+
+// command prepares a local command run in dir, which is also its home directory, with only the
+// allowed variables of the worker's environment and, when configured, as the unprivileged user
+func (s *localSandbox) command(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.Env = []string{"HOME=" + dir}
+	for _, key := range localCommandEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	if s.user != nil {
+		dropPrivileges(cmd, s.user)
+	}
+	return cmd
+}
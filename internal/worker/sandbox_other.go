@@ -0,0 +1,11 @@
+//go:build !unix
+
+package worker
+
+import "os/exec"
+
+// canDropPrivileges reports whether local commands can run as another user
+const canDropPrivileges = false
+
+// dropPrivileges is never called where local commands cannot run as another user
+func dropPrivileges(cmd *exec.Cmd, u *execUser) {}
@@ -0,0 +1,25 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocalSandboxCheckIsolated(t *testing.T) {
+	tests := []struct {
+		name    string
+		sandbox localSandbox
+		want    error
+	}{
+		{"other user", localSandbox{user: &execUser{name: "nobody", uid: 65534, gid: 65534}}, nil},
+		{"worker's user", localSandbox{}, errLocalCommandsUnisolated},
+		{"worker's user allowed", localSandbox{allowUnisolated: true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sandbox.checkIsolated(); !errors.Is(err, tt.want) {
+				t.Errorf("checkIsolated() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package worker
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// canDropPrivileges reports whether local commands can run as another user
+const canDropPrivileges = true
+
+// dropPrivileges makes cmd run as u, without the supplementary groups of the worker
+func dropPrivileges(cmd *exec.Cmd, u *execUser) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: u.uid, Gid: u.gid, Groups: []uint32{}},
+	}
+}
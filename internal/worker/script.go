@@ -0,0 +1,172 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// remoteAppDir is where the repository is cloned on the target
+const remoteAppDir = models.RemoteWorkspaceDir
+
+// scriptDeployment holds the parameters of a script deployment job
+type scriptDeployment struct {
+	repoURL       string
+	pat           string
+	branch        string
+	scriptPath    string
+	scriptContent string
+	envFilePath   string
+	envVars       string
+	port          int
+	checkout      repoCheckout
+	metadata      deploymentMetadata
+}
+
+// executeScriptDeploymentSteps clones the repository and runs the user supplied deployment script
+func (w *Worker) executeScriptDeploymentSteps(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params scriptDeployment) error {
+	// Step 1: Clone the repository
+	if err := w.cloneRepository(ctx, deploymentID, sshClient, params.repoURL, params.pat, params.branch, params.checkout); err != nil {
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepGitClone)
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	// Step 2: Run the deployment script
+	if err := w.runDeploymentScript(ctx, deploymentID, sshClient, params); err != nil {
+		w.markRemainingStepsAsFailed(ctx, deploymentID, stepRunScript)
+		return fmt.Errorf("deployment script failed: %w", err)
+	}
+
+	return nil
+}
+
+// runDeploymentScript executes the deployment script on the target with the deployment environment injected
+func (w *Worker) runDeploymentScript(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, params scriptDeployment) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepRunScript, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Preparing deployment script", "run_script", intPtr(stepRunScript))
+
+	envContent, err := w.buildScriptEnvironment(deploymentID, params)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Failed to prepare script environment: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "run_script", intPtr(stepRunScript))
+		w.updateDeploymentStep(ctx, deploymentID, stepRunScript, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to prepare script environment: %w", err)
+	}
+
+	remoteEnvPath := fmt.Sprintf("/tmp/deployknot-script-%s.env", deploymentID.String())
+	remoteFiles := []string{remoteEnvPath}
+	defer func() {
+		w.removeRemoteFiles(ctx, deploymentID, sshClient, remoteFiles...)
+	}()
+
+	if err := sshClient.CopyFile(ctx, remoteEnvPath, strings.NewReader(envContent), 0600); err != nil {
+		errorMsg := fmt.Sprintf("Failed to upload script environment: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "run_script", intPtr(stepRunScript))
+		w.updateDeploymentStep(ctx, deploymentID, stepRunScript, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to upload script environment: %w", err)
+	}
+
+	// Resolve the script to execute: inline scripts are uploaded next to the env file
+	scriptPath := "./" + params.scriptPath
+	if params.scriptContent != "" {
+		scriptPath = fmt.Sprintf("/tmp/deployknot-script-%s.sh", deploymentID.String())
+		remoteFiles = append(remoteFiles, scriptPath)
+		if err := sshClient.CopyFile(ctx, scriptPath, strings.NewReader(params.scriptContent), 0700); err != nil {
+			errorMsg := fmt.Sprintf("Failed to upload inline script: %v", err)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "run_script", intPtr(stepRunScript))
+			w.updateDeploymentStep(ctx, deploymentID, stepRunScript, models.DeploymentStatusFailed, &errorMsg)
+			return fmt.Errorf("failed to upload inline script: %w", err)
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Inline deployment script uploaded", "run_script", intPtr(stepRunScript))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using repository script: %s", params.scriptPath), "run_script", intPtr(stepRunScript))
+	}
+
+	runCmd := fmt.Sprintf("cd %s && set -a && . %s && set +a && chmod +x %s && %s",
+		shellquote.Quote(params.checkout.appDir()), shellquote.Quote(remoteEnvPath), shellquote.Quote(scriptPath), shellquote.Quote(scriptPath))
+
+	// The script may have side effects, so a session that ends without its exit status is not
+	// run again
+	var output bytes.Buffer
+	err = sshClient.RunWithStream(ctx, runCmd, nil, &output, &output)
+	if err != nil {
+		var exitErr *ssh.ExitError
+		errorMsg := fmt.Sprintf("Deployment script failed: %v", err)
+		if errors.As(err, &exitErr) {
+			errorMsg = fmt.Sprintf("Deployment script exited with status %d", exitErr.ExitStatus())
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", fmt.Sprintf("%s, output: %s", errorMsg, output.String()), "run_script", intPtr(stepRunScript))
+		w.updateDeploymentStep(ctx, deploymentID, stepRunScript, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("script execution failed: %w, output: %s", err, output.String())
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Deployment script completed successfully: %s", output.String()), "run_script", intPtr(stepRunScript))
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepRunScript, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// buildScriptEnvironment renders the environment exported to the deployment script
+func (w *Worker) buildScriptEnvironment(deploymentID uuid.UUID, params scriptDeployment) (string, error) {
+	envVars := models.EnvironmentVariables{
+		{Key: "DEPLOYKNOT_DEPLOYMENT_ID", Value: deploymentID.String()},
+		{Key: "DEPLOYKNOT_REPO_URL", Value: params.repoURL},
+		{Key: "DEPLOYKNOT_BRANCH", Value: params.branch},
+		{Key: "DEPLOYKNOT_WORKSPACE", Value: params.checkout.appDir()},
+	}
+	if params.port > 0 {
+		envVars = append(envVars, models.EnvironmentVariable{Key: "PORT", Value: strconv.Itoa(params.port)})
+	}
+
+	// Uploaded env files take precedence over inline environment variables
+	userEnv := params.envVars
+	if params.envFilePath != "" {
+		content, err := os.ReadFile(params.envFilePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read env file: %w", err)
+		}
+		userEnv = string(content)
+	}
+	envVars = append(envVars, models.FromEnvFile(params.metadata.interpolateEnv(userEnv, params.port))...)
+
+	var lines []string
+	for _, env := range envVars {
+		if models.ValidateEnvKey(env.Key) != nil {
+			w.logger.WithField("key", env.Key).Warn("Skipping invalid environment variable name")
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", env.Key, shellquote.Quote(env.Value)))
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// removeRemoteFiles removes temporary files from the target
+func (w *Worker) removeRemoteFiles(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, paths ...string) {
+	quoted := make([]string, 0, len(paths))
+	for _, p := range paths {
+		quoted = append(quoted, shellquote.Quote(p))
+	}
+
+	if output, err := sshClient.Run(ctx, "rm -f "+strings.Join(quoted, " ")); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Remote cleanup warning: %v, output: %s", err, string(output)), "run_script", intPtr(stepRunScript))
+	}
+}
@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// secretScanLimit bounds the findings a rule reports, so a repository full of fixtures does not
+// flood the step output
+const secretScanLimit = 100
+
+// secretRule is a kind of secret the scan looks for. Its patterns are extended regular
+// expressions that read the same to grep and to PowerShell's Select-String.
+type secretRule struct {
+	name     string
+	patterns []string
+}
+
+// secretRules are the secrets that are never meant to be committed and are recognizable by their
+// format alone
+var secretRules = []secretRule{
+	{"aws_access_key_id", []string{`(AKIA|ASIA)[0-9A-Z]{16}`}},
+	{"private_key", []string{`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`}},
+	{"github_token", []string{`gh[pousr]_[A-Za-z0-9]{36}`, `github_pat_[A-Za-z0-9_]{82}`}},
+	{"slack_token", []string{`xox[baprs]-[A-Za-z0-9-]{10,}`}},
+	{"google_api_key", []string{`AIza[0-9A-Za-z_-]{35}`}},
+}
+
+// secretFinding is where a secret was found; the secret itself is never recorded
+type secretFinding struct {
+	Rule string `json:"rule"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// scanSecrets looks for committed secrets in the cloned repository before its image is built, so
+// credentials are not baked into an image by accident. The policy is the stricter of the worker's
+// and the one in deployknot.yaml: warn logs the findings, fail fails the deployment over them.
+func (w *Worker) scanSecrets(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, settings *appSettings) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	policy := models.SecretScanPolicy(w.workerConfig.SecretScan).Stricter(settings.secretScan.Policy)
+	if policy == models.SecretScanOff {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Secret scanning is off", "secret_scan", intPtr(stepSecretScan))
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Scanning the repository for committed secrets, policy %s", policy), "secret_scan", intPtr(stepSecretScan))
+	findings, err := findSecrets(sshClient, settings.appDir, settings.secretScan)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Secret scan failed: %v", err)
+		if policy == models.SecretScanWarn {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", errorMsg, "secret_scan", intPtr(stepSecretScan))
+			if err := w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusCompleted, nil); err != nil {
+				w.logger.WithError(err).Error("Failed to update step status to completed")
+			}
+			return nil
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "secret_scan", intPtr(stepSecretScan))
+		w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	w.recordStepOutput(ctx, deploymentID, stepSecretScan, map[string]interface{}{
+		"policy":   policy,
+		"findings": findings,
+	})
+	if len(findings) == 0 {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "No committed secrets found", "secret_scan", intPtr(stepSecretScan))
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	level := models.LogLevelWarn
+	if policy == models.SecretScanFail {
+		level = models.LogLevelError
+	}
+	for _, finding := range findings {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, level, fmt.Sprintf("Possible %s committed at %s:%d", finding.Rule, finding.File, finding.Line), "secret_scan", intPtr(stepSecretScan))
+	}
+
+	summary := fmt.Sprintf("Found %d possible secrets committed to the repository; remove them and rotate them, or exclude false positives with secret_scan.exclude in deployknot.yaml", len(findings))
+	if policy == models.SecretScanWarn {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", summary, "secret_scan", intPtr(stepSecretScan))
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", summary, "secret_scan", intPtr(stepSecretScan))
+	w.updateDeploymentStep(ctx, deploymentID, stepSecretScan, models.DeploymentStatusFailed, &summary)
+	return fmt.Errorf("%s", summary)
+}
+
+// findSecrets runs every rule over the files under appDir and returns the findings that are not
+// excluded, at most secretScanLimit per rule
+func findSecrets(sshClient *targetConn, appDir string, scan models.RepoSecretScan) ([]secretFinding, error) {
+	findings := []secretFinding{}
+	for _, rule := range secretRules {
+		found := 0
+		for _, pattern := range rule.patterns {
+			// Excluded files count towards the limit on the target, so leave room for them
+			output, err := runRemoteCommand(sshClient, sshClient.shell.findPattern(appDir, pattern, secretScanLimit*10))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, output)
+			}
+			for _, line := range strings.Split(output, "\n") {
+				finding, ok := parseSecretFinding(rule.name, line)
+				if !ok || scan.Excludes(finding.File) || found >= secretScanLimit {
+					continue
+				}
+				findings = append(findings, finding)
+				found++
+			}
+		}
+	}
+	return findings, nil
+}
+
+// parseSecretFinding parses a "path:line" line of findPattern's output, with the path relative to
+// the scanned directory in either shell's notation
+func parseSecretFinding(rule, line string) (secretFinding, bool) {
+	line = strings.TrimSpace(line)
+	sep := strings.LastIndex(line, ":")
+	if sep <= 0 {
+		return secretFinding{}, false
+	}
+	number, err := strconv.Atoi(line[sep+1:])
+	if err != nil {
+		return secretFinding{}, false
+	}
+	file := strings.ReplaceAll(line[:sep], `\`, "/")
+	file = strings.TrimPrefix(file, "./")
+	return secretFinding{Rule: rule, File: file, Line: number}, true
+}
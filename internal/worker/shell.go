@@ -0,0 +1,342 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/shellquote"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// validateJobParameters re-validates job parameters that reach commands on the target,
+// so a job enqueued without going through the API cannot inject commands
+func validateJobParameters(repoURL, pat, branch, containerName, repoSubdirectory string) error {
+	if err := models.ValidateRepoURL(repoURL); err != nil {
+		return err
+	}
+	if err := models.ValidateGitHubPAT(pat); err != nil {
+		return err
+	}
+	if err := models.ValidateGitBranch(branch); err != nil {
+		return err
+	}
+	if containerName != "" {
+		if err := models.ValidateContainerName(containerName); err != nil {
+			return fmt.Errorf("invalid container name: %w", err)
+		}
+	}
+	if repoSubdirectory != "" {
+		if err := models.ValidateRepoSubdirectory(repoSubdirectory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shells a target's SSH server can run commands in
+const (
+	shellPOSIX      = "posix"
+	shellPowerShell = "powershell"
+)
+
+// windowsTempDir is where files are uploaded on Windows targets; forward slashes work in
+// PowerShell, git, docker and SFTP alike
+const windowsTempDir = "C:/Windows/Temp"
+
+// remoteShell builds command lines for the shell the target's SSH server runs commands in, so
+// the deployment steps work on Linux targets as well as on Windows Server targets with Docker
+type remoteShell interface {
+	// name identifies the shell, shellPOSIX or shellPowerShell
+	name() string
+	// quote quotes a string so it is passed as a single literal word
+	quote(s string) string
+	// command builds a command line from a program and its arguments, quoting every word
+	command(args ...string) string
+	// all joins commands, running each one only when the previous one succeeded
+	all(cmds ...string) string
+	// inDir runs cmd with dir as the working directory
+	inDir(dir, cmd string) string
+	// setEnv sets an environment variable for the commands that follow it
+	setEnv(key, value string) string
+	// ignoreErrors runs cmd, discarding its error output and exit status
+	ignoreErrors(cmd string) string
+	// runScript runs a script written for the shell, such as a deployknot.yaml hook
+	runScript(script string) string
+	// removeAll removes a file or directory tree, succeeding when it does not exist
+	removeAll(path string) string
+	// isDir succeeds when path is a directory
+	isDir(path string) string
+	// requireDir fails with message when path is not a directory
+	requireDir(path, message string) string
+	// copyFile copies a file, replacing the destination
+	copyFile(src, dst string) string
+	// showFile prints a file's details, a header line and its content
+	showFile(path, header string) string
+	// portListeners prints the listening TCP sockets bound to port, nothing when it is free
+	portListeners(port int) string
+	// httpGet prints the body of url, failing on an error response
+	httpGet(url string, headers map[string]string) string
+	// httpTime requests url and prints how many seconds the request took, failing on an error response
+	httpTime(url string) string
+	// httpStatus requests url and prints the body followed by a line with the status code, whatever
+	// the status; it only fails when no response arrives
+	httpStatus(url string) string
+	// tcpConnect succeeds when a TCP connection to host and port can be opened
+	tcpConnect(host string, port int) string
+	// removeContainersMatching force-removes the containers whose name matches name
+	removeContainersMatching(name string) string
+	// findPattern prints the file and line number, relative to dir, of at most limit lines of
+	// the text files under dir matching the extended regular expression pattern, skipping .git.
+	// The matching text itself is never printed.
+	findPattern(dir, pattern string, limit int) string
+	// tempDir is where files are uploaded to the target
+	tempDir() string
+	// workspaceDir is where the repository is cloned on the target
+	workspaceDir() string
+}
+
+// targetConn is a connection to a target: the runner of its commands together with the shell it
+// runs them in
+type targetConn struct {
+	RemoteRunner
+	shell remoteShell
+	// dial opens a connection from the target, such as to its Docker socket
+	dial func(network, address string) (net.Conn, error)
+}
+
+// detectShell finds out which shell the target's SSH server runs commands in. The probe prints the
+// PowerShell major version in PowerShell, is left unexpanded by cmd.exe and is expanded to its
+// suffix by POSIX shells. Its session is retried like any other command's, and only its exit status
+// is ignored.
+func detectShell(ctx context.Context, runner RemoteRunner) (remoteShell, error) {
+	output, err := runner.Run(ctx, "echo $PSVersionTable.PSVersion.Major")
+	var exitErr *ssh.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	probe := strings.TrimSpace(string(output))
+	switch {
+	case probe != "" && strings.Trim(probe, "0123456789") == "":
+		return powerShell{}, nil
+	case strings.Contains(probe, "$PSVersionTable"):
+		return nil, fmt.Errorf("the target's SSH server runs commands in cmd.exe; set the OpenSSH DefaultShell to PowerShell")
+	default:
+		return posixShell{}, nil
+	}
+}
+
+// checkWindowsSupport rejects deployments that need a POSIX target: deployment scripts are shell
+// scripts, cron jobs are installed with crontab, the Docker Engine API backend forwards a unix socket and GPUs are passed to containers
+// by the NVIDIA Container Toolkit, which only runs on Linux
+func checkWindowsSupport(deploymentType models.DeploymentType, dockerBackend string, options containerOptions) error {
+	if deploymentType == models.DeploymentTypeScript {
+		return fmt.Errorf("script deployments need a target with a POSIX shell")
+	}
+	if deploymentType == models.DeploymentTypeManaged {
+		return fmt.Errorf("managed services need a Linux target to run their official images")
+	}
+	if deploymentType == models.DeploymentTypeCron {
+		return fmt.Errorf("cron deployments install their job in the crontab of a target with a POSIX shell")
+	}
+	if dockerBackend == config.DockerBackendAPI {
+		return fmt.Errorf("the Docker Engine API backend needs a target with a POSIX shell; use the CLI backend for Windows targets")
+	}
+	if options.gpus != "" {
+		return fmt.Errorf("gpus needs a Linux target with the NVIDIA Container Toolkit")
+	}
+	return nil
+}
+
+// posixShell builds commands for sh and compatible shells
+type posixShell struct{}
+
+func (posixShell) name() string { return shellPOSIX }
+
+func (posixShell) quote(s string) string { return shellquote.Quote(s) }
+
+func (posixShell) command(args ...string) string { return shellquote.Join(args...) }
+
+func (posixShell) all(cmds ...string) string { return strings.Join(cmds, " && ") }
+
+func (posixShell) inDir(dir, cmd string) string { return "cd " + shellquote.Quote(dir) + " && " + cmd }
+
+func (posixShell) setEnv(key, value string) string {
+	return "export " + key + "=" + shellquote.Quote(value)
+}
+
+func (posixShell) ignoreErrors(cmd string) string { return cmd + " 2>/dev/null || true" }
+
+func (posixShell) runScript(script string) string { return shellquote.Join("sh", "-c", script) }
+
+func (posixShell) removeAll(path string) string { return shellquote.Join("rm", "-rf", path) }
+
+func (posixShell) isDir(path string) string { return shellquote.Join("test", "-d", path) }
+
+func (posixShell) requireDir(path, message string) string {
+	return "{ test -d " + shellquote.Quote(path) + " || { echo " + shellquote.Quote(message) + " >&2; exit 1; }; }"
+}
+
+func (posixShell) copyFile(src, dst string) string { return shellquote.Join("cp", src, dst) }
+
+func (posixShell) showFile(path, header string) string {
+	return shellquote.Join("ls", "-la", path) + " && echo " + shellquote.Quote(header) + " && " + shellquote.Join("cat", path)
+}
+
+func (posixShell) portListeners(port int) string {
+	return "(ss -ltnH 2>/dev/null || netstat -ltn 2>/dev/null) | awk '{print $4}' | grep -E " + shellquote.Quote(fmt.Sprintf("[:.]%d$", port)) + " || true"
+}
+
+func (posixShell) httpGet(url string, headers map[string]string) string {
+	args := []string{"curl", "-fsSL", "--max-time", "30"}
+	for _, key := range sortedKeys(headers) {
+		args = append(args, "-H", key+": "+headers[key])
+	}
+	return shellquote.Join(append(args, url)...)
+}
+
+// httpTime uses curl, which reports the request time itself, and falls back to wget, which
+// prints nothing and leaves the caller to measure the round trip
+func (posixShell) httpTime(url string) string {
+	return shellquote.Join("curl", "-fsS", "-o", "/dev/null", "-w", "%{time_total}", "--max-time", "5", url) + " 2>&1 || " +
+		shellquote.Join("wget", "-q", "-O", "/dev/null", "-T", "5", url) + " 2>&1"
+}
+
+func (posixShell) findPattern(dir, pattern string, limit int) string {
+	return "cd " + shellquote.Quote(dir) + " && " + shellquote.Join("grep", "-rInE", "--exclude-dir=.git", "-e", pattern, ".") +
+		" | cut -d: -f1,2 | head -n " + strconv.Itoa(limit)
+}
+
+func (posixShell) httpStatus(url string) string {
+	return shellquote.Join("curl", "-sS", "--max-time", "10", "-w", `\n%{http_code}`, url)
+}
+
+// tcpConnect uses nc and falls back to bash's /dev/tcp, one of which nearly every target has
+func (posixShell) tcpConnect(host string, port int) string {
+	return shellquote.Join("nc", "-z", "-w", "5", host, strconv.Itoa(port)) + " 2>/dev/null || " +
+		shellquote.Join("timeout", "5", "bash", "-c", "</dev/tcp/"+shellquote.Quote(host)+"/"+strconv.Itoa(port))
+}
+
+func (posixShell) removeContainersMatching(name string) string {
+	return shellquote.Join("docker", "ps", "-a", "--filter", "name="+name, "--format", "{{.Names}}") + " | xargs -r docker rm -f"
+}
+
+func (posixShell) tempDir() string { return "/tmp" }
+
+func (posixShell) workspaceDir() string { return remoteAppDir }
+
+// powerShell builds commands for Windows PowerShell 5.1 and PowerShell 7, the shell Windows
+// Server targets run OpenSSH commands in. Double quotes are avoided since OpenSSH passes the
+// command line on to powershell.exe as a quoted argument.
+type powerShell struct{}
+
+func (powerShell) name() string { return shellPowerShell }
+
+func (powerShell) quote(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+
+func (p powerShell) command(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = p.quote(arg)
+	}
+	return "& " + strings.Join(quoted, " ")
+}
+
+// all stops at the first native command exiting with an error; cmdlets are run with
+// -ErrorAction Stop, which ends the script on failure
+func (powerShell) all(cmds ...string) string {
+	return strings.Join(cmds, "; if ($LASTEXITCODE) { exit $LASTEXITCODE }; ")
+}
+
+func (p powerShell) inDir(dir, cmd string) string {
+	return "Set-Location -LiteralPath " + p.quote(dir) + " -ErrorAction Stop; " + cmd
+}
+
+func (p powerShell) setEnv(key, value string) string { return "$env:" + key + " = " + p.quote(value) }
+
+func (powerShell) ignoreErrors(cmd string) string {
+	return "try { " + cmd + " 2>$null } catch {}; $global:LASTEXITCODE = 0"
+}
+
+func (p powerShell) runScript(script string) string {
+	return "& ([scriptblock]::Create(" + p.quote(script) + "))"
+}
+
+func (p powerShell) removeAll(path string) string {
+	return "if (Test-Path -LiteralPath " + p.quote(path) + ") { Remove-Item -LiteralPath " + p.quote(path) + " -Recurse -Force -ErrorAction Stop }"
+}
+
+func (p powerShell) isDir(path string) string {
+	return "if (-not (Test-Path -LiteralPath " + p.quote(path) + " -PathType Container)) { exit 1 }"
+}
+
+func (p powerShell) requireDir(path, message string) string {
+	return "if (-not (Test-Path -LiteralPath " + p.quote(path) + " -PathType Container)) { [Console]::Error.WriteLine(" + p.quote(message) + "); exit 1 }"
+}
+
+func (p powerShell) copyFile(src, dst string) string {
+	return "Copy-Item -LiteralPath " + p.quote(src) + " -Destination " + p.quote(dst) + " -Force -ErrorAction Stop"
+}
+
+func (p powerShell) showFile(path, header string) string {
+	return "Get-Item -LiteralPath " + p.quote(path) + " -ErrorAction Stop | Format-List FullName,Length,LastWriteTime; " +
+		p.quote(header) + "; Get-Content -LiteralPath " + p.quote(path) + " -ErrorAction Stop"
+}
+
+func (powerShell) portListeners(port int) string {
+	return fmt.Sprintf("Get-NetTCPConnection -State Listen -LocalPort %d -ErrorAction SilentlyContinue | ForEach-Object { $_.LocalAddress + ':' + $_.LocalPort }", port)
+}
+
+func (p powerShell) httpGet(url string, headers map[string]string) string {
+	pairs := make([]string, 0, len(headers))
+	for _, key := range sortedKeys(headers) {
+		pairs = append(pairs, p.quote(key)+" = "+p.quote(headers[key]))
+	}
+	return "(Invoke-WebRequest -UseBasicParsing -TimeoutSec 30 -Headers @{" + strings.Join(pairs, "; ") + "} -Uri " + p.quote(url) + " -ErrorAction Stop).Content"
+}
+
+func (p powerShell) httpTime(url string) string {
+	return "(Measure-Command { Invoke-WebRequest -UseBasicParsing -TimeoutSec 5 -Uri " + p.quote(url) + " -ErrorAction Stop | Out-Null }).TotalSeconds.ToString([cultureinfo]::InvariantCulture)"
+}
+
+// httpStatus reports error responses through the exception Invoke-WebRequest throws for them,
+// without their body, since reading it differs between Windows PowerShell and PowerShell 7
+func (p powerShell) httpStatus(url string) string {
+	return "try { $r = Invoke-WebRequest -UseBasicParsing -TimeoutSec 10 -Uri " + p.quote(url) + " -ErrorAction Stop; $r.Content; [int]$r.StatusCode } " +
+		"catch { if (-not $_.Exception.Response) { throw }; ''; [int]$_.Exception.Response.StatusCode }"
+}
+
+func (p powerShell) findPattern(dir, pattern string, limit int) string {
+	return fmt.Sprintf("Set-Location -LiteralPath %s -ErrorAction Stop; Get-ChildItem -Recurse -File -Force | Where-Object { $_.FullName -notmatch '[\\\\/]\\.git[\\\\/]' } | "+
+		"Select-String -CaseSensitive -Pattern %s -ErrorAction SilentlyContinue | Select-Object -First %d | "+
+		"ForEach-Object { (Resolve-Path -LiteralPath $_.Path -Relative) + ':' + $_.LineNumber }", p.quote(dir), p.quote(pattern), limit)
+}
+
+func (p powerShell) tcpConnect(host string, port int) string {
+	return fmt.Sprintf("$c = New-Object System.Net.Sockets.TcpClient; if (-not $c.ConnectAsync(%s, %d).Wait(5000)) { exit 1 }; $c.Close()", p.quote(host), port)
+}
+
+func (p powerShell) removeContainersMatching(name string) string {
+	return p.command("docker", "ps", "-a", "--filter", "name="+name, "--format", "{{.Names}}") + " | ForEach-Object { & 'docker' 'rm' '-f' $_ }"
+}
+
+func (powerShell) tempDir() string { return windowsTempDir }
+
+func (powerShell) workspaceDir() string { return windowsTempDir + "/deployknot-app" }
+
+// sortedKeys returns the keys of m in order, so generated commands are stable
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPowerShellQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "''"},
+		{"abc", "'abc'"},
+		{"it's", "'it''s'"},
+		{"''", "''''''"},
+		{"$(Get-Date)", "'$(Get-Date)'"},
+		{"a; Remove-Item C:\\ -Recurse", "'a; Remove-Item C:\\ -Recurse'"},
+		{"`n", "'`n'"},
+	}
+	for _, tt := range tests {
+		if got := (powerShell{}).quote(tt.in); got != tt.want {
+			t.Errorf("powerShell.quote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPowerShellQuoteRoundTrip(t *testing.T) {
+	pwsh, err := exec.LookPath("pwsh")
+	if err != nil {
+		t.Skip("pwsh is not installed")
+	}
+	for _, word := range []string{"it's", "''", "$(Get-Date)", "`n", "a; b", `"double"`} {
+		out, err := exec.Command(pwsh, "-NoProfile", "-Command", "[Console]::Write("+(powerShell{}).quote(word)+")").Output()
+		if err != nil {
+			t.Fatalf("pwsh: %v", err)
+		}
+		if string(out) != word {
+			t.Errorf("powerShell.quote(%q) reached PowerShell as %q", word, out)
+		}
+	}
+}
+
+func TestPowerShellCommand(t *testing.T) {
+	got := (powerShell{}).command("docker", "rm", "-f", "it's")
+	if want := "& 'docker' 'rm' '-f' 'it''s'"; got != want {
+		t.Errorf("powerShell.command = %q, want %q", got, want)
+	}
+}
+
+func TestPosixShellCommandsQuoteHostileArguments(t *testing.T) {
+	dir := t.TempDir()
+	pwned := filepath.Join(dir, "pwned")
+	hostile := "x'; touch " + pwned + "; echo '$(touch " + pwned + ")`touch " + pwned + "`"
+	shell := posixShell{}
+
+	for _, cmd := range []string{
+		shell.command("printf", "%s", hostile),
+		shell.all(shell.setEnv("KEY", hostile), `printf %s "$KEY"`),
+		shell.inDir(dir, shell.command("printf", "%s", hostile)),
+	} {
+		out, err := exec.Command("sh", "-c", cmd).Output()
+		if err != nil {
+			t.Fatalf("sh -c %s: %v", cmd, err)
+		}
+		if string(out) != hostile {
+			t.Errorf("sh -c %s printed %q, want %q", cmd, out, hostile)
+		}
+	}
+	if _, err := os.Stat(pwned); err == nil {
+		t.Fatal("a quoted argument ran a command")
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	tests := []struct {
+		probe string
+		err   error
+		want  string
+	}{
+		{".PSVersion.Major", nil, shellPOSIX},
+		{"", nil, shellPOSIX},
+		{"7", nil, shellPowerShell},
+		{"5\r\n", nil, shellPowerShell},
+		{"$PSVersionTable.PSVersion.Major", nil, ""},
+		// The probe's exit status does not matter, failing to run it does
+		{".PSVersion.Major", &ssh.ExitError{}, shellPOSIX},
+		{"", &ssh.OpenChannelError{Reason: ssh.Prohibited}, ""},
+	}
+	for _, tt := range tests {
+		runner := newFakeRunner(func(string) (string, error) { return tt.probe, tt.err })
+		shell, err := detectShell(context.Background(), runner)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("probe %q, %v: detected %s, want an error", tt.probe, tt.err, shell.name())
+		case tt.want != "" && (err != nil || shell.name() != tt.want):
+			t.Errorf("probe %q, %v: detectShell = %v, %v, want %s", tt.probe, tt.err, shell, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// cosignVerifyTimeout bounds how long verifying an image's signatures with one key may take
+const cosignVerifyTimeout = 2 * time.Minute
+
+// cosignPayload is the part of a verified cosign signature payload the worker uses
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			Digest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifyImageSignature verifies the image of a Kubernetes deployment with cosign against the
+// project's signing keys, and returns the image to deploy: pinned to the verified digest, so the
+// cluster pulls exactly what was verified, or unchanged when it was not verified. Under the warn
+// policy a failed verification is logged; under enforce it is returned as an error.
+func (w *Worker) verifyImageSignature(ctx context.Context, deploymentID uuid.UUID, params kubernetesDeployment) (string, error) {
+	policy := params.signaturePolicy
+	if policy == models.ImageSignatureOff {
+		return params.image, nil
+	}
+	unverified := func(reason string) (string, error) {
+		if policy == models.ImageSignatureEnforce {
+			return "", fmt.Errorf("image signature verification failed: %s", reason)
+		}
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Deploying without a verified image signature: %s", reason), "image_signature", intPtr(stepKubectlApply))
+		return params.image, nil
+	}
+
+	if params.manifestsPath != "" {
+		return unverified("the images of repository manifests cannot be verified, deploy an image instead")
+	}
+	if len(params.signingKeys) == 0 {
+		return unverified("the project has no signing keys")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Verifying the signature of image %s with %d signing keys", params.image, len(params.signingKeys)), "image_signature", intPtr(stepKubectlApply))
+	var lastErr string
+	for i, key := range params.signingKeys {
+		keyPath := filepath.Join(params.workDir, fmt.Sprintf("cosign-%d.pub", i))
+		if err := w.sandbox.writeShared(keyPath, key); err != nil {
+			return "", fmt.Errorf("failed to write signing key: %w", err)
+		}
+		digest, err := w.cosignVerify(ctx, params.homeDir, keyPath, params.image)
+		if err != nil {
+			lastErr = err.Error()
+			continue
+		}
+		pinned := pinImageDigest(params.image, digest)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Image signature verified, deploying %s", pinned), "image_signature", intPtr(stepKubectlApply))
+		return pinned, nil
+	}
+	return unverified(fmt.Sprintf("no signing key of the project verifies %s: %s", params.image, lastErr))
+}
+
+// cosignVerify verifies the signatures of an image with a public key and returns the digest of the
+// verified image
+func (w *Worker) cosignVerify(ctx context.Context, dir, keyPath, image string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cosignVerifyTimeout)
+	defer cancel()
+
+	var stderr strings.Builder
+	cmd := w.sandbox.command(ctx, dir, "cosign", "verify", "--key", keyPath, "--output", "json", image)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v, output: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var payloads []cosignPayload
+	if err := json.Unmarshal(output, &payloads); err != nil {
+		return "", fmt.Errorf("failed to parse cosign output: %v", err)
+	}
+	for _, payload := range payloads {
+		if payload.Critical.Image.Digest != "" {
+			return payload.Critical.Image.Digest, nil
+		}
+	}
+	return "", fmt.Errorf("cosign verified no signature with an image digest")
+}
+
+// pinImageDigest replaces the tag or digest of an image reference with digest, such as
+// ghcr.io/acme/app:v1 with sha256:ab… becoming ghcr.io/acme/app@sha256:ab…
+func pinImageDigest(image, digest string) string {
+	name, _, _ := strings.Cut(image, "@")
+	// A tag follows the last colon after the last slash; earlier colons separate a registry port
+	if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		name = name[:colon]
+	}
+	return name + "@" + digest
+}
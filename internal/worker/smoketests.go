@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// maxSmokeTestDetail bounds the output kept in the result of a smoke test
+const maxSmokeTestDetail = 500
+
+// smokeTestResult is the outcome of one smoke test, recorded in the output of the smoke_tests step
+type smokeTestResult struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Passed     bool   `json:"passed"`
+	DurationMs int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// runSmokeTests runs the repository's smoke tests against the deployed application. Every test
+// runs, so the step output lists the outcome of each; when any fails and rollback is enabled, the
+// previous image is restored.
+func (w *Worker) runSmokeTests(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, settings *appSettings, rollback imageRollback) error {
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepSmokeTests, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	checks := settings.smokeTests.Checks
+	if len(checks) == 0 {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "No smoke tests defined in deployknot.yaml", "smoke_tests", intPtr(stepSmokeTests))
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepSmokeTests, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Running %d smoke tests", len(checks)), "smoke_tests", intPtr(stepSmokeTests))
+	results := make([]smokeTestResult, 0, len(checks))
+	failed := 0
+	for _, check := range checks {
+		result := runSmokeTest(sshClient, settings, check)
+		if result.Passed {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Smoke test %q passed in %dms: %s", result.Name, result.DurationMs, result.Detail), "smoke_test", intPtr(stepSmokeTests))
+		} else {
+			failed++
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", fmt.Sprintf("Smoke test %q failed: %s", result.Name, result.Detail), "smoke_test", intPtr(stepSmokeTests))
+		}
+		results = append(results, result)
+	}
+
+	output := map[string]interface{}{
+		"checks": results,
+		"passed": len(checks) - failed,
+		"failed": failed,
+	}
+	if failed == 0 {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("All %d smoke tests passed", len(checks)), "smoke_tests", intPtr(stepSmokeTests))
+		w.recordStepOutput(ctx, deploymentID, stepSmokeTests, output)
+		if err := w.updateDeploymentStep(ctx, deploymentID, stepSmokeTests, models.DeploymentStatusCompleted, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to completed")
+		}
+		return nil
+	}
+
+	errorMsg := fmt.Sprintf("%d of %d smoke tests failed", failed, len(checks))
+	if settings.smokeTests.Rollback {
+		errorMsg += w.rollBack(ctx, deploymentID, stepSmokeTests, rollback, output)
+	}
+	w.recordStepOutput(ctx, deploymentID, stepSmokeTests, output)
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "smoke_tests", intPtr(stepSmokeTests))
+	w.updateDeploymentStep(ctx, deploymentID, stepSmokeTests, models.DeploymentStatusFailed, &errorMsg)
+	return fmt.Errorf("%s", errorMsg)
+}
+
+// runSmokeTest runs a single smoke test on the target
+func runSmokeTest(sshClient *targetConn, settings *appSettings, check models.SmokeTest) smokeTestResult {
+	started := time.Now()
+	var detail string
+	var err error
+	switch {
+	case check.HTTP != nil:
+		detail, err = httpSmokeTest(sshClient, settings.port, check.HTTP)
+	case check.TCP != nil:
+		detail, err = tcpSmokeTest(sshClient, check.TCP)
+	default:
+		detail, err = commandSmokeTest(sshClient, settings.appDir, check.Command)
+	}
+	if err != nil {
+		detail = err.Error()
+	}
+	if len(detail) > maxSmokeTestDetail {
+		detail = detail[:maxSmokeTestDetail] + "..."
+	}
+
+	return smokeTestResult{
+		Name:       check.Name,
+		Type:       check.Type(),
+		Passed:     err == nil,
+		DurationMs: time.Since(started).Milliseconds(),
+		Detail:     detail,
+	}
+}
+
+// httpSmokeTest requests a path of the application and checks the status and body of the response
+func httpSmokeTest(sshClient *targetConn, appPort int, check *models.HTTPSmokeTest) (string, error) {
+	port := check.Port
+	if port == 0 {
+		port = appPort
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, check.Path)
+
+	output, err := runRemoteCommand(sshClient, sshClient.shell.httpStatus(url))
+	if err != nil {
+		return "", fmt.Errorf("request to %s failed: %v, output: %s", url, err, output)
+	}
+
+	// The status code is the last line of the output, the body everything before it
+	body, statusLine := "", output
+	if i := strings.LastIndex(output, "\n"); i >= 0 {
+		body, statusLine = output[:i], output[i+1:]
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(statusLine))
+	if err != nil {
+		return "", fmt.Errorf("request to %s returned no status code, output: %s", url, output)
+	}
+
+	if status != check.ExpectedStatus() {
+		return "", fmt.Errorf("%s returned status %d, expected %d", url, status, check.ExpectedStatus())
+	}
+	if check.BodyContains != "" && !strings.Contains(body, check.BodyContains) {
+		return "", fmt.Errorf("%s returned status %d but its body does not contain %q", url, status, check.BodyContains)
+	}
+	return fmt.Sprintf("%s returned status %d", url, status), nil
+}
+
+// tcpSmokeTest opens a TCP connection from the target
+func tcpSmokeTest(sshClient *targetConn, check *models.TCPSmokeTest) (string, error) {
+	address := fmt.Sprintf("%s:%d", check.TargetHost(), check.Port)
+	if output, err := runRemoteCommand(sshClient, sshClient.shell.tcpConnect(check.TargetHost(), check.Port)); err != nil {
+		return "", fmt.Errorf("cannot connect to %s: %v, output: %s", address, err, output)
+	}
+	return fmt.Sprintf("connected to %s", address), nil
+}
+
+// commandSmokeTest runs a command on the target from the application root
+func commandSmokeTest(sshClient *targetConn, appDir string, check *models.CommandSmokeTest) (string, error) {
+	output, err := runRemoteCommand(sshClient, sshClient.shell.inDir(appDir, sshClient.shell.runScript(check.Run)))
+	if err != nil {
+		return "", fmt.Errorf("command failed: %v, output: %s", err, output)
+	}
+	if check.OutputContains != "" && !strings.Contains(output, check.OutputContains) {
+		return "", fmt.Errorf("command output does not contain %q: %s", check.OutputContains, output)
+	}
+	return output, nil
+}
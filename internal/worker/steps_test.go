@@ -0,0 +1,114 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLoadRepoConfig(t *testing.T) {
+	runner := newFakeRunner(nil)
+	ctx := context.Background()
+
+	cfg, name, err := loadRepoConfig(ctx, runner.conn(), "/tmp/app")
+	if cfg != nil || name != "" || err != nil {
+		t.Fatalf("without deployknot.yaml: loadRepoConfig = %v, %q, %v, want nil, \"\", nil", cfg, name, err)
+	}
+
+	runner.files["/tmp/app/deployknot.yml"] = []byte("port: 8080\nhealth_check_path: /healthz\n")
+	cfg, name, err = loadRepoConfig(ctx, runner.conn(), "/tmp/app")
+	if err != nil || name != "deployknot.yml" || cfg.Port != 8080 || cfg.HealthCheckPath != "/healthz" {
+		t.Fatalf("loadRepoConfig = %+v, %q, %v, want port 8080 from deployknot.yml", cfg, name, err)
+	}
+
+	// deployknot.yaml wins over deployknot.yml
+	runner.files["/tmp/app/deployknot.yaml"] = []byte("unknown_field: true\n")
+	if _, name, err = loadRepoConfig(ctx, runner.conn(), "/tmp/app"); err == nil || name != "deployknot.yaml" {
+		t.Fatalf("loadRepoConfig with an unknown field = %q, %v, want an error for deployknot.yaml", name, err)
+	}
+
+	runner.files["/tmp/app/deployknot.yaml"] = []byte(strings.Repeat("#", maxRepoConfigSize+1))
+	if _, _, err = loadRepoConfig(ctx, runner.conn(), "/tmp/app"); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("loadRepoConfig of an oversized file = %v, want a size error", err)
+	}
+}
+
+func TestFetchDockerfile(t *testing.T) {
+	const pat = "ghp_secret"
+	runner := newFakeRunner(func(cmd string) (string, error) {
+		if strings.Contains(cmd, "/main/") {
+			return "FROM alpine:3.20\n", nil
+		}
+		return "curl: (22) The requested URL returned error: 404 for token " + pat, exitError(22)
+	})
+
+	dockerfile, err := fetchDockerfile(runner.conn(), "https://github.com/owner/repo", pat, "main", repoCheckout{subdirectory: "services/api"})
+	if err != nil || dockerfile != "FROM alpine:3.20\n" {
+		t.Fatalf("fetchDockerfile = %q, %v", dockerfile, err)
+	}
+	want := posixShell{}.command("curl", "-fsSL", "--max-time", "30", "-H", "Authorization: token "+pat,
+		"https://raw.githubusercontent.com/owner/repo/main/services/api/Dockerfile")
+	if got := runner.ran(); len(got) != 1 || got[0] != want {
+		t.Fatalf("ran %q, want %q", got, want)
+	}
+
+	// A pinned commit is fetched instead of the branch head, and the PAT never reaches the error
+	_, err = fetchDockerfile(runner.conn(), "owner/repo", pat, "main", repoCheckout{commit: strings.Repeat("a", 40)})
+	if err == nil {
+		t.Fatal("fetchDockerfile of a missing Dockerfile succeeded")
+	}
+	if strings.Contains(err.Error(), pat) {
+		t.Fatalf("error %q contains the PAT", err)
+	}
+	if last := runner.ran()[1]; !strings.Contains(last, "/"+strings.Repeat("a", 40)+"/Dockerfile") {
+		t.Fatalf("ran %q, want the Dockerfile of the pinned commit", last)
+	}
+}
+
+func TestCLIBaseImageStore(t *testing.T) {
+	runner := newFakeRunner(func(cmd string) (string, error) {
+		switch {
+		case hasPrefix(cmd, "docker", "image", "inspect", "alpine:3.20"):
+			return "[{}]", nil
+		case hasPrefix(cmd, "docker", "image", "inspect"):
+			return "Error: No such image", exitError(1)
+		case hasPrefix(cmd, "docker", "pull", "private/image"):
+			return "pull access denied", exitError(1)
+		}
+		return "", nil
+	})
+	images := cliBaseImageStore(runner.conn())
+
+	if err := images.present("alpine:3.20"); err != nil {
+		t.Errorf("present(alpine:3.20) = %v, want nil", err)
+	}
+	if err := images.present("node:22"); err == nil {
+		t.Error("present(node:22) = nil, want an error")
+	}
+	if err := images.pull("node:22"); err != nil {
+		t.Errorf("pull(node:22) = %v, want nil", err)
+	}
+	if err := images.pull("private/image"); err == nil || !strings.Contains(err.Error(), "pull access denied") {
+		t.Errorf("pull(private/image) = %v, want the output of docker pull", err)
+	}
+	if got := runner.ran(); len(got) != 4 || !hasPrefix(got[2], "docker", "pull", "node:22") {
+		t.Errorf("ran %q", got)
+	}
+}
+
+func TestCLIContainerState(t *testing.T) {
+	runner := newFakeRunner(func(cmd string) (string, error) {
+		if hasPrefix(cmd, "docker", "inspect", "--format", "{{json .State}}", "app") {
+			return `{"Status":"running","Running":true,"Health":{"Status":"healthy"}}`, nil
+		}
+		return "Error: No such object", exitError(1)
+	})
+
+	state, err := cliContainerState(runner.conn(), "app")()
+	if err != nil || !state.Running || state.Health == nil || state.Health.Status != "healthy" {
+		t.Fatalf("state of app = %+v, %v, want running and healthy", state, err)
+	}
+	if _, err := cliContainerState(runner.conn(), "missing")(); err == nil || !strings.Contains(err.Error(), "No such object") {
+		t.Fatalf("state of missing = %v, want docker's error", err)
+	}
+}
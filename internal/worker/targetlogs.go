@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"deployknot/internal/shellquote"
+
+	"github.com/google/uuid"
+)
+
+// oomKernelPattern matches the kernel messages of the OOM killer
+const oomKernelPattern = "out of memory|oom-kill|oom_reaper|killed process"
+
+// targetClock reads the target's clock as a Unix timestamp, so its journal is read for the
+// deployment window whatever the clock skew between worker and target; it falls back to the
+// worker's clock
+func targetClock(sshClient *targetConn) int64 {
+	output, err := runRemoteCommand(sshClient, "date +%s")
+	if err == nil {
+		if now, err := strconv.ParseInt(output, 10, 64); err == nil {
+			return now
+		}
+	}
+	return time.Now().Unix()
+}
+
+// captureTargetLogs attaches the target's journal entries written since the deployment started:
+// kernel OOM killer messages always, and Docker daemon messages when the deployment failed, so a
+// container that died right away can be diagnosed without logging in to the target. Targets without
+// a systemd journal, or whose SSH user may not read it, get a note instead.
+func (w *Worker) captureTargetLogs(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, since int64, failed bool) {
+	if sshClient.shell.name() != shellPOSIX {
+		return
+	}
+	lines := w.workerConfig.TargetLogLines
+
+	probe, err := runRemoteCommand(sshClient, "command -v journalctl >/dev/null && journalctl -k -n 1 --no-pager 2>&1")
+	switch {
+	case err != nil && probe == "":
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "The target has no systemd journal, its system logs were not captured", "target_logs", nil)
+		return
+	case strings.Contains(probe, "insufficient permissions") || strings.Contains(probe, "not seeing messages from other users"):
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "The SSH user may not read the target's journal, its system logs were not captured; add it to the systemd-journal group", "target_logs", nil)
+		return
+	}
+
+	// grep fails when nothing matched, which leaves the output empty
+	if output, _ := runRemoteCommand(sshClient, fmt.Sprintf(
+		"journalctl -k --since @%d --no-pager -o short-iso 2>/dev/null | grep -iE %s | tail -n %d",
+		since, shellquote.Quote(oomKernelPattern), lines)); output != "" {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", "The kernel's OOM killer ran on the target during the deployment:\n"+output, "target_logs", nil)
+	}
+
+	if !failed {
+		return
+	}
+	output, err := runRemoteCommand(sshClient, fmt.Sprintf(
+		"journalctl -u docker.service --since @%d --no-pager -o short-iso -n %d 2>/dev/null",
+		since, lines))
+	if err == nil && output != "" && !strings.HasPrefix(output, "-- No entries --") {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Docker daemon log on the target during the deployment:\n"+output, "target_logs", nil)
+	}
+}
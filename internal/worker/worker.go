@@ -0,0 +1,1533 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"deployknot/internal/app"
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+	"deployknot/pkg/encryption"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Worker represents the deployment worker
+type Worker struct {
+	queueService      *services.QueueService
+	deploymentService *services.DeploymentService
+	artifactService   *services.ArtifactService
+	sshCA             *services.SSHCAService
+	targets           *services.SSHTargetLimiter
+	// dialTarget opens the SSH connection of a deployment to its target; tests replace it to reach
+	// targets listening elsewhere than port 22
+	dialTarget func(ctx context.Context, host string, config *ssh.ClientConfig) (*ssh.Client, error)
+	// capabilities are advertised with every heartbeat and decide which jobs the worker runs
+	capabilities     models.WorkerCapabilities
+	commandTemplates *services.CommandTemplateService
+	encryptor        *encryption.Encryptor
+	workerConfig     config.WorkerConfig
+	// sandbox confines the local files jobs name and the local commands they run
+	sandbox   *localSandbox
+	logger    *logrus.Logger
+	sshClient *ssh.Client
+	id        string
+}
+
+// ShutdownTimeout bounds how long a worker being shut down is waited for to stop its current job
+const ShutdownTimeout = 30 * time.Second
+
+// concurrencyRetryDelay is how long the worker waits after deferring a job whose concurrency group is busy
+const concurrencyRetryDelay = 2 * time.Second
+
+// cancellationPollInterval is how often a running deployment is checked for cancellation
+const cancellationPollInterval = 5 * time.Second
+
+// uploadedEnvFileName is the name of the env file uploaded to the target's temporary directory
+const uploadedEnvFileName = "deployknot-uploaded.env"
+
+// Step orders as created by initialSteps in the deployment service
+const (
+	stepValidateCredentials = 1
+	stepGitClone            = 2
+	stepDockerBuild         = 3
+	stepDockerRun           = 4
+	stepHealthCheck         = 5
+	stepPullBaseImages      = 6
+	stepSmokeTests          = 7
+	stepLatencyCheck        = 8
+	stepSecretScan          = 9
+	stepRunScript           = 3
+	stepKubectlApply        = 3
+	stepRolloutStatus       = 4
+	stepPullImage           = 2
+	stepCreateVolume        = 3
+	stepInstallCron         = 4
+)
+
+// NewWorker creates a new worker instance
+func NewWorker(queueService *services.QueueService, deploymentService *services.DeploymentService, artifactService *services.ArtifactService, sshCA *services.SSHCAService, targets *services.SSHTargetLimiter, commandTemplates *services.CommandTemplateService, encryptor *encryption.Encryptor, workerConfig config.WorkerConfig, logger *logrus.Logger) *Worker {
+	hostname, _ := os.Hostname()
+	return &Worker{
+		queueService:      queueService,
+		deploymentService: deploymentService,
+		artifactService:   artifactService,
+		sshCA:             sshCA,
+		targets:           targets,
+		dialTarget:        targets.Dial,
+		commandTemplates:  commandTemplates,
+		capabilities: models.WorkerCapabilities{
+			DockerBuild:       workerConfig.DockerBuild,
+			MaxConcurrentJobs: workerConfig.MaxConcurrentJobs,
+			Networks:          workerConfig.Networks,
+		},
+		encryptor:    encryptor,
+		workerConfig: workerConfig,
+		logger:       logger,
+		id:           fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Start starts the worker and returns once ctx is cancelled and its current jobs have stopped
+func (w *Worker) Start(ctx context.Context) error {
+	pool := w.workerConfig.Pool
+	if pool == "" {
+		pool = models.DefaultWorkerPool
+	}
+	w.logger.WithFields(logrus.Fields{
+		"pool":                pool,
+		"docker_build":        w.capabilities.DockerBuild,
+		"max_concurrent_jobs": w.capabilities.MaxConcurrentJobs,
+		"networks":            w.capabilities.Networks,
+		"exec_user":           w.sandbox.userName(),
+	}).Info("Starting deployment worker...")
+	if w.sandbox.user == nil {
+		if w.sandbox.allowUnisolated {
+			w.logger.Warn("git, kubectl and cosign run as the worker's own user and can read its environment, including ENCRYPTION_KEY; run the worker as root to isolate them")
+		} else {
+			w.logger.Warn("Kubernetes deployments are refused: git, kubectl and cosign would run as the worker's own user; run the worker as root, or set WORKER_ALLOW_UNISOLATED_COMMANDS=true")
+		}
+	}
+
+	// Report liveness and capabilities so jobs are routed to the worker and health checks can tell
+	// whether deployments are being processed
+	go w.sendHeartbeats(ctx)
+
+	// Each slot processes one deployment at a time
+	var wg sync.WaitGroup
+	for slot := 0; slot < w.capabilities.MaxConcurrentJobs; slot++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			w.consume(ctx, slot)
+		}(slot)
+	}
+	wg.Wait()
+	return nil
+}
+
+// consume processes the jobs of the worker's pool in one of its slots until ctx is cancelled
+func (w *Worker) consume(ctx context.Context, slot int) {
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.WithField("slot", slot).Info("Worker context cancelled, shutting down...")
+			return
+		default:
+			// Dequeue a job
+			job, err := w.queueService.DequeueJob(ctx, w.workerConfig.Pool)
+			if err != nil {
+				w.logger.WithError(err).Error("Failed to dequeue job")
+				time.Sleep(5 * time.Second)
+				continue
+			}
+
+			if job == nil {
+				// No jobs available, wait a bit
+				time.Sleep(1 * time.Second)
+				continue
+			}
+
+			// Leave jobs this worker cannot run to the other workers of the pool
+			if err := job.CanRunOn(w.capabilities); err != nil {
+				w.passOverJob(ctx, job, err)
+				time.Sleep(concurrencyRetryDelay)
+				continue
+			}
+
+			// Hold the deployment lock so no other worker processes it concurrently
+			acquired, err := w.queueService.AcquireDeploymentLock(ctx, job.DeploymentID, w.id, w.workerConfig.LockTTL)
+			if err != nil {
+				w.logger.WithError(err).Error("Failed to acquire deployment lock")
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			if !acquired {
+				w.logger.WithField("deployment_id", job.DeploymentID).Warn("Deployment is locked by another worker, skipping job")
+				continue
+			}
+
+			// Jobs are delivered at least once through the outbox; skip deployments already picked up
+			if pending, err := w.isDeploymentPending(ctx, job); err != nil || !pending {
+				if err != nil {
+					w.logger.WithError(err).Error("Failed to check deployment status")
+				} else if services.HasOneTimeCredentials(job) {
+					w.deploymentService.WipeOneTimeCredentials(context.Background(), job)
+				}
+				if err := w.queueService.ReleaseDeploymentLock(context.Background(), job.DeploymentID, w.id); err != nil {
+					w.logger.WithError(err).Error("Failed to release deployment lock")
+				}
+				continue
+			}
+
+			// Deployments of the same concurrency group run one at a time
+			concurrencyKey := getStringFromMap(job.Data, "concurrency_key")
+			if concurrencyKey != "" {
+				acquired, err := w.queueService.AcquireConcurrencyLock(ctx, concurrencyKey, job.DeploymentID, w.workerConfig.LockTTL)
+				if err != nil || !acquired {
+					if err != nil {
+						w.logger.WithError(err).Error("Failed to acquire concurrency lock")
+					}
+					w.deferJob(ctx, job)
+					if err := w.queueService.ReleaseDeploymentLock(context.Background(), job.DeploymentID, w.id); err != nil {
+						w.logger.WithError(err).Error("Failed to release deployment lock")
+					}
+					time.Sleep(concurrencyRetryDelay)
+					continue
+				}
+			}
+
+			// Process the job
+			w.logger.WithField("job_id", job.ID).Info("Processing deployment job")
+			if err := w.queueService.SetWorkerJob(ctx, w.id, slot, job.DeploymentID); err != nil {
+				w.logger.WithError(err).Warn("Failed to record worker job")
+			}
+			if err := w.processDeploymentJob(ctx, job); err != nil {
+				w.logger.WithError(err).Error("Failed to process deployment job")
+				// Update job status to failed
+				errorMsg := err.Error()
+				w.queueService.UpdateJobStatus(ctx, job.ID, services.JobStatusFailed, &errorMsg)
+			}
+			if services.HasOneTimeCredentials(job) {
+				w.deploymentService.WipeOneTimeCredentials(context.Background(), job)
+			}
+			if err := w.queueService.ClearWorkerJob(context.Background(), w.id, slot); err != nil {
+				w.logger.WithError(err).Warn("Failed to clear worker job")
+			}
+
+			if concurrencyKey != "" {
+				if err := w.queueService.ReleaseConcurrencyLock(context.Background(), concurrencyKey, job.DeploymentID); err != nil {
+					w.logger.WithError(err).Error("Failed to release concurrency lock")
+				}
+			}
+			if err := w.queueService.ReleaseDeploymentLock(context.Background(), job.DeploymentID, w.id); err != nil {
+				w.logger.WithError(err).Error("Failed to release deployment lock")
+			}
+		}
+	}
+}
+
+// sendHeartbeats records a worker heartbeat every heartbeat interval until ctx is cancelled
+func (w *Worker) sendHeartbeats(ctx context.Context) {
+	expireAfter := 10 * w.workerConfig.HeartbeatInterval
+
+	ticker := time.NewTicker(w.workerConfig.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.queueService.RecordWorkerHeartbeat(ctx, w.id, w.workerConfig.Pool, w.capabilities, expireAfter); err != nil && ctx.Err() == nil {
+			w.logger.WithError(err).Warn("Failed to record worker heartbeat")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isDeploymentPending reports whether the job's deployment is still waiting to be processed
+func (w *Worker) isDeploymentPending(ctx context.Context, job *services.Job) (bool, error) {
+	deployment, err := w.deploymentService.GetDeployment(ctx, job.DeploymentID)
+	if err != nil {
+		return false, err
+	}
+	if deployment.SupersededBy != nil {
+		w.logger.WithFields(logrus.Fields{
+			"job_id":        job.ID,
+			"deployment_id": job.DeploymentID,
+			"superseded_by": *deployment.SupersededBy,
+		}).Info("Deployment was superseded by a newer one, skipping job")
+		errorMsg := fmt.Sprintf("superseded by deployment %s", *deployment.SupersededBy)
+		if err := w.queueService.UpdateJobStatus(ctx, job.ID, services.JobStatusFailed, &errorMsg); err != nil {
+			w.logger.WithError(err).Error("Failed to update job status to failed")
+		}
+		return false, nil
+	}
+	if deployment.Status != models.DeploymentStatusPending {
+		w.logger.WithFields(logrus.Fields{
+			"job_id":        job.ID,
+			"deployment_id": job.DeploymentID,
+			"status":        deployment.Status,
+		}).Warn("Deployment is no longer pending, skipping job")
+		return false, nil
+	}
+	return true, nil
+}
+
+// passOverJob puts a job the worker cannot run back at the end of the queue for the other workers
+// of its pool. The deployment's log notes when no live worker of the pool can run it.
+func (w *Worker) passOverJob(ctx context.Context, job *services.Job, reason error) {
+	w.logger.WithError(reason).WithField("deployment_id", job.DeploymentID).Debug("Passing over deployment job")
+	if job.PassedOver == 0 {
+		pool := job.Pool
+		if pool == "" {
+			pool = models.DefaultWorkerPool
+		}
+		capable, err := w.queueService.HasCapableWorker(ctx, job, 3*w.workerConfig.HeartbeatInterval)
+		if err != nil {
+			w.logger.WithError(err).Warn("Failed to look for a capable worker")
+		} else if !capable {
+			message := fmt.Sprintf("No live worker of the %s pool can run this deployment (%v); it waits for one that can", pool, reason)
+			w.deploymentService.AddDeploymentLog(ctx, job.DeploymentID, "warn", message, "worker_routing", nil)
+		}
+	}
+	if err := w.queueService.PassOverJob(ctx, job); err != nil {
+		w.logger.WithError(err).WithField("deployment_id", job.DeploymentID).Error("Failed to pass over deployment job")
+	}
+}
+
+// deferJob puts a job back at the end of the queue while another deployment of its concurrency group runs
+func (w *Worker) deferJob(ctx context.Context, job *services.Job) {
+	if job.Deferrals == 0 {
+		w.deploymentService.AddDeploymentLog(ctx, job.DeploymentID, "info", "Waiting for the active deployment of its concurrency group to finish", "concurrency", nil)
+	}
+	if err := w.queueService.DeferJob(ctx, job); err != nil {
+		w.logger.WithError(err).WithField("deployment_id", job.DeploymentID).Error("Failed to defer deployment job")
+	}
+}
+
+// watchCancellation calls cancel once the deployment has been cancelled, e.g. replaced by a newer
+// deployment of its concurrency group; it returns when ctx is done
+func (w *Worker) watchCancellation(ctx context.Context, deploymentID uuid.UUID, cancel context.CancelFunc) {
+	ticker := time.NewTicker(cancellationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deployment, err := w.deploymentService.GetDeployment(ctx, deploymentID)
+		if err != nil {
+			continue
+		}
+		if deployment.Status == models.DeploymentStatusCancelled {
+			w.logger.WithField("deployment_id", deploymentID).Warn("Deployment was cancelled, stopping it")
+			cancel()
+			return
+		}
+	}
+}
+
+// processDeploymentJob processes a deployment job
+func (w *Worker) processDeploymentJob(ctx context.Context, job *services.Job) error {
+	w.logger.WithFields(logrus.Fields{
+		"job_id":        job.ID,
+		"deployment_id": job.DeploymentID,
+	}).Info("Processing deployment job")
+
+	// Update deployment status to running
+	if err := w.deploymentService.UpdateDeploymentStatus(ctx, job.DeploymentID, models.DeploymentStatusRunning, nil); err != nil {
+		return fmt.Errorf("failed to update deployment status: %w", err)
+	}
+
+	// Add log entry
+	w.deploymentService.AddDeploymentEvent(ctx, job.DeploymentID, models.LogEventDeploymentStarted, nil, "deployment_start", nil)
+
+	// One-time credentials travel sealed in the job and are only opened in memory
+	if err := services.OpenOneTimeCredentials(w.encryptor, job); err != nil {
+		errorMsg := fmt.Sprintf("Failed to open one-time credentials: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, job.DeploymentID, "error", errorMsg, "deployment_failed", nil)
+		w.markAllStepsAsFailed(ctx, job.DeploymentID, errorMsg)
+		if updateErr := w.deploymentService.UpdateDeploymentStatus(ctx, job.DeploymentID, models.DeploymentStatusFailed, &errorMsg); updateErr != nil {
+			w.logger.WithError(updateErr).Error("Failed to update deployment status to failed")
+		}
+		return fmt.Errorf("failed to open one-time credentials: %w", err)
+	}
+
+	// Stop working on the deployment as soon as it is cancelled
+	jobCtx, cancelJob := context.WithCancel(ctx)
+	defer cancelJob()
+	go w.watchCancellation(jobCtx, job.DeploymentID, cancelJob)
+
+	// Kubernetes targets are driven through kubectl instead of SSH
+	if models.TargetType(getStringFromMap(job.Data, "target_type")) == models.TargetTypeKubernetes {
+		return w.finishDeployment(ctx, job, w.executeKubernetesDeployment(jobCtx, job))
+	}
+
+	// Extract deployment data using robust helpers
+	targetIP := getStringFromMap(job.Data, "target_ip")
+	sshUsername := getStringFromMap(job.Data, "ssh_username")
+	sshPassword := getStringFromMap(job.Data, "ssh_password")
+	githubRepoURL := getStringFromMap(job.Data, "github_repo_url")
+	githubPAT := getStringFromMap(job.Data, "github_pat")
+	githubBranch := getStringFromMap(job.Data, "github_branch")
+	port := getIntFromMap(job.Data, "port")
+	containerName := getStringFromMap(job.Data, "container_name")
+	// New: env_file_path
+	envFilePath := getStringFromMap(job.Data, "env_file_path")
+	environmentVars := getStringFromMap(job.Data, "environment_vars") // fallback only
+	deploymentType := models.DeploymentType(getStringFromMap(job.Data, "deployment_type"))
+	checkout := repoCheckout{
+		subdirectory: getStringFromMap(job.Data, "repo_subdirectory"),
+		lfs:          getBoolFromMap(job.Data, "git_lfs"),
+		commit:       getStringFromMap(job.Data, "commit_sha"),
+	}
+	options, optionsErr := containerOptionsFromJob(job.Data)
+	metadata := deploymentMetadata{
+		deploymentID: job.DeploymentID,
+		projectName:  getStringFromMap(job.Data, "project_name"),
+		targetIP:     targetIP,
+	}
+
+	w.logger.WithFields(logrus.Fields{
+		"target_ip":             targetIP,
+		"ssh_username":          sshUsername,
+		"ssh_password_length":   len(sshPassword),
+		"github_repo_url":       githubRepoURL,
+		"github_pat_length":     len(githubPAT),
+		"github_branch":         githubBranch,
+		"env_file_path":         envFilePath,
+		"env_vars_length":       len(environmentVars),
+		"port":                  port,
+		"container_name":        containerName,
+		"container_name_length": len(containerName),
+		"deployment_type":       deploymentType,
+		"repo_subdirectory":     checkout.subdirectory,
+		"git_lfs":               checkout.lfs,
+		"commit_sha":            checkout.commit,
+		"gpus":                  options.gpus,
+		"extra_run_args":        models.FormatRunArgs(options.extraRunArgs),
+		"job_data_keys":         getMapKeys(job.Data),
+	}).Info("Extracted deployment credentials")
+
+	// Validate required fields; managed services run an official image instead of a repository
+	managed := deploymentType == models.DeploymentTypeManaged
+	if targetIP == "" || sshUsername == "" || (!managed && (githubRepoURL == "" || githubPAT == "" || githubBranch == "")) {
+		errorMsg := "missing required deployment parameters"
+		w.markAllStepsAsFailed(ctx, job.DeploymentID, errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	// Reject parameters that could alter the commands run on the target
+	var err error
+	var service *managedServiceJob
+	if managed {
+		service, err = managedServiceFromJob(job.Data, containerName, port)
+	} else {
+		err = validateJobParameters(githubRepoURL, githubPAT, githubBranch, containerName, checkout.subdirectory)
+	}
+	if err == nil && checkout.commit != "" {
+		err = models.ValidateCommitSHA(checkout.commit)
+	}
+	if err == nil && deploymentType == models.DeploymentTypeCron {
+		err = validateCronSchedule(getStringFromMap(job.Data, "cron_schedule"))
+	}
+	if err == nil {
+		err = optionsErr
+	}
+	if err == nil && envFilePath != "" {
+		envFilePath, err = w.sandbox.localFile(envFilePath)
+	}
+	if err == nil {
+		// Connection variables of managed services are defaults the deployment's own variables override
+		envFilePath, environmentVars, err = withManagedEnv(envFilePath, environmentVars, getStringFromMap(job.Data, "managed_environment_vars"))
+	}
+	if err != nil {
+		errorMsg := fmt.Sprintf("invalid deployment parameters: %v", err)
+		w.markAllStepsAsFailed(ctx, job.DeploymentID, errorMsg)
+		return fmt.Errorf("%s", errorMsg)
+	}
+
+	// A resumed deployment validated its credentials before, unless that is the step it resumes from
+	validate := job.ResumeFrom <= stepValidateCredentials
+
+	// Update step status to running
+	if validate {
+		if err := w.updateDeploymentStep(ctx, job.DeploymentID, stepValidateCredentials, models.DeploymentStatusRunning, nil); err != nil {
+			w.logger.WithError(err).Error("Failed to update step status to running")
+		}
+	}
+
+	// Connect to target server via SSH
+	client, err := w.connectSSH(ctx, job.DeploymentID, targetIP, sshUsername, sshPassword)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Failed to connect to target server: %v", err)
+		w.deploymentService.AddDeploymentEvent(ctx, job.DeploymentID, models.LogEventSSHConnectFailed, map[string]string{
+			"target": targetIP,
+			"error":  err.Error(),
+		}, "ssh_connect", nil)
+		w.markStepAsFailed(ctx, stepValidateCredentials, job.DeploymentID, errorMsg)
+		w.markRemainingStepsAsFailed(ctx, job.DeploymentID, stepValidateCredentials)
+		// Update deployment status to failed
+		if updateErr := w.deploymentService.UpdateDeploymentStatus(ctx, job.DeploymentID, models.DeploymentStatusFailed, &errorMsg); updateErr != nil {
+			w.logger.WithError(updateErr).Error("Failed to update deployment status to failed")
+		}
+		return fmt.Errorf("failed to connect to target server: %w", err)
+	}
+	defer client.Close()
+	// Closing the connection aborts whatever is running on the target
+	stopClosing := context.AfterFunc(jobCtx, func() { client.Close() })
+	defer stopClosing()
+
+	w.deploymentService.AddDeploymentEvent(ctx, job.DeploymentID, models.LogEventSSHConnected, nil, "ssh_connect", nil)
+
+	runner := newSSHRunner(client, newSSHRetryPolicy(w.workerConfig), w.workerConfig.SSHCommandTimeout,
+		w.logger.WithFields(logrus.Fields{"deployment_id": job.DeploymentID, "host": targetIP}), githubPAT, sshPassword)
+
+	// Commands are generated for the shell the target runs them in
+	shell, err := detectShell(jobCtx, runner)
+	if err == nil && shell.name() == shellPowerShell {
+		err = checkWindowsSupport(deploymentType, w.workerConfig.DockerBackend, options)
+	}
+	if err != nil {
+		errorMsg := fmt.Sprintf("Unsupported target: %v", err)
+		w.deploymentService.AddDeploymentLog(ctx, job.DeploymentID, "error", errorMsg, "ssh_connect", nil)
+		w.markStepAsFailed(ctx, stepValidateCredentials, job.DeploymentID, errorMsg)
+		w.markRemainingStepsAsFailed(ctx, job.DeploymentID, stepValidateCredentials)
+		if updateErr := w.deploymentService.UpdateDeploymentStatus(ctx, job.DeploymentID, models.DeploymentStatusFailed, &errorMsg); updateErr != nil {
+			w.logger.WithError(updateErr).Error("Failed to update deployment status to failed")
+		}
+		return fmt.Errorf("unsupported target: %w", err)
+	}
+	sshClient := &targetConn{RemoteRunner: runner, shell: shell, dial: client.Dial}
+	checkout.root = shell.workspaceDir()
+	var windowStart int64
+	if w.workerConfig.TargetLogs && shell.name() == shellPOSIX {
+		windowStart = targetClock(sshClient)
+	}
+	if shell.name() != shellPOSIX {
+		w.deploymentService.AddDeploymentLog(ctx, job.DeploymentID, "info", fmt.Sprintf("Target runs commands in %s, generating commands for it", shell.name()), "ssh_connect", nil)
+	}
+
+	// Validate the target before any destructive cleanup happens
+	if validate {
+		if err := w.validateCredentials(ctx, job.DeploymentID, sshClient, credentialCheck{
+			repoURL:        githubRepoURL,
+			pat:            githubPAT,
+			branch:         githubBranch,
+			port:           port,
+			containerName:  containerName,
+			deploymentType: deploymentType,
+			gitLFS:         checkout.lfs,
+			gpus:           options.gpus,
+		}); err != nil {
+			return w.finishDeployment(ctx, job, err)
+		}
+	}
+
+	// Execute deployment steps (pass envFilePath and environmentVars)
+	var stepsErr error
+	if managed {
+		stepsErr = w.executeManagedServiceSteps(ctx, job.DeploymentID, sshClient, service)
+	} else if deploymentType == models.DeploymentTypeCron {
+		stepsErr = w.executeCronDeploymentSteps(ctx, job.DeploymentID, sshClient, cronDeployment{
+			repoURL:       githubRepoURL,
+			pat:           githubPAT,
+			branch:        githubBranch,
+			checkout:      checkout,
+			envFilePath:   envFilePath,
+			envVars:       environmentVars,
+			containerName: containerName,
+			schedule:      getStringFromMap(job.Data, "cron_schedule"),
+			metadata:      metadata,
+		})
+	} else if deploymentType == models.DeploymentTypeScript {
+		stepsErr = w.executeScriptDeploymentSteps(ctx, job.DeploymentID, sshClient, scriptDeployment{
+			repoURL:       githubRepoURL,
+			pat:           githubPAT,
+			branch:        githubBranch,
+			scriptPath:    getStringFromMap(job.Data, "script_path"),
+			scriptContent: getStringFromMap(job.Data, "script_content"),
+			envFilePath:   envFilePath,
+			envVars:       environmentVars,
+			port:          port,
+			checkout:      checkout,
+			metadata:      metadata,
+		})
+	} else if w.workerConfig.DockerBackend == config.DockerBackendAPI {
+		stepsErr = w.executeDockerAPIDeploymentSteps(ctx, job.DeploymentID, sshClient, githubRepoURL, githubPAT, githubBranch, checkout, envFilePath, environmentVars, port, containerName, options, metadata, job.ResumeFrom)
+	} else {
+		stepsErr = w.executeDeploymentSteps(ctx, job.DeploymentID, sshClient, githubRepoURL, githubPAT, githubBranch, checkout, envFilePath, environmentVars, port, containerName, options, metadata, job.ResumeFrom)
+	}
+	if jobCtx.Err() == nil {
+		if deploymentType != models.DeploymentTypeScript && deploymentType != models.DeploymentTypeCron {
+			w.saveContainerInspect(ctx, job.DeploymentID, sshClient, containerName)
+		}
+		if w.workerConfig.TargetLogs {
+			w.captureTargetLogs(ctx, job.DeploymentID, sshClient, windowStart, stepsErr != nil)
+		}
+	}
+	return w.finishDeployment(ctx, job, stepsErr)
+}
+
+// finishDeployment records the outcome of the deployment steps on the deployment and its job
+func (w *Worker) finishDeployment(ctx context.Context, job *services.Job, stepsErr error) error {
+	// The watchdog releases the lock when it times the deployment out; its outcome stands
+	if owned, err := w.queueService.OwnsDeploymentLock(ctx, job.DeploymentID, w.id); err == nil && !owned {
+		w.logger.WithField("deployment_id", job.DeploymentID).Warn("Deployment lock was released by the watchdog, not recording the outcome")
+		return fmt.Errorf("deployment exceeded the maximum duration")
+	}
+
+	// A cancelled deployment keeps its status, whatever the steps made of the interruption
+	if deployment, err := w.deploymentService.GetDeployment(ctx, job.DeploymentID); err == nil && deployment.Status == models.DeploymentStatusCancelled {
+		w.deploymentService.AddDeploymentEvent(ctx, job.DeploymentID, models.LogEventDeploymentCancelled, nil, "deployment_cancelled", nil)
+		errorMsg := "deployment cancelled"
+		if err := w.queueService.UpdateJobStatus(ctx, job.ID, services.JobStatusFailed, &errorMsg); err != nil {
+			w.logger.WithError(err).Error("Failed to update job status to failed")
+		}
+		return nil
+	}
+
+	if err := stepsErr; err != nil {
+		errorMsg := fmt.Sprintf("Deployment failed: %v", err)
+		w.deploymentService.AddDeploymentEvent(ctx, job.DeploymentID, models.LogEventDeploymentFailed, map[string]string{"error": err.Error()}, "deployment_failed", nil)
+
+		// Update deployment status to failed
+		if updateErr := w.deploymentService.UpdateDeploymentStatus(ctx, job.DeploymentID, models.DeploymentStatusFailed, &errorMsg); updateErr != nil {
+			w.logger.WithError(updateErr).Error("Failed to update deployment status to failed")
+		}
+
+		return err
+	}
+
+	// Update deployment status to completed
+	if err := w.deploymentService.UpdateDeploymentStatus(ctx, job.DeploymentID, models.DeploymentStatusCompleted, nil); err != nil {
+		return fmt.Errorf("failed to update deployment status: %w", err)
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, job.DeploymentID, models.LogEventDeploymentCompleted, nil, "deployment_complete", nil)
+
+	// Update job status to completed
+	if err := w.queueService.UpdateJobStatus(ctx, job.ID, services.JobStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update job status to completed")
+	}
+
+	w.logger.WithField("deployment_id", job.DeploymentID).Info("Deployment completed successfully")
+	return nil
+}
+
+// connectSSH establishes SSH connection to the target server, logging in with a certificate of the
+// SSH certificate authority when it has an active key and with the password otherwise. It waits
+// for the target to have a free connection when other deployments and servers are using it.
+func (w *Worker) connectSSH(ctx context.Context, deploymentID uuid.UUID, host, username, password string) (*ssh.Client, error) {
+	w.logger.WithFields(logrus.Fields{
+		"host":            host,
+		"username":        username,
+		"password_length": len(password),
+	}).Info("Attempting SSH connection")
+
+	auth, err := w.sshCA.AuthMethods(ctx, username, password, fmt.Sprintf("deployknot deployment %s", deploymentID))
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         30 * time.Second,
+	}
+
+	client, err := w.dialTarget(ctx, host, config)
+	if err != nil {
+		w.logger.WithError(err).Error("SSH connection failed")
+		return nil, fmt.Errorf("failed to dial SSH: %w", err)
+	}
+
+	w.logger.Info("SSH connection established successfully")
+	return client, nil
+}
+
+// executeDeploymentSteps executes the deployment steps. They run as a graph, so the base images
+// are pulled while the repository is cloned.
+func (w *Worker) executeDeploymentSteps(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, repoURL, pat, branch string, checkout repoCheckout, envFilePath, envVars string, port int, containerName string, options containerOptions, metadata deploymentMetadata, resumeFrom int) error {
+	// Ensure we have a valid container name, a rollback tags the image by it
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name: %s", containerName), "docker_build", intPtr(stepDockerBuild))
+	}
+
+	// A resumed deployment skips the steps whose results are still on the target
+	resumeFrom = w.resumePoint(ctx, deploymentID, resumeFrom, dockerResumeRequirements(sshClient, checkout.appDir(), containerName))
+
+	// Merge the repository's deployknot.yaml with the request parameters once the clone is there
+	resolveSettings := w.lazyAppSettings(ctx, deploymentID, sshClient, checkout.appDir(), envFilePath, envVars, port, metadata)
+
+	runContainer := func() error {
+		settings, err := resolveSettings()
+		if err != nil {
+			return err
+		}
+		readState := func(container string) containerStateReader { return cliContainerState(sshClient, container) }
+		if err := w.waitForDependencies(ctx, deploymentID, sshClient, options.dependencies, readState); err != nil {
+			return err
+		}
+		if settings.envFilePath == "" {
+			if err := w.runDockerContainer(ctx, deploymentID, sshClient, settings.envVars, settings.port, containerName, options); err != nil {
+				return fmt.Errorf("failed to run Docker container: %w", err)
+			}
+			return nil
+		}
+		// Copy env file to target instance
+		if err := w.copyEnvFileToTarget(ctx, deploymentID, sshClient, settings.envFilePath); err != nil {
+			return fmt.Errorf("failed to copy env file to target: %w", err)
+		}
+		if err := w.runDockerContainerWithEnvFile(ctx, deploymentID, sshClient, settings.envFilePath, settings.port, containerName, options); err != nil {
+			return fmt.Errorf("failed to run Docker container with env file: %w", err)
+		}
+		return nil
+	}
+	rollback := cliImageRollback(sshClient, containerName, runContainer)
+
+	return w.runPipeline(ctx, deploymentID, map[string]func() error{
+		"git_clone": func() error {
+			if err := w.cloneRepository(ctx, deploymentID, sshClient, repoURL, pat, branch, checkout); err != nil {
+				return fmt.Errorf("failed to clone repository: %w", err)
+			}
+			return nil
+		},
+		"secret_scan": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.scanSecrets(ctx, deploymentID, sshClient, settings)
+		},
+		"pull_base_images": func() error {
+			return w.pullBaseImages(ctx, deploymentID, sshClient, repoURL, pat, branch, checkout, cliBaseImageStore(sshClient))
+		},
+		"docker_build": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			if err := w.runHooks(ctx, deploymentID, sshClient, settings.appDir, "pre_build", settings.hooks.PreBuild, stepDockerBuild); err != nil {
+				return err
+			}
+			w.preservePreviousImage(ctx, deploymentID, settings, containerName, rollback)
+			if err := w.buildDockerImage(ctx, deploymentID, sshClient, containerName, settings.appDir, settings.dockerfile); err != nil {
+				return fmt.Errorf("failed to build Docker image: %w", err)
+			}
+			return nil
+		},
+		"docker_run": runContainer,
+		"health_check": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			if err := w.healthCheck(ctx, deploymentID, sshClient, containerName, settings.port, settings.healthCheckPath); err != nil {
+				return fmt.Errorf("health check failed: %w", err)
+			}
+			return w.runHooks(ctx, deploymentID, sshClient, settings.appDir, "post_deploy", settings.hooks.PostDeploy, stepHealthCheck)
+		},
+		"smoke_tests": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.runSmokeTests(ctx, deploymentID, sshClient, settings, rollback)
+		},
+		"latency_check": func() error {
+			settings, err := resolveSettings()
+			if err != nil {
+				return err
+			}
+			return w.runLatencyCheck(ctx, deploymentID, sshClient, settings, rollback)
+		},
+	}, resumeFrom)
+}
+
+// cloneRepository clones the Git repository
+func (w *Worker) cloneRepository(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, repoURL, pat, branch string, checkout repoCheckout) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventGitCloneStarted, nil, "git_clone", intPtr(stepGitClone))
+
+	// First, clean up existing directory
+	cleanupCmd := sshClient.shell.removeAll(checkout.root)
+	cleanupOutput, err := sshClient.Run(ctx, cleanupCmd)
+	if err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Cleanup warning: %v, output: %s", err, string(cleanupOutput)), "git_cleanup", intPtr(stepGitClone))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Existing directory cleaned up", "git_cleanup", intPtr(stepGitClone))
+	}
+
+	// Normalize repository URL to the expected owner/repo format
+	normalized := models.NormalizeRepoURL(repoURL)
+
+	// Prepare git clone command with PAT
+	cloneURL := fmt.Sprintf("https://%s@github.com/%s.git", pat, normalized)
+	cloneCmd := w.stepCommand(ctx, deploymentID, sshClient.shell, models.CommandStepGitClone, stepGitClone, checkout.cloneCommand(sshClient.shell, cloneURL, branch), nil, map[string]string{
+		"URL":    cloneURL,
+		"Branch": branch,
+		"Commit": checkout.commit,
+		"Dir":    checkout.root,
+	})
+	if checkout.subdirectory != "" {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using sparse checkout of %s", checkout.subdirectory), "git_clone", intPtr(stepGitClone))
+	}
+
+	// Execute command; the runner keeps the PAT out of its output
+	outputBytes, err := sshClient.Run(ctx, cloneCmd)
+	output := string(outputBytes)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Git clone failed: %v, output: %s", err, output)
+		w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventGitCloneFailed, map[string]string{"error": fmt.Sprintf("%v, output: %s", err, output)}, "git_clone", intPtr(stepGitClone))
+		w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("git clone failed: %w, output: %s", err, output)
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventGitCloneSucceeded, map[string]string{"output": output}, "git_clone", intPtr(stepGitClone))
+
+	cloneOutput := map[string]interface{}{"branch": branch}
+	if sha, err := runRemoteCommand(sshClient, sshClient.shell.command("git", "-C", checkout.root, "rev-parse", "HEAD")); err != nil {
+		w.logger.WithError(err).Warn("Failed to resolve cloned commit")
+	} else {
+		cloneOutput["commit_sha"] = sha
+	}
+	w.recordStepOutput(ctx, deploymentID, stepGitClone, cloneOutput)
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepGitClone, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// buildDockerImage builds the Docker image
+func (w *Worker) buildDockerImage(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, containerName, appDir, dockerfile string) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerBuildStarted, nil, "docker_build", intPtr(stepDockerBuild))
+
+	// Ensure we have a valid container name
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name: %s", containerName), "docker_build", intPtr(stepDockerBuild))
+	}
+
+	// Comprehensive cleanup to ensure fresh deployment
+	// Step 1: Force remove existing container
+	cleanupCmd := sshClient.shell.ignoreErrors(sshClient.shell.command("docker", "rm", "-f", containerName))
+	if cleanupOutput, err := sshClient.Run(ctx, cleanupCmd); err != nil {
+		w.logger.WithError(err).Warn("Failed to remove existing container")
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Remove existing container warning: %v, output: %s", err, string(cleanupOutput)), "docker_rm", intPtr(stepDockerBuild))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Existing container removed successfully", "docker_rm", intPtr(stepDockerBuild))
+	}
+
+	// Step 2: Remove container image to force rebuild
+	removeImageCmd := sshClient.shell.ignoreErrors(sshClient.shell.command("docker", "rmi", containerName+":latest"))
+	if removeImageOutput, err := sshClient.Run(ctx, removeImageCmd); err != nil {
+		w.logger.WithError(err).Warn("Failed to remove existing image")
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Remove existing image warning: %v, output: %s", err, string(removeImageOutput)), "docker_rmi", intPtr(stepDockerBuild))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Existing image removed successfully", "docker_rmi", intPtr(stepDockerBuild))
+	}
+
+	// Step 3: Clean up any dangling images and containers
+	pruneCmd := sshClient.shell.command("docker", "system", "prune", "-f")
+	if pruneOutput, err := sshClient.Run(ctx, pruneCmd); err != nil {
+		w.logger.WithError(err).Warn("Failed to prune Docker system")
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Docker prune warning: %v, output: %s", err, string(pruneOutput)), "docker_prune", intPtr(stepDockerBuild))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Docker system cleaned successfully", "docker_prune", intPtr(stepDockerBuild))
+	}
+	time.Sleep(2 * time.Second)
+
+	// Build Docker image with the container name as the image tag
+	buildArgs := []string{"docker", "build", "-t", containerName + ":latest"}
+	if dockerfile != "" {
+		buildArgs = append(buildArgs, "-f", dockerfile)
+	}
+	buildArgs = append(buildArgs, ".")
+	buildCmd := sshClient.shell.inDir(appDir, w.stepCommand(ctx, deploymentID, sshClient.shell, models.CommandStepDockerBuild, stepDockerBuild, sshClient.shell.command(buildArgs...), buildArgs, map[string]string{
+		"Image":      containerName + ":latest",
+		"Dockerfile": dockerfile,
+		"Context":    ".",
+	}))
+	rawOutput, err := sshClient.Run(ctx, buildCmd)
+	output := w.buildOutputForLog(ctx, deploymentID, string(rawOutput))
+	if err != nil {
+		errorMsg := fmt.Sprintf("Docker build failed: %v, output: %s", err, output)
+		w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerBuildFailed, map[string]string{"error": fmt.Sprintf("%v, output: %s", err, output)}, "docker_build", intPtr(stepDockerBuild))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker build failed: %w, output: %s", err, output)
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerBuildSucceeded, map[string]string{"output": output}, "docker_build", intPtr(stepDockerBuild))
+
+	buildOutput := map[string]interface{}{"image": containerName + ":latest"}
+	if imageID, err := runRemoteCommand(sshClient, sshClient.shell.command("docker", "image", "inspect", "--format", "{{.Id}}", containerName+":latest")); err != nil {
+		w.logger.WithError(err).Warn("Failed to inspect built image")
+	} else {
+		buildOutput["image_id"] = imageID
+	}
+	w.recordStepOutput(ctx, deploymentID, stepDockerBuild, buildOutput)
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerBuild, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// buildLogTailLines is how many lines of build output are still logged when the full output is
+// kept as an artifact
+const buildLogTailLines = 20
+
+// buildOutputForLog returns the build output to record in the deployment logs. With build log
+// artifacts enabled the full output is stored as the build.log artifact and only its last lines are
+// logged; the full output is logged when storing the artifact fails.
+func (w *Worker) buildOutputForLog(ctx context.Context, deploymentID uuid.UUID, output string) string {
+	if !w.artifactService.BuildLogsEnabled() {
+		return output
+	}
+
+	artifact, err := w.artifactService.SaveBuildLog(ctx, deploymentID, []byte(output))
+	if err != nil {
+		w.logger.WithError(err).WithField("deployment_id", deploymentID).Warn("Failed to store build log artifact")
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Failed to store the build log artifact: %v", err), "docker_build", intPtr(stepDockerBuild))
+		return output
+	}
+
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) <= buildLogTailLines {
+		return output
+	}
+	return fmt.Sprintf("[%d earlier lines in the %s artifact]\n%s", len(lines)-buildLogTailLines, artifact.Name, strings.Join(lines[len(lines)-buildLogTailLines:], "\n"))
+}
+
+// runDockerContainer runs the Docker container
+func (w *Worker) runDockerContainer(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, envVars string, port int, containerName string, options containerOptions) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunStarted, nil, "docker_run", intPtr(stepDockerRun))
+
+	// Ensure we have a valid container name
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name: %s", containerName), "docker_run", intPtr(stepDockerRun))
+	}
+
+	// Stop and remove existing container if running
+	// More aggressive cleanup - stop, remove, and also remove any containers with the same name
+	shell := sshClient.shell
+	stopCmd := shell.all(
+		shell.ignoreErrors(shell.command("docker", "stop", containerName)),
+		shell.ignoreErrors(shell.command("docker", "rm", containerName)),
+		shell.ignoreErrors(shell.removeContainersMatching(containerName)),
+	)
+	stopOutput, err := sshClient.Run(ctx, stopCmd)
+	if err != nil {
+		w.logger.WithError(err).Warn("Failed to stop existing container")
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Stop existing container warning: %v, output: %s", err, string(stopOutput)), "docker_stop", intPtr(stepDockerRun))
+	} else {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Existing container cleanup completed: %s", string(stopOutput)), "docker_stop", intPtr(stepDockerRun))
+	}
+
+	// Wait a moment for cleanup
+	time.Sleep(2 * time.Second)
+
+	// First check if Docker is available
+	dockerCheckCmd := shell.command("docker", "--version")
+	dockerCheckOutput, err := sshClient.Run(ctx, dockerCheckCmd)
+	if err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", fmt.Sprintf("Docker not available: %v, output: %s", err, string(dockerCheckOutput)), "docker_check", intPtr(stepDockerRun))
+		return fmt.Errorf("docker not available: %w, output: %s", err, string(dockerCheckOutput))
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker available: %s", string(dockerCheckOutput)), "docker_check", intPtr(stepDockerRun))
+	w.ensureNetwork(ctx, deploymentID, sshClient, options)
+
+	// Create .env file if environment variables are provided
+	envFilePath := ""
+	if envVars != "" {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Creating .env file with environment variables", "env_setup", intPtr(stepDockerRun))
+
+		// Create a unique env file path for this deployment
+		envFilePath = path.Join(shell.tempDir(), fmt.Sprintf("deployknot-env-%s.env", deploymentID.String()))
+
+		// Process and validate environment variables
+		processedEnvVars := w.processEnvironmentVariables(envVars)
+
+		// Upload the .env file over SFTP so its content never passes through a shell
+		if err := sshClient.CopyFile(ctx, envFilePath, strings.NewReader(processedEnvVars+"\n"), 0600); err != nil {
+			errorMsg := fmt.Sprintf("Failed to create .env file: %v", err)
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "env_setup", intPtr(stepDockerRun))
+			w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+			return fmt.Errorf("failed to create .env file: %w", err)
+		}
+
+		// Verify the .env file was created and has content
+		verifyCmd := shell.showFile(envFilePath, "--- ENV FILE CONTENT ---")
+		verifyOutput, err := sshClient.Run(ctx, verifyCmd)
+		if err != nil {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", fmt.Sprintf("Env file verification warning: %v, output: %s", err, string(verifyOutput)), "env_verify", intPtr(stepDockerRun))
+		} else {
+			w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Environment file created and verified: %s", string(verifyOutput)), "env_verify", intPtr(stepDockerRun))
+		}
+
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Environment variables file created successfully", "env_setup", intPtr(stepDockerRun))
+	}
+
+	// Run container with environment file if available
+	runArgs := []string{"docker", "run", "-d", "--name", containerName, "-p", fmt.Sprintf("%d:%d", port, port)}
+	if envFilePath != "" {
+		runArgs = append(runArgs, "--env-file", envFilePath)
+	}
+	runArgs = append(runArgs, options.runArgs()...)
+	runCmd := w.dockerRunCommand(ctx, deploymentID, shell, append(runArgs, containerName+":latest"), containerName, port)
+
+	// A run that lost its exit status may have started the container, so it is not run again
+	var runBuf bytes.Buffer
+	err = sshClient.RunWithStream(ctx, runCmd, nil, &runBuf, &runBuf)
+	runOutput := runBuf.Bytes()
+	if err != nil {
+		errorMsg := fmt.Sprintf("Docker run failed: %v, output: %s", err, string(runOutput))
+		w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunFailed, map[string]string{"error": fmt.Sprintf("%v, output: %s", err, string(runOutput))}, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker run failed: %w, output: %s", err, string(runOutput))
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunSucceeded, map[string]string{"container_id": strings.TrimSpace(string(runOutput))}, "docker_run", intPtr(stepDockerRun))
+	w.recordStepOutput(ctx, deploymentID, stepDockerRun, map[string]interface{}{
+		"container_id":   strings.TrimSpace(string(runOutput)),
+		"container_name": containerName,
+	})
+
+	if err := w.waitForHealthy(ctx, deploymentID, containerName, cliContainerState(sshClient, containerName)); err != nil {
+		return err
+	}
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// ensureNetwork creates the network the container joins, which the services of an application
+// share. Creating it fails once another service created it; a network that is really missing
+// fails docker run.
+func (w *Worker) ensureNetwork(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, options containerOptions) {
+	if options.network == "" {
+		return
+	}
+	shell := sshClient.shell
+	if _, err := runRemoteCommand(sshClient, shell.ignoreErrors(shell.command("docker", "network", "create", options.network))); err != nil {
+		w.logger.WithError(err).Warn("Failed to create application network")
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Joining network %s as %s", options.network, options.networkAlias), "docker_run", intPtr(stepDockerRun))
+}
+
+// processEnvironmentVariables processes and validates environment variables
+func (w *Worker) processEnvironmentVariables(envVars string) string {
+	// Split by newlines and process each line
+	lines := strings.Split(envVars, "\n")
+	var processedLines []string
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue // Skip empty lines
+		}
+
+		// Skip comments
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Validate the format (should be KEY=VALUE)
+		if !strings.Contains(line, "=") {
+			continue // Skip invalid lines
+		}
+
+		// Ensure proper formatting
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+
+			// Skip names docker would reject or misinterpret
+			if models.ValidateEnvKey(key) != nil {
+				w.logger.WithField("key", key).Warn("Skipping invalid environment variable name")
+				continue
+			}
+
+			// Remove quotes if they exist
+			value = strings.Trim(value, `"'`)
+
+			// Reconstruct the line
+			processedLines = append(processedLines, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+
+	return strings.Join(processedLines, "\n")
+}
+
+// healthCheck performs a health check on the deployed application; with a health check path
+// the application must also answer HTTP requests on it
+func (w *Worker) healthCheck(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, containerName string, port int, healthCheckPath string) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventHealthCheckStarted, nil, "health_check", intPtr(stepHealthCheck))
+
+	// Ensure we have a valid container name
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name for health check: %s", containerName), "health_check", intPtr(stepHealthCheck))
+	}
+
+	// Check if container is running
+	checkCmd := sshClient.shell.command("docker", "ps", "--filter", "name="+containerName, "--format", "table {{.Names}}\t{{.Status}}")
+	output, err := sshClient.Run(ctx, checkCmd)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Health check failed: %v, output: %s", err, string(output))
+		w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventHealthCheckFailed, map[string]string{"error": fmt.Sprintf("%v, output: %s", err, string(output))}, "health_check", intPtr(stepHealthCheck))
+		w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("health check failed: %w, output: %s", err, string(output))
+	}
+
+	healthOutput := map[string]interface{}{"container_name": containerName}
+	if healthCheckPath != "" {
+		latency, err := w.checkHealthEndpoint(ctx, deploymentID, sshClient, port, healthCheckPath)
+		if err != nil {
+			errorMsg := fmt.Sprintf("Health check failed: %v", err)
+			w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventHealthCheckFailed, map[string]string{"error": err.Error()}, "health_check", intPtr(stepHealthCheck))
+			w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusFailed, &errorMsg)
+			return err
+		}
+		healthOutput["health_check_path"] = healthCheckPath
+		healthOutput["latency_ms"] = latency.Milliseconds()
+	}
+
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventHealthCheckPassed, map[string]string{"output": string(output)}, "health_check", intPtr(stepHealthCheck))
+	w.recordStepOutput(ctx, deploymentID, stepHealthCheck, healthOutput)
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepHealthCheck, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// copyEnvFileToTarget copies the env file from the API server to the target instance via SCP
+func (w *Worker) copyEnvFileToTarget(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, localEnvFilePath string) error {
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Copying uploaded .env file to target instance", "env_upload", intPtr(stepDockerRun))
+	file, err := os.Open(localEnvFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open local env file: %w", err)
+	}
+	defer file.Close()
+
+	remotePath := path.Join(sshClient.shell.tempDir(), uploadedEnvFileName)
+	if err := sshClient.CopyFile(ctx, remotePath, file, 0600); err != nil {
+		return fmt.Errorf("failed to copy env file to remote: %w", err)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Uploaded .env file to target instance", "env_upload", intPtr(stepDockerRun))
+	return nil
+}
+
+// runDockerContainerWithEnvFile runs the Docker container using the uploaded env file
+func (w *Worker) runDockerContainerWithEnvFile(ctx context.Context, deploymentID uuid.UUID, sshClient *targetConn, envFilePath string, port int, containerName string, options containerOptions) error {
+	// Update step status to running
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusRunning, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to running")
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Starting Docker container with uploaded .env file", "docker_run", intPtr(stepDockerRun))
+
+	if containerName == "" {
+		containerName = fmt.Sprintf("deployknot-%s", deploymentID.String())
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Using generated container name: %s", containerName), "docker_run", intPtr(stepDockerRun))
+	}
+
+	// Verify the env file exists and has content
+	shell := sshClient.shell
+	remoteEnvPath := path.Join(shell.tempDir(), uploadedEnvFileName)
+	checkEnvCmd := shell.showFile(remoteEnvPath, "---ENV FILE CONTENT---")
+	checkEnvOutput, err := sshClient.Run(ctx, checkEnvCmd)
+	if err != nil {
+		errorMsg := fmt.Sprintf("Env file check failed: %v, output: %s", err, string(checkEnvOutput))
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "env_check", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("env file check failed: %w, output: %s", err, string(checkEnvOutput))
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Env file verified: %s", string(checkEnvOutput)), "env_check", intPtr(stepDockerRun))
+
+	// Check if the Docker image exists
+	checkImageCmd := shell.command("docker", "images", containerName+":latest", "--format", "{{.Repository}}:{{.Tag}}")
+	checkImageOutput, err := sshClient.Run(ctx, checkImageCmd)
+	if err != nil || len(strings.TrimSpace(string(checkImageOutput))) == 0 {
+		errorMsg := fmt.Sprintf("Docker image not found: %s:latest", containerName)
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", errorMsg, "image_check", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker image not found: %s:latest", containerName)
+	}
+
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Docker image found: %s", string(checkImageOutput)), "image_check", intPtr(stepDockerRun))
+
+	// Copy env file to a Docker-accessible location
+	copyEnvCmd := shell.copyFile(remoteEnvPath, "./deployknot.env")
+	_, err = sshClient.Run(ctx, copyEnvCmd)
+	if err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "error", fmt.Sprintf("Failed to copy env file: %v", err), "env_copy", intPtr(stepDockerRun))
+		errorMsg := fmt.Sprintf("Failed to copy env file: %v", err)
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("failed to copy env file: %w", err)
+	}
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", "Env file copied successfully", "env_copy", intPtr(stepDockerRun))
+
+	w.ensureNetwork(ctx, deploymentID, sshClient, options)
+
+	// Build the docker run command with the copied env file
+	runArgs := []string{"docker", "run", "-d", "--name", containerName, "-p", fmt.Sprintf("%d:%d", port, port), "--env-file", "./deployknot.env"}
+	runArgs = append(runArgs, options.runArgs()...)
+	runCmd := w.dockerRunCommand(ctx, deploymentID, shell, append(runArgs, containerName+":latest"), containerName, port)
+
+	// Log the command being executed
+	w.deploymentService.AddDeploymentLog(ctx, deploymentID, "info", fmt.Sprintf("Executing Docker run command: %s", runCmd), "docker_run", intPtr(stepDockerRun))
+
+	// Execute the actual docker run command with detailed error capture. A run that lost its exit
+	// status may have started the container, so it is not run again.
+	var runBuf bytes.Buffer
+	err = sshClient.RunWithStream(ctx, runCmd, nil, &runBuf, &runBuf)
+	runOutput := runBuf.Bytes()
+	if err != nil {
+		errorMsg := fmt.Sprintf("Docker run failed: %v", err)
+		w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunFailed, map[string]string{"error": err.Error()}, "docker_run", intPtr(stepDockerRun))
+		w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusFailed, &errorMsg)
+		return fmt.Errorf("docker run failed: %w", err)
+	}
+
+	containerID := strings.TrimSpace(string(runOutput))
+	w.deploymentService.AddDeploymentEvent(ctx, deploymentID, models.LogEventDockerRunSucceeded, map[string]string{"container_id": containerID}, "docker_run", intPtr(stepDockerRun))
+	w.recordStepOutput(ctx, deploymentID, stepDockerRun, map[string]interface{}{
+		"container_id":   containerID,
+		"container_name": containerName,
+	})
+
+	// Verify the container is running
+	checkRunningCmd := shell.command("docker", "ps", "--filter", "id="+containerID, "--format", "{{.Names}} {{.Status}}")
+	if _, err := sshClient.Run(ctx, checkRunningCmd); err != nil {
+		w.deploymentService.AddDeploymentLog(ctx, deploymentID, "warn", "Container verification failed", "container_check", intPtr(stepDockerRun))
+	}
+
+	if err := w.waitForHealthy(ctx, deploymentID, containerName, cliContainerState(sshClient, containerName)); err != nil {
+		return err
+	}
+
+	// Update step status to completed
+	if err := w.updateDeploymentStep(ctx, deploymentID, stepDockerRun, models.DeploymentStatusCompleted, nil); err != nil {
+		w.logger.WithError(err).Error("Failed to update step status to completed")
+	}
+
+	return nil
+}
+
+// markRemainingStepsAsFailed marks all remaining steps as failed when a deployment fails
+func (w *Worker) markRemainingStepsAsFailed(ctx context.Context, deploymentID uuid.UUID, failedStepOrder int) {
+	// Get all steps for this deployment
+	steps, err := w.deploymentService.GetDeploymentSteps(ctx, deploymentID)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to get deployment steps for marking as failed")
+		return
+	}
+
+	// Mark all steps after the failed step as failed
+	for _, step := range steps {
+		if step.StepOrder > failedStepOrder && step.Status == models.DeploymentStatusPending || step.Status == models.DeploymentStatusRunning {
+			errorMsg := fmt.Sprintf("Step abandoned due to failure in step %d", failedStepOrder)
+			if err := w.updateDeploymentStep(ctx, deploymentID, step.StepOrder, models.DeploymentStatusFailed, &errorMsg); err != nil {
+				w.logger.WithError(err).WithField("step_order", step.StepOrder).Error("Failed to mark step as failed")
+			}
+		}
+	}
+
+	w.logger.WithFields(logrus.Fields{
+		"deployment_id":     deploymentID,
+		"failed_step_order": failedStepOrder,
+	}).Info("Marked remaining steps as failed")
+}
+
+// markAllStepsAsFailed marks all steps as failed with an error message
+func (w *Worker) markAllStepsAsFailed(ctx context.Context, deploymentID uuid.UUID, errorMsg string) {
+	steps, err := w.deploymentService.GetDeploymentSteps(ctx, deploymentID)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to get deployment steps for marking all as failed")
+		return
+	}
+	for _, step := range steps {
+		if step.Status != models.DeploymentStatusCompleted && step.Status != models.DeploymentStatusFailed {
+			if err := w.updateDeploymentStep(ctx, deploymentID, step.StepOrder, models.DeploymentStatusFailed, &errorMsg); err != nil {
+				w.logger.WithError(err).WithField("step_order", step.StepOrder).Error("Failed to mark step as failed (all)")
+			}
+		}
+	}
+	w.logger.WithFields(logrus.Fields{"deployment_id": deploymentID}).Info("Marked all steps as failed")
+}
+
+// markStepAsFailed with an error message
+func (w *Worker) markStepAsFailed(ctx context.Context, stepOrder int, deploymentID uuid.UUID, errorMsg string) error {
+	steps, err := w.deploymentService.GetDeploymentSteps(ctx, deploymentID)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to get deployment steps")
+	}
+	var targetStep *models.DeploymentStep
+	for _, step := range steps {
+		if step.StepOrder == stepOrder {
+			targetStep = step
+			break
+		}
+	}
+	if targetStep == nil {
+		w.logger.WithFields(logrus.Fields{
+			"deployment_id": deploymentID,
+			"step_order":    stepOrder,
+		}).Error("Step not found")
+		return fmt.Errorf("step not found")
+	}
+
+	// Update step status
+	now := time.Now()
+	targetStep.Status = models.DeploymentStatusFailed
+	targetStep.ErrorMessage = &errorMsg
+	targetStep.CompletedAt = &now
+
+	if targetStep.StartedAt != nil {
+		duration := int(now.Sub(*targetStep.StartedAt).Milliseconds())
+		targetStep.DurationMs = &duration
+	}
+
+	// Update the step in the database
+	if err := w.deploymentService.UpdateDeploymentStep(ctx, targetStep); err != nil {
+		w.logger.WithError(err).Error("Failed to update deployment step")
+		return err
+	}
+
+	w.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"step_name":     targetStep.StepName,
+		"step_order":    stepOrder,
+		"status":        models.DeploymentStatusFailed,
+	}).Info("Deployment step updated")
+
+	return nil
+}
+
+// updateDeploymentStep updates a deployment step status
+func (w *Worker) updateDeploymentStep(ctx context.Context, deploymentID uuid.UUID, stepOrder int, status models.DeploymentStatus, errorMessage *string) error {
+	// Get the step by deployment ID and step order
+	steps, err := w.deploymentService.GetDeploymentSteps(ctx, deploymentID)
+	if err != nil {
+		w.logger.WithError(err).Error("Failed to get deployment steps")
+		return err
+	}
+
+	// Find the step with the matching order
+	var targetStep *models.DeploymentStep
+	for _, step := range steps {
+		if step.StepOrder == stepOrder {
+			targetStep = step
+			break
+		}
+	}
+
+	if targetStep == nil {
+		w.logger.WithFields(logrus.Fields{
+			"deployment_id": deploymentID,
+			"step_order":    stepOrder,
+		}).Error("Step not found")
+		return fmt.Errorf("step not found")
+	}
+
+	// Update step status
+	now := time.Now()
+	targetStep.Status = status
+	targetStep.ErrorMessage = errorMessage
+
+	if status == models.DeploymentStatusRunning {
+		targetStep.StartedAt = &now
+	} else if status == models.DeploymentStatusCompleted || status == models.DeploymentStatusFailed {
+		targetStep.CompletedAt = &now
+		if targetStep.StartedAt != nil {
+			duration := int(now.Sub(*targetStep.StartedAt).Milliseconds())
+			targetStep.DurationMs = &duration
+		}
+	}
+
+	// Update the step in the database
+	if err := w.deploymentService.UpdateDeploymentStep(ctx, targetStep); err != nil {
+		w.logger.WithError(err).Error("Failed to update deployment step")
+		return err
+	}
+
+	w.logger.WithFields(logrus.Fields{
+		"deployment_id": deploymentID,
+		"step_name":     targetStep.StepName,
+		"step_order":    stepOrder,
+		"status":        status,
+	}).Info("Deployment step updated")
+
+	return nil
+}
+
+// recordStepOutput adds structured results to a step's output; failures are only logged since the
+// results are informational
+func (w *Worker) recordStepOutput(ctx context.Context, deploymentID uuid.UUID, stepOrder int, output map[string]interface{}) {
+	if err := w.deploymentService.RecordStepOutput(ctx, deploymentID, stepOrder, output); err != nil {
+		w.logger.WithError(err).WithFields(logrus.Fields{
+			"deployment_id": deploymentID,
+			"step_order":    stepOrder,
+		}).Warn("Failed to record step output")
+	}
+}
+
+// Helper function to create int pointer
+func intPtr(i int) *int {
+	return &i
+}
+
+// getMapKeys returns the keys of a map as a slice of strings
+func getMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Helper functions for robust extraction from map[string]interface{}
+func getStringFromMap(m map[string]interface{}, key string) string {
+	if v, ok := m[key]; ok {
+		switch val := v.(type) {
+		case string:
+			return val
+		case fmt.Stringer:
+			return val.String()
+		case float64:
+			// For numbers that should be strings
+			return fmt.Sprintf("%v", val)
+		case int:
+			return fmt.Sprintf("%d", val)
+		case nil:
+			return ""
+		default:
+			return fmt.Sprintf("%v", val)
+		}
+	}
+	return ""
+}
+
+func getBoolFromMap(m map[string]interface{}, key string) bool {
+	if v, ok := m[key]; ok {
+		switch val := v.(type) {
+		case bool:
+			return val
+		case string:
+			return val == "true"
+		}
+	}
+	return false
+}
+
+func getIntFromMap(m map[string]interface{}, key string) int {
+	if v, ok := m[key]; ok {
+		switch val := v.(type) {
+		case int:
+			return val
+		case float64:
+			return int(val)
+		case string:
+			var i int
+			_, err := fmt.Sscanf(val, "%d", &i)
+			if err == nil {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func getStringsFromMap(m map[string]interface{}, key string) []string {
+	var values []string
+	switch val := m[key].(type) {
+	case []string:
+		values = val
+	case []interface{}:
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// Run starts a worker and the watchdog of the application, and blocks until ctx is cancelled and
+// the worker has stopped. The worker binary and the server's embedded worker both run it.
+func Run(ctx context.Context, application *app.App, cfg *config.Config, logger *logrus.Logger) error {
+	if cfg.Worker.Pool != "" {
+		if err := models.ValidateWorkerPool(cfg.Worker.Pool); err != nil {
+			return fmt.Errorf("invalid WORKER_POOL: %w", err)
+		}
+	}
+
+	sandbox, err := newLocalSandbox(cfg.Worker)
+	if err != nil {
+		return err
+	}
+
+	worker := NewWorker(application.QueueService, application.DeploymentService, application.ArtifactService, application.SSHCAService, application.SSHTargetLimiter, application.CommandTemplateService, application.Encryptor, cfg.Worker, logger)
+	worker.sandbox = sandbox
+
+	// Fail or requeue deployments left running by workers that died
+	if cfg.Watchdog.Enabled {
+		go application.Watchdog.Run(ctx)
+	}
+
+	return worker.Start(ctx)
+}
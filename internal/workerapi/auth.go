@@ -0,0 +1,107 @@
+package workerapi
+
+import (
+	"context"
+	"strings"
+
+	"deployknot/internal/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TokenAuthenticator resolves the token a worker presents in its authorization metadata
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*models.WorkerToken, error)
+}
+
+type workerTokenKey struct{}
+
+// authenticate resolves the worker token of a call and adds it to the call's context
+func authenticate(ctx context.Context, tokens TokenAuthenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "a worker token is required")
+	}
+
+	workerToken, err := tokens.Authenticate(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if workerToken == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid or revoked worker token")
+	}
+	return context.WithValue(ctx, workerTokenKey{}, workerToken), nil
+}
+
+// authorize rejects calls made for another worker than the one the call's token belongs to
+func authorize(ctx context.Context, workerID string) error {
+	if workerID == "" {
+		return status.Error(codes.InvalidArgument, "worker_id is required")
+	}
+	workerToken, ok := ctx.Value(workerTokenKey{}).(*models.WorkerToken)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "a worker token is required")
+	}
+	if workerToken.WorkerID != workerID {
+		return status.Errorf(codes.PermissionDenied, "the worker token belongs to worker %s", workerToken.WorkerID)
+	}
+	return nil
+}
+
+// authStream is a server stream whose context carries the worker token
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// AuthOptions returns the server options that require every worker API call to present an active
+// worker token as "authorization: Bearer <token>" metadata
+func AuthOptions(tokens TokenAuthenticator) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := authenticate(ctx, tokens)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticate(stream.Context(), tokens)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authStream{ServerStream: stream, ctx: ctx})
+		}),
+	}
+}
+
+// tokenCredentials sends a worker token with every call
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// WithToken makes a client authenticate with a worker token. Set secure when the connection uses
+// TLS, so the token is never sent in the clear by mistake.
+func WithToken(token string, secure bool) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(tokenCredentials{token: token, secure: secure})
+}
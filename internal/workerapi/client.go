@@ -0,0 +1,62 @@
+package workerapi
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client calls the worker API of a server
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient connects to the worker API at target, e.g. "deployknot-server:9090"
+func NewClient(target string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)),
+	}, opts...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to worker API: %w", err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Heartbeat records that the worker is alive with the capabilities it advertises
+func (c *Client) Heartbeat(ctx context.Context, req *HeartbeatRequest) error {
+	return c.conn.Invoke(ctx, "/"+ServiceName+"/Heartbeat", req, &HeartbeatResponse{})
+}
+
+// LeaseJob waits for the next job of the worker's pool; the response holds no job when none was
+// pending in time
+func (c *Client) LeaseJob(ctx context.Context, req *LeaseJobRequest) (*LeaseJobResponse, error) {
+	resp := &LeaseJobResponse{}
+	if err := c.conn.Invoke(ctx, "/"+ServiceName+"/LeaseJob", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// AppendLogs opens a stream of deployment log lines; CloseAndRecv ends it and reports how many
+// lines were stored
+func (c *Client) AppendLogs(ctx context.Context) (grpc.ClientStreamingClient[AppendLogRequest, AppendLogsResponse], error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+ServiceName+"/AppendLogs")
+	if err != nil {
+		return nil, err
+	}
+	return &grpc.GenericClientStream[AppendLogRequest, AppendLogsResponse]{ClientStream: stream}, nil
+}
+
+// UpdateStatus reports the status of a deployment the worker holds
+func (c *Client) UpdateStatus(ctx context.Context, req *UpdateStatusRequest) error {
+	return c.conn.Invoke(ctx, "/"+ServiceName+"/UpdateStatus", req, &UpdateStatusResponse{})
+}
@@ -0,0 +1,217 @@
+package workerapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"deployknot/internal/config"
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server serves the worker API from the deployment queue and deployment service
+type Server struct {
+	queue       *services.QueueService
+	deployments *services.DeploymentService
+	config      config.WorkerConfig
+	logger      *logrus.Logger
+}
+
+// NewServer creates a new worker API server
+func NewServer(queue *services.QueueService, deployments *services.DeploymentService, cfg config.WorkerConfig, logger *logrus.Logger) *Server {
+	return &Server{
+		queue:       queue,
+		deployments: deployments,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// Heartbeat records that a worker is alive, like the heartbeats of workers sharing Redis
+func (s *Server) Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	if err := authorize(ctx, req.WorkerID); err != nil {
+		return nil, err
+	}
+	if err := s.queue.RecordWorkerHeartbeat(ctx, req.WorkerID, req.Pool, req.Capabilities, 10*s.config.HeartbeatInterval); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &HeartbeatResponse{}, nil
+}
+
+// LeaseJob waits for the next job of the worker's pool and leases its deployment to the worker.
+// Jobs the worker cannot run are left to the other workers of the pool, and jobs whose deployment
+// is no longer pending or whose concurrency group is busy are skipped like the worker skips them.
+func (s *Server) LeaseJob(ctx context.Context, req *LeaseJobRequest) (*LeaseJobResponse, error) {
+	if err := authorize(ctx, req.WorkerID); err != nil {
+		return nil, err
+	}
+	if req.Slot < 0 || req.Slot >= max(req.Capabilities.MaxConcurrentJobs, 1) {
+		return nil, status.Error(codes.InvalidArgument, "slot must be below the worker's max_concurrent_jobs")
+	}
+
+	job, err := s.queue.DequeueJob(ctx, req.Pool)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if job == nil {
+		return &LeaseJobResponse{}, nil
+	}
+
+	if err := job.CanRunOn(req.Capabilities); err != nil {
+		if err := s.queue.PassOverJob(ctx, job); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &LeaseJobResponse{}, nil
+	}
+
+	acquired, err := s.queue.AcquireDeploymentLock(ctx, job.DeploymentID, req.WorkerID, s.config.LockTTL)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !acquired {
+		return &LeaseJobResponse{}, nil
+	}
+
+	deployment, err := s.deployments.GetDeployment(ctx, job.DeploymentID)
+	if err != nil || deployment.Status != models.DeploymentStatusPending || deployment.SupersededBy != nil {
+		s.releaseLease(req.WorkerID, job.DeploymentID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &LeaseJobResponse{}, nil
+	}
+
+	if key, _ := job.Data["concurrency_key"].(string); key != "" {
+		acquired, err := s.queue.AcquireConcurrencyLock(ctx, key, job.DeploymentID, s.config.LockTTL)
+		if err != nil || !acquired {
+			if err := s.queue.DeferJob(ctx, job); err != nil {
+				s.logger.WithError(err).WithField("deployment_id", job.DeploymentID).Error("Failed to defer deployment job")
+			}
+			s.releaseLease(req.WorkerID, job.DeploymentID)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			return &LeaseJobResponse{}, nil
+		}
+	}
+
+	if err := s.queue.SetWorkerJob(ctx, req.WorkerID, req.Slot, job.DeploymentID); err != nil {
+		s.logger.WithError(err).Warn("Failed to record worker job")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"worker_id":     req.WorkerID,
+		"job_id":        job.ID,
+		"deployment_id": job.DeploymentID,
+	}).Info("Deployment job leased through the worker API")
+
+	return &LeaseJobResponse{Job: job, LeaseTTLSeconds: int64(s.config.LockTTL / time.Second)}, nil
+}
+
+// AppendLogs stores the log lines a worker streams for the deployments it holds
+func (s *Server) AppendLogs(stream grpc.ClientStreamingServer[AppendLogRequest, AppendLogsResponse]) error {
+	ctx := stream.Context()
+	held := make(map[uuid.UUID]bool)
+	appended := 0
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&AppendLogsResponse{Appended: appended})
+		}
+		if err != nil {
+			return err
+		}
+
+		if !held[req.DeploymentID] {
+			if err := s.checkLease(ctx, req.WorkerID, req.DeploymentID); err != nil {
+				return err
+			}
+			held[req.DeploymentID] = true
+		}
+		if req.Level != models.LogLevelInfo && req.Level != models.LogLevelWarn && req.Level != models.LogLevelError {
+			return status.Errorf(codes.InvalidArgument, "invalid log level %q", req.Level)
+		}
+		if err := s.deployments.AddDeploymentLog(ctx, req.DeploymentID, req.Level, req.Message, req.TaskName, req.StepOrder); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		appended++
+	}
+}
+
+// UpdateStatus records the status of a deployment the worker holds. A final status completes the
+// deployment's job and ends the lease.
+func (s *Server) UpdateStatus(ctx context.Context, req *UpdateStatusRequest) (*UpdateStatusResponse, error) {
+	if err := s.checkLease(ctx, req.WorkerID, req.DeploymentID); err != nil {
+		return nil, err
+	}
+
+	var jobStatus services.JobStatus
+	switch req.Status {
+	case models.DeploymentStatusRunning:
+	case models.DeploymentStatusCompleted:
+		jobStatus = services.JobStatusCompleted
+	case models.DeploymentStatusFailed, models.DeploymentStatusCancelled, models.DeploymentStatusAborted:
+		jobStatus = services.JobStatusFailed
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "a worker cannot set status %q", req.Status)
+	}
+
+	if err := s.deployments.UpdateDeploymentStatus(ctx, req.DeploymentID, req.Status, req.ErrorMessage); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if jobStatus == "" {
+		return &UpdateStatusResponse{}, nil
+	}
+
+	job, err := s.queue.GetDeploymentJob(ctx, req.DeploymentID)
+	if err != nil {
+		s.logger.WithError(err).WithField("deployment_id", req.DeploymentID).Warn("Failed to get deployment job")
+	} else {
+		if err := s.queue.UpdateJobStatus(ctx, job.ID, jobStatus, req.ErrorMessage); err != nil {
+			s.logger.WithError(err).Warn("Failed to update job status")
+		}
+		if services.HasOneTimeCredentials(job) {
+			s.deployments.WipeOneTimeCredentials(context.Background(), job)
+		}
+		if key, _ := job.Data["concurrency_key"].(string); key != "" {
+			if err := s.queue.ReleaseConcurrencyLock(context.Background(), key, req.DeploymentID); err != nil {
+				s.logger.WithError(err).Error("Failed to release concurrency lock")
+			}
+		}
+	}
+	if err := s.queue.ClearWorkerJob(context.Background(), req.WorkerID, req.Slot); err != nil {
+		s.logger.WithError(err).Warn("Failed to clear worker job")
+	}
+	s.releaseLease(req.WorkerID, req.DeploymentID)
+	return &UpdateStatusResponse{}, nil
+}
+
+// checkLease rejects requests for deployments the worker does not hold
+func (s *Server) checkLease(ctx context.Context, workerID string, deploymentID uuid.UUID) error {
+	if err := authorize(ctx, workerID); err != nil {
+		return err
+	}
+	owns, err := s.queue.OwnsDeploymentLock(ctx, deploymentID, workerID)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if !owns {
+		return status.Errorf(codes.PermissionDenied, "worker %s does not hold deployment %s", workerID, deploymentID)
+	}
+	return nil
+}
+
+// releaseLease releases the worker's hold on a deployment
+func (s *Server) releaseLease(workerID string, deploymentID uuid.UUID) {
+	if err := s.queue.ReleaseDeploymentLock(context.Background(), deploymentID, workerID); err != nil {
+		s.logger.WithError(err).WithField("deployment_id", deploymentID).Error("Failed to release deployment lock")
+	}
+}
@@ -0,0 +1,127 @@
+// Package workerapi is the gRPC API workers use to lease deployment jobs, append deployment logs
+// and report deployment statuses, instead of sharing the server's PostgreSQL and Redis.
+package workerapi
+
+import (
+	"context"
+
+	"deployknot/internal/models"
+	"deployknot/internal/services"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the fully qualified name of the worker API service
+const ServiceName = "deployknot.worker.v1.WorkerService"
+
+// HeartbeatRequest records that a worker is alive with the capabilities it advertises
+type HeartbeatRequest struct {
+	WorkerID     string                    `json:"worker_id"`
+	Pool         string                    `json:"pool,omitempty"`
+	Capabilities models.WorkerCapabilities `json:"capabilities"`
+}
+
+// HeartbeatResponse is the response to a heartbeat
+type HeartbeatResponse struct{}
+
+// LeaseJobRequest asks for the next job of a pool the worker can run. Slot tells the worker's
+// concurrent jobs apart; a worker running one job at a time leaves it 0.
+type LeaseJobRequest struct {
+	WorkerID     string                    `json:"worker_id"`
+	Pool         string                    `json:"pool,omitempty"`
+	Capabilities models.WorkerCapabilities `json:"capabilities"`
+	Slot         int                       `json:"slot,omitempty"`
+}
+
+// LeaseJobResponse holds the leased job, or no job when none was pending within the lease's wait.
+// The worker holds the deployment until it reports a final status or the lease expires.
+type LeaseJobResponse struct {
+	Job             *services.Job `json:"job,omitempty"`
+	LeaseTTLSeconds int64         `json:"lease_ttl_seconds,omitempty"`
+}
+
+// AppendLogRequest is one deployment log line streamed by the worker holding the deployment
+type AppendLogRequest struct {
+	WorkerID     string          `json:"worker_id"`
+	DeploymentID uuid.UUID       `json:"deployment_id"`
+	Level        models.LogLevel `json:"level"`
+	Message      string          `json:"message"`
+	TaskName     string          `json:"task_name,omitempty"`
+	StepOrder    *int            `json:"step_order,omitempty"`
+}
+
+// AppendLogsResponse reports how many log lines of the stream were stored
+type AppendLogsResponse struct {
+	Appended int `json:"appended"`
+}
+
+// UpdateStatusRequest reports the status of a deployment the worker holds. A final status ends the
+// worker's lease of the deployment.
+type UpdateStatusRequest struct {
+	WorkerID     string                  `json:"worker_id"`
+	DeploymentID uuid.UUID               `json:"deployment_id"`
+	Status       models.DeploymentStatus `json:"status"`
+	ErrorMessage *string                 `json:"error_message,omitempty"`
+	Slot         int                     `json:"slot,omitempty"`
+}
+
+// UpdateStatusResponse is the response to a status update
+type UpdateStatusResponse struct{}
+
+// WorkerServiceServer is the server side of the worker API
+type WorkerServiceServer interface {
+	Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error)
+	LeaseJob(ctx context.Context, req *LeaseJobRequest) (*LeaseJobResponse, error)
+	AppendLogs(stream grpc.ClientStreamingServer[AppendLogRequest, AppendLogsResponse]) error
+	UpdateStatus(ctx context.Context, req *UpdateStatusRequest) (*UpdateStatusResponse, error)
+}
+
+// RegisterWorkerServiceServer registers the worker API on a gRPC server
+func RegisterWorkerServiceServer(s grpc.ServiceRegistrar, srv WorkerServiceServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+func unaryHandler[Req, Resp any](method string, call func(WorkerServiceServer, context.Context, *Req) (*Resp, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(WorkerServiceServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(WorkerServiceServer), ctx, req.(*Req))
+		})
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*WorkerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Heartbeat",
+			Handler:    unaryHandler("Heartbeat", WorkerServiceServer.Heartbeat),
+		},
+		{
+			MethodName: "LeaseJob",
+			Handler:    unaryHandler("LeaseJob", WorkerServiceServer.LeaseJob),
+		},
+		{
+			MethodName: "UpdateStatus",
+			Handler:    unaryHandler("UpdateStatus", WorkerServiceServer.UpdateStatus),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "AppendLogs",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(WorkerServiceServer).AppendLogs(&grpc.GenericServerStream[AppendLogRequest, AppendLogsResponse]{ServerStream: stream})
+			},
+			ClientStreams: true,
+		},
+	},
+}
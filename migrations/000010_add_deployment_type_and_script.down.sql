@@ -0,0 +1,5 @@
+-- Remove deployment_type and script fields from deployments table
+ALTER TABLE deploy_knot.deployments
+DROP COLUMN IF EXISTS script_content,
+DROP COLUMN IF EXISTS script_path,
+DROP COLUMN IF EXISTS deployment_type;
@@ -0,0 +1,5 @@
+-- Add deployment_type and script fields to deployments table
+ALTER TABLE deploy_knot.deployments
+ADD COLUMN deployment_type VARCHAR(20) NOT NULL DEFAULT 'docker' CHECK (deployment_type IN ('docker', 'script')),
+ADD COLUMN script_path VARCHAR(500),
+ADD COLUMN script_content TEXT;
@@ -0,0 +1,7 @@
+-- Remove target_type and Kubernetes target fields from deployments table
+ALTER TABLE deploy_knot.deployments
+DROP COLUMN IF EXISTS manifests_path,
+DROP COLUMN IF EXISTS image,
+DROP COLUMN IF EXISTS kubernetes_namespace,
+DROP COLUMN IF EXISTS kubeconfig_encrypted,
+DROP COLUMN IF EXISTS target_type;
@@ -0,0 +1,7 @@
+-- Add target_type and Kubernetes target fields to deployments table
+ALTER TABLE deploy_knot.deployments
+ADD COLUMN target_type VARCHAR(20) NOT NULL DEFAULT 'ssh' CHECK (target_type IN ('ssh', 'kubernetes')),
+ADD COLUMN kubeconfig_encrypted TEXT,
+ADD COLUMN kubernetes_namespace VARCHAR(253),
+ADD COLUMN image VARCHAR(500),
+ADD COLUMN manifests_path VARCHAR(500);
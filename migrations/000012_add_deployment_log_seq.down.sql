@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS deploy_knot.idx_deployment_logs_deployment_id_seq;
+
+ALTER TABLE deploy_knot.deployment_logs DROP COLUMN IF EXISTS seq;
@@ -0,0 +1,4 @@
+-- Monotonic sequence used to fetch logs incrementally
+ALTER TABLE deploy_knot.deployment_logs ADD COLUMN seq BIGSERIAL;
+
+CREATE INDEX idx_deployment_logs_deployment_id_seq ON deploy_knot.deployment_logs(deployment_id, seq);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS deploy_knot.idx_deployments_target_ip;
+DROP INDEX IF EXISTS deploy_knot.idx_deployments_user_id_status;
+DROP INDEX IF EXISTS deploy_knot.idx_users_role;
+
+ALTER TABLE deploy_knot.users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,9 @@
+-- Add role to users
+ALTER TABLE deploy_knot.users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin'));
+
+CREATE INDEX idx_users_role ON deploy_knot.users(role);
+
+-- Speed up cross-user deployment queries by status and target
+CREATE INDEX IF NOT EXISTS idx_deployments_user_id_status ON deploy_knot.deployments(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_deployments_target_ip ON deploy_knot.deployments(target_ip);
@@ -0,0 +1,13 @@
+-- Deployment jobs waiting to be published to the Redis queue
+CREATE TABLE deploy_knot.job_outbox (
+    id UUID PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    payload_encrypted TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX idx_job_outbox_unpublished ON deploy_knot.job_outbox(created_at) WHERE published_at IS NULL;
+CREATE INDEX idx_job_outbox_deployment_id ON deploy_knot.job_outbox(deployment_id);
@@ -0,0 +1,20 @@
+DROP POLICY IF EXISTS organization_isolation ON deploy_knot.deployment_logs;
+ALTER TABLE deploy_knot.deployment_logs NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_logs DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS organization_isolation ON deploy_knot.deployment_steps;
+ALTER TABLE deploy_knot.deployment_steps NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_steps DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS organization_isolation ON deploy_knot.deployments;
+ALTER TABLE deploy_knot.deployments NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployments DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS deploy_knot.idx_deployments_organization_id;
+DROP INDEX IF EXISTS deploy_knot.idx_users_organization_id;
+
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE deploy_knot.users DROP COLUMN IF EXISTS organization_id;
+
+DROP TRIGGER IF EXISTS update_organizations_updated_at ON deploy_knot.organizations;
+DROP TABLE IF EXISTS deploy_knot.organizations;
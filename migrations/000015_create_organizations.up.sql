@@ -0,0 +1,50 @@
+-- Organizations group users; the isolation mode is chosen at creation
+CREATE TABLE deploy_knot.organizations (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    isolation_mode VARCHAR(20) NOT NULL DEFAULT 'shared'
+        CHECK (isolation_mode IN ('shared', 'rls')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_organizations_updated_at
+    BEFORE UPDATE ON deploy_knot.organizations
+    FOR EACH ROW EXECUTE FUNCTION deploy_knot.update_updated_at_column();
+
+ALTER TABLE deploy_knot.users ADD COLUMN organization_id UUID
+    REFERENCES deploy_knot.organizations(id) ON DELETE SET NULL;
+ALTER TABLE deploy_knot.deployments ADD COLUMN organization_id UUID
+    REFERENCES deploy_knot.organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_users_organization_id ON deploy_knot.users(organization_id);
+CREATE INDEX idx_deployments_organization_id ON deploy_knot.deployments(organization_id);
+
+-- Row-level security: a session that sets deploy_knot.organization_id only sees that
+-- organization's deployments, steps and logs. Sessions without it (workers, the watchdog,
+-- admin endpoints) see every row. FORCE applies the policies to the table owner too;
+-- superusers and BYPASSRLS roles are never subject to them.
+ALTER TABLE deploy_knot.deployments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployments FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.deployments
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR organization_id = NULLIF(current_setting('deploy_knot.organization_id', true), '')::uuid
+    );
+
+ALTER TABLE deploy_knot.deployment_steps ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_steps FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.deployment_steps
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR deployment_id IN (SELECT id FROM deploy_knot.deployments)
+    );
+
+ALTER TABLE deploy_knot.deployment_logs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_logs FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.deployment_logs
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR deployment_id IN (SELECT id FROM deploy_knot.deployments)
+    );
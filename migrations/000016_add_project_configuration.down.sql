@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS update_project_targets_updated_at ON deploy_knot.project_targets;
+DROP TABLE IF EXISTS deploy_knot.project_targets;
+
+DROP INDEX IF EXISTS deploy_knot.idx_deployment_templates_project_id_name;
+ALTER TABLE deploy_knot.deployment_templates DROP COLUMN IF EXISTS project_id;
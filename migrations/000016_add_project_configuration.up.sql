@@ -0,0 +1,25 @@
+-- Templates belong to a project; names are unique within it
+ALTER TABLE deploy_knot.deployment_templates ADD COLUMN project_id UUID
+    REFERENCES deploy_knot.projects(id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX idx_deployment_templates_project_id_name
+    ON deploy_knot.deployment_templates(project_id, name) WHERE project_id IS NOT NULL;
+
+-- Named deployment targets of a project; credentials are never stored here
+CREATE TABLE deploy_knot.project_targets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    target_type VARCHAR(20) NOT NULL DEFAULT 'ssh' CHECK (target_type IN ('ssh', 'kubernetes')),
+    target_ip VARCHAR(255),
+    ssh_username VARCHAR(100),
+    port INTEGER,
+    kubernetes_namespace VARCHAR(253),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (project_id, name)
+);
+
+CREATE TRIGGER update_project_targets_updated_at
+    BEFORE UPDATE ON deploy_knot.project_targets
+    FOR EACH ROW EXECUTE FUNCTION deploy_knot.update_updated_at_column();
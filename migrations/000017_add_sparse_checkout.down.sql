@@ -0,0 +1,4 @@
+-- Remove monorepo checkout options from deployments table
+ALTER TABLE deploy_knot.deployments
+DROP COLUMN IF EXISTS git_lfs,
+DROP COLUMN IF EXISTS repo_subdirectory;
@@ -0,0 +1,4 @@
+-- Add monorepo checkout options to deployments table
+ALTER TABLE deploy_knot.deployments
+ADD COLUMN repo_subdirectory VARCHAR(500),
+ADD COLUMN git_lfs BOOLEAN NOT NULL DEFAULT FALSE;
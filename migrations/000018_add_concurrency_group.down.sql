@@ -0,0 +1,5 @@
+-- Remove concurrency groups from deployments table
+DROP INDEX IF EXISTS deploy_knot.idx_deployments_active_concurrency_group;
+
+ALTER TABLE deploy_knot.deployments
+DROP COLUMN IF EXISTS concurrency_group;
@@ -0,0 +1,7 @@
+-- Add concurrency groups to deployments table
+ALTER TABLE deploy_knot.deployments
+ADD COLUMN concurrency_group VARCHAR(200);
+
+-- Active deployments are looked up by group when a new deployment is created
+CREATE INDEX idx_deployments_active_concurrency_group ON deploy_knot.deployments(concurrency_group)
+WHERE status IN ('pending', 'running');
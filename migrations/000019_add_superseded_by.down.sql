@@ -0,0 +1,5 @@
+-- Remove superseded deployment links from deployments table
+DROP INDEX IF EXISTS deploy_knot.idx_deployments_pending_branch;
+
+ALTER TABLE deploy_knot.deployments
+DROP COLUMN IF EXISTS superseded_by;
@@ -0,0 +1,7 @@
+-- Link deployments superseded while still queued to the newer deployment that replaced them
+ALTER TABLE deploy_knot.deployments
+ADD COLUMN superseded_by UUID REFERENCES deploy_knot.deployments(id) ON DELETE SET NULL;
+
+-- Pending deployments are looked up by project, branch and target when a new one is created
+CREATE INDEX idx_deployments_pending_branch ON deploy_knot.deployments(github_branch, target_ip)
+WHERE status = 'pending';
@@ -0,0 +1,27 @@
+-- Audit trail of interactive shells opened in deployment containers
+CREATE TABLE deploy_knot.exec_sessions (
+    id UUID PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES deploy_knot.users(id) ON DELETE SET NULL,
+    username VARCHAR(255) NOT NULL,
+    client_ip VARCHAR(64),
+    container_name VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMP WITH TIME ZONE,
+    exit_code INTEGER,
+    end_reason TEXT,
+    -- Everything the user typed, capped at the configured transcript size
+    input_transcript TEXT NOT NULL DEFAULT '',
+    input_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    output_bytes BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_exec_sessions_deployment_id ON deploy_knot.exec_sessions(deployment_id, started_at);
+
+ALTER TABLE deploy_knot.exec_sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.exec_sessions FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.exec_sessions
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR deployment_id IN (SELECT id FROM deploy_knot.deployments)
+    );
@@ -0,0 +1,21 @@
+-- Comments team members leave on deployments, e.g. why one was rolled back
+CREATE TABLE deploy_knot.deployment_comments (
+    id UUID PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES deploy_knot.users(id) ON DELETE SET NULL,
+    username VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    mentions TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_deployment_comments_deployment_id ON deploy_knot.deployment_comments(deployment_id, created_at);
+CREATE INDEX idx_deployment_comments_mentions ON deploy_knot.deployment_comments USING GIN (mentions);
+
+ALTER TABLE deploy_knot.deployment_comments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_comments FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.deployment_comments
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR deployment_id IN (SELECT id FROM deploy_knot.deployments)
+    );
@@ -0,0 +1,14 @@
+-- Named deployment filters users save for dashboards and the CLI
+CREATE TABLE deploy_knot.saved_views (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    filters JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TRIGGER update_saved_views_updated_at
+    BEFORE UPDATE ON deploy_knot.saved_views
+    FOR EACH ROW EXECUTE FUNCTION deploy_knot.update_updated_at_column();
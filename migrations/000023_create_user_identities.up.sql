@@ -0,0 +1,14 @@
+-- External identities (GitHub, Google, OIDC) users sign in with, alongside or instead of a password
+CREATE TABLE deploy_knot.user_identities (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+CREATE INDEX idx_user_identities_user_id ON deploy_knot.user_identities(user_id);
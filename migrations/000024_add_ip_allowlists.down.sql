@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS deploy_knot.audit_events;
+ALTER TABLE deploy_knot.organizations DROP COLUMN IF EXISTS allowed_cidrs;
@@ -0,0 +1,19 @@
+-- Networks an organization's members may create deployments and reach targets from; empty allows any
+ALTER TABLE deploy_knot.organizations ADD COLUMN allowed_cidrs TEXT[] NOT NULL DEFAULT '{}';
+
+-- Security-relevant events such as requests blocked by an IP allowlist
+CREATE TABLE deploy_knot.audit_events (
+    id UUID PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    user_id UUID REFERENCES deploy_knot.users(id) ON DELETE SET NULL,
+    username VARCHAR(255),
+    organization_id UUID REFERENCES deploy_knot.organizations(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_events_created_at ON deploy_knot.audit_events(created_at DESC);
+CREATE INDEX idx_audit_events_user_id ON deploy_knot.audit_events(user_id);
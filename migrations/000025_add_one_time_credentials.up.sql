@@ -0,0 +1,2 @@
+-- Deployments whose credentials were used once and never stored
+ALTER TABLE deploy_knot.deployments ADD COLUMN one_time_credentials BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS worker_pool;
+ALTER TABLE deploy_knot.project_targets DROP COLUMN IF EXISTS worker_pool;
+ALTER TABLE deploy_knot.projects DROP COLUMN IF EXISTS worker_pool;
@@ -0,0 +1,4 @@
+-- Worker pools: projects and their targets may require deployments to run on workers of a named pool
+ALTER TABLE deploy_knot.projects ADD COLUMN worker_pool VARCHAR(63);
+ALTER TABLE deploy_knot.project_targets ADD COLUMN worker_pool VARCHAR(63);
+ALTER TABLE deploy_knot.deployments ADD COLUMN worker_pool VARCHAR(63);
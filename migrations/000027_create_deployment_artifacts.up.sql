@@ -0,0 +1,23 @@
+-- Files kept with a deployment, such as the full output of its image build, stored gzip-compressed
+CREATE TABLE deploy_knot.deployment_artifacts (
+    id UUID PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    compressed_size BIGINT NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    content BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (deployment_id, name)
+);
+
+CREATE INDEX idx_deployment_artifacts_created_at ON deploy_knot.deployment_artifacts(created_at);
+
+ALTER TABLE deploy_knot.deployment_artifacts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_artifacts FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.deployment_artifacts
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR deployment_id IN (SELECT id FROM deploy_knot.deployments)
+    );
@@ -0,0 +1,2 @@
+-- Structured results recorded by a step, e.g. the commit it cloned or the container it started
+ALTER TABLE deploy_knot.deployment_steps ADD COLUMN output JSONB;
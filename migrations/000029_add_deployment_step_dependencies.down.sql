@@ -0,0 +1 @@
+ALTER TABLE deploy_knot.deployment_steps DROP COLUMN IF EXISTS depends_on;
@@ -0,0 +1,6 @@
+-- Orders of the steps that must complete before a step can start; steps without dependencies run
+-- as soon as the deployment starts, in parallel with each other
+ALTER TABLE deploy_knot.deployment_steps ADD COLUMN depends_on INTEGER[] NOT NULL DEFAULT '{}';
+
+-- Steps created before the pipeline ran as a graph ran one after another
+UPDATE deploy_knot.deployment_steps SET depends_on = ARRAY[step_order - 1] WHERE step_order > 1;
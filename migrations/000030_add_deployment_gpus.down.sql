@@ -0,0 +1 @@
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS gpus;
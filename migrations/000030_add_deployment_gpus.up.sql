@@ -0,0 +1,2 @@
+-- GPUs: docker deployments may request "all" GPUs of the target or a comma-separated list of devices
+ALTER TABLE deploy_knot.deployments ADD COLUMN gpus VARCHAR(255);
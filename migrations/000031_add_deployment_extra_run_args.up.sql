@@ -0,0 +1,2 @@
+-- Extra docker run arguments of a deployment, restricted to allowlisted flags and stored normalized
+ALTER TABLE deploy_knot.deployments ADD COLUMN extra_run_args TEXT;
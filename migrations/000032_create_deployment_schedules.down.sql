@@ -0,0 +1,2 @@
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS schedule_id;
+DROP TABLE IF EXISTS deploy_knot.deployment_schedules;
@@ -0,0 +1,31 @@
+-- Cron schedules that redeploy a source deployment's parameters, e.g. a nightly redeploy of main
+CREATE TABLE deploy_knot.deployment_schedules (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    project VARCHAR(500) NOT NULL,
+    source_deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    github_branch VARCHAR(255),
+    cron_expression VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_deployment_id UUID REFERENCES deploy_knot.deployments(id) ON DELETE SET NULL,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX idx_deployment_schedules_due ON deploy_knot.deployment_schedules(next_run_at) WHERE enabled;
+CREATE INDEX idx_deployment_schedules_project ON deploy_knot.deployment_schedules(project);
+
+CREATE TRIGGER update_deployment_schedules_updated_at
+    BEFORE UPDATE ON deploy_knot.deployment_schedules
+    FOR EACH ROW EXECUTE FUNCTION deploy_knot.update_updated_at_column();
+
+-- The schedule that created a deployment
+ALTER TABLE deploy_knot.deployments
+    ADD COLUMN schedule_id UUID REFERENCES deploy_knot.deployment_schedules(id) ON DELETE SET NULL;
+CREATE INDEX idx_deployments_schedule_id ON deploy_knot.deployments(schedule_id) WHERE schedule_id IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS deploy_knot.project_freeze_windows;
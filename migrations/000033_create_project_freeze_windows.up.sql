@@ -0,0 +1,12 @@
+-- Change freeze windows of a project: its deployments are rejected while one is in effect
+CREATE TABLE deploy_knot.project_freeze_windows (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_project_freeze_windows_project_id_ends_at ON deploy_knot.project_freeze_windows(project_id, ends_at);
@@ -0,0 +1,2 @@
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS commit_sha;
+DROP TABLE IF EXISTS deploy_knot.api_keys;
@@ -0,0 +1,15 @@
+-- API keys authenticate CI pipelines as their user; only a SHA-256 hash of each key is stored
+CREATE TABLE deploy_knot.api_keys (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- The commit a deployment checks out instead of the head of its branch
+ALTER TABLE deploy_knot.deployments ADD COLUMN commit_sha VARCHAR(40);
@@ -0,0 +1,4 @@
+ALTER TABLE deploy_knot.job_outbox DROP COLUMN IF EXISTS held;
+
+DROP TABLE IF EXISTS deploy_knot.deployment_gates;
+DROP TABLE IF EXISTS deploy_knot.project_gates;
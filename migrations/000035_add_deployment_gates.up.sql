@@ -0,0 +1,28 @@
+-- External checks a project requires before its deployments start, such as CI reporting "tests-passed"
+CREATE TABLE deploy_knot.project_gates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    timeout_minutes INTEGER NOT NULL CHECK (timeout_minutes > 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (project_id, name)
+);
+
+-- The gates a deployment waits for; its job is held in the outbox until every gate has passed
+CREATE TABLE deploy_knot.deployment_gates (
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'passed', 'failed', 'timed_out')),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    details TEXT,
+    url TEXT,
+    reported_by UUID REFERENCES deploy_knot.users(id) ON DELETE SET NULL,
+    reported_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (deployment_id, name)
+);
+
+CREATE INDEX idx_deployment_gates_waiting_expires_at ON deploy_knot.deployment_gates(expires_at) WHERE status = 'waiting';
+
+ALTER TABLE deploy_knot.job_outbox ADD COLUMN held BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS deploy_knot.deployment_escalations;
+DROP TABLE IF EXISTS deploy_knot.project_escalations;
+DROP TABLE IF EXISTS deploy_knot.project_digests;
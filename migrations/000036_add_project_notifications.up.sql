@@ -0,0 +1,32 @@
+-- A summary of a project's deployments sent to a notification channel on a cron schedule
+CREATE TABLE deploy_knot.project_digests (
+    project_id UUID PRIMARY KEY REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    channel VARCHAR(63) NOT NULL,
+    cron_expression VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    -- Unset until the digest is scheduled by the notifier, and again after its schedule changed
+    next_send_at TIMESTAMP WITH TIME ZONE,
+    last_sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Policies notifying a secondary channel when a deployment of a project stays failed
+CREATE TABLE deploy_knot.project_escalations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    -- Deployment names the policy applies to; all of them when empty
+    environments TEXT[] NOT NULL DEFAULT '{}',
+    after_minutes INTEGER NOT NULL CHECK (after_minutes > 0),
+    channel VARCHAR(63) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_project_escalations_project_id ON deploy_knot.project_escalations(project_id);
+
+-- The failed deployments each escalation policy has been sent for, so every failure escalates once
+CREATE TABLE deploy_knot.deployment_escalations (
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    escalation_id UUID NOT NULL REFERENCES deploy_knot.project_escalations(id) ON DELETE CASCADE,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (deployment_id, escalation_id)
+);
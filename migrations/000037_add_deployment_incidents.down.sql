@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS deploy_knot.incident_deployments;
+DROP TABLE IF EXISTS deploy_knot.deployment_incidents;
+DROP TABLE IF EXISTS deploy_knot.project_incident_policies;
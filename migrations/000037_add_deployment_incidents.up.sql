@@ -0,0 +1,41 @@
+-- The incident management service failed deployments of a project are reported to
+CREATE TABLE deploy_knot.project_incident_policies (
+    project_id UUID PRIMARY KEY REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    service VARCHAR(63) NOT NULL,
+    -- Deployment names incidents are raised for; all of them when empty
+    environments TEXT[] NOT NULL DEFAULT '{}',
+    severity VARCHAR(20) NOT NULL DEFAULT 'critical' CHECK (severity IN ('critical', 'error', 'warning', 'info')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Incidents raised for the failed deployments of a project environment, resolved once a later
+-- deployment of the environment completes
+CREATE TABLE deploy_knot.deployment_incidents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    -- The deployment name, empty for deployments without one
+    environment VARCHAR(200) NOT NULL,
+    service VARCHAR(63) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'triggered' CHECK (status IN ('triggered', 'resolved')),
+    deployment_id UUID REFERENCES deploy_knot.deployments(id) ON DELETE SET NULL,
+    failures INTEGER NOT NULL DEFAULT 1,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resolved_by_deployment_id UUID REFERENCES deploy_knot.deployments(id) ON DELETE SET NULL,
+    -- The event still to be delivered to the service; delivery is retried until it succeeds
+    pending_event VARCHAR(20) CHECK (pending_event IN ('trigger', 'resolve')),
+    last_error TEXT,
+    triggered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX idx_deployment_incidents_triggered ON deploy_knot.deployment_incidents(project_id, environment)
+    WHERE status = 'triggered';
+CREATE INDEX idx_deployment_incidents_pending_event ON deploy_knot.deployment_incidents(triggered_at)
+    WHERE pending_event IS NOT NULL;
+
+-- The incident each failed deployment was added to
+CREATE TABLE deploy_knot.incident_deployments (
+    deployment_id UUID PRIMARY KEY REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    incident_id UUID NOT NULL REFERENCES deploy_knot.deployment_incidents(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS deploy_knot.project_on_call;
+
+ALTER TABLE deploy_knot.projects DROP COLUMN IF EXISTS owner;
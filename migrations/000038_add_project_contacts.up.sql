@@ -0,0 +1,16 @@
+ALTER TABLE deploy_knot.projects ADD COLUMN owner VARCHAR(200);
+
+-- Who is on call for a project, synchronized from an external schedule. It is kept apart from the
+-- project so schedule changes do not change the project's ETag.
+CREATE TABLE deploy_knot.project_on_call (
+    project_id UUID PRIMARY KEY REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    contact VARCHAR(200),
+    source VARCHAR(100),
+    -- When name took over; it is kept while the same person is reported again
+    since TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- When the shift ends; a shift that ended without a handoff leaves the project without anyone on call
+    until TIMESTAMP WITH TIME ZONE,
+    previous_name VARCHAR(200),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1 @@
+ALTER TABLE deploy_knot.projects DROP COLUMN IF EXISTS public_status;
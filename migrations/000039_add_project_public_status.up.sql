@@ -0,0 +1,2 @@
+-- Projects opt in to a public status page, readable without an account
+ALTER TABLE deploy_knot.projects ADD COLUMN public_status BOOLEAN NOT NULL DEFAULT FALSE;
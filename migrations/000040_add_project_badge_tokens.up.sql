@@ -0,0 +1,8 @@
+-- Tokens that give access to the status badge of a project without a public status page. Only a
+-- hash of each token is stored; a project has at most one.
+CREATE TABLE deploy_knot.project_badge_tokens (
+    project_id UUID PRIMARY KEY REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL,
+    token_prefix VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE deploy_knot.deployment_logs DROP COLUMN IF EXISTS params;
+ALTER TABLE deploy_knot.deployment_logs DROP COLUMN IF EXISTS event_code;
+ALTER TABLE deploy_knot.deployment_logs DROP COLUMN IF EXISTS category;
@@ -0,0 +1,5 @@
+-- Log entries record what they are about in a form clients can filter and localize: the category of
+-- the deployment they come from, and for event entries a code with the parameters of the message
+ALTER TABLE deploy_knot.deployment_logs ADD COLUMN category VARCHAR(20);
+ALTER TABLE deploy_knot.deployment_logs ADD COLUMN event_code VARCHAR(64);
+ALTER TABLE deploy_knot.deployment_logs ADD COLUMN params JSONB;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS deploy_knot.idx_deployment_logs_seq;
+DROP TABLE IF EXISTS deploy_knot.log_sink_cursors;
@@ -0,0 +1,12 @@
+-- How far each external log sink has received the deployment logs
+CREATE TABLE deploy_knot.log_sink_cursors (
+    sink VARCHAR(64) PRIMARY KEY,
+    last_seq BIGINT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    shipped_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Sinks read the logs of all deployments in sequence order
+CREATE INDEX idx_deployment_logs_seq ON deploy_knot.deployment_logs(seq);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS deploy_knot.idx_deployments_failure_category;
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS failure_category;
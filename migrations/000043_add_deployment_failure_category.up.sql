@@ -0,0 +1,5 @@
+-- The likely cause of a failed deployment, classified from the error of its failed step
+ALTER TABLE deploy_knot.deployments ADD COLUMN failure_category VARCHAR(20);
+
+CREATE INDEX idx_deployments_failure_category ON deploy_knot.deployments(project_name, failure_category)
+    WHERE failure_category IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Command templates overriding the commands workers run on targets, by step
+CREATE TABLE deploy_knot.command_templates (
+    step VARCHAR(50) PRIMARY KEY,
+    template TEXT NOT NULL,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
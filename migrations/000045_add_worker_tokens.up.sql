@@ -0,0 +1,16 @@
+-- Tokens authenticating workers to the worker API; only a SHA-256 hash of each token is stored.
+-- Revoked tokens are kept as the revocation list of decommissioned workers.
+CREATE TABLE deploy_knot.worker_tokens (
+    id UUID PRIMARY KEY,
+    worker_id VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by VARCHAR(255)
+);
+
+-- A worker has at most one active token
+CREATE UNIQUE INDEX idx_worker_tokens_active_worker ON deploy_knot.worker_tokens(worker_id) WHERE revoked_at IS NULL;
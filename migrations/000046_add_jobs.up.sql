@@ -0,0 +1,19 @@
+-- Lifecycle of deployment jobs, kept after the jobs expire from Redis. Job data, which carries
+-- credentials, is not stored.
+CREATE TABLE deploy_knot.jobs (
+    id UUID PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    pool VARCHAR(100) NOT NULL DEFAULT '',
+    requeues INTEGER NOT NULL DEFAULT 0,
+    deferrals INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_jobs_deployment_id ON deploy_knot.jobs(deployment_id);
+CREATE INDEX idx_jobs_created_at ON deploy_knot.jobs(created_at DESC);
@@ -0,0 +1,12 @@
+-- The GitHub deployment each deployment is mirrored to, and the last of its statuses reported to
+-- GitHub. Reporting a status is retried until it succeeds or runs out of attempts.
+CREATE TABLE deploy_knot.github_deployments (
+    deployment_id UUID PRIMARY KEY REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    github_deployment_id BIGINT,
+    reported_status VARCHAR(20),
+    -- The status the last failed attempts tried to report, and how many attempts failed
+    attempted_status VARCHAR(20),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
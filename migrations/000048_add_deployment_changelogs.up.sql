@@ -0,0 +1,21 @@
+-- The commits a deployment adds on top of the last completed deployment of its environment,
+-- taken from the GitHub compare API when the deployment is created
+CREATE TABLE deploy_knot.deployment_changelogs (
+    deployment_id UUID PRIMARY KEY REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    base_deployment_id UUID REFERENCES deploy_knot.deployments(id) ON DELETE SET NULL,
+    base_commit_sha VARCHAR(40) NOT NULL,
+    head_commit_sha VARCHAR(40) NOT NULL,
+    -- Subject, author and links of each commit, oldest first; GitHub lists at most 250 of them
+    commits JSONB NOT NULL DEFAULT '[]',
+    total_commits INTEGER NOT NULL DEFAULT 0,
+    compare_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE deploy_knot.deployment_changelogs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE deploy_knot.deployment_changelogs FORCE ROW LEVEL SECURITY;
+CREATE POLICY organization_isolation ON deploy_knot.deployment_changelogs
+    USING (
+        NULLIF(current_setting('deploy_knot.organization_id', true), '') IS NULL
+        OR deployment_id IN (SELECT id FROM deploy_knot.deployments)
+    );
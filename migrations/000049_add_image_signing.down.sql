@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS deploy_knot.project_signing_keys;
+ALTER TABLE deploy_knot.projects DROP COLUMN IF EXISTS image_signature_policy;
@@ -0,0 +1,15 @@
+-- Whether the images of a project's deployments must carry a cosign signature by one of its keys
+ALTER TABLE deploy_knot.projects ADD COLUMN image_signature_policy VARCHAR(20) NOT NULL DEFAULT 'off'
+    CHECK (image_signature_policy IN ('off', 'warn', 'enforce'));
+
+-- The cosign public keys the images of a project's deployments are verified with
+CREATE TABLE deploy_knot.project_signing_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES deploy_knot.projects(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    public_key TEXT NOT NULL,
+    -- SHA-256 of the DER encoded key, to tell keys apart without comparing them
+    fingerprint VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (project_id, name)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE deploy_knot.project_targets DROP COLUMN IF EXISTS bootstrapped_at;
+ALTER TABLE deploy_knot.project_targets DROP COLUMN IF EXISTS ssh_host_key_fingerprint;
+ALTER TABLE deploy_knot.project_targets DROP COLUMN IF EXISTS ssh_key_fingerprint;
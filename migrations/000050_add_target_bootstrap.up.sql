@@ -0,0 +1,5 @@
+-- What "server bootstrap-target" set up on an SSH target: the fingerprints of the deploy user's
+-- key and of the host key seen at the time. The credentials themselves are never stored here.
+ALTER TABLE deploy_knot.project_targets ADD COLUMN ssh_key_fingerprint VARCHAR(100);
+ALTER TABLE deploy_knot.project_targets ADD COLUMN ssh_host_key_fingerprint VARCHAR(100);
+ALTER TABLE deploy_knot.project_targets ADD COLUMN bootstrapped_at TIMESTAMP WITH TIME ZONE;
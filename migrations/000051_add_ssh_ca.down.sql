@@ -0,0 +1 @@
+DROP TABLE IF EXISTS deploy_knot.ssh_ca_keys;
@@ -0,0 +1,17 @@
+-- Keys of the SSH certificate authority the workers' short-lived certificates are signed with. The
+-- active key signs; pending keys are trusted ahead of a rotation and retiring keys after one.
+CREATE TABLE deploy_knot.ssh_ca_keys (
+    id UUID PRIMARY KEY,
+    name VARCHAR(200) NOT NULL UNIQUE,
+    -- Authorized keys line of the public key, as listed in the targets' TrustedUserCAKeys
+    public_key TEXT NOT NULL,
+    private_key_encrypted TEXT NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'active', 'retiring')),
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    activated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- At most one key signs certificates
+CREATE UNIQUE INDEX idx_ssh_ca_keys_active ON deploy_knot.ssh_ca_keys(status) WHERE status = 'active';
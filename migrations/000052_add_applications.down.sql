@@ -0,0 +1,4 @@
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS application_service;
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS application_release_id;
+DROP TABLE IF EXISTS deploy_knot.application_releases;
+DROP TABLE IF EXISTS deploy_knot.applications;
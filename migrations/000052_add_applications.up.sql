@@ -0,0 +1,36 @@
+-- Applications group the container services a user deploys together, such as an api, a worker
+-- and a frontend. Services are deployed in their order, on a network shared by the application.
+CREATE TABLE deploy_knot.applications (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    name VARCHAR(63) NOT NULL,
+    description TEXT,
+    -- Array of {name, github_repo_url, github_branch, port, repo_subdirectory}, in deployment order
+    services JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TRIGGER update_applications_updated_at
+    BEFORE UPDATE ON deploy_knot.applications
+    FOR EACH ROW EXECUTE FUNCTION deploy_knot.update_updated_at_column();
+
+-- A release deploys every service of an application once; each service is a deployment
+CREATE TABLE deploy_knot.application_releases (
+    id UUID PRIMARY KEY,
+    application_id UUID NOT NULL REFERENCES deploy_knot.applications(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    target_ip VARCHAR(45) NOT NULL,
+    -- Names of the services released, in deployment order
+    services TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_application_releases_application ON deploy_knot.application_releases(application_id, created_at DESC);
+
+-- The application release a deployment deploys a service of
+ALTER TABLE deploy_knot.deployments
+    ADD COLUMN application_release_id UUID REFERENCES deploy_knot.application_releases(id) ON DELETE SET NULL,
+    ADD COLUMN application_service VARCHAR(63);
+CREATE INDEX idx_deployments_application_release_id ON deploy_knot.deployments(application_release_id) WHERE application_release_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE deploy_knot.application_releases DROP COLUMN IF EXISTS dependencies;
@@ -0,0 +1,5 @@
+-- The services each service of an application release waited for, by service name:
+-- {"api": [{"service": "db", "condition": "healthy"}]}. A service without dependencies waits for
+-- the service before it.
+ALTER TABLE deploy_knot.application_releases
+    ADD COLUMN dependencies JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS deploy_knot.managed_services;
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS managed_services;
+DELETE FROM deploy_knot.deployments WHERE deployment_type = 'managed';
+ALTER TABLE deploy_knot.deployments
+    DROP CONSTRAINT IF EXISTS deployments_deployment_type_check,
+    ADD CONSTRAINT deployments_deployment_type_check CHECK (deployment_type IN ('docker', 'script'));
@@ -0,0 +1,35 @@
+-- Managed services are databases DeployKnot runs on a target from their official images, with a
+-- generated password and a persistent volume. Each deployment of one has deployment_type 'managed'.
+CREATE TABLE deploy_knot.managed_services (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES deploy_knot.users(id) ON DELETE CASCADE,
+    name VARCHAR(63) NOT NULL,
+    -- postgres, mysql or redis
+    engine VARCHAR(20) NOT NULL,
+    version VARCHAR(128) NOT NULL,
+    target_ip VARCHAR(45) NOT NULL,
+    port INTEGER NOT NULL,
+    database_name VARCHAR(63),
+    username VARCHAR(63),
+    password_encrypted TEXT NOT NULL,
+    volume VARCHAR(200) NOT NULL,
+    -- Cron expression of when the volume is backed up; NULL disables backups
+    backup_schedule VARCHAR(100),
+    backup_retention INTEGER NOT NULL DEFAULT 7,
+    -- The latest deployment of the service
+    deployment_id UUID REFERENCES deploy_knot.deployments(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, target_ip, name)
+);
+
+CREATE TRIGGER update_managed_services_updated_at
+    BEFORE UPDATE ON deploy_knot.managed_services
+    FOR EACH ROW EXECUTE FUNCTION deploy_knot.update_updated_at_column();
+
+ALTER TABLE deploy_knot.deployments
+    DROP CONSTRAINT IF EXISTS deployments_deployment_type_check,
+    ADD CONSTRAINT deployments_deployment_type_check CHECK (deployment_type IN ('docker', 'script', 'managed'));
+
+-- Comma-separated names of the managed services whose connection variables the container gets
+ALTER TABLE deploy_knot.deployments ADD COLUMN managed_services VARCHAR(1000);
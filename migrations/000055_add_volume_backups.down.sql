@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS deploy_knot.volume_backups;
+DROP INDEX IF EXISTS deploy_knot.idx_managed_services_next_backup_at;
+ALTER TABLE deploy_knot.managed_services DROP COLUMN IF EXISTS next_backup_at;
@@ -0,0 +1,29 @@
+-- When the next scheduled backup of a managed service is due; NULL without a backup schedule
+ALTER TABLE deploy_knot.managed_services ADD COLUMN next_backup_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_managed_services_next_backup_at ON deploy_knot.managed_services(next_backup_at) WHERE next_backup_at IS NOT NULL;
+
+-- Backups of the data of managed services, kept as objects in S3-compatible storage
+CREATE TABLE deploy_knot.volume_backups (
+    id UUID PRIMARY KEY,
+    managed_service_id UUID NOT NULL REFERENCES deploy_knot.managed_services(id) ON DELETE CASCADE,
+    -- pg_dump, mysqldump or tar
+    method VARCHAR(20) NOT NULL,
+    -- scheduled or manual
+    trigger_type VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    object_key VARCHAR(500) NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    sha256 VARCHAR(64),
+    error_message TEXT,
+    created_by UUID REFERENCES deploy_knot.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    -- The latest restore of the backup
+    restore_status VARCHAR(20) CHECK (restore_status IN ('running', 'completed', 'failed')),
+    restore_error TEXT,
+    restored_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_volume_backups_managed_service ON deploy_knot.volume_backups(managed_service_id, created_at DESC);
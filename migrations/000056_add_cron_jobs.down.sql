@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS deploy_knot.cron_job_runs;
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS cron_removed_at;
+ALTER TABLE deploy_knot.deployments DROP COLUMN IF EXISTS cron_schedule;
+DELETE FROM deploy_knot.deployments WHERE deployment_type = 'cron';
+ALTER TABLE deploy_knot.deployments
+    DROP CONSTRAINT IF EXISTS deployments_deployment_type_check,
+    ADD CONSTRAINT deployments_deployment_type_check CHECK (deployment_type IN ('docker', 'script', 'managed'));
@@ -0,0 +1,26 @@
+-- Cron deployments build an image and install a crontab entry on the target that runs it on a
+-- schedule as a one-shot container
+ALTER TABLE deploy_knot.deployments
+    DROP CONSTRAINT IF EXISTS deployments_deployment_type_check,
+    ADD CONSTRAINT deployments_deployment_type_check CHECK (deployment_type IN ('docker', 'script', 'managed', 'cron'));
+
+-- Cron expression the job runs on; NULL for other deployment types
+ALTER TABLE deploy_knot.deployments ADD COLUMN cron_schedule VARCHAR(100);
+-- When the crontab entry of the job was removed from the target
+ALTER TABLE deploy_knot.deployments ADD COLUMN cron_removed_at TIMESTAMP WITH TIME ZONE;
+
+-- Runs of cron jobs, collected from the targets they run on
+CREATE TABLE deploy_knot.cron_job_runs (
+    id UUID PRIMARY KEY,
+    deployment_id UUID NOT NULL REFERENCES deploy_knot.deployments(id) ON DELETE CASCADE,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    exit_code INTEGER NOT NULL,
+    -- The end of the container's output
+    output TEXT,
+    output_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    collected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (deployment_id, started_at)
+);
+
+CREATE INDEX idx_cron_job_runs_deployment ON deploy_knot.cron_job_runs(deployment_id, started_at DESC);
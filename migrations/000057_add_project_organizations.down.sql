@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS deploy_knot.idx_projects_organization_id;
+ALTER TABLE deploy_knot.projects DROP COLUMN IF EXISTS organization_id;
@@ -0,0 +1,6 @@
+-- Projects belong to an organization: only its members deploy under the project's name, and the
+-- project's status page and badge only show their deployments
+ALTER TABLE deploy_knot.projects ADD COLUMN organization_id UUID
+    REFERENCES deploy_knot.organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_projects_organization_id ON deploy_knot.projects(organization_id);
@@ -0,0 +1,36 @@
+DROP TABLE IF EXISTS ssh_ca_keys;
+DROP TABLE IF EXISTS project_signing_keys;
+DROP TABLE IF EXISTS deployment_changelogs;
+DROP TABLE IF EXISTS github_deployments;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS worker_tokens;
+DROP TABLE IF EXISTS command_templates;
+DROP TABLE IF EXISTS log_sink_cursors;
+DROP TABLE IF EXISTS project_badge_tokens;
+DROP TABLE IF EXISTS project_on_call;
+DROP TABLE IF EXISTS incident_deployments;
+DROP TABLE IF EXISTS deployment_incidents;
+DROP TABLE IF EXISTS project_incident_policies;
+DROP TABLE IF EXISTS deployment_escalations;
+DROP TABLE IF EXISTS project_escalations;
+DROP TABLE IF EXISTS project_digests;
+DROP TABLE IF EXISTS deployment_gates;
+DROP TABLE IF EXISTS project_gates;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS project_freeze_windows;
+DROP TABLE IF EXISTS deployment_schedules;
+DROP TABLE IF EXISTS deployment_artifacts;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS saved_views;
+DROP TABLE IF EXISTS deployment_comments;
+DROP TABLE IF EXISTS exec_sessions;
+DROP TABLE IF EXISTS job_outbox;
+DROP TABLE IF EXISTS project_targets;
+DROP TABLE IF EXISTS deployment_templates;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS deployment_steps;
+DROP TABLE IF EXISTS deployment_logs;
+DROP TABLE IF EXISTS deployments;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS users;
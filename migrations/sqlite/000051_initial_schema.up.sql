@@ -0,0 +1,531 @@
+-- The schema of SQLite databases, as PostgreSQL migrations 1 to 51 leave it. Its version is the
+-- version of the last of them, so later migrations add a migration to both directories.
+--
+-- Types follow the PostgreSQL schema: UUIDs and JSON are stored as text, arrays as text in the
+-- PostgreSQL array format, and timestamps as UTC text with nanoseconds, which sorts in time order.
+-- gen_random_uuid() is provided by DeployKnot's SQLite driver. Row-level security has no
+-- counterpart; the updated_at columns PostgreSQL sets with triggers are set by the driver.
+
+CREATE TABLE users (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    username VARCHAR(100) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    organization_id TEXT REFERENCES organizations(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_users_username ON users(username);
+CREATE INDEX idx_users_email ON users(email);
+CREATE INDEX idx_users_is_active ON users(is_active);
+CREATE INDEX idx_users_role ON users(role);
+CREATE INDEX idx_users_organization_id ON users(organization_id);
+
+CREATE TABLE organizations (
+    id TEXT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    isolation_mode VARCHAR(20) NOT NULL DEFAULT 'shared' CHECK (isolation_mode IN ('shared', 'rls')),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    allowed_cidrs TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE deployments (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled')),
+    target_ip VARCHAR(45) NOT NULL,
+    ssh_username VARCHAR(100) NOT NULL,
+    ssh_password_encrypted TEXT,
+    github_repo_url VARCHAR(500) NOT NULL,
+    github_pat_encrypted TEXT,
+    github_branch VARCHAR(100) NOT NULL DEFAULT 'main',
+    additional_vars TEXT,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    error_message TEXT,
+    created_by VARCHAR(100),
+    project_name VARCHAR(200),
+    deployment_name VARCHAR(200),
+    environment_vars TEXT,
+    port INTEGER DEFAULT 3000,
+    container_name VARCHAR(200),
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+    deployment_type VARCHAR(20) NOT NULL DEFAULT 'docker' CHECK (deployment_type IN ('docker', 'script')),
+    script_path VARCHAR(500),
+    script_content TEXT,
+    target_type VARCHAR(20) NOT NULL DEFAULT 'ssh' CHECK (target_type IN ('ssh', 'kubernetes')),
+    kubeconfig_encrypted TEXT,
+    kubernetes_namespace VARCHAR(253),
+    image VARCHAR(500),
+    manifests_path VARCHAR(500),
+    organization_id TEXT REFERENCES organizations(id) ON DELETE SET NULL,
+    repo_subdirectory VARCHAR(500),
+    git_lfs BOOLEAN NOT NULL DEFAULT FALSE,
+    concurrency_group VARCHAR(200),
+    superseded_by TEXT REFERENCES deployments(id) ON DELETE SET NULL,
+    one_time_credentials BOOLEAN NOT NULL DEFAULT FALSE,
+    worker_pool VARCHAR(63),
+    gpus VARCHAR(255),
+    extra_run_args TEXT,
+    schedule_id TEXT REFERENCES deployment_schedules(id) ON DELETE SET NULL,
+    commit_sha VARCHAR(40),
+    failure_category VARCHAR(20)
+);
+
+CREATE INDEX idx_deployments_status ON deployments(status);
+CREATE INDEX idx_deployments_created_at ON deployments(created_at);
+CREATE INDEX idx_deployments_container_name ON deployments(container_name);
+CREATE INDEX idx_deployments_user_id ON deployments(user_id);
+CREATE INDEX idx_deployments_user_id_status ON deployments(user_id, status);
+CREATE INDEX idx_deployments_target_ip ON deployments(target_ip);
+CREATE INDEX idx_deployments_organization_id ON deployments(organization_id);
+CREATE INDEX idx_deployments_active_concurrency_group ON deployments(concurrency_group)
+    WHERE status IN ('pending', 'running');
+CREATE INDEX idx_deployments_pending_branch ON deployments(github_branch, target_ip)
+    WHERE status = 'pending';
+CREATE INDEX idx_deployments_schedule_id ON deployments(schedule_id) WHERE schedule_id IS NOT NULL;
+CREATE INDEX idx_deployments_failure_category ON deployments(project_name, failure_category)
+    WHERE failure_category IS NOT NULL;
+
+CREATE TABLE deployment_logs (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    log_level VARCHAR(10) NOT NULL DEFAULT 'info' CHECK (log_level IN ('info', 'warn', 'error', 'debug')),
+    message TEXT NOT NULL,
+    task_name VARCHAR(100),
+    step_order INTEGER,
+    seq INTEGER,
+    category VARCHAR(20),
+    event_code VARCHAR(64),
+    params TEXT
+);
+
+CREATE INDEX idx_deployment_logs_deployment_id ON deployment_logs(deployment_id);
+CREATE INDEX idx_deployment_logs_created_at ON deployment_logs(created_at);
+CREATE INDEX idx_deployment_logs_deployment_id_seq ON deployment_logs(deployment_id, seq);
+CREATE INDEX idx_deployment_logs_seq ON deployment_logs(seq);
+
+-- The sequence PostgreSQL numbers the logs with; writes are serialized, so logs are numbered in
+-- commit order
+CREATE TRIGGER deployment_logs_seq AFTER INSERT ON deployment_logs
+WHEN NEW.seq IS NULL
+BEGIN
+    UPDATE deployment_logs SET seq = (SELECT COALESCE(MAX(seq), 0) + 1 FROM deployment_logs) WHERE id = NEW.id;
+END;
+
+CREATE TABLE deployment_steps (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    step_name VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    duration_ms INTEGER,
+    error_message TEXT,
+    step_order INTEGER NOT NULL,
+    output TEXT,
+    depends_on TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX idx_deployment_steps_deployment_id ON deployment_steps(deployment_id);
+CREATE INDEX idx_deployment_steps_status ON deployment_steps(status);
+
+CREATE TABLE projects (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name VARCHAR(200) NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    is_active BOOLEAN DEFAULT TRUE,
+    worker_pool VARCHAR(63),
+    owner VARCHAR(200),
+    public_status BOOLEAN NOT NULL DEFAULT FALSE,
+    image_signature_policy VARCHAR(20) NOT NULL DEFAULT 'off' CHECK (image_signature_policy IN ('off', 'warn', 'enforce'))
+);
+
+CREATE INDEX idx_projects_is_active ON projects(is_active);
+
+CREATE TABLE deployment_templates (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name VARCHAR(200) NOT NULL,
+    description TEXT,
+    playbook_template TEXT NOT NULL,
+    default_vars TEXT,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    is_active BOOLEAN DEFAULT TRUE,
+    project_id TEXT REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_deployment_templates_is_active ON deployment_templates(is_active);
+CREATE UNIQUE INDEX idx_deployment_templates_project_id_name
+    ON deployment_templates(project_id, name) WHERE project_id IS NOT NULL;
+
+CREATE TABLE project_targets (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    target_type VARCHAR(20) NOT NULL DEFAULT 'ssh' CHECK (target_type IN ('ssh', 'kubernetes')),
+    target_ip VARCHAR(255),
+    ssh_username VARCHAR(100),
+    port INTEGER,
+    kubernetes_namespace VARCHAR(253),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    worker_pool VARCHAR(63),
+    ssh_key_fingerprint VARCHAR(100),
+    ssh_host_key_fingerprint VARCHAR(100),
+    bootstrapped_at TIMESTAMP,
+    UNIQUE (project_id, name)
+);
+
+CREATE TABLE job_outbox (
+    id TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    payload_encrypted TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    published_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    held BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_job_outbox_unpublished ON job_outbox(created_at) WHERE published_at IS NULL;
+CREATE INDEX idx_job_outbox_deployment_id ON job_outbox(deployment_id);
+
+CREATE TABLE exec_sessions (
+    id TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    username VARCHAR(255) NOT NULL,
+    client_ip VARCHAR(64),
+    container_name VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    ended_at TIMESTAMP,
+    exit_code INTEGER,
+    end_reason TEXT,
+    input_transcript TEXT NOT NULL DEFAULT '',
+    input_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    output_bytes BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_exec_sessions_deployment_id ON exec_sessions(deployment_id, started_at);
+
+CREATE TABLE deployment_comments (
+    id TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    username VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    mentions TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE INDEX idx_deployment_comments_deployment_id ON deployment_comments(deployment_id, created_at);
+
+CREATE TABLE saved_views (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    filters TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE user_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    last_login_at TIMESTAMP,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+CREATE TABLE audit_events (
+    id TEXT PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    username VARCHAR(255),
+    organization_id TEXT REFERENCES organizations(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at DESC);
+CREATE INDEX idx_audit_events_user_id ON audit_events(user_id);
+
+CREATE TABLE deployment_artifacts (
+    id TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    compressed_size BIGINT NOT NULL,
+    truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    content BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (deployment_id, name)
+);
+
+CREATE INDEX idx_deployment_artifacts_created_at ON deployment_artifacts(created_at);
+
+CREATE TABLE deployment_schedules (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    project VARCHAR(500) NOT NULL,
+    source_deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    github_branch VARCHAR(255),
+    cron_expression VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    last_deployment_id TEXT REFERENCES deployments(id) ON DELETE SET NULL,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX idx_deployment_schedules_due ON deployment_schedules(next_run_at) WHERE enabled;
+CREATE INDEX idx_deployment_schedules_project ON deployment_schedules(project);
+
+CREATE TABLE project_freeze_windows (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_project_freeze_windows_project_id_ends_at ON project_freeze_windows(project_id, ends_at);
+
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE project_gates (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    timeout_minutes INTEGER NOT NULL CHECK (timeout_minutes > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (project_id, name)
+);
+
+CREATE TABLE deployment_gates (
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'passed', 'failed', 'timed_out')),
+    expires_at TIMESTAMP NOT NULL,
+    details TEXT,
+    url TEXT,
+    reported_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    reported_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    PRIMARY KEY (deployment_id, name)
+);
+
+CREATE INDEX idx_deployment_gates_waiting_expires_at ON deployment_gates(expires_at) WHERE status = 'waiting';
+
+CREATE TABLE project_digests (
+    project_id TEXT PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    channel VARCHAR(63) NOT NULL,
+    cron_expression VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    next_send_at TIMESTAMP,
+    last_sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE project_escalations (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    environments TEXT NOT NULL DEFAULT '{}',
+    after_minutes INTEGER NOT NULL CHECK (after_minutes > 0),
+    channel VARCHAR(63) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE INDEX idx_project_escalations_project_id ON project_escalations(project_id);
+
+CREATE TABLE deployment_escalations (
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    escalation_id TEXT NOT NULL REFERENCES project_escalations(id) ON DELETE CASCADE,
+    sent_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    PRIMARY KEY (deployment_id, escalation_id)
+);
+
+CREATE TABLE project_incident_policies (
+    project_id TEXT PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    service VARCHAR(63) NOT NULL,
+    environments TEXT NOT NULL DEFAULT '{}',
+    severity VARCHAR(20) NOT NULL DEFAULT 'critical' CHECK (severity IN ('critical', 'error', 'warning', 'info')),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE deployment_incidents (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    environment VARCHAR(200) NOT NULL,
+    service VARCHAR(63) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'triggered' CHECK (status IN ('triggered', 'resolved')),
+    deployment_id TEXT REFERENCES deployments(id) ON DELETE SET NULL,
+    failures INTEGER NOT NULL DEFAULT 1,
+    last_failed_at TIMESTAMP NOT NULL,
+    resolved_by_deployment_id TEXT REFERENCES deployments(id) ON DELETE SET NULL,
+    pending_event VARCHAR(20) CHECK (pending_event IN ('trigger', 'resolve')),
+    last_error TEXT,
+    triggered_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    resolved_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_deployment_incidents_triggered ON deployment_incidents(project_id, environment)
+    WHERE status = 'triggered';
+CREATE INDEX idx_deployment_incidents_pending_event ON deployment_incidents(triggered_at)
+    WHERE pending_event IS NOT NULL;
+
+CREATE TABLE incident_deployments (
+    deployment_id TEXT PRIMARY KEY REFERENCES deployments(id) ON DELETE CASCADE,
+    incident_id TEXT NOT NULL REFERENCES deployment_incidents(id) ON DELETE CASCADE
+);
+
+CREATE TABLE project_on_call (
+    project_id TEXT PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    contact VARCHAR(200),
+    source VARCHAR(100),
+    since TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    until TIMESTAMP,
+    previous_name VARCHAR(200),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE project_badge_tokens (
+    project_id TEXT PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL,
+    token_prefix VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE log_sink_cursors (
+    sink VARCHAR(64) PRIMARY KEY,
+    last_seq BIGINT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    shipped_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE command_templates (
+    step VARCHAR(50) PRIMARY KEY,
+    template TEXT NOT NULL,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE worker_tokens (
+    id TEXT PRIMARY KEY,
+    worker_id VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(255)
+);
+
+CREATE UNIQUE INDEX idx_worker_tokens_active_worker ON worker_tokens(worker_id) WHERE revoked_at IS NULL;
+
+CREATE TABLE jobs (
+    id TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    pool VARCHAR(100) NOT NULL DEFAULT '',
+    requeues INTEGER NOT NULL DEFAULT 0,
+    deferrals INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE INDEX idx_jobs_deployment_id ON jobs(deployment_id);
+CREATE INDEX idx_jobs_created_at ON jobs(created_at DESC);
+
+CREATE TABLE github_deployments (
+    deployment_id TEXT PRIMARY KEY REFERENCES deployments(id) ON DELETE CASCADE,
+    github_deployment_id BIGINT,
+    reported_status VARCHAR(20),
+    attempted_status VARCHAR(20),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE deployment_changelogs (
+    deployment_id TEXT PRIMARY KEY REFERENCES deployments(id) ON DELETE CASCADE,
+    base_deployment_id TEXT REFERENCES deployments(id) ON DELETE SET NULL,
+    base_commit_sha VARCHAR(40) NOT NULL,
+    head_commit_sha VARCHAR(40) NOT NULL,
+    commits TEXT NOT NULL DEFAULT '[]',
+    total_commits INTEGER NOT NULL DEFAULT 0,
+    compare_url TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE project_signing_keys (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name VARCHAR(200) NOT NULL,
+    public_key TEXT NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (project_id, name)
+);
+
+CREATE TABLE ssh_ca_keys (
+    id TEXT PRIMARY KEY,
+    name VARCHAR(200) NOT NULL UNIQUE,
+    public_key TEXT NOT NULL,
+    private_key_encrypted TEXT NOT NULL,
+    fingerprint VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'active', 'retiring')),
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    activated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_ssh_ca_keys_active ON ssh_ca_keys(status) WHERE status = 'active';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_deployments_application_release_id;
+ALTER TABLE deployments DROP COLUMN application_service;
+ALTER TABLE deployments DROP COLUMN application_release_id;
+DROP TABLE IF EXISTS application_releases;
+DROP TABLE IF EXISTS applications;
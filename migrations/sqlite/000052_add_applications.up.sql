@@ -0,0 +1,27 @@
+-- Applications and their releases; see PostgreSQL migration 52
+
+CREATE TABLE applications (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(63) NOT NULL,
+    description TEXT,
+    services TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE application_releases (
+    id TEXT PRIMARY KEY,
+    application_id TEXT NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_ip VARCHAR(45) NOT NULL,
+    services TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE INDEX idx_application_releases_application ON application_releases(application_id, created_at DESC);
+
+ALTER TABLE deployments ADD COLUMN application_release_id TEXT REFERENCES application_releases(id) ON DELETE SET NULL;
+ALTER TABLE deployments ADD COLUMN application_service VARCHAR(63);
+CREATE INDEX idx_deployments_application_release_id ON deployments(application_release_id) WHERE application_release_id IS NOT NULL;
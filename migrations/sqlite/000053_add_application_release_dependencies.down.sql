@@ -0,0 +1 @@
+ALTER TABLE application_releases DROP COLUMN dependencies;
@@ -0,0 +1,2 @@
+-- Dependencies of the services of application releases; see PostgreSQL migration 53
+ALTER TABLE application_releases ADD COLUMN dependencies TEXT NOT NULL DEFAULT '{}';
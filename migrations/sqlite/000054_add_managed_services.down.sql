@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS managed_services;
+ALTER TABLE deployments DROP COLUMN managed_services;
+DELETE FROM deployments WHERE deployment_type = 'managed';
+PRAGMA writable_schema = ON;
+UPDATE sqlite_schema
+SET sql = replace(sql, 'CHECK (deployment_type IN (''docker'', ''script'', ''managed''))', 'CHECK (deployment_type IN (''docker'', ''script''))')
+WHERE type = 'table' AND name = 'deployments';
+PRAGMA writable_schema = RESET;
@@ -0,0 +1,31 @@
+-- Managed services; see PostgreSQL migration 54
+
+CREATE TABLE managed_services (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(63) NOT NULL,
+    engine VARCHAR(20) NOT NULL,
+    version VARCHAR(128) NOT NULL,
+    target_ip VARCHAR(45) NOT NULL,
+    port INTEGER NOT NULL,
+    database_name VARCHAR(63),
+    username VARCHAR(63),
+    password_encrypted TEXT NOT NULL,
+    volume VARCHAR(200) NOT NULL,
+    backup_schedule VARCHAR(100),
+    backup_retention INTEGER NOT NULL DEFAULT 7,
+    deployment_id TEXT REFERENCES deployments(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (user_id, target_ip, name)
+);
+
+-- SQLite cannot alter a CHECK constraint, so the stored definition of the table is rewritten;
+-- existing rows already satisfy the wider constraint
+PRAGMA writable_schema = ON;
+UPDATE sqlite_schema
+SET sql = replace(sql, 'CHECK (deployment_type IN (''docker'', ''script''))', 'CHECK (deployment_type IN (''docker'', ''script'', ''managed''))')
+WHERE type = 'table' AND name = 'deployments';
+PRAGMA writable_schema = RESET;
+
+ALTER TABLE deployments ADD COLUMN managed_services VARCHAR(1000);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS volume_backups;
+DROP INDEX IF EXISTS idx_managed_services_next_backup_at;
+ALTER TABLE managed_services DROP COLUMN next_backup_at;
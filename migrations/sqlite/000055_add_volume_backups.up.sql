@@ -0,0 +1,26 @@
+-- Backups of managed services; see PostgreSQL migration 55
+
+ALTER TABLE managed_services ADD COLUMN next_backup_at TIMESTAMP;
+
+CREATE INDEX idx_managed_services_next_backup_at ON managed_services(next_backup_at) WHERE next_backup_at IS NOT NULL;
+
+CREATE TABLE volume_backups (
+    id TEXT PRIMARY KEY,
+    managed_service_id TEXT NOT NULL REFERENCES managed_services(id) ON DELETE CASCADE,
+    method VARCHAR(20) NOT NULL,
+    trigger_type VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    object_key VARCHAR(500) NOT NULL,
+    size_bytes INTEGER NOT NULL DEFAULT 0,
+    sha256 VARCHAR(64),
+    error_message TEXT,
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    restore_status VARCHAR(20) CHECK (restore_status IN ('running', 'completed', 'failed')),
+    restore_error TEXT,
+    restored_at TIMESTAMP
+);
+
+CREATE INDEX idx_volume_backups_managed_service ON volume_backups(managed_service_id, created_at DESC);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS cron_job_runs;
+ALTER TABLE deployments DROP COLUMN cron_removed_at;
+ALTER TABLE deployments DROP COLUMN cron_schedule;
+DELETE FROM deployments WHERE deployment_type = 'cron';
+PRAGMA writable_schema = ON;
+UPDATE sqlite_schema
+SET sql = replace(sql, 'CHECK (deployment_type IN (''docker'', ''script'', ''managed'', ''cron''))', 'CHECK (deployment_type IN (''docker'', ''script'', ''managed''))')
+WHERE type = 'table' AND name = 'deployments';
+PRAGMA writable_schema = RESET;
@@ -0,0 +1,24 @@
+-- Cron jobs; see PostgreSQL migration 56
+
+PRAGMA writable_schema = ON;
+UPDATE sqlite_schema
+SET sql = replace(sql, 'CHECK (deployment_type IN (''docker'', ''script'', ''managed''))', 'CHECK (deployment_type IN (''docker'', ''script'', ''managed'', ''cron''))')
+WHERE type = 'table' AND name = 'deployments';
+PRAGMA writable_schema = RESET;
+
+ALTER TABLE deployments ADD COLUMN cron_schedule VARCHAR(100);
+ALTER TABLE deployments ADD COLUMN cron_removed_at TIMESTAMP;
+
+CREATE TABLE cron_job_runs (
+    id TEXT PRIMARY KEY,
+    deployment_id TEXT NOT NULL REFERENCES deployments(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    exit_code INTEGER NOT NULL,
+    output TEXT,
+    output_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    collected_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    UNIQUE (deployment_id, started_at)
+);
+
+CREATE INDEX idx_cron_job_runs_deployment ON cron_job_runs(deployment_id, started_at DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_projects_organization_id;
+ALTER TABLE projects DROP COLUMN organization_id;
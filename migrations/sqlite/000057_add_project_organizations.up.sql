@@ -0,0 +1,5 @@
+-- Project organizations; see PostgreSQL migration 57
+
+ALTER TABLE projects ADD COLUMN organization_id TEXT REFERENCES organizations(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_projects_organization_id ON projects(organization_id);